@@ -15,6 +15,14 @@ if [[ ! $REPLY =~ ^[Yy]$ ]]; then
     exit 0
 fi
 
+# CloudFormation only deletes empty buckets
+EXPORTS_BUCKET=$(aws cloudformation describe-stacks --stack-name nexusscan-stack \
+    --query "Stacks[0].Outputs[?OutputKey=='ExportsBucketName'].OutputValue" --output text 2>/dev/null)
+if [ -n "$EXPORTS_BUCKET" ] && [ "$EXPORTS_BUCKET" != "None" ]; then
+    echo -e "${YELLOW}Emptying exports bucket $EXPORTS_BUCKET...${NC}"
+    aws s3 rm "s3://$EXPORTS_BUCKET" --recursive
+fi
+
 echo -e "${YELLOW}Deleting CloudFormation stack...${NC}"
 aws cloudformation delete-stack --stack-name nexusscan-stack
 
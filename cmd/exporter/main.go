@@ -0,0 +1,13 @@
+// cmd/exporter/main.go
+
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/exporter"
+)
+
+// The exporter Lambda renders exports requested through the API
+func main() {
+	lambda.Start(exporter.HandleExport)
+}
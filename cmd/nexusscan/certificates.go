@@ -0,0 +1,84 @@
+// cmd/nexusscan/certificates.go
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// runCertificates lists the certificate inventory, soonest expiry first
+func runCertificates(args []string) error {
+	flags := flag.NewFlagSet("certificates", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	expiring := flags.Int("expiring", -1, "only certificates expiring within this many days, or already expired")
+	selfSigned := flags.Bool("self-signed", false, "only self-signed certificates")
+	mismatched := flags.Bool("mismatched", false, "only certificates served for a hostname they do not cover")
+	issuer := flags.String("issuer", "", "only certificates whose issuer contains this")
+	limit := flags.Int("limit", 100, "most certificates per page (up to 1000)")
+	cursor := flags.String("cursor", "", "page to list, from the previous page")
+	args = parseArgs(flags, args)
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(*limit)}}
+	if *expiring >= 0 {
+		query.Set("expiringWithin", strconv.Itoa(*expiring))
+	}
+	if *selfSigned {
+		query.Set("selfSigned", "true")
+	}
+	if *mismatched {
+		query.Set("mismatched", "true")
+	}
+	if *issuer != "" {
+		query.Set("issuer", *issuer)
+	}
+	if *cursor != "" {
+		query.Set("cursor", *cursor)
+	}
+
+	var response struct {
+		Certificates []models.Certificate `json:"certificates"`
+		Count        int                  `json:"count"`
+		Total        int                  `json:"total"`
+		NextCursor   string               `json:"nextCursor,omitempty"`
+	}
+	if err := client.call(context.Background(), "GET", "certificates", query, nil, &response); err != nil {
+		return err
+	}
+
+	t := &table{header: []string{"FINGERPRINT", "SUBJECT", "ISSUER", "NOT AFTER", "DAYS LEFT", "SERVED ON", "FLAGS"}}
+	for _, cert := range response.Certificates {
+		var servedOn []string
+		for _, location := range cert.CurrentLocations() {
+			servedOn = append(servedOn, fmt.Sprintf("%s:%d", location.IPAddress, location.Port))
+		}
+		var certFlags []string
+		if cert.SelfSigned {
+			certFlags = append(certFlags, "self-signed")
+		}
+		if cert.Mismatched {
+			certFlags = append(certFlags, "mismatched")
+		}
+		fingerprint := cert.Fingerprint
+		if len(fingerprint) > 16 {
+			fingerprint = fingerprint[:16]
+		}
+		t.add(fingerprint, orDash(cert.SubjectCN), orDash(cert.IssuerCN), cert.NotAfter.Format("2006-01-02"),
+			fmt.Sprint(cert.DaysLeft), orDash(strings.Join(servedOn, ",")), orDash(strings.Join(certFlags, ",")))
+	}
+	return renderPage(opts.output, response, t, response.NextCursor)
+}
@@ -0,0 +1,165 @@
+// cmd/nexusscan/client.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultEndpoint is where nexusscan serve listens by default
+const defaultEndpoint = "http://127.0.0.1:8080/"
+
+// clientOptions are the flags shared by every command that talks to the API
+type clientOptions struct {
+	endpoint string
+	token    string
+	output   string
+}
+
+// addClientFlags registers the API and output flags on a command
+func addClientFlags(flags *flag.FlagSet) *clientOptions {
+	opts := &clientOptions{}
+	flags.StringVar(&opts.endpoint, "api", firstEnv(defaultEndpoint, "NEXUSSCAN_API", "API_ENDPOINT"), "API endpoint, from $NEXUSSCAN_API or $API_ENDPOINT if set")
+	flags.StringVar(&opts.token, "token", firstEnv("", "NEXUSSCAN_TOKEN", "TOKEN"), "Cognito ID token or serve token, from $NEXUSSCAN_TOKEN or $TOKEN if set")
+	flags.StringVar(&opts.output, "o", outputTable, "output format: table, json or csv")
+	return opts
+}
+
+// parseArgs parses flags given before, between or after the positional
+// arguments, which it returns. Arguments after "--" are all positional.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		rest := flags.Args()
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// firstEnv returns the first non-empty environment variable of names, or
+// fallback
+func firstEnv(fallback string, names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return fallback
+}
+
+// apiClient calls the NexusScan API, deployed or served locally
+type apiClient struct {
+	endpoint string
+	token    string
+	http     *http.Client
+}
+
+// client validates the options and returns a client for them
+func (o *clientOptions) client() (*apiClient, error) {
+	if err := checkOutput(o.output); err != nil {
+		return nil, err
+	}
+	endpoint, err := url.Parse(o.endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid API endpoint %q", o.endpoint)
+	}
+	return &apiClient{
+		endpoint: strings.TrimSuffix(o.endpoint, "/"),
+		token:    o.token,
+		http:     &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// apiError is an error response from the API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// call sends a request to path under /api and decodes the JSON response
+// into out. body, if not nil, is sent as JSON.
+func (c *apiClient) call(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+	target := c.endpoint + "/api/" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 300 {
+		var failure struct {
+			Error   string `json:"error"`
+			Message string `json:"message"` // API Gateway's own errors
+		}
+		json.Unmarshal(data, &failure)
+		message := failure.Error
+		if message == "" {
+			message = failure.Message
+		}
+		if message == "" {
+			message = strings.TrimSpace(string(data))
+		}
+		if message == "" {
+			message = http.StatusText(response.StatusCode)
+		}
+		return &apiError{StatusCode: response.StatusCode, Message: message}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding response from %s: %w", path, err)
+	}
+	return nil
+}
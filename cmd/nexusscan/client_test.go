@@ -0,0 +1,115 @@
+// cmd/nexusscan/client_test.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		output     string
+		tags       []string
+	}{
+		{args: nil, positional: nil, output: outputTable},
+		{args: []string{"10.0.0.1", "10.0.0.2"}, positional: []string{"10.0.0.1", "10.0.0.2"}, output: outputTable},
+		{args: []string{"-o", "json", "10.0.0.1"}, positional: []string{"10.0.0.1"}, output: outputJSON},
+		{args: []string{"10.0.0.1", "-o", "csv"}, positional: []string{"10.0.0.1"}, output: outputCSV},
+		{
+			args:       []string{"10.0.0.1", "-tag", "env:prod", "10.0.0.2", "-tag=team:web"},
+			positional: []string{"10.0.0.1", "10.0.0.2"},
+			output:     outputTable,
+			tags:       []string{"env:prod", "team:web"},
+		},
+		{args: []string{"-o", "json", "--", "-o", "csv"}, positional: []string{"-o", "csv"}, output: outputJSON},
+		{args: []string{"10.0.0.1", "--", "-tag"}, positional: []string{"10.0.0.1", "-tag"}, output: outputTable},
+	}
+
+	for _, tt := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		opts := addClientFlags(flags)
+		var tags listFlag
+		flags.Var(&tags, "tag", "")
+		positional := parseArgs(flags, tt.args)
+		if !reflect.DeepEqual(positional, tt.positional) || opts.output != tt.output || !reflect.DeepEqual([]string(tags), tt.tags) {
+			t.Errorf("%q: got %q, -o %s, tags %q; want %q, -o %s, tags %q",
+				tt.args, positional, opts.output, tags, tt.positional, tt.output, tt.tags)
+		}
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	t.Setenv("NEXUSSCAN_API", "")
+	t.Setenv("API_ENDPOINT", "https://abc.execute-api.eu-west-1.amazonaws.com/prod/")
+	t.Setenv("NEXUSSCAN_TOKEN", "")
+	t.Setenv("TOKEN", "from-token")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts := addClientFlags(flags)
+	parseArgs(flags, nil)
+	client, err := opts.client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.endpoint != "https://abc.execute-api.eu-west-1.amazonaws.com/prod" || client.token != "from-token" {
+		t.Errorf("from the environment: got %s with token %q", client.endpoint, client.token)
+	}
+
+	for _, bad := range []clientOptions{
+		{endpoint: defaultEndpoint, output: "xml"},
+		{endpoint: "127.0.0.1:8080", output: outputTable},
+		{endpoint: "", output: outputTable},
+	} {
+		if _, err := bad.client(); err == nil {
+			t.Errorf("%+v: got a client, want an error", bad)
+		}
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	testAPI(t)
+
+	_, _, err := runCommand(t, runIP, "ls", "-token", "wrong")
+	var failure *apiError
+	if !errors.As(err, &failure) || failure.StatusCode != http.StatusUnauthorized || failure.Message != "Unauthorized" {
+		t.Errorf("wrong token: got %v, want Unauthorized (HTTP 401)", err)
+	}
+
+	_, _, err = runCommand(t, runIP, "show", "10.9.9.9")
+	if !errors.As(err, &failure) || failure.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown address: got %v, want HTTP 404", err)
+	}
+
+	// Errors from API Gateway or a proxy in front of the API are reported as
+	// they came
+	tests := []struct {
+		body string
+		want string
+	}{
+		{body: `{"message":"Endpoint request timed out"}`, want: "Endpoint request timed out"},
+		{body: "upstream connect error\n", want: "upstream connect error"},
+		{body: "", want: "Bad Gateway"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, tt.body)
+		}))
+		client := &apiClient{endpoint: server.URL, http: server.Client()}
+		err := client.call(context.Background(), "GET", "ips", nil, nil, nil)
+		server.Close()
+		if !errors.As(err, &failure) || failure.StatusCode != http.StatusBadGateway || failure.Message != tt.want {
+			t.Errorf("%q: got %v, want %s (HTTP 502)", tt.body, err, tt.want)
+		}
+	}
+}
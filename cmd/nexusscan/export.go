@@ -0,0 +1,266 @@
+// cmd/nexusscan/export.go
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/export"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+const exportUsage = `Usage: nexusscan export <command> [flags]
+
+Commands:
+  start                  Export a scan, the history of an address or the inventory
+  status <exportId>...   Show the progress and download link of exports
+  download <exportId>    Download a completed export
+`
+
+// runExport starts, follows and downloads exports
+func runExport(args []string) error {
+	if len(args) == 0 {
+		return usageError(exportUsage)
+	}
+
+	switch args[0] {
+	case "start":
+		return runExportStart(args[1:])
+	case "status":
+		return runExportStatus(args[1:])
+	case "download":
+		return runExportDownload(args[1:])
+	}
+	return usageError(exportUsage)
+}
+
+// exportStatus is an export as the API reports it
+type exportStatus struct {
+	models.ExportJob
+	DownloadURL       string     `json:"downloadUrl,omitempty"`
+	DownloadExpiresAt *time.Time `json:"downloadExpiresAt,omitempty"`
+}
+
+func runExportStart(args []string) error {
+	flags := flag.NewFlagSet("export start", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	format := flags.String("format", "", "export format: "+strings.Join(models.ExportFormats, ", "))
+	scanID := flags.String("scan", "", "export this scan")
+	ip := flags.String("ip", "", "export every scan of this address")
+	wait := flags.Bool("wait", false, "wait for the export to finish")
+	file := flags.String("file", "", "wait, then download the export to this file, - for standard output")
+	selection := addSelectorFlags(flags, "export")
+	if args = parseArgs(flags, args); len(args) > 0 {
+		return fmt.Errorf("unexpected argument %q: choose what to export with -scan, -ip or the selector flags", args[0])
+	}
+	selector, err := selection.selector()
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		return fmt.Errorf("-format is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	request := map[string]interface{}{
+		"format": *format,
+		"scanId": *scanID,
+		"ip":     *ip,
+	}
+	if selector != nil {
+		request["selector"] = selector
+	}
+
+	ctx := context.Background()
+	var started exportStatus
+	if err := client.call(ctx, "POST", "export", nil, request, &started); err != nil {
+		return fmt.Errorf("starting export: %w", err)
+	}
+
+	if *file != "" {
+		status, err := waitForExport(ctx, client, started.ExportID, 2*time.Second)
+		if err != nil {
+			return err
+		}
+		return download(ctx, status, *file)
+	}
+	if *wait {
+		status, err := waitForExport(ctx, client, started.ExportID, 2*time.Second)
+		if err != nil {
+			return err
+		}
+		return renderExports(opts.output, []exportStatus{*status})
+	}
+	return renderExports(opts.output, []exportStatus{started})
+}
+
+func runExportStatus(args []string) error {
+	flags := flag.NewFlagSet("export status", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) == 0 {
+		return fmt.Errorf("at least one export ID is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]exportStatus, 0, len(args))
+	for _, exportID := range args {
+		var status exportStatus
+		if err := client.call(context.Background(), "GET", "export/"+url.PathEscape(exportID), nil, nil, &status); err != nil {
+			return fmt.Errorf("getting export %s: %w", exportID, err)
+		}
+		statuses = append(statuses, status)
+	}
+	return renderExports(opts.output, statuses)
+}
+
+func runExportDownload(args []string) error {
+	flags := flag.NewFlagSet("export download", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	file := flags.String("file", "", "file to download to, - for standard output (default the export ID with the format's extension)")
+	wait := flags.Bool("wait", false, "wait for the export to finish first")
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one export ID is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var status *exportStatus
+	if *wait {
+		status, err = waitForExport(ctx, client, args[0], 2*time.Second)
+		if err != nil {
+			return err
+		}
+	} else {
+		status = &exportStatus{}
+		if err := client.call(ctx, "GET", "export/"+url.PathEscape(args[0]), nil, nil, status); err != nil {
+			return fmt.Errorf("getting export %s: %w", args[0], err)
+		}
+		if status.Status != models.ExportStatusCompleted {
+			return fmt.Errorf("export %s is %s", args[0], status.Status)
+		}
+	}
+	return download(ctx, status, *file)
+}
+
+// waitForExport polls an export until it finishes. It fails if the export
+// failed.
+func waitForExport(ctx context.Context, client *apiClient, exportID string, interval time.Duration) (*exportStatus, error) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	for {
+		var status exportStatus
+		if err := client.call(ctx, "GET", "export/"+url.PathEscape(exportID), nil, nil, &status); err != nil {
+			return nil, fmt.Errorf("getting export %s: %w", exportID, err)
+		}
+		switch status.Status {
+		case models.ExportStatusCompleted:
+			return &status, nil
+		case models.ExportStatusFailed:
+			return nil, fmt.Errorf("export %s failed: %s", exportID, status.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for export %s: %w", exportID, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// download fetches a completed export from its link to path. Links carry
+// their own authorisation, so no token is sent.
+func download(ctx context.Context, status *exportStatus, path string) error {
+	if status.DownloadURL == "" {
+		return fmt.Errorf("export %s has no download link", status.ExportID)
+	}
+	if path == "" {
+		path = status.ExportID + export.Extension(status.Format)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", status.DownloadURL, nil)
+	if err != nil {
+		return err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading export %s: %s", status.ExportID, response.Status)
+	}
+
+	if path == "-" {
+		_, err := io.Copy(os.Stdout, response.Body)
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(file, response.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d hosts with %d open ports to %s (%d bytes)\n", status.Hosts, status.OpenPorts, path, written)
+	return nil
+}
+
+func renderExports(output string, statuses []exportStatus) error {
+	t := &table{header: []string{"EXPORT ID", "FORMAT", "SCOPE", "TARGET", "STATUS", "HOSTS", "OPEN PORTS", "SIZE", "CREATED"}}
+	for _, status := range statuses {
+		target := "-"
+		switch {
+		case status.ScanID != "":
+			target = status.ScanID
+		case status.IPAddress != "":
+			target = status.IPAddress
+		case status.Selector != nil:
+			target = status.Selector.String()
+		}
+		t.add(status.ExportID, status.Format, status.Scope, target, status.Status,
+			fmt.Sprint(status.Hosts), fmt.Sprint(status.OpenPorts), fmt.Sprint(status.Size), formatTime(status.CreatedAt))
+	}
+	if err := render(output, statuses, t); err != nil {
+		return err
+	}
+	if output != outputJSON {
+		for _, status := range statuses {
+			if status.DownloadURL != "" {
+				fmt.Fprintf(os.Stderr, "Download %s: %s\n", status.ExportID, status.DownloadURL)
+			}
+			if status.Error != "" {
+				fmt.Fprintf(os.Stderr, "Export %s failed: %s\n", status.ExportID, status.Error)
+			}
+		}
+	}
+	return nil
+}
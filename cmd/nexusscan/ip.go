@@ -0,0 +1,394 @@
+// cmd/nexusscan/ip.go
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/targets"
+)
+
+const ipUsage = `Usage: nexusscan ip <command> [flags]
+
+Commands:
+  add <target>...   Add addresses, CIDR blocks, ranges or hostnames
+  rm <target>...    Remove addresses, or every address of a block or range
+  ls                List addresses in the inventory
+  show <ip>         Show one address with its tags, group and owner
+  set <ip>...       Change the tags, group, owner or description of addresses
+`
+
+// runIP manages the IP inventory
+func runIP(args []string) error {
+	if len(args) == 0 {
+		return usageError(ipUsage)
+	}
+
+	switch args[0] {
+	case "add":
+		return runIPAdd(args[1:])
+	case "rm":
+		return runIPRemove(args[1:])
+	case "ls":
+		return runIPList(args[1:])
+	case "show":
+		return runIPShow(args[1:])
+	case "set":
+		return runIPSet(args[1:])
+	}
+	return usageError(ipUsage)
+}
+
+func runIPAdd(args []string) error {
+	flags := flag.NewFlagSet("ip add", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	var exclude, tags listFlag
+	flags.Var(&exclude, "exclude", "addresses, blocks or ranges to skip (repeatable or comma-separated)")
+	flags.Var(&tags, "tag", "tag as key:value (repeatable or comma-separated)")
+	group := flags.String("group", "", "asset group")
+	owner := flags.String("owner", "", "owner")
+	description := flags.String("description", "", "description")
+	args = parseArgs(flags, args)
+	if len(args) == 0 {
+		return fmt.Errorf("at least one target is required")
+	}
+
+	metadata := models.AssetMetadata{Group: *group, Owner: *owner, Description: *description}
+	var err error
+	if metadata.Tags, err = parseTagFlag(tags); err != nil {
+		return err
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Message   string   `json:"message"`
+		AddedIPs  []string `json:"addedIPs"`
+		FailedIPs []string `json:"failedIPs,omitempty"`
+		Total     int      `json:"total"`
+	}
+	request := struct {
+		IPs     []string `json:"ips"`
+		Exclude []string `json:"exclude"`
+		models.AssetMetadata
+	}{args, exclude, metadata}
+	if err := client.call(context.Background(), "POST", "ips", nil, request, &response); err != nil {
+		return err
+	}
+
+	t := &table{header: []string{"IP", "STATUS"}}
+	for _, ip := range response.AddedIPs {
+		t.add(ip, "added")
+	}
+	for _, ip := range response.FailedIPs {
+		t.add(ip, "failed")
+	}
+	return render(opts.output, response, t)
+}
+
+func runIPRemove(args []string) error {
+	flags := flag.NewFlagSet("ip rm", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	selection := addSelectorFlags(flags, "remove")
+	args = parseArgs(flags, args)
+	selector, err := selection.selector()
+	if err != nil {
+		return err
+	}
+	if selector != nil && len(args) > 0 {
+		return fmt.Errorf("give either targets or selector flags, not both")
+	}
+	if selector == nil && len(args) == 0 {
+		return fmt.Errorf("at least one target or selector flag is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	if selector != nil {
+		var response struct {
+			Message    string   `json:"message"`
+			DeletedIPs []string `json:"deletedIPs"`
+			FailedIPs  []string `json:"failedIPs,omitempty"`
+			Total      int      `json:"total"`
+		}
+		request := map[string]interface{}{"selector": selector}
+		if err := client.call(context.Background(), "DELETE", "ips", nil, request, &response); err != nil {
+			return err
+		}
+
+		t := &table{header: []string{"TARGET", "RESULT"}}
+		for _, ip := range response.DeletedIPs {
+			t.add(ip, "deleted")
+		}
+		for _, ip := range response.FailedIPs {
+			t.add(ip, "failed")
+		}
+		return render(opts.output, response, t)
+	}
+
+	type removal struct {
+		Target  string `json:"target"`
+		Message string `json:"message"`
+	}
+	var removed []removal
+	t := &table{header: []string{"TARGET", "RESULT"}}
+	for _, target := range args {
+		var response struct {
+			Message string `json:"message"`
+		}
+		// Blocks and ranges are removed by the network they were added from
+		if targets.IsSingleAddress(target) {
+			err = client.call(context.Background(), "DELETE", "ip", nil, map[string]string{"ip": target}, &response)
+		} else {
+			err = client.call(context.Background(), "DELETE", "network", nil, map[string]string{"network": target}, &response)
+		}
+		if err != nil {
+			return fmt.Errorf("removing %s: %w", target, err)
+		}
+		removed = append(removed, removal{Target: target, Message: response.Message})
+		t.add(target, response.Message)
+	}
+	return render(opts.output, removed, t)
+}
+
+func runIPList(args []string) error {
+	flags := flag.NewFlagSet("ip ls", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	network := flags.String("network", "", "only list addresses added from this CIDR block or range")
+	limit := flags.Int("limit", 100, "most addresses per page (up to 1000)")
+	cursor := flags.String("cursor", "", "page to list, from the previous page")
+	all := flags.Bool("all", false, "list every page")
+	sortBy := flags.String("sort", "created", "order by created or lastScanned")
+	desc := flags.Bool("desc", false, "newest first")
+	notScannedFor := flags.String("not-scanned-for", "", "only addresses not scanned for this long, such as 7d or 12h")
+	scannedWithin := flags.String("scanned-within", "", "only addresses scanned within this long, such as 24h")
+	group := flags.String("group", "", "only addresses in this group")
+	owner := flags.String("owner", "", "only addresses with this owner")
+	var tags listFlag
+	flags.Var(&tags, "tag", "only addresses with this tag, as key:value or key for any value (repeatable or comma-separated)")
+	args = parseArgs(flags, args)
+	if _, err := parseTagFlag(tags); err != nil {
+		return err
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		IPs        []models.IP `json:"ips"`
+		Count      int         `json:"count"`
+		Total      int         `json:"total"`
+		NextCursor string      `json:"nextCursor,omitempty"`
+	}
+	ctx := context.Background()
+	if *network != "" {
+		query := url.Values{"network": {*network}}
+		if err := client.call(ctx, "GET", "ips", query, nil, &response); err != nil {
+			return err
+		}
+	} else {
+		query := url.Values{
+			"limit": {strconv.Itoa(*limit)},
+			"sort":  {*sortBy},
+		}
+		if *desc {
+			query.Set("order", "desc")
+		}
+		if *notScannedFor != "" {
+			query.Set("notScannedFor", *notScannedFor)
+		}
+		if *scannedWithin != "" {
+			query.Set("scannedWithin", *scannedWithin)
+		}
+		if *group != "" {
+			query.Set("group", *group)
+		}
+		if *owner != "" {
+			query.Set("owner", *owner)
+		}
+		if len(tags) > 0 {
+			query.Set("tags", tags.String())
+		}
+
+		next := *cursor
+		for {
+			if next != "" {
+				query.Set("cursor", next)
+			}
+			var page struct {
+				IPs        []models.IP `json:"ips"`
+				Total      int         `json:"total"`
+				NextCursor string      `json:"nextCursor"`
+			}
+			if err := client.call(ctx, "GET", "ips", query, nil, &page); err != nil {
+				return err
+			}
+			response.IPs = append(response.IPs, page.IPs...)
+			response.Total = page.Total
+			next = page.NextCursor
+			if !*all || next == "" {
+				break
+			}
+		}
+		response.Count = len(response.IPs)
+		response.NextCursor = next
+	}
+
+	return renderPage(opts.output, response, ipTable(response.IPs), response.NextCursor)
+}
+
+func runIPShow(args []string) error {
+	flags := flag.NewFlagSet("ip show", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one IP address is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	var ip models.IP
+	if err := client.call(context.Background(), "GET", "ip/"+url.PathEscape(args[0]), nil, nil, &ip); err != nil {
+		return err
+	}
+	if opts.output == outputTable && ip.Description != "" {
+		fmt.Println(ip.Description)
+		fmt.Println()
+	}
+	return render(opts.output, ip, ipTable([]models.IP{ip}))
+}
+
+func runIPSet(args []string) error {
+	flags := flag.NewFlagSet("ip set", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	selection := addSelectorFlags(flags, "change")
+	var tags, untag listFlag
+	flags.Var(&tags, "tag", "add or replace a tag, as key:value (repeatable or comma-separated)")
+	flags.Var(&untag, "untag", "remove tags by key (repeatable or comma-separated)")
+	group := flags.String("group", "", "asset group, empty to clear")
+	owner := flags.String("owner", "", "owner, empty to clear")
+	description := flags.String("description", "", "description, empty to clear")
+	args = parseArgs(flags, args)
+
+	selector, err := selection.selector()
+	if err != nil {
+		return err
+	}
+	if selector != nil && len(args) > 0 {
+		return fmt.Errorf("give either IP addresses or selector flags, not both")
+	}
+	if selector == nil && len(args) == 0 {
+		return fmt.Errorf("at least one IP address or selector flag is required")
+	}
+
+	// Only the flags given change anything
+	update := models.AssetMetadataUpdate{RemoveTags: untag}
+	if update.Tags, err = parseTagFlag(tags); err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "group":
+			update.Group = group
+		case "owner":
+			update.Owner = owner
+		case "description":
+			update.Description = description
+		}
+	})
+	if update.IsEmpty() {
+		return fmt.Errorf("nothing to change: give -tag, -untag, -group, -owner or -description")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	request := struct {
+		IPs      []string              `json:"ips,omitempty"`
+		Selector *models.AssetSelector `json:"selector,omitempty"`
+		models.AssetMetadataUpdate
+	}{args, selector, update}
+	var response struct {
+		Message   string      `json:"message"`
+		IPs       []models.IP `json:"ips"`
+		FailedIPs []string    `json:"failedIPs,omitempty"`
+		Total     int         `json:"total"`
+	}
+	if err := client.call(context.Background(), "PUT", "ip-metadata", nil, request, &response); err != nil {
+		return err
+	}
+	if err := render(opts.output, response, ipTable(response.IPs)); err != nil {
+		return err
+	}
+	if len(response.FailedIPs) > 0 {
+		return fmt.Errorf("could not update %s", strings.Join(response.FailedIPs, ", "))
+	}
+	return nil
+}
+
+// ipTable lists addresses with their origin, metadata and scan times
+func ipTable(ips []models.IP) *table {
+	t := &table{header: []string{"IP", "NETWORK", "HOSTNAME", "GROUP", "OWNER", "TAGS", "CREATED", "LAST SCANNED"}}
+	for _, ip := range ips {
+		t.add(ip.IPAddress, orDash(ip.Network), orDash(ip.Hostname), orDash(ip.Group), orDash(ip.Owner),
+			orDash(models.FormatTags(ip.Tags)), formatTime(ip.CreatedAt), formatTime(ip.LastScanned))
+	}
+	return t
+}
+
+// selectorFlags pick addresses by their metadata instead of naming them
+type selectorFlags struct {
+	group string
+	owner string
+	tags  listFlag
+}
+
+// addSelectorFlags registers the selector flags of a command that acts on
+// the addresses selected, as described by verb
+func addSelectorFlags(flags *flag.FlagSet, verb string) *selectorFlags {
+	s := &selectorFlags{}
+	flags.StringVar(&s.group, "select-group", "", verb+" every address in this group")
+	flags.StringVar(&s.owner, "select-owner", "", verb+" every address with this owner")
+	flags.Var(&s.tags, "select-tag", verb+" every address with this tag, as key:value or key for any value (repeatable or comma-separated)")
+	return s
+}
+
+// selector returns the selector the flags describe, or nil if none were given
+func (s *selectorFlags) selector() (*models.AssetSelector, error) {
+	tags, err := parseTagFlag(s.tags)
+	if err != nil {
+		return nil, err
+	}
+	selector := &models.AssetSelector{Group: s.group, Owner: s.owner, Tags: tags}
+	if selector.IsEmpty() {
+		return nil, nil
+	}
+	return selector, nil
+}
+
+// parseTagFlag reads tags given as key:value, or nil if there are none
+func parseTagFlag(tags listFlag) (map[string]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	return models.ParseTags(tags.String())
+}
@@ -0,0 +1,168 @@
+// cmd/nexusscan/ip_test.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// tableRows splits table output into the cells of each row after the
+// header, for tables whose cells hold no spaces
+func tableRows(t *testing.T, output string, header string) [][]string {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if got := strings.Join(strings.Fields(lines[0]), " "); got != header {
+		t.Fatalf("got header %q, want %q", got, header)
+	}
+	var rows [][]string
+	for _, line := range lines[1:] {
+		rows = append(rows, strings.Fields(line))
+	}
+	return rows
+}
+
+const ipHeader = "IP NETWORK HOSTNAME GROUP OWNER TAGS CREATED LAST SCANNED"
+
+// ipRows keeps the columns of ip ls rows that do not change with time
+func ipRows(t *testing.T, output string) [][]string {
+	t.Helper()
+	rows := tableRows(t, output, ipHeader)
+	for i, row := range rows {
+		if len(row) != 8 {
+			t.Fatalf("row %q has %d cells, want 8", row, len(row))
+		}
+		rows[i] = append(row[:6:6], row[7])
+	}
+	return rows
+}
+
+func TestIPCommands(t *testing.T) {
+	testAPI(t)
+
+	out := mustRun(t, runIP, "add", "10.0.0.1", "-group", "web", "10.0.0.2", "-tag", "env:prod,team:ops")
+	want := "IP        STATUS\n10.0.0.1  added\n10.0.0.2  added\n"
+	if out != want {
+		t.Errorf("ip add: got\n%swant\n%s", out, want)
+	}
+
+	var added struct {
+		AddedIPs []string `json:"addedIPs"`
+		Total    int      `json:"total"`
+	}
+	out = mustRun(t, runIP, "add", "10.0.1.0/30", "-exclude", "10.0.1.1", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &added); err != nil || !reflect.DeepEqual(added.AddedIPs, []string{"10.0.1.2"}) {
+		t.Errorf("ip add of a block: got %s, want only 10.0.1.2 added", out)
+	}
+
+	// Without -all, ls prints one page and tells how to get the next
+	stdout, stderr, err := runCommand(t, runIP, "ls", "-limit", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRows := [][]string{
+		{"10.0.0.1", "-", "-", "web", "-", "env:prod,team:ops", "-"},
+		{"10.0.0.2", "-", "-", "web", "-", "env:prod,team:ops", "-"},
+	}
+	if rows := ipRows(t, stdout); !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("ip ls -limit 2: got %q, want %q", rows, wantRows)
+	}
+	cursor := strings.TrimSpace(strings.TrimPrefix(stderr, "More results: rerun with -cursor "))
+	if cursor == "" || cursor == strings.TrimSpace(stderr) {
+		t.Fatalf("ip ls -limit 2: got %q on stderr, want the next cursor", stderr)
+	}
+	stdout, stderr, err = runCommand(t, runIP, "ls", "-limit", "2", "-cursor", cursor)
+	if err != nil || stderr != "" {
+		t.Fatalf("ip ls -cursor: %v, %q", err, stderr)
+	}
+	if rows := ipRows(t, stdout); len(rows) != 1 || rows[0][0] != "10.0.1.2" || rows[0][1] != "10.0.1.0/30" {
+		t.Errorf("ip ls -cursor: got %q, want 10.0.1.2 of 10.0.1.0/30", rows)
+	}
+	if rows := ipRows(t, mustRun(t, runIP, "ls", "-limit", "1", "-all", "-desc")); len(rows) != 3 || rows[2][0] != "10.0.0.1" {
+		t.Errorf("ip ls -all -desc: got %q, want 3 addresses, 10.0.0.1 last", rows)
+	}
+
+	out = mustRun(t, runIP, "ls", "-o", "csv", "-tag", "team:ops", "-group", "web")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || lines[0] != "IP,NETWORK,HOSTNAME,GROUP,OWNER,TAGS,CREATED,LAST SCANNED" ||
+		!strings.HasPrefix(lines[1], `10.0.0.1,-,-,web,-,"env:prod,team:ops",`) {
+		t.Errorf("ip ls -o csv: got\n%s", out)
+	}
+
+	// Only the flags given change anything
+	out = mustRun(t, runIP, "set", "10.0.0.2", "-owner", "alice", "-untag", "env", "-o", "json")
+	var set struct {
+		IPs []models.IP `json:"ips"`
+	}
+	if err := json.Unmarshal([]byte(out), &set); err != nil || len(set.IPs) != 1 {
+		t.Fatalf("ip set -o json: got %s", out)
+	}
+	if ip := set.IPs[0]; ip.Owner != "alice" || ip.Group != "web" || !reflect.DeepEqual(ip.Tags, map[string]string{"team": "ops"}) {
+		t.Errorf("ip set: got owner %q, group %q, tags %v; want alice, web and team:ops", ip.Owner, ip.Group, ip.Tags)
+	}
+
+	mustRun(t, runIP, "set", "-select-tag", "team", "-description", "Web frontend")
+	out = mustRun(t, runIP, "show", "10.0.0.1")
+	if description, table, _ := strings.Cut(out, "\n\n"); description != "Web frontend" {
+		t.Errorf("ip show: got %q, want the description first", out)
+	} else if rows := ipRows(t, table); len(rows) != 1 || rows[0][0] != "10.0.0.1" {
+		t.Errorf("ip show: got %q, want 10.0.0.1", rows)
+	}
+
+	out = mustRun(t, runIP, "rm", "10.0.1.0/30", "10.0.0.2")
+	want = "TARGET       RESULT\n10.0.1.0/30  Deleted 1 IPs from network 10.0.1.0/30\n10.0.0.2     IP deleted successfully\n"
+	if out != want {
+		t.Errorf("ip rm: got\n%swant\n%s", out, want)
+	}
+	out = mustRun(t, runIP, "rm", "-select-group", "web")
+	if want := "TARGET    RESULT\n10.0.0.1  deleted\n"; out != want {
+		t.Errorf("ip rm -select-group: got\n%swant\n%s", out, want)
+	}
+	if rows := ipRows(t, mustRun(t, runIP, "ls")); len(rows) != 0 {
+		t.Errorf("ip ls after removing everything: got %q", rows)
+	}
+}
+
+func TestIPArguments(t *testing.T) {
+	server := testAPI(t)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"add"}, want: "at least one target is required"},
+		{args: []string{"add", "10.0.0.1", "-tag", "env prod:yes"}, want: `invalid tag key "env prod"`},
+		{args: []string{"add", "10.0.0.1", "-o", "xml"}, want: `unknown output format "xml"`},
+		{args: []string{"rm"}, want: "at least one target or selector flag is required"},
+		{args: []string{"rm", "10.0.0.1", "-select-group", "web"}, want: "not both"},
+		{args: []string{"show"}, want: "exactly one IP address is required"},
+		{args: []string{"show", "10.0.0.1", "10.0.0.2"}, want: "exactly one IP address is required"},
+		{args: []string{"set", "10.0.0.1"}, want: "nothing to change"},
+		{args: []string{"set", "-owner", "alice"}, want: "at least one IP address or selector flag is required"},
+		{args: []string{"set", "10.0.0.1", "-select-owner", "bob", "-owner", "alice"}, want: "not both"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := runCommand(t, runIP, tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ip %s: got %v, want an error with %q", strings.Join(tt.args, " "), err, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{nil, {"list"}} {
+		if _, stderr, err := runCommand(t, runIP, args...); err != errUsage || !strings.HasPrefix(stderr, "Usage: nexusscan ip") {
+			t.Errorf("ip %q: got %v, want the usage", args, err)
+		}
+	}
+
+	// None of them reached the API
+	if page, err := server.db.ListIPs(context.Background(), database.IPQuery{Limit: 10}); err != nil || len(page.IPs) != 0 {
+		t.Errorf("got %d addresses added, %v; want none", len(page.IPs), err)
+	}
+}
@@ -0,0 +1,93 @@
+// cmd/nexusscan/main.go
+
+// Command nexusscan runs NexusScan outside AWS and drives a NexusScan API
+// from the command line
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: nexusscan <command> [flags]
+
+Commands:
+  serve         Run the API, scheduler, workers and enrichment in one process
+  ip            Add, remove and list addresses in the inventory
+  scan          Start scans, follow their progress, or scan from this machine
+  schedule      Create, change, list and delete scan schedules
+  results       List the scan results of an address
+  ports         List the ports last found open on an address
+  enrichment    List what enrichment found on an address
+  tls           List the TLS versions, suites and certificates of an address
+  state         List the current state of the ports of an address
+  enrichment-changes
+                List when the title, server, status or certificate of a port changed
+  certificates  List the certificate inventory, soonest expiry first
+  export        Export results as Nmap XML, CSV, JSON Lines or SARIF
+
+Commands that call the API read its address from -api, $NEXUSSCAN_API or
+$API_ENDPOINT, and the token from -token, $NEXUSSCAN_TOKEN or $TOKEN. They
+print a table by default, or JSON or CSV with -o json or -o csv.
+
+Run "nexusscan <command> -h" for the flags of a command.
+`
+
+// errUsage is returned after a command has printed its usage
+var errUsage = errors.New("usage")
+
+// usageError prints the usage of a command with subcommands
+func usageError(text string) error {
+	fmt.Fprint(os.Stderr, text)
+	return errUsage
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "ip":
+		err = runIP(os.Args[2:])
+	case "scan":
+		err = runScan(os.Args[2:])
+	case "schedule":
+		err = runSchedule(os.Args[2:])
+	case "results":
+		err = runResults(os.Args[2:])
+	case "ports":
+		err = runPorts(os.Args[2:])
+	case "enrichment":
+		err = runEnrichment(os.Args[2:])
+	case "tls":
+		err = runTLS(os.Args[2:])
+	case "state":
+		err = runState(os.Args[2:])
+	case "enrichment-changes":
+		err = runEnrichmentChanges(os.Args[2:])
+	case "certificates":
+		err = runCertificates(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "nexusscan %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
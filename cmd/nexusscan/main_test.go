@@ -0,0 +1,132 @@
+// cmd/nexusscan/main_test.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/scheduler"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/local"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// testToken is the bearer token the test API requires
+const testToken = "test-token"
+
+// testServer is the API of nexusscan serve with no workers behind it
+type testServer struct {
+	db        *database.Client
+	functions *local.Functions
+
+	mu    sync.Mutex
+	tasks []scanner.ScanRequest
+}
+
+// testAPI serves the API the way serve does, on an empty local store with
+// the IP, schedule and result stores in memory. Commands reach it through
+// $NEXUSSCAN_API and $NEXUSSCAN_TOKEN. Scan batches the scheduler queues
+// are kept instead of scanned.
+func testAPI(t *testing.T) *testServer {
+	t.Helper()
+	for name, value := range localEnvironment {
+		t.Setenv(name, value)
+	}
+	log.SetOutput(io.Discard)
+
+	tables := database.DefaultTables()
+	store, err := local.OpenStore(filepath.Join(t.TempDir(), "nexusscan.db"), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		db:        database.NewClientWithStore(store, tables, database.NewMemoryStore()),
+		functions: local.NewFunctions(),
+	}
+
+	queues := local.NewQueues()
+	queues.Consume(os.Getenv("TASKS_QUEUE_URL"), local.Consumer{Handler: s.keepTasks})
+	s.functions.Register(os.Getenv("SCHEDULER_FUNCTION"), scheduler.HandleSchedule)
+	platform.Use(&platform.Services{DB: s.db, Queues: queues, Functions: s.functions})
+
+	server := httptest.NewServer(apiHandler(testToken))
+	t.Setenv("NEXUSSCAN_API", server.URL)
+	t.Setenv("NEXUSSCAN_TOKEN", testToken)
+	t.Cleanup(func() {
+		server.Close()
+		s.functions.Wait()
+		queues.Close()
+		platform.Use(nil)
+		store.Close()
+		log.SetOutput(os.Stderr)
+	})
+	return s
+}
+
+// keepTasks stands in for the workers
+func (s *testServer) keepTasks(ctx context.Context, event events.SQSEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, message := range event.Records {
+		var request scanner.ScanRequest
+		if err := json.Unmarshal([]byte(message.Body), &request); err != nil {
+			return err
+		}
+		s.tasks = append(s.tasks, request)
+	}
+	return nil
+}
+
+// runCommand runs a command as main would, returning what it printed on
+// stdout and stderr
+func runCommand(t *testing.T, run func(args []string) error, args ...string) (string, string, error) {
+	t.Helper()
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	var wg sync.WaitGroup
+	outputs := make([]string, 2)
+	writers := make([]*os.File, 2)
+	for i := range writers {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers[i] = w
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, _ := io.ReadAll(r)
+			r.Close()
+			outputs[i] = string(data)
+		}(i)
+	}
+	os.Stdout, os.Stderr = writers[0], writers[1]
+
+	err := run(args)
+	for _, w := range writers {
+		w.Close()
+	}
+	wg.Wait()
+	return outputs[0], outputs[1], err
+}
+
+// mustRun runs a command that must succeed and returns its stdout
+func mustRun(t *testing.T, run func(args []string) error, args ...string) string {
+	t.Helper()
+	stdout, stderr, err := runCommand(t, run, args...)
+	if err != nil {
+		t.Fatalf("%v: %v\n%s", args, err, stderr)
+	}
+	return stdout
+}
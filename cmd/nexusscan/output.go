@@ -0,0 +1,118 @@
+// cmd/nexusscan/output.go
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// checkOutput rejects unknown output formats before any request is made
+func checkOutput(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputCSV:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, use table, json or csv", format)
+}
+
+// table is what a command prints in table and CSV output
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// add appends a row
+func (t *table) add(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// render writes value as indented JSON, or t as an aligned table or CSV
+func render(format string, value interface{}, t *table) error {
+	w := os.Stdout
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+
+	case outputCSV:
+		writer := csv.NewWriter(w)
+		writer.Write(t.header)
+		writer.WriteAll(t.rows)
+		return writer.Error()
+
+	default:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+}
+
+// renderPage renders one page of a listing. Outside JSON output, where the
+// cursor is part of value, it tells on stderr how to get the next page.
+func renderPage(format string, value interface{}, t *table, nextCursor string) error {
+	if err := render(format, value, t); err != nil {
+		return err
+	}
+	if format != outputJSON && nextCursor != "" {
+		fmt.Fprintf(os.Stderr, "More results: rerun with -cursor %s\n", nextCursor)
+	}
+	return nil
+}
+
+// formatTime shows a time in UTC, or "-" for the zero time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// orDash returns "-" for empty cells so table columns stay readable
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// joinInts joins numbers with commas
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprint(value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// listFlag collects a flag given several times, or once with commas
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+// cmd/nexusscan/results.go
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// runResults lists the scan results of an address
+func runResults(args []string) error {
+	flags := flag.NewFlagSet("results", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	limit := flags.Int("limit", 10, "most results per page (up to 1000)")
+	cursor := flags.String("cursor", "", "page to list, from the previous page")
+	oldest := flags.Bool("oldest", false, "oldest first")
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one IP address is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		IP         string              `json:"ip"`
+		Results    []models.ScanResult `json:"results"`
+		Count      int                 `json:"count"`
+		Total      int                 `json:"total"`
+		NextCursor string              `json:"nextCursor,omitempty"`
+	}
+	query := historyQuery(*limit, *cursor, *oldest)
+	if err := client.call(context.Background(), "GET", "scan-results/"+url.PathEscape(args[0]), query, nil, &response); err != nil {
+		return err
+	}
+
+	t := &table{header: []string{"SCANNED", "SCAN ID", "PROTOCOL", "STATUS", "PORTS SCANNED", "OPEN PORTS"}}
+	for _, result := range response.Results {
+		open := make([]int, len(result.OpenPorts))
+		for i, port := range result.OpenPorts {
+			open[i] = port.Number
+		}
+		t.add(result.ScanTimestamp, result.ScanID, orDash(result.Protocol), orDash(result.ScanStatus),
+			fmt.Sprint(result.PortsScanned), orDash(joinInts(open)))
+	}
+	return renderPage(opts.output, response, t, response.NextCursor)
+}
+
+// historyQuery returns the paging parameters of a scan result or enrichment
+// history listing
+func historyQuery(limit int, cursor string, oldest bool) url.Values {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	if oldest {
+		query.Set("order", "asc")
+	}
+	return query
+}
+
+// runPorts lists the ports last found open on an address
+func runPorts(args []string) error {
+	flags := flag.NewFlagSet("ports", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one IP address is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		IP           string `json:"ip"`
+		OpenPorts    []int  `json:"openPorts"`
+		OpenUDPPorts []int  `json:"openUdpPorts"`
+		Count        int    `json:"count"`
+		UDPCount     int    `json:"udpCount"`
+	}
+	if err := client.call(context.Background(), "GET", "open-ports/"+url.PathEscape(args[0]), nil, nil, &response); err != nil {
+		return err
+	}
+
+	t := &table{header: []string{"PORT", "PROTOCOL"}}
+	for _, port := range response.OpenPorts {
+		t.add(fmt.Sprint(port), models.ProtocolTCP)
+	}
+	for _, port := range response.OpenUDPPorts {
+		t.add(fmt.Sprint(port), models.ProtocolUDP)
+	}
+	return render(opts.output, response, t)
+}
+
+// runEnrichment lists what enrichment found on the open ports of an address
+func runEnrichment(args []string) error {
+	flags := flag.NewFlagSet("enrichment", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	limit := flags.Int("limit", 5, "most enrichment runs per page (up to 1000)")
+	cursor := flags.String("cursor", "", "page to list, from the previous page")
+	oldest := flags.Bool("oldest", false, "oldest first")
+	latest := flags.Bool("latest", false, "only the latest enrichment run")
+	scanID := flags.String("scan", "", "only the enrichment run of this scan")
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one IP address is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	ip := url.PathEscape(args[0])
+	query := url.Values{"format": {"full"}}
+	var runs []database.HttpxEnrichment
+	var value interface{}
+	var nextCursor string
+	switch {
+	case *scanID != "" || *latest:
+		path := "latest-enrichment/" + ip
+		if *scanID != "" {
+			path = "enrichment-scan/" + ip + "/" + url.PathEscape(*scanID)
+		}
+		var result database.HttpxEnrichment
+		if err := client.call(context.Background(), "GET", path, query, nil, &result); err != nil {
+			return err
+		}
+		runs = []database.HttpxEnrichment{result}
+		value = result
+
+	default:
+		query = historyQuery(*limit, *cursor, *oldest)
+		query.Set("format", "full")
+		var response struct {
+			IP         string                     `json:"ip"`
+			Results    []database.HttpxEnrichment `json:"results"`
+			Count      int                        `json:"count"`
+			Total      int                        `json:"total"`
+			NextCursor string                     `json:"nextCursor,omitempty"`
+		}
+		if err := client.call(context.Background(), "GET", "enrichment-results/"+ip, query, nil, &response); err != nil {
+			return err
+		}
+		runs = response.Results
+		value = response
+		nextCursor = response.NextCursor
+	}
+
+	t := &table{header: []string{"TIMESTAMP", "URL", "STATUS", "TITLE", "SERVER", "TECHNOLOGIES"}}
+	for _, run := range runs {
+		for _, port := range run.EnrichedPorts {
+			status := "-"
+			if port.StatusCode != 0 {
+				status = fmt.Sprint(port.StatusCode)
+			}
+			if port.Failed {
+				status = "failed"
+			}
+			t.add(run.Timestamp, port.URL, status, orDash(port.Title), orDash(port.ServerHeader),
+				orDash(strings.Join(port.Technologies, ",")))
+		}
+	}
+	return renderPage(opts.output, value, t, nextCursor)
+}
+
+// runTLS lists what TLS inspection found on the ports of an address in its
+// latest enrichment
+func runTLS(args []string) error {
+	flags := flag.NewFlagSet("tls", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	port := flags.Int("port", 0, "only this port")
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one IP address is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	var query url.Values
+	if *port != 0 {
+		query = url.Values{"port": {strconv.Itoa(*port)}}
+	}
+	var response struct {
+		IP        string               `json:"ip"`
+		ScanID    string               `json:"scanId"`
+		Timestamp string               `json:"timestamp"`
+		Ports     []database.TLSResult `json:"ports"`
+		Count     int                  `json:"count"`
+	}
+	if err := client.call(context.Background(), "GET", "tls/"+url.PathEscape(args[0]), query, nil, &response); err != nil {
+		return err
+	}
+
+	t := &table{header: []string{"PORT", "VERSIONS", "SUBJECT", "NOT AFTER", "OCSP", "WEAKNESSES"}}
+	for _, result := range response.Ports {
+		var versions []string
+		for _, version := range result.Versions {
+			versions = append(versions, version.Version)
+		}
+		subject, notAfter := "-", "-"
+		if len(result.Certificates) > 0 {
+			subject = orDash(result.Certificates[0].SubjectCN)
+			notAfter = orDash(result.Certificates[0].NotAfter)
+		}
+		ocsp := "-"
+		if result.OCSPStapled {
+			ocsp = "stapled"
+			if result.OCSPStatus != "" {
+				ocsp = result.OCSPStatus
+			}
+		}
+		t.add(fmt.Sprint(result.Port), orDash(strings.Join(versions, ",")), subject, notAfter, ocsp,
+			orDash(strings.Join(result.Weaknesses, ",")))
+	}
+	return render(opts.output, response, t)
+}
+
+// runState lists the current state of the ports of an address, folded from
+// every enrichment so far
+func runState(args []string) error {
+	flags := flag.NewFlagSet("state", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	port := flags.Int("port", 0, "only this port")
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one IP address is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	var query url.Values
+	if *port != 0 {
+		query = url.Values{"port": {strconv.Itoa(*port)}}
+	}
+	var response struct {
+		IP    string                `json:"ip"`
+		Ports []models.ServiceState `json:"ports"`
+		Count int                   `json:"count"`
+	}
+	if err := client.call(context.Background(), "GET", "service-state/"+url.PathEscape(args[0]), query, nil, &response); err != nil {
+		return err
+	}
+
+	t := &table{header: []string{"PORT", "SERVICE", "STATUS", "TITLE", "SERVER", "CERTIFICATE", "LAST SEEN", "LAST CHANGED"}}
+	for _, state := range response.Ports {
+		status := "-"
+		if state.StatusCode != 0 {
+			status = fmt.Sprint(state.StatusCode)
+		}
+		certificate := state.CertificateFingerprint
+		if len(certificate) > 16 {
+			certificate = certificate[:16]
+		}
+		t.add(fmt.Sprint(state.Port), orDash(state.Service), status, orDash(state.Title), orDash(state.Server),
+			orDash(certificate), state.LastSeen.Format(time.RFC3339), state.LastChanged.Format(time.RFC3339))
+	}
+	return render(opts.output, response, t)
+}
+
+// runEnrichmentChanges lists the changes of the title, server, status code
+// and certificate of the ports of an address, newest first
+func runEnrichmentChanges(args []string) error {
+	flags := flag.NewFlagSet("enrichment-changes", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	port := flags.Int("port", 0, "only this port")
+	field := flags.String("field", "", "only this field: "+strings.Join(models.TrackedFields, ", "))
+	limit := flags.Int("limit", 20, "most changes per page (up to 1000)")
+	cursor := flags.String("cursor", "", "page to list, from the previous page")
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one IP address is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(*limit)}}
+	if *port != 0 {
+		query.Set("port", strconv.Itoa(*port))
+	}
+	if *field != "" {
+		query.Set("field", *field)
+	}
+	if *cursor != "" {
+		query.Set("cursor", *cursor)
+	}
+	var response struct {
+		IP         string                    `json:"ip"`
+		Changes    []models.EnrichmentChange `json:"changes"`
+		Count      int                       `json:"count"`
+		Total      int                       `json:"total"`
+		NextCursor string                    `json:"nextCursor,omitempty"`
+	}
+	if err := client.call(context.Background(), "GET", "enrichment-changes/"+url.PathEscape(args[0]), query, nil, &response); err != nil {
+		return err
+	}
+
+	t := &table{header: []string{"DETECTED", "PORT", "FIELD", "PREVIOUS", "CURRENT", "SCAN ID"}}
+	for _, change := range response.Changes {
+		t.add(change.DetectedAt.Format(time.RFC3339), fmt.Sprint(change.Port), change.Field,
+			orDash(change.Previous), orDash(change.Current), change.ScanID)
+	}
+	return renderPage(opts.output, response, t, response.NextCursor)
+}
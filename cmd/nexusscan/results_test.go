@@ -0,0 +1,107 @@
+// cmd/nexusscan/results_test.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+func TestResultsCommand(t *testing.T) {
+	server := testAPI(t)
+	ctx := context.Background()
+	mustRun(t, runIP, "add", "10.0.0.1")
+
+	scans := []struct {
+		scanID string
+		status string
+		open   []models.Port
+	}{
+		{scanID: "scan-1", status: models.ScanStatusCompleted, open: []models.Port{{Number: 22, Protocol: "tcp", State: models.PortStateOpen}}},
+		{scanID: "scan-2", status: models.ScanStatusPartial},
+		{
+			scanID: "scan-3",
+			status: models.ScanStatusCompleted,
+			open: []models.Port{
+				{Number: 22, Protocol: "tcp", State: models.PortStateOpen},
+				{Number: 443, Protocol: "tcp", State: models.PortStateOpen},
+			},
+		},
+	}
+	for _, scan := range scans {
+		err := server.db.StoreFinalScanSummary(ctx, "10.0.0.1", scan.scanID, "tcp", "default", scan.status, scan.open,
+			"1-1000", time.Second, 1000, models.PortStateCounts{}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	header := "SCANNED SCAN ID PROTOCOL STATUS PORTS SCANNED OPEN PORTS"
+	stdout, stderr, err := runCommand(t, runResults, "10.0.0.1", "-limit", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := tableRows(t, stdout, header)
+	var got [][]string
+	for _, row := range rows {
+		got = append(got, row[1:])
+	}
+	want := [][]string{
+		{"scan-3", "tcp", "completed", "1000", "22,443"},
+		{"scan-2", "tcp", "partial", "1000", "-"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results -limit 2: got %q, want %q", got, want)
+	}
+	cursor := strings.TrimSpace(strings.TrimPrefix(stderr, "More results: rerun with -cursor "))
+	if cursor == "" || cursor == strings.TrimSpace(stderr) {
+		t.Fatalf("results -limit 2: got %q on stderr, want the next cursor", stderr)
+	}
+	if rows := tableRows(t, mustRun(t, runResults, "10.0.0.1", "-limit", "2", "-cursor", cursor), header); len(rows) != 1 || rows[0][1] != "scan-1" {
+		t.Errorf("results -cursor: got %q, want scan-1", rows)
+	}
+
+	var response struct {
+		IP         string              `json:"ip"`
+		Results    []models.ScanResult `json:"results"`
+		Count      int                 `json:"count"`
+		NextCursor string              `json:"nextCursor"`
+	}
+	out := mustRun(t, runResults, "-o", "json", "-oldest", "10.0.0.1")
+	if err := json.Unmarshal([]byte(out), &response); err != nil {
+		t.Fatalf("results -o json: %v\n%s", err, out)
+	}
+	var order []string
+	for _, result := range response.Results {
+		order = append(order, result.ScanID)
+	}
+	if response.IP != "10.0.0.1" || response.Count != 3 || response.NextCursor != "" || !reflect.DeepEqual(order, []string{"scan-1", "scan-2", "scan-3"}) {
+		t.Errorf("results -oldest -o json: got %s with %d results in order %v, want all 3 oldest first", response.IP, response.Count, order)
+	}
+
+	out = mustRun(t, runResults, "10.0.0.1", "-limit", "1", "-o", "csv")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || lines[0] != "SCANNED,SCAN ID,PROTOCOL,STATUS,PORTS SCANNED,OPEN PORTS" || !strings.HasSuffix(lines[1], `,scan-3,tcp,completed,1000,"22,443"`) {
+		t.Errorf("results -o csv: got\n%s", out)
+	}
+
+	if rows := tableRows(t, mustRun(t, runResults, "10.0.0.2"), header); len(rows) != 0 {
+		t.Errorf("results of an address never scanned: got %q", rows)
+	}
+}
+
+func TestResultsArguments(t *testing.T) {
+	for _, args := range [][]string{nil, {"10.0.0.1", "10.0.0.2"}} {
+		_, _, err := runCommand(t, runResults, args...)
+		if err == nil || err.Error() != "exactly one IP address is required" {
+			t.Errorf("results %q: got %v, want one address required", args, err)
+		}
+	}
+}
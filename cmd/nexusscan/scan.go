@@ -0,0 +1,383 @@
+// cmd/nexusscan/scan.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/targets"
+)
+
+const scanUsage = `Usage: nexusscan scan <command> [flags]
+
+Commands:
+  start <target>...   Start scans through the API
+  status <scanId>...  Show the progress of scans
+  wait <scanId>...    Wait for scans to finish
+  local <target>...   Scan from this machine, without the API
+`
+
+// runScan starts and follows scans
+func runScan(args []string) error {
+	if len(args) == 0 {
+		return usageError(scanUsage)
+	}
+
+	switch args[0] {
+	case "start":
+		return runScanStart(args[1:])
+	case "status":
+		return runScanStatus(args[1:])
+	case "wait":
+		return runScanWait(args[1:])
+	case "local":
+		return runScanLocal(args[1:])
+	}
+	return usageError(scanUsage)
+}
+
+// scanStarted is one scan started by scan start
+type scanStarted struct {
+	IP     string `json:"ip"`
+	ScanID string `json:"scanId"`
+}
+
+func runScanStart(args []string) error {
+	flags := flag.NewFlagSet("scan start", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	portSet := flags.String("port-set", "top_100", "built-in or custom port set, or previous_open")
+	protocol := flags.String("protocol", models.ProtocolTCP, "tcp or udp")
+	profile := flags.String("profile", "", "scan profile (default profile if empty)")
+	banners := flags.Bool("banners", false, "fingerprint services on open TCP ports")
+	maxScanRate := flags.Int("max-scan-rate", 0, "probes per second cap of each scan, 0 for the profile's")
+	wait := flags.Bool("wait", false, "wait for the scans to finish")
+	var exclude listFlag
+	flags.Var(&exclude, "exclude", "addresses, blocks or ranges to skip (repeatable or comma-separated)")
+	selection := addSelectorFlags(flags, "scan")
+	args = parseArgs(flags, args)
+	selector, err := selection.selector()
+	if err != nil {
+		return err
+	}
+	if selector != nil && len(args) > 0 {
+		return fmt.Errorf("give either targets or selector flags, not both")
+	}
+	if selector == nil && len(args) == 0 {
+		return fmt.Errorf("at least one target or selector flag is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	// Targets are scanned one request each; a selector is one bulk scan
+	path, requests := "scan", args
+	if selector != nil {
+		path, requests = "scans", []string{""}
+	}
+
+	ctx := context.Background()
+	var started []scanStarted
+	for _, target := range requests {
+		var response struct {
+			ScanID  string            `json:"scanId"`
+			IP      string            `json:"ip"`
+			ScanIDs map[string]string `json:"scanIds"` // Blocks, ranges, hostnames and selectors
+		}
+		request := map[string]interface{}{
+			"portSet":     *portSet,
+			"protocol":    *protocol,
+			"profile":     *profile,
+			"grabBanners": *banners,
+			"maxScanRate": *maxScanRate,
+			"immediate":   true,
+			"exclude":     []string(exclude),
+		}
+		if selector != nil {
+			request["selector"] = selector
+		} else {
+			request["ip"] = target
+		}
+		if err := client.call(ctx, "POST", path, nil, request, &response); err != nil {
+			if selector != nil {
+				return fmt.Errorf("starting scans: %w", err)
+			}
+			return fmt.Errorf("starting scan of %s: %w", target, err)
+		}
+
+		if response.ScanID != "" {
+			started = append(started, scanStarted{IP: response.IP, ScanID: response.ScanID})
+		}
+		ips := make([]string, 0, len(response.ScanIDs))
+		for ip := range response.ScanIDs {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			started = append(started, scanStarted{IP: ip, ScanID: response.ScanIDs[ip]})
+		}
+	}
+
+	if *wait {
+		scanIDs := make([]string, len(started))
+		for i, scan := range started {
+			scanIDs[i] = scan.ScanID
+		}
+		return waitForScans(ctx, client, opts.output, scanIDs, 5*time.Second, 0)
+	}
+
+	t := &table{header: []string{"IP", "SCAN ID"}}
+	for _, scan := range started {
+		t.add(scan.IP, scan.ScanID)
+	}
+	return render(opts.output, started, t)
+}
+
+func runScanStatus(args []string) error {
+	flags := flag.NewFlagSet("scan status", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) == 0 {
+		return fmt.Errorf("at least one scan ID is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	jobs, err := getScanJobs(context.Background(), client, args)
+	if err != nil {
+		return err
+	}
+	return renderScanJobs(opts.output, jobs)
+}
+
+func runScanWait(args []string) error {
+	flags := flag.NewFlagSet("scan wait", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	interval := flags.Duration("interval", 5*time.Second, "time between status checks")
+	timeout := flags.Duration("timeout", 0, "give up after this long, 0 to wait indefinitely")
+	args = parseArgs(flags, args)
+	if len(args) == 0 {
+		return fmt.Errorf("at least one scan ID is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	return waitForScans(context.Background(), client, opts.output, args, *interval, *timeout)
+}
+
+// scanRecordGrace is how long wait treats an unknown scan as queued
+const scanRecordGrace = time.Minute
+
+// waitForScans polls scans until none is queued or running, then prints
+// them. It fails if any scan failed.
+func waitForScans(ctx context.Context, client *apiClient, output string, scanIDs []string, interval time.Duration, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	started := time.Now()
+	for {
+		jobs := make([]models.ScanJob, 0, len(scanIDs))
+		for _, scanID := range scanIDs {
+			var job models.ScanJob
+			err := client.call(ctx, "GET", "scan/"+url.PathEscape(scanID), nil, nil, &job)
+
+			// The scheduler records a scan shortly after it is started
+			var failure *apiError
+			if errors.As(err, &failure) && failure.StatusCode == http.StatusNotFound && time.Since(started) < scanRecordGrace {
+				job = models.ScanJob{ScanID: scanID, Status: models.ScanStatusQueued}
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("getting scan %s: %w", scanID, err)
+			}
+			jobs = append(jobs, job)
+		}
+
+		finished := 0
+		failed := 0
+		for _, job := range jobs {
+			switch job.Status {
+			case models.ScanStatusQueued, models.ScanStatusRunning:
+			case models.ScanStatusFailed:
+				failed++
+				finished++
+			default:
+				finished++
+			}
+		}
+
+		if finished == len(jobs) {
+			if err := renderScanJobs(output, jobs); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d scans failed", failed, len(jobs))
+			}
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "%d of %d scans finished\n", finished, len(jobs))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting with %d of %d scans finished: %w", finished, len(jobs), ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// getScanJobs fetches the progress of each scan
+func getScanJobs(ctx context.Context, client *apiClient, scanIDs []string) ([]models.ScanJob, error) {
+	jobs := make([]models.ScanJob, 0, len(scanIDs))
+	for _, scanID := range scanIDs {
+		var job models.ScanJob
+		if err := client.call(ctx, "GET", "scan/"+url.PathEscape(scanID), nil, nil, &job); err != nil {
+			return nil, fmt.Errorf("getting scan %s: %w", scanID, err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func renderScanJobs(output string, jobs []models.ScanJob) error {
+	t := &table{header: []string{"SCAN ID", "IP", "PROTOCOL", "STATUS", "BATCHES", "PORTS", "OPEN", "UPDATED"}}
+	for _, job := range jobs {
+		t.add(job.ScanID, job.IPAddress, job.Protocol, job.Status,
+			fmt.Sprintf("%d/%d", job.BatchesDone, job.TotalBatches),
+			fmt.Sprintf("%d/%d", job.PortsScanned, job.PortsTotal),
+			fmt.Sprint(job.OpenPortsFound), formatTime(job.UpdatedAt))
+	}
+	return render(output, jobs, t)
+}
+
+// localResult is the outcome of scan local for one target
+type localResult struct {
+	IP           string                 `json:"ip"`
+	Hostname     string                 `json:"hostname,omitempty"`
+	Protocol     string                 `json:"protocol"`
+	OpenPorts    []models.Port          `json:"openPorts"`
+	PortsScanned int                    `json:"portsScanned"`
+	StateCounts  models.PortStateCounts `json:"stateCounts"`
+	Duration     string                 `json:"duration"`
+}
+
+func runScanLocal(args []string) error {
+	flags := flag.NewFlagSet("scan local", flag.ExitOnError)
+	ports := flags.String("ports", "top_100", "built-in port set (top_100, custom_3500, full_65k) or ports and ranges such as 22,80,8000-8100")
+	protocol := flags.String("protocol", models.ProtocolTCP, "tcp or udp")
+	profileName := flags.String("profile", models.DefaultScanProfile, "built-in scan profile: default, stealth, aggressive or lan")
+	banners := flags.Bool("banners", false, "fingerprint services on open TCP ports")
+	maxScanRate := flags.Int("max-scan-rate", 0, "probes per second cap of each scan, 0 for the profile's")
+	verbose := flags.Bool("v", false, "log scanner progress")
+	output := flags.String("o", outputTable, "output format: table, json or csv")
+	var exclude listFlag
+	flags.Var(&exclude, "exclude", "addresses, blocks or ranges to skip (repeatable or comma-separated)")
+	args = parseArgs(flags, args)
+	if len(args) == 0 {
+		return fmt.Errorf("at least one target is required")
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+
+	if !models.IsValidProtocol(*protocol) {
+		return fmt.Errorf("invalid protocol %q, use tcp or udp", *protocol)
+	}
+	profile := models.GetBuiltinScanProfile(*profileName)
+	if profile == nil {
+		return fmt.Errorf("unknown scan profile %q, scan local only has the built-in profiles", *profileName)
+	}
+
+	// previous_open needs stored results, which only the API has
+	if *ports == models.PortSetPreviousOpen {
+		return fmt.Errorf("%s needs earlier scan results, use scan start", models.PortSetPreviousOpen)
+	}
+	portsToScan := models.GetPortSet(*ports)
+	if !models.IsBuiltinPortSet(*ports) {
+		var err error
+		if portsToScan, err = models.ParsePortSpec(*ports); err != nil {
+			return err
+		}
+	}
+
+	rate := profile.MaxScanRate
+	if *maxScanRate > 0 {
+		rate = *maxScanRate
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	expanded, err := targets.Expand(ctx, args, targets.Options{Exclude: exclude})
+	if err != nil {
+		return err
+	}
+
+	results := make([]localResult, 0, len(expanded))
+	t := &table{header: []string{"IP", "PORT", "PROTOCOL", "STATE", "SERVICE", "PRODUCT", "VERSION"}}
+	for _, target := range expanded {
+		result, err := scanner.ScanPorts(ctx, scanner.ScanRequest{
+			IPAddress:   target.IPAddress,
+			PortsToScan: portsToScan,
+			ScanID:      models.NewScanID("local", target.IPAddress),
+			TimeoutMs:   profile.TimeoutFor(*protocol),
+			Concurrency: profile.Concurrency,
+			RetryCount:  profile.RetryCount,
+			Protocol:    *protocol,
+			GrabBanners: *banners,
+			MaxRate:     float64(rate),
+			ProbeOrder:  profile.ProbeOrder,
+			Profile:     profile.Name,
+		})
+		if err != nil {
+			return fmt.Errorf("scanning %s: %w", target.IPAddress, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		results = append(results, localResult{
+			IP:           target.IPAddress,
+			Hostname:     target.Hostname,
+			Protocol:     result.Protocol,
+			OpenPorts:    result.OpenPorts,
+			PortsScanned: result.PortsScanned,
+			StateCounts:  result.StateCounts,
+			Duration:     result.ScanDuration.Round(time.Millisecond).String(),
+		})
+		for _, port := range result.OpenPorts {
+			t.add(target.IPAddress, fmt.Sprint(port.Number), port.Protocol, port.State,
+				orDash(port.Service), orDash(port.Product), orDash(port.Version))
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d open of %d ports in %v (%s)\n", target.IPAddress,
+			len(result.OpenPorts), result.PortsScanned, result.ScanDuration.Round(time.Millisecond), result.StateCounts)
+	}
+	return render(*output, results, t)
+}
@@ -0,0 +1,157 @@
+// cmd/nexusscan/scan_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+)
+
+// waitTasks waits for the scheduler to queue count scan batches and
+// returns them
+func (s *testServer) waitTasks(t *testing.T, count int) []scanner.ScanRequest {
+	t.Helper()
+	s.functions.Wait()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		s.mu.Lock()
+		tasks := s.tasks
+		s.mu.Unlock()
+		if len(tasks) >= count || time.Now().After(deadline) {
+			if len(tasks) != count {
+				t.Fatalf("%d batches queued, want %d", len(tasks), count)
+			}
+			return tasks
+		}
+	}
+}
+
+func TestScanCommands(t *testing.T) {
+	server := testAPI(t)
+	mustRun(t, runIP, "add", "10.0.0.1", "10.0.0.2", "-group", "web")
+
+	rows := tableRows(t, mustRun(t, runScan, "start", "10.0.0.1", "-port-set", "custom_3500", "-profile", "stealth"), "IP SCAN ID")
+	if len(rows) != 1 || rows[0][0] != "10.0.0.1" || rows[0][1] == "" {
+		t.Fatalf("scan start: got %q, want one scan of 10.0.0.1", rows)
+	}
+	scanID := rows[0][1]
+
+	// The stealth profile caps its rate, so the scan is one chain of batches
+	tasks := server.waitTasks(t, 1)
+	if task := tasks[0]; task.ScanID != scanID || task.IPAddress != "10.0.0.1" || task.Profile != "stealth" || task.Chain == nil {
+		t.Errorf("queued %+v, want the first batch of the stealth chain of scan %s", task, scanID)
+	}
+
+	out := mustRun(t, runScan, "status", scanID, "-o", "json")
+	var jobs []models.ScanJob
+	if err := json.Unmarshal([]byte(out), &jobs); err != nil || len(jobs) != 1 {
+		t.Fatalf("scan status -o json: got %s", out)
+	}
+	if job := jobs[0]; job.ScanID != scanID || job.Status != models.ScanStatusQueued || job.PortsTotal != len(models.GetPortSet("custom_3500")) {
+		t.Errorf("scan status: got %+v, want %s queued with every port of custom_3500", job, scanID)
+	}
+
+	rows = tableRows(t, mustRun(t, runScan, "status", scanID), "SCAN ID IP PROTOCOL STATUS BATCHES PORTS OPEN UPDATED")
+	if want := []string{scanID, "10.0.0.1", "tcp", "queued", fmt.Sprintf("0/%d", jobs[0].TotalBatches), fmt.Sprintf("0/%d", jobs[0].PortsTotal), "0"}; len(rows) != 1 || !reflect.DeepEqual(rows[0][:7], want) {
+		t.Errorf("scan status: got %q, want %q", rows, want)
+	}
+
+	// Nothing consumes the batches, so the scan never finishes
+	_, stderr, err := runCommand(t, runScan, "wait", scanID, "-interval", "10ms", "-timeout", "50ms")
+	if err == nil || !strings.Contains(err.Error(), "stopped waiting with 0 of 1 scans finished") {
+		t.Errorf("scan wait: got %v, want it to give up", err)
+	}
+	if !strings.Contains(stderr, "0 of 1 scans finished") {
+		t.Errorf("scan wait: got %q on stderr, want the progress", stderr)
+	}
+
+	var started []scanStarted
+	out = mustRun(t, runScan, "start", "-select-group", "web", "-port-set", "top_100", "-protocol", "udp", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &started); err != nil || len(started) != 2 {
+		t.Fatalf("scan start -select-group: got %s, want 2 scans", out)
+	}
+	if started[0].IP != "10.0.0.1" || started[1].IP != "10.0.0.2" || started[0].ScanID == started[1].ScanID {
+		t.Errorf("scan start -select-group: got %+v, want a scan of each address in order", started)
+	}
+	server.functions.Wait()
+	out = mustRun(t, runScan, "status", started[0].ScanID, started[1].ScanID, "-o", "json")
+	if err := json.Unmarshal([]byte(out), &jobs); err != nil || len(jobs) != 2 {
+		t.Fatalf("scan status of two scans: got %s", out)
+	}
+	queued := 1
+	for _, job := range jobs {
+		if job.Protocol != models.ProtocolUDP || job.PortSet != "top_100" || job.PortsTotal == 0 {
+			t.Errorf("scan status: got %+v, want a UDP scan of top_100", job)
+		}
+		queued += job.BatchesQueued
+	}
+	scanned := map[string]string{}
+	for _, task := range server.waitTasks(t, queued)[1:] {
+		scanned[task.ScanID] = task.IPAddress
+	}
+	if want := map[string]string{started[0].ScanID: "10.0.0.1", started[1].ScanID: "10.0.0.2"}; !reflect.DeepEqual(scanned, want) {
+		t.Errorf("scan start -select-group: queued batches of %v, want %v", scanned, want)
+	}
+}
+
+func TestScanLocal(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	out, stderr, err := runCommand(t, runScan, "local", "127.0.0.1", "-ports", fmt.Sprintf("%d,%d", port, port+1), "-profile", "lan", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []localResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil || len(results) != 1 {
+		t.Fatalf("scan local -o json: got %s", out)
+	}
+	result := results[0]
+	if result.IP != "127.0.0.1" || result.PortsScanned != 2 || len(result.OpenPorts) != 1 || result.OpenPorts[0].Number != port {
+		t.Errorf("scan local: got %+v, want port %d of 2 open", result, port)
+	}
+	if !strings.HasPrefix(stderr, "127.0.0.1: 1 open of 2 ports") {
+		t.Errorf("scan local: got %q on stderr, want a summary", stderr)
+	}
+}
+
+func TestScanArguments(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"start"}, want: "at least one target or selector flag is required"},
+		{args: []string{"start", "10.0.0.1", "-select-tag", "env:prod"}, want: "not both"},
+		{args: []string{"start", "10.0.0.1", "-api", "not a URL"}, want: `invalid API endpoint "not a URL"`},
+		{args: []string{"status"}, want: "at least one scan ID is required"},
+		{args: []string{"wait"}, want: "at least one scan ID is required"},
+		{args: []string{"local"}, want: "at least one target is required"},
+		{args: []string{"local", "127.0.0.1", "-protocol", "sctp"}, want: `invalid protocol "sctp"`},
+		{args: []string{"local", "127.0.0.1", "-profile", "office"}, want: `unknown scan profile "office"`},
+		{args: []string{"local", "127.0.0.1", "-ports", "previous_open"}, want: "use scan start"},
+		{args: []string{"local", "127.0.0.1", "-ports", "80-"}, want: "invalid port"},
+		{args: []string{"local", "127.0.0.1", "-o", "yaml"}, want: `unknown output format "yaml"`},
+	}
+
+	for _, tt := range tests {
+		_, _, err := runCommand(t, runScan, tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("scan %s: got %v, want an error with %q", strings.Join(tt.args, " "), err, tt.want)
+		}
+	}
+
+	if _, stderr, err := runCommand(t, runScan, "stop"); err != errUsage || !strings.HasPrefix(stderr, "Usage: nexusscan scan") {
+		t.Errorf("scan stop: got %v, want the usage", err)
+	}
+}
@@ -0,0 +1,402 @@
+// cmd/nexusscan/schedule.go
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+const scheduleUsage = `Usage: nexusscan schedule <command> [flags]
+
+Commands:
+  add <ip>                  Create a schedule, or one for the addresses selected
+  update <scheduleId>       Change the flags given, keeping the rest
+  rm <scheduleId>...        Delete schedules
+  ls [ip]                   List the schedules of an address, or of selectors
+  show <scheduleId>         Show one schedule
+  enable <scheduleId>...    Enable schedules
+  disable <scheduleId>...   Disable schedules
+`
+
+// runSchedule manages scan schedules
+func runSchedule(args []string) error {
+	if len(args) == 0 {
+		return usageError(scheduleUsage)
+	}
+
+	switch args[0] {
+	case "add":
+		return runScheduleAdd(args[1:])
+	case "update":
+		return runScheduleUpdate(args[1:])
+	case "rm":
+		return runScheduleRemove(args[1:])
+	case "ls":
+		return runScheduleList(args[1:])
+	case "show":
+		return runScheduleShow(args[1:])
+	case "enable":
+		return runScheduleStatus(args[1:], true)
+	case "disable":
+		return runScheduleStatus(args[1:], false)
+	}
+	return usageError(scheduleUsage)
+}
+
+// windowFlag collects scan windows written as "[days ]HH:MM-HH:MM", such
+// as "weekdays 22:00-06:00" or "sat,sun 00:00-23:59"
+type windowFlag []models.ScanWindow
+
+func (w *windowFlag) String() string {
+	parts := make([]string, len(*w))
+	for i, window := range *w {
+		parts[i] = strings.TrimSpace(strings.Join(window.Days, ",") + " " + window.Start + "-" + window.End)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (w *windowFlag) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	var window models.ScanWindow
+	times := value
+	if fields := strings.Fields(value); len(fields) == 2 {
+		window.Days = strings.Split(fields[0], ",")
+		times = fields[1]
+	} else if len(fields) != 1 {
+		return fmt.Errorf("invalid scan window %q, expected [days ]HH:MM-HH:MM", value)
+	}
+
+	start, end, ok := strings.Cut(times, "-")
+	if !ok {
+		return fmt.Errorf("invalid scan window %q, expected [days ]HH:MM-HH:MM", value)
+	}
+	window.Start, window.End = start, end
+	*w = append(*w, window)
+	return nil
+}
+
+// scheduleFlags are the settings of a schedule add and update take
+type scheduleFlags struct {
+	scheduleType string
+	cron         string
+	timezone     string
+	windows      windowFlag
+	blackout     listFlag
+	portSet      string
+	profile      string
+}
+
+func addScheduleFlags(flags *flag.FlagSet) *scheduleFlags {
+	s := &scheduleFlags{}
+	flags.StringVar(&s.scheduleType, "type", "", "hourly, 12hour, daily, weekly or monthly")
+	flags.StringVar(&s.cron, "cron", "", "cron expression, instead of -type")
+	flags.StringVar(&s.timezone, "tz", "", "IANA time zone of the cron expression, windows and blackout dates (default UTC)")
+	flags.Var(&s.windows, "window", `scan window as "[days ]HH:MM-HH:MM" (repeatable)`)
+	flags.Var(&s.blackout, "blackout", "YYYY-MM-DD dates to skip (repeatable or comma-separated)")
+	flags.StringVar(&s.portSet, "port-set", "top_100", "built-in or custom port set, or previous_open")
+	flags.StringVar(&s.profile, "profile", "", "scan profile (default profile if empty)")
+	return s
+}
+
+// timing returns the timing the flags describe
+func (s *scheduleFlags) timing() models.ScheduleTiming {
+	return models.ScheduleTiming{
+		CronExpression: s.cron,
+		Timezone:       s.timezone,
+		Windows:        s.windows,
+		BlackoutDates:  s.blackout,
+	}
+}
+
+func runScheduleAdd(args []string) error {
+	flags := flag.NewFlagSet("schedule add", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	settings := addScheduleFlags(flags)
+	disabled := flags.Bool("disabled", false, "create the schedule disabled")
+	selection := addSelectorFlags(flags, "schedule")
+	args = parseArgs(flags, args)
+	selector, err := selection.selector()
+	if err != nil {
+		return err
+	}
+	if selector != nil && len(args) > 0 {
+		return fmt.Errorf("give either an IP address or selector flags, not both")
+	}
+	if selector == nil && len(args) != 1 {
+		return fmt.Errorf("exactly one IP address is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	// A selector is kept on one schedule, which scans the addresses it
+	// selects each time it runs
+	ip, path := "", "schedule"
+	if selector == nil {
+		ip = args[0]
+	} else {
+		path = "schedules"
+	}
+	request := struct {
+		IP           string                `json:"ip,omitempty"`
+		Selector     *models.AssetSelector `json:"selector,omitempty"`
+		ScheduleType string                `json:"scheduleType,omitempty"`
+		models.ScheduleTiming
+		PortSet string `json:"portSet"`
+		Profile string `json:"profile,omitempty"`
+		Enabled bool   `json:"enabled"`
+	}{
+		IP:             ip,
+		Selector:       selector,
+		ScheduleType:   settings.scheduleType,
+		ScheduleTiming: settings.timing(),
+		PortSet:        settings.portSet,
+		Profile:        settings.profile,
+		Enabled:        !*disabled,
+	}
+
+	var response struct {
+		ScheduleID string `json:"scheduleId"`
+	}
+	if err := client.call(context.Background(), "POST", path, nil, request, &response); err != nil {
+		return err
+	}
+	return showSchedule(client, opts.output, response.ScheduleID)
+}
+
+func runScheduleUpdate(args []string) error {
+	flags := flag.NewFlagSet("schedule update", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	settings := addScheduleFlags(flags)
+	enabled := flags.Bool("enabled", true, "whether the schedule runs")
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one schedule ID is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	// The API replaces the whole schedule, so start from what is stored
+	ctx := context.Background()
+	schedule, err := getSchedule(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "type":
+			schedule.ScheduleType = settings.scheduleType
+		case "cron":
+			schedule.CronExpression = settings.cron
+			if !flagSet(flags, "type") {
+				schedule.ScheduleType = ""
+			}
+		case "tz":
+			schedule.Timezone = settings.timezone
+		case "window":
+			schedule.Windows = settings.windows
+		case "blackout":
+			schedule.BlackoutDates = settings.blackout
+		case "port-set":
+			schedule.PortSet = settings.portSet
+		case "profile":
+			schedule.Profile = settings.profile
+		case "enabled":
+			schedule.Enabled = *enabled
+		}
+	})
+	// Fixed schedule types are reported with the expression they stand for,
+	// which must not be sent back unless it was given
+	if models.IsScheduleType(schedule.ScheduleType) && !flagSet(flags, "cron") {
+		schedule.CronExpression = ""
+	}
+	if schedule.ScheduleType == models.ScheduleTypeCron {
+		schedule.ScheduleType = ""
+	}
+
+	request := struct {
+		ScheduleID   string `json:"scheduleId"`
+		ScheduleType string `json:"scheduleType,omitempty"`
+		models.ScheduleTiming
+		PortSet string `json:"portSet"`
+		Profile string `json:"profile,omitempty"`
+		Enabled bool   `json:"enabled"`
+	}{
+		ScheduleID:     schedule.ScheduleID,
+		ScheduleType:   schedule.ScheduleType,
+		ScheduleTiming: schedule.ScheduleTiming,
+		PortSet:        schedule.PortSet,
+		Profile:        schedule.Profile,
+		Enabled:        schedule.Enabled,
+	}
+	if err := client.call(ctx, "PUT", "schedule", nil, request, nil); err != nil {
+		return err
+	}
+	return showSchedule(client, opts.output, schedule.ScheduleID)
+}
+
+// flagSet reports whether the flag called name was given
+func flagSet(flags *flag.FlagSet, name string) bool {
+	found := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+func runScheduleRemove(args []string) error {
+	flags := flag.NewFlagSet("schedule rm", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) == 0 {
+		return fmt.Errorf("at least one schedule ID is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	t := &table{header: []string{"SCHEDULE ID", "RESULT"}}
+	for _, scheduleID := range args {
+		if err := client.call(context.Background(), "DELETE", "schedule", nil, map[string]string{"scheduleId": scheduleID}, nil); err != nil {
+			return fmt.Errorf("deleting schedule %s: %w", scheduleID, err)
+		}
+		t.add(scheduleID, "deleted")
+	}
+	return render(opts.output, args, t)
+}
+
+func runScheduleList(args []string) error {
+	flags := flag.NewFlagSet("schedule ls", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) > 1 {
+		return fmt.Errorf("at most one IP address is allowed")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	// Without an address, list the schedules of selectors
+	path := "schedules"
+	if len(args) == 1 {
+		path += "/" + url.PathEscape(args[0])
+	}
+	var response struct {
+		IP        string            `json:"ip,omitempty"`
+		Schedules []models.Schedule `json:"schedules"`
+		Count     int               `json:"count"`
+	}
+	if err := client.call(context.Background(), "GET", path, nil, nil, &response); err != nil {
+		return err
+	}
+	return renderSchedules(opts.output, response, response.Schedules)
+}
+
+func runScheduleShow(args []string) error {
+	flags := flag.NewFlagSet("schedule show", flag.ExitOnError)
+	opts := addClientFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one schedule ID is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+	return showSchedule(client, opts.output, args[0])
+}
+
+func runScheduleStatus(args []string, enabled bool) error {
+	name := "schedule disable"
+	if enabled {
+		name = "schedule enable"
+	}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	opts := addClientFlags(flags)
+	args = parseArgs(flags, args)
+	if len(args) == 0 {
+		return fmt.Errorf("at least one schedule ID is required")
+	}
+
+	client, err := opts.client()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	schedules := make([]models.Schedule, 0, len(args))
+	for _, scheduleID := range args {
+		request := map[string]interface{}{"scheduleId": scheduleID, "enabled": enabled}
+		if err := client.call(ctx, "PUT", "schedule-status", nil, request, nil); err != nil {
+			return fmt.Errorf("updating schedule %s: %w", scheduleID, err)
+		}
+		schedule, err := getSchedule(ctx, client, scheduleID)
+		if err != nil {
+			return err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return renderSchedules(opts.output, schedules, schedules)
+}
+
+// getSchedule fetches one schedule by ID
+func getSchedule(ctx context.Context, client *apiClient, scheduleID string) (models.Schedule, error) {
+	var schedule models.Schedule
+	if err := client.call(ctx, "GET", "schedule-detail/"+url.PathEscape(scheduleID), nil, nil, &schedule); err != nil {
+		return schedule, fmt.Errorf("getting schedule %s: %w", scheduleID, err)
+	}
+	return schedule, nil
+}
+
+// showSchedule fetches a schedule and prints it
+func showSchedule(client *apiClient, output string, scheduleID string) error {
+	schedule, err := getSchedule(context.Background(), client, scheduleID)
+	if err != nil {
+		return err
+	}
+	return renderSchedules(output, schedule, []models.Schedule{schedule})
+}
+
+func renderSchedules(output string, value interface{}, schedules []models.Schedule) error {
+	t := &table{header: []string{"SCHEDULE ID", "TARGET", "WHEN", "PORT SET", "PROFILE", "ENABLED", "LAST RUN", "NEXT RUN"}}
+	for _, schedule := range schedules {
+		when := schedule.ScheduleType
+		if when == models.ScheduleTypeCron {
+			when = schedule.CronExpression
+		}
+		if schedule.Timezone != "" {
+			when += " " + schedule.Timezone
+		}
+		target := schedule.IPAddress
+		if schedule.Selector != nil {
+			target = schedule.Selector.String()
+		}
+		t.add(schedule.ScheduleID, target, when, schedule.PortSet,
+			orDash(schedule.Profile), fmt.Sprint(schedule.Enabled),
+			formatTime(schedule.LastRun), formatTime(schedule.NextRun))
+	}
+	return render(output, value, t)
+}
@@ -0,0 +1,149 @@
+// cmd/nexusscan/schedule_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+const scheduleHeader = "SCHEDULE ID TARGET WHEN PORT SET PROFILE ENABLED LAST RUN NEXT RUN"
+
+// scheduleRows keeps the columns of schedule rows up to ENABLED. WHEN may
+// be a cron expression, which holds spaces.
+func scheduleRows(t *testing.T, output string) [][]string {
+	t.Helper()
+	rows := tableRows(t, output, scheduleHeader)
+	for i, row := range rows {
+		if len(row) < 8 {
+			t.Fatalf("row %q has %d cells, want 8 or more", row, len(row))
+		}
+		when := strings.Join(row[2:len(row)-5], " ")
+		rows[i] = append([]string{row[0], row[1], when}, row[len(row)-5:len(row)-2]...)
+	}
+	return rows
+}
+
+// showJSON runs schedule show -o json
+func showJSON(t *testing.T, scheduleID string) models.Schedule {
+	t.Helper()
+	var schedule models.Schedule
+	out := mustRun(t, runSchedule, "show", scheduleID, "-o", "json")
+	if err := json.Unmarshal([]byte(out), &schedule); err != nil {
+		t.Fatalf("schedule show -o json: %v\n%s", err, out)
+	}
+	return schedule
+}
+
+func TestScheduleCommands(t *testing.T) {
+	testAPI(t)
+	mustRun(t, runIP, "add", "10.0.0.1", "-group", "web")
+
+	rows := scheduleRows(t, mustRun(t, runSchedule, "add", "10.0.0.1", "-type", "daily", "-window", "weekdays 22:00-06:00", "-port-set", "custom_3500"))
+	if len(rows) != 1 || rows[0][0] == "" || !reflect.DeepEqual(rows[0][1:], []string{"10.0.0.1", "daily", "custom_3500", "-", "true"}) {
+		t.Fatalf("schedule add: got %q, want a daily schedule of 10.0.0.1", rows)
+	}
+	daily := rows[0][0]
+
+	out := mustRun(t, runSchedule, "add", "-select-group", "web", "-cron", "0 3 * * *", "-tz", "Europe/Berlin", "-disabled", "-o", "json")
+	var selected models.Schedule
+	if err := json.Unmarshal([]byte(out), &selected); err != nil {
+		t.Fatalf("schedule add -o json: %v\n%s", err, out)
+	}
+	if selected.Selector == nil || selected.Selector.Group != "web" || selected.CronExpression != "0 3 * * *" || selected.Timezone != "Europe/Berlin" || selected.Enabled {
+		t.Errorf("schedule add -select-group: got %+v, want a disabled cron schedule of group web", selected)
+	}
+
+	// An address lists its own schedules, and no address those of selectors
+	if rows := scheduleRows(t, mustRun(t, runSchedule, "ls", "10.0.0.1")); len(rows) != 1 || rows[0][0] != daily {
+		t.Errorf("schedule ls 10.0.0.1: got %q, want %s", rows, daily)
+	}
+	want := [][]string{{selected.ScheduleID, `{"group":"web"}`, "0 3 * * * Europe/Berlin", "top_100", "-", "false"}}
+	if rows := scheduleRows(t, mustRun(t, runSchedule, "ls")); !reflect.DeepEqual(rows, want) {
+		t.Errorf("schedule ls: got %q, want %q", rows, want)
+	}
+
+	// update changes the flags given and keeps the rest
+	mustRun(t, runSchedule, "update", daily, "-type", "weekly", "-profile", "stealth")
+	schedule := showJSON(t, daily)
+	if schedule.ScheduleType != "weekly" || schedule.Profile != "stealth" || schedule.PortSet != "custom_3500" ||
+		!reflect.DeepEqual(schedule.Windows, []models.ScanWindow{{Days: []string{"weekdays"}, Start: "22:00", End: "06:00"}}) {
+		t.Errorf("schedule update -type weekly: got %+v", schedule)
+	}
+	mustRun(t, runSchedule, "update", daily, "-cron", "30 1 * * 1-5", "-window", "")
+	schedule = showJSON(t, daily)
+	if schedule.ScheduleType != models.ScheduleTypeCron || schedule.CronExpression != "30 1 * * 1-5" || len(schedule.Windows) != 0 || schedule.Profile != "stealth" {
+		t.Errorf("schedule update -cron: got %+v", schedule)
+	}
+
+	rows = scheduleRows(t, mustRun(t, runSchedule, "disable", daily))
+	if len(rows) != 1 || rows[0][0] != daily || rows[0][5] != "false" {
+		t.Errorf("schedule disable: got %q, want %s disabled", rows, daily)
+	}
+	out = mustRun(t, runSchedule, "enable", daily, selected.ScheduleID, "-o", "csv")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], ",true,") || !strings.Contains(lines[2], ",true,") {
+		t.Errorf("schedule enable -o csv: got\n%s", out)
+	}
+
+	out = mustRun(t, runSchedule, "rm", daily, selected.ScheduleID)
+	if want := "SCHEDULE ID                           RESULT\n" + daily + "  deleted\n" + selected.ScheduleID + "  deleted\n"; out != want {
+		t.Errorf("schedule rm: got\n%swant\n%s", out, want)
+	}
+	if _, _, err := runCommand(t, runSchedule, "show", daily); err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("schedule show after rm: got %v, want HTTP 404", err)
+	}
+}
+
+func TestScheduleArguments(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"add"}, want: "exactly one IP address is required"},
+		{args: []string{"add", "10.0.0.1", "10.0.0.2"}, want: "exactly one IP address is required"},
+		{args: []string{"add", "10.0.0.1", "-select-group", "web"}, want: "not both"},
+		{args: []string{"update"}, want: "exactly one schedule ID is required"},
+		{args: []string{"rm"}, want: "at least one schedule ID is required"},
+		{args: []string{"ls", "10.0.0.1", "10.0.0.2"}, want: "at most one IP address is allowed"},
+		{args: []string{"show"}, want: "exactly one schedule ID is required"},
+		{args: []string{"enable"}, want: "at least one schedule ID is required"},
+		{args: []string{"disable", "-o", "xml", "abc"}, want: `unknown output format "xml"`},
+	}
+
+	for _, tt := range tests {
+		_, _, err := runCommand(t, runSchedule, tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("schedule %s: got %v, want an error with %q", strings.Join(tt.args, " "), err, tt.want)
+		}
+	}
+}
+
+func TestWindowFlag(t *testing.T) {
+	var windows windowFlag
+	for _, value := range []string{"22:00-06:00", " sat,sun 00:00-23:59 ", ""} {
+		if err := windows.Set(value); err != nil {
+			t.Fatalf("%q: %v", value, err)
+		}
+	}
+	want := windowFlag{
+		{Start: "22:00", End: "06:00"},
+		{Days: []string{"sat", "sun"}, Start: "00:00", End: "23:59"},
+	}
+	if !reflect.DeepEqual(windows, want) {
+		t.Errorf("got %+v, want %+v", windows, want)
+	}
+	if got := windows.String(); got != "22:00-06:00; sat,sun 00:00-23:59" {
+		t.Errorf("String() = %q", got)
+	}
+
+	for _, value := range []string{"22:00", "mon tue 22:00-23:00"} {
+		if err := windows.Set(value); err == nil {
+			t.Errorf("%q: got no error", value)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// cmd/nexusscan/serve.go
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	lambdaService "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/api"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/enricher"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/exporter"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/notifier"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/processor"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/scheduler"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/worker"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/local"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+)
+
+// Environment the handlers read, with the values used in local mode. Values
+// already set in the environment win.
+var localEnvironment = map[string]string{
+	"TASKS_QUEUE_URL":         "local://nexusscan-tasks",
+	"RESULTS_QUEUE_URL":       "local://nexusscan-results",
+	"NOTIFICATIONS_QUEUE_URL": "local://nexusscan-notifications",
+	"SCHEDULER_FUNCTION":      "nexusscan-scheduler",
+	"ENRICHER_FUNCTION":       "nexusscan-enricher",
+	"EXPORTER_FUNCTION":       "nexusscan-exporter",
+}
+
+// runServe runs every NexusScan function in this process against an
+// embedded store, with the API served over plain HTTP
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "address to serve the API on")
+	dataFile := flags.String("data", "nexusscan.db", "file to keep inventory, schedules and results in")
+	token := flags.String("token", os.Getenv("NEXUSSCAN_TOKEN"), "bearer token required on API requests (default $NEXUSSCAN_TOKEN, none if empty)")
+	workers := flags.Int("workers", 4, "scan batches to run at once")
+	databaseURL := flags.String("database-url", os.Getenv("DATABASE_URL"), "PostgreSQL database to keep IPs, schedules, results, open ports and enrichment in; everything else stays in the data file (default $DATABASE_URL)")
+	exportsDir := flags.String("exports", "", "directory to keep exports in (default exports next to the data file)")
+	flags.Parse(args)
+
+	if *exportsDir == "" {
+		*exportsDir = filepath.Join(filepath.Dir(*dataFile), "exports")
+	}
+
+	for name, value := range localEnvironment {
+		if os.Getenv(name) == "" {
+			os.Setenv(name, value)
+		}
+	}
+
+	tables := database.TablesFromEnv()
+	store, err := local.OpenStore(*dataFile, tables)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	db := database.NewClientWithAPI(store, tables)
+	if *databaseURL != "" {
+		postgres, err := database.OpenPostgresStore(context.Background(), *databaseURL, tables)
+		if err != nil {
+			return err
+		}
+		defer postgres.Close()
+		db = database.NewClientWithStore(store, tables, postgres)
+	} else {
+		// Data files written before the inventory was paged by index hold
+		// IPs without its keys
+		backfilled, err := db.Store.(*database.DynamoDBStore).BackfillInventory(context.Background())
+		if err != nil {
+			return fmt.Errorf("error backfilling the inventory: %w", err)
+		}
+		if backfilled > 0 {
+			log.Printf("Added the inventory keys to %d IPs", backfilled)
+		}
+	}
+
+	objects, err := local.NewObjects(*exportsDir, serverURL(*addr)+exportsPath)
+	if err != nil {
+		return err
+	}
+
+	queues := local.NewQueues()
+	functions := local.NewFunctions()
+	platform.Use(&platform.Services{
+		DB:        db,
+		Queues:    queues,
+		Functions: functions,
+		Objects:   objects,
+	})
+
+	functions.Register(os.Getenv("SCHEDULER_FUNCTION"), scheduler.HandleSchedule)
+	functions.Register(os.Getenv("ENRICHER_FUNCTION"), enricher.HandleRequest)
+	functions.Register(os.Getenv("EXPORTER_FUNCTION"), exporter.HandleExport)
+
+	// Batch sizes and retries follow the event source mappings and
+	// dead-letter queues in template.yaml
+	queues.Consume(os.Getenv("TASKS_QUEUE_URL"), local.Consumer{
+		Handler:     worker.HandleSQSEvent,
+		BatchSize:   1,
+		Concurrency: *workers,
+		MaxReceives: 3,
+	})
+	queues.Consume(os.Getenv("RESULTS_QUEUE_URL"), local.Consumer{
+		Handler:     processor.HandleEvent,
+		BatchSize:   10,
+		MaxReceives: 10,
+	})
+	queues.Consume(os.Getenv("NOTIFICATIONS_QUEUE_URL"), local.Consumer{
+		Handler:     notifier.HandleSQSEvent,
+		BatchSize:   5,
+		MaxReceives: 3,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The EventBridge rules of the Lambda deployment
+	go every(ctx, time.Minute, func() {
+		invoke(ctx, functions, os.Getenv("SCHEDULER_FUNCTION"), `{"dispatch":true}`)
+	})
+	go every(ctx, 5*time.Minute, func() {
+		if err := processor.HandleStaleScans(ctx); err != nil {
+			log.Printf("Error finalizing stale scans: %v", err)
+		}
+	})
+	go every(ctx, 24*time.Hour, func() {
+		if err := enricher.HandleCertificateExpiry(ctx); err != nil {
+			log.Printf("Error checking certificate expiry: %v", err)
+		}
+	})
+	go every(ctx, time.Hour, func() {
+		if purged, err := store.PurgeExpired(); err != nil {
+			log.Printf("Error purging expired items: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d expired items", purged)
+		}
+		if purged, err := objects.Purge(models.ExportRetention); err != nil {
+			log.Printf("Error purging expired exports: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d expired exports", purged)
+		}
+	})
+
+	// Paths are passed on as they are, like API Gateway does, rather than
+	// cleaned and redirected by a ServeMux
+	api := apiHandler(*token)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, exportsPath+"/") {
+			objects.ServeHTTP(w, r)
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	log.Printf("NexusScan listening on http://%s (data in %s)", *addr, *dataFile)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	log.Printf("Shutting down, waiting for running scans to finish")
+	queues.Close()
+	functions.Wait()
+	return nil
+}
+
+// exportsPath is where serve hands out export downloads
+const exportsPath = "/exports"
+
+// serverURL returns the base URL of a listen address, naming localhost when
+// the address listens on every interface
+func serverURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// every runs fn at each interval until ctx is done
+func every(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
+
+// invoke starts an asynchronous invocation of a registered function
+func invoke(ctx context.Context, functions *local.Functions, name, payload string) {
+	_, err := functions.Invoke(ctx, &lambdaService.InvokeInput{
+		FunctionName:   aws.String(name),
+		Payload:        []byte(payload),
+		InvocationType: lambdaTypes.InvocationTypeEvent,
+	})
+	if err != nil {
+		log.Printf("Error invoking %s: %v", name, err)
+	}
+}
+
+// apiHandler serves the API handler over HTTP, translating requests and
+// responses the way API Gateway's proxy integration does
+func apiHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"Unauthorized"}`)
+				return
+			}
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		request := events.APIGatewayProxyRequest{
+			Path:                            r.URL.Path,
+			HTTPMethod:                      r.Method,
+			Headers:                         map[string]string{},
+			MultiValueHeaders:               r.Header,
+			QueryStringParameters:           map[string]string{},
+			MultiValueQueryStringParameters: r.URL.Query(),
+			Body:                            string(body),
+		}
+		for name := range r.Header {
+			request.Headers[name] = r.Header.Get(name)
+		}
+		for name := range r.URL.Query() {
+			request.QueryStringParameters[name] = r.URL.Query().Get(name)
+		}
+
+		response, err := api.HandleRequest(r.Context(), request)
+		if err != nil {
+			log.Printf("Error handling %s %s: %v", r.Method, r.URL.Path, err)
+			http.Error(w, `{"error":"Internal server error"}`, http.StatusBadGateway)
+			return
+		}
+
+		for name, value := range response.Headers {
+			w.Header().Set(name, value)
+		}
+		for name, values := range response.MultiValueHeaders {
+			for _, value := range values {
+				w.Header().Add(name, value)
+			}
+		}
+		if response.StatusCode == 0 {
+			response.StatusCode = http.StatusOK
+		}
+		w.WriteHeader(response.StatusCode)
+
+		if response.IsBase64Encoded {
+			decoded, err := base64.StdEncoding.DecodeString(response.Body)
+			if err != nil {
+				log.Printf("Error decoding response body: %v", err)
+				return
+			}
+			w.Write(decoded)
+			return
+		}
+		io.WriteString(w, response.Body)
+	})
+}
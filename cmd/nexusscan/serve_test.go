@@ -0,0 +1,25 @@
+// cmd/nexusscan/serve_test.go
+
+package main
+
+import "testing"
+
+func TestServerURL(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: ":8080", want: "http://localhost:8080"},
+		{addr: "0.0.0.0:8080", want: "http://localhost:8080"},
+		{addr: "[::]:8080", want: "http://localhost:8080"},
+		{addr: "127.0.0.1:8080", want: "http://127.0.0.1:8080"},
+		{addr: "[::1]:8080", want: "http://[::1]:8080"},
+		{addr: "[2001:db8::1]:9000", want: "http://[2001:db8::1]:9000"},
+	}
+
+	for _, tt := range tests {
+		if got := serverURL(tt.addr); got != tt.want {
+			t.Errorf("serverURL(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
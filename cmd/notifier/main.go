@@ -0,0 +1,13 @@
+// cmd/notifier/main.go
+
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/handlers/notifier"
+)
+
+// The notifier Lambda handles events from the notifications queue
+func main() {
+	lambda.Start(notifier.HandleSQSEvent)
+}
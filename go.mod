@@ -10,6 +10,10 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/dynamodb v1.21.5
 	github.com/aws/aws-sdk-go-v2/service/lambda v1.39.5
 	github.com/aws/aws-sdk-go-v2/service/sqs v1.24.5
+	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.10.9
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.14.0
 )
 
 require (
@@ -27,6 +31,6 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.17.1 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.23.0 // indirect
 	github.com/aws/smithy-go v1.15.0 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
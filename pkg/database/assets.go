@@ -0,0 +1,170 @@
+// pkg/database/assets.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Attributes that hold asset metadata on the IPs table, named through
+// placeholders since OWNER, GROUP and DESCRIPTION are reserved words
+var metadataAttributeNames = map[string]string{
+	"#tags":        "Tags",
+	"#description": "Description",
+	"#owner":       "Owner",
+	"#group":       "AssetGroup",
+}
+
+// GetIP returns one IP of the inventory
+func (s *DynamoDBStore) GetIP(ctx context.Context, ipAddress string) (*models.IP, error) {
+	result, err := s.DynamoDB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.Tables.IPs),
+		Key: map[string]types.AttributeValue{
+			"IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, ErrIPNotFound
+	}
+
+	var ip models.IP
+	if err := attributevalue.UnmarshalMap(result.Item, &ip); err != nil {
+		return nil, err
+	}
+	return &ip, nil
+}
+
+// SetIPMetadata replaces the tags, description, owner and group of an IP,
+// removing the attributes of those left empty
+func (s *DynamoDBStore) SetIPMetadata(ctx context.Context, ipAddress string, metadata models.AssetMetadata) error {
+	values := map[string]types.AttributeValue{}
+	var set, remove []string
+
+	if len(metadata.Tags) > 0 {
+		tags, err := attributevalue.Marshal(metadata.Tags)
+		if err != nil {
+			return err
+		}
+		values[":tags"] = tags
+		set = append(set, "#tags = :tags")
+	} else {
+		remove = append(remove, "#tags")
+	}
+	for _, field := range []struct{ name, value string }{
+		{"description", metadata.Description},
+		{"owner", metadata.Owner},
+		{"group", metadata.Group},
+	} {
+		if field.value == "" {
+			remove = append(remove, "#"+field.name)
+			continue
+		}
+		values[":"+field.name] = &types.AttributeValueMemberS{Value: field.value}
+		set = append(set, fmt.Sprintf("#%s = :%s", field.name, field.name))
+	}
+
+	updateExpression := ""
+	if len(set) > 0 {
+		updateExpression = "SET " + strings.Join(set, ", ")
+	}
+	if len(remove) > 0 {
+		updateExpression += " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.Tables.IPs),
+		Key: map[string]types.AttributeValue{
+			"IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
+		},
+		UpdateExpression:         aws.String(updateExpression),
+		ConditionExpression:      aws.String("attribute_exists(IPAddress)"),
+		ExpressionAttributeNames: metadataAttributeNames,
+	}
+	if len(values) > 0 {
+		input.ExpressionAttributeValues = values
+	}
+
+	_, err := s.DynamoDB.UpdateItem(ctx, input)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrIPNotFound
+	}
+	return err
+}
+
+// selectorConditions returns the filter conditions of a selector, adding
+// the names and values they use to the query
+func selectorConditions(selector models.AssetSelector, input *dynamodb.QueryInput) []string {
+	if selector.IsEmpty() {
+		return nil
+	}
+	if input.ExpressionAttributeNames == nil {
+		input.ExpressionAttributeNames = map[string]string{}
+	}
+
+	var conditions []string
+	if selector.Group != "" {
+		input.ExpressionAttributeNames["#group"] = metadataAttributeNames["#group"]
+		input.ExpressionAttributeValues[":group"] = &types.AttributeValueMemberS{Value: selector.Group}
+		conditions = append(conditions, "#group = :group")
+	}
+	if selector.Owner != "" {
+		input.ExpressionAttributeNames["#owner"] = metadataAttributeNames["#owner"]
+		input.ExpressionAttributeValues[":owner"] = &types.AttributeValueMemberS{Value: selector.Owner}
+		conditions = append(conditions, "#owner = :owner")
+	}
+
+	keys := make([]string, 0, len(selector.Tags))
+	for key := range selector.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		input.ExpressionAttributeNames["#tags"] = metadataAttributeNames["#tags"]
+	}
+	for i, key := range keys {
+		name := fmt.Sprintf("#tag%d", i)
+		input.ExpressionAttributeNames[name] = key
+		if selector.Tags[key] == "" {
+			conditions = append(conditions, fmt.Sprintf("attribute_exists(#tags.%s)", name))
+			continue
+		}
+		value := fmt.Sprintf(":tag%d", i)
+		input.ExpressionAttributeValues[value] = &types.AttributeValueMemberS{Value: selector.Tags[key]}
+		conditions = append(conditions, fmt.Sprintf("#tags.%s = %s", name, value))
+	}
+	return conditions
+}
+
+// SelectIPs returns every IP in the inventory a selector matches, paging
+// through the whole listing
+func (c *Client) SelectIPs(ctx context.Context, selector models.AssetSelector) ([]string, error) {
+	query := IPQuery{Selector: selector, Limit: MaxPageSize}
+	var ips []string
+	for {
+		page, err := c.ListIPs(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range page.IPs {
+			ips = append(ips, ip.IPAddress)
+		}
+		if page.NextCursor == "" {
+			return ips, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
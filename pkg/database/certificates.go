@@ -0,0 +1,476 @@
+// pkg/database/certificates.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// The certificate inventory keeps one item per certificate and port, so
+// enrichments of different IPs never write the same item. Every item is in
+// the same Inventory partition of the ExpiryIndex, which holds the whole
+// inventory in expiry order.
+const (
+	certificateExpiryIndex    = "ExpiryIndex"
+	certificateIPAddressIndex = "IPAddressIndex"
+	certificateInventory      = "certificate"
+)
+
+// certificateRetention is how long a certificate is kept on a port after it
+// was last seen there
+const certificateRetention = 90 * 24 * time.Hour
+
+// ErrCertificateNotFound is returned for fingerprints not in the inventory
+var ErrCertificateNotFound = errors.New("certificate not found")
+
+// CertificateSighting is a leaf certificate an enrichment found on a port
+type CertificateSighting struct {
+	IPAddress   string
+	Port        int
+	Hostname    string
+	Mismatched  bool // The certificate does not cover Hostname
+	Certificate TLSCertificate
+}
+
+// CertificateQuery selects a page of the certificate inventory, soonest
+// expiry first. Each filter that is set keeps only the certificates it
+// matches.
+type CertificateQuery struct {
+	// ExpiringWithin keeps certificates that expire within this many days,
+	// including those already expired
+	ExpiringWithin *int
+	SelfSigned     bool
+	Mismatched     bool
+	// Issuer keeps certificates whose issuer CN or DN contains it, ignoring case
+	Issuer string
+	Limit  int
+	Cursor string
+}
+
+// CertificatePage is one page of the certificate inventory. Total counts
+// every certificate the query matches.
+type CertificatePage struct {
+	Certificates []models.Certificate
+	NextCursor   string
+	Total        int
+}
+
+func (q CertificateQuery) listing() string {
+	within := ""
+	if q.ExpiringWithin != nil {
+		within = strconv.Itoa(*q.ExpiringWithin)
+	}
+	return fmt.Sprintf("certificates|%s|%t|%t|%s", within, q.SelfSigned, q.Mismatched, strings.ToLower(q.Issuer))
+}
+
+func (q CertificateQuery) keeps(cert models.Certificate) bool {
+	if q.SelfSigned && !cert.SelfSigned {
+		return false
+	}
+	if q.Mismatched && !cert.Mismatched {
+		return false
+	}
+	if q.Issuer != "" {
+		issuer := strings.ToLower(q.Issuer)
+		if !strings.Contains(strings.ToLower(cert.IssuerCN), issuer) && !strings.Contains(strings.ToLower(cert.IssuerDN), issuer) {
+			return false
+		}
+	}
+	return true
+}
+
+// certificateRecord is the stored form of a certificate on one port
+type certificateRecord struct {
+	Fingerprint        string   `dynamodbav:"Fingerprint"`
+	Location           string   `dynamodbav:"Location"` // IP address and port, joined by #
+	Inventory          string   `dynamodbav:"Inventory"`
+	IPAddress          string   `dynamodbav:"IPAddress"`
+	Port               int      `dynamodbav:"Port"`
+	Hostname           string   `dynamodbav:"Hostname,omitempty"`
+	Mismatched         bool     `dynamodbav:"Mismatched"`
+	Current            bool     `dynamodbav:"Current"`
+	SubjectCN          string   `dynamodbav:"SubjectCN,omitempty"`
+	SubjectAN          []string `dynamodbav:"SubjectAN,omitempty"`
+	IssuerCN           string   `dynamodbav:"IssuerCN,omitempty"`
+	IssuerDN           string   `dynamodbav:"IssuerDN,omitempty"`
+	Serial             string   `dynamodbav:"Serial,omitempty"`
+	NotBefore          string   `dynamodbav:"NotBefore,omitempty"`
+	NotAfter           string   `dynamodbav:"NotAfter"`
+	KeyAlgorithm       string   `dynamodbav:"KeyAlgorithm,omitempty"`
+	KeyBits            int      `dynamodbav:"KeyBits,omitempty"`
+	SignatureAlgorithm string   `dynamodbav:"SignatureAlgorithm,omitempty"`
+	SelfSigned         bool     `dynamodbav:"SelfSigned"`
+	FirstSeen          string   `dynamodbav:"FirstSeen"`
+	LastSeen           string   `dynamodbav:"LastSeen"`
+	ExpirationTime     int64    `dynamodbav:"ExpirationTime"`
+}
+
+func certificateLocation(ipAddress string, port int) string {
+	return ipAddress + "#" + strconv.Itoa(port)
+}
+
+// RecordCertificates adds what an enrichment of an IP found to the
+// inventory. ports are the ports that were enriched: certificates seen on
+// them before but not found now are no longer current there.
+func (c *Client) RecordCertificates(ctx context.Context, ipAddress string, ports []int, sightings []CertificateSighting, seenAt time.Time) error {
+	seenAt = seenAt.UTC()
+	seen := make(map[string]bool, len(sightings))
+
+	for _, sighting := range sightings {
+		cert := sighting.Certificate
+		if cert.FingerprintSHA256 == "" || cert.NotAfter == "" {
+			continue
+		}
+		record := certificateRecord{
+			Fingerprint:        cert.FingerprintSHA256,
+			Location:           certificateLocation(sighting.IPAddress, sighting.Port),
+			Inventory:          certificateInventory,
+			IPAddress:          sighting.IPAddress,
+			Port:               sighting.Port,
+			Hostname:           sighting.Hostname,
+			Mismatched:         sighting.Mismatched,
+			Current:            true,
+			SubjectCN:          cert.SubjectCN,
+			SubjectAN:          cert.SubjectAN,
+			IssuerCN:           cert.IssuerCN,
+			IssuerDN:           cert.IssuerDN,
+			Serial:             cert.Serial,
+			NotBefore:          cert.NotBefore,
+			NotAfter:           cert.NotAfter,
+			KeyAlgorithm:       cert.KeyAlgorithm,
+			KeyBits:            cert.KeyBits,
+			SignatureAlgorithm: cert.SignatureAlgorithm,
+			SelfSigned:         cert.SelfSigned,
+			LastSeen:           seenAt.Format(time.RFC3339),
+			ExpirationTime:     seenAt.Add(certificateRetention).Unix(),
+		}
+		if err := c.putCertificateRecord(ctx, record); err != nil {
+			return err
+		}
+		seen[record.Fingerprint+"|"+record.Location] = true
+	}
+
+	enriched := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		enriched[port] = true
+	}
+	records, err := c.ipCertificateRecords(ctx, ipAddress)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if !record.Current || !enriched[record.Port] || seen[record.Fingerprint+"|"+record.Location] {
+			continue
+		}
+		_, err := c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(c.Tables.Certificates),
+			Key: map[string]types.AttributeValue{
+				"Fingerprint": &types.AttributeValueMemberS{Value: record.Fingerprint},
+				"Location":    &types.AttributeValueMemberS{Value: record.Location},
+			},
+			UpdateExpression:    aws.String("SET #current = :false"),
+			ConditionExpression: aws.String("attribute_exists(Fingerprint)"),
+			ExpressionAttributeNames: map[string]string{
+				"#current": "Current",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":false": &types.AttributeValueMemberBOOL{Value: false},
+			},
+		})
+		var conditionFailed *types.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &conditionFailed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// putCertificateRecord writes a sighting, keeping FirstSeen from the first
+// time the certificate was seen on the port
+func (c *Client) putCertificateRecord(ctx context.Context, record certificateRecord) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+	key := map[string]types.AttributeValue{
+		"Fingerprint": item["Fingerprint"],
+		"Location":    item["Location"],
+	}
+	delete(item, "Fingerprint")
+	delete(item, "Location")
+	delete(item, "FirstSeen")
+
+	names := make(map[string]string, len(item)+1)
+	values := make(map[string]types.AttributeValue, len(item)+1)
+	assignments := make([]string, 0, len(item)+1)
+	i := 0
+	for attribute, value := range item {
+		names[fmt.Sprintf("#a%d", i)] = attribute
+		values[fmt.Sprintf(":a%d", i)] = value
+		assignments = append(assignments, fmt.Sprintf("#a%d = :a%d", i, i))
+		i++
+	}
+	names["#firstSeen"] = "FirstSeen"
+	values[":firstSeen"] = &types.AttributeValueMemberS{Value: record.LastSeen}
+	assignments = append(assignments, "#firstSeen = if_not_exists(#firstSeen, :firstSeen)")
+
+	_, err = c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(c.Tables.Certificates),
+		Key:                       key,
+		UpdateExpression:          aws.String("SET " + strings.Join(assignments, ", ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	return err
+}
+
+// ipCertificateRecords returns every certificate record of an IP
+func (c *Client) ipCertificateRecords(ctx context.Context, ipAddress string) ([]certificateRecord, error) {
+	paginator := dynamodb.NewQueryPaginator(c.DynamoDB, &dynamodb.QueryInput{
+		TableName:              aws.String(c.Tables.Certificates),
+		IndexName:              aws.String(certificateIPAddressIndex),
+		KeyConditionExpression: aws.String("IPAddress = :ip"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ip": &types.AttributeValueMemberS{Value: ipAddress},
+		},
+	})
+
+	var records []certificateRecord
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var pageRecords []certificateRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageRecords); err != nil {
+			return nil, err
+		}
+		records = append(records, pageRecords...)
+	}
+	return records, nil
+}
+
+// ListCertificates returns a page of the certificate inventory. The items
+// of every certificate the expiry filter keeps are read and grouped, then
+// the other filters are applied.
+func (c *Client) ListCertificates(ctx context.Context, query CertificateQuery) (CertificatePage, error) {
+	listing := query.listing()
+	cursor, err := decodePageCursor(query.Cursor, listing)
+	if err != nil {
+		return CertificatePage{}, err
+	}
+
+	now := time.Now().UTC()
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(c.Tables.Certificates),
+		IndexName:              aws.String(certificateExpiryIndex),
+		KeyConditionExpression: aws.String("Inventory = :inventory"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":inventory": &types.AttributeValueMemberS{Value: certificateInventory},
+		},
+	}
+	if query.ExpiringWithin != nil {
+		cutoff := now.Add(time.Duration(*query.ExpiringWithin) * 24 * time.Hour)
+		input.KeyConditionExpression = aws.String("Inventory = :inventory AND NotAfter <= :cutoff")
+		input.ExpressionAttributeValues[":cutoff"] = &types.AttributeValueMemberS{Value: cutoff.Format(time.RFC3339)}
+	}
+
+	grouped := make(map[string][]certificateRecord)
+	paginator := dynamodb.NewQueryPaginator(c.DynamoDB, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return CertificatePage{}, err
+		}
+		var records []certificateRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &records); err != nil {
+			return CertificatePage{}, err
+		}
+		for _, record := range records {
+			grouped[record.Fingerprint] = append(grouped[record.Fingerprint], record)
+		}
+	}
+
+	var certs []models.Certificate
+	for _, records := range grouped {
+		if cert := certificateFromRecords(records, now); query.keeps(cert) {
+			certs = append(certs, cert)
+		}
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		if !certs[i].NotAfter.Equal(certs[j].NotAfter) {
+			return certs[i].NotAfter.Before(certs[j].NotAfter)
+		}
+		return certs[i].Fingerprint < certs[j].Fingerprint
+	})
+
+	// Skip to the certificate after the cursor's
+	start := 0
+	if len(cursor.LastKey) > 0 {
+		lastNotAfter, err := time.Parse(time.RFC3339, cursor.LastKey["NotAfter"])
+		if err != nil || cursor.LastKey["Fingerprint"] == "" {
+			return CertificatePage{}, ErrInvalidCursor
+		}
+		for start < len(certs) {
+			cert := certs[start]
+			if cert.NotAfter.After(lastNotAfter) || (cert.NotAfter.Equal(lastNotAfter) && cert.Fingerprint > cursor.LastKey["Fingerprint"]) {
+				break
+			}
+			start++
+		}
+	}
+
+	end := start + pageSize(query.Limit)
+	if end > len(certs) {
+		end = len(certs)
+	}
+	page := CertificatePage{Certificates: certs[start:end], Total: len(certs)}
+	if end < len(certs) {
+		last := certs[end-1]
+		page.NextCursor, err = nextPageCursor(listing, map[string]string{
+			"NotAfter":    last.NotAfter.Format(time.RFC3339),
+			"Fingerprint": last.Fingerprint,
+		}, page.Total)
+	}
+	return page, err
+}
+
+// GetCertificate returns one certificate of the inventory with every port
+// it has been seen on
+func (c *Client) GetCertificate(ctx context.Context, fingerprint string) (*models.Certificate, error) {
+	paginator := dynamodb.NewQueryPaginator(c.DynamoDB, &dynamodb.QueryInput{
+		TableName:              aws.String(c.Tables.Certificates),
+		KeyConditionExpression: aws.String("Fingerprint = :fingerprint"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":fingerprint": &types.AttributeValueMemberS{Value: strings.ToLower(fingerprint)},
+		},
+	})
+
+	var records []certificateRecord
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var pageRecords []certificateRecord
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageRecords); err != nil {
+			return nil, err
+		}
+		records = append(records, pageRecords...)
+	}
+	if len(records) == 0 {
+		return nil, ErrCertificateNotFound
+	}
+
+	cert := certificateFromRecords(records, time.Now().UTC())
+	return &cert, nil
+}
+
+// certificateFromRecords merges the items of one certificate. It was first
+// seen on its earliest port and last seen on its latest, and is mismatched
+// if any port serves it for a hostname it does not cover.
+func certificateFromRecords(records []certificateRecord, now time.Time) models.Certificate {
+	parse := func(value string) time.Time {
+		t, _ := time.Parse(time.RFC3339, value)
+		return t
+	}
+
+	first := records[0]
+	cert := models.Certificate{
+		Fingerprint:        first.Fingerprint,
+		SubjectCN:          first.SubjectCN,
+		SubjectAN:          first.SubjectAN,
+		IssuerCN:           first.IssuerCN,
+		IssuerDN:           first.IssuerDN,
+		Serial:             first.Serial,
+		NotBefore:          parse(first.NotBefore),
+		NotAfter:           parse(first.NotAfter),
+		KeyAlgorithm:       first.KeyAlgorithm,
+		KeyBits:            first.KeyBits,
+		SignatureAlgorithm: first.SignatureAlgorithm,
+		SelfSigned:         first.SelfSigned,
+		Locations:          make([]models.CertificateLocation, 0, len(records)),
+	}
+	cert.DaysLeft = models.DaysUntil(cert.NotAfter, now)
+
+	for _, record := range records {
+		location := models.CertificateLocation{
+			IPAddress:  record.IPAddress,
+			Port:       record.Port,
+			Hostname:   record.Hostname,
+			Mismatched: record.Mismatched,
+			Current:    record.Current,
+			FirstSeen:  parse(record.FirstSeen),
+			LastSeen:   parse(record.LastSeen),
+		}
+		cert.Locations = append(cert.Locations, location)
+		cert.Mismatched = cert.Mismatched || record.Mismatched
+		if cert.FirstSeen.IsZero() || location.FirstSeen.Before(cert.FirstSeen) {
+			cert.FirstSeen = location.FirstSeen
+		}
+		if location.LastSeen.After(cert.LastSeen) {
+			cert.LastSeen = location.LastSeen
+		}
+	}
+
+	sort.Slice(cert.Locations, func(i, j int) bool {
+		if cert.Locations[i].IPAddress != cert.Locations[j].IPAddress {
+			return cert.Locations[i].IPAddress < cert.Locations[j].IPAddress
+		}
+		return cert.Locations[i].Port < cert.Locations[j].Port
+	})
+	return cert
+}
+
+// DeleteIPCertificates removes an IP from the certificate inventory (used
+// when deleting an IP). Certificates seen on no other IP go with it.
+func (c *Client) DeleteIPCertificates(ctx context.Context, ipAddress string) error {
+	records, err := c.ipCertificateRecords(ctx, ipAddress)
+	if err != nil {
+		return err
+	}
+
+	// Process up to 25 items at a time (DynamoDB batch limit)
+	for i := 0; i < len(records); i += 25 {
+		end := i + 25
+		if end > len(records) {
+			end = len(records)
+		}
+
+		deleteRequests := make([]types.WriteRequest, 0, end-i)
+		for _, record := range records[i:end] {
+			deleteRequests = append(deleteRequests, types.WriteRequest{
+				DeleteRequest: &types.DeleteRequest{
+					Key: map[string]types.AttributeValue{
+						"Fingerprint": &types.AttributeValueMemberS{Value: record.Fingerprint},
+						"Location":    &types.AttributeValueMemberS{Value: record.Location},
+					},
+				},
+			})
+		}
+
+		_, err := c.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				c.Tables.Certificates: deleteRequests,
+			},
+		})
+		if err != nil {
+			log.Printf("Error batch deleting certificates for IP %s: %v", ipAddress, err)
+			return err
+		}
+	}
+	return nil
+}
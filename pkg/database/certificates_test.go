@@ -0,0 +1,157 @@
+// pkg/database/certificates_test.go
+
+package database_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// TestCertificateInventory checks that a certificate served on several
+// ports and IPs is listed once with each of its locations
+func TestCertificateInventory(t *testing.T) {
+	ctx := context.Background()
+	db := newLocalClient(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	shared := database.TLSCertificate{
+		SubjectCN:         "www.example.com",
+		SubjectAN:         []string{"www.example.com", "example.com"},
+		IssuerCN:          "Example CA",
+		NotBefore:         now.AddDate(0, -1, 0).Format(time.RFC3339),
+		NotAfter:          now.AddDate(0, 0, 10).Format(time.RFC3339),
+		FingerprintSHA256: strings.Repeat("a", 64),
+	}
+	selfSigned := database.TLSCertificate{
+		SubjectCN:         "localhost",
+		IssuerCN:          "localhost",
+		SelfSigned:        true,
+		NotAfter:          now.AddDate(1, 0, 0).Format(time.RFC3339),
+		FingerprintSHA256: strings.Repeat("b", 64),
+	}
+	sighting := func(ip string, port int, hostname string, mismatched bool, cert database.TLSCertificate) database.CertificateSighting {
+		return database.CertificateSighting{IPAddress: ip, Port: port, Hostname: hostname, Mismatched: mismatched, Certificate: cert}
+	}
+
+	firstSeen := now.Add(-time.Hour)
+	if err := db.RecordCertificates(ctx, "10.0.0.1", []int{443, 8443, 9443}, []database.CertificateSighting{
+		sighting("10.0.0.1", 443, "www.example.com", false, shared),
+		sighting("10.0.0.1", 8443, "www.example.com", false, shared),
+		sighting("10.0.0.1", 9443, "", false, selfSigned),
+	}, firstSeen); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RecordCertificates(ctx, "10.0.0.2", []int{443}, []database.CertificateSighting{
+		sighting("10.0.0.2", 443, "api.example.com", true, shared),
+	}, firstSeen); err != nil {
+		t.Fatal(err)
+	}
+	// A sighting without a fingerprint cannot be told apart and is left out
+	if err := db.RecordCertificates(ctx, "10.0.0.3", []int{443}, []database.CertificateSighting{
+		sighting("10.0.0.3", 443, "", false, database.TLSCertificate{NotAfter: shared.NotAfter}),
+	}, firstSeen); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := db.ListCertificates(ctx, database.CertificateQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Certificates) != 2 {
+		t.Fatalf("listed %d certificates of %d, want 2", len(page.Certificates), page.Total)
+	}
+	cert := page.Certificates[0]
+	if cert.Fingerprint != shared.FingerprintSHA256 {
+		t.Fatalf("first certificate is %s, want the one expiring soonest", cert.Fingerprint)
+	}
+	var got []string
+	for _, location := range cert.Locations {
+		got = append(got, location.IPAddress+"#"+strconv.Itoa(location.Port))
+	}
+	if want := []string{"10.0.0.1#443", "10.0.0.1#8443", "10.0.0.2#443"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("locations = %v, want %v", got, want)
+	}
+	// One IP serves it for a name it does not cover
+	if !cert.Mismatched || cert.SelfSigned || cert.DaysLeft < 9 || cert.DaysLeft > 10 {
+		t.Errorf("mismatched %v, self-signed %v, %d days left, want mismatched, not self-signed, with 10 days left at most", cert.Mismatched, cert.SelfSigned, cert.DaysLeft)
+	}
+	if !cert.FirstSeen.Equal(firstSeen) || !cert.LastSeen.Equal(firstSeen) {
+		t.Errorf("seen from %s to %s, want %s", cert.FirstSeen, cert.LastSeen, firstSeen)
+	}
+
+	// The certificate moves off one port of the first IP
+	if err := db.RecordCertificates(ctx, "10.0.0.1", []int{443, 8443}, []database.CertificateSighting{
+		sighting("10.0.0.1", 443, "www.example.com", false, shared),
+	}, now); err != nil {
+		t.Fatal(err)
+	}
+	again, err := db.GetCertificate(ctx, strings.ToUpper(shared.FingerprintSHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Locations) != 3 || len(again.CurrentLocations()) != 2 {
+		t.Errorf("%d locations with %d current, want 3 with 2", len(again.Locations), len(again.CurrentLocations()))
+	}
+	for _, location := range again.Locations {
+		switch location.IPAddress + "#" + strconv.Itoa(location.Port) {
+		case "10.0.0.1#443":
+			if !location.Current || !location.FirstSeen.Equal(firstSeen) || !location.LastSeen.Equal(now) {
+				t.Errorf("port 443 seen from %s to %s (current %v), want %s to %s", location.FirstSeen, location.LastSeen, location.Current, firstSeen, now)
+			}
+		case "10.0.0.1#8443":
+			if location.Current || !location.LastSeen.Equal(firstSeen) {
+				t.Errorf("port 8443 last seen %s (current %v), want %s and not current", location.LastSeen, location.Current, firstSeen)
+			}
+		}
+	}
+	if !again.FirstSeen.Equal(firstSeen) || !again.LastSeen.Equal(now) {
+		t.Errorf("seen from %s to %s, want %s to %s", again.FirstSeen, again.LastSeen, firstSeen, now)
+	}
+
+	// Filters
+	thirty, five := 30, 5
+	for _, tt := range []struct {
+		query database.CertificateQuery
+		want  []string
+	}{
+		{database.CertificateQuery{SelfSigned: true}, []string{selfSigned.FingerprintSHA256}},
+		{database.CertificateQuery{Mismatched: true}, []string{shared.FingerprintSHA256}},
+		{database.CertificateQuery{Issuer: "example ca"}, []string{shared.FingerprintSHA256}},
+		{database.CertificateQuery{ExpiringWithin: &thirty}, []string{shared.FingerprintSHA256}},
+		{database.CertificateQuery{ExpiringWithin: &five}, nil},
+	} {
+		page, err := db.ListCertificates(ctx, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fingerprints []string
+		for _, cert := range page.Certificates {
+			fingerprints = append(fingerprints, cert.Fingerprint)
+		}
+		if !reflect.DeepEqual(fingerprints, tt.want) {
+			t.Errorf("%+v listed %v, want %v", tt.query, fingerprints, tt.want)
+		}
+	}
+
+	// Deleting an IP keeps the certificates other IPs serve
+	if err := db.DeleteIPCertificates(ctx, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := db.GetCertificate(ctx, shared.FingerprintSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining.Locations) != 1 || remaining.Locations[0].IPAddress != "10.0.0.2" {
+		t.Errorf("locations after deleting 10.0.0.1 = %+v, want 10.0.0.2 alone", remaining.Locations)
+	}
+	if _, err := db.GetCertificate(ctx, selfSigned.FingerprintSHA256); !errors.Is(err, database.ErrCertificateNotFound) {
+		t.Errorf("getting a certificate of the deleted IP alone: %v, want %v", err, database.ErrCertificateNotFound)
+	}
+}
@@ -4,9 +4,11 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
-	"fmt"
+	"strings"
 	"time"
 	"encoding/json"
 
@@ -19,18 +21,62 @@ import (
 	"github.com/google/uuid"
 )
 
-// Client wraps DynamoDB client with utility methods
+// DynamoDBAPI is the part of the DynamoDB API the database client uses. It is
+// satisfied by *dynamodb.Client and by the embedded store used in local mode.
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// Client wraps DynamoDB client with utility methods. IPs, schedules, results,
+// open ports and enrichment go through the embedded Store, which can be any
+// backend; scan jobs, port sets, profiles, port changes, notifications,
+// exports, certificates and the current state of each port are always kept
+// in DynamoDB.
 type Client struct {
-	DynamoDB *dynamodb.Client
+	Store
+	DynamoDB DynamoDBAPI
+	Tables   Tables
 }
 
-// NewClient creates a new database client
+// NewClient creates a new database client, with table names from the
+// environment
 func NewClient(cfg aws.Config) *Client {
+	return NewClientWithAPI(dynamodb.NewFromConfig(cfg), TablesFromEnv())
+}
+
+// NewClientWithAPI creates a database client on any implementation of the
+// DynamoDB API
+func NewClientWithAPI(api DynamoDBAPI, tables Tables) *Client {
+	return NewClientWithStore(api, tables, NewDynamoDBStore(api, tables))
+}
+
+// NewClientWithStore creates a database client that keeps IPs, schedules,
+// results, open ports and enrichment in store
+func NewClientWithStore(api DynamoDBAPI, tables Tables, store Store) *Client {
 	return &Client{
-		DynamoDB: dynamodb.NewFromConfig(cfg),
+		Store:    store,
+		DynamoDB: api,
+		Tables:   tables,
 	}
 }
 
+// DynamoDBStore is the Store on the DynamoDB tables of template.yaml
+type DynamoDBStore struct {
+	DynamoDB DynamoDBAPI
+	Tables   Tables
+}
+
+// NewDynamoDBStore creates a store on the given tables
+func NewDynamoDBStore(api DynamoDBAPI, tables Tables) *DynamoDBStore {
+	return &DynamoDBStore{DynamoDB: api, Tables: tables}
+}
+
 // DefaultClient creates a client with default config
 func DefaultClient(ctx context.Context) (*Client, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
@@ -41,61 +87,106 @@ func DefaultClient(ctx context.Context) (*Client, error) {
 }
 
 // AddIP adds a new IP address to the database
-func (c *Client) AddIP(ctx context.Context, ipAddress string) error {
-	timestamp := time.Now().Format(time.RFC3339)
+func (s *DynamoDBStore) AddIP(ctx context.Context, ipAddress string) error {
+	return s.AddIPFromNetwork(ctx, ipAddress, "", "", models.AssetMetadata{})
+}
+
+// AddIPFromNetwork adds an IP address that was expanded from a CIDR block,
+// range or hostname, recording where it came from so the inventory can be
+// grouped and deleted by network. An IP that is already in the inventory
+// keeps when it was added and last scanned; its metadata is merged with the
+// given metadata, and its network and hostname are only filled in if unset.
+func (s *DynamoDBStore) AddIPFromNetwork(ctx context.Context, ipAddress string, network string, hostname string, metadata models.AssetMetadata) error {
+	timestamp := time.Now().UTC().Format(time.RFC3339)
 	
-	item := map[string]types.AttributeValue{
-		"IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
-		"CreatedAt": &types.AttributeValueMemberS{Value: timestamp},
+	// Tags, description, owner and group, each only when set
+	item, err := attributevalue.MarshalMap(metadata)
+	if err != nil {
+		return err
+	}
+	
+	// Inventory and LastScanned key the inventory indexes, so every IP has
+	// both; LastScanned is the zero time until the IP is first scanned
+	item["IPAddress"] = &types.AttributeValueMemberS{Value: ipAddress}
+	item["CreatedAt"] = &types.AttributeValueMemberS{Value: timestamp}
+	item["Inventory"] = &types.AttributeValueMemberS{Value: inventoryPartition}
+	item["LastScanned"] = &types.AttributeValueMemberS{Value: neverScanned}
+	
+	// Only set when present; NetworkIndex is sparse
+	if network != "" {
+		item["Network"] = &types.AttributeValueMemberS{Value: network}
+	}
+	if hostname != "" {
+		item["Hostname"] = &types.AttributeValueMemberS{Value: hostname}
 	}
 	
-	_, err := c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String("nexusscan-ips"),
-		Item:      item,
+	_, err = s.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.Tables.IPs),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(IPAddress)"),
 	})
 	
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) {
+		return err
+	}
+	return s.readdIP(ctx, ipAddress, network, hostname, metadata)
+}
+
+// readdIP merges metadata into an IP that is already in the inventory and
+// fills in its network, hostname and inventory keys where they are unset
+func (s *DynamoDBStore) readdIP(ctx context.Context, ipAddress string, network string, hostname string, metadata models.AssetMetadata) error {
+	existing, err := s.GetIP(ctx, ipAddress)
+	if err != nil {
+		return err
+	}
+	
+	merged := existing.AssetMetadata.Merge(metadata)
+	if err := merged.Validate(); err != nil {
+		return fmt.Errorf("merging metadata of IP %s: %w", ipAddress, err)
+	}
+	if err := s.SetIPMetadata(ctx, ipAddress, merged); err != nil {
+		return err
+	}
+	
+	// IPs added before the inventory indexes existed get their keys here,
+	// as they would from the backfill. Network and hostname are only set
+	// when present; NetworkIndex is sparse.
+	values := map[string]types.AttributeValue{
+		":inventory":    &types.AttributeValueMemberS{Value: inventoryPartition},
+		":neverScanned": &types.AttributeValueMemberS{Value: neverScanned},
+	}
+	set := []string{"Inventory = if_not_exists(Inventory, :inventory)", "LastScanned = if_not_exists(LastScanned, :neverScanned)"}
+	for _, field := range []struct{ attribute, placeholder, value string }{
+		{"Network", ":network", network},
+		{"Hostname", ":hostname", hostname},
+	} {
+		if field.value != "" {
+			values[field.placeholder] = &types.AttributeValueMemberS{Value: field.value}
+			set = append(set, fmt.Sprintf("%s = if_not_exists(%s, %s)", field.attribute, field.attribute, field.placeholder))
+		}
+	}
+	
+	_, err = s.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.Tables.IPs),
+		Key: map[string]types.AttributeValue{
+			"IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
+		},
+		UpdateExpression:          aws.String("SET " + strings.Join(set, ", ")),
+		ExpressionAttributeValues: values,
+	})
 	return err
 }
 
 
-// StoreFinalScanSummary stores a final summary of a completed scan with all discovered ports
-func (c *Client) StoreFinalScanSummary(ctx context.Context, ipAddress string, scanID string, 
-    openPorts []models.Port, scanDuration time.Duration, portsScanned int, 
-    useHistoricalPorts bool) error {
-    
-    timestamp := time.Now().Format(time.RFC3339)
+// StoreFinalScanSummary stores a final summary of a finished scan with all discovered ports.
+// scanStatus records whether every batch reported (completed) or some were lost (partial).
+func (s *DynamoDBStore) StoreFinalScanSummary(ctx context.Context, ipAddress string, scanID string, 
+    protocol string, profile string, scanStatus string, openPorts []models.Port, portsProbed string, scanDuration time.Duration, portsScanned int, 
+    stateCounts models.PortStateCounts, useHistoricalPorts bool) error {
     
     // Determine which ports to include in the final summary
-    var finalOpenPorts []models.Port
-    
-    if useHistoricalPorts {
-        // Get previously discovered open ports to include in summary
-        completeOpenPorts, err := c.GetOpenPorts(ctx, ipAddress)
-        if err != nil {
-            log.Printf("Error getting complete open ports for IP %s: %v", ipAddress, err)
-            finalOpenPorts = openPorts // Use current ports if can't get historical
-        } else {
-            // Check if any historical ports exist
-            if len(completeOpenPorts) > 0 {
-                // Create combined list from all historical ports
-                finalOpenPorts = make([]models.Port, 0, len(completeOpenPorts))
-                for _, portNum := range completeOpenPorts {
-                    port := models.Port{
-                        Number:  portNum,
-                        State:   "open",
-                        Latency: 1 * time.Millisecond,
-                    }
-                    finalOpenPorts = append(finalOpenPorts, port)
-                }
-            } else {
-                // No historical ports, use current scan
-                finalOpenPorts = openPorts
-            }
-        }
-    } else {
-        // Use only the ports from the current scan
-        finalOpenPorts = openPorts
-    }
+    finalOpenPorts := finalSummaryPorts(ctx, s, ipAddress, protocol, openPorts, useHistoricalPorts)
     
     // Debug output to see what we're trying to store
     log.Printf("Final summary for %s with %d ports: %+v", ipAddress, len(finalOpenPorts), finalOpenPorts)
@@ -105,6 +196,7 @@ func (c *Client) StoreFinalScanSummary(ctx context.Context, ipAddress string, sc
     for _, port := range finalOpenPorts {
         simplifiedPorts = append(simplifiedPorts, map[string]interface{}{
             "number": port.Number,
+            "protocol": models.NormalizeProtocol(port.Protocol),
             "state": "open",
             "latency": 1000000, // 1ms in nanoseconds
         })
@@ -122,12 +214,19 @@ func (c *Client) StoreFinalScanSummary(ctx context.Context, ipAddress string, sc
     // Create DynamoDB item
     item := map[string]types.AttributeValue{
         "IPAddress":     &types.AttributeValueMemberS{Value: ipAddress},
-        "ScanTimestamp": &types.AttributeValueMemberS{Value: timestamp + "Z"},
         "ScanId":        &types.AttributeValueMemberS{Value: scanID},
         "ScanDuration":  &types.AttributeValueMemberN{Value: formatDuration(scanDuration)},
         "PortsScanned":  &types.AttributeValueMemberN{Value: formatInt(portsScanned)},
+        "Protocol":      &types.AttributeValueMemberS{Value: models.NormalizeProtocol(protocol)},
         "IsFinalSummary": &types.AttributeValueMemberBOOL{Value: true},
-        "ExpirationTime": &types.AttributeValueMemberN{Value: formatInt(int(time.Now().Add(30*24*time.Hour).Unix()))},
+        "ScanStatus":    &types.AttributeValueMemberS{Value: scanStatus},
+        "ExpirationTime": &types.AttributeValueMemberN{Value: formatInt(int(time.Now().Add(resultRetention).Unix()))},
+    }
+    if profile != "" {
+        item["Profile"] = &types.AttributeValueMemberS{Value: profile}
+    }
+    if portsProbed != "" {
+        item["PortsProbed"] = &types.AttributeValueMemberS{Value: portsProbed}
     }
     
     // Add open ports if there are any
@@ -137,9 +236,22 @@ func (c *Client) StoreFinalScanSummary(ctx context.Context, ipAddress string, sc
         for _, port := range finalOpenPorts {
             portMap := map[string]types.AttributeValue{
                 "number": &types.AttributeValueMemberN{Value: strconv.Itoa(port.Number)},
+                "protocol": &types.AttributeValueMemberS{Value: models.NormalizeProtocol(port.Protocol)},
                 "state":  &types.AttributeValueMemberS{Value: "open"},
                 "latency": &types.AttributeValueMemberN{Value: "1000000"},
             }
+            
+            // Keep whatever banner grabbing identified on the port
+            for name, value := range map[string]string{
+                "service": port.Service,
+                "product": port.Product,
+                "version": port.Version,
+                "banner":  port.Banner,
+            } {
+                if value != "" {
+                    portMap[name] = &types.AttributeValueMemberS{Value: value}
+                }
+            }
             portsList = append(portsList, &types.AttributeValueMemberM{Value: portMap})
         }
         item["OpenPorts"] = &types.AttributeValueMemberL{Value: portsList}
@@ -148,11 +260,14 @@ func (c *Client) StoreFinalScanSummary(ctx context.Context, ipAddress string, sc
         item["OpenPorts"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{}}
     }
     
-    _, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
-        TableName: aws.String("nexusscan-results"),
-        Item:      item,
-    })
+    // Record how the remaining ports responded
+    countsAV, err := attributevalue.Marshal(stateCounts)
+    if err != nil {
+        return err
+    }
+    item["StateCounts"] = countsAV
     
+    err = s.putResultItem(ctx, item, time.Now())
     if err != nil {
         log.Printf("Error storing final scan summary: %v", err)
     } else {
@@ -164,11 +279,30 @@ func (c *Client) StoreFinalScanSummary(ctx context.Context, ipAddress string, sc
 
 
 
-// DeleteIP removes an IP address from the database
+// DeleteIP removes an IP address from the database, along with its port
+// change events, its certificate sightings and the state of its ports
 func (c *Client) DeleteIP(ctx context.Context, ipAddress string) error {
+    if err := c.Store.DeleteIP(ctx, ipAddress); err != nil {
+        return err
+    }
+
+    if err := c.DeleteIPPortChanges(ctx, ipAddress); err != nil {
+        log.Printf("Error deleting port changes for IP %s: %v", ipAddress, err)
+    }
+    if err := c.DeleteIPCertificates(ctx, ipAddress); err != nil {
+        log.Printf("Error deleting certificates for IP %s: %v", ipAddress, err)
+    }
+    if err := c.DeleteIPServiceState(ctx, ipAddress); err != nil {
+        log.Printf("Error deleting service state for IP %s: %v", ipAddress, err)
+    }
+    return nil
+}
+
+// DeleteIP removes an IP address from the database
+func (s *DynamoDBStore) DeleteIP(ctx context.Context, ipAddress string) error {
     // Delete from IPs table
-    _, err := c.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-        TableName: aws.String("nexusscan-ips"),
+    _, err := s.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+        TableName: aws.String(s.Tables.IPs),
         Key: map[string]types.AttributeValue{
             "IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
         },
@@ -178,13 +312,13 @@ func (c *Client) DeleteIP(ctx context.Context, ipAddress string) error {
     }
     
     // Delete all schedules for this IP
-    if err := c.DeleteIPSchedules(ctx, ipAddress); err != nil {
+    if err := s.DeleteIPSchedules(ctx, ipAddress); err != nil {
         log.Printf("Error deleting schedules for IP %s: %v", ipAddress, err)
     }
     
     // Delete from OpenPorts table
-    _, err = c.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-        TableName: aws.String("nexusscan-open-ports"),
+    _, err = s.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+        TableName: aws.String(s.Tables.OpenPorts),
         Key: map[string]types.AttributeValue{
             "IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
         },
@@ -194,14 +328,14 @@ func (c *Client) DeleteIP(ctx context.Context, ipAddress string) error {
     }
     
     // Delete enrichment data for this IP
-    if err := c.DeleteIPEnrichments(ctx, ipAddress); err != nil {
+    if err := s.DeleteIPEnrichments(ctx, ipAddress); err != nil {
         log.Printf("Error deleting enrichment data for IP %s: %v", ipAddress, err)
     }
     
     // Delete all scan results for this IP
     // This requires a query + batch delete because scan results are stored with a composite key
     scanResultsQuery := &dynamodb.QueryInput{
-        TableName:              aws.String("nexusscan-results"),
+        TableName:              aws.String(s.Tables.Results),
         KeyConditionExpression: aws.String("IPAddress = :ip"),
         ExpressionAttributeValues: map[string]types.AttributeValue{
             ":ip": &types.AttributeValueMemberS{Value: ipAddress},
@@ -210,7 +344,7 @@ func (c *Client) DeleteIP(ctx context.Context, ipAddress string) error {
     }
     
     // Paginate through all results
-    paginator := dynamodb.NewQueryPaginator(c.DynamoDB, scanResultsQuery)
+    paginator := dynamodb.NewQueryPaginator(s.DynamoDB, scanResultsQuery)
     
     for paginator.HasMorePages() {
         page, err := paginator.NextPage(ctx)
@@ -246,9 +380,9 @@ func (c *Client) DeleteIP(ctx context.Context, ipAddress string) error {
             }
             
             // Execute batch delete
-            _, err := c.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+            _, err := s.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
                 RequestItems: map[string][]types.WriteRequest{
-                    "nexusscan-results": deleteRequests,
+                    s.Tables.Results: deleteRequests,
                 },
             })
             
@@ -261,36 +395,112 @@ func (c *Client) DeleteIP(ctx context.Context, ipAddress string) error {
     return nil
 }
 
-// GetIPs retrieves all IP addresses with pagination
-func (c *Client) GetIPs(ctx context.Context, limit int, offset int) ([]models.IP, error) {
-	scanInput := &dynamodb.ScanInput{
-		TableName: aws.String("nexusscan-ips"),
-		Limit:     aws.Int32(int32(limit)),
+// ListIPs returns a page of the inventory from CreatedAtIndex or
+// LastScannedIndex. Age filters are key conditions on LastScannedIndex and
+// filters on CreatedAtIndex; the selector is always a filter.
+func (s *DynamoDBStore) ListIPs(ctx context.Context, query IPQuery) (IPPage, error) {
+	if err := query.Validate(); err != nil {
+		return IPPage{}, err
 	}
-	
-	// If offset is provided, we need to scan and skip results
-	if offset > 0 {
-		// This is a simplified approach - in a production system you'd use LastEvaluatedKey for pagination
-		scanInput.Limit = aws.Int32(int32(limit + offset))
+
+	input := &dynamodb.QueryInput{
+		TableName:        aws.String(s.Tables.IPs),
+		IndexName:        aws.String(CreatedAtIndex),
+		ScanIndexForward: aws.Bool(!query.Descending),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":inventory": &types.AttributeValueMemberS{Value: inventoryPartition},
+		},
 	}
-	
-	result, err := c.DynamoDB.Scan(ctx, scanInput)
+
+	var ageCondition string
+	before, since := !query.ScannedBefore.IsZero(), !query.ScannedSince.IsZero()
+	switch {
+	case before && since:
+		// BETWEEN is inclusive and LastScanned is kept to the second
+		ageCondition = "LastScanned BETWEEN :since AND :before"
+		input.ExpressionAttributeValues[":since"] = &types.AttributeValueMemberS{Value: query.ScannedSince.UTC().Format(time.RFC3339)}
+		input.ExpressionAttributeValues[":before"] = &types.AttributeValueMemberS{Value: query.ScannedBefore.Add(-time.Second).UTC().Format(time.RFC3339)}
+	case before:
+		ageCondition = "LastScanned < :before"
+		input.ExpressionAttributeValues[":before"] = &types.AttributeValueMemberS{Value: query.ScannedBefore.UTC().Format(time.RFC3339)}
+	case since:
+		ageCondition = "LastScanned >= :since"
+		input.ExpressionAttributeValues[":since"] = &types.AttributeValueMemberS{Value: query.ScannedSince.UTC().Format(time.RFC3339)}
+	}
+
+	filters := selectorConditions(query.Selector, input)
+	input.KeyConditionExpression = aws.String("Inventory = :inventory")
+	if query.sortBy() == SortByLastScanned {
+		input.IndexName = aws.String(LastScannedIndex)
+		if ageCondition != "" {
+			input.KeyConditionExpression = aws.String("Inventory = :inventory AND " + ageCondition)
+		}
+	} else if ageCondition != "" {
+		filters = append([]string{ageCondition}, filters...)
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+
+	items, next, total, err := s.queryPage(ctx, input, query.listing(), pageSize(query.Limit), query.Cursor)
 	if err != nil {
-		return nil, err
+		return IPPage{}, err
+	}
+
+	page := IPPage{IPs: []models.IP{}, NextCursor: next, Total: total}
+	if err := attributevalue.UnmarshalListOfMaps(items, &page.IPs); err != nil {
+		return IPPage{}, err
+	}
+	return page, nil
+}
+
+// GetIPsByNetwork retrieves every IP that was added from the given network
+func (s *DynamoDBStore) GetIPsByNetwork(ctx context.Context, network string) ([]models.IP, error) {
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(s.Tables.IPs),
+		IndexName:              aws.String("NetworkIndex"),
+		KeyConditionExpression: aws.String("Network = :network"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":network": &types.AttributeValueMemberS{Value: network},
+		},
 	}
 	
 	var ips []models.IP
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &ips)
+	paginator := dynamodb.NewQueryPaginator(s.DynamoDB, queryInput)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		
+		var pageIPs []models.IP
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageIPs); err != nil {
+			return nil, err
+		}
+		ips = append(ips, pageIPs...)
+	}
+	
+	return ips, nil
+}
+
+// DeleteNetwork removes every IP that was added from the given network,
+// along with its schedules, results and enrichment data
+func (c *Client) DeleteNetwork(ctx context.Context, network string) ([]string, error) {
+	ips, err := c.GetIPsByNetwork(ctx, network)
 	if err != nil {
 		return nil, err
 	}
-	
-	// Apply offset if necessary
-	if offset > 0 && len(ips) > offset {
-		ips = ips[offset:min(len(ips), offset+limit)]
+
+	var deleted []string
+	for _, ip := range ips {
+		if err := c.DeleteIP(ctx, ip.IPAddress); err != nil {
+			log.Printf("Error deleting IP %s from network %s: %v", ip.IPAddress, network, err)
+			continue
+		}
+		deleted = append(deleted, ip.IPAddress)
 	}
 	
-	return ips, nil
+	return deleted, nil
 }
 
 // Helper function for min
@@ -302,56 +512,130 @@ func min(a, b int) int {
 }
 
 // AddSchedule adds or updates a scan schedule for an IP
-func (c *Client) AddSchedule(ctx context.Context, ipAddress string, scheduleType string, portSet string, enabled bool) (string, error) {
+func (s *DynamoDBStore) AddSchedule(ctx context.Context, ipAddress string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
+    return s.addSchedule(ctx, map[string]types.AttributeValue{
+        "IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
+    }, scheduleType, timing, portSet, profile, enabled)
+}
+
+// AddSelectorSchedule adds a scan schedule for the IPs a selector matches.
+// The item has no IPAddress, so it stays out of IPAddressIndex.
+func (s *DynamoDBStore) AddSelectorSchedule(ctx context.Context, selector models.AssetSelector, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
+	av, err := attributevalue.Marshal(selector)
+	if err != nil {
+		return "", err
+	}
+	return s.addSchedule(ctx, map[string]types.AttributeValue{"Selector": av}, scheduleType, timing, portSet, profile, enabled)
+}
+
+// addSchedule stores a schedule whose target attributes are already built
+func (s *DynamoDBStore) addSchedule(ctx context.Context, target map[string]types.AttributeValue, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
     now := time.Now()
     timestamp := now.Format(time.RFC3339)
-    nextRun := now.Add(getScheduleInterval(scheduleType))
+    nextRun, err := timing.ForScheduleType(scheduleType).Next(now)
+    if err != nil {
+        return "", err
+    }
     
     // Generate a unique ID for the schedule
     scheduleID := uuid.New().String()
     
     item := map[string]types.AttributeValue{
         "ScheduleID":   &types.AttributeValueMemberS{Value: scheduleID},
-        "IPAddress":    &types.AttributeValueMemberS{Value: ipAddress},
         "ScheduleType": &types.AttributeValueMemberS{Value: scheduleType},
         "PortSet":      &types.AttributeValueMemberS{Value: portSet},
+        "Profile":      &types.AttributeValueMemberS{Value: profile},
         "Enabled":      &types.AttributeValueMemberBOOL{Value: enabled},
         "CreatedAt":    &types.AttributeValueMemberS{Value: timestamp},
         "UpdatedAt":    &types.AttributeValueMemberS{Value: timestamp},
         "LastRun":      &types.AttributeValueMemberS{Value: ""},
         "NextRun":      &types.AttributeValueMemberS{Value: nextRun.Format(time.RFC3339)},
     }
+    for name, value := range target {
+        item[name] = value
+    }
+    for name, value := range scheduleTimingAttributes(timing) {
+        item[name] = value
+    }
     
-    _, err := c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
-        TableName: aws.String("nexusscan-schedules"),
+    _, err = s.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+        TableName: aws.String(s.Tables.Schedules),
         Item:      item,
     })
     
     return scheduleID, err
 }
 
-// Helper function to determine schedule interval
-func getScheduleInterval(scheduleType string) time.Duration {
-	switch scheduleType {
-	case "hourly":
-		return 1 * time.Hour
-	case "12hour":
-		return 12 * time.Hour
-	case "daily":
-		return 24 * time.Hour
-	case "weekly":
-		return 7 * 24 * time.Hour
-	case "monthly":
-		return 30 * 24 * time.Hour
-	default:
-		return 24 * time.Hour // Default to daily
+// scheduleTimingAttributes returns the timing attributes of a schedule item.
+// Every attribute is present, empty when unset, so updates clear old values.
+func scheduleTimingAttributes(timing models.ScheduleTiming) map[string]types.AttributeValue {
+	windows := make([]types.AttributeValue, 0, len(timing.Windows))
+	for _, window := range timing.Windows {
+		if av, err := attributevalue.Marshal(window); err == nil {
+			windows = append(windows, av)
+		}
+	}
+
+	blackoutDates := make([]types.AttributeValue, 0, len(timing.BlackoutDates))
+	for _, date := range timing.BlackoutDates {
+		blackoutDates = append(blackoutDates, &types.AttributeValueMemberS{Value: date})
+	}
+
+	return map[string]types.AttributeValue{
+		"CronExpression": &types.AttributeValueMemberS{Value: timing.CronExpression},
+		"Timezone":       &types.AttributeValueMemberS{Value: timing.Timezone},
+		"Windows":        &types.AttributeValueMemberL{Value: windows},
+		"BlackoutDates":  &types.AttributeValueMemberL{Value: blackoutDates},
+	}
+}
+
+// getSelector reads the selector of a schedule item, nil for schedules of a
+// single IP
+func getSelector(item map[string]types.AttributeValue) *models.AssetSelector {
+	av, ok := item["Selector"]
+	if !ok {
+		return nil
+	}
+	var selector models.AssetSelector
+	if err := attributevalue.Unmarshal(av, &selector); err != nil {
+		log.Printf("Error reading selector of schedule %s: %v", getString(item, "ScheduleID"), err)
+		return nil
+	}
+	return &selector
+}
+
+// getSchedule reads a schedule item, leaving empty time fields zero
+func getSchedule(item map[string]types.AttributeValue) models.Schedule {
+	return models.Schedule{
+		ScheduleID:     getString(item, "ScheduleID"),
+		IPAddress:      getString(item, "IPAddress"),
+		Selector:       getSelector(item),
+		ScheduleType:   getString(item, "ScheduleType"),
+		ScheduleTiming: getScheduleTiming(item),
+		PortSet:        getString(item, "PortSet"),
+		Profile:        getString(item, "Profile"),
+		Enabled:        getBool(item, "Enabled"),
+		CreatedAt:      getTime(item, "CreatedAt"),
+		UpdatedAt:      getTime(item, "UpdatedAt"),
+		LastRun:        getTime(item, "LastRun"),
+		NextRun:        getTime(item, "NextRun"),
+	}
+}
+
+// getScheduleTiming reads the timing of a schedule item. Schedules stored
+// before cron expressions existed run at the interval of their type.
+func getScheduleTiming(item map[string]types.AttributeValue) models.ScheduleTiming {
+	var timing models.ScheduleTiming
+	if err := attributevalue.UnmarshalMap(item, &timing); err != nil {
+		log.Printf("Error reading timing of schedule %s: %v", getString(item, "ScheduleID"), err)
 	}
+	return timing.ForScheduleType(getString(item, "ScheduleType"))
 }
 
 // DeleteSchedule removes a scan schedule for an IP
-func (c *Client) DeleteSchedule(ctx context.Context, scheduleID string) error {
-    _, err := c.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-        TableName: aws.String("nexusscan-schedules"),
+func (s *DynamoDBStore) DeleteSchedule(ctx context.Context, scheduleID string) error {
+    _, err := s.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+        TableName: aws.String(s.Tables.Schedules),
         Key: map[string]types.AttributeValue{
             "ScheduleID": &types.AttributeValueMemberS{Value: scheduleID},
         },
@@ -361,10 +645,10 @@ func (c *Client) DeleteSchedule(ctx context.Context, scheduleID string) error {
 }
 
 // DeleteIPSchedules deletes all schedules for an IP (used when deleting an IP)
-func (c *Client) DeleteIPSchedules(ctx context.Context, ipAddress string) error {
+func (s *DynamoDBStore) DeleteIPSchedules(ctx context.Context, ipAddress string) error {
     // Query to get all schedules for this IP
     queryInput := &dynamodb.QueryInput{
-        TableName:              aws.String("nexusscan-schedules"),
+        TableName:              aws.String(s.Tables.Schedules),
         IndexName:              aws.String("IPAddressIndex"),
         KeyConditionExpression: aws.String("IPAddress = :ip"),
         ExpressionAttributeValues: map[string]types.AttributeValue{
@@ -372,7 +656,7 @@ func (c *Client) DeleteIPSchedules(ctx context.Context, ipAddress string) error
         },
     }
     
-    result, err := c.DynamoDB.Query(ctx, queryInput)
+    result, err := s.DynamoDB.Query(ctx, queryInput)
     if err != nil {
         return err
     }
@@ -380,8 +664,8 @@ func (c *Client) DeleteIPSchedules(ctx context.Context, ipAddress string) error
     for _, item := range result.Items {
         scheduleID := item["ScheduleID"].(*types.AttributeValueMemberS).Value
         
-        _, err := c.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-            TableName: aws.String("nexusscan-schedules"),
+        _, err := s.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+            TableName: aws.String(s.Tables.Schedules),
             Key: map[string]types.AttributeValue{
                 "ScheduleID": &types.AttributeValueMemberS{Value: scheduleID},
             },
@@ -396,27 +680,38 @@ func (c *Client) DeleteIPSchedules(ctx context.Context, ipAddress string) error
 
 
 // UpdateScheduleStatus enables or disables a scan schedule
-func (c *Client) UpdateScheduleStatus(ctx context.Context, scheduleID string, enabled bool) error {
+func (s *DynamoDBStore) UpdateScheduleStatus(ctx context.Context, scheduleID string, enabled bool) error {
     updateInput := &dynamodb.UpdateItemInput{
-        TableName: aws.String("nexusscan-schedules"),
+        TableName: aws.String(s.Tables.Schedules),
         Key: map[string]types.AttributeValue{
             "ScheduleID": &types.AttributeValueMemberS{Value: scheduleID},
         },
-        UpdateExpression: aws.String("SET Enabled = :enabled, UpdatedAt = :updatedAt"),
+        UpdateExpression:    aws.String("SET Enabled = :enabled, UpdatedAt = :updatedAt"),
+        ConditionExpression: aws.String("attribute_exists(ScheduleID)"),
         ExpressionAttributeValues: map[string]types.AttributeValue{
             ":enabled":   &types.AttributeValueMemberBOOL{Value: enabled},
             ":updatedAt": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
         },
     }
     
-    _, err := c.DynamoDB.UpdateItem(ctx, updateInput)
+    _, err := s.DynamoDB.UpdateItem(ctx, updateInput)
+    return scheduleUpdateError(err)
+}
+
+// scheduleUpdateError turns an update whose schedule does not exist into
+// ErrScheduleNotFound, rather than letting the update create it
+func scheduleUpdateError(err error) error {
+    var conditionFailed *types.ConditionalCheckFailedException
+    if errors.As(err, &conditionFailed) {
+        return ErrScheduleNotFound
+    }
     return err
 }
 
 // GetSchedulesForIP retrieves all scan schedules for an IP
-func (c *Client) GetSchedulesForIP(ctx context.Context, ipAddress string) ([]models.Schedule, error) {
+func (s *DynamoDBStore) GetSchedulesForIP(ctx context.Context, ipAddress string) ([]models.Schedule, error) {
     queryInput := &dynamodb.QueryInput{
-        TableName:              aws.String("nexusscan-schedules"),
+        TableName:              aws.String(s.Tables.Schedules),
         IndexName:              aws.String("IPAddressIndex"),
         KeyConditionExpression: aws.String("IPAddress = :ip"),
         ExpressionAttributeValues: map[string]types.AttributeValue{
@@ -424,7 +719,7 @@ func (c *Client) GetSchedulesForIP(ctx context.Context, ipAddress string) ([]mod
         },
     }
     
-    result, err := c.DynamoDB.Query(ctx, queryInput)
+    result, err := s.DynamoDB.Query(ctx, queryInput)
     if err != nil {
         return nil, err
     }
@@ -432,59 +727,100 @@ func (c *Client) GetSchedulesForIP(ctx context.Context, ipAddress string) ([]mod
     // Custom unmarshaling to handle empty time fields
     var schedules []models.Schedule
     for _, item := range result.Items {
-        schedule := models.Schedule{
-            ScheduleID:   getString(item, "ScheduleID"),
-            IPAddress:    getString(item, "IPAddress"),
-            ScheduleType: getString(item, "ScheduleType"),
-            PortSet:      getString(item, "PortSet"),
-            Enabled:      getBool(item, "Enabled"),
-        }
-        
-        // Handle time fields with default values if they're empty
-        schedule.CreatedAt = getTime(item, "CreatedAt")
-        schedule.UpdatedAt = getTime(item, "UpdatedAt")
-        schedule.LastRun = getTime(item, "LastRun")
-        schedule.NextRun = getTime(item, "NextRun")
-        
-        schedules = append(schedules, schedule)
+        schedules = append(schedules, getSchedule(item))
     }
     
     return schedules, nil
 }
 
+// GetSelectorSchedules retrieves the schedules of selectors, oldest first
+func (s *DynamoDBStore) GetSelectorSchedules(ctx context.Context) ([]models.Schedule, error) {
+	paginator := dynamodb.NewScanPaginator(s.DynamoDB, &dynamodb.ScanInput{
+		TableName:        aws.String(s.Tables.Schedules),
+		FilterExpression: aws.String("attribute_exists(Selector)"),
+	})
+
+	var schedules []models.Schedule
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			schedules = append(schedules, getSchedule(item))
+		}
+	}
+	sortSchedules(schedules)
+	return schedules, nil
+}
+
 // GetScheduleByID retrieves a schedule by its ID
-func (c *Client) GetScheduleByID(ctx context.Context, scheduleID string) (*models.Schedule, error) {
+func (s *DynamoDBStore) GetScheduleByID(ctx context.Context, scheduleID string) (*models.Schedule, error) {
     input := &dynamodb.GetItemInput{
-        TableName: aws.String("nexusscan-schedules"),
+        TableName: aws.String(s.Tables.Schedules),
         Key: map[string]types.AttributeValue{
             "ScheduleID": &types.AttributeValueMemberS{Value: scheduleID},
         },
     }
     
-    result, err := c.DynamoDB.GetItem(ctx, input)
+    result, err := s.DynamoDB.GetItem(ctx, input)
     if err != nil {
         return nil, err
     }
     
     if result.Item == nil {
-        return nil, fmt.Errorf("schedule not found")
-    }
-    
-    schedule := &models.Schedule{
-        ScheduleID:   getString(result.Item, "ScheduleID"),
-        IPAddress:    getString(result.Item, "IPAddress"),
-        ScheduleType: getString(result.Item, "ScheduleType"),
-        PortSet:      getString(result.Item, "PortSet"),
-        Enabled:      getBool(result.Item, "Enabled"),
+        return nil, ErrScheduleNotFound
     }
     
-    // Handle time fields
-    schedule.CreatedAt = getTime(result.Item, "CreatedAt")
-    schedule.UpdatedAt = getTime(result.Item, "UpdatedAt")
-    schedule.LastRun = getTime(result.Item, "LastRun")
-    schedule.NextRun = getTime(result.Item, "NextRun")
-    
-    return schedule, nil
+    schedule := getSchedule(result.Item)
+    return &schedule, nil
+}
+
+// SchedulesUsePortSet reports whether any schedule scans with the named port set
+func (s *DynamoDBStore) SchedulesUsePortSet(ctx context.Context, name string) (bool, error) {
+	paginator := dynamodb.NewScanPaginator(s.DynamoDB, &dynamodb.ScanInput{
+		TableName:        aws.String(s.Tables.Schedules),
+		FilterExpression: aws.String("PortSet = :portSet"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":portSet": &types.AttributeValueMemberS{Value: name},
+		},
+		ProjectionExpression: aws.String("ScheduleID"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return false, err
+		}
+		if len(page.Items) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SchedulesUseProfile reports whether any schedule scans with the named profile
+func (s *DynamoDBStore) SchedulesUseProfile(ctx context.Context, name string) (bool, error) {
+	paginator := dynamodb.NewScanPaginator(s.DynamoDB, &dynamodb.ScanInput{
+		TableName:        aws.String(s.Tables.Schedules),
+		FilterExpression: aws.String("#profile = :profile"),
+		ExpressionAttributeNames: map[string]string{
+			"#profile": "Profile",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":profile": &types.AttributeValueMemberS{Value: name},
+		},
+		ProjectionExpression: aws.String("ScheduleID"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return false, err
+		}
+		if len(page.Items) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // Helper functions for safer item extraction
@@ -513,103 +849,85 @@ func getTime(item map[string]types.AttributeValue, key string) time.Time {
 }
 
 
-// GetPendingScans retrieves IPs that need to be scanned for a specific schedule type
-func (c *Client) GetPendingScans(ctx context.Context, scheduleType string, maxIPs int) ([]models.ScheduleScan, error) {
-    now := time.Now().Format(time.RFC3339)
-    
-    queryInput := &dynamodb.QueryInput{
-        TableName:              aws.String("nexusscan-schedules"),
-        IndexName:              aws.String("ScheduleTypeIndex"),
-        KeyConditionExpression: aws.String("ScheduleType = :scheduleType"),
-        FilterExpression:       aws.String("Enabled = :enabled AND NextRun <= :now"),
-        ExpressionAttributeValues: map[string]types.AttributeValue{
-            ":scheduleType": &types.AttributeValueMemberS{Value: scheduleType},
-            ":enabled":      &types.AttributeValueMemberBOOL{Value: true},
-            ":now":          &types.AttributeValueMemberS{Value: now},
-        },
-        Limit: aws.Int32(int32(maxIPs)),
-    }
-    
-    result, err := c.DynamoDB.Query(ctx, queryInput)
+// deferSchedule moves the NextRun of a schedule that is due at a time its
+// windows or blackout dates do not allow
+func (s *DynamoDBStore) deferSchedule(ctx context.Context, scheduleID string, timing models.ScheduleTiming, now time.Time) error {
+    nextRun, err := timing.Next(now)
     if err != nil {
-        return nil, err
-    }
-    
-    var scheduledScans []models.ScheduleScan
-    for _, item := range result.Items {
-        scan := models.ScheduleScan{
-            ScheduleID:   getString(item, "ScheduleID"),
-            IPAddress:    getString(item, "IPAddress"),
-            ScheduleType: getString(item, "ScheduleType"),
-            PortSet:      getString(item, "PortSet"),
-        }
-        
-        // Parse NextRun time
-        nextRunStr := getString(item, "NextRun")
-        if nextRunStr != "" {
-            nextRun, err := time.Parse(time.RFC3339, nextRunStr)
-            if err == nil {
-                scan.NextRun = nextRun
-            }
-        }
-        
-        scheduledScans = append(scheduledScans, scan)
+        return err
     }
     
-    return scheduledScans, nil
-}
-
-// UpdateScheduleAfterScan updates the LastRun and NextRun timestamps after a scan
-func (c *Client) UpdateScheduleAfterScan(ctx context.Context, scheduleID string, scheduleType string) error {
-    now := time.Now()
-    nextRun := now.Add(getScheduleInterval(scheduleType))
-    
-    updateInput := &dynamodb.UpdateItemInput{
-        TableName: aws.String("nexusscan-schedules"),
+    _, err = s.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+        TableName: aws.String(s.Tables.Schedules),
         Key: map[string]types.AttributeValue{
             "ScheduleID": &types.AttributeValueMemberS{Value: scheduleID},
         },
-        UpdateExpression: aws.String("SET LastRun = :lastRun, NextRun = :nextRun, UpdatedAt = :updatedAt"),
+        UpdateExpression: aws.String("SET NextRun = :nextRun"),
         ExpressionAttributeValues: map[string]types.AttributeValue{
-            ":lastRun":   &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
-            ":nextRun":   &types.AttributeValueMemberS{Value: nextRun.Format(time.RFC3339)},
-            ":updatedAt": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+            ":nextRun": &types.AttributeValueMemberS{Value: nextRun.Format(time.RFC3339)},
         },
-    }
-    
-    _, err := c.DynamoDB.UpdateItem(ctx, updateInput)
+    })
     return err
 }
-func (c *Client) UpdateSchedule(ctx context.Context, scheduleID string, scheduleType string, portSet string, enabled bool) error {
+
+// UpdateSchedule replaces the type, timing, port set, profile and status of a schedule
+func (s *DynamoDBStore) UpdateSchedule(ctx context.Context, scheduleID string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) error {
+    nextRun, err := timing.ForScheduleType(scheduleType).Next(time.Now())
+    if err != nil {
+        return err
+    }
+    
+    values := map[string]types.AttributeValue{
+        ":scheduleType": &types.AttributeValueMemberS{Value: scheduleType},
+        ":portSet":      &types.AttributeValueMemberS{Value: portSet},
+        ":profile":      &types.AttributeValueMemberS{Value: profile},
+        ":enabled":      &types.AttributeValueMemberBOOL{Value: enabled},
+        ":updatedAt":    &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
+        ":nextRun":      &types.AttributeValueMemberS{Value: nextRun.Format(time.RFC3339)},
+    }
+    timingAttributes := scheduleTimingAttributes(timing)
+    values[":cronExpression"] = timingAttributes["CronExpression"]
+    values[":timezone"] = timingAttributes["Timezone"]
+    values[":windows"] = timingAttributes["Windows"]
+    values[":blackoutDates"] = timingAttributes["BlackoutDates"]
+    
     updateInput := &dynamodb.UpdateItemInput{
-        TableName: aws.String("nexusscan-schedules"),
+        TableName: aws.String(s.Tables.Schedules),
         Key: map[string]types.AttributeValue{
             "ScheduleID": &types.AttributeValueMemberS{Value: scheduleID},
         },
-        UpdateExpression: aws.String("SET ScheduleType = :scheduleType, PortSet = :portSet, Enabled = :enabled, UpdatedAt = :updatedAt, NextRun = :nextRun"),
-        ExpressionAttributeValues: map[string]types.AttributeValue{
-            ":scheduleType": &types.AttributeValueMemberS{Value: scheduleType},
-            ":portSet":      &types.AttributeValueMemberS{Value: portSet},
-            ":enabled":      &types.AttributeValueMemberBOOL{Value: enabled},
-            ":updatedAt":    &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
-            ":nextRun":      &types.AttributeValueMemberS{Value: time.Now().Add(getScheduleInterval(scheduleType)).Format(time.RFC3339)},
+        UpdateExpression: aws.String("SET ScheduleType = :scheduleType, PortSet = :portSet, #profile = :profile, Enabled = :enabled, UpdatedAt = :updatedAt, NextRun = :nextRun, " +
+            "#cronExpression = :cronExpression, #timezone = :timezone, #windows = :windows, #blackoutDates = :blackoutDates"),
+        ConditionExpression: aws.String("attribute_exists(ScheduleID)"),
+        ExpressionAttributeNames: map[string]string{
+            "#cronExpression": "CronExpression",
+            "#timezone":       "Timezone",
+            "#windows":        "Windows",
+            "#blackoutDates":  "BlackoutDates",
+            "#profile":        "Profile",
         },
+        ExpressionAttributeValues: values,
     }
     
-    _, err := c.DynamoDB.UpdateItem(ctx, updateInput)
-    return err
+    _, err = s.DynamoDB.UpdateItem(ctx, updateInput)
+    return scheduleUpdateError(err)
 }
 
-// GetOpenPorts retrieves previously discovered open ports for an IP
-func (c *Client) GetOpenPorts(ctx context.Context, ipAddress string) ([]int, error) {
+// GetOpenPorts retrieves previously discovered open TCP ports for an IP
+func (s *DynamoDBStore) GetOpenPorts(ctx context.Context, ipAddress string) ([]int, error) {
+	return s.GetOpenPortsByProtocol(ctx, ipAddress, models.ProtocolTCP)
+}
+
+// GetOpenPortsByProtocol retrieves previously discovered open ports for an IP and protocol
+func (s *DynamoDBStore) GetOpenPortsByProtocol(ctx context.Context, ipAddress string, protocol string) ([]int, error) {
 	input := &dynamodb.GetItemInput{
-		TableName: aws.String("nexusscan-open-ports"),
+		TableName: aws.String(s.Tables.OpenPorts),
 		Key: map[string]types.AttributeValue{
 			"IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
 		},
 	}
 	
-	result, err := c.DynamoDB.GetItem(ctx, input)
+	result, err := s.DynamoDB.GetItem(ctx, input)
 	if err != nil {
 		return nil, err
 	}
@@ -620,8 +938,9 @@ func (c *Client) GetOpenPorts(ctx context.Context, ipAddress string) ([]int, err
 	
 	// Extract open ports
 	var portMap struct {
-		IPAddress string `dynamodbav:"IPAddress"`
-		OpenPorts []int  `dynamodbav:"OpenPorts"`
+		IPAddress    string `dynamodbav:"IPAddress"`
+		OpenPorts    []int  `dynamodbav:"OpenPorts"`
+		OpenUDPPorts []int  `dynamodbav:"OpenUDPPorts"`
 	}
 	
 	err = attributevalue.UnmarshalMap(result.Item, &portMap)
@@ -629,87 +948,78 @@ func (c *Client) GetOpenPorts(ctx context.Context, ipAddress string) ([]int, err
 		return nil, err
 	}
 	
+	if models.NormalizeProtocol(protocol) == models.ProtocolUDP {
+		if portMap.OpenUDPPorts == nil {
+			return []int{}, nil
+		}
+		return portMap.OpenUDPPorts, nil
+	}
+	
 	return portMap.OpenPorts, nil
 }
 
-// StoreOpenPorts saves open ports for an IP
-func (c *Client) StoreOpenPorts(ctx context.Context, ipAddress string, openPorts []int, replaceExisting bool) error {
-    // Check if we should replace existing data
-    if replaceExisting {
-        // Just store the current open ports, replacing any previous data
-        item := map[string]types.AttributeValue{
-            "IPAddress":   &types.AttributeValueMemberS{Value: ipAddress},
-            "LastUpdated": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
-        }
-        
-        // Marshal port list
-        portsAV, err := attributevalue.Marshal(openPorts)
-        if err != nil {
-            return err
-        }
-        item["OpenPorts"] = portsAV
-        
-        _, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
-            TableName: aws.String("nexusscan-open-ports"),
-            Item:      item,
-        })
-        
-        return err
-    } else {
-        // Original behavior - merge with existing ports
-        // First, get the existing open ports
-        existingPorts, err := c.GetOpenPorts(ctx, ipAddress)
+// openPortsAttribute returns the open ports tracker attribute for a protocol
+func openPortsAttribute(protocol string) string {
+	if models.NormalizeProtocol(protocol) == models.ProtocolUDP {
+		return "OpenUDPPorts"
+	}
+	return "OpenPorts"
+}
+
+// StoreOpenPorts saves open TCP ports for an IP
+func (s *DynamoDBStore) StoreOpenPorts(ctx context.Context, ipAddress string, openPorts []int, replaceExisting bool) error {
+	return s.StoreOpenPortsByProtocol(ctx, ipAddress, models.ProtocolTCP, openPorts, replaceExisting)
+}
+
+// StoreOpenPortsByProtocol saves open ports for an IP and protocol. Each protocol
+// is kept in its own attribute so a UDP scan never overwrites TCP findings.
+func (s *DynamoDBStore) StoreOpenPortsByProtocol(ctx context.Context, ipAddress string, protocol string, openPorts []int, replaceExisting bool) error {
+    portsToStore := openPorts
+    
+    if !replaceExisting {
+        // Merge with existing ports
+        existingPorts, err := s.GetOpenPortsByProtocol(ctx, ipAddress, protocol)
         if err != nil {
             log.Printf("Error getting existing open ports for IP %s: %v", ipAddress, err)
             // Continue with empty list if error
             existingPorts = []int{}
         }
         
-        // Merge existing ports with new ones (avoiding duplicates)
-        portsMap := make(map[int]bool)
-        for _, port := range existingPorts {
-            portsMap[port] = true
-        }
-        for _, port := range openPorts {
-            portsMap[port] = true
-        }
-        
-        // Convert back to slice
-        mergedPorts := make([]int, 0, len(portsMap))
-        for port := range portsMap {
-            mergedPorts = append(mergedPorts, port)
-        }
-
-        // Update with merged ports
-        item := map[string]types.AttributeValue{
-            "IPAddress":   &types.AttributeValueMemberS{Value: ipAddress},
-            "LastUpdated": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
-        }
-        
-        // Marshal port list
-        portsAV, err := attributevalue.Marshal(mergedPorts)
-        if err != nil {
-            return err
-        }
-        item["OpenPorts"] = portsAV
-        
-        _, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
-            TableName: aws.String("nexusscan-open-ports"),
-            Item:      item,
-        })
-        
+        portsToStore = mergeOpenPorts(existingPorts, openPorts)
+    }
+    
+    if portsToStore == nil {
+        portsToStore = []int{}
+    }
+    
+    // Marshal port list
+    portsAV, err := attributevalue.Marshal(portsToStore)
+    if err != nil {
         return err
     }
+    
+    // Update only this protocol's attribute, leaving the other protocol intact
+    _, err = s.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+        TableName: aws.String(s.Tables.OpenPorts),
+        Key: map[string]types.AttributeValue{
+            "IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
+        },
+        UpdateExpression: aws.String("SET #ports = :ports, LastUpdated = :lastUpdated"),
+        ExpressionAttributeNames: map[string]string{
+            "#ports": openPortsAttribute(protocol),
+        },
+        ExpressionAttributeValues: map[string]types.AttributeValue{
+            ":ports":       portsAV,
+            ":lastUpdated": &types.AttributeValueMemberS{Value: time.Now().Format(time.RFC3339)},
+        },
+    })
+    
+    return err
 }
 
 // StoreScanResult saves a scan result
-func (c *Client) StoreScanResult(ctx context.Context, ipAddress string, scanID string, openPorts []models.Port, scanDuration time.Duration, portsScanned int) error {
-    timestamp := time.Now().Format(time.RFC3339)
-    
-    // Clean port data - remove service names if you don't want them
-    for i := range openPorts {
-        openPorts[i].Service = "" // Remove service names
-    }
+func (s *DynamoDBStore) StoreScanResult(ctx context.Context, ipAddress string, scanID string, protocol string, profile string, openPorts []models.Port, scanDuration time.Duration, portsScanned int, stateCounts models.PortStateCounts, watchedPorts []models.Port) error {
+    timestamp := time.Now().UTC().Format(time.RFC3339)
     
     // Marshal the open ports
     portsAV, err := attributevalue.Marshal(openPorts)
@@ -717,153 +1027,153 @@ func (c *Client) StoreScanResult(ctx context.Context, ipAddress string, scanID s
         return err
     }
     
+    // Marshal the per-state counts
+    countsAV, err := attributevalue.Marshal(stateCounts)
+    if err != nil {
+        return err
+    }
+    
     item := map[string]types.AttributeValue{
         "IPAddress":     &types.AttributeValueMemberS{Value: ipAddress},
-        "ScanTimestamp": &types.AttributeValueMemberS{Value: timestamp},
         "ScanId":        &types.AttributeValueMemberS{Value: scanID},
         "OpenPorts":     portsAV,
         "ScanDuration":  &types.AttributeValueMemberN{Value: formatDuration(scanDuration)},
         "PortsScanned":  &types.AttributeValueMemberN{Value: formatInt(portsScanned)},
+        "Protocol":      &types.AttributeValueMemberS{Value: models.NormalizeProtocol(protocol)},
+        "StateCounts":   countsAV,
         // Set TTL for automatic cleanup (30 days for most results)
-        "ExpirationTime": &types.AttributeValueMemberN{Value: formatInt(int(time.Now().Add(30*24*time.Hour).Unix()))},
+        "ExpirationTime": &types.AttributeValueMemberN{Value: formatInt(int(time.Now().Add(resultRetention).Unix()))},
+    }
+    if profile != "" {
+        item["Profile"] = &types.AttributeValueMemberS{Value: profile}
     }
     
-    _, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
-        TableName: aws.String("nexusscan-results"),
-        Item:      item,
-    })
+    // Keep the state of previously open ports so a disappearing port can be
+    // attributed to a firewall change (filtered) or the service going down (closed)
+    if len(watchedPorts) > 0 {
+        watchedAV, err := attributevalue.Marshal(watchedPorts)
+        if err != nil {
+            return err
+        }
+        item["WatchedPorts"] = watchedAV
+    }
     
+    err = s.putResultItem(ctx, item, time.Now())
     if err != nil {
         log.Printf("Error storing scan result: %v", err)
     }
     
-    // Also update the IP's LastScanned timestamp
+    // Also update the IP's LastScanned timestamp. Inventory is set as well so
+    // IPs added before the inventory indexes existed join them once scanned.
     updateInput := &dynamodb.UpdateItemInput{
-        TableName: aws.String("nexusscan-ips"),
+        TableName: aws.String(s.Tables.IPs),
         Key: map[string]types.AttributeValue{
             "IPAddress": &types.AttributeValueMemberS{Value: ipAddress},
         },
-        UpdateExpression: aws.String("SET LastScanned = :lastScanned"),
+        UpdateExpression:    aws.String("SET LastScanned = :lastScanned, Inventory = :inventory"),
+        ConditionExpression: aws.String("attribute_exists(IPAddress)"),
         ExpressionAttributeValues: map[string]types.AttributeValue{
             ":lastScanned": &types.AttributeValueMemberS{Value: timestamp},
+            ":inventory":   &types.AttributeValueMemberS{Value: inventoryPartition},
         },
     }
     
-    _, err = c.DynamoDB.UpdateItem(ctx, updateInput)
+    // An IP deleted while it was being scanned stays deleted
+    _, err = s.DynamoDB.UpdateItem(ctx, updateInput)
+    var conditionFailed *types.ConditionalCheckFailedException
+    if errors.As(err, &conditionFailed) {
+        return nil
+    }
     return err
 }
 
 
-// GetScanResults retrieves scan results for an IP with limit
-func (c *Client) GetScanResults(ctx context.Context, ipAddress string, limit int) ([]models.ScanResult, error) {
-    if limit <= 0 {
-        limit = 10 // Default limit
-    }
-    
-    // Query to get all scan results for this IP
-    queryInput := &dynamodb.QueryInput{
-        TableName:              aws.String("nexusscan-results"),
-        KeyConditionExpression: aws.String("IPAddress = :ip"),
-        ExpressionAttributeValues: map[string]types.AttributeValue{
-            ":ip": &types.AttributeValueMemberS{Value: ipAddress},
-        },
-        ScanIndexForward: aws.Bool(false), // Sort by timestamp descending (newest first)
-    }
-    
-    result, err := c.DynamoDB.Query(ctx, queryInput)
-    if err != nil {
-        return nil, err
-    }
-    
-    var scanResults []models.ScanResult
-    err = attributevalue.UnmarshalListOfMaps(result.Items, &scanResults)
-    if err != nil {
-        return nil, err
-    }
-    
-    // Group results by scanId
-    scanIdMap := make(map[string][]models.ScanResult)
-    for _, result := range scanResults {
-        scanIdMap[result.ScanID] = append(scanIdMap[result.ScanID], result)
-    }
-    
-    // Prioritize final summaries and consolidate results
-    var finalResults []models.ScanResult
-    for _, results := range scanIdMap {
-        // Look for a final summary first
-        var finalSummary *models.ScanResult
-        for i := range results {
-            if results[i].IsFinalSummary {
-                finalSummary = &results[i]
-                break
-            }
-        }
+// putResultItem stores a scan result under the time it was stored. Results
+// never replace one another: a key already taken, by another batch or the
+// other protocol's summary stored at the same instant, moves the result on
+// by a nanosecond.
+func (s *DynamoDBStore) putResultItem(ctx context.Context, item map[string]types.AttributeValue, stored time.Time) error {
+    for {
+        item["ScanTimestamp"] = &types.AttributeValueMemberS{Value: resultTimestamp(stored)}
+        _, err := s.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+            TableName:           aws.String(s.Tables.Results),
+            Item:                item,
+            ConditionExpression: aws.String("attribute_not_exists(ScanTimestamp)"),
+        })
         
-        if finalSummary != nil {
-            // Use the final summary if available
-            finalResults = append(finalResults, *finalSummary)
-        } else {
-            // Otherwise, consolidate batch results
-            // Use the result with the latest timestamp as the base
-            var latestResult models.ScanResult
-            for _, result := range results {
-                if result.ScanTimestamp > latestResult.ScanTimestamp {
-                    latestResult = result
-                }
-            }
-            
-            // Combine open ports from all batches
-            allOpenPorts := make([]models.Port, 0)
-            totalPortsScanned := 0
-            for _, result := range results {
-                allOpenPorts = append(allOpenPorts, result.OpenPorts...)
-                totalPortsScanned += result.PortsScanned
-            }
-            
-            // Create a map to deduplicate ports
-            portMap := make(map[int]models.Port)
-            for _, port := range allOpenPorts {
-                portMap[port.Number] = port
-            }
-            
-            // Convert back to slice
-            uniquePorts := make([]models.Port, 0, len(portMap))
-            for _, port := range portMap {
-                uniquePorts = append(uniquePorts, port)
-            }
-            
-            // Sort by port number
-            for i := 0; i < len(uniquePorts); i++ {
-                for j := i + 1; j < len(uniquePorts); j++ {
-                    if uniquePorts[i].Number > uniquePorts[j].Number {
-                        uniquePorts[i], uniquePorts[j] = uniquePorts[j], uniquePorts[i]
-                    }
-                }
-            }
-            
-            // Update the latest result with consolidated information
-            latestResult.OpenPorts = uniquePorts
-            latestResult.PortsScanned = totalPortsScanned
-            
-            finalResults = append(finalResults, latestResult)
-        }
-    }
-    
-    // Sort by timestamp descending
-    for i := 0; i < len(finalResults); i++ {
-        for j := i + 1; j < len(finalResults); j++ {
-            if finalResults[i].ScanTimestamp < finalResults[j].ScanTimestamp {
-                finalResults[i], finalResults[j] = finalResults[j], finalResults[i]
-            }
+        var conditionFailed *types.ConditionalCheckFailedException
+        if !errors.As(err, &conditionFailed) {
+            return err
         }
+        stored = stored.Add(time.Nanosecond)
     }
-    
-    // Apply limit
-    if len(finalResults) > limit {
-        finalResults = finalResults[:limit]
-    }
-    
-    return finalResults, nil
+}
+
+// ListScanResults returns a page of the final summaries of an IP's scans.
+// Scans that are still running have no summary yet.
+func (s *DynamoDBStore) ListScanResults(ctx context.Context, query HistoryQuery) (ScanResultPage, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.Tables.Results),
+		KeyConditionExpression: aws.String("IPAddress = :ip"),
+		FilterExpression:       aws.String("IsFinalSummary = :final"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ip":    &types.AttributeValueMemberS{Value: query.IPAddress},
+			":final": &types.AttributeValueMemberBOOL{Value: true},
+		},
+		ScanIndexForward: aws.Bool(query.OldestFirst),
+	}
+
+	items, next, total, err := s.queryPage(ctx, input, query.listing("results"), pageSize(query.Limit), query.Cursor)
+	if err != nil {
+		return ScanResultPage{}, err
+	}
+
+	page := ScanResultPage{Results: []models.ScanResult{}, NextCursor: next, Total: total}
+	if err := attributevalue.UnmarshalListOfMaps(items, &page.Results); err != nil {
+		return ScanResultPage{}, err
+	}
+	return page, nil
+}
+
+
+// GetLastCompletedSummary retrieves the final summary of the most recent
+// completed scan of an IP for a protocol, skipping the scan with excludeScanID.
+// It returns nil when the IP has no earlier completed scan.
+func (s *DynamoDBStore) GetLastCompletedSummary(ctx context.Context, ipAddress string, protocol string, excludeScanID string) (*models.ScanResult, error) {
+	paginator := dynamodb.NewQueryPaginator(s.DynamoDB, &dynamodb.QueryInput{
+		TableName:              aws.String(s.Tables.Results),
+		KeyConditionExpression: aws.String("IPAddress = :ip"),
+		// Summaries written before scans were tracked have no status and
+		// were only stored once the last batch arrived
+		FilterExpression: aws.String("IsFinalSummary = :final AND (attribute_not_exists(ScanStatus) OR ScanStatus = :completed)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ip":        &types.AttributeValueMemberS{Value: ipAddress},
+			":final":     &types.AttributeValueMemberBOOL{Value: true},
+			":completed": &types.AttributeValueMemberS{Value: models.ScanStatusCompleted},
+		},
+		ScanIndexForward: aws.Bool(false), // Newest first
+	})
+
+	protocol = models.NormalizeProtocol(protocol)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var summaries []models.ScanResult
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &summaries); err != nil {
+			return nil, err
+		}
+
+		for i := range summaries {
+			if summaries[i].ScanID != excludeScanID && models.NormalizeProtocol(summaries[i].Protocol) == protocol {
+				return &summaries[i], nil
+			}
+		}
+	}
+
+	return nil, nil
 }
 
 
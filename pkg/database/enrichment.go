@@ -6,6 +6,7 @@ import (
 	"context"
 	"log"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -19,11 +20,14 @@ type HttpxEnrichment struct {
 	Timestamp     string          `json:"timestamp" dynamodbav:"Timestamp"`
 	ScanID        string          `json:"scanId" dynamodbav:"ScanID"`
 	EnrichedPorts []HttpxResult   `json:"enrichedPorts" dynamodbav:"EnrichedPorts"`
+	Services      []ServiceResult `json:"services,omitempty" dynamodbav:"Services,omitempty"`
+	TLS           []TLSResult     `json:"tls,omitempty" dynamodbav:"TLS,omitempty"`
 	ScheduleID    string          `json:"scheduleId,omitempty" dynamodbav:"ScheduleID,omitempty"`
+	AssetGroup    string          `json:"assetGroup,omitempty" dynamodbav:"AssetGroup,omitempty"` // Group of the IP when enriched, which sets the retention
 	ExpirationTime int64          `json:"expirationTime,omitempty" dynamodbav:"ExpirationTime,omitempty"`
 }
 
-// HttpxResult represents a single result from httpx
+// HttpxResult represents a single web service found on an open port
 type HttpxResult struct {
     URL               string              `json:"url" dynamodbav:"URL"`
     StatusCode        int                 `json:"statusCode,omitempty" dynamodbav:"StatusCode,omitempty"`
@@ -43,8 +47,9 @@ type HttpxResult struct {
     Method            string              `json:"method,omitempty" dynamodbav:"Method,omitempty"`
     Failed            bool                `json:"failed,omitempty" dynamodbav:"Failed,omitempty"`
     ResponseHeaders   map[string]string   `json:"responseHeaders,omitempty" dynamodbav:"ResponseHeaders,omitempty"`
+    Hash              map[string]string   `json:"hash,omitempty" dynamodbav:"Hash,omitempty"`
     TLS               TLSData             `json:"tls,omitempty" dynamodbav:"TLS"`
-    Chain             []string            `json:"chain,omitempty" dynamodbav:"Chain,omitempty"`
+    Chain             []string            `json:"chain,omitempty" dynamodbav:"Chain,omitempty"` // URLs of the redirects followed
     Error             string              `json:"error,omitempty" dynamodbav:"Error,omitempty"`
     Timestamp         string              `json:"timestamp,omitempty" dynamodbav:"Timestamp,omitempty"`
     KnowledgeBase     map[string]string   `json:"knowledgeBase,omitempty" dynamodbav:"KnowledgeBase,omitempty"`
@@ -73,44 +78,56 @@ type TLSData struct {
     Host             string             `json:"host,omitempty" dynamodbav:"Host"`
     Port             string             `json:"port,omitempty" dynamodbav:"Port"`
     ProbeStatus      bool               `json:"probe_status,omitempty" dynamodbav:"ProbeStatus"`
+    Chain            []TLSCertificate   `json:"chain,omitempty" dynamodbav:"Chain,omitempty"`
 }
 
-// GetEnrichmentResults retrieves enrichment results for an IP
-func (c *Client) GetEnrichmentResults(ctx context.Context, ipAddress string, limit int) ([]HttpxEnrichment, error) {
-	if limit <= 0 {
-		limit = 10 // Default limit
-	}
+// TLSCertificate describes one certificate of the chain a server presented,
+// leaf first
+type TLSCertificate struct {
+    SubjectDN          string   `json:"subject_dn,omitempty" dynamodbav:"SubjectDN,omitempty"`
+    SubjectCN          string   `json:"subject_cn,omitempty" dynamodbav:"SubjectCN,omitempty"`
+    SubjectAN          []string `json:"subject_an,omitempty" dynamodbav:"SubjectAN,omitempty"`
+    IssuerDN           string   `json:"issuer_dn,omitempty" dynamodbav:"IssuerDN,omitempty"`
+    IssuerCN           string   `json:"issuer_cn,omitempty" dynamodbav:"IssuerCN,omitempty"`
+    Serial             string   `json:"serial,omitempty" dynamodbav:"Serial,omitempty"`
+    NotBefore          string   `json:"not_before,omitempty" dynamodbav:"NotBefore,omitempty"`
+    NotAfter           string   `json:"not_after,omitempty" dynamodbav:"NotAfter,omitempty"`
+    KeyAlgorithm       string   `json:"key_algorithm,omitempty" dynamodbav:"KeyAlgorithm,omitempty"`
+    KeyBits            int      `json:"key_bits,omitempty" dynamodbav:"KeyBits,omitempty"`
+    SignatureAlgorithm string   `json:"signature_algorithm,omitempty" dynamodbav:"SignatureAlgorithm,omitempty"`
+    IsCA               bool     `json:"is_ca,omitempty" dynamodbav:"IsCA,omitempty"`
+    SelfSigned         bool     `json:"self_signed,omitempty" dynamodbav:"SelfSigned,omitempty"`
+    FingerprintSHA256  string   `json:"fingerprint_sha256,omitempty" dynamodbav:"FingerprintSHA256,omitempty"`
+}
 
-	// Query to get enrichment results for this IP
-	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String("nexusscan-enrichment"),
+// ListEnrichmentResults returns a page of the enrichment runs of an IP
+func (s *DynamoDBStore) ListEnrichmentResults(ctx context.Context, query HistoryQuery) (EnrichmentPage, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.Tables.Enrichment),
 		KeyConditionExpression: aws.String("IPAddress = :ip"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":ip": &types.AttributeValueMemberS{Value: ipAddress},
+			":ip": &types.AttributeValueMemberS{Value: query.IPAddress},
 		},
-		ScanIndexForward: aws.Bool(false), // Sort by timestamp descending (newest first)
-		Limit:            aws.Int32(int32(limit)),
+		ScanIndexForward: aws.Bool(query.OldestFirst),
 	}
 
-	result, err := c.DynamoDB.Query(ctx, queryInput)
+	items, next, total, err := s.queryPage(ctx, input, query.listing("enrichment"), pageSize(query.Limit), query.Cursor)
 	if err != nil {
-		return nil, fmt.Errorf("error querying enrichment results: %v", err)
+		return EnrichmentPage{}, fmt.Errorf("error querying enrichment results: %w", err)
 	}
 
-	var enrichments []HttpxEnrichment
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &enrichments)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshaling enrichment results: %v", err)
+	page := EnrichmentPage{Results: []HttpxEnrichment{}, NextCursor: next, Total: total}
+	if err := attributevalue.UnmarshalListOfMaps(items, &page.Results); err != nil {
+		return EnrichmentPage{}, fmt.Errorf("error unmarshaling enrichment results: %v", err)
 	}
-
-	return enrichments, nil
+	return page, nil
 }
 
 // GetEnrichmentResultByScan retrieves enrichment results for a specific scan
-func (c *Client) GetEnrichmentResultByScan(ctx context.Context, ipAddress string, scanID string) (*HttpxEnrichment, error) {
+func (s *DynamoDBStore) GetEnrichmentResultByScan(ctx context.Context, ipAddress string, scanID string) (*HttpxEnrichment, error) {
 	// Query to get enrichment results for this scan
 	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String("nexusscan-enrichment"),
+		TableName:              aws.String(s.Tables.Enrichment),
 		KeyConditionExpression: aws.String("IPAddress = :ip"),
 		FilterExpression:       aws.String("ScanID = :scanId"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
@@ -120,13 +137,13 @@ func (c *Client) GetEnrichmentResultByScan(ctx context.Context, ipAddress string
 		Limit: aws.Int32(1), // We only need one result
 	}
 
-	result, err := c.DynamoDB.Query(ctx, queryInput)
+	result, err := s.DynamoDB.Query(ctx, queryInput)
 	if err != nil {
 		return nil, fmt.Errorf("error querying enrichment result: %v", err)
 	}
 
 	if len(result.Items) == 0 {
-		return nil, fmt.Errorf("no enrichment result found for IP %s and scan ID %s", ipAddress, scanID)
+		return nil, errNoEnrichmentForScan(ipAddress, scanID)
 	}
 
 	var enrichment HttpxEnrichment
@@ -139,10 +156,10 @@ func (c *Client) GetEnrichmentResultByScan(ctx context.Context, ipAddress string
 }
 
 // GetLatestEnrichmentResult retrieves the latest enrichment result for an IP
-func (c *Client) GetLatestEnrichmentResult(ctx context.Context, ipAddress string) (*HttpxEnrichment, error) {
+func (s *DynamoDBStore) GetLatestEnrichmentResult(ctx context.Context, ipAddress string) (*HttpxEnrichment, error) {
 	// Query to get the latest enrichment result for this IP
 	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String("nexusscan-enrichment"),
+		TableName:              aws.String(s.Tables.Enrichment),
 		KeyConditionExpression: aws.String("IPAddress = :ip"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":ip": &types.AttributeValueMemberS{Value: ipAddress},
@@ -151,13 +168,13 @@ func (c *Client) GetLatestEnrichmentResult(ctx context.Context, ipAddress string
 		Limit:            aws.Int32(1),    // Only get the most recent result
 	}
 
-	result, err := c.DynamoDB.Query(ctx, queryInput)
+	result, err := s.DynamoDB.Query(ctx, queryInput)
 	if err != nil {
 		return nil, fmt.Errorf("error querying latest enrichment result: %v", err)
 	}
 
 	if len(result.Items) == 0 {
-		return nil, fmt.Errorf("no enrichment results found for IP %s", ipAddress)
+		return nil, errNoEnrichment(ipAddress)
 	}
 
 	var enrichment HttpxEnrichment
@@ -170,10 +187,10 @@ func (c *Client) GetLatestEnrichmentResult(ctx context.Context, ipAddress string
 }
 
 // DeleteIPEnrichments deletes all enrichment results for an IP (used when deleting an IP)
-func (c *Client) DeleteIPEnrichments(ctx context.Context, ipAddress string) error {
+func (s *DynamoDBStore) DeleteIPEnrichments(ctx context.Context, ipAddress string) error {
 	// Query to get all enrichment results for this IP
 	queryInput := &dynamodb.QueryInput{
-		TableName:              aws.String("nexusscan-enrichment"),
+		TableName:              aws.String(s.Tables.Enrichment),
 		KeyConditionExpression: aws.String("IPAddress = :ip"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":ip": &types.AttributeValueMemberS{Value: ipAddress},
@@ -182,7 +199,7 @@ func (c *Client) DeleteIPEnrichments(ctx context.Context, ipAddress string) erro
 	}
 
 	// Paginate through all results
-	paginator := dynamodb.NewQueryPaginator(c.DynamoDB, queryInput)
+	paginator := dynamodb.NewQueryPaginator(s.DynamoDB, queryInput)
 
 	for paginator.HasMorePages() {
 		page, err := paginator.NextPage(ctx)
@@ -218,9 +235,9 @@ func (c *Client) DeleteIPEnrichments(ctx context.Context, ipAddress string) erro
 			}
 
 			// Execute batch delete
-			_, err := c.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			_, err := s.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
 				RequestItems: map[string][]types.WriteRequest{
-					"nexusscan-enrichment": deleteRequests,
+					s.Tables.Enrichment: deleteRequests,
 				},
 			})
 
@@ -233,3 +250,20 @@ func (c *Client) DeleteIPEnrichments(ctx context.Context, ipAddress string) erro
 
 	return nil
 }
+
+// StoreEnrichmentResult saves the enrichment of one scan. Results expire
+// after the retention of the IP's asset group.
+func (s *DynamoDBStore) StoreEnrichmentResult(ctx context.Context, enrichment *HttpxEnrichment) error {
+	prepareEnrichment(enrichment, time.Now())
+
+	item, err := attributevalue.MarshalMap(enrichment)
+	if err != nil {
+		return fmt.Errorf("error marshaling enrichment result: %v", err)
+	}
+
+	_, err = s.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Tables.Enrichment),
+		Item:      item,
+	})
+	return err
+}
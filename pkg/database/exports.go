@@ -0,0 +1,75 @@
+// pkg/database/exports.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// ErrExportNotFound is returned for export IDs that do not exist
+var ErrExportNotFound = errors.New("export not found")
+
+// CreateExportJob stores a new export job as pending, before the exporter is
+// invoked
+func (c *Client) CreateExportJob(ctx context.Context, job *models.ExportJob) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	job.Status = models.ExportStatusPending
+	job.CreatedAt = now
+	job.ExpirationTime = now.Add(models.ExportRetention).Unix()
+
+	return c.putExportJob(ctx, job)
+}
+
+// GetExportJob retrieves an export job
+func (c *Client) GetExportJob(ctx context.Context, exportID string) (*models.ExportJob, error) {
+	result, err := c.DynamoDB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.Tables.Exports),
+		Key: map[string]types.AttributeValue{
+			"ExportID": &types.AttributeValueMemberS{Value: exportID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, ErrExportNotFound
+	}
+
+	var job models.ExportJob
+	if err := attributevalue.UnmarshalMap(result.Item, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// SaveExportJob writes back an export job the exporter has updated. Only
+// the exporter running the job writes to it once it is created.
+func (c *Client) SaveExportJob(ctx context.Context, job *models.ExportJob) error {
+	if job.Finished() && job.CompletedAt == nil {
+		completedAt := time.Now().UTC().Truncate(time.Second)
+		job.CompletedAt = &completedAt
+	}
+	return c.putExportJob(ctx, job)
+}
+
+func (c *Client) putExportJob(ctx context.Context, job *models.ExportJob) error {
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.Tables.Exports),
+		Item:      item,
+	})
+	return err
+}
@@ -0,0 +1,747 @@
+// pkg/database/memory.go
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/google/uuid"
+)
+
+// MemoryStore is a Store held in memory, for tests and throwaway runs.
+// Nothing is kept once the process exits.
+type MemoryStore struct {
+	mu          sync.Mutex
+	ips         map[string]models.IP
+	schedules   map[string]models.Schedule
+	results     map[string]map[string]models.ScanResult // By IP, then scan timestamp
+	openPorts   map[string]map[string][]int             // By IP, then protocol
+	enrichments map[string]map[string]HttpxEnrichment   // By IP, then timestamp
+}
+
+// NewMemoryStore creates an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		ips:         make(map[string]models.IP),
+		schedules:   make(map[string]models.Schedule),
+		results:     make(map[string]map[string]models.ScanResult),
+		openPorts:   make(map[string]map[string][]int),
+		enrichments: make(map[string]map[string]HttpxEnrichment),
+	}
+}
+
+// storeTime returns the current time at the precision DynamoDBStore keeps
+func storeTime() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// AddIP adds a new IP address
+func (m *MemoryStore) AddIP(ctx context.Context, ipAddress string) error {
+	return m.AddIPFromNetwork(ctx, ipAddress, "", "", models.AssetMetadata{})
+}
+
+// AddIPFromNetwork adds an IP address with its metadata, recording the
+// network or hostname it was expanded from. An IP that is already in the
+// inventory keeps when it was added and last scanned; its metadata is merged
+// with the given metadata, and its network and hostname are only filled in
+// if unset.
+func (m *MemoryStore) AddIPFromNetwork(ctx context.Context, ipAddress string, network string, hostname string, metadata models.AssetMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ip, ok := m.ips[ipAddress]; ok {
+		merged := ip.AssetMetadata.Merge(metadata)
+		if err := merged.Validate(); err != nil {
+			return fmt.Errorf("merging metadata of IP %s: %w", ipAddress, err)
+		}
+		ip.AssetMetadata = copyMetadata(merged)
+		if ip.Network == "" {
+			ip.Network = network
+		}
+		if ip.Hostname == "" {
+			ip.Hostname = hostname
+		}
+		m.ips[ipAddress] = ip
+		return nil
+	}
+
+	m.ips[ipAddress] = models.IP{
+		IPAddress:     ipAddress,
+		CreatedAt:     storeTime(),
+		Network:       network,
+		Hostname:      hostname,
+		AssetMetadata: copyMetadata(metadata),
+	}
+	return nil
+}
+
+// GetIP returns one IP of the inventory
+func (m *MemoryStore) GetIP(ctx context.Context, ipAddress string) (*models.IP, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ip, ok := m.ips[ipAddress]
+	if !ok {
+		return nil, ErrIPNotFound
+	}
+	ip.AssetMetadata = copyMetadata(ip.AssetMetadata)
+	return &ip, nil
+}
+
+// SetIPMetadata replaces the metadata of an IP
+func (m *MemoryStore) SetIPMetadata(ctx context.Context, ipAddress string, metadata models.AssetMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ip, ok := m.ips[ipAddress]
+	if !ok {
+		return ErrIPNotFound
+	}
+	ip.AssetMetadata = copyMetadata(metadata)
+	m.ips[ipAddress] = ip
+	return nil
+}
+
+// copyMetadata copies the tags of metadata, so callers cannot change what
+// the store holds
+func copyMetadata(metadata models.AssetMetadata) models.AssetMetadata {
+	if metadata.Tags != nil {
+		tags := make(map[string]string, len(metadata.Tags))
+		for key, value := range metadata.Tags {
+			tags[key] = value
+		}
+		metadata.Tags = tags
+	}
+	return metadata
+}
+
+// ListIPs returns a page of the inventory
+func (m *MemoryStore) ListIPs(ctx context.Context, query IPQuery) (IPPage, error) {
+	if err := query.Validate(); err != nil {
+		return IPPage{}, err
+	}
+	listing := query.listing()
+	cursor, err := decodePageCursor(query.Cursor, listing)
+	if err != nil {
+		return IPPage{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ips := []models.IP{}
+	for _, ip := range m.ips {
+		if query.keeps(ip) {
+			ips = append(ips, ip)
+		}
+	}
+
+	// precedes reports whether the IP at one position comes before the IP at
+	// another in the order asked for
+	precedes := func(aTime time.Time, aIP string, bTime time.Time, bIP string) bool {
+		if !aTime.Equal(bTime) {
+			return aTime.Before(bTime) != query.Descending
+		}
+		if aIP == bIP {
+			return false
+		}
+		return (aIP < bIP) != query.Descending
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return precedes(query.sortTime(ips[i]), ips[i].IPAddress, query.sortTime(ips[j]), ips[j].IPAddress)
+	})
+
+	total := cursor.Total
+	if query.Cursor == "" {
+		total = len(ips)
+	}
+	start := 0
+	if len(cursor.LastKey) > 0 {
+		lastTime, lastIP, err := query.cursorPosition(cursor)
+		if err != nil {
+			return IPPage{}, err
+		}
+		for start < len(ips) && !precedes(lastTime, lastIP, query.sortTime(ips[start]), ips[start].IPAddress) {
+			start++
+		}
+	}
+
+	page := IPPage{IPs: ips[start:], Total: total}
+	if limit := pageSize(query.Limit); len(page.IPs) > limit {
+		page.IPs = page.IPs[:limit]
+		page.NextCursor, err = nextPageCursor(listing, query.cursorKey(page.IPs[limit-1]), total)
+	}
+	return page, err
+}
+
+// GetIPsByNetwork returns every IP that was added from the given network
+func (m *MemoryStore) GetIPsByNetwork(ctx context.Context, network string) ([]models.IP, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ips []models.IP
+	for _, ip := range m.ips {
+		if ip.Network == network {
+			ips = append(ips, ip)
+		}
+	}
+	sort.Slice(ips, func(i, j int) bool { return ips[i].IPAddress < ips[j].IPAddress })
+	return ips, nil
+}
+
+// DeleteIP removes an IP along with its schedules, open ports, results and
+// enrichment data
+func (m *MemoryStore) DeleteIP(ctx context.Context, ipAddress string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.ips, ipAddress)
+	for id, schedule := range m.schedules {
+		if schedule.IPAddress == ipAddress {
+			delete(m.schedules, id)
+		}
+	}
+	delete(m.openPorts, ipAddress)
+	delete(m.results, ipAddress)
+	delete(m.enrichments, ipAddress)
+	return nil
+}
+
+// AddSchedule adds a scan schedule for an IP
+func (m *MemoryStore) AddSchedule(ctx context.Context, ipAddress string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
+	return m.addSchedule(ipAddress, nil, scheduleType, timing, portSet, profile, enabled)
+}
+
+// AddSelectorSchedule adds a scan schedule for the IPs a selector matches
+func (m *MemoryStore) AddSelectorSchedule(ctx context.Context, selector models.AssetSelector, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
+	selector.Tags = copyMetadata(models.AssetMetadata{Tags: selector.Tags}).Tags
+	return m.addSchedule("", &selector, scheduleType, timing, portSet, profile, enabled)
+}
+
+func (m *MemoryStore) addSchedule(ipAddress string, selector *models.AssetSelector, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
+	created := storeTime()
+	nextRun, err := timing.ForScheduleType(scheduleType).Next(created)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule := models.Schedule{
+		ScheduleID:     uuid.New().String(),
+		IPAddress:      ipAddress,
+		Selector:       selector,
+		ScheduleType:   scheduleType,
+		ScheduleTiming: timing,
+		PortSet:        portSet,
+		Profile:        profile,
+		Enabled:        enabled,
+		CreatedAt:      created,
+		UpdatedAt:      created,
+		NextRun:        nextRun.UTC(),
+	}
+	m.schedules[schedule.ScheduleID] = schedule
+	return schedule.ScheduleID, nil
+}
+
+// UpdateSchedule replaces the type, timing, port set, profile and status of a schedule
+func (m *MemoryStore) UpdateSchedule(ctx context.Context, scheduleID string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) error {
+	updated := storeTime()
+	nextRun, err := timing.ForScheduleType(scheduleType).Next(updated)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[scheduleID]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	schedule.ScheduleType = scheduleType
+	schedule.ScheduleTiming = timing
+	schedule.PortSet = portSet
+	schedule.Profile = profile
+	schedule.Enabled = enabled
+	schedule.UpdatedAt = updated
+	schedule.NextRun = nextRun.UTC()
+	m.schedules[scheduleID] = schedule
+	return nil
+}
+
+// UpdateScheduleStatus enables or disables a scan schedule
+func (m *MemoryStore) UpdateScheduleStatus(ctx context.Context, scheduleID string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[scheduleID]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	schedule.Enabled = enabled
+	schedule.UpdatedAt = storeTime()
+	m.schedules[scheduleID] = schedule
+	return nil
+}
+
+// DeleteSchedule removes a scan schedule
+func (m *MemoryStore) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.schedules, scheduleID)
+	return nil
+}
+
+// DeleteIPSchedules deletes all schedules for an IP
+func (m *MemoryStore) DeleteIPSchedules(ctx context.Context, ipAddress string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, schedule := range m.schedules {
+		if schedule.IPAddress == ipAddress {
+			delete(m.schedules, id)
+		}
+	}
+	return nil
+}
+
+// GetSchedulesForIP returns the schedules of an IP, oldest first
+func (m *MemoryStore) GetSchedulesForIP(ctx context.Context, ipAddress string) ([]models.Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var schedules []models.Schedule
+	for _, schedule := range m.schedules {
+		if schedule.IPAddress == ipAddress {
+			schedules = append(schedules, readSchedule(schedule))
+		}
+	}
+	sortSchedules(schedules)
+	return schedules, nil
+}
+
+// GetSelectorSchedules returns the schedules of selectors, oldest first
+func (m *MemoryStore) GetSelectorSchedules(ctx context.Context) ([]models.Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var schedules []models.Schedule
+	for _, schedule := range m.schedules {
+		if schedule.Selector != nil {
+			schedules = append(schedules, readSchedule(schedule))
+		}
+	}
+	sortSchedules(schedules)
+	return schedules, nil
+}
+
+// GetScheduleByID returns a schedule by its ID
+func (m *MemoryStore) GetScheduleByID(ctx context.Context, scheduleID string) (*models.Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[scheduleID]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	schedule = readSchedule(schedule)
+	return &schedule, nil
+}
+
+// GetDueSchedules returns one page of enabled schedules whose NextRun has
+// passed, in NextRun order. Schedules due outside their scan windows or on a
+// blackout date are deferred instead of returned.
+func (m *MemoryStore) GetDueSchedules(ctx context.Context, at time.Time, scheduleType string, pageSize int, token string) ([]models.ScheduleScan, string, error) {
+	cursor, err := decodeDispatchCursor(token)
+	if err != nil {
+		return nil, "", err
+	}
+	after, err := dueScheduleAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []models.Schedule
+	for _, schedule := range m.schedules {
+		if !schedule.Enabled || schedule.NextRun.After(at) {
+			continue
+		}
+		if scheduleType != "" && schedule.ScheduleType != scheduleType {
+			continue
+		}
+		if after != nil && !dueAfter(schedule, after) {
+			continue
+		}
+		due = append(due, readSchedule(schedule))
+	}
+	sort.Slice(due, func(i, j int) bool { return dueAfter(due[j], &due[i]) })
+
+	more := pageSize > 0 && len(due) > pageSize
+	if more {
+		due = due[:pageSize]
+	}
+
+	var scans []models.ScheduleScan
+	for _, schedule := range due {
+		scan := scheduleScan(schedule)
+		if !scan.Allows(at) {
+			nextRun, err := scan.Next(at)
+			if err != nil {
+				return nil, "", err
+			}
+			stored := m.schedules[schedule.ScheduleID]
+			stored.NextRun = nextRun.UTC()
+			m.schedules[schedule.ScheduleID] = stored
+			continue
+		}
+		scans = append(scans, scan)
+	}
+
+	if !more {
+		return scans, "", nil
+	}
+	next, err := encodeDispatchCursor(dueScheduleCursor(due[len(due)-1]))
+	if err != nil {
+		return nil, "", err
+	}
+	return scans, next, nil
+}
+
+// ClaimScheduleRun records that a due schedule is being run and moves its
+// NextRun on, unless another dispatcher claimed the run first
+func (m *MemoryStore) ClaimScheduleRun(ctx context.Context, scan models.ScheduleScan, at time.Time) (bool, error) {
+	nextRun, err := scan.Next(at)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[scan.ScheduleID]
+	if !ok || !schedule.NextRun.Equal(scan.NextRun) {
+		return false, nil
+	}
+	schedule.LastRun = at.UTC()
+	schedule.NextRun = nextRun.UTC()
+	schedule.UpdatedAt = at.UTC()
+	m.schedules[scan.ScheduleID] = schedule
+	return true, nil
+}
+
+// ReleaseScheduleRun puts a claimed run back so the next dispatch pass
+// retries it
+func (m *MemoryStore) ReleaseScheduleRun(ctx context.Context, scan models.ScheduleScan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule, ok := m.schedules[scan.ScheduleID]
+	if !ok {
+		return fmt.Errorf("error releasing run of schedule %s: %w", scan.ScheduleID, ErrScheduleNotFound)
+	}
+	schedule.NextRun = scan.NextRun
+	m.schedules[scan.ScheduleID] = schedule
+	return nil
+}
+
+// SchedulesUsePortSet reports whether any schedule scans with the named port set
+func (m *MemoryStore) SchedulesUsePortSet(ctx context.Context, portSet string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, schedule := range m.schedules {
+		if schedule.PortSet == portSet {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SchedulesUseProfile reports whether any schedule scans with the named profile
+func (m *MemoryStore) SchedulesUseProfile(ctx context.Context, profile string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, schedule := range m.schedules {
+		if schedule.Profile == profile {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// StoreScanResult saves the result of one scan batch and updates the IP's
+// LastScanned time
+func (m *MemoryStore) StoreScanResult(ctx context.Context, ipAddress string, scanID string, protocol string, profile string, openPorts []models.Port, scanDuration time.Duration, portsScanned int, stateCounts models.PortStateCounts, watchedPorts []models.Port) error {
+	scanned := storeTime()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.putResult(models.ScanResult{
+		IPAddress:      ipAddress,
+		ScanTimestamp:  resultTimestamp(time.Now()),
+		ScanID:         scanID,
+		OpenPorts:      openPorts,
+		ScanDuration:   int(scanDuration.Milliseconds()),
+		PortsScanned:   portsScanned,
+		Protocol:       models.NormalizeProtocol(protocol),
+		StateCounts:    &stateCounts,
+		WatchedPorts:   watchedPorts,
+		Profile:        profile,
+		ExpirationTime: scanned.Add(resultRetention).Unix(),
+	})
+
+	if ip, ok := m.ips[ipAddress]; ok {
+		ip.LastScanned = scanned
+		m.ips[ipAddress] = ip
+	}
+	return nil
+}
+
+// StoreFinalScanSummary saves the final summary of a finished scan
+func (m *MemoryStore) StoreFinalScanSummary(ctx context.Context, ipAddress string, scanID string, protocol string, profile string, scanStatus string, openPorts []models.Port, portsProbed string, scanDuration time.Duration, portsScanned int, stateCounts models.PortStateCounts, useHistoricalPorts bool) error {
+	finalOpenPorts := finalSummaryPorts(ctx, m, ipAddress, protocol, openPorts, useHistoricalPorts)
+	summary := newFinalSummary(ipAddress, scanID, protocol, profile, scanStatus, finalOpenPorts, portsProbed, scanDuration, portsScanned, stateCounts, time.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.putResult(summary)
+	return nil
+}
+
+// putResult stores a scan result, moving it on by a nanosecond while its
+// key is taken so results never replace one another
+func (m *MemoryStore) putResult(result models.ScanResult) {
+	if m.results[result.IPAddress] == nil {
+		m.results[result.IPAddress] = make(map[string]models.ScanResult)
+	}
+	for {
+		if _, taken := m.results[result.IPAddress][result.ScanTimestamp]; !taken {
+			break
+		}
+		stored, err := time.Parse(resultTimestampLayout, result.ScanTimestamp)
+		if err != nil {
+			stored = time.Now()
+		}
+		result.ScanTimestamp = resultTimestamp(stored.Add(time.Nanosecond))
+	}
+	m.results[result.IPAddress][result.ScanTimestamp] = result
+}
+
+// liveResults returns the unexpired results of an IP, newest first
+func (m *MemoryStore) liveResults(ipAddress string) []models.ScanResult {
+	current := time.Now().Unix()
+	var results []models.ScanResult
+	for _, result := range m.results[ipAddress] {
+		if result.ExpirationTime == 0 || result.ExpirationTime >= current {
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ScanTimestamp > results[j].ScanTimestamp })
+	return results
+}
+
+// ListScanResults returns a page of the final summaries of an IP's scans
+func (m *MemoryStore) ListScanResults(ctx context.Context, query HistoryQuery) (ScanResultPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	summaries := []models.ScanResult{}
+	for _, result := range m.liveResults(query.IPAddress) {
+		if result.IsFinalSummary {
+			summaries = append(summaries, result)
+		}
+	}
+
+	results, next, total, err := historyPage(summaries, func(result models.ScanResult) string { return result.ScanTimestamp },
+		"ScanTimestamp", query, query.listing("results"))
+	if err != nil {
+		return ScanResultPage{}, err
+	}
+	return ScanResultPage{Results: results, NextCursor: next, Total: total}, nil
+}
+
+// GetLastCompletedSummary returns the final summary of the most recent
+// completed scan of an IP for a protocol, skipping the scan with
+// excludeScanID, or nil when there is none
+func (m *MemoryStore) GetLastCompletedSummary(ctx context.Context, ipAddress string, protocol string, excludeScanID string) (*models.ScanResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	protocol = models.NormalizeProtocol(protocol)
+	for _, result := range m.liveResults(ipAddress) {
+		if isCompletedSummary(result) && result.ScanID != excludeScanID && models.NormalizeProtocol(result.Protocol) == protocol {
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetOpenPorts returns the open TCP ports of an IP
+func (m *MemoryStore) GetOpenPorts(ctx context.Context, ipAddress string) ([]int, error) {
+	return m.GetOpenPortsByProtocol(ctx, ipAddress, models.ProtocolTCP)
+}
+
+// GetOpenPortsByProtocol returns the open ports of an IP for a protocol
+func (m *MemoryStore) GetOpenPortsByProtocol(ctx context.Context, ipAddress string, protocol string) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ports := m.openPorts[ipAddress][models.NormalizeProtocol(protocol)]
+	return append([]int{}, ports...), nil
+}
+
+// StoreOpenPorts saves open TCP ports for an IP
+func (m *MemoryStore) StoreOpenPorts(ctx context.Context, ipAddress string, openPorts []int, replaceExisting bool) error {
+	return m.StoreOpenPortsByProtocol(ctx, ipAddress, models.ProtocolTCP, openPorts, replaceExisting)
+}
+
+// StoreOpenPortsByProtocol saves open ports for an IP and protocol, merging
+// them with the ports already known unless replaceExisting is set
+func (m *MemoryStore) StoreOpenPortsByProtocol(ctx context.Context, ipAddress string, protocol string, openPorts []int, replaceExisting bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	protocol = models.NormalizeProtocol(protocol)
+	if m.openPorts[ipAddress] == nil {
+		m.openPorts[ipAddress] = make(map[string][]int)
+	}
+
+	ports := append([]int{}, openPorts...)
+	if !replaceExisting {
+		ports = mergeOpenPorts(m.openPorts[ipAddress][protocol], openPorts)
+	}
+	m.openPorts[ipAddress][protocol] = ports
+	return nil
+}
+
+// StoreEnrichmentResult saves the enrichment of one scan
+func (m *MemoryStore) StoreEnrichmentResult(ctx context.Context, enrichment *HttpxEnrichment) error {
+	prepareEnrichment(enrichment, time.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.enrichments[enrichment.IPAddress] == nil {
+		m.enrichments[enrichment.IPAddress] = make(map[string]HttpxEnrichment)
+	}
+	m.enrichments[enrichment.IPAddress][enrichment.Timestamp] = *enrichment
+	return nil
+}
+
+// liveEnrichments returns the unexpired enrichment results of an IP, newest first
+func (m *MemoryStore) liveEnrichments(ipAddress string) []HttpxEnrichment {
+	current := time.Now().Unix()
+	var enrichments []HttpxEnrichment
+	for _, enrichment := range m.enrichments[ipAddress] {
+		if enrichment.ExpirationTime == 0 || enrichment.ExpirationTime >= current {
+			enrichments = append(enrichments, enrichment)
+		}
+	}
+	sort.Slice(enrichments, func(i, j int) bool { return enrichments[i].Timestamp > enrichments[j].Timestamp })
+	return enrichments
+}
+
+// ListEnrichmentResults returns a page of the enrichment runs of an IP
+func (m *MemoryStore) ListEnrichmentResults(ctx context.Context, query HistoryQuery) (EnrichmentPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enrichments := append([]HttpxEnrichment{}, m.liveEnrichments(query.IPAddress)...)
+	results, next, total, err := historyPage(enrichments, func(enrichment HttpxEnrichment) string { return enrichment.Timestamp },
+		"Timestamp", query, query.listing("enrichment"))
+	if err != nil {
+		return EnrichmentPage{}, err
+	}
+	return EnrichmentPage{Results: results, NextCursor: next, Total: total}, nil
+}
+
+// historyPage pages through the history of an IP, given newest first. Items
+// are keyed by their timestamp, which the cursor keeps under attribute.
+func historyPage[T any](items []T, timestamp func(T) string, attribute string, query HistoryQuery, listing string) ([]T, string, int, error) {
+	cursor, err := decodePageCursor(query.Cursor, listing)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	if query.OldestFirst {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	total := cursor.Total
+	if query.Cursor == "" {
+		total = len(items)
+	}
+	start := 0
+	if len(cursor.LastKey) > 0 {
+		last := cursor.LastKey[attribute]
+		if last == "" {
+			return nil, "", 0, ErrInvalidCursor
+		}
+		for start < len(items) {
+			current := timestamp(items[start])
+			if (query.OldestFirst && current > last) || (!query.OldestFirst && current < last) {
+				break
+			}
+			start++
+		}
+	}
+
+	items = items[start:]
+	limit := pageSize(query.Limit)
+	if len(items) <= limit {
+		return items, "", total, nil
+	}
+	items = items[:limit]
+	next, err := nextPageCursor(listing, map[string]string{attribute: timestamp(items[limit-1])}, total)
+	return items, next, total, err
+}
+
+// GetEnrichmentResultByScan returns the enrichment result of a scan
+func (m *MemoryStore) GetEnrichmentResultByScan(ctx context.Context, ipAddress string, scanID string) (*HttpxEnrichment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, enrichment := range m.liveEnrichments(ipAddress) {
+		if enrichment.ScanID == scanID {
+			return &enrichment, nil
+		}
+	}
+	return nil, errNoEnrichmentForScan(ipAddress, scanID)
+}
+
+// GetLatestEnrichmentResult returns the newest enrichment result of an IP
+func (m *MemoryStore) GetLatestEnrichmentResult(ctx context.Context, ipAddress string) (*HttpxEnrichment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enrichments := m.liveEnrichments(ipAddress)
+	if len(enrichments) == 0 {
+		return nil, errNoEnrichment(ipAddress)
+	}
+	return &enrichments[0], nil
+}
+
+// DeleteIPEnrichments deletes all enrichment results for an IP
+func (m *MemoryStore) DeleteIPEnrichments(ctx context.Context, ipAddress string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.enrichments, ipAddress)
+	return nil
+}
@@ -0,0 +1,93 @@
+// pkg/database/modules.go
+
+package database
+
+// ServiceResult is what a protocol module found on an open port. Exactly
+// one of the module sections is set, named after the module.
+type ServiceResult struct {
+	Port      int    `json:"port" dynamodbav:"Port"`
+	Service   string `json:"service,omitempty" dynamodbav:"Service,omitempty"` // Service detected on the port, empty if unknown
+	Module    string `json:"module" dynamodbav:"Module"`
+	Error     string `json:"error,omitempty" dynamodbav:"Error,omitempty"`
+	Timestamp string `json:"timestamp,omitempty" dynamodbav:"Timestamp,omitempty"`
+
+	SSH           *SSHResult       `json:"ssh,omitempty" dynamodbav:"SSH,omitempty"`
+	SMTP          *SMTPResult      `json:"smtp,omitempty" dynamodbav:"SMTP,omitempty"`
+	FTP           *FTPResult       `json:"ftp,omitempty" dynamodbav:"FTP,omitempty"`
+	RDP           *RDPResult       `json:"rdp,omitempty" dynamodbav:"RDP,omitempty"`
+	SMB           *SMBResult       `json:"smb,omitempty" dynamodbav:"SMB,omitempty"`
+	Redis         *DatastoreResult `json:"redis,omitempty" dynamodbav:"Redis,omitempty"`
+	Memcached     *DatastoreResult `json:"memcached,omitempty" dynamodbav:"Memcached,omitempty"`
+	MongoDB       *DatastoreResult `json:"mongodb,omitempty" dynamodbav:"MongoDB,omitempty"`
+	Elasticsearch *DatastoreResult `json:"elasticsearch,omitempty" dynamodbav:"Elasticsearch,omitempty"`
+	DNS           *DNSResult       `json:"dns,omitempty" dynamodbav:"DNS,omitempty"`
+}
+
+// SSHResult describes an SSH server's identification, host keys and the
+// algorithms it offers
+type SSHResult struct {
+	Banner            string       `json:"banner,omitempty" dynamodbav:"Banner,omitempty"`
+	HostKeys          []SSHHostKey `json:"hostKeys,omitempty" dynamodbav:"HostKeys,omitempty"`
+	KexAlgorithms     []string     `json:"kexAlgorithms,omitempty" dynamodbav:"KexAlgorithms,omitempty"`
+	HostKeyAlgorithms []string     `json:"hostKeyAlgorithms,omitempty" dynamodbav:"HostKeyAlgorithms,omitempty"`
+	Ciphers           []string     `json:"ciphers,omitempty" dynamodbav:"Ciphers,omitempty"`
+	MACs              []string     `json:"macs,omitempty" dynamodbav:"MACs,omitempty"`
+	Compression       []string     `json:"compression,omitempty" dynamodbav:"Compression,omitempty"`
+	WeakAlgorithms    []string     `json:"weakAlgorithms,omitempty" dynamodbav:"WeakAlgorithms,omitempty"`
+}
+
+// SSHHostKey is one host key of an SSH server
+type SSHHostKey struct {
+	Type              string `json:"type" dynamodbav:"Type"`
+	FingerprintSHA256 string `json:"fingerprintSha256" dynamodbav:"FingerprintSHA256"`
+	FingerprintMD5    string `json:"fingerprintMd5,omitempty" dynamodbav:"FingerprintMD5,omitempty"`
+}
+
+// SMTPResult describes the extensions an SMTP server announces
+type SMTPResult struct {
+	Banner         string   `json:"banner,omitempty" dynamodbav:"Banner,omitempty"`
+	Capabilities   []string `json:"capabilities,omitempty" dynamodbav:"Capabilities,omitempty"`
+	AuthMechanisms []string `json:"authMechanisms,omitempty" dynamodbav:"AuthMechanisms,omitempty"`
+	StartTLS       bool     `json:"startTls" dynamodbav:"StartTLS"`
+	TLSVersion     string   `json:"tlsVersion,omitempty" dynamodbav:"TLSVersion,omitempty"` // Negotiated after STARTTLS
+	AuthBeforeTLS  bool     `json:"authBeforeTls,omitempty" dynamodbav:"AuthBeforeTLS,omitempty"`
+}
+
+// FTPResult describes an FTP server and whether it takes anonymous logins
+type FTPResult struct {
+	Banner         string   `json:"banner,omitempty" dynamodbav:"Banner,omitempty"`
+	AnonymousLogin bool     `json:"anonymousLogin" dynamodbav:"AnonymousLogin"`
+	Features       []string `json:"features,omitempty" dynamodbav:"Features,omitempty"`
+}
+
+// RDPResult describes the security protocols an RDP server accepts
+type RDPResult struct {
+	SelectedProtocol string `json:"selectedProtocol,omitempty" dynamodbav:"SelectedProtocol,omitempty"` // Chosen when every protocol is offered
+	NLARequired      bool   `json:"nlaRequired" dynamodbav:"NLARequired"`
+	TLSSupported     bool   `json:"tlsSupported" dynamodbav:"TLSSupported"`
+	StandardSecurity bool   `json:"standardSecurity" dynamodbav:"StandardSecurity"` // Legacy RDP encryption without TLS is accepted
+}
+
+// SMBResult describes the dialects and signing of an SMB server
+type SMBResult struct {
+	Dialects        []string `json:"dialects,omitempty" dynamodbav:"Dialects,omitempty"`
+	SMBv1           bool     `json:"smbv1" dynamodbav:"SMBv1"`
+	SigningEnabled  bool     `json:"signingEnabled" dynamodbav:"SigningEnabled"`
+	SigningRequired bool     `json:"signingRequired" dynamodbav:"SigningRequired"`
+}
+
+// DatastoreResult describes whether a database or cache answers without
+// credentials
+type DatastoreResult struct {
+	Product         string            `json:"product,omitempty" dynamodbav:"Product,omitempty"`
+	Version         string            `json:"version,omitempty" dynamodbav:"Version,omitempty"`
+	Unauthenticated bool              `json:"unauthenticated" dynamodbav:"Unauthenticated"` // Data can be read without credentials
+	Details         map[string]string `json:"details,omitempty" dynamodbav:"Details,omitempty"`
+}
+
+// DNSResult describes whether a DNS server resolves names for anyone
+type DNSResult struct {
+	RecursionAvailable bool   `json:"recursionAvailable" dynamodbav:"RecursionAvailable"`
+	Recursive          bool   `json:"recursive" dynamodbav:"Recursive"` // Answered a query for a name it does not serve
+	Version            string `json:"version,omitempty" dynamodbav:"Version,omitempty"`
+}
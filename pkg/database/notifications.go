@@ -0,0 +1,245 @@
+// pkg/database/notifications.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/targets"
+	"github.com/google/uuid"
+)
+
+// NotificationFailureRetention is how long undelivered notifications are kept
+const NotificationFailureRetention = 14 * 24 * time.Hour
+
+// Notification errors, distinguished so the API can map them to status codes
+var (
+	ErrNotificationNotFound = errors.New("notification channel or rule not found")
+	ErrInvalidNotification  = errors.New("invalid notification channel or rule")
+	ErrChannelInUse         = errors.New("notification channel is used by rules")
+)
+
+// CreateNotificationChannel validates and stores a new notification channel
+func (c *Client) CreateNotificationChannel(ctx context.Context, channel *models.NotificationChannel) error {
+	if err := channel.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+
+	channel.ChannelID = uuid.New().String()
+	channel.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	item, err := attributevalue.MarshalMap(channel)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.Tables.NotificationChannels),
+		Item:      item,
+	})
+	return err
+}
+
+// GetNotificationChannel retrieves a notification channel
+func (c *Client) GetNotificationChannel(ctx context.Context, channelID string) (*models.NotificationChannel, error) {
+	result, err := c.DynamoDB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.Tables.NotificationChannels),
+		Key: map[string]types.AttributeValue{
+			"ChannelID": &types.AttributeValueMemberS{Value: channelID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, ErrNotificationNotFound
+	}
+
+	var channel models.NotificationChannel
+	if err := attributevalue.UnmarshalMap(result.Item, &channel); err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// ListNotificationChannels retrieves all notification channels
+func (c *Client) ListNotificationChannels(ctx context.Context) ([]models.NotificationChannel, error) {
+	var channels []models.NotificationChannel
+	if err := c.scanAll(ctx, c.Tables.NotificationChannels, &channels); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].CreatedAt.Before(channels[j].CreatedAt)
+	})
+	return channels, nil
+}
+
+// DeleteNotificationChannel removes a notification channel. Channels that
+// rules still send to cannot be deleted.
+func (c *Client) DeleteNotificationChannel(ctx context.Context, channelID string) error {
+	rules, err := c.ListNotificationRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		for _, id := range rule.ChannelIDs {
+			if id == channelID {
+				return ErrChannelInUse
+			}
+		}
+	}
+
+	return c.deleteNotificationItem(ctx, c.Tables.NotificationChannels, "ChannelID", channelID)
+}
+
+// CreateNotificationRule validates and stores a new notification rule
+func (c *Client) CreateNotificationRule(ctx context.Context, rule *models.NotificationRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("%w: rule name is required", ErrInvalidNotification)
+	}
+	for _, eventType := range rule.EventTypes {
+		if !models.IsValidEventType(eventType) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidNotification, eventType)
+		}
+	}
+	for _, spec := range rule.Targets {
+		if err := targets.ValidateMatch(spec); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+		}
+	}
+	if rule.Selector != nil {
+		if err := rule.Selector.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+		}
+		if rule.Selector.IsEmpty() {
+			rule.Selector = nil
+		}
+	}
+	if len(rule.ChannelIDs) == 0 {
+		return fmt.Errorf("%w: at least one channelId is required", ErrInvalidNotification)
+	}
+	for _, channelID := range rule.ChannelIDs {
+		if _, err := c.GetNotificationChannel(ctx, channelID); err != nil {
+			if errors.Is(err, ErrNotificationNotFound) {
+				return fmt.Errorf("%w: channel %q does not exist", ErrInvalidNotification, channelID)
+			}
+			return err
+		}
+	}
+
+	rule.RuleID = uuid.New().String()
+	rule.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	item, err := attributevalue.MarshalMap(rule)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.Tables.NotificationRules),
+		Item:      item,
+	})
+	return err
+}
+
+// ListNotificationRules retrieves all notification rules
+func (c *Client) ListNotificationRules(ctx context.Context) ([]models.NotificationRule, error) {
+	var rules []models.NotificationRule
+	if err := c.scanAll(ctx, c.Tables.NotificationRules, &rules); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+	})
+	return rules, nil
+}
+
+// DeleteNotificationRule removes a notification rule
+func (c *Client) DeleteNotificationRule(ctx context.Context, ruleID string) error {
+	return c.deleteNotificationItem(ctx, c.Tables.NotificationRules, "RuleID", ruleID)
+}
+
+// StoreNotificationFailure records an event that could not be delivered
+func (c *Client) StoreNotificationFailure(ctx context.Context, failure *models.NotificationFailure) error {
+	if failure.FailureID == "" {
+		failure.FailureID = uuid.New().String()
+	}
+	failure.ExpirationTime = failure.FailedAt.Add(NotificationFailureRetention).Unix()
+
+	item, err := attributevalue.MarshalMap(failure)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.Tables.NotificationFailures),
+		Item:      item,
+	})
+	return err
+}
+
+// ListNotificationFailures retrieves recorded delivery failures, newest first
+func (c *Client) ListNotificationFailures(ctx context.Context, limit int) ([]models.NotificationFailure, error) {
+	var failures []models.NotificationFailure
+	if err := c.scanAll(ctx, c.Tables.NotificationFailures, &failures); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].FailedAt.After(failures[j].FailedAt)
+	})
+	if limit > 0 && len(failures) > limit {
+		failures = failures[:limit]
+	}
+	return failures, nil
+}
+
+// scanAll reads every item of a small configuration table into out
+func (c *Client) scanAll(ctx context.Context, table string, out interface{}) error {
+	var items []map[string]types.AttributeValue
+
+	paginator := dynamodb.NewScanPaginator(c.DynamoDB, &dynamodb.ScanInput{
+		TableName: aws.String(table),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		items = append(items, page.Items...)
+	}
+
+	return attributevalue.UnmarshalListOfMaps(items, out)
+}
+
+// deleteNotificationItem deletes a channel or rule, reporting missing items
+func (c *Client) deleteNotificationItem(ctx context.Context, table string, keyName string, id string) error {
+	_, err := c.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			keyName: &types.AttributeValueMemberS{Value: id},
+		},
+		ConditionExpression: aws.String("attribute_exists(#key)"),
+		ExpressionAttributeNames: map[string]string{
+			"#key": keyName,
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrNotificationNotFound
+	}
+	return err
+}
@@ -0,0 +1,336 @@
+// pkg/database/pagination.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Indexes that order the IP inventory. Every IP is written to the same
+// Inventory partition so each index holds the whole inventory in order.
+const (
+	CreatedAtIndex   = "CreatedAtIndex"
+	LastScannedIndex = "LastScannedIndex"
+)
+
+// inventoryPartition is the Inventory of every IP
+const inventoryPartition = "ip"
+
+// Orders the inventory can be listed in
+const (
+	SortByCreated     = "created"
+	SortByLastScanned = "lastScanned"
+)
+
+// Page sizes of the cursor-paged listings
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 1000
+)
+
+// ErrInvalidCursor is returned for cursors that were not produced by the same
+// listing with the same query
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// IPQuery selects a page of the IP inventory. IPs are ordered by when they
+// were added unless SortBy is SortByLastScanned, oldest first unless
+// Descending is set. IPs that were never scanned sort before every scanned one.
+// Selector, when not empty, keeps only the IPs it matches.
+type IPQuery struct {
+	SortBy     string
+	Descending bool
+	// ScannedBefore keeps only IPs last scanned before it, including those
+	// never scanned
+	ScannedBefore time.Time
+	// ScannedSince keeps only IPs last scanned at or after it
+	ScannedSince time.Time
+	Selector     models.AssetSelector
+	Limit        int
+	// Cursor is the NextCursor of the previous page, empty for the first
+	Cursor string
+}
+
+// HistoryQuery selects a page of the scan results or enrichment runs of an
+// IP, newest first unless OldestFirst is set
+type HistoryQuery struct {
+	IPAddress   string
+	OldestFirst bool
+	Limit       int
+	Cursor      string
+}
+
+// IPPage is one page of the IP inventory. NextCursor is empty on the last page
+// and Total counts every IP the query matches, not just this page.
+type IPPage struct {
+	IPs        []models.IP
+	NextCursor string
+	Total      int
+}
+
+// ScanResultPage is one page of the final scan summaries of an IP
+type ScanResultPage struct {
+	Results    []models.ScanResult
+	NextCursor string
+	Total      int
+}
+
+// EnrichmentPage is one page of the enrichment runs of an IP
+type EnrichmentPage struct {
+	Results    []HttpxEnrichment
+	NextCursor string
+	Total      int
+}
+
+// neverScanned is the LastScanned stored for IPs that have not been scanned,
+// which sorts before any scan time
+var neverScanned = time.Time{}.Format(time.RFC3339)
+
+// pageCursor is the decoded form of a page cursor: the listing and query it
+// belongs to, the key of the last item returned and the total counted when
+// the first page was read
+type pageCursor struct {
+	Listing string            `json:"l"`
+	LastKey map[string]string `json:"k"`
+	Total   int               `json:"n"`
+}
+
+// listing identifies an inventory query, so a cursor cannot be replayed
+// against a different order or filter
+func (q IPQuery) listing() string {
+	bound := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return fmt.Sprint(t.Unix())
+	}
+	return fmt.Sprintf("ips|%s|%t|%s|%s|%s", q.sortBy(), q.Descending, bound(q.ScannedBefore), bound(q.ScannedSince), q.Selector)
+}
+
+func (q IPQuery) sortBy() string {
+	if q.SortBy == SortByLastScanned {
+		return SortByLastScanned
+	}
+	return SortByCreated
+}
+
+// Validate checks the sort order, age filters and selector
+func (q IPQuery) Validate() error {
+	if q.SortBy != "" && q.SortBy != SortByCreated && q.SortBy != SortByLastScanned {
+		return fmt.Errorf("invalid sort order %q, expected %s or %s", q.SortBy, SortByCreated, SortByLastScanned)
+	}
+	if !q.ScannedBefore.IsZero() && !q.ScannedSince.IsZero() && !q.ScannedSince.Before(q.ScannedBefore) {
+		return fmt.Errorf("no scan time is both before %s and since %s",
+			q.ScannedBefore.UTC().Format(time.RFC3339), q.ScannedSince.UTC().Format(time.RFC3339))
+	}
+	return q.Selector.Validate()
+}
+
+// keeps reports whether an IP passes the age filters and selector
+func (q IPQuery) keeps(ip models.IP) bool {
+	if !q.Selector.Matches(ip) {
+		return false
+	}
+	if !q.ScannedBefore.IsZero() && !ip.LastScanned.Before(q.ScannedBefore) {
+		return false
+	}
+	if !q.ScannedSince.IsZero() && ip.LastScanned.Before(q.ScannedSince) {
+		return false
+	}
+	return true
+}
+
+// sortAttribute returns the attribute the query orders by
+func (q IPQuery) sortAttribute() string {
+	if q.sortBy() == SortByLastScanned {
+		return "LastScanned"
+	}
+	return "CreatedAt"
+}
+
+// sortTime returns the time an IP is ordered by
+func (q IPQuery) sortTime(ip models.IP) time.Time {
+	if q.sortBy() == SortByLastScanned {
+		return ip.LastScanned
+	}
+	return ip.CreatedAt
+}
+
+// Stores that page by value rather than by DynamoDB key keep the sort time
+// and address of the last IP read in the cursor
+
+func (q IPQuery) cursorKey(ip models.IP) map[string]string {
+	return map[string]string{
+		q.sortAttribute(): q.sortTime(ip).UTC().Format(time.RFC3339Nano),
+		"IPAddress":       ip.IPAddress,
+	}
+}
+
+func (q IPQuery) cursorPosition(cursor pageCursor) (time.Time, string, error) {
+	sortTime, err := time.Parse(time.RFC3339Nano, cursor.LastKey[q.sortAttribute()])
+	if err != nil || cursor.LastKey["IPAddress"] == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return sortTime, cursor.LastKey["IPAddress"], nil
+}
+
+func (q HistoryQuery) listing(kind string) string {
+	return fmt.Sprintf("%s|%s|%t", kind, q.IPAddress, q.OldestFirst)
+}
+
+// pageSize returns the page size to use for a requested limit
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
+
+// decodePageCursor reads the cursor of a listing. An empty token is the first
+// page and decodes to a cursor with no last key.
+func decodePageCursor(token string, listing string) (pageCursor, error) {
+	var cursor pageCursor
+	if token == "" {
+		return cursor, nil
+	}
+	if decodeToken(token, &cursor) != nil || cursor.Listing != listing || len(cursor.LastKey) == 0 {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// nextPageCursor returns the cursor of the page after the one ending at
+// lastKey, or "" when lastKey is nil
+func nextPageCursor(listing string, lastKey map[string]string, total int) (string, error) {
+	if len(lastKey) == 0 {
+		return "", nil
+	}
+	return encodeToken(pageCursor{Listing: listing, LastKey: lastKey, Total: total})
+}
+
+// queryPage reads one page of a query: up to limit items after the cursor's
+// last key, along with the key to resume after and the total count of the
+// query, which is counted on the first page and carried by later cursors.
+// The query is repeated as often as it takes to fill the page, as filters
+// and DynamoDB's 1 MB response limit can each cut a response short.
+func (s *DynamoDBStore) queryPage(ctx context.Context, input *dynamodb.QueryInput, listing string, limit int, token string) ([]map[string]types.AttributeValue, string, int, error) {
+	cursor, err := decodePageCursor(token, listing)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	total := cursor.Total
+	if token == "" {
+		if total, err = s.countQuery(ctx, input); err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	query := *input
+	if len(cursor.LastKey) > 0 {
+		query.ExclusiveStartKey = make(map[string]types.AttributeValue, len(cursor.LastKey))
+		for name, value := range cursor.LastKey {
+			query.ExclusiveStartKey[name] = &types.AttributeValueMemberS{Value: value}
+		}
+	}
+
+	var items []map[string]types.AttributeValue
+	for {
+		query.Limit = aws.Int32(int32(limit - len(items)))
+		result, err := s.DynamoDB.Query(ctx, &query)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		items = append(items, result.Items...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return items, "", total, nil
+		}
+		if len(items) >= limit {
+			lastKey := make(map[string]string, len(result.LastEvaluatedKey))
+			for name, value := range result.LastEvaluatedKey {
+				if s, ok := value.(*types.AttributeValueMemberS); ok {
+					lastKey[name] = s.Value
+				}
+			}
+			next, err := nextPageCursor(listing, lastKey, total)
+			return items, next, total, err
+		}
+		query.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// countQuery counts the items a query matches. Counting reads every item the
+// key condition selects, filtered or not, so the first page of a listing
+// costs as many read units as reading the whole query: for the inventory,
+// the whole Inventory partition of the index. Later pages reuse the count
+// kept in their cursor.
+func (s *DynamoDBStore) countQuery(ctx context.Context, input *dynamodb.QueryInput) (int, error) {
+	query := *input
+	query.Select = types.SelectCount
+	query.Limit = nil
+	query.ExclusiveStartKey = nil
+
+	total := 0
+	paginator := dynamodb.NewQueryPaginator(s.DynamoDB, &query)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += int(page.Count)
+	}
+	return total, nil
+}
+
+// BackfillInventory adds Inventory, and LastScanned when missing, to IPs
+// stored before the inventory indexes existed. Without them an IP is left
+// out of CreatedAtIndex and LastScannedIndex and so out of every listing. It
+// returns how many IPs it updated; it can be run again after an error, as
+// IPs already updated are skipped.
+func (s *DynamoDBStore) BackfillInventory(ctx context.Context) (int, error) {
+	paginator := dynamodb.NewScanPaginator(s.DynamoDB, &dynamodb.ScanInput{
+		TableName:            aws.String(s.Tables.IPs),
+		FilterExpression:     aws.String("attribute_not_exists(Inventory) OR attribute_not_exists(LastScanned)"),
+		ProjectionExpression: aws.String("IPAddress"),
+	})
+
+	updated := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return updated, err
+		}
+		for _, item := range page.Items {
+			_, err := s.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:           aws.String(s.Tables.IPs),
+				Key:                 map[string]types.AttributeValue{"IPAddress": item["IPAddress"]},
+				UpdateExpression:    aws.String("SET Inventory = :inventory, LastScanned = if_not_exists(LastScanned, :neverScanned)"),
+				ConditionExpression: aws.String("attribute_exists(IPAddress)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":inventory":    &types.AttributeValueMemberS{Value: inventoryPartition},
+					":neverScanned": &types.AttributeValueMemberS{Value: neverScanned},
+				},
+			})
+			var conditionFailed *types.ConditionalCheckFailedException
+			if errors.As(err, &conditionFailed) {
+				continue // Deleted since the scan read it
+			}
+			if err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,79 @@
+// pkg/database/pagination_test.go
+
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/local"
+)
+
+// TestBackfillInventory stores IPs the way they were written before the
+// inventory indexes existed and checks that the backfill lists them again
+func TestBackfillInventory(t *testing.T) {
+	ctx := context.Background()
+	tables := database.DefaultTables()
+	api, err := local.OpenStore(filepath.Join(t.TempDir(), "nexusscan.db"), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+	store := database.NewDynamoDBStore(api, tables)
+
+	if err := store.AddIP(ctx, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	legacy := []map[string]types.AttributeValue{
+		{
+			"IPAddress": &types.AttributeValueMemberS{Value: "10.0.0.2"},
+			"CreatedAt": &types.AttributeValueMemberS{Value: "2023-01-01T00:00:00Z"},
+		},
+		{
+			"IPAddress":   &types.AttributeValueMemberS{Value: "10.0.0.3"},
+			"CreatedAt":   &types.AttributeValueMemberS{Value: "2023-01-02T00:00:00Z"},
+			"LastScanned": &types.AttributeValueMemberS{Value: "2023-02-01T00:00:00Z"},
+		},
+	}
+	for _, item := range legacy {
+		if _, err := api.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tables.IPs), Item: item}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listed := func() string {
+		page, err := store.ListIPs(ctx, database.IPQuery{SortBy: database.SortByLastScanned, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ips []string
+		for _, ip := range page.IPs {
+			ips = append(ips, ip.IPAddress+"@"+ip.LastScanned.Format("2006-01-02"))
+		}
+		return fmt.Sprint(ips)
+	}
+	if got, want := listed(), "[10.0.0.1@0001-01-01]"; got != want {
+		t.Fatalf("IPs listed before the backfill = %s, want %s", got, want)
+	}
+
+	for run, want := range []int{2, 0} {
+		updated, err := store.BackfillInventory(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != want {
+			t.Errorf("backfill %d updated %d IPs, want %d", run+1, updated, want)
+		}
+	}
+
+	if got, want := listed(), "[10.0.0.1@0001-01-01 10.0.0.2@0001-01-01 10.0.0.3@2023-02-01]"; got != want {
+		t.Errorf("IPs listed after the backfill = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+// pkg/database/port_changes.go
+
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// portChangesFeed is the single FeedIndex partition every change is written
+// to, so the recent changes across all IPs can be read in time order
+const portChangesFeed = "changes"
+
+// portChangeRetention is how long change events are kept
+const portChangeRetention = 90 * 24 * time.Hour
+
+// StorePortChange saves a change event detected by a scan
+func (c *Client) StorePortChange(ctx context.Context, change *models.PortChange) error {
+	change.ChangeID = models.NewPortChangeID(change.DetectedAt, change.ScanID)
+	change.ExpirationTime = change.DetectedAt.Add(portChangeRetention).Unix()
+
+	item, err := attributevalue.MarshalMap(change)
+	if err != nil {
+		return err
+	}
+	item["Feed"] = &types.AttributeValueMemberS{Value: portChangesFeed}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.Tables.PortChanges),
+		Item:      item,
+	})
+	return err
+}
+
+// GetPortChanges retrieves the most recent change events for an IP, newest first
+func (c *Client) GetPortChanges(ctx context.Context, ipAddress string, limit int) ([]models.PortChange, error) {
+	if limit <= 0 {
+		limit = 10 // Default limit
+	}
+
+	result, err := c.DynamoDB.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(c.Tables.PortChanges),
+		KeyConditionExpression: aws.String("IPAddress = :ip"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ip": &types.AttributeValueMemberS{Value: ipAddress},
+		},
+		ScanIndexForward: aws.Bool(false), // Newest first
+		Limit:            aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []models.PortChange
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// GetRecentPortChanges retrieves the most recent change events across all
+// IPs, newest first, optionally only those detected at or after since
+func (c *Client) GetRecentPortChanges(ctx context.Context, limit int, since time.Time) ([]models.PortChange, error) {
+	if limit <= 0 {
+		limit = 50 // Default limit
+	}
+
+	keyCondition := "Feed = :feed"
+	values := map[string]types.AttributeValue{
+		":feed": &types.AttributeValueMemberS{Value: portChangesFeed},
+	}
+	if !since.IsZero() {
+		keyCondition += " AND ChangeID >= :since"
+		values[":since"] = &types.AttributeValueMemberS{Value: since.UTC().Format(time.RFC3339)}
+	}
+
+	result, err := c.DynamoDB.Query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(c.Tables.PortChanges),
+		IndexName:                 aws.String("FeedIndex"),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false), // Newest first
+		Limit:                     aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []models.PortChange
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// DeleteIPPortChanges deletes all change events for an IP (used when deleting an IP)
+func (c *Client) DeleteIPPortChanges(ctx context.Context, ipAddress string) error {
+	paginator := dynamodb.NewQueryPaginator(c.DynamoDB, &dynamodb.QueryInput{
+		TableName:              aws.String(c.Tables.PortChanges),
+		KeyConditionExpression: aws.String("IPAddress = :ip"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ip": &types.AttributeValueMemberS{Value: ipAddress},
+		},
+		ProjectionExpression: aws.String("IPAddress, ChangeID"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Process up to 25 items at a time (DynamoDB batch limit)
+		for i := 0; i < len(page.Items); i += 25 {
+			end := min(i+25, len(page.Items))
+
+			deleteRequests := make([]types.WriteRequest, 0, end-i)
+			for _, item := range page.Items[i:end] {
+				deleteRequests = append(deleteRequests, types.WriteRequest{
+					DeleteRequest: &types.DeleteRequest{
+						Key: map[string]types.AttributeValue{
+							"IPAddress": item["IPAddress"],
+							"ChangeID":  item["ChangeID"],
+						},
+					},
+				})
+			}
+
+			_, err := c.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{
+					c.Tables.PortChanges: deleteRequests,
+				},
+			})
+			if err != nil {
+				log.Printf("Error batch deleting port changes for IP %s: %v", ipAddress, err)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
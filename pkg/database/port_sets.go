@@ -0,0 +1,225 @@
+// pkg/database/port_sets.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Port set errors, distinguished so the API can map them to status codes
+var (
+	ErrPortSetNotFound = errors.New("port set not found")
+	ErrInvalidPortSet  = errors.New("invalid port set")
+	ErrPortSetExists   = errors.New("port set already exists")
+	ErrPortSetInUse    = errors.New("port set is used by schedules")
+)
+
+// CreatePortSet stores a new user-defined port set
+func (c *Client) CreatePortSet(ctx context.Context, name string, description string, spec string) (*models.PortSet, error) {
+	portSet, err := newPortSet(name, description, spec)
+	if err != nil {
+		return nil, err
+	}
+	portSet.CreatedAt = portSet.UpdatedAt
+
+	item, err := attributevalue.MarshalMap(portSet)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(c.Tables.PortSets),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#name)"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "Name",
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil, ErrPortSetExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return portSet, nil
+}
+
+// UpdatePortSet replaces the ports and description of an existing port set
+func (c *Client) UpdatePortSet(ctx context.Context, name string, description string, spec string) (*models.PortSet, error) {
+	portSet, err := newPortSet(name, description, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.Tables.PortSets),
+		Key: map[string]types.AttributeValue{
+			"Name": &types.AttributeValueMemberS{Value: name},
+		},
+		UpdateExpression:    aws.String("SET Description = :description, Ports = :ports, PortCount = :portCount, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("attribute_exists(#name)"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "Name",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":description": &types.AttributeValueMemberS{Value: portSet.Description},
+			":ports":       &types.AttributeValueMemberS{Value: portSet.Ports},
+			":portCount":   &types.AttributeValueMemberN{Value: formatInt(portSet.PortCount)},
+			":updatedAt":   &types.AttributeValueMemberS{Value: portSet.UpdatedAt.Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil, ErrPortSetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var updated models.PortSet
+	if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// GetPortSetByName retrieves a user-defined port set
+func (c *Client) GetPortSetByName(ctx context.Context, name string) (*models.PortSet, error) {
+	result, err := c.DynamoDB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.Tables.PortSets),
+		Key: map[string]types.AttributeValue{
+			"Name": &types.AttributeValueMemberS{Value: name},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, ErrPortSetNotFound
+	}
+
+	var portSet models.PortSet
+	if err := attributevalue.UnmarshalMap(result.Item, &portSet); err != nil {
+		return nil, err
+	}
+	return &portSet, nil
+}
+
+// ListPortSets retrieves all user-defined port sets
+func (c *Client) ListPortSets(ctx context.Context) ([]models.PortSet, error) {
+	var portSets []models.PortSet
+
+	paginator := dynamodb.NewScanPaginator(c.DynamoDB, &dynamodb.ScanInput{
+		TableName: aws.String(c.Tables.PortSets),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var pagePortSets []models.PortSet
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pagePortSets); err != nil {
+			return nil, err
+		}
+		portSets = append(portSets, pagePortSets...)
+	}
+
+	return portSets, nil
+}
+
+// DeletePortSet removes a user-defined port set. Port sets that schedules
+// still refer to cannot be deleted.
+func (c *Client) DeletePortSet(ctx context.Context, name string) error {
+	inUse, err := c.SchedulesUsePortSet(ctx, name)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrPortSetInUse
+	}
+
+	_, err = c.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.Tables.PortSets),
+		Key: map[string]types.AttributeValue{
+			"Name": &types.AttributeValueMemberS{Value: name},
+		},
+		ConditionExpression: aws.String("attribute_exists(#name)"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "Name",
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrPortSetNotFound
+	}
+	return err
+}
+
+// ValidatePortSet checks that name refers to previous_open, a built-in port
+// set or a stored user-defined port set. It is the single check used
+// wherever a portSet is accepted.
+func (c *Client) ValidatePortSet(ctx context.Context, name string) error {
+	if models.IsBuiltinPortSet(name) {
+		return nil
+	}
+
+	if _, err := c.GetPortSetByName(ctx, name); err != nil {
+		if errors.Is(err, ErrPortSetNotFound) {
+			return fmt.Errorf("%w %q: must be previous_open, top_100, custom_3500, full_65k or a defined port set",
+				ErrInvalidPortSet, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// ResolvePortSet returns the ports of a built-in or user-defined port set.
+// previous_open depends on the IP being scanned and is resolved by the caller.
+func (c *Client) ResolvePortSet(ctx context.Context, name string) ([]int, error) {
+	if ports := models.GetPortSet(name); len(ports) > 0 {
+		return ports, nil
+	}
+
+	portSet, err := c.GetPortSetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return models.ParsePortSpec(portSet.Ports)
+}
+
+// newPortSet validates a port set definition and counts its ports
+func newPortSet(name string, description string, spec string) (*models.PortSet, error) {
+	if err := models.ValidatePortSetName(name); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPortSet, err)
+	}
+
+	ports, err := models.ParsePortSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPortSet, err)
+	}
+
+	return &models.PortSet{
+		Name:        name,
+		Description: description,
+		Ports:       spec,
+		PortCount:   len(ports),
+		UpdatedAt:   time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,1026 @@
+// pkg/database/postgres.go
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PostgresStore is a Store on PostgreSQL. Each table has a column for its
+// key and for whatever it is searched by; results and enrichment keep the
+// rest of the record as JSON. Tables take the names in Tables, so stages
+// with different prefixes can share a database.
+type PostgresStore struct {
+	db *sql.DB
+
+	// Quoted table names
+	ips        string
+	schedules  string
+	results    string
+	openPorts  string
+	enrichment string
+}
+
+// OpenPostgresStore connects to the database at url and creates any tables
+// that do not exist yet
+func OpenPostgresStore(ctx context.Context, url string, tables Tables) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PostgresStore{
+		db:         db,
+		ips:        pq.QuoteIdentifier(tables.IPs),
+		schedules:  pq.QuoteIdentifier(tables.Schedules),
+		results:    pq.QuoteIdentifier(tables.Results),
+		openPorts:  pq.QuoteIdentifier(tables.OpenPorts),
+		enrichment: pq.QuoteIdentifier(tables.Enrichment),
+	}
+	if err := p.createTables(ctx, tables); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating tables: %v", err)
+	}
+	return p, nil
+}
+
+// Close closes the connection pool
+func (p *PostgresStore) Close() error {
+	return p.db.Close()
+}
+
+func (p *PostgresStore) createTables(ctx context.Context, tables Tables) error {
+	index := func(table string, name string) string {
+		return pq.QuoteIdentifier(table + "-" + name)
+	}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + p.ips + ` (
+			ip_address   text PRIMARY KEY,
+			created_at   timestamptz NOT NULL,
+			last_scanned timestamptz,
+			network      text NOT NULL DEFAULT '',
+			hostname     text NOT NULL DEFAULT '',
+			tags         jsonb NOT NULL DEFAULT '{}',
+			description  text NOT NULL DEFAULT '',
+			owner        text NOT NULL DEFAULT '',
+			asset_group  text NOT NULL DEFAULT ''
+		)`,
+		// Asset metadata was added after the IPs table
+		`ALTER TABLE ` + p.ips + ` ADD COLUMN IF NOT EXISTS tags jsonb NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS owner text NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS asset_group text NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS ` + index(tables.IPs, "network") + ` ON ` + p.ips + ` (network) WHERE network <> ''`,
+		`CREATE INDEX IF NOT EXISTS ` + index(tables.IPs, "created") + ` ON ` + p.ips + ` (created_at, ip_address)`,
+		`CREATE INDEX IF NOT EXISTS ` + index(tables.IPs, "last-scanned") + ` ON ` + p.ips + ` (` + lastScannedOrder + `, ip_address)`,
+		`CREATE INDEX IF NOT EXISTS ` + index(tables.IPs, "tags") + ` ON ` + p.ips + ` USING gin (tags)`,
+
+		`CREATE TABLE IF NOT EXISTS ` + p.schedules + ` (
+			schedule_id   text PRIMARY KEY,
+			ip_address    text NOT NULL,
+			schedule_type text NOT NULL,
+			timing        jsonb NOT NULL,
+			port_set      text NOT NULL,
+			profile       text NOT NULL DEFAULT '',
+			enabled       boolean NOT NULL,
+			created_at    timestamptz NOT NULL,
+			updated_at    timestamptz NOT NULL,
+			last_run      timestamptz,
+			next_run      timestamptz NOT NULL
+		)`,
+		`ALTER TABLE ` + p.schedules + ` ADD COLUMN IF NOT EXISTS selector jsonb`,
+		`CREATE INDEX IF NOT EXISTS ` + index(tables.Schedules, "ip") + ` ON ` + p.schedules + ` (ip_address)`,
+		`CREATE INDEX IF NOT EXISTS ` + index(tables.Schedules, "next-run") + ` ON ` + p.schedules + ` (next_run, schedule_id) WHERE enabled`,
+
+		`CREATE TABLE IF NOT EXISTS ` + p.results + ` (
+			ip_address     text NOT NULL,
+			scan_timestamp text NOT NULL,
+			expires_at     timestamptz NOT NULL,
+			result         jsonb NOT NULL,
+			PRIMARY KEY (ip_address, scan_timestamp)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS ` + p.openPorts + ` (
+			ip_address   text PRIMARY KEY,
+			tcp_ports    integer[] NOT NULL DEFAULT '{}',
+			udp_ports    integer[] NOT NULL DEFAULT '{}',
+			last_updated timestamptz NOT NULL
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS ` + p.enrichment + ` (
+			ip_address text NOT NULL,
+			timestamp  text NOT NULL,
+			scan_id    text NOT NULL,
+			expires_at timestamptz NOT NULL,
+			enrichment jsonb NOT NULL,
+			PRIMARY KEY (ip_address, timestamp)
+		)`,
+	}
+
+	for _, statement := range statements {
+		if _, err := p.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddIP adds a new IP address
+func (p *PostgresStore) AddIP(ctx context.Context, ipAddress string) error {
+	return p.AddIPFromNetwork(ctx, ipAddress, "", "", models.AssetMetadata{})
+}
+
+// AddIPFromNetwork adds an IP address with its metadata, recording the
+// network or hostname it was expanded from. An IP that is already in the
+// inventory keeps when it was added and last scanned; its metadata is merged
+// with the given metadata, and its network and hostname are only filled in
+// if unset.
+func (p *PostgresStore) AddIPFromNetwork(ctx context.Context, ipAddress string, network string, hostname string, metadata models.AssetMetadata) error {
+	tags, err := tagsJSON(metadata.Tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO `+p.ips+` (ip_address, created_at, last_scanned, network, hostname, tags, description, owner, asset_group)
+		VALUES ($1, $2, NULL, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (ip_address) DO NOTHING`,
+		ipAddress, storeTime(), network, hostname, tags, metadata.Description, metadata.Owner, metadata.Group)
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 1 {
+		return tx.Commit()
+	}
+
+	// Merge into the IP already there, locking it until the merge is written
+	var existing models.AssetMetadata
+	var existingTags []byte
+	err = tx.QueryRowContext(ctx, `
+		SELECT tags, description, owner, asset_group FROM `+p.ips+` WHERE ip_address = $1 FOR UPDATE`, ipAddress).
+		Scan(&existingTags, &existing.Description, &existing.Owner, &existing.Group)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(existingTags, &existing.Tags); err != nil {
+		return err
+	}
+
+	merged := existing.Merge(metadata)
+	if err := merged.Validate(); err != nil {
+		return fmt.Errorf("merging metadata of IP %s: %w", ipAddress, err)
+	}
+	if tags, err = tagsJSON(merged.Tags); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE `+p.ips+` SET tags = $2, description = $3, owner = $4, asset_group = $5,
+			network = CASE WHEN network = '' THEN $6 ELSE network END,
+			hostname = CASE WHEN hostname = '' THEN $7 ELSE hostname END
+		WHERE ip_address = $1`,
+		ipAddress, tags, merged.Description, merged.Owner, merged.Group, network, hostname)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetIP returns one IP of the inventory
+func (p *PostgresStore) GetIP(ctx context.Context, ipAddress string) (*models.IP, error) {
+	ips, err := p.queryIPs(ctx, `SELECT `+ipColumns+` FROM `+p.ips+` WHERE ip_address = $1`, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, ErrIPNotFound
+	}
+	return &ips[0], nil
+}
+
+// SetIPMetadata replaces the metadata of an IP
+func (p *PostgresStore) SetIPMetadata(ctx context.Context, ipAddress string, metadata models.AssetMetadata) error {
+	tags, err := tagsJSON(metadata.Tags)
+	if err != nil {
+		return err
+	}
+	result, err := p.db.ExecContext(ctx, `
+		UPDATE `+p.ips+` SET tags = $2, description = $3, owner = $4, asset_group = $5 WHERE ip_address = $1`,
+		ipAddress, tags, metadata.Description, metadata.Owner, metadata.Group)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrIPNotFound
+	}
+	return nil
+}
+
+// tagsJSON encodes tags for the tags column, as an empty object when there
+// are none
+func tagsJSON(tags map[string]string) ([]byte, error) {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	return json.Marshal(tags)
+}
+
+// ipColumns are the columns queryIPs reads
+const ipColumns = `ip_address, created_at, last_scanned, network, hostname, tags, description, owner, asset_group`
+
+// lastScannedOrder orders IPs by LastScanned, with IPs never scanned first
+const lastScannedOrder = `COALESCE(last_scanned, '0001-01-01 00:00:00+00'::timestamptz)`
+
+// ListIPs returns a page of the inventory, reading one IP past the page to
+// tell whether another follows
+func (p *PostgresStore) ListIPs(ctx context.Context, query IPQuery) (IPPage, error) {
+	if err := query.Validate(); err != nil {
+		return IPPage{}, err
+	}
+	listing := query.listing()
+	cursor, err := decodePageCursor(query.Cursor, listing)
+	if err != nil {
+		return IPPage{}, err
+	}
+
+	order := "created_at"
+	if query.sortBy() == SortByLastScanned {
+		order = lastScannedOrder
+	}
+
+	var conditions []string
+	var args []interface{}
+	if !query.ScannedBefore.IsZero() {
+		args = append(args, query.ScannedBefore)
+		conditions = append(conditions, fmt.Sprintf("%s < $%d", lastScannedOrder, len(args)))
+	}
+	if !query.ScannedSince.IsZero() {
+		args = append(args, query.ScannedSince)
+		conditions = append(conditions, fmt.Sprintf("last_scanned >= $%d", len(args)))
+	}
+	if query.Selector.Group != "" {
+		args = append(args, query.Selector.Group)
+		conditions = append(conditions, fmt.Sprintf("asset_group = $%d", len(args)))
+	}
+	if query.Selector.Owner != "" {
+		args = append(args, query.Selector.Owner)
+		conditions = append(conditions, fmt.Sprintf("owner = $%d", len(args)))
+	}
+	// Tags with a value are matched by containment, tags without one by key
+	tagged := map[string]string{}
+	for key, value := range query.Selector.Tags {
+		if value == "" {
+			args = append(args, key)
+			conditions = append(conditions, fmt.Sprintf("tags ? $%d", len(args)))
+		} else {
+			tagged[key] = value
+		}
+	}
+	if len(tagged) > 0 {
+		contained, err := json.Marshal(tagged)
+		if err != nil {
+			return IPPage{}, err
+		}
+		args = append(args, contained)
+		conditions = append(conditions, fmt.Sprintf("tags @> $%d::jsonb", len(args)))
+	}
+
+	total := cursor.Total
+	if query.Cursor == "" {
+		err := p.db.QueryRowContext(ctx, `SELECT count(*) FROM `+p.ips+whereClause(conditions), args...).Scan(&total)
+		if err != nil {
+			return IPPage{}, err
+		}
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if len(cursor.LastKey) > 0 {
+		lastTime, lastIP, err := query.cursorPosition(cursor)
+		if err != nil {
+			return IPPage{}, err
+		}
+		args = append(args, lastTime, lastIP)
+		conditions = append(conditions, fmt.Sprintf("(%s, ip_address) %s ($%d, $%d)", order, comparison, len(args)-1, len(args)))
+	}
+
+	limit := pageSize(query.Limit)
+	args = append(args, limit+1)
+	ips, err := p.queryIPs(ctx, `
+		SELECT `+ipColumns+` FROM `+p.ips+whereClause(conditions)+`
+		ORDER BY `+order+` `+direction+`, ip_address `+direction+fmt.Sprintf(` LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return IPPage{}, err
+	}
+
+	page := IPPage{IPs: ips, Total: total}
+	if len(ips) > limit {
+		page.IPs = ips[:limit]
+		page.NextCursor, err = nextPageCursor(listing, query.cursorKey(page.IPs[limit-1]), total)
+	}
+	return page, err
+}
+
+// whereClause joins conditions into a WHERE clause, empty when there are none
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// GetIPsByNetwork returns every IP that was added from the given network
+func (p *PostgresStore) GetIPsByNetwork(ctx context.Context, network string) ([]models.IP, error) {
+	return p.queryIPs(ctx, `
+		SELECT `+ipColumns+` FROM `+p.ips+`
+		WHERE network = $1 ORDER BY ip_address`, network)
+}
+
+func (p *PostgresStore) queryIPs(ctx context.Context, query string, args ...interface{}) ([]models.IP, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ips := []models.IP{}
+	for rows.Next() {
+		var ip models.IP
+		var lastScanned sql.NullTime
+		var tags []byte
+		if err := rows.Scan(&ip.IPAddress, &ip.CreatedAt, &lastScanned, &ip.Network, &ip.Hostname,
+			&tags, &ip.Description, &ip.Owner, &ip.Group); err != nil {
+			return nil, err
+		}
+		ip.LastScanned = lastScanned.Time
+		if err := json.Unmarshal(tags, &ip.Tags); err != nil {
+			return nil, err
+		}
+		if len(ip.Tags) == 0 {
+			ip.Tags = nil
+		}
+		ips = append(ips, ip)
+	}
+	return ips, rows.Err()
+}
+
+// DeleteIP removes an IP along with its schedules, open ports, results and
+// enrichment data
+func (p *PostgresStore) DeleteIP(ctx context.Context, ipAddress string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{p.ips, p.schedules, p.openPorts, p.results, p.enrichment} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE ip_address = $1`, ipAddress); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AddSchedule adds a scan schedule for an IP
+func (p *PostgresStore) AddSchedule(ctx context.Context, ipAddress string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
+	return p.addSchedule(ctx, ipAddress, nil, scheduleType, timing, portSet, profile, enabled)
+}
+
+// AddSelectorSchedule adds a scan schedule for the IPs a selector matches.
+// Its ip_address is empty.
+func (p *PostgresStore) AddSelectorSchedule(ctx context.Context, selector models.AssetSelector, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
+	selectorJSON, err := json.Marshal(selector)
+	if err != nil {
+		return "", err
+	}
+	return p.addSchedule(ctx, "", selectorJSON, scheduleType, timing, portSet, profile, enabled)
+}
+
+func (p *PostgresStore) addSchedule(ctx context.Context, ipAddress string, selectorJSON []byte, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error) {
+	created := storeTime()
+	nextRun, err := timing.ForScheduleType(scheduleType).Next(created)
+	if err != nil {
+		return "", err
+	}
+	timingJSON, err := json.Marshal(timing)
+	if err != nil {
+		return "", err
+	}
+
+	scheduleID := uuid.New().String()
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO `+p.schedules+` (schedule_id, ip_address, selector, schedule_type, timing, port_set, profile, enabled, created_at, updated_at, next_run)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $10)`,
+		scheduleID, ipAddress, selectorJSON, scheduleType, timingJSON, portSet, profile, enabled, created, nextRun)
+	if err != nil {
+		return "", err
+	}
+	return scheduleID, nil
+}
+
+// UpdateSchedule replaces the type, timing, port set, profile and status of a schedule
+func (p *PostgresStore) UpdateSchedule(ctx context.Context, scheduleID string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) error {
+	updated := storeTime()
+	nextRun, err := timing.ForScheduleType(scheduleType).Next(updated)
+	if err != nil {
+		return err
+	}
+	timingJSON, err := json.Marshal(timing)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.db.ExecContext(ctx, `
+		UPDATE `+p.schedules+`
+		SET schedule_type = $2, timing = $3, port_set = $4, profile = $5, enabled = $6, updated_at = $7, next_run = $8
+		WHERE schedule_id = $1`,
+		scheduleID, scheduleType, timingJSON, portSet, profile, enabled, updated, nextRun)
+	return scheduleUpdated(result, err)
+}
+
+// UpdateScheduleStatus enables or disables a scan schedule
+func (p *PostgresStore) UpdateScheduleStatus(ctx context.Context, scheduleID string, enabled bool) error {
+	result, err := p.db.ExecContext(ctx, `
+		UPDATE `+p.schedules+` SET enabled = $2, updated_at = $3 WHERE schedule_id = $1`,
+		scheduleID, enabled, storeTime())
+	return scheduleUpdated(result, err)
+}
+
+// scheduleUpdated turns an update that matched no schedule into ErrScheduleNotFound
+func scheduleUpdated(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// DeleteSchedule removes a scan schedule
+func (p *PostgresStore) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM `+p.schedules+` WHERE schedule_id = $1`, scheduleID)
+	return err
+}
+
+// DeleteIPSchedules deletes all schedules for an IP
+func (p *PostgresStore) DeleteIPSchedules(ctx context.Context, ipAddress string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM `+p.schedules+` WHERE ip_address = $1`, ipAddress)
+	return err
+}
+
+const scheduleColumns = `schedule_id, ip_address, selector, schedule_type, timing, port_set, profile, enabled, created_at, updated_at, last_run, next_run`
+
+// GetSchedulesForIP returns the schedules of an IP, oldest first
+func (p *PostgresStore) GetSchedulesForIP(ctx context.Context, ipAddress string) ([]models.Schedule, error) {
+	return p.querySchedules(ctx, `
+		SELECT `+scheduleColumns+` FROM `+p.schedules+`
+		WHERE ip_address = $1 ORDER BY created_at, schedule_id`, ipAddress)
+}
+
+// GetSelectorSchedules returns the schedules of selectors, oldest first
+func (p *PostgresStore) GetSelectorSchedules(ctx context.Context) ([]models.Schedule, error) {
+	return p.querySchedules(ctx, `
+		SELECT `+scheduleColumns+` FROM `+p.schedules+`
+		WHERE selector IS NOT NULL ORDER BY created_at, schedule_id`)
+}
+
+// GetScheduleByID returns a schedule by its ID
+func (p *PostgresStore) GetScheduleByID(ctx context.Context, scheduleID string) (*models.Schedule, error) {
+	schedules, err := p.querySchedules(ctx, `
+		SELECT `+scheduleColumns+` FROM `+p.schedules+` WHERE schedule_id = $1`, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, ErrScheduleNotFound
+	}
+	return &schedules[0], nil
+}
+
+func (p *PostgresStore) querySchedules(ctx context.Context, query string, args ...interface{}) ([]models.Schedule, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []models.Schedule
+	for rows.Next() {
+		var schedule models.Schedule
+		var selector, timing []byte
+		var lastRun sql.NullTime
+		err := rows.Scan(&schedule.ScheduleID, &schedule.IPAddress, &selector, &schedule.ScheduleType, &timing,
+			&schedule.PortSet, &schedule.Profile, &schedule.Enabled,
+			&schedule.CreatedAt, &schedule.UpdatedAt, &lastRun, &schedule.NextRun)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(timing, &schedule.ScheduleTiming); err != nil {
+			return nil, fmt.Errorf("error reading timing of schedule %s: %v", schedule.ScheduleID, err)
+		}
+		if selector != nil {
+			schedule.Selector = &models.AssetSelector{}
+			if err := json.Unmarshal(selector, schedule.Selector); err != nil {
+				return nil, fmt.Errorf("error reading selector of schedule %s: %v", schedule.ScheduleID, err)
+			}
+		}
+		schedule.LastRun = lastRun.Time
+		schedules = append(schedules, readSchedule(schedule))
+	}
+	return schedules, rows.Err()
+}
+
+// GetDueSchedules returns one page of enabled schedules whose NextRun has
+// passed, in NextRun order. Schedules due outside their scan windows or on a
+// blackout date are deferred instead of returned.
+func (p *PostgresStore) GetDueSchedules(ctx context.Context, now time.Time, scheduleType string, pageSize int, token string) ([]models.ScheduleScan, string, error) {
+	cursor, err := decodeDispatchCursor(token)
+	if err != nil {
+		return nil, "", err
+	}
+	after, err := dueScheduleAfter(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	query := `SELECT ` + scheduleColumns + ` FROM ` + p.schedules + `
+		WHERE enabled AND next_run <= $1 AND ($2 = '' OR schedule_type = $2)`
+	args := []interface{}{now, scheduleType, pageSize + 1}
+	if after != nil {
+		query += ` AND (next_run, schedule_id) > ($4, $5)`
+		args = append(args, after.NextRun, after.ScheduleID)
+	}
+	query += ` ORDER BY next_run, schedule_id LIMIT $3`
+
+	due, err := p.querySchedules(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	more := len(due) > pageSize
+	if more {
+		due = due[:pageSize]
+	}
+
+	var scans []models.ScheduleScan
+	for _, schedule := range due {
+		scan := scheduleScan(schedule)
+		if !scan.Allows(now) {
+			if err := p.deferSchedule(ctx, scan, now); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		scans = append(scans, scan)
+	}
+
+	if !more {
+		return scans, "", nil
+	}
+	next, err := encodeDispatchCursor(dueScheduleCursor(due[len(due)-1]))
+	if err != nil {
+		return nil, "", err
+	}
+	return scans, next, nil
+}
+
+// deferSchedule moves the NextRun of a schedule that is due at a time its
+// windows or blackout dates do not allow
+func (p *PostgresStore) deferSchedule(ctx context.Context, scan models.ScheduleScan, now time.Time) error {
+	nextRun, err := scan.Next(now)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `UPDATE `+p.schedules+` SET next_run = $2 WHERE schedule_id = $1`, scan.ScheduleID, nextRun)
+	return err
+}
+
+// ClaimScheduleRun records that a due schedule is being run and moves its
+// NextRun on, unless another dispatcher claimed the run first
+func (p *PostgresStore) ClaimScheduleRun(ctx context.Context, scan models.ScheduleScan, now time.Time) (bool, error) {
+	nextRun, err := scan.Next(now)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := p.db.ExecContext(ctx, `
+		UPDATE `+p.schedules+` SET last_run = $3, next_run = $4, updated_at = $3
+		WHERE schedule_id = $1 AND next_run = $2`,
+		scan.ScheduleID, scan.NextRun, now, nextRun)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseScheduleRun puts a claimed run back so the next dispatch pass
+// retries it
+func (p *PostgresStore) ReleaseScheduleRun(ctx context.Context, scan models.ScheduleScan) error {
+	result, err := p.db.ExecContext(ctx, `UPDATE `+p.schedules+` SET next_run = $2 WHERE schedule_id = $1`, scan.ScheduleID, scan.NextRun)
+	if err := scheduleUpdated(result, err); err != nil {
+		return fmt.Errorf("error releasing run of schedule %s: %w", scan.ScheduleID, err)
+	}
+	return nil
+}
+
+// SchedulesUsePortSet reports whether any schedule scans with the named port set
+func (p *PostgresStore) SchedulesUsePortSet(ctx context.Context, portSet string) (bool, error) {
+	return p.exists(ctx, `SELECT EXISTS (SELECT 1 FROM `+p.schedules+` WHERE port_set = $1)`, portSet)
+}
+
+// SchedulesUseProfile reports whether any schedule scans with the named profile
+func (p *PostgresStore) SchedulesUseProfile(ctx context.Context, profile string) (bool, error) {
+	return p.exists(ctx, `SELECT EXISTS (SELECT 1 FROM `+p.schedules+` WHERE profile = $1)`, profile)
+}
+
+func (p *PostgresStore) exists(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	var exists bool
+	err := p.db.QueryRowContext(ctx, query, args...).Scan(&exists)
+	return exists, err
+}
+
+// StoreScanResult saves the result of one scan batch and updates the IP's
+// LastScanned time
+func (p *PostgresStore) StoreScanResult(ctx context.Context, ipAddress string, scanID string, protocol string, profile string, openPorts []models.Port, scanDuration time.Duration, portsScanned int, stateCounts models.PortStateCounts, watchedPorts []models.Port) error {
+	scanned := storeTime()
+	err := p.putResult(ctx, models.ScanResult{
+		IPAddress:      ipAddress,
+		ScanTimestamp:  resultTimestamp(time.Now()),
+		ScanID:         scanID,
+		OpenPorts:      openPorts,
+		ScanDuration:   int(scanDuration.Milliseconds()),
+		PortsScanned:   portsScanned,
+		Protocol:       models.NormalizeProtocol(protocol),
+		StateCounts:    &stateCounts,
+		WatchedPorts:   watchedPorts,
+		Profile:        profile,
+		ExpirationTime: scanned.Add(resultRetention).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, `UPDATE `+p.ips+` SET last_scanned = $2 WHERE ip_address = $1`, ipAddress, scanned)
+	return err
+}
+
+// StoreFinalScanSummary saves the final summary of a finished scan
+func (p *PostgresStore) StoreFinalScanSummary(ctx context.Context, ipAddress string, scanID string, protocol string, profile string, scanStatus string, openPorts []models.Port, portsProbed string, scanDuration time.Duration, portsScanned int, stateCounts models.PortStateCounts, useHistoricalPorts bool) error {
+	finalOpenPorts := finalSummaryPorts(ctx, p, ipAddress, protocol, openPorts, useHistoricalPorts)
+	return p.putResult(ctx, newFinalSummary(ipAddress, scanID, protocol, profile, scanStatus, finalOpenPorts, portsProbed, scanDuration, portsScanned, stateCounts, time.Now()))
+}
+
+// putResult stores a scan result, clearing out the IP's expired results.
+// Results never replace one another: while its key is taken, the result is
+// moved on by a nanosecond.
+func (p *PostgresStore) putResult(ctx context.Context, result models.ScanResult) error {
+	for {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		inserted, err := p.db.ExecContext(ctx, `
+			INSERT INTO `+p.results+` (ip_address, scan_timestamp, expires_at, result) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (ip_address, scan_timestamp) DO NOTHING`,
+			result.IPAddress, result.ScanTimestamp, time.Unix(result.ExpirationTime, 0), data)
+		if err != nil {
+			return err
+		}
+		rows, err := inserted.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows > 0 {
+			break
+		}
+
+		stored, err := time.Parse(resultTimestampLayout, result.ScanTimestamp)
+		if err != nil {
+			return err
+		}
+		result.ScanTimestamp = resultTimestamp(stored.Add(time.Nanosecond))
+	}
+
+	_, err := p.db.ExecContext(ctx, `DELETE FROM `+p.results+` WHERE ip_address = $1 AND expires_at < now()`, result.IPAddress)
+	return err
+}
+
+// liveResults returns the unexpired results of an IP, newest first
+func (p *PostgresStore) liveResults(ctx context.Context, ipAddress string) ([]models.ScanResult, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT result FROM `+p.results+`
+		WHERE ip_address = $1 AND expires_at >= now() ORDER BY scan_timestamp DESC`, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.ScanResult
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var result models.ScanResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// ListScanResults returns a page of the final summaries of an IP's scans
+func (p *PostgresStore) ListScanResults(ctx context.Context, query HistoryQuery) (ScanResultPage, error) {
+	listing := query.listing("results")
+	rows, next, total, err := p.historyPage(ctx, p.results, "result", "scan_timestamp", "ScanTimestamp",
+		`result @> '{"isFinalSummary": true}'`, query, listing)
+	if err != nil {
+		return ScanResultPage{}, err
+	}
+
+	page := ScanResultPage{Results: make([]models.ScanResult, len(rows)), NextCursor: next, Total: total}
+	for i, data := range rows {
+		if err := json.Unmarshal(data, &page.Results[i]); err != nil {
+			return ScanResultPage{}, err
+		}
+	}
+	return page, nil
+}
+
+// historyPage reads the JSON column of one page of an IP's unexpired rows in
+// a results or enrichment table, ordered by the timestamp column, which the
+// cursor keeps under attribute. filter, if set, further limits the rows.
+func (p *PostgresStore) historyPage(ctx context.Context, table string, column string, timestamp string, attribute string, filter string, query HistoryQuery, listing string) ([][]byte, string, int, error) {
+	cursor, err := decodePageCursor(query.Cursor, listing)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	conditions := []string{"ip_address = $1", "expires_at >= now()"}
+	if filter != "" {
+		conditions = append(conditions, filter)
+	}
+	args := []interface{}{query.IPAddress}
+
+	total := cursor.Total
+	if query.Cursor == "" {
+		err := p.db.QueryRowContext(ctx, `SELECT count(*) FROM `+table+whereClause(conditions), args...).Scan(&total)
+		if err != nil {
+			return nil, "", 0, err
+		}
+	}
+
+	direction, comparison := "DESC", "<"
+	if query.OldestFirst {
+		direction, comparison = "ASC", ">"
+	}
+	if len(cursor.LastKey) > 0 {
+		last := cursor.LastKey[attribute]
+		if last == "" {
+			return nil, "", 0, ErrInvalidCursor
+		}
+		args = append(args, last)
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d", timestamp, comparison, len(args)))
+	}
+
+	limit := pageSize(query.Limit)
+	args = append(args, limit+1)
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT `+timestamp+`, `+column+` FROM `+table+whereClause(conditions)+`
+		ORDER BY `+timestamp+` `+direction+fmt.Sprintf(` LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer rows.Close()
+
+	var timestamps []string
+	items := [][]byte{}
+	for rows.Next() {
+		var stamp string
+		var data []byte
+		if err := rows.Scan(&stamp, &data); err != nil {
+			return nil, "", 0, err
+		}
+		timestamps = append(timestamps, stamp)
+		items = append(items, data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", 0, err
+	}
+
+	if len(items) <= limit {
+		return items, "", total, nil
+	}
+	next, err := nextPageCursor(listing, map[string]string{attribute: timestamps[limit-1]}, total)
+	return items[:limit], next, total, err
+}
+
+// GetLastCompletedSummary returns the final summary of the most recent
+// completed scan of an IP for a protocol, skipping the scan with
+// excludeScanID, or nil when there is none
+func (p *PostgresStore) GetLastCompletedSummary(ctx context.Context, ipAddress string, protocol string, excludeScanID string) (*models.ScanResult, error) {
+	results, err := p.liveResults(ctx, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol = models.NormalizeProtocol(protocol)
+	for i := range results {
+		if isCompletedSummary(results[i]) && results[i].ScanID != excludeScanID && models.NormalizeProtocol(results[i].Protocol) == protocol {
+			return &results[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// openPortsColumn returns the column holding the open ports of a protocol
+func openPortsColumn(protocol string) string {
+	if models.NormalizeProtocol(protocol) == models.ProtocolUDP {
+		return "udp_ports"
+	}
+	return "tcp_ports"
+}
+
+// GetOpenPorts returns the open TCP ports of an IP
+func (p *PostgresStore) GetOpenPorts(ctx context.Context, ipAddress string) ([]int, error) {
+	return p.GetOpenPortsByProtocol(ctx, ipAddress, models.ProtocolTCP)
+}
+
+// GetOpenPortsByProtocol returns the open ports of an IP for a protocol
+func (p *PostgresStore) GetOpenPortsByProtocol(ctx context.Context, ipAddress string, protocol string) ([]int, error) {
+	var ports pq.Int64Array
+	err := p.db.QueryRowContext(ctx, `SELECT `+openPortsColumn(protocol)+` FROM `+p.openPorts+` WHERE ip_address = $1`, ipAddress).Scan(&ports)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []int{}, nil // No open ports found
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	openPorts := make([]int, 0, len(ports))
+	for _, port := range ports {
+		openPorts = append(openPorts, int(port))
+	}
+	return openPorts, nil
+}
+
+// StoreOpenPorts saves open TCP ports for an IP
+func (p *PostgresStore) StoreOpenPorts(ctx context.Context, ipAddress string, openPorts []int, replaceExisting bool) error {
+	return p.StoreOpenPortsByProtocol(ctx, ipAddress, models.ProtocolTCP, openPorts, replaceExisting)
+}
+
+// StoreOpenPortsByProtocol saves open ports for an IP and protocol, merging
+// them with the ports already known unless replaceExisting is set. The
+// other protocol's ports are left alone.
+func (p *PostgresStore) StoreOpenPortsByProtocol(ctx context.Context, ipAddress string, protocol string, openPorts []int, replaceExisting bool) error {
+	portsToStore := openPorts
+	if !replaceExisting {
+		existingPorts, err := p.GetOpenPortsByProtocol(ctx, ipAddress, protocol)
+		if err != nil {
+			return err
+		}
+		portsToStore = mergeOpenPorts(existingPorts, openPorts)
+	}
+
+	ports := make(pq.Int64Array, 0, len(portsToStore))
+	for _, port := range portsToStore {
+		ports = append(ports, int64(port))
+	}
+
+	column := openPortsColumn(protocol)
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO `+p.openPorts+` (ip_address, `+column+`, last_updated) VALUES ($1, $2, $3)
+		ON CONFLICT (ip_address) DO UPDATE SET `+column+` = EXCLUDED.`+column+`, last_updated = EXCLUDED.last_updated`,
+		ipAddress, ports, storeTime())
+	return err
+}
+
+// StoreEnrichmentResult saves the enrichment of one scan, clearing out the
+// IP's expired enrichment results
+func (p *PostgresStore) StoreEnrichmentResult(ctx context.Context, enrichment *HttpxEnrichment) error {
+	prepareEnrichment(enrichment, time.Now())
+
+	data, err := json.Marshal(enrichment)
+	if err != nil {
+		return fmt.Errorf("error marshaling enrichment result: %v", err)
+	}
+
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO `+p.enrichment+` (ip_address, timestamp, scan_id, expires_at, enrichment) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (ip_address, timestamp) DO UPDATE
+		SET scan_id = EXCLUDED.scan_id, expires_at = EXCLUDED.expires_at, enrichment = EXCLUDED.enrichment`,
+		enrichment.IPAddress, enrichment.Timestamp, enrichment.ScanID, time.Unix(enrichment.ExpirationTime, 0), data)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, `DELETE FROM `+p.enrichment+` WHERE ip_address = $1 AND expires_at < now()`, enrichment.IPAddress)
+	return err
+}
+
+func (p *PostgresStore) queryEnrichments(ctx context.Context, query string, args ...interface{}) ([]HttpxEnrichment, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying enrichment results: %v", err)
+	}
+	defer rows.Close()
+
+	var enrichments []HttpxEnrichment
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var enrichment HttpxEnrichment
+		if err := json.Unmarshal(data, &enrichment); err != nil {
+			return nil, fmt.Errorf("error unmarshaling enrichment results: %v", err)
+		}
+		enrichments = append(enrichments, enrichment)
+	}
+	return enrichments, rows.Err()
+}
+
+// ListEnrichmentResults returns a page of the enrichment runs of an IP
+func (p *PostgresStore) ListEnrichmentResults(ctx context.Context, query HistoryQuery) (EnrichmentPage, error) {
+	listing := query.listing("enrichment")
+	rows, next, total, err := p.historyPage(ctx, p.enrichment, "enrichment", "timestamp", "Timestamp", "", query, listing)
+	if err != nil {
+		return EnrichmentPage{}, fmt.Errorf("error querying enrichment results: %w", err)
+	}
+
+	page := EnrichmentPage{Results: make([]HttpxEnrichment, len(rows)), NextCursor: next, Total: total}
+	for i, data := range rows {
+		if err := json.Unmarshal(data, &page.Results[i]); err != nil {
+			return EnrichmentPage{}, fmt.Errorf("error unmarshaling enrichment results: %v", err)
+		}
+	}
+	return page, nil
+}
+
+// GetEnrichmentResultByScan returns the enrichment result of a scan
+func (p *PostgresStore) GetEnrichmentResultByScan(ctx context.Context, ipAddress string, scanID string) (*HttpxEnrichment, error) {
+	enrichments, err := p.queryEnrichments(ctx, `
+		SELECT enrichment FROM `+p.enrichment+`
+		WHERE ip_address = $1 AND scan_id = $2 AND expires_at >= now() ORDER BY timestamp DESC LIMIT 1`, ipAddress, scanID)
+	if err != nil {
+		return nil, err
+	}
+	if len(enrichments) == 0 {
+		return nil, errNoEnrichmentForScan(ipAddress, scanID)
+	}
+	return &enrichments[0], nil
+}
+
+// GetLatestEnrichmentResult returns the newest enrichment result of an IP
+func (p *PostgresStore) GetLatestEnrichmentResult(ctx context.Context, ipAddress string) (*HttpxEnrichment, error) {
+	enrichments, err := p.queryEnrichments(ctx, `
+		SELECT enrichment FROM `+p.enrichment+`
+		WHERE ip_address = $1 AND expires_at >= now() ORDER BY timestamp DESC LIMIT 1`, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if len(enrichments) == 0 {
+		return nil, errNoEnrichment(ipAddress)
+	}
+	return &enrichments[0], nil
+}
+
+// DeleteIPEnrichments deletes all enrichment results for an IP
+func (p *PostgresStore) DeleteIPEnrichments(ctx context.Context, ipAddress string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM `+p.enrichment+` WHERE ip_address = $1`, ipAddress)
+	return err
+}
@@ -0,0 +1,440 @@
+// pkg/database/scan_jobs.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Scan job errors
+var (
+	ErrScanJobNotFound      = errors.New("scan job not found")
+	ErrBatchAlreadyRecorded = errors.New("batch already reported")
+	ErrScanJobClosed        = errors.New("scan job already finished")
+	ErrScanJobExists        = errors.New("scan job already exists")
+)
+
+// scanJobRetention is how long scan jobs and their batches are kept
+const scanJobRetention = 30 * 24 * time.Hour
+
+// finalizeRetryWindow is how long after a job last changed the stale-job
+// sweep keeps looking for it when it finished but was never finalised
+const finalizeRetryWindow = 24 * time.Hour
+
+// CreateScanJob stores a new scan job before its batches are queued. The job
+// starts out expecting every batch; SetScanJobBatchesQueued lowers the count
+// when some batches could not be queued. A job with the same ID is never
+// overwritten; ErrScanJobExists is returned instead.
+func (c *Client) CreateScanJob(ctx context.Context, job *models.ScanJob) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	job.Status = models.ScanStatusQueued
+	job.BatchesQueued = job.TotalBatches
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.ExpirationTime = now.Add(scanJobRetention).Unix()
+
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(c.Tables.ScanJobs),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ScanID)"),
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrScanJobExists
+	}
+	return err
+}
+
+// FailScanJob records a scan that could not be started, with the reason, so
+// a scan ID handed out before the scan was dispatched still leads to a job.
+// The job is created in failed status when it does not exist yet. A job that
+// exists only gets the reason when none of its batches were queued; a job
+// with queued batches is left to them.
+func (c *Client) FailScanJob(ctx context.Context, job *models.ScanJob, reason string) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	job.Status = models.ScanStatusFailed
+	job.Error = reason
+	job.BatchesQueued = 0
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.CompletedAt = &now
+	job.ExpirationTime = now.Add(scanJobRetention).Unix()
+
+	item, err := attributevalue.MarshalMap(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(c.Tables.ScanJobs),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ScanID)"),
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) {
+		return err
+	}
+
+	// The job was created before the scan failed
+	_, err = c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.Tables.ScanJobs),
+		Key: map[string]types.AttributeValue{
+			"ScanID": &types.AttributeValueMemberS{Value: job.ScanID},
+		},
+		UpdateExpression:    aws.String("SET #status = :failed, #error = :error, CompletedAt = if_not_exists(CompletedAt, :now), UpdatedAt = :now"),
+		ConditionExpression: aws.String("BatchesQueued = :zero"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+			"#error":  "Error",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":failed": &types.AttributeValueMemberS{Value: models.ScanStatusFailed},
+			":error":  &types.AttributeValueMemberS{Value: reason},
+			":now":    &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+			":zero":   &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	return err
+}
+
+// GetScanJob retrieves a scan job with its derived progress fields filled in
+func (c *Client) GetScanJob(ctx context.Context, scanID string) (*models.ScanJob, error) {
+	result, err := c.DynamoDB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.Tables.ScanJobs),
+		Key: map[string]types.AttributeValue{
+			"ScanID": &types.AttributeValueMemberS{Value: scanID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, ErrScanJobNotFound
+	}
+
+	var job models.ScanJob
+	if err := attributevalue.UnmarshalMap(result.Item, &job); err != nil {
+		return nil, err
+	}
+	job.Refresh(time.Now())
+	return &job, nil
+}
+
+// SetScanJobBatchesQueued records how many batches actually reached the
+// tasks queue and finishes the job if they have all reported already
+func (c *Client) SetScanJobBatchesQueued(ctx context.Context, scanID string, batchesQueued int) (*models.ScanJob, error) {
+	result, err := c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.Tables.ScanJobs),
+		Key: map[string]types.AttributeValue{
+			"ScanID": &types.AttributeValueMemberS{Value: scanID},
+		},
+		UpdateExpression:    aws.String("SET BatchesQueued = :queued, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("attribute_exists(ScanID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":queued":    &types.AttributeValueMemberN{Value: formatInt(batchesQueued)},
+			":updatedAt": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil, ErrScanJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c.finishScanJobIfComplete(ctx, result.Attributes)
+}
+
+// RecordScanBatch stores one batch's findings and counts the batch on its
+// scan job, finishing the job once every queued batch has reported. Each
+// batch is an item of its own, so a scan's findings are not limited by the
+// size of one item. A batch that was already counted, for instance after SQS
+// redelivered its result, is rejected with ErrBatchAlreadyRecorded so it is
+// not counted twice. A batch arriving after its job finished, for instance
+// once the stale-job sweep gave up on it, is rejected with ErrScanJobClosed;
+// it is still stored, so a job that is not finalised yet includes it.
+// ErrScanJobNotFound means the job does not exist.
+func (c *Client) RecordScanBatch(ctx context.Context, scanID string, batchID int, batch models.ScanBatchResult) (*models.ScanJob, error) {
+	now := time.Now().UTC()
+	batch.ScanID = scanID
+	batch.BatchID = batchID
+	batch.ExpirationTime = now.Add(scanJobRetention).Unix()
+
+	// The batch is stored before it is counted, so a counted batch is always
+	// there when the scan is finalised. Storing it again on redelivery
+	// writes the same findings.
+	item, err := attributevalue.MarshalMap(batch)
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.Tables.ScanBatches),
+		Item:      item,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.Tables.ScanJobs),
+		Key: map[string]types.AttributeValue{
+			"ScanID": &types.AttributeValueMemberS{Value: scanID},
+		},
+		UpdateExpression: aws.String("ADD ReportedBatches :batch, PortsScanned :ports, OpenPortsFound :open SET #status = :running, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("attribute_exists(ScanID) AND NOT contains(ReportedBatches, :batchId) AND " +
+			"#status IN (:queued, :running) AND attribute_not_exists(FinalizedAt)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":batch":     &types.AttributeValueMemberNS{Value: []string{formatInt(batchID)}},
+			":batchId":   &types.AttributeValueMemberN{Value: formatInt(batchID)},
+			":ports":     &types.AttributeValueMemberN{Value: formatInt(batch.PortsScanned)},
+			":open":      &types.AttributeValueMemberN{Value: formatInt(len(batch.OpenPorts))},
+			":queued":    &types.AttributeValueMemberS{Value: models.ScanStatusQueued},
+			":running":   &types.AttributeValueMemberS{Value: models.ScanStatusRunning},
+			":updatedAt": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		// Tell a missing job apart from a batch counted before and from
+		// a job that was closed without it
+		job, err := c.GetScanJob(ctx, scanID)
+		if err != nil {
+			return nil, err
+		}
+		for _, reported := range job.ReportedBatches {
+			if reported == batchID {
+				return nil, ErrBatchAlreadyRecorded
+			}
+		}
+		return nil, ErrScanJobClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c.finishScanJobIfComplete(ctx, result.Attributes)
+}
+
+// ResumeScanJob reads a job whose batch an earlier delivery recorded and
+// finishes the job if every queued batch has reported. The earlier delivery
+// may have stopped after counting the last batch but before finishing or
+// finalising the job.
+func (c *Client) ResumeScanJob(ctx context.Context, scanID string) (*models.ScanJob, error) {
+	result, err := c.DynamoDB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.Tables.ScanJobs),
+		Key: map[string]types.AttributeValue{
+			"ScanID": &types.AttributeValueMemberS{Value: scanID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, ErrScanJobNotFound
+	}
+	return c.finishScanJobIfComplete(ctx, result.Item)
+}
+
+// GetScanBatches retrieves the findings of every reported batch of a scan
+// in batch order
+func (c *Client) GetScanBatches(ctx context.Context, scanID string) ([]models.ScanBatchResult, error) {
+	paginator := dynamodb.NewQueryPaginator(c.DynamoDB, &dynamodb.QueryInput{
+		TableName:              aws.String(c.Tables.ScanBatches),
+		KeyConditionExpression: aws.String("ScanID = :scanId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":scanId": &types.AttributeValueMemberS{Value: scanID},
+		},
+		ConsistentRead: aws.Bool(true), // The last batch may have been stored just now
+	})
+
+	var batches []models.ScanBatchResult
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var pageBatches []models.ScanBatchResult
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageBatches); err != nil {
+			return nil, err
+		}
+		batches = append(batches, pageBatches...)
+	}
+	return batches, nil
+}
+
+// FinishScanJob moves a job to a terminal status. Jobs that have already
+// finished are left as they are.
+func (c *Client) FinishScanJob(ctx context.Context, scanID string, status string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.Tables.ScanJobs),
+		Key: map[string]types.AttributeValue{
+			"ScanID": &types.AttributeValueMemberS{Value: scanID},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, CompletedAt = :now, UpdatedAt = :now"),
+		ConditionExpression: aws.String("#status IN (:queued, :running)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status":  &types.AttributeValueMemberS{Value: status},
+			":now":     &types.AttributeValueMemberS{Value: now},
+			":queued":  &types.AttributeValueMemberS{Value: models.ScanStatusQueued},
+			":running": &types.AttributeValueMemberS{Value: models.ScanStatusRunning},
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	return err
+}
+
+// ClaimScanJobFinalization marks a finished job as finalised and reports
+// whether this caller made the claim. Only the claimant stores the summary
+// and triggers enrichment, so a scan is finalised once even when its last
+// batch and the stale-job sweep race. A claimant that cannot store the
+// summary gives the claim back with ReleaseScanJobFinalization.
+func (c *Client) ClaimScanJobFinalization(ctx context.Context, scanID string) (bool, error) {
+	_, err := c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.Tables.ScanJobs),
+		Key: map[string]types.AttributeValue{
+			"ScanID": &types.AttributeValueMemberS{Value: scanID},
+		},
+		UpdateExpression:    aws.String("SET FinalizedAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(ScanID) AND attribute_not_exists(FinalizedAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseScanJobFinalization gives back a claim on finalising a job whose
+// summary could not be stored, so the stale-job sweep finalises it again
+func (c *Client) ReleaseScanJobFinalization(ctx context.Context, scanID string) error {
+	_, err := c.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(c.Tables.ScanJobs),
+		Key: map[string]types.AttributeValue{
+			"ScanID": &types.AttributeValueMemberS{Value: scanID},
+		},
+		UpdateExpression:    aws.String("REMOVE FinalizedAt"),
+		ConditionExpression: aws.String("attribute_exists(ScanID)"),
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrScanJobNotFound
+	}
+	return err
+}
+
+// GetStaleScanJobs retrieves jobs that have not been finalised and have not
+// been updated since before cutoff. Besides unfinished jobs this includes
+// finished jobs that were never finalised: partial jobs whose last batch
+// reported before the scheduler lowered their queued batch count, and jobs
+// whose finalisation stopped or failed. Finished jobs are only looked for
+// within finalizeRetryWindow of cutoff, as most of them are finalised.
+func (c *Client) GetStaleScanJobs(ctx context.Context, cutoff time.Time) ([]models.ScanJob, error) {
+	var jobs []models.ScanJob
+
+	statuses := []string{models.ScanStatusQueued, models.ScanStatusRunning,
+		models.ScanStatusCompleted, models.ScanStatusPartial, models.ScanStatusFailed}
+	for _, status := range statuses {
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(c.Tables.ScanJobs),
+			IndexName:              aws.String("StatusIndex"),
+			KeyConditionExpression: aws.String("#status = :status AND UpdatedAt < :cutoff"),
+			FilterExpression:       aws.String("attribute_not_exists(FinalizedAt)"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "Status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":status": &types.AttributeValueMemberS{Value: status},
+				":cutoff": &types.AttributeValueMemberS{Value: cutoff.UTC().Format(time.RFC3339)},
+			},
+		}
+		if status != models.ScanStatusQueued && status != models.ScanStatusRunning {
+			input.KeyConditionExpression = aws.String("#status = :status AND UpdatedAt BETWEEN :since AND :cutoff")
+			input.ExpressionAttributeValues[":since"] = &types.AttributeValueMemberS{
+				Value: cutoff.Add(-finalizeRetryWindow).UTC().Format(time.RFC3339),
+			}
+		}
+
+		paginator := dynamodb.NewQueryPaginator(c.DynamoDB, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			var pageJobs []models.ScanJob
+			if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageJobs); err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, pageJobs...)
+		}
+	}
+
+	return jobs, nil
+}
+
+// finishScanJobIfComplete decodes an updated job and moves it to its
+// terminal status when no queued batch is outstanding
+func (c *Client) finishScanJobIfComplete(ctx context.Context, attributes map[string]types.AttributeValue) (*models.ScanJob, error) {
+	var job models.ScanJob
+	if err := attributevalue.UnmarshalMap(attributes, &job); err != nil {
+		return nil, err
+	}
+
+	if status := job.CompletionStatus(); status != "" && !job.Finished() {
+		if err := c.FinishScanJob(ctx, job.ScanID, status); err != nil {
+			return nil, err
+		}
+		completedAt := time.Now().UTC()
+		job.Status = status
+		job.CompletedAt = &completedAt
+	}
+
+	job.Refresh(time.Now())
+	return &job, nil
+}
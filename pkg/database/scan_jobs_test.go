@@ -0,0 +1,298 @@
+// pkg/database/scan_jobs_test.go
+
+package database_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/local"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// newLocalClient returns a client on an empty local store
+func newLocalClient(t *testing.T) *database.Client {
+	t.Helper()
+	tables := database.DefaultTables()
+	store, err := local.OpenStore(filepath.Join(t.TempDir(), "nexusscan.db"), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return database.NewClientWithAPI(store, tables)
+}
+
+func TestRecordScanBatch(t *testing.T) {
+	ctx := context.Background()
+	db := newLocalClient(t)
+
+	job := &models.ScanJob{
+		ScanID:       "scan-10.0.0.1-1",
+		IPAddress:    "10.0.0.1",
+		Protocol:     models.ProtocolTCP,
+		ScheduleID:   "schedule-1",
+		ScheduleType: "daily",
+		TotalBatches: 3,
+		PortsTotal:   300,
+	}
+	if err := db.CreateScanJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := func(ports ...int) models.ScanBatchResult {
+		result := models.ScanBatchResult{PortsScanned: 100}
+		for _, port := range ports {
+			result.OpenPorts = append(result.OpenPorts, models.Port{Number: port, State: models.PortStateOpen})
+		}
+		return result
+	}
+
+	// Batches arrive out of order
+	for _, b := range []struct {
+		id    int
+		ports []int
+	}{{2, []int{250}}, {0, []int{22, 80}}} {
+		got, err := db.RecordScanBatch(ctx, job.ScanID, b.id, batch(b.ports...))
+		if err != nil {
+			t.Fatalf("recording batch %d: %v", b.id, err)
+		}
+		if got.Finished() {
+			t.Fatalf("job finished after batch %d with %d of 3 batches", b.id, got.BatchesDone)
+		}
+	}
+
+	// A redelivered batch is not counted again
+	if _, err := db.RecordScanBatch(ctx, job.ScanID, 2, batch(250)); !errors.Is(err, database.ErrBatchAlreadyRecorded) {
+		t.Fatalf("recording batch 2 again: %v, want %v", err, database.ErrBatchAlreadyRecorded)
+	}
+
+	finished, err := db.RecordScanBatch(ctx, job.ScanID, 1, batch(143))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished.Status != models.ScanStatusCompleted {
+		t.Errorf("status = %s, want %s", finished.Status, models.ScanStatusCompleted)
+	}
+	if finished.PortsScanned != 300 || finished.OpenPortsFound != 4 {
+		t.Errorf("counted %d ports scanned and %d open, want 300 and 4", finished.PortsScanned, finished.OpenPortsFound)
+	}
+	if finished.ScheduleID != "schedule-1" || finished.ScheduleType != "daily" {
+		t.Errorf("schedule = %q/%q, want schedule-1/daily", finished.ScheduleID, finished.ScheduleType)
+	}
+
+	batches, err := db.GetScanBatches(ctx, job.ScanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 {
+		t.Fatalf("got %d batches, want 3", len(batches))
+	}
+	for i, b := range batches {
+		if b.BatchID != i || b.ScanID != job.ScanID {
+			t.Errorf("batch %d is %s/%d", i, b.ScanID, b.BatchID)
+		}
+	}
+
+	merged := models.AggregateBatches(batches)
+	var open []int
+	for _, port := range merged.OpenPorts {
+		open = append(open, port.Number)
+	}
+	if want := []int{22, 80, 143, 250}; !reflect.DeepEqual(open, want) {
+		t.Errorf("merged open ports = %v, want %v", open, want)
+	}
+	if merged.PortsScanned != 300 {
+		t.Errorf("merged ports scanned = %d, want 300", merged.PortsScanned)
+	}
+}
+
+func TestRecordScanBatchWithoutJob(t *testing.T) {
+	db := newLocalClient(t)
+	_, err := db.RecordScanBatch(context.Background(), "scan-missing", 0, models.ScanBatchResult{PortsScanned: 10})
+	if !errors.Is(err, database.ErrScanJobNotFound) {
+		t.Fatalf("recording a batch without a job: %v, want %v", err, database.ErrScanJobNotFound)
+	}
+}
+
+// TestRecordScanBatchAfterJobClosed checks that a batch arriving after the
+// stale-job sweep finished its job is not counted and does not reopen it
+func TestRecordScanBatchAfterJobClosed(t *testing.T) {
+	ctx := context.Background()
+	db := newLocalClient(t)
+
+	job := &models.ScanJob{ScanID: "scan-10.0.0.2-1", IPAddress: "10.0.0.2", Protocol: models.ProtocolTCP, TotalBatches: 2}
+	if err := db.CreateScanJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RecordScanBatch(ctx, job.ScanID, 0, models.ScanBatchResult{PortsScanned: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FinishScanJob(ctx, job.ScanID, models.ScanStatusPartial); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := db.RecordScanBatch(ctx, job.ScanID, 1, models.ScanBatchResult{PortsScanned: 100})
+	if !errors.Is(err, database.ErrScanJobClosed) {
+		t.Fatalf("recording a batch of a finished job: %v, want %v", err, database.ErrScanJobClosed)
+	}
+	got, err := db.GetScanJob(ctx, job.ScanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.ScanStatusPartial || got.BatchesDone != 1 {
+		t.Errorf("job is %s with %d batches done, want %s with 1", got.Status, got.BatchesDone, models.ScanStatusPartial)
+	}
+
+	// A redelivery of the batch that was counted is still told apart
+	if _, err := db.RecordScanBatch(ctx, job.ScanID, 0, models.ScanBatchResult{PortsScanned: 100}); !errors.Is(err, database.ErrBatchAlreadyRecorded) {
+		t.Fatalf("recording batch 0 again: %v, want %v", err, database.ErrBatchAlreadyRecorded)
+	}
+}
+
+// TestStaleScanJobsUnfinalized checks that finished jobs whose finalisation
+// never happened, or was given back, are found again by the sweep
+func TestStaleScanJobsUnfinalized(t *testing.T) {
+	ctx := context.Background()
+	db := newLocalClient(t)
+
+	job := &models.ScanJob{ScanID: "scan-10.0.0.3-1", IPAddress: "10.0.0.3", Protocol: models.ProtocolTCP, TotalBatches: 1}
+	if err := db.CreateScanJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	finished, err := db.RecordScanBatch(ctx, job.ScanID, 0, models.ScanBatchResult{PortsScanned: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished.Status != models.ScanStatusCompleted {
+		t.Fatalf("status = %s, want %s", finished.Status, models.ScanStatusCompleted)
+	}
+
+	stale := func() []string {
+		t.Helper()
+		jobs, err := db.GetStaleScanJobs(ctx, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, job := range jobs {
+			ids = append(ids, job.ScanID)
+		}
+		return ids
+	}
+
+	if got := stale(); !reflect.DeepEqual(got, []string{job.ScanID}) {
+		t.Errorf("stale jobs before finalisation = %v, want %s", got, job.ScanID)
+	}
+
+	claimed, err := db.ClaimScanJobFinalization(ctx, job.ScanID)
+	if err != nil || !claimed {
+		t.Fatalf("claiming finalisation = %v, %v", claimed, err)
+	}
+	if got := stale(); len(got) != 0 {
+		t.Errorf("stale jobs after finalisation = %v, want none", got)
+	}
+
+	// A claim given back after the summary could not be stored
+	if err := db.ReleaseScanJobFinalization(ctx, job.ScanID); err != nil {
+		t.Fatal(err)
+	}
+	if got := stale(); !reflect.DeepEqual(got, []string{job.ScanID}) {
+		t.Errorf("stale jobs after release = %v, want %s", got, job.ScanID)
+	}
+
+	// A redelivery of the last batch finds the job ready to finalise
+	resumed, err := db.ResumeScanJob(ctx, job.ScanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.CompletedAt == nil || resumed.FinalizedAt != nil {
+		t.Errorf("resumed job completed at %v, finalized at %v, want completed and not finalized", resumed.CompletedAt, resumed.FinalizedAt)
+	}
+}
+
+func TestCreateScanJobExisting(t *testing.T) {
+	ctx := context.Background()
+	db := newLocalClient(t)
+
+	job := &models.ScanJob{ScanID: "scan-10.0.0.4-1", IPAddress: "10.0.0.4", Protocol: models.ProtocolTCP, TotalBatches: 2}
+	if err := db.CreateScanJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RecordScanBatch(ctx, job.ScanID, 0, models.ScanBatchResult{PortsScanned: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	again := &models.ScanJob{ScanID: job.ScanID, IPAddress: "10.0.0.4", Protocol: models.ProtocolUDP, TotalBatches: 1}
+	if err := db.CreateScanJob(ctx, again); !errors.Is(err, database.ErrScanJobExists) {
+		t.Fatalf("creating a job with an existing ID: %v, want %v", err, database.ErrScanJobExists)
+	}
+	got, err := db.GetScanJob(ctx, job.ScanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Protocol != models.ProtocolTCP || got.BatchesDone != 1 {
+		t.Errorf("job is %s with %d batches done, want the first job's tcp with 1", got.Protocol, got.BatchesDone)
+	}
+}
+
+func TestFailScanJob(t *testing.T) {
+	ctx := context.Background()
+	db := newLocalClient(t)
+
+	// A scan that failed before its job was created
+	missing := &models.ScanJob{ScanID: "scan-10.0.0.5-1", IPAddress: "10.0.0.5", Protocol: models.ProtocolTCP, PortSet: "no_such_set"}
+	if err := db.FailScanJob(ctx, missing, "port set not found"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A scan none of whose batches could be queued
+	unqueued := &models.ScanJob{ScanID: "scan-10.0.0.6-1", IPAddress: "10.0.0.6", Protocol: models.ProtocolTCP, TotalBatches: 2}
+	if err := db.CreateScanJob(ctx, unqueued); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SetScanJobBatchesQueued(ctx, unqueued.ScanID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FailScanJob(ctx, &models.ScanJob{ScanID: unqueued.ScanID, IPAddress: "10.0.0.6"}, "queue unavailable"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A scan whose batches are under way is left to them
+	running := &models.ScanJob{ScanID: "scan-10.0.0.7-1", IPAddress: "10.0.0.7", Protocol: models.ProtocolTCP, TotalBatches: 2}
+	if err := db.CreateScanJob(ctx, running); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FailScanJob(ctx, &models.ScanJob{ScanID: running.ScanID, IPAddress: "10.0.0.7"}, "scheduled twice"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		scanID     string
+		wantStatus string
+		wantError  string
+		wantTotal  int
+	}{
+		{missing.ScanID, models.ScanStatusFailed, "port set not found", 0},
+		{unqueued.ScanID, models.ScanStatusFailed, "queue unavailable", 2},
+		{running.ScanID, models.ScanStatusQueued, "", 2},
+	}
+	for _, tt := range tests {
+		got, err := db.GetScanJob(ctx, tt.scanID)
+		if err != nil {
+			t.Errorf("%s: %v", tt.scanID, err)
+			continue
+		}
+		if got.Status != tt.wantStatus || got.Error != tt.wantError || got.TotalBatches != tt.wantTotal {
+			t.Errorf("%s: got %s %q with %d batches, want %s %q with %d",
+				tt.scanID, got.Status, got.Error, got.TotalBatches, tt.wantStatus, tt.wantError, tt.wantTotal)
+		}
+		if tt.wantStatus == models.ScanStatusFailed && got.CompletedAt == nil {
+			t.Errorf("%s: failed job has no completion time", tt.scanID)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// pkg/database/scan_profiles.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Scan profile errors, distinguished so the API can map them to status codes
+var (
+	ErrScanProfileNotFound = errors.New("scan profile not found")
+	ErrInvalidScanProfile  = errors.New("invalid scan profile")
+	ErrScanProfileExists   = errors.New("scan profile already exists")
+	ErrScanProfileInUse    = errors.New("scan profile is used by schedules")
+)
+
+// CreateScanProfile validates and stores a new user-defined scan profile
+func (c *Client) CreateScanProfile(ctx context.Context, profile *models.ScanProfile) error {
+	if err := profile.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidScanProfile, err)
+	}
+	profile.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	profile.UpdatedAt = profile.CreatedAt
+
+	return c.putScanProfile(ctx, profile, "attribute_not_exists(#name)", ErrScanProfileExists)
+}
+
+// UpdateScanProfile replaces the settings of a user-defined scan profile
+func (c *Client) UpdateScanProfile(ctx context.Context, profile *models.ScanProfile) error {
+	if err := profile.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidScanProfile, err)
+	}
+
+	existing, err := c.GetScanProfile(ctx, profile.Name)
+	if err != nil {
+		return err
+	}
+	if existing.Builtin {
+		return fmt.Errorf("%w: built-in profiles cannot be changed", ErrInvalidScanProfile)
+	}
+	profile.CreatedAt = existing.CreatedAt
+	profile.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+
+	return c.putScanProfile(ctx, profile, "attribute_exists(#name)", ErrScanProfileNotFound)
+}
+
+// putScanProfile writes a profile, returning conditionErr if the condition fails
+func (c *Client) putScanProfile(ctx context.Context, profile *models.ScanProfile, condition string, conditionErr error) error {
+	item, err := attributevalue.MarshalMap(profile)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(c.Tables.ScanProfiles),
+		Item:                item,
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "Name",
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return conditionErr
+	}
+	return err
+}
+
+// GetScanProfile retrieves a built-in or user-defined scan profile. An empty
+// name returns the default profile.
+func (c *Client) GetScanProfile(ctx context.Context, name string) (*models.ScanProfile, error) {
+	if name == "" {
+		name = models.DefaultScanProfile
+	}
+	if profile := models.GetBuiltinScanProfile(name); profile != nil {
+		return profile, nil
+	}
+
+	result, err := c.DynamoDB.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.Tables.ScanProfiles),
+		Key: map[string]types.AttributeValue{
+			"Name": &types.AttributeValueMemberS{Value: name},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %q", ErrScanProfileNotFound, name)
+	}
+
+	var profile models.ScanProfile
+	if err := attributevalue.UnmarshalMap(result.Item, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// ListScanProfiles retrieves the built-in and user-defined scan profiles
+func (c *Client) ListScanProfiles(ctx context.Context) ([]models.ScanProfile, error) {
+	var stored []models.ScanProfile
+	if err := c.scanAll(ctx, c.Tables.ScanProfiles, &stored); err != nil {
+		return nil, err
+	}
+	return append(models.BuiltinScanProfiles(), stored...), nil
+}
+
+// DeleteScanProfile removes a user-defined scan profile. Profiles that
+// schedules still refer to cannot be deleted.
+func (c *Client) DeleteScanProfile(ctx context.Context, name string) error {
+	if models.GetBuiltinScanProfile(name) != nil {
+		return fmt.Errorf("%w: built-in profiles cannot be deleted", ErrInvalidScanProfile)
+	}
+
+	inUse, err := c.SchedulesUseProfile(ctx, name)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrScanProfileInUse
+	}
+
+	_, err = c.DynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(c.Tables.ScanProfiles),
+		Key: map[string]types.AttributeValue{
+			"Name": &types.AttributeValueMemberS{Value: name},
+		},
+		ConditionExpression: aws.String("attribute_exists(#name)"),
+		ExpressionAttributeNames: map[string]string{
+			"#name": "Name",
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return ErrScanProfileNotFound
+	}
+	return err
+}
+
+// ValidateScanProfile checks that name is empty, a built-in profile or a
+// stored user-defined profile. It is the single check used wherever a
+// profile is accepted.
+func (c *Client) ValidateScanProfile(ctx context.Context, name string) error {
+	if _, err := c.GetScanProfile(ctx, name); err != nil {
+		if errors.Is(err, ErrScanProfileNotFound) {
+			return fmt.Errorf("%w %q: must be default, stealth, aggressive, lan or a defined profile",
+				ErrInvalidScanProfile, name)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// pkg/database/schedule_dispatch.go
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// NextRunIndex orders the schedules of each type by NextRun
+const NextRunIndex = "NextRunIndex"
+
+// ErrInvalidContinuationToken is returned for tokens that were not produced
+// by GetDueSchedules
+var ErrInvalidContinuationToken = errors.New("invalid continuation token")
+
+// dispatchCursor is the decoded form of a continuation token: the schedule
+// type being paged through and the last key read from it
+type dispatchCursor struct {
+	ScheduleType string            `json:"t"`
+	LastKey      map[string]string `json:"k,omitempty"`
+}
+
+// dispatchScheduleTypes returns the schedule types a dispatch pass covers,
+// starting with the one a continuation token stopped in
+func dispatchScheduleTypes(only string, from string) []string {
+	all := append(append([]string{}, models.ScheduleTypes...), models.ScheduleTypeCron)
+	if only != "" {
+		all = []string{only}
+	}
+
+	for i, scheduleType := range all {
+		if scheduleType == from {
+			return all[i:]
+		}
+	}
+	return all
+}
+
+// GetDueSchedules returns one page of enabled schedules whose NextRun has
+// passed, across every schedule type or only scheduleType when it is set.
+// The returned token resumes after this page and is empty once every due
+// schedule has been read. Pages can be empty while the token is not.
+// Schedules due outside their scan windows or on a blackout date are
+// deferred instead of returned.
+func (s *DynamoDBStore) GetDueSchedules(ctx context.Context, now time.Time, scheduleType string, pageSize int, token string) ([]models.ScheduleScan, string, error) {
+	cursor, err := decodeDispatchCursor(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	scheduleTypes := dispatchScheduleTypes(scheduleType, cursor.ScheduleType)
+	currentType := scheduleTypes[0]
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.Tables.Schedules),
+		IndexName:              aws.String(NextRunIndex),
+		KeyConditionExpression: aws.String("ScheduleType = :scheduleType AND NextRun <= :now"),
+		FilterExpression:       aws.String("Enabled = :enabled"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":scheduleType": &types.AttributeValueMemberS{Value: currentType},
+			":now":          &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			":enabled":      &types.AttributeValueMemberBOOL{Value: true},
+		},
+		Limit: aws.Int32(int32(pageSize)),
+	}
+	if cursor.ScheduleType == currentType && len(cursor.LastKey) > 0 {
+		input.ExclusiveStartKey = make(map[string]types.AttributeValue, len(cursor.LastKey))
+		for name, value := range cursor.LastKey {
+			input.ExclusiveStartKey[name] = &types.AttributeValueMemberS{Value: value}
+		}
+	}
+
+	result, err := s.DynamoDB.Query(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var scans []models.ScheduleScan
+	for _, item := range result.Items {
+		scan := models.ScheduleScan{
+			ScheduleID:     getString(item, "ScheduleID"),
+			IPAddress:      getString(item, "IPAddress"),
+			Selector:       getSelector(item),
+			ScheduleType:   getString(item, "ScheduleType"),
+			ScheduleTiming: getScheduleTiming(item),
+			PortSet:        getString(item, "PortSet"),
+			Profile:        getString(item, "Profile"),
+			NextRun:        getTime(item, "NextRun"),
+		}
+
+		if !scan.Allows(now) {
+			if err := s.deferSchedule(ctx, scan.ScheduleID, scan.ScheduleTiming, now); err != nil {
+				log.Printf("Error deferring schedule %s: %v", scan.ScheduleID, err)
+			}
+			continue
+		}
+
+		scans = append(scans, scan)
+	}
+
+	// Work out where the next page starts
+	next := dispatchCursor{ScheduleType: currentType}
+	if len(result.LastEvaluatedKey) > 0 {
+		next.LastKey = make(map[string]string, len(result.LastEvaluatedKey))
+		for name, value := range result.LastEvaluatedKey {
+			if s, ok := value.(*types.AttributeValueMemberS); ok {
+				next.LastKey[name] = s.Value
+			}
+		}
+	} else if len(scheduleTypes) > 1 {
+		next.ScheduleType = scheduleTypes[1]
+	} else {
+		return scans, "", nil
+	}
+
+	nextToken, err := encodeDispatchCursor(next)
+	if err != nil {
+		return nil, "", err
+	}
+	return scans, nextToken, nil
+}
+
+// ClaimScheduleRun records that a due schedule is being run and moves its
+// NextRun on. It returns false when another dispatcher already claimed the
+// run, so overlapping dispatch passes never start the same run twice.
+func (s *DynamoDBStore) ClaimScheduleRun(ctx context.Context, scan models.ScheduleScan, now time.Time) (bool, error) {
+	nextRun, err := scan.Next(now)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.Tables.Schedules),
+		Key: map[string]types.AttributeValue{
+			"ScheduleID": &types.AttributeValueMemberS{Value: scan.ScheduleID},
+		},
+		UpdateExpression:    aws.String("SET LastRun = :lastRun, NextRun = :nextRun, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("NextRun = :dueRun"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":lastRun":   &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			":nextRun":   &types.AttributeValueMemberS{Value: nextRun.Format(time.RFC3339)},
+			":updatedAt": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			":dueRun":    &types.AttributeValueMemberS{Value: scan.NextRun.Format(time.RFC3339)},
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseScheduleRun puts a claimed run back when its scan could not be
+// dispatched, so the next dispatch pass retries it
+func (s *DynamoDBStore) ReleaseScheduleRun(ctx context.Context, scan models.ScheduleScan) error {
+	_, err := s.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.Tables.Schedules),
+		Key: map[string]types.AttributeValue{
+			"ScheduleID": &types.AttributeValueMemberS{Value: scan.ScheduleID},
+		},
+		UpdateExpression:    aws.String("SET NextRun = :dueRun"),
+		ConditionExpression: aws.String("attribute_exists(ScheduleID)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":dueRun": &types.AttributeValueMemberS{Value: scan.NextRun.Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error releasing run of schedule %s: %w", scan.ScheduleID, err)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+// pkg/database/service_state.go
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// The current state of each port and the changes of its tracked fields are
+// kept apart from the enrichment results, without expiry, so they outlast
+// the retention of the results they were folded from
+
+// EnrichmentChangeQuery selects a page of the enrichment changes of an IP,
+// newest first. Port and Field, when set, keep only the changes of one port
+// or one field.
+type EnrichmentChangeQuery struct {
+	IPAddress string
+	Port      int
+	Field     string
+	Limit     int
+	Cursor    string
+}
+
+// EnrichmentChangePage is one page of the enrichment changes of an IP
+type EnrichmentChangePage struct {
+	Changes    []models.EnrichmentChange
+	NextCursor string
+	Total      int
+}
+
+func (q EnrichmentChangeQuery) listing() string {
+	return fmt.Sprintf("enrichment-changes|%s|%d|%s", q.IPAddress, q.Port, q.Field)
+}
+
+// RecordServiceState folds an enrichment into the current state of the IP's
+// ports and stores a change for each tracked field that differs from the
+// port's previous state. Ports that answered no probe keep their state. It
+// returns the changes.
+func (c *Client) RecordServiceState(ctx context.Context, enrichment *HttpxEnrichment) ([]models.EnrichmentChange, error) {
+	seenAt, err := time.Parse(time.RFC3339, enrichment.Timestamp)
+	if err != nil {
+		seenAt = time.Now()
+	}
+	seenAt = seenAt.UTC()
+
+	existing, err := c.GetServiceState(ctx, enrichment.IPAddress, 0)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[int]*models.ServiceState, len(existing))
+	for i := range existing {
+		previous[existing[i].Port] = &existing[i]
+	}
+
+	var changes []models.EnrichmentChange
+	for _, state := range serviceStates(enrichment, seenAt) {
+		state.FirstSeen, state.LastChanged = seenAt, seenAt
+		if before, ok := previous[state.Port]; ok {
+			state.FirstSeen, state.LastChanged = before.FirstSeen, before.LastChanged
+			if portChanges := models.DiffServiceState(before, &state); len(portChanges) > 0 {
+				state.LastChanged = seenAt
+				changes = append(changes, portChanges...)
+			}
+		}
+
+		item, err := attributevalue.MarshalMap(state)
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(c.Tables.ServiceState),
+			Item:      item,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, change := range changes {
+		item, err := attributevalue.MarshalMap(change)
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(c.Tables.EnrichmentChanges),
+			Item:      item,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// serviceStates builds the state of each port of an enrichment that
+// answered a web probe, a protocol module or a TLS handshake. The
+// certificate is the one TLS inspection kept, or else the one the web probe
+// was served.
+func serviceStates(enrichment *HttpxEnrichment, seenAt time.Time) []models.ServiceState {
+	states := make(map[int]*models.ServiceState)
+	state := func(port int) *models.ServiceState {
+		if states[port] == nil {
+			states[port] = &models.ServiceState{
+				IPAddress: enrichment.IPAddress,
+				Port:      port,
+				ScanID:    enrichment.ScanID,
+				LastSeen:  seenAt,
+			}
+		}
+		return states[port]
+	}
+
+	for _, result := range enrichment.Services {
+		if result.Error != "" {
+			continue
+		}
+		s := state(result.Port)
+		s.Service = result.Service
+		if s.Service == "" {
+			s.Service = result.Module
+		}
+	}
+
+	for _, result := range enrichment.TLS {
+		if len(result.Versions) == 0 && len(result.Certificates) == 0 {
+			continue
+		}
+		s := state(result.Port)
+		for _, version := range result.Versions {
+			s.TLSVersions = append(s.TLSVersions, version.Version)
+		}
+		if len(result.Certificates) > 0 {
+			leaf := result.Certificates[0]
+			s.CertificateFingerprint = leaf.FingerprintSHA256
+			s.CertificateSubjectCN = leaf.SubjectCN
+			s.CertificateNotAfter = leaf.NotAfter
+		}
+	}
+
+	for _, result := range enrichment.EnrichedPorts {
+		port, err := strconv.Atoi(result.Port)
+		if err != nil || result.Failed || result.Error != "" {
+			continue
+		}
+		s := state(port)
+		s.URL = result.URL
+		s.StatusCode = result.StatusCode
+		s.Title = result.Title
+		s.Server = result.ServerHeader
+		s.Technologies = result.Technologies
+		if s.CertificateFingerprint == "" && len(result.TLS.Chain) > 0 {
+			leaf := result.TLS.Chain[0]
+			s.CertificateFingerprint = leaf.FingerprintSHA256
+			s.CertificateSubjectCN = leaf.SubjectCN
+			s.CertificateNotAfter = leaf.NotAfter
+		}
+	}
+
+	ports := make([]int, 0, len(states))
+	for port := range states {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+
+	result := make([]models.ServiceState, len(ports))
+	for i, port := range ports {
+		result[i] = *states[port]
+	}
+	return result
+}
+
+// GetServiceState returns the current state of an IP's ports in port
+// order, or of one port when port is not zero
+func (c *Client) GetServiceState(ctx context.Context, ipAddress string, port int) ([]models.ServiceState, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(c.Tables.ServiceState),
+		KeyConditionExpression: aws.String("IPAddress = :ip"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ip": &types.AttributeValueMemberS{Value: ipAddress},
+		},
+	}
+	if port != 0 {
+		input.KeyConditionExpression = aws.String("IPAddress = :ip AND #port = :port")
+		input.ExpressionAttributeNames = map[string]string{"#port": "Port"}
+		input.ExpressionAttributeValues[":port"] = &types.AttributeValueMemberN{Value: strconv.Itoa(port)}
+	}
+
+	states := []models.ServiceState{}
+	paginator := dynamodb.NewQueryPaginator(c.DynamoDB, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var pageStates []models.ServiceState
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageStates); err != nil {
+			return nil, err
+		}
+		states = append(states, pageStates...)
+	}
+	return states, nil
+}
+
+// ListEnrichmentChanges returns a page of the enrichment changes of an IP,
+// newest first
+func (c *Client) ListEnrichmentChanges(ctx context.Context, query EnrichmentChangeQuery) (EnrichmentChangePage, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(c.Tables.EnrichmentChanges),
+		KeyConditionExpression: aws.String("IPAddress = :ip"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ip": &types.AttributeValueMemberS{Value: query.IPAddress},
+		},
+		ScanIndexForward: aws.Bool(false), // Newest first
+	}
+
+	filters := []string{}
+	names := map[string]string{}
+	if query.Port != 0 {
+		filters = append(filters, "#port = :port")
+		names["#port"] = "Port"
+		input.ExpressionAttributeValues[":port"] = &types.AttributeValueMemberN{Value: strconv.Itoa(query.Port)}
+	}
+	if query.Field != "" {
+		filters = append(filters, "#field = :field")
+		names["#field"] = "Field"
+		input.ExpressionAttributeValues[":field"] = &types.AttributeValueMemberS{Value: query.Field}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+		input.ExpressionAttributeNames = names
+	}
+
+	// The paging of the store's own listings, on the changes table
+	store := NewDynamoDBStore(c.DynamoDB, c.Tables)
+	items, next, total, err := store.queryPage(ctx, input, query.listing(), pageSize(query.Limit), query.Cursor)
+	if err != nil {
+		return EnrichmentChangePage{}, fmt.Errorf("error querying enrichment changes: %w", err)
+	}
+
+	page := EnrichmentChangePage{Changes: []models.EnrichmentChange{}, NextCursor: next, Total: total}
+	if err := attributevalue.UnmarshalListOfMaps(items, &page.Changes); err != nil {
+		return EnrichmentChangePage{}, fmt.Errorf("error unmarshaling enrichment changes: %v", err)
+	}
+	return page, nil
+}
+
+// DeleteIPServiceState deletes the current state of an IP's ports and their
+// changes (used when deleting an IP)
+func (c *Client) DeleteIPServiceState(ctx context.Context, ipAddress string) error {
+	if err := c.deleteIPItems(ctx, c.Tables.ServiceState, "Port", ipAddress); err != nil {
+		return err
+	}
+	return c.deleteIPItems(ctx, c.Tables.EnrichmentChanges, "ChangeID", ipAddress)
+}
+
+// deleteIPItems deletes every item of an IP from a table keyed by
+// IPAddress and rangeKey
+func (c *Client) deleteIPItems(ctx context.Context, table string, rangeKey string, ipAddress string) error {
+	paginator := dynamodb.NewQueryPaginator(c.DynamoDB, &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("IPAddress = :ip"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ip": &types.AttributeValueMemberS{Value: ipAddress},
+		},
+		ProjectionExpression:     aws.String("IPAddress, #range"),
+		ExpressionAttributeNames: map[string]string{"#range": rangeKey},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Process up to 25 items at a time (DynamoDB batch limit)
+		for i := 0; i < len(page.Items); i += 25 {
+			end := min(i+25, len(page.Items))
+
+			deleteRequests := make([]types.WriteRequest, 0, end-i)
+			for _, item := range page.Items[i:end] {
+				deleteRequests = append(deleteRequests, types.WriteRequest{
+					DeleteRequest: &types.DeleteRequest{
+						Key: map[string]types.AttributeValue{
+							"IPAddress": item["IPAddress"],
+							rangeKey:    item[rangeKey],
+						},
+					},
+				})
+			}
+
+			_, err := c.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{
+					table: deleteRequests,
+				},
+			})
+			if err != nil {
+				log.Printf("Error batch deleting from %s for IP %s: %v", table, ipAddress, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
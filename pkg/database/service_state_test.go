@@ -0,0 +1,219 @@
+// pkg/database/service_state_test.go
+
+package database_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+func TestEnrichmentRetention(t *testing.T) {
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		days   string
+		groups string
+		group  string
+		want   time.Duration
+	}{
+		{group: "", want: 30 * day},
+		{group: "prod", want: 30 * day},
+		{days: "90", group: "", want: 90 * day},
+		{days: "90", group: "prod", want: 90 * day},
+		{days: "90", groups: "prod=365,lab=7", group: "prod", want: 365 * day},
+		{days: "90", groups: "prod=365,lab=7", group: "lab", want: 7 * day},
+		{days: "90", groups: "prod=365,lab=7", group: "dev", want: 90 * day},
+		{groups: " prod = 365 , lab=7", group: "prod", want: 365 * day},
+		{groups: "prod=365", group: "", want: 30 * day},
+		{groups: "prod=365", group: "PROD", want: 30 * day},
+		{groups: "prod=0,lab=-1,dev=soon,qa", group: "prod", want: 30 * day},
+		{days: "60", groups: "prod=0,lab=-1,dev=soon,qa", group: "lab", want: 60 * day},
+		{days: "60", groups: "prod=0,lab=-1,dev=soon,qa", group: "dev", want: 60 * day},
+		{days: "60", groups: "prod=0,lab=-1,dev=soon,qa", group: "qa", want: 60 * day},
+		{days: "0", group: "", want: 30 * day},
+		{days: "-5", group: "", want: 30 * day},
+		{days: "a month", group: "", want: 30 * day},
+		{days: "90", groups: "prod=2,prod=365", group: "prod", want: 2 * day},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("ENRICHMENT_RETENTION_DAYS", tt.days)
+		t.Setenv("ENRICHMENT_RETENTION_GROUPS", tt.groups)
+		if got := database.EnrichmentRetention(tt.group); got != tt.want {
+			t.Errorf("days %q, groups %q: EnrichmentRetention(%q) = %v, want %v", tt.days, tt.groups, tt.group, got, tt.want)
+		}
+	}
+}
+
+// TestEnrichmentRetentionByGroup checks that every backend stamps an
+// enrichment result to expire after the retention of the IP's group
+func TestEnrichmentRetentionByGroup(t *testing.T) {
+	t.Setenv("ENRICHMENT_RETENTION_DAYS", "90")
+	t.Setenv("ENRICHMENT_RETENTION_GROUPS", "prod=365,lab=1")
+
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		retentions := map[string]time.Duration{
+			"10.0.0.1": 365 * 24 * time.Hour,
+			"10.0.0.2": 24 * time.Hour,
+			"10.0.0.3": 90 * 24 * time.Hour,
+		}
+		assetGroups := map[string]string{"10.0.0.1": "prod", "10.0.0.2": "lab", "10.0.0.3": ""}
+
+		for ip, retention := range retentions {
+			if err := store.AddIP(ctx, ip); err != nil {
+				t.Fatal(err)
+			}
+			before := time.Now()
+			enrichment := &database.HttpxEnrichment{IPAddress: ip, ScanID: "scan-" + ip, AssetGroup: assetGroups[ip]}
+			if err := store.StoreEnrichmentResult(ctx, enrichment); err != nil {
+				t.Fatal(err)
+			}
+			after := time.Now()
+
+			// DynamoDB and the local store expire items at ExpirationTime
+			expires := time.Unix(enrichment.ExpirationTime, 0)
+			if expires.Before(before.Add(retention).Truncate(time.Second)) || expires.After(after.Add(retention)) {
+				t.Errorf("%s in group %q: expires at %v, want %v after it was stored", ip, assetGroups[ip], expires, retention)
+			}
+
+			page, err := store.ListEnrichmentResults(ctx, database.HistoryQuery{IPAddress: ip, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Results) != 1 || page.Results[0].AssetGroup != assetGroups[ip] {
+				t.Errorf("%s: got %+v, want the result stored with its group", ip, page.Results)
+			}
+		}
+	})
+}
+
+// enrichmentAt builds an enrichment of 10.0.0.1 by a scan at a time, with a
+// web service and its certificate on port 443
+func enrichmentAt(scanID string, at time.Time, title string, fingerprint string) *database.HttpxEnrichment {
+	return &database.HttpxEnrichment{
+		IPAddress: "10.0.0.1",
+		ScanID:    scanID,
+		Timestamp: at.Format(time.RFC3339),
+		EnrichedPorts: []database.HttpxResult{{
+			URL:          "https://10.0.0.1:443",
+			Port:         "443",
+			StatusCode:   200,
+			Title:        title,
+			ServerHeader: "nginx",
+			TLS:          database.TLSData{Chain: []database.TLSCertificate{{SubjectCN: "www.example.com", FingerprintSHA256: fingerprint}}},
+		}},
+		Services: []database.ServiceResult{{Port: 22, Module: "ssh", Service: "ssh"}},
+	}
+}
+
+// TestRecordServiceState folds three enrichments of an IP into the state of
+// its ports, checking the change events the second one emits for the title
+// and certificate that changed
+func TestRecordServiceState(t *testing.T) {
+	ctx := context.Background()
+	db := newLocalClient(t)
+	first := time.Now().UTC().Truncate(time.Second).Add(-2 * time.Hour)
+	second, third := first.Add(time.Hour), first.Add(90*time.Minute)
+
+	changes, err := db.RecordServiceState(ctx, enrichmentAt("scan-1", first, "Welcome", "aa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("first enrichment: got changes %+v, want none", changes)
+	}
+
+	// Port 22 does not answer again and keeps its state
+	next := enrichmentAt("scan-2", second, "Sign in", "bb")
+	next.Services = []database.ServiceResult{{Port: 22, Module: "ssh", Error: "connection refused"}}
+	changes, err = db.RecordServiceState(ctx, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.EnrichmentChange{
+		{
+			IPAddress:      "10.0.0.1",
+			ChangeID:       models.NewEnrichmentChangeID(second, 443, models.FieldTitle),
+			Port:           443,
+			Field:          models.FieldTitle,
+			Previous:       "Welcome",
+			Current:        "Sign in",
+			ScanID:         "scan-2",
+			PreviousScanID: "scan-1",
+			DetectedAt:     second,
+		},
+		{
+			IPAddress:      "10.0.0.1",
+			ChangeID:       models.NewEnrichmentChangeID(second, 443, models.FieldCertificateFingerprint),
+			Port:           443,
+			Field:          models.FieldCertificateFingerprint,
+			Previous:       "aa",
+			Current:        "bb",
+			ScanID:         "scan-2",
+			PreviousScanID: "scan-1",
+			DetectedAt:     second,
+		},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("second enrichment: got changes %+v, want %+v", changes, want)
+	}
+
+	last := enrichmentAt("scan-3", third, "Sign in", "bb")
+	last.Services = nil
+	changes, err = db.RecordServiceState(ctx, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("unchanged enrichment: got changes %+v, want none", changes)
+	}
+
+	states, err := db.GetServiceState(ctx, "10.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[0].Port != 22 || states[1].Port != 443 {
+		t.Fatalf("got states %+v, want ports 22 and 443", states)
+	}
+	if ssh := states[0]; ssh.Service != "ssh" || ssh.ScanID != "scan-1" || !ssh.LastSeen.Equal(first) {
+		t.Errorf("port 22: got %+v, want the state of scan-1", ssh)
+	}
+	if web := states[1]; web.Title != "Sign in" || web.ScanID != "scan-3" || !web.FirstSeen.Equal(first) ||
+		!web.LastChanged.Equal(second) || !web.LastSeen.Equal(third) {
+		t.Errorf("port 443: got %+v, want first seen by scan-1, changed by scan-2 and seen by scan-3", web)
+	}
+
+	page, err := db.ListEnrichmentChanges(ctx, database.EnrichmentChangeQuery{IPAddress: "10.0.0.1", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || !reflect.DeepEqual(page.Changes, want) {
+		t.Errorf("ListEnrichmentChanges = %+v, want the 2 changes of scan-2 stored", page)
+	}
+	page, err = db.ListEnrichmentChanges(ctx, database.EnrichmentChangeQuery{IPAddress: "10.0.0.1", Port: 443, Field: models.FieldTitle, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page.Changes, want[:1]) {
+		t.Errorf("ListEnrichmentChanges of the title = %+v, want %+v", page.Changes, want[:1])
+	}
+
+	// Deleting the IP deletes the state of its ports and their changes
+	if err := db.DeleteIPServiceState(ctx, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	states, err = db.GetServiceState(ctx, "10.0.0.1", 0)
+	if err != nil || len(states) != 0 {
+		t.Errorf("state after deleting: got %+v, %v", states, err)
+	}
+	page, err = db.ListEnrichmentChanges(ctx, database.EnrichmentChangeQuery{IPAddress: "10.0.0.1", Limit: 10})
+	if err != nil || len(page.Changes) != 0 {
+		t.Errorf("changes after deleting: got %+v, %v", page.Changes, err)
+	}
+}
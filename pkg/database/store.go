@@ -0,0 +1,351 @@
+// pkg/database/store.go
+
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Store is the storage behind IPs, schedules, results, open ports and
+// enrichment. DynamoDBStore is used in Lambda; PostgresStore and MemoryStore
+// can take its place.
+type Store interface {
+	IPStore
+	ScheduleStore
+	ResultStore
+	OpenPortStore
+	EnrichmentStore
+}
+
+// IPStore keeps the IP inventory
+type IPStore interface {
+	AddIP(ctx context.Context, ipAddress string) error
+	// AddIPFromNetwork adds an IP, or replaces it and its metadata if it
+	// is already in the inventory
+	AddIPFromNetwork(ctx context.Context, ipAddress string, network string, hostname string, metadata models.AssetMetadata) error
+	// GetIP returns one IP, or ErrIPNotFound
+	GetIP(ctx context.Context, ipAddress string) (*models.IP, error)
+	// SetIPMetadata replaces the metadata of an IP, or returns ErrIPNotFound
+	SetIPMetadata(ctx context.Context, ipAddress string, metadata models.AssetMetadata) error
+	// ListIPs returns a page of the inventory in the order and with the
+	// filters the query asks for
+	ListIPs(ctx context.Context, query IPQuery) (IPPage, error)
+	GetIPsByNetwork(ctx context.Context, network string) ([]models.IP, error)
+	// DeleteIP removes an IP along with its schedules, open ports, scan
+	// results and enrichment data
+	DeleteIP(ctx context.Context, ipAddress string) error
+}
+
+// ScheduleStore keeps scan schedules and hands out their due runs
+type ScheduleStore interface {
+	AddSchedule(ctx context.Context, ipAddress string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error)
+	// AddSelectorSchedule adds a schedule that scans every IP the selector
+	// matches at the time of each run
+	AddSelectorSchedule(ctx context.Context, selector models.AssetSelector, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (string, error)
+	UpdateSchedule(ctx context.Context, scheduleID string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) error
+	UpdateScheduleStatus(ctx context.Context, scheduleID string, enabled bool) error
+	DeleteSchedule(ctx context.Context, scheduleID string) error
+	DeleteIPSchedules(ctx context.Context, ipAddress string) error
+	GetSchedulesForIP(ctx context.Context, ipAddress string) ([]models.Schedule, error)
+	GetScheduleByID(ctx context.Context, scheduleID string) (*models.Schedule, error)
+	// GetSelectorSchedules returns the schedules of selectors, oldest first
+	GetSelectorSchedules(ctx context.Context) ([]models.Schedule, error)
+	// GetDueSchedules pages through enabled schedules whose NextRun has
+	// passed. Tokens are opaque and only valid for the store that made them.
+	GetDueSchedules(ctx context.Context, now time.Time, scheduleType string, pageSize int, token string) ([]models.ScheduleScan, string, error)
+	ClaimScheduleRun(ctx context.Context, scan models.ScheduleScan, now time.Time) (bool, error)
+	ReleaseScheduleRun(ctx context.Context, scan models.ScheduleScan) error
+	// SchedulesUsePortSet reports whether any schedule scans with the named port set
+	SchedulesUsePortSet(ctx context.Context, portSet string) (bool, error)
+	// SchedulesUseProfile reports whether any schedule scans with the named profile
+	SchedulesUseProfile(ctx context.Context, profile string) (bool, error)
+}
+
+// ResultStore keeps the results of each scan batch and the final summary of
+// each scan
+type ResultStore interface {
+	StoreScanResult(ctx context.Context, ipAddress string, scanID string, protocol string, profile string, openPorts []models.Port, scanDuration time.Duration, portsScanned int, stateCounts models.PortStateCounts, watchedPorts []models.Port) error
+	StoreFinalScanSummary(ctx context.Context, ipAddress string, scanID string, protocol string, profile string, scanStatus string, openPorts []models.Port, portsProbed string, scanDuration time.Duration, portsScanned int, stateCounts models.PortStateCounts, useHistoricalPorts bool) error
+	// ListScanResults returns a page of the final summaries of the scans of an IP
+	ListScanResults(ctx context.Context, query HistoryQuery) (ScanResultPage, error)
+	GetLastCompletedSummary(ctx context.Context, ipAddress string, protocol string, excludeScanID string) (*models.ScanResult, error)
+}
+
+// OpenPortStore tracks the ports found open on each IP, per protocol
+type OpenPortStore interface {
+	GetOpenPorts(ctx context.Context, ipAddress string) ([]int, error)
+	GetOpenPortsByProtocol(ctx context.Context, ipAddress string, protocol string) ([]int, error)
+	StoreOpenPorts(ctx context.Context, ipAddress string, openPorts []int, replaceExisting bool) error
+	StoreOpenPortsByProtocol(ctx context.Context, ipAddress string, protocol string, openPorts []int, replaceExisting bool) error
+}
+
+// EnrichmentStore keeps HTTP enrichment results
+type EnrichmentStore interface {
+	StoreEnrichmentResult(ctx context.Context, enrichment *HttpxEnrichment) error
+	ListEnrichmentResults(ctx context.Context, query HistoryQuery) (EnrichmentPage, error)
+	GetEnrichmentResultByScan(ctx context.Context, ipAddress string, scanID string) (*HttpxEnrichment, error)
+	GetLatestEnrichmentResult(ctx context.Context, ipAddress string) (*HttpxEnrichment, error)
+	DeleteIPEnrichments(ctx context.Context, ipAddress string) error
+}
+
+// ErrScheduleNotFound is returned for schedule IDs that do not exist
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// ErrIPNotFound is returned for IPs that are not in the inventory
+var ErrIPNotFound = errors.New("IP not found")
+
+// Retention of scan results and enrichment data. Enrichment retention can be
+// changed per asset group, see EnrichmentRetention.
+const (
+	resultRetention     = 30 * 24 * time.Hour
+	enrichmentRetention = 30 * 24 * time.Hour
+)
+
+// EnrichmentRetention returns how long the enrichment results of IPs in an
+// asset group are kept. ENRICHMENT_RETENTION_GROUPS sets the days of
+// particular groups as group=days pairs separated by commas, such as
+// "prod=365,lab=7"; ENRICHMENT_RETENTION_DAYS sets those of the other IPs.
+// Entries that are not a positive number of days are ignored.
+func EnrichmentRetention(group string) time.Duration {
+	retention := enrichmentRetention
+	if days, err := strconv.Atoi(os.Getenv("ENRICHMENT_RETENTION_DAYS")); err == nil && days > 0 {
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+	if group == "" {
+		return retention
+	}
+
+	for _, entry := range strings.Split(os.Getenv("ENRICHMENT_RETENTION_GROUPS"), ",") {
+		name, value, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(name) != group {
+			continue
+		}
+		if days, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour
+		}
+	}
+	return retention
+}
+
+func errNoEnrichmentForScan(ipAddress string, scanID string) error {
+	return fmt.Errorf("no enrichment result found for IP %s and scan ID %s", ipAddress, scanID)
+}
+
+func errNoEnrichment(ipAddress string) error {
+	return fmt.Errorf("no enrichment results found for IP %s", ipAddress)
+}
+
+// prepareEnrichment stamps an enrichment result before it is stored, to
+// expire after the retention of its asset group
+func prepareEnrichment(enrichment *HttpxEnrichment, now time.Time) {
+	if enrichment.Timestamp == "" {
+		enrichment.Timestamp = now.Format(time.RFC3339)
+	}
+	enrichment.ExpirationTime = now.Add(EnrichmentRetention(enrichment.AssetGroup)).Unix()
+}
+
+// encodeToken and decodeToken convert a cursor to and from the opaque token
+// handed to callers
+func encodeToken(cursor interface{}) (string, error) {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeToken(token string, cursor interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, cursor)
+}
+
+// encodeDispatchCursor and decodeDispatchCursor convert a dispatch cursor to
+// and from its continuation token
+func encodeDispatchCursor(cursor dispatchCursor) (string, error) {
+	return encodeToken(cursor)
+}
+
+func decodeDispatchCursor(token string) (dispatchCursor, error) {
+	var cursor dispatchCursor
+	if token == "" {
+		return cursor, nil
+	}
+	if decodeToken(token, &cursor) != nil {
+		return dispatchCursor{}, ErrInvalidContinuationToken
+	}
+	return cursor, nil
+}
+
+// mergeOpenPorts returns the union of two port lists
+func mergeOpenPorts(existing []int, found []int) []int {
+	portsMap := make(map[int]bool)
+	for _, port := range existing {
+		portsMap[port] = true
+	}
+	for _, port := range found {
+		portsMap[port] = true
+	}
+
+	merged := make([]int, 0, len(portsMap))
+	for port := range portsMap {
+		merged = append(merged, port)
+	}
+	sort.Ints(merged)
+	return merged
+}
+
+// finalSummaryPorts works out the ports a final summary lists: every port
+// ever found open on the IP when useHistoricalPorts is set and any are
+// known, otherwise the ports of this scan
+func finalSummaryPorts(ctx context.Context, store OpenPortStore, ipAddress string, protocol string, openPorts []models.Port, useHistoricalPorts bool) []models.Port {
+	if !useHistoricalPorts {
+		return openPorts
+	}
+
+	completeOpenPorts, err := store.GetOpenPortsByProtocol(ctx, ipAddress, protocol)
+	if err != nil {
+		log.Printf("Error getting complete open ports for IP %s: %v", ipAddress, err)
+		return openPorts // Use current ports if can't get historical
+	}
+	if len(completeOpenPorts) == 0 {
+		return openPorts
+	}
+
+	finalOpenPorts := make([]models.Port, 0, len(completeOpenPorts))
+	for _, portNum := range completeOpenPorts {
+		finalOpenPorts = append(finalOpenPorts, models.Port{
+			Number:   portNum,
+			Protocol: models.NormalizeProtocol(protocol),
+			State:    "open",
+			Latency:  1 * time.Millisecond,
+		})
+	}
+	return finalOpenPorts
+}
+
+// resultTimestampLayout keeps the nanoseconds of a result's time, at a fixed
+// width so the keys of an IP's results sort in time order
+const resultTimestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// resultTimestamp returns the key of a result stored at t
+func resultTimestamp(t time.Time) string {
+	return t.UTC().Format(resultTimestampLayout)
+}
+
+// newFinalSummary builds the final summary of a scan as every backend
+// stores it. Ports keep only their identity and what banner grabbing found.
+func newFinalSummary(ipAddress string, scanID string, protocol string, profile string, scanStatus string,
+	finalOpenPorts []models.Port, portsProbed string, scanDuration time.Duration, portsScanned int, stateCounts models.PortStateCounts, now time.Time) models.ScanResult {
+
+	ports := make([]models.Port, 0, len(finalOpenPorts))
+	for _, port := range finalOpenPorts {
+		ports = append(ports, models.Port{
+			Number:   port.Number,
+			Protocol: models.NormalizeProtocol(port.Protocol),
+			State:    "open",
+			Latency:  1 * time.Millisecond,
+			Service:  port.Service,
+			Product:  port.Product,
+			Version:  port.Version,
+			Banner:   port.Banner,
+		})
+	}
+
+	return models.ScanResult{
+		IPAddress:      ipAddress,
+		ScanTimestamp:  resultTimestamp(now),
+		ScanID:         scanID,
+		OpenPorts:      ports,
+		ScanDuration:   int(scanDuration.Milliseconds()),
+		PortsScanned:   portsScanned,
+		Protocol:       models.NormalizeProtocol(protocol),
+		StateCounts:    &stateCounts,
+		Profile:        profile,
+		ExpirationTime: now.Add(resultRetention).Unix(),
+		IsFinalSummary: true,
+		ScanStatus:     scanStatus,
+		PortsProbed:    portsProbed,
+	}
+}
+
+// isCompletedSummary reports whether a result is the final summary of a
+// completed scan. Summaries written before scans were tracked have no
+// status and were only stored once the last batch arrived.
+func isCompletedSummary(result models.ScanResult) bool {
+	return result.IsFinalSummary && (result.ScanStatus == "" || result.ScanStatus == models.ScanStatusCompleted)
+}
+
+// readSchedule fills in the timing of a stored schedule. Schedules stored
+// before cron expressions existed run at the interval of their type.
+func readSchedule(schedule models.Schedule) models.Schedule {
+	schedule.ScheduleTiming = schedule.ScheduleTiming.ForScheduleType(schedule.ScheduleType)
+	return schedule
+}
+
+// sortSchedules orders schedules oldest first
+func sortSchedules(schedules []models.Schedule) {
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].CreatedAt.Equal(schedules[j].CreatedAt) {
+			return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+		}
+		return schedules[i].ScheduleID < schedules[j].ScheduleID
+	})
+}
+
+// scheduleScan returns the pending scan of a due schedule
+func scheduleScan(schedule models.Schedule) models.ScheduleScan {
+	return models.ScheduleScan{
+		ScheduleID:     schedule.ScheduleID,
+		IPAddress:      schedule.IPAddress,
+		Selector:       schedule.Selector,
+		ScheduleType:   schedule.ScheduleType,
+		ScheduleTiming: schedule.ScheduleTiming,
+		PortSet:        schedule.PortSet,
+		Profile:        schedule.Profile,
+		NextRun:        schedule.NextRun,
+	}
+}
+
+// Stores that page through due schedules in NextRun order rather than by
+// schedule type keep the last schedule read in the cursor
+
+func dueScheduleCursor(last models.Schedule) dispatchCursor {
+	return dispatchCursor{LastKey: map[string]string{
+		"NextRun":    last.NextRun.UTC().Format(time.RFC3339Nano),
+		"ScheduleID": last.ScheduleID,
+	}}
+}
+
+func dueScheduleAfter(cursor dispatchCursor) (*models.Schedule, error) {
+	if len(cursor.LastKey) == 0 {
+		return nil, nil
+	}
+	nextRun, err := time.Parse(time.RFC3339Nano, cursor.LastKey["NextRun"])
+	if err != nil || cursor.LastKey["ScheduleID"] == "" {
+		return nil, ErrInvalidContinuationToken
+	}
+	return &models.Schedule{ScheduleID: cursor.LastKey["ScheduleID"], NextRun: nextRun}, nil
+}
+
+// dueAfter reports whether schedule comes after last in NextRun order
+func dueAfter(schedule models.Schedule, last *models.Schedule) bool {
+	if !schedule.NextRun.Equal(last.NextRun) {
+		return schedule.NextRun.After(last.NextRun)
+	}
+	return schedule.ScheduleID > last.ScheduleID
+}
@@ -0,0 +1,534 @@
+// pkg/database/store_test.go
+
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/local"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/lib/pq"
+)
+
+// testDatabaseURL names the variable holding a PostgreSQL database the store
+// tests may create and drop tables in. PostgresStore is skipped without it.
+const testDatabaseURL = "NEXUSSCAN_TEST_DATABASE_URL"
+
+// forEachStore runs a test against an empty store of every backend
+func forEachStore(t *testing.T, test func(t *testing.T, store database.Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, database.NewMemoryStore())
+	})
+
+	t.Run("dynamodb", func(t *testing.T) {
+		tables := database.DefaultTables()
+		api, err := local.OpenStore(filepath.Join(t.TempDir(), "nexusscan.db"), tables)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { api.Close() })
+		test(t, database.NewDynamoDBStore(api, tables))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv(testDatabaseURL)
+		if url == "" {
+			t.Skipf("$%s is not set", testDatabaseURL)
+		}
+		tables := database.TablesWithPrefix(fmt.Sprintf("nexusscan-test-%d", time.Now().UnixNano()))
+		store, err := database.OpenPostgresStore(context.Background(), url, tables)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			store.Close()
+			dropTables(t, url, tables)
+		})
+		test(t, store)
+	})
+}
+
+// dropTables removes the tables a PostgresStore created for a test
+func dropTables(t *testing.T, url string, tables database.Tables) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer db.Close()
+	for _, table := range []string{tables.IPs, tables.Schedules, tables.Results, tables.OpenPorts, tables.Enrichment} {
+		if _, err := db.Exec(`DROP TABLE IF EXISTS ` + pq.QuoteIdentifier(table)); err != nil {
+			t.Errorf("dropping %s: %v", table, err)
+		}
+	}
+}
+
+// listAll pages through the inventory, checking every page's total
+func listAll(t *testing.T, store database.Store, query database.IPQuery, wantTotal int) []string {
+	t.Helper()
+	var ips []string
+	for pages := 0; ; pages++ {
+		if pages > wantTotal {
+			t.Fatalf("ListIPs(%+v) did not finish after %d pages", query, pages)
+		}
+		page, err := store.ListIPs(context.Background(), query)
+		if err != nil {
+			t.Fatalf("ListIPs(%+v): %v", query, err)
+		}
+		if page.Total != wantTotal {
+			t.Errorf("ListIPs(%+v) total = %d, want %d", query, page.Total, wantTotal)
+		}
+		for _, ip := range page.IPs {
+			ips = append(ips, ip.IPAddress)
+		}
+		if page.NextCursor == "" {
+			return ips
+		}
+		if len(page.IPs) != query.Limit {
+			t.Errorf("ListIPs(%+v) returned a short page of %d before the last", query, len(page.IPs))
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+func TestListIPsCursors(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		all := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}
+		for _, ip := range all {
+			metadata := models.AssetMetadata{Group: "web"}
+			if ip == "10.0.0.5" {
+				metadata.Group = "db"
+			}
+			if err := store.AddIPFromNetwork(ctx, ip, "10.0.0.0/29", "", metadata); err != nil {
+				t.Fatal(err)
+			}
+		}
+		scanned := []string{"10.0.0.2", "10.0.0.4"}
+		for _, ip := range scanned {
+			if err := store.StoreScanResult(ctx, ip, "scan-"+ip, models.ProtocolTCP, "", nil, time.Second, 100, models.PortStateCounts{}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// IPs are added in address order, usually within the same second, so
+		// pages must break ties by address without skipping or repeating any
+		reversed := append([]string{}, all...)
+		sort.Sort(sort.Reverse(sort.StringSlice(reversed)))
+
+		tests := []struct {
+			name  string
+			query database.IPQuery
+			want  []string
+		}{
+			{name: "created", query: database.IPQuery{Limit: 2}, want: all},
+			{name: "created descending", query: database.IPQuery{Limit: 2, Descending: true}, want: reversed},
+			{name: "one per page", query: database.IPQuery{Limit: 1}, want: all},
+			{name: "single page", query: database.IPQuery{Limit: 10}, want: all},
+			{name: "last scanned", query: database.IPQuery{SortBy: database.SortByLastScanned, Limit: 2},
+				want: []string{"10.0.0.1", "10.0.0.3", "10.0.0.5", "10.0.0.2", "10.0.0.4"}},
+			{name: "never scanned", query: database.IPQuery{SortBy: database.SortByLastScanned, Limit: 2, ScannedBefore: time.Unix(1, 0)},
+				want: []string{"10.0.0.1", "10.0.0.3", "10.0.0.5"}},
+			{name: "selector", query: database.IPQuery{Limit: 3, Selector: models.AssetSelector{Group: "web"}},
+				want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got := listAll(t, store, tt.query, len(tt.want))
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("ListIPs(%+v) = %v, want %v", tt.query, got, tt.want)
+				}
+			})
+		}
+
+		t.Run("cursor of another listing", func(t *testing.T) {
+			page, err := store.ListIPs(ctx, database.IPQuery{Limit: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.ListIPs(ctx, database.IPQuery{Limit: 1, Descending: true, Cursor: page.NextCursor})
+			if !errors.Is(err, database.ErrInvalidCursor) {
+				t.Errorf("ListIPs with a cursor of another order = %v, want %v", err, database.ErrInvalidCursor)
+			}
+			_, err = store.ListIPs(ctx, database.IPQuery{Limit: 1, Cursor: "not-a-cursor"})
+			if !errors.Is(err, database.ErrInvalidCursor) {
+				t.Errorf("ListIPs with a malformed cursor = %v, want %v", err, database.ErrInvalidCursor)
+			}
+		})
+	})
+}
+
+func TestGetDueSchedulesPages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		want := map[string]bool{}
+		for i := 1; i <= 5; i++ {
+			id, err := store.AddSchedule(ctx, fmt.Sprintf("10.0.0.%d", i), "hourly", models.ScheduleTiming{}, "top100", "", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want[id] = true
+		}
+		if _, err := store.AddSchedule(ctx, "10.0.0.9", "hourly", models.ScheduleTiming{}, "top100", "", false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AddSchedule(ctx, "10.0.0.9", "daily", models.ScheduleTiming{}, "top100", "", true); err != nil {
+			t.Fatal(err)
+		}
+
+		// The daily schedule is due too, but is not an hourly one
+		at := time.Now().Add(25 * time.Hour)
+		if scans, _, err := store.GetDueSchedules(ctx, time.Now(), "hourly", 10, ""); err != nil || len(scans) != 0 {
+			t.Fatalf("GetDueSchedules before NextRun = %d schedules, %v; want none", len(scans), err)
+		}
+
+		got := map[string]bool{}
+		token := ""
+		for pages := 0; ; pages++ {
+			if pages > len(want) {
+				t.Fatal("GetDueSchedules did not finish")
+			}
+			scans, next, err := store.GetDueSchedules(ctx, at, "hourly", 2, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, scan := range scans {
+				if got[scan.ScheduleID] {
+					t.Errorf("schedule %s returned twice", scan.ScheduleID)
+				}
+				got[scan.ScheduleID] = true
+			}
+			if next == "" {
+				break
+			}
+			token = next
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("GetDueSchedules returned %v, want %v", got, want)
+		}
+	})
+}
+
+// TestAddIPAgain checks that adding an IP already in the inventory, as an
+// overlapping range does, keeps its history and merges its metadata
+func TestAddIPAgain(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		first := models.AssetMetadata{Group: "web", Owner: "alice", Tags: map[string]string{"env": "prod", "team": "core"}}
+		if err := store.AddIPFromNetwork(ctx, "10.0.0.1", "10.0.0.0/30", "", first); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.StoreScanResult(ctx, "10.0.0.1", "scan-1", models.ProtocolTCP, "", nil, time.Second, 100, models.PortStateCounts{}, nil); err != nil {
+			t.Fatal(err)
+		}
+		before, err := store.GetIP(ctx, "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if before.LastScanned.IsZero() {
+			t.Fatal("IP not marked scanned")
+		}
+
+		again := models.AssetMetadata{Owner: "bob", Tags: map[string]string{"env": "staging", "site": "fra"}}
+		if err := store.AddIPFromNetwork(ctx, "10.0.0.1", "10.0.0.0/24", "", again); err != nil {
+			t.Fatal(err)
+		}
+		after, err := store.GetIP(ctx, "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !after.CreatedAt.Equal(before.CreatedAt) || !after.LastScanned.Equal(before.LastScanned) {
+			t.Errorf("added %v, last scanned %v; want %v and %v kept", after.CreatedAt, after.LastScanned, before.CreatedAt, before.LastScanned)
+		}
+		if after.Network != "10.0.0.0/30" {
+			t.Errorf("network = %q, want the first %q kept", after.Network, "10.0.0.0/30")
+		}
+		want := models.AssetMetadata{Group: "web", Owner: "bob", Tags: map[string]string{"env": "staging", "team": "core", "site": "fra"}}
+		if !reflect.DeepEqual(after.AssetMetadata, want) {
+			t.Errorf("metadata = %+v, want %+v", after.AssetMetadata, want)
+		}
+
+		// Adding an IP on its own leaves its metadata as it is
+		if err := store.AddIP(ctx, "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := store.GetIP(ctx, "10.0.0.1"); err != nil || !reflect.DeepEqual(got.AssetMetadata, want) {
+			t.Errorf("metadata after AddIP = %+v, %v; want %+v", got, err, want)
+		}
+	})
+}
+
+// TestSelectorSchedules checks that a schedule keeps its selector, so the
+// IPs it scans can be picked when it runs
+func TestSelectorSchedules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		selector := models.AssetSelector{Group: "acme", Tags: map[string]string{"env": "prod"}}
+		id, err := store.AddSelectorSchedule(ctx, selector, "hourly", models.ScheduleTiming{}, "top100", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AddSchedule(ctx, "10.0.0.1", "hourly", models.ScheduleTiming{}, "top100", "", true); err != nil {
+			t.Fatal(err)
+		}
+
+		schedules, err := store.GetSelectorSchedules(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(schedules) != 1 || schedules[0].ScheduleID != id {
+			t.Fatalf("GetSelectorSchedules = %+v, want schedule %s", schedules, id)
+		}
+		if got := schedules[0].Selector; got == nil || got.String() != selector.String() || schedules[0].IPAddress != "" {
+			t.Errorf("selector schedule targets %q %v, want %v", schedules[0].IPAddress, got, selector)
+		}
+
+		schedule, err := store.GetScheduleByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schedule.Selector == nil || schedule.Selector.String() != selector.String() {
+			t.Errorf("GetScheduleByID selector = %v, want %v", schedule.Selector, selector)
+		}
+
+		scans, _, err := store.GetDueSchedules(ctx, time.Now().Add(2*time.Hour), "hourly", 10, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		selectors := map[string]string{}
+		for _, scan := range scans {
+			selectors[scan.ScheduleID] = "<nil>"
+			if scan.Selector != nil {
+				selectors[scan.ScheduleID] = scan.Selector.String()
+			}
+		}
+		if len(scans) != 2 || selectors[id] != selector.String() {
+			t.Errorf("GetDueSchedules selectors = %v, want %s for schedule %s", selectors, selector, id)
+		}
+	})
+}
+
+// TestClaimScheduleRunRace has several dispatchers claim the same due run at
+// once. Exactly one may win.
+func TestClaimScheduleRunRace(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		id, err := store.AddSchedule(ctx, "10.0.0.1", "hourly", models.ScheduleTiming{}, "top100", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		at := time.Now().Add(2 * time.Hour)
+		scans, _, err := store.GetDueSchedules(ctx, at, "hourly", 10, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(scans) != 1 || scans[0].ScheduleID != id {
+			t.Fatalf("GetDueSchedules = %+v, want schedule %s", scans, id)
+		}
+		scan := scans[0]
+
+		const dispatchers = 8
+		var wg sync.WaitGroup
+		claims := make(chan bool, dispatchers)
+		for i := 0; i < dispatchers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, err := store.ClaimScheduleRun(ctx, scan, at)
+				if err != nil {
+					t.Error(err)
+				}
+				claims <- claimed
+			}()
+		}
+		wg.Wait()
+		close(claims)
+
+		won := 0
+		for claimed := range claims {
+			if claimed {
+				won++
+			}
+		}
+		if won != 1 {
+			t.Fatalf("%d dispatchers claimed the run, want 1", won)
+		}
+
+		schedule, err := store.GetScheduleByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !schedule.NextRun.After(at) {
+			t.Errorf("NextRun after the claim = %s, want after %s", schedule.NextRun, at)
+		}
+		if scans, _, err := store.GetDueSchedules(ctx, at, "hourly", 10, ""); err != nil || len(scans) != 0 {
+			t.Errorf("GetDueSchedules after the claim = %d schedules, %v; want none", len(scans), err)
+		}
+
+		// A released run is due again and can be claimed once more
+		if err := store.ReleaseScheduleRun(ctx, scan); err != nil {
+			t.Fatal(err)
+		}
+		scans, _, err = store.GetDueSchedules(ctx, at, "hourly", 10, "")
+		if err != nil || len(scans) != 1 {
+			t.Fatalf("GetDueSchedules after the release = %d schedules, %v; want 1", len(scans), err)
+		}
+		if claimed, err := store.ClaimScheduleRun(ctx, scans[0], at); err != nil || !claimed {
+			t.Errorf("ClaimScheduleRun after the release = %v, %v; want true", claimed, err)
+		}
+		if claimed, err := store.ClaimScheduleRun(ctx, scan, at); err != nil || claimed {
+			t.Errorf("ClaimScheduleRun with a stale NextRun = %v, %v; want false", claimed, err)
+		}
+	})
+}
+
+// TestUpdateMissingSchedule checks that updating a schedule that does not
+// exist fails without creating it
+func TestUpdateMissingSchedule(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		id, err := store.AddSchedule(ctx, "10.0.0.1", "hourly", models.ScheduleTiming{}, "top100", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.DeleteSchedule(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.UpdateSchedule(ctx, id, "daily", models.ScheduleTiming{}, "top100", "", true); !errors.Is(err, database.ErrScheduleNotFound) {
+			t.Errorf("UpdateSchedule of a deleted schedule: %v, want %v", err, database.ErrScheduleNotFound)
+		}
+		if err := store.UpdateScheduleStatus(ctx, id, false); !errors.Is(err, database.ErrScheduleNotFound) {
+			t.Errorf("UpdateScheduleStatus of a deleted schedule: %v, want %v", err, database.ErrScheduleNotFound)
+		}
+		if schedule, err := store.GetScheduleByID(ctx, id); !errors.Is(err, database.ErrScheduleNotFound) {
+			t.Errorf("GetScheduleByID after the updates = %+v, %v; want %v", schedule, err, database.ErrScheduleNotFound)
+		}
+	})
+}
+
+func TestEnrichmentHistoryPages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		if err := store.AddIP(ctx, "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+		var timestamps []string
+		for i := 0; i < 5; i++ {
+			timestamp := start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+			timestamps = append(timestamps, timestamp)
+			err := store.StoreEnrichmentResult(ctx, &database.HttpxEnrichment{
+				IPAddress: "10.0.0.1",
+				Timestamp: timestamp,
+				ScanID:    fmt.Sprintf("scan-%d", i),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.StoreEnrichmentResult(ctx, &database.HttpxEnrichment{IPAddress: "10.0.0.2", ScanID: "other"}); err != nil {
+			t.Fatal(err)
+		}
+		newestFirst := append([]string{}, timestamps...)
+		sort.Sort(sort.Reverse(sort.StringSlice(newestFirst)))
+
+		for _, oldestFirst := range []bool{false, true} {
+			query := database.HistoryQuery{IPAddress: "10.0.0.1", OldestFirst: oldestFirst, Limit: 2}
+			var got []string
+			for pages := 0; ; pages++ {
+				if pages > len(timestamps) {
+					t.Fatalf("ListEnrichmentResults(%+v) did not finish", query)
+				}
+				page, err := store.ListEnrichmentResults(ctx, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page.Total != len(timestamps) {
+					t.Errorf("ListEnrichmentResults(%+v) total = %d, want %d", query, page.Total, len(timestamps))
+				}
+				for _, enrichment := range page.Results {
+					got = append(got, enrichment.Timestamp)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+
+			want := newestFirst
+			if oldestFirst {
+				want = timestamps
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("ListEnrichmentResults(oldestFirst=%t) = %v, want %v", oldestFirst, got, want)
+			}
+		}
+
+		page, err := store.ListEnrichmentResults(ctx, database.HistoryQuery{IPAddress: "10.0.0.1", Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = store.ListEnrichmentResults(ctx, database.HistoryQuery{IPAddress: "10.0.0.2", Limit: 1, Cursor: page.NextCursor})
+		if !errors.Is(err, database.ErrInvalidCursor) {
+			t.Errorf("ListEnrichmentResults with a cursor of another IP = %v, want %v", err, database.ErrInvalidCursor)
+		}
+	})
+}
+
+func TestScanSummariesKeptApart(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store database.Store) {
+		ctx := context.Background()
+		if err := store.AddIP(ctx, "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+
+		// TCP and UDP summaries of several scans finishing at the same time
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < 10; i++ {
+			for _, protocol := range []string{models.ProtocolTCP, models.ProtocolUDP} {
+				wg.Add(1)
+				go func(scanID string, protocol string) {
+					defer wg.Done()
+					errs <- store.StoreFinalScanSummary(ctx, "10.0.0.1", scanID, protocol, "", models.ScanStatusCompleted,
+						nil, "1-1000", time.Second, 100, models.PortStateCounts{}, false)
+				}(fmt.Sprintf("scan-%d", i), protocol)
+			}
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		page, err := store.ListScanResults(ctx, database.HistoryQuery{IPAddress: "10.0.0.1", Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept := map[string]bool{}
+		for _, result := range page.Results {
+			kept[result.ScanID+"/"+result.Protocol] = true
+		}
+		if len(page.Results) != 20 || len(kept) != 20 {
+			t.Errorf("kept %d summaries of %d scans and protocols, want 20 of 20", len(page.Results), len(kept))
+		}
+	})
+}
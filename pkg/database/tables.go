@@ -0,0 +1,97 @@
+// pkg/database/tables.go
+
+package database
+
+import (
+	"os"
+)
+
+// DefaultTablePrefix is the prefix of every table name when TABLE_PREFIX is
+// not set
+const DefaultTablePrefix = "nexusscan"
+
+// Tables holds the name of each table. Giving each stage its own prefix lets
+// several deployments share one account.
+type Tables struct {
+	IPs                  string
+	Schedules            string
+	Results              string
+	OpenPorts            string
+	Enrichment           string
+	PortSets             string
+	ScanProfiles         string
+	ScanJobs             string
+	ScanBatches          string
+	PortChanges          string
+	NotificationChannels string
+	NotificationRules    string
+	NotificationFailures string
+	Exports              string
+	Certificates         string
+	ServiceState         string
+	EnrichmentChanges    string
+}
+
+// TablesWithPrefix names every table prefix-<table>, matching template.yaml
+func TablesWithPrefix(prefix string) Tables {
+	return Tables{
+		IPs:                  prefix + "-ips",
+		Schedules:            prefix + "-schedules",
+		Results:              prefix + "-results",
+		OpenPorts:            prefix + "-open-ports",
+		Enrichment:           prefix + "-enrichment",
+		PortSets:             prefix + "-port-sets",
+		ScanProfiles:         prefix + "-scan-profiles",
+		ScanJobs:             prefix + "-scan-jobs",
+		ScanBatches:          prefix + "-scan-batches",
+		PortChanges:          prefix + "-port-changes",
+		NotificationChannels: prefix + "-notification-channels",
+		NotificationRules:    prefix + "-notification-rules",
+		NotificationFailures: prefix + "-notification-failures",
+		Exports:              prefix + "-exports",
+		Certificates:         prefix + "-certificates",
+		ServiceState:         prefix + "-service-state",
+		EnrichmentChanges:    prefix + "-enrichment-changes",
+	}
+}
+
+// DefaultTables returns the table names of a deployment with the default prefix
+func DefaultTables() Tables {
+	return TablesWithPrefix(DefaultTablePrefix)
+}
+
+// TablesFromEnv reads table names from the environment. TABLE_PREFIX names
+// every table at once; a variable per table, such as IPS_TABLE, overrides a
+// single name.
+func TablesFromEnv() Tables {
+	prefix := os.Getenv("TABLE_PREFIX")
+	if prefix == "" {
+		prefix = DefaultTablePrefix
+	}
+	tables := TablesWithPrefix(prefix)
+
+	for variable, name := range map[string]*string{
+		"IPS_TABLE":                   &tables.IPs,
+		"SCHEDULES_TABLE":             &tables.Schedules,
+		"RESULTS_TABLE":               &tables.Results,
+		"OPEN_PORTS_TABLE":            &tables.OpenPorts,
+		"ENRICHMENT_TABLE":            &tables.Enrichment,
+		"PORT_SETS_TABLE":             &tables.PortSets,
+		"SCAN_PROFILES_TABLE":         &tables.ScanProfiles,
+		"SCAN_JOBS_TABLE":             &tables.ScanJobs,
+		"SCAN_BATCHES_TABLE":          &tables.ScanBatches,
+		"PORT_CHANGES_TABLE":          &tables.PortChanges,
+		"NOTIFICATION_CHANNELS_TABLE": &tables.NotificationChannels,
+		"NOTIFICATION_RULES_TABLE":    &tables.NotificationRules,
+		"NOTIFICATION_FAILURES_TABLE": &tables.NotificationFailures,
+		"EXPORTS_TABLE":               &tables.Exports,
+		"CERTIFICATES_TABLE":          &tables.Certificates,
+		"SERVICE_STATE_TABLE":         &tables.ServiceState,
+		"ENRICHMENT_CHANGES_TABLE":    &tables.EnrichmentChanges,
+	} {
+		if value := os.Getenv(variable); value != "" {
+			*name = value
+		}
+	}
+	return tables
+}
@@ -0,0 +1,33 @@
+// pkg/database/tls.go
+
+package database
+
+// TLSResult is what TLS inspection found on an open port that speaks TLS
+type TLSResult struct {
+	Port         int              `json:"port" dynamodbav:"Port"`
+	Versions     []TLSVersion     `json:"versions,omitempty" dynamodbav:"Versions,omitempty"`
+	ServerNames  []TLSServerName  `json:"serverNames,omitempty" dynamodbav:"ServerNames,omitempty"`
+	Certificates []TLSCertificate `json:"certificates,omitempty" dynamodbav:"Certificates,omitempty"` // Chain presented for the hostname, or without SNI
+	OCSPStapled  bool             `json:"ocspStapled" dynamodbav:"OCSPStapled"`
+	OCSPStatus   string           `json:"ocspStatus,omitempty" dynamodbav:"OCSPStatus,omitempty"` // good, revoked or unknown
+	Weaknesses   []string         `json:"weaknesses,omitempty" dynamodbav:"Weaknesses,omitempty"`
+	Error        string           `json:"error,omitempty" dynamodbav:"Error,omitempty"`
+	Timestamp    string           `json:"timestamp,omitempty" dynamodbav:"Timestamp,omitempty"`
+}
+
+// TLSVersion is a protocol version the server accepts and the cipher
+// suites it accepts with it, in the order it prefers them
+type TLSVersion struct {
+	Version      string   `json:"version" dynamodbav:"Version"`
+	CipherSuites []string `json:"cipherSuites,omitempty" dynamodbav:"CipherSuites,omitempty"`
+}
+
+// TLSServerName is the leaf certificate presented for one SNI value. An
+// empty server name means no SNI was sent.
+type TLSServerName struct {
+	ServerName        string `json:"serverName" dynamodbav:"ServerName"`
+	SubjectCN         string `json:"subjectCn,omitempty" dynamodbav:"SubjectCN,omitempty"`
+	FingerprintSHA256 string `json:"fingerprintSha256,omitempty" dynamodbav:"FingerprintSHA256,omitempty"`
+	Mismatched        bool   `json:"mismatched,omitempty" dynamodbav:"Mismatched,omitempty"`
+	Error             string `json:"error,omitempty" dynamodbav:"Error,omitempty"`
+}
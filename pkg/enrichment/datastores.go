@@ -0,0 +1,211 @@
+// pkg/enrichment/datastores.go
+
+package enrichment
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// Modules for databases and caches check whether data can be read without
+// credentials, using only read commands
+
+type redisModule struct{}
+
+func (redisModule) Name() string       { return "redis" }
+func (redisModule) Services() []string { return []string{"redis"} }
+func (redisModule) Ports() []int       { return []int{6379} }
+
+// Enrich runs INFO server, which needs authentication when a password is
+// set and is refused in protected mode
+func (redisModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "*2\r\n$4\r\nINFO\r\n$6\r\nserver\r\n"); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	info := &database.DatastoreResult{Product: "Redis"}
+	switch {
+	case strings.HasPrefix(line, "-"):
+		info.Details = map[string]string{"error": strings.TrimPrefix(line, "-")}
+	case strings.HasPrefix(line, "$"):
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > 1<<20 {
+			return fmt.Errorf("invalid INFO reply %q", line)
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return err
+		}
+		info.Unauthenticated = true
+		info.Details = map[string]string{}
+		for _, field := range strings.Split(string(body), "\n") {
+			key, value, found := strings.Cut(strings.TrimSpace(field), ":")
+			if !found {
+				continue
+			}
+			switch key {
+			case "redis_version":
+				info.Version = value
+			case "redis_mode", "os", "tcp_port", "uptime_in_days":
+				info.Details[key] = value
+			}
+		}
+	default:
+		return fmt.Errorf("not a Redis server")
+	}
+	result.Redis = info
+	return nil
+}
+
+type memcachedModule struct{}
+
+func (memcachedModule) Name() string       { return "memcached" }
+func (memcachedModule) Services() []string { return []string{"memcached"} }
+func (memcachedModule) Ports() []int       { return []int{11211} }
+
+// Enrich runs stats, which any client may run unless SASL is enabled
+func (memcachedModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "stats\r\n"); err != nil {
+		return err
+	}
+
+	info := &database.DatastoreResult{Product: "Memcached", Details: map[string]string{}}
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "END" {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "STAT" {
+			info.Details["error"] = line
+			break
+		}
+		info.Unauthenticated = true
+		switch fields[1] {
+		case "version":
+			info.Version = fields[2]
+		case "curr_items", "uptime", "curr_connections":
+			info.Details[fields[1]] = fields[2]
+		}
+	}
+	if !info.Unauthenticated && info.Details["error"] == "" {
+		return fmt.Errorf("not a Memcached server")
+	}
+	result.Memcached = info
+	return nil
+}
+
+type elasticsearchModule struct{}
+
+func (elasticsearchModule) Name() string       { return "elasticsearch" }
+func (elasticsearchModule) Services() []string { return []string{"elasticsearch"} }
+func (elasticsearchModule) Ports() []int       { return []int{9200, 9201} }
+
+// Enrich fetches the cluster information at / over HTTP, then HTTPS, and
+// counts the indices when it is readable
+func (elasticsearchModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	hostPort := net.JoinHostPort(target.IPAddress, strconv.Itoa(port))
+
+	var response *http.Response
+	var base string
+	var err error
+	for _, scheme := range []string{"http", "https"} {
+		base = scheme + "://" + hostPort
+		response, err = elasticsearchGet(ctx, client, base+"/")
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	info := &database.DatastoreResult{Product: "Elasticsearch", Details: map[string]string{}}
+	switch response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		info.Details["error"] = response.Status
+		result.Elasticsearch = info
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	var cluster struct {
+		ClusterName string `json:"cluster_name"`
+		Tagline     string `json:"tagline"`
+		Version     struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&cluster); err != nil || cluster.Version.Number == "" {
+		return fmt.Errorf("not an Elasticsearch server")
+	}
+	if cluster.Version.Distribution == "opensearch" {
+		info.Product = "OpenSearch"
+	}
+	info.Version = cluster.Version.Number
+	info.Unauthenticated = true
+	info.Details["cluster_name"] = cluster.ClusterName
+
+	if indices, err := elasticsearchGet(ctx, client, base+"/_cat/indices?format=json&h=index"); err == nil {
+		defer indices.Body.Close()
+		var list []map[string]interface{}
+		if indices.StatusCode == http.StatusOK && json.NewDecoder(io.LimitReader(indices.Body, 8<<20)).Decode(&list) == nil {
+			info.Details["indices"] = strconv.Itoa(len(list))
+		}
+	}
+	result.Elasticsearch = info
+	return nil
+}
+
+func elasticsearchGet(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	return client.Do(request)
+}
@@ -0,0 +1,201 @@
+// pkg/enrichment/datastores_test.go
+
+package enrichment
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// replyScript plays a server that reads a request of the given length and
+// answers with reply
+func replyScript(requestLength int, reply string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		if _, err := io.ReadFull(conn, make([]byte, requestLength)); err != nil {
+			return
+		}
+		io.WriteString(conn, reply)
+	}
+}
+
+// redisInfo is the start of an INFO server reply
+const redisInfo = "# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\nos:Linux 6.1.0 x86_64\r\ntcp_port:6379\r\nexecutable:/usr/bin/redis-server\r\n"
+
+func TestRedisEnrich(t *testing.T) {
+	request := len("*2\r\n$4\r\nINFO\r\n$6\r\nserver\r\n")
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    *database.DatastoreResult
+		wantErr bool
+	}{
+		{
+			name:  "INFO",
+			reply: fmt.Sprintf("$%d\r\n%s\r\n", len(redisInfo), redisInfo),
+			want: &database.DatastoreResult{
+				Product:         "Redis",
+				Version:         "7.2.4",
+				Unauthenticated: true,
+				Details:         map[string]string{"redis_mode": "standalone", "os": "Linux 6.1.0 x86_64", "tcp_port": "6379"},
+			},
+		},
+		{
+			name:  "password set",
+			reply: "-NOAUTH Authentication required.\r\n",
+			want:  &database.DatastoreResult{Product: "Redis", Details: map[string]string{"error": "NOAUTH Authentication required."}},
+		},
+		{
+			name:  "empty INFO",
+			reply: "$0\r\n\r\n",
+			want:  &database.DatastoreResult{Product: "Redis", Unauthenticated: true, Details: map[string]string{}},
+		},
+		{name: "INFO cut short", reply: "$100\r\nredis_version:7.2.4\r\n", wantErr: true},
+		{name: "null reply", reply: "$-1\r\n", wantErr: true},
+		{name: "bad length", reply: "$abc\r\n", wantErr: true},
+		{name: "oversized", reply: "$2000000\r\n", wantErr: true},
+		{name: "line cut short", reply: "-ERR", wantErr: true},
+		{name: "HTTP", reply: "HTTP/1.1 400 Bad Request\r\n\r\n", wantErr: true},
+		{name: "no reply", reply: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := enrichScript(t, redisModule{}, replyScript(request, tt.reply))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.Redis, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.Redis, tt.want)
+		}
+	}
+}
+
+func TestMemcachedEnrich(t *testing.T) {
+	request := len("stats\r\n")
+
+	tests := []struct {
+		name    string
+		reply   string
+		want    *database.DatastoreResult
+		wantErr bool
+	}{
+		{
+			name:  "stats",
+			reply: "STAT pid 1\r\nSTAT uptime 3600\r\nSTAT version 1.6.21\r\nSTAT curr_connections 2\r\nSTAT curr_items 42\r\nEND\r\n",
+			want: &database.DatastoreResult{
+				Product:         "Memcached",
+				Version:         "1.6.21",
+				Unauthenticated: true,
+				Details:         map[string]string{"uptime": "3600", "curr_connections": "2", "curr_items": "42"},
+			},
+		},
+		{
+			name:  "SASL required",
+			reply: "CLIENT_ERROR unauthenticated\r\n",
+			want:  &database.DatastoreResult{Product: "Memcached", Details: map[string]string{"error": "CLIENT_ERROR unauthenticated"}},
+		},
+		{name: "no stats", reply: "END\r\n", wantErr: true},
+		{name: "stats cut short", reply: "STAT pid 1\r\nSTAT version 1.6", wantErr: true},
+		{name: "no reply", reply: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := enrichScript(t, memcachedModule{}, replyScript(request, tt.reply))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.Memcached, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.Memcached, tt.want)
+		}
+	}
+}
+
+func TestElasticsearchEnrich(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		cluster string
+		indices string
+		want    *database.DatastoreResult
+		wantErr bool
+	}{
+		{
+			name:    "open cluster",
+			status:  http.StatusOK,
+			cluster: `{"cluster_name":"logs","version":{"number":"8.13.0"},"tagline":"You Know, for Search"}`,
+			indices: `[{"index":"logs-1"},{"index":"logs-2"}]`,
+			want: &database.DatastoreResult{
+				Product:         "Elasticsearch",
+				Version:         "8.13.0",
+				Unauthenticated: true,
+				Details:         map[string]string{"cluster_name": "logs", "indices": "2"},
+			},
+		},
+		{
+			name:    "OpenSearch without index listing",
+			status:  http.StatusOK,
+			cluster: `{"cluster_name":"search","version":{"number":"2.11.0","distribution":"opensearch"}}`,
+			want: &database.DatastoreResult{
+				Product:         "OpenSearch",
+				Version:         "2.11.0",
+				Unauthenticated: true,
+				Details:         map[string]string{"cluster_name": "search"},
+			},
+		},
+		{
+			name:   "security enabled",
+			status: http.StatusUnauthorized,
+			want:   &database.DatastoreResult{Product: "Elasticsearch", Details: map[string]string{"error": "401 Unauthorized"}},
+		},
+		{name: "no version", status: http.StatusOK, cluster: `{"cluster_name":"logs"}`, wantErr: true},
+		{name: "JSON cut short", status: http.StatusOK, cluster: `{"cluster_name":"logs","version":{"num`, wantErr: true},
+		{name: "HTML", status: http.StatusOK, cluster: "<html><body>It works!</body></html>", wantErr: true},
+		{name: "not found", status: http.StatusNotFound, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/_cat/indices" {
+				if tt.indices == "" {
+					http.Error(w, "forbidden", http.StatusForbidden)
+					return
+				}
+				io.WriteString(w, tt.indices)
+				return
+			}
+			w.WriteHeader(tt.status)
+			io.WriteString(w, tt.cluster)
+		}))
+		port := server.Listener.Addr().(*net.TCPAddr).Port
+
+		result := &database.ServiceResult{Port: port, Module: "elasticsearch"}
+		err := elasticsearchModule{}.Enrich(testContext(t), Target{IPAddress: "127.0.0.1"}, port, result)
+		server.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.Elasticsearch, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.Elasticsearch, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// pkg/enrichment/dns.go
+
+package enrichment
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// DNS query parameters
+const (
+	dnsTypeA     = 1
+	dnsTypeTXT   = 16
+	dnsClassIN   = 1
+	dnsClassCH   = 3
+	dnsFlagRA    = 0x0080
+	dnsFlagAA    = 0x0400
+	dnsRcodeMask = 0x000f
+
+	// dnsRecursionProbe is a name no server probed is authoritative for,
+	// so an answer to it means the server resolved it on our behalf
+	dnsRecursionProbe = "www.example.com"
+)
+
+type dnsModule struct{}
+
+func (dnsModule) Name() string       { return "dns" }
+func (dnsModule) Services() []string { return []string{"dns", "domain"} }
+func (dnsModule) Ports() []int       { return []int{53} }
+
+// Enrich asks over TCP for a name the server does not serve, with recursion
+// desired, and for its version.bind
+func (dnsModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	flags, answers, err := dnsQuery(ctx, target, port, dnsRecursionProbe, dnsTypeA, dnsClassIN)
+	if err != nil {
+		return err
+	}
+	info := &database.DNSResult{
+		RecursionAvailable: flags&dnsFlagRA != 0,
+		Recursive:          flags&dnsFlagRA != 0 && flags&dnsFlagAA == 0 && flags&dnsRcodeMask == 0 && len(answers) > 0,
+	}
+	result.DNS = info
+
+	if _, answers, err := dnsQuery(ctx, target, port, "version.bind", dnsTypeTXT, dnsClassCH); err == nil && len(answers) > 0 {
+		info.Version = answers[0]
+	}
+	return nil
+}
+
+// dnsQuery sends one query and returns the response flags and the answers
+// of the queried type, TXT records as their text
+func dnsQuery(ctx context.Context, target Target, port int, name string, qtype, qclass uint16) (uint16, []string, error) {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer conn.Close()
+
+	id := uint16(rand.Intn(1 << 16))
+	query := []byte{0x00, 0x00} // Length prefix of DNS over TCP
+	query = binary.BigEndian.AppendUint16(query, id)
+	query = append(query, 0x01, 0x00) // Standard query, recursion desired
+	query = append(query, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	for _, label := range strings.Split(name, ".") {
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0x00)
+	query = binary.BigEndian.AppendUint16(query, qtype)
+	query = binary.BigEndian.AppendUint16(query, qclass)
+	binary.BigEndian.PutUint16(query, uint16(len(query)-2))
+
+	if _, err := conn.Write(query); err != nil {
+		return 0, nil, err
+	}
+
+	var prefix [2]byte
+	if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+		return 0, nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return 0, nil, err
+	}
+	return dnsAnswers(response, id, qtype)
+}
+
+// dnsAnswers returns the flags of the response to query id and its answers
+// of type qtype, TXT records as their text
+func dnsAnswers(response []byte, id uint16, qtype uint16) (uint16, []string, error) {
+	if len(response) < 12 || binary.BigEndian.Uint16(response) != id {
+		return 0, nil, fmt.Errorf("not a DNS response")
+	}
+
+	flags := binary.BigEndian.Uint16(response[2:])
+	questions := int(binary.BigEndian.Uint16(response[4:]))
+	count := int(binary.BigEndian.Uint16(response[6:]))
+
+	var err error
+	pos := 12
+	for i := 0; i < questions; i++ {
+		if pos, err = dnsSkipName(response, pos); err != nil {
+			return flags, nil, err
+		}
+		pos += 4
+	}
+
+	var answers []string
+	for i := 0; i < count; i++ {
+		if pos, err = dnsSkipName(response, pos); err != nil {
+			return flags, answers, err
+		}
+		if pos+10 > len(response) {
+			return flags, answers, fmt.Errorf("truncated DNS answer")
+		}
+		rtype := binary.BigEndian.Uint16(response[pos:])
+		length := int(binary.BigEndian.Uint16(response[pos+8:]))
+		pos += 10
+		if pos+length > len(response) {
+			return flags, answers, fmt.Errorf("truncated DNS answer")
+		}
+		data := response[pos : pos+length]
+		pos += length
+
+		if rtype != qtype {
+			continue
+		}
+		switch rtype {
+		case dnsTypeTXT:
+			var text strings.Builder
+			for len(data) > 0 && int(data[0]) < len(data) {
+				text.Write(data[1 : 1+data[0]])
+				data = data[1+data[0]:]
+			}
+			answers = append(answers, text.String())
+		case dnsTypeA:
+			if len(data) == 4 {
+				answers = append(answers, fmt.Sprintf("%d.%d.%d.%d", data[0], data[1], data[2], data[3]))
+			}
+		}
+	}
+	return flags, answers, nil
+}
+
+// dnsSkipName returns the offset after a possibly compressed name
+func dnsSkipName(message []byte, pos int) (int, error) {
+	for pos < len(message) {
+		length := int(message[pos])
+		switch {
+		case length == 0:
+			return pos + 1, nil
+		case length&0xc0 == 0xc0:
+			return pos + 2, nil
+		default:
+			pos += length + 1
+		}
+	}
+	return 0, fmt.Errorf("truncated DNS name")
+}
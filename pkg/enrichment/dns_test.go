@@ -0,0 +1,209 @@
+// pkg/enrichment/dns_test.go
+
+package enrichment
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// Question sections of an A query for example.com and a CHAOS TXT query for
+// version.bind
+var (
+	dnsQuestion        = []byte("\x07example\x03com\x00\x00\x01\x00\x01")
+	dnsVersionQuestion = []byte("\x07version\x04bind\x00\x00\x10\x00\x03")
+)
+
+// dnsResponse builds a response to query id with a question and answers
+func dnsResponse(id, flags uint16, question []byte, answers ...[]byte) []byte {
+	response := binary.BigEndian.AppendUint16(nil, id)
+	response = binary.BigEndian.AppendUint16(response, flags)
+	response = binary.BigEndian.AppendUint16(response, 1)
+	response = binary.BigEndian.AppendUint16(response, uint16(len(answers)))
+	response = append(response, 0, 0, 0, 0)
+	response = append(response, question...)
+	for _, answer := range answers {
+		response = append(response, answer...)
+	}
+	return response
+}
+
+// dnsRecord builds a resource record whose name points at the question
+func dnsRecord(rtype uint16, data []byte) []byte {
+	record := []byte{0xc0, 0x0c}
+	record = binary.BigEndian.AppendUint16(record, rtype)
+	record = append(record, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10) // Class IN, TTL
+	record = binary.BigEndian.AppendUint16(record, uint16(len(data)))
+	return append(record, data...)
+}
+
+func TestDNSAnswers(t *testing.T) {
+	const id = 0x1234
+	answerA := dnsResponse(id, 0x8180, dnsQuestion, dnsRecord(dnsTypeA, []byte{93, 184, 216, 34}))
+
+	tests := []struct {
+		name        string
+		response    []byte
+		qtype       uint16
+		wantFlags   uint16
+		wantAnswers []string
+		wantErr     bool
+	}{
+		{name: "A", response: answerA, qtype: dnsTypeA, wantFlags: 0x8180, wantAnswers: []string{"93.184.216.34"}},
+		{
+			name: "CNAME before A",
+			response: dnsResponse(id, 0x8180, dnsQuestion,
+				dnsRecord(5, []byte("\x03www\xc0\x0c")),
+				dnsRecord(dnsTypeA, []byte{10, 0, 0, 1}),
+			),
+			qtype:       dnsTypeA,
+			wantFlags:   0x8180,
+			wantAnswers: []string{"10.0.0.1"},
+		},
+		{
+			name:        "uncompressed answer name",
+			response:    dnsResponse(id, 0x8180, dnsQuestion, append([]byte("\x07example\x03com\x00"), dnsRecord(dnsTypeA, []byte{10, 0, 0, 2})[2:]...)),
+			qtype:       dnsTypeA,
+			wantFlags:   0x8180,
+			wantAnswers: []string{"10.0.0.2"},
+		},
+		{
+			name:      "A of the wrong length",
+			response:  dnsResponse(id, 0x8180, dnsQuestion, dnsRecord(dnsTypeA, make([]byte, 16))),
+			qtype:     dnsTypeA,
+			wantFlags: 0x8180,
+		},
+		{
+			name:        "version.bind",
+			response:    dnsResponse(id, 0x8400, dnsVersionQuestion, dnsRecord(dnsTypeTXT, []byte("\x049.18\x03.24"))),
+			qtype:       dnsTypeTXT,
+			wantFlags:   0x8400,
+			wantAnswers: []string{"9.18.24"},
+		},
+		{
+			name:        "TXT string past its record",
+			response:    dnsResponse(id, 0x8400, dnsVersionQuestion, dnsRecord(dnsTypeTXT, []byte("\x09ab"))),
+			qtype:       dnsTypeTXT,
+			wantFlags:   0x8400,
+			wantAnswers: []string{""},
+		},
+		{name: "refused", response: dnsResponse(id, 0x8105, dnsQuestion), qtype: dnsTypeA, wantFlags: 0x8105},
+		{name: "answer cut short", response: answerA[:len(answerA)-2], qtype: dnsTypeA, wantFlags: 0x8180, wantErr: true},
+		{name: "answer header cut short", response: answerA[:len(dnsQuestion)+12+6], qtype: dnsTypeA, wantFlags: 0x8180, wantErr: true},
+		{name: "question cut short", response: answerA[:15], qtype: dnsTypeA, wantFlags: 0x8180, wantErr: true},
+		{name: "other query", response: dnsResponse(id+1, 0x8180, dnsQuestion), qtype: dnsTypeA, wantErr: true},
+		{name: "header cut short", response: answerA[:11], qtype: dnsTypeA, wantErr: true},
+		{name: "empty", response: nil, qtype: dnsTypeA, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		flags, answers, err := dnsAnswers(tt.response, id, tt.qtype)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if flags != tt.wantFlags || !reflect.DeepEqual(answers, tt.wantAnswers) {
+			t.Errorf("%s: got flags 0x%04x answers %v, want 0x%04x and %v", tt.name, flags, answers, tt.wantFlags, tt.wantAnswers)
+		}
+	}
+
+	everyPrefix(t, "DNS response", answerA, func(data []byte) {
+		dnsAnswers(data, id, dnsTypeA)
+	})
+}
+
+// dnsScript plays a DNS server over TCP that answers each query with the
+// response respond builds for its ID and type, hanging up when that is nil
+func dnsScript(respond func(id, qtype uint16, question []byte) []byte) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		var prefix [2]byte
+		if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+		if _, err := io.ReadFull(conn, query); err != nil || len(query) < 16 {
+			return
+		}
+		qtype := binary.BigEndian.Uint16(query[len(query)-4:])
+		response := respond(binary.BigEndian.Uint16(query), qtype, query[12:])
+		if response == nil {
+			return
+		}
+		conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+	}
+}
+
+func TestDNSEnrich(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(id, qtype uint16, question []byte) []byte
+		want    *database.DNSResult
+		wantErr bool
+	}{
+		{
+			name: "open resolver",
+			respond: func(id, qtype uint16, question []byte) []byte {
+				if qtype == dnsTypeTXT {
+					return dnsResponse(id, 0x8580, question, dnsRecord(dnsTypeTXT, []byte("\x079.18.24")))
+				}
+				return dnsResponse(id, 0x8180, question, dnsRecord(dnsTypeA, []byte{93, 184, 216, 34}))
+			},
+			want: &database.DNSResult{RecursionAvailable: true, Recursive: true, Version: "9.18.24"},
+		},
+		{
+			name: "authoritative only",
+			respond: func(id, qtype uint16, question []byte) []byte {
+				return dnsResponse(id, 0x8105, question)
+			},
+			want: &database.DNSResult{},
+		},
+		{
+			name: "recursion offered but failing",
+			respond: func(id, qtype uint16, question []byte) []byte {
+				if qtype == dnsTypeTXT {
+					return nil
+				}
+				return dnsResponse(id, 0x8182, question)
+			},
+			want: &database.DNSResult{RecursionAvailable: true},
+		},
+		{
+			name: "answers for the zone it serves",
+			respond: func(id, qtype uint16, question []byte) []byte {
+				return dnsResponse(id, 0x8580, question, dnsRecord(dnsTypeA, []byte{10, 0, 0, 1}))
+			},
+			want: &database.DNSResult{RecursionAvailable: true},
+		},
+		{
+			name: "other query's response",
+			respond: func(id, qtype uint16, question []byte) []byte {
+				return dnsResponse(id+1, 0x8180, question)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no response",
+			respond: func(uint16, uint16, []byte) []byte { return nil },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := enrichScript(t, dnsModule{}, dnsScript(tt.respond))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.DNS, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.DNS, tt.want)
+		}
+	}
+}
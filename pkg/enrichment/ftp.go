@@ -0,0 +1,59 @@
+// pkg/enrichment/ftp.go
+
+package enrichment
+
+import (
+	"context"
+	"net/textproto"
+	"strings"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+type ftpModule struct{}
+
+func (ftpModule) Name() string       { return "ftp" }
+func (ftpModule) Services() []string { return []string{"ftp"} }
+func (ftpModule) Ports() []int       { return []int{21} }
+
+// Enrich lists the server's features and tries to log in as anonymous
+func (ftpModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	_, greeting, err := text.ReadResponse(220)
+	if err != nil {
+		return err
+	}
+	info := &database.FTPResult{Banner: firstLine(greeting)}
+	result.FTP = info
+
+	// FEAT answers with the features on the lines between the first and last
+	if _, features, err := command(text, 211, "FEAT"); err == nil {
+		lines := strings.Split(features, "\n")
+		for _, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line != "" && !strings.EqualFold(line, "End") {
+				info.Features = append(info.Features, line)
+			}
+		}
+	}
+
+	code, _, err := command(text, 0, "USER anonymous")
+	if err != nil {
+		return err
+	}
+	if code == 331 {
+		code, _, err = command(text, 0, "PASS anonymous@example.com")
+		if err != nil {
+			return err
+		}
+	}
+	info.AnonymousLogin = code == 230
+
+	text.Cmd("QUIT")
+	return nil
+}
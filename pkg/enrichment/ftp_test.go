@@ -0,0 +1,110 @@
+// pkg/enrichment/ftp_test.go
+
+package enrichment
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// ftpScript plays an FTP server that greets with greeting and answers each
+// command from replies, hanging up at an empty reply. Without replies it
+// hangs up after the greeting.
+func ftpScript(greeting string, replies map[string]string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		io.WriteString(conn, greeting)
+		if replies == nil {
+			return
+		}
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			verb := strings.ToUpper(strings.Fields(line + " x")[0])
+			if verb == "QUIT" {
+				io.WriteString(conn, "221 Goodbye.\r\n")
+				return
+			}
+			reply, ok := replies[verb]
+			if !ok {
+				reply = "500 Unknown command.\r\n"
+			}
+			if reply == "" {
+				return
+			}
+			io.WriteString(conn, reply)
+		}
+	}
+}
+
+func TestFTPEnrich(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting string
+		replies  map[string]string
+		want     *database.FTPResult
+		wantErr  bool
+	}{
+		{
+			name:     "anonymous login",
+			greeting: "220 (vsFTPd 3.0.3)\r\n",
+			replies: map[string]string{
+				"FEAT": "211-Features:\r\n EPRT\r\n MDTM\r\n UTF8\r\n211 End\r\n",
+				"USER": "331 Please specify the password.\r\n",
+				"PASS": "230 Login successful.\r\n",
+			},
+			want: &database.FTPResult{
+				Banner:         "(vsFTPd 3.0.3)",
+				AnonymousLogin: true,
+				Features:       []string{"EPRT", "MDTM", "UTF8"},
+			},
+		},
+		{
+			name:     "anonymous refused",
+			greeting: "220-Welcome\r\n220 ProFTPD Server ready.\r\n",
+			replies: map[string]string{
+				"FEAT": "211-Features:\r\n AUTH TLS\r\n211 End\r\n",
+				"USER": "331 Anonymous login ok, send your complete email address as your password\r\n",
+				"PASS": "530 Login incorrect.\r\n",
+			},
+			want: &database.FTPResult{Banner: "Welcome", Features: []string{"AUTH TLS"}},
+		},
+		{
+			name:     "no FEAT",
+			greeting: "220 FTP server ready\r\n",
+			replies:  map[string]string{"USER": "230 Logged in without a password.\r\n"},
+			want:     &database.FTPResult{Banner: "FTP server ready", AnonymousLogin: true},
+		},
+		{
+			name:     "hangs up at FEAT",
+			greeting: "220 FTP server ready\r\n",
+			replies:  map[string]string{"FEAT": ""},
+			wantErr:  true,
+		},
+		{name: "service not available", greeting: "421 Too many connections\r\n", wantErr: true},
+		{name: "greeting cut short", greeting: "220-Welcome\r\n", wantErr: true},
+		{name: "not FTP", greeting: "+OK POP3 server ready\r\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := enrichScript(t, ftpModule{}, ftpScript(tt.greeting, tt.replies))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.FTP, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.FTP, tt.want)
+		}
+	}
+}
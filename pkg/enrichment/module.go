@@ -0,0 +1,246 @@
+// pkg/enrichment/module.go
+
+// Package enrichment runs protocol modules against the open ports of a
+// host. Each module understands one kind of service, such as SSH or SMB,
+// and is picked by the service detected on a port or, when none was, by
+// the port number.
+package enrichment
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+)
+
+// Module enriches one kind of service
+type Module interface {
+	// Name keys the module's results
+	Name() string
+	// Services are the detected services the module runs on
+	Services() []string
+	// Ports are where the module runs when no service was detected
+	Ports() []int
+	// Enrich probes a port and fills the module's section of result. The
+	// context carries the deadline for the whole probe.
+	Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error
+}
+
+// Target is the host whose ports are enriched
+type Target struct {
+	IPAddress string
+	Hostname  string // Announced where a protocol carries a server name
+}
+
+// Limits on module runs
+const (
+	DefaultConcurrency = 25
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Options controls how many modules run at once and for how long
+type Options struct {
+	Concurrency int
+	Timeout     time.Duration // Limit on each module run
+}
+
+func (o Options) withDefaults() Options {
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	return o
+}
+
+// webServices are detected services the web prober handles
+var webServices = map[string]bool{"http": true, "https": true}
+
+var (
+	registryMu sync.RWMutex
+	registry   = []Module{
+		sshModule{},
+		smtpModule{},
+		ftpModule{},
+		rdpModule{},
+		smbModule{},
+		redisModule{},
+		memcachedModule{},
+		mongoModule{},
+		elasticsearchModule{},
+		dnsModule{},
+	}
+)
+
+// Register adds a module. Modules registered later run alongside the
+// built-in ones on the services and ports they claim.
+func Register(module Module) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, module)
+}
+
+// Select returns the modules for a port. A detected service picks the
+// modules that claim it; a port whose service is unknown, or has no
+// module, falls back to the modules that claim the port number.
+func Select(service string, port int) []Module {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var selected []Module
+	if service != "" {
+		for _, module := range registry {
+			if contains(module.Services(), service) {
+				selected = append(selected, module)
+			}
+		}
+		if len(selected) > 0 {
+			return selected
+		}
+	}
+	for _, module := range registry {
+		if containsPort(module.Ports(), port) {
+			selected = append(selected, module)
+		}
+	}
+	return selected
+}
+
+// IsWeb reports whether a port should be probed for web services: its
+// service was detected as HTTP, or it is unknown and no module claims the
+// port
+func IsWeb(service string, port int) bool {
+	if webServices[service] {
+		return true
+	}
+	return service == "" && len(Select("", port)) == 0
+}
+
+// Detect fills in the service of every port missing from known by
+// grabbing its banner. Ports that stay silent or are not recognised are
+// left out.
+func Detect(ctx context.Context, target Target, ports []int, known map[int]string, opts Options) map[int]string {
+	opts = opts.withDefaults()
+
+	services := make(map[int]string, len(ports))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, opts.Concurrency)
+
+	for _, port := range ports {
+		if service := known[port]; service != "" {
+			services[port] = service
+			continue
+		}
+
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			info := scanner.GrabBanner(ctx, target.IPAddress, port, opts.Timeout)
+			if info.Service != "" {
+				mu.Lock()
+				services[port] = info.Service
+				mu.Unlock()
+			}
+		}(port)
+	}
+	wg.Wait()
+	return services
+}
+
+// Run runs the modules selected for each port and returns their results in
+// port order. A module that fails keeps its result, with the error.
+func Run(ctx context.Context, target Target, ports []int, services map[int]string, opts Options) []database.ServiceResult {
+	opts = opts.withDefaults()
+
+	type run struct {
+		module Module
+		port   int
+	}
+	var runs []run
+	for _, port := range ports {
+		for _, module := range Select(services[port], port) {
+			runs = append(runs, run{module: module, port: port})
+		}
+	}
+
+	results := make([]database.ServiceResult, len(runs))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, opts.Concurrency)
+
+	for i, r := range runs {
+		results[i] = database.ServiceResult{
+			Port:    r.port,
+			Service: services[r.port],
+			Module:  r.module.Name(),
+		}
+
+		wg.Add(1)
+		go func(r run, result *database.ServiceResult) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				result.Error = ctx.Err().Error()
+				return
+			}
+			defer func() { <-slots }()
+
+			runCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+			if err := r.module.Enrich(runCtx, target, r.port, result); err != nil {
+				result.Error = err.Error()
+			}
+			result.Timestamp = time.Now().UTC().Format(time.RFC3339)
+		}(r, &results[i])
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Port < results[j].Port })
+	return results
+}
+
+// dial connects to a port with the context's deadline applied to every
+// read and write
+func dial(ctx context.Context, target Target, port int) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target.IPAddress, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+// pkg/enrichment/module_test.go
+
+package enrichment
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// serveScript listens on a loopback port and plays the part of a server on
+// every connection made to it with handle, which owns the connection
+func serveScript(t *testing.T, handle func(conn net.Conn)) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// testContext returns a context that gives up after five seconds
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// enrichScript runs a module against a server played by handle
+func enrichScript(t *testing.T, module Module, handle func(conn net.Conn)) (*database.ServiceResult, error) {
+	t.Helper()
+	port := serveScript(t, handle)
+	result := &database.ServiceResult{Port: port, Module: module.Name()}
+	err := module.Enrich(testContext(t), Target{IPAddress: "127.0.0.1"}, port, result)
+	return result, err
+}
+
+// everyPrefix hands parse each truncation of message, from empty to one byte
+// short, and reports any that makes it panic
+func everyPrefix(t *testing.T, name string, message []byte, parse func(data []byte)) {
+	t.Helper()
+	for n := 0; n < len(message); n++ {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s cut to %d of %d bytes: panic: %v", name, n, len(message), r)
+				}
+			}()
+			parse(append([]byte(nil), message[:n]...))
+		}()
+	}
+}
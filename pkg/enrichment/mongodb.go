@@ -0,0 +1,289 @@
+// pkg/enrichment/mongodb.go
+
+package enrichment
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// mongoOpMsg is the opcode of OP_MSG, the message every supported MongoDB
+// version accepts
+const mongoOpMsg = 2013
+
+// mongoUnauthorized is the error code of a command refused for lack of
+// authentication
+const mongoUnauthorized = 13
+
+type mongoModule struct{}
+
+func (mongoModule) Name() string       { return "mongodb" }
+func (mongoModule) Services() []string { return []string{"mongodb"} }
+func (mongoModule) Ports() []int       { return []int{27017, 27018} }
+
+// Enrich reads the version with buildInfo, which needs no credentials, and
+// then lists the databases, which does when access control is enabled
+func (mongoModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	build, err := mongoCommand(conn, 1, "buildInfo")
+	if err != nil {
+		return err
+	}
+	info := &database.DatastoreResult{Product: "MongoDB", Details: map[string]string{}}
+	if version, ok := build["version"].(string); ok {
+		info.Version = version
+	}
+	result.MongoDB = info
+
+	databases, err := mongoCommand(conn, 2, "listDatabases")
+	if err != nil {
+		return err
+	}
+	if mongoOK(databases) {
+		info.Unauthenticated = true
+		var names []string
+		list, _ := databases["databases"].([]interface{})
+		for _, entry := range list {
+			if db, isDoc := entry.(map[string]interface{}); isDoc {
+				if name, isString := db["name"].(string); isString {
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		info.Details["databases"] = strings.Join(names, ",")
+		return nil
+	}
+
+	if code, _ := databases["code"].(int32); code != mongoUnauthorized {
+		if message, _ := databases["errmsg"].(string); message != "" {
+			info.Details["error"] = message
+		}
+	}
+	return nil
+}
+
+// mongoOK reports whether a reply succeeded. Servers send ok as a double,
+// though some send an integer.
+func mongoOK(reply map[string]interface{}) bool {
+	switch ok := reply["ok"].(type) {
+	case float64:
+		return ok == 1
+	case int32:
+		return ok == 1
+	case int64:
+		return ok == 1
+	}
+	return false
+}
+
+// mongoCommand runs a command against the admin database and returns the
+// reply document
+func mongoCommand(conn net.Conn, requestID int32, name string) (map[string]interface{}, error) {
+	var doc bytes.Buffer
+	bsonInt32(&doc, name, 1)
+	if name == "listDatabases" {
+		bsonBool(&doc, "nameOnly", true)
+	}
+	bsonString(&doc, "$db", "admin")
+
+	body := bsonDocument(doc.Bytes())
+	message := make([]byte, 16+4+1, 16+4+1+len(body))
+	binary.LittleEndian.PutUint32(message[4:], uint32(requestID))
+	binary.LittleEndian.PutUint32(message[12:], mongoOpMsg)
+	message = append(message, body...)
+	binary.LittleEndian.PutUint32(message[0:], uint32(len(message)))
+
+	if _, err := conn.Write(message); err != nil {
+		return nil, err
+	}
+
+	var header [16]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[0:])
+	if length < 16+5 || length > 16<<20 || binary.LittleEndian.Uint32(header[12:]) != mongoOpMsg {
+		return nil, fmt.Errorf("not a MongoDB reply")
+	}
+	reply := make([]byte, length-16)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	if reply[4] != 0 {
+		return nil, fmt.Errorf("unexpected OP_MSG section %d", reply[4])
+	}
+	parsed, _, err := bsonParse(reply[5:])
+	return parsed, err
+}
+
+// The BSON this module writes and reads: a document of int32, bool and
+// string fields out, and any document in, with values decoded to Go types
+
+func bsonDocument(elements []byte) []byte {
+	doc := make([]byte, 4, 4+len(elements)+1)
+	doc = append(doc, elements...)
+	doc = append(doc, 0)
+	binary.LittleEndian.PutUint32(doc, uint32(len(doc)))
+	return doc
+}
+
+func bsonInt32(buf *bytes.Buffer, key string, value int32) {
+	buf.WriteByte(0x10)
+	buf.WriteString(key)
+	buf.WriteByte(0)
+	binary.Write(buf, binary.LittleEndian, value)
+}
+
+func bsonBool(buf *bytes.Buffer, key string, value bool) {
+	buf.WriteByte(0x08)
+	buf.WriteString(key)
+	buf.WriteByte(0)
+	if value {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+}
+
+func bsonString(buf *bytes.Buffer, key, value string) {
+	buf.WriteByte(0x02)
+	buf.WriteString(key)
+	buf.WriteByte(0)
+	binary.Write(buf, binary.LittleEndian, int32(len(value)+1))
+	buf.WriteString(value)
+	buf.WriteByte(0)
+}
+
+// bsonParse decodes a document and returns it with the bytes it used.
+// Types without a Go counterpart here are skipped.
+func bsonParse(data []byte) (map[string]interface{}, int, error) {
+	if len(data) < 5 {
+		return nil, 0, fmt.Errorf("truncated BSON document")
+	}
+	size := int(binary.LittleEndian.Uint32(data))
+	if size < 5 || size > len(data) {
+		return nil, 0, fmt.Errorf("invalid BSON document size %d", size)
+	}
+
+	doc := make(map[string]interface{})
+	pos := 4
+	for pos < size-1 {
+		kind := data[pos]
+		pos++
+		end := bytes.IndexByte(data[pos:size], 0)
+		if end < 0 {
+			return nil, 0, fmt.Errorf("unterminated BSON key")
+		}
+		key := string(data[pos : pos+end])
+		pos += end + 1
+
+		value, used, err := bsonValue(kind, data[pos:size])
+		if err != nil {
+			return nil, 0, err
+		}
+		if value != nil {
+			doc[key] = value
+		}
+		pos += used
+	}
+	return doc, size, nil
+}
+
+func bsonValue(kind byte, data []byte) (interface{}, int, error) {
+	need := func(n int) error {
+		if n > len(data) || n < 0 {
+			return fmt.Errorf("truncated BSON value")
+		}
+		return nil
+	}
+
+	switch kind {
+	case 0x01: // Double
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+	case 0x02, 0x0d, 0x0e: // String, JavaScript, symbol
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		length := int(binary.LittleEndian.Uint32(data))
+		if err := need(4 + length); err != nil || length < 1 {
+			return nil, 0, fmt.Errorf("truncated BSON string")
+		}
+		return string(data[4 : 4+length-1]), 4 + length, nil
+	case 0x03: // Document
+		doc, used, err := bsonParse(data)
+		return doc, used, err
+	case 0x04: // Array, a document keyed by index
+		doc, used, err := bsonParse(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		array := make([]interface{}, 0, len(doc))
+		for i := 0; ; i++ {
+			value, ok := doc[strconv.Itoa(i)]
+			if !ok {
+				break
+			}
+			array = append(array, value)
+		}
+		return array, used, nil
+	case 0x05: // Binary
+		if err := need(5); err != nil {
+			return nil, 0, err
+		}
+		length := int(binary.LittleEndian.Uint32(data))
+		return nil, 5 + length, need(5 + length)
+	case 0x06, 0x0a, 0x7f, 0xff: // Undefined, null, max key, min key
+		return nil, 0, nil
+	case 0x07: // ObjectId
+		return nil, 12, need(12)
+	case 0x08: // Boolean
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		return data[0] == 1, 1, nil
+	case 0x09, 0x11: // UTC datetime, timestamp
+		return nil, 8, need(8)
+	case 0x10: // Int32
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		return int32(binary.LittleEndian.Uint32(data)), 4, nil
+	case 0x12: // Int64
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return int64(binary.LittleEndian.Uint64(data)), 8, nil
+	case 0x13: // Decimal128
+		return nil, 16, need(16)
+	case 0x0b: // Regular expression, two C strings
+		first := bytes.IndexByte(data, 0)
+		if first < 0 {
+			return nil, 0, fmt.Errorf("truncated BSON regex")
+		}
+		second := bytes.IndexByte(data[first+1:], 0)
+		if second < 0 {
+			return nil, 0, fmt.Errorf("truncated BSON regex")
+		}
+		return nil, first + second + 2, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported BSON type 0x%02x", kind)
+}
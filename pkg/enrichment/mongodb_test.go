@@ -0,0 +1,252 @@
+// pkg/enrichment/mongodb_test.go
+
+package enrichment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// bsonElement builds an element of any type from its encoded value
+func bsonElement(kind byte, key string, value []byte) []byte {
+	element := append([]byte{kind}, key...)
+	element = append(element, 0)
+	return append(element, value...)
+}
+
+// bsonDouble encodes a double value
+func bsonDouble(value float64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, math.Float64bits(value))
+}
+
+// bsonStringValue encodes a string value
+func bsonStringValue(value string) []byte {
+	encoded := binary.LittleEndian.AppendUint32(nil, uint32(len(value)+1))
+	return append(append(encoded, value...), 0)
+}
+
+// bsonDoc builds a document from its elements
+func bsonDoc(elements ...[]byte) []byte {
+	return bsonDocument(bytes.Join(elements, nil))
+}
+
+// buildInfoReply is a buildInfo reply holding every type bsonParse reads or
+// skips
+var buildInfoReply = bsonDoc(
+	bsonElement(0x02, "version", bsonStringValue("7.0.5")),
+	bsonElement(0x04, "versionArray", bsonDoc(
+		bsonElement(0x10, "0", []byte{7, 0, 0, 0}),
+		bsonElement(0x10, "1", []byte{0, 0, 0, 0}),
+		bsonElement(0x10, "2", []byte{5, 0, 0, 0}),
+	)),
+	bsonElement(0x03, "openssl", bsonDoc(bsonElement(0x02, "running", bsonStringValue("OpenSSL 3.0.2")))),
+	bsonElement(0x08, "debug", []byte{0}),
+	bsonElement(0x12, "maxBsonObjectSize", binary.LittleEndian.AppendUint64(nil, 16<<20)),
+	bsonElement(0x07, "_id", make([]byte, 12)),
+	bsonElement(0x05, "key", append([]byte{3, 0, 0, 0, 0}, "abc"...)),
+	bsonElement(0x09, "localTime", make([]byte, 8)),
+	bsonElement(0x0b, "pattern", []byte("^a\x00i\x00")),
+	bsonElement(0x13, "price", make([]byte, 16)),
+	bsonElement(0x0a, "gitVersion", nil),
+	bsonElement(0x01, "ok", bsonDouble(1)),
+)
+
+func TestBSONParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "buildInfo",
+			data: buildInfoReply,
+			want: map[string]interface{}{
+				"version":           "7.0.5",
+				"versionArray":      []interface{}{int32(7), int32(0), int32(5)},
+				"openssl":           map[string]interface{}{"running": "OpenSSL 3.0.2"},
+				"debug":             false,
+				"maxBsonObjectSize": int64(16 << 20),
+				"ok":                float64(1),
+			},
+		},
+		{name: "empty document", data: bsonDoc(), want: map[string]interface{}{}},
+		{name: "trailing bytes", data: append(bsonDoc(bsonElement(0x08, "ok", []byte{1})), 0xff, 0xff), want: map[string]interface{}{"ok": true}},
+		{name: "size past the data", data: []byte{0x20, 0, 0, 0, 0}, wantErr: true},
+		{name: "size too small", data: []byte{0x04, 0, 0, 0, 0}, wantErr: true},
+		{name: "unterminated key", data: bsonDocument([]byte{0x10, 'o', 'k'}), wantErr: true},
+		{name: "empty string", data: bsonDoc(bsonElement(0x02, "s", []byte{0, 0, 0, 0})), wantErr: true},
+		{name: "string past the document", data: bsonDoc(bsonElement(0x02, "s", []byte{0xff, 0, 0, 0, 'a', 0})), wantErr: true},
+		{name: "string length overflow", data: bsonDoc(bsonElement(0x02, "s", []byte{0xff, 0xff, 0xff, 0xff, 'a', 0})), wantErr: true},
+		{name: "binary past the document", data: bsonDoc(bsonElement(0x05, "b", []byte{0xff, 0xff, 0xff, 0x7f, 0})), wantErr: true},
+		{name: "nested document past its parent", data: bsonDoc(bsonElement(0x03, "d", []byte{0x40, 0, 0, 0, 0})), wantErr: true},
+		{name: "unterminated regex", data: bsonDoc(bsonElement(0x0b, "r", []byte("^a"))), wantErr: true},
+		{name: "int32 cut short", data: bsonDoc(bsonElement(0x10, "n", []byte{1, 0})), wantErr: true},
+		{name: "unsupported type", data: bsonDoc(bsonElement(0x20, "x", []byte{1})), wantErr: true},
+		{name: "empty", data: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, _, err := bsonParse(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	everyPrefix(t, "buildInfo reply", buildInfoReply, func(data []byte) {
+		if _, _, err := bsonParse(data); err == nil {
+			t.Errorf("buildInfo reply cut to %d bytes parsed", len(data))
+		}
+	})
+}
+
+// mongoReply builds a reply message with one section of the given kind
+func mongoReply(opcode uint32, section byte, doc []byte) []byte {
+	message := make([]byte, 16, 16+5+len(doc))
+	binary.LittleEndian.PutUint32(message[12:], opcode)
+	message = append(message, 0, 0, 0, 0, section)
+	message = append(message, doc...)
+	binary.LittleEndian.PutUint32(message[0:], uint32(len(message)))
+	return message
+}
+
+// mongoScript plays a MongoDB server that answers each command with the
+// message reply returns for its name. It hangs up when that is nil, or once
+// it is sent when it is shorter than its header says.
+func mongoScript(reply func(command string) []byte) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		for {
+			var header [16]byte
+			if _, err := io.ReadFull(conn, header[:]); err != nil {
+				return
+			}
+			body := make([]byte, binary.LittleEndian.Uint32(header[0:])-16)
+			if _, err := io.ReadFull(conn, body); err != nil {
+				return
+			}
+			request, _, err := bsonParse(body[5:])
+			if err != nil {
+				return
+			}
+			command := "buildInfo"
+			if _, ok := request["listDatabases"]; ok {
+				command = "listDatabases"
+			}
+			message := reply(command)
+			if message == nil {
+				return
+			}
+			conn.Write(message)
+			if binary.LittleEndian.Uint32(message) != uint32(len(message)) {
+				return
+			}
+		}
+	}
+}
+
+// mongoReplies answers buildInfo with version 6.0.4 and listDatabases with
+// the given document
+func mongoReplies(databases []byte) func(command string) []byte {
+	return func(command string) []byte {
+		if command == "buildInfo" {
+			return mongoReply(mongoOpMsg, 0, bsonDoc(
+				bsonElement(0x02, "version", bsonStringValue("6.0.4")),
+				bsonElement(0x01, "ok", bsonDouble(1)),
+			))
+		}
+		if databases == nil {
+			return nil
+		}
+		return mongoReply(mongoOpMsg, 0, databases)
+	}
+}
+
+func TestMongoEnrich(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   func(command string) []byte
+		want    *database.DatastoreResult
+		wantErr bool
+	}{
+		{
+			name: "no access control",
+			reply: mongoReplies(bsonDoc(
+				bsonElement(0x04, "databases", bsonDoc(
+					bsonElement(0x03, "0", bsonDoc(bsonElement(0x02, "name", bsonStringValue("local")))),
+					bsonElement(0x03, "1", bsonDoc(bsonElement(0x02, "name", bsonStringValue("admin")))),
+				)),
+				bsonElement(0x10, "ok", []byte{1, 0, 0, 0}),
+			)),
+			want: &database.DatastoreResult{
+				Product:         "MongoDB",
+				Version:         "6.0.4",
+				Unauthenticated: true,
+				Details:         map[string]string{"databases": "admin,local"},
+			},
+		},
+		{
+			name: "authentication required",
+			reply: mongoReplies(bsonDoc(
+				bsonElement(0x01, "ok", bsonDouble(0)),
+				bsonElement(0x02, "errmsg", bsonStringValue("command listDatabases requires authentication")),
+				bsonElement(0x10, "code", []byte{mongoUnauthorized, 0, 0, 0}),
+			)),
+			want: &database.DatastoreResult{Product: "MongoDB", Version: "6.0.4", Details: map[string]string{}},
+		},
+		{
+			name: "other error",
+			reply: mongoReplies(bsonDoc(
+				bsonElement(0x01, "ok", bsonDouble(0)),
+				bsonElement(0x02, "errmsg", bsonStringValue("not primary")),
+				bsonElement(0x10, "code", []byte{10, 0, 0, 0}),
+			)),
+			want: &database.DatastoreResult{Product: "MongoDB", Version: "6.0.4", Details: map[string]string{"error": "not primary"}},
+		},
+		{name: "hangs up after buildInfo", reply: mongoReplies(nil), wantErr: true},
+		{
+			name:    "OP_REPLY",
+			reply:   func(string) []byte { return mongoReply(1, 0, bsonDoc()) },
+			wantErr: true,
+		},
+		{
+			name:    "document sequence section",
+			reply:   func(string) []byte { return mongoReply(mongoOpMsg, 1, bsonDoc()) },
+			wantErr: true,
+		},
+		{
+			name:    "reply cut short",
+			reply:   func(string) []byte { return mongoReply(mongoOpMsg, 0, buildInfoReply)[:60] },
+			wantErr: true,
+		},
+		{
+			name:    "malformed document",
+			reply:   func(string) []byte { return mongoReply(mongoOpMsg, 0, []byte{0x40, 0, 0, 0, 0}) },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := enrichScript(t, mongoModule{}, mongoScript(tt.reply))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.MongoDB, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.MongoDB, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// pkg/enrichment/rdp.go
+
+package enrichment
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// RDP security protocols, as requested in an RDP_NEG_REQ
+const (
+	rdpProtocolRDP      = 0x00
+	rdpProtocolSSL      = 0x01
+	rdpProtocolHybrid   = 0x02 // CredSSP, which is Network Level Authentication
+	rdpProtocolHybridEx = 0x08 // CredSSP with early user authorization
+)
+
+// rdpHybridRequired is the RDP_NEG_FAILURE code of a server that only
+// accepts CredSSP
+const rdpHybridRequired = 0x05
+
+var rdpProtocolNames = map[uint32]string{
+	rdpProtocolRDP:      "rdp",
+	rdpProtocolSSL:      "tls",
+	rdpProtocolHybrid:   "credssp",
+	rdpProtocolHybridEx: "credssp-early-auth",
+}
+
+type rdpModule struct{}
+
+func (rdpModule) Name() string       { return "rdp" }
+func (rdpModule) Services() []string { return []string{"rdp", "ms-wbt-server"} }
+func (rdpModule) Ports() []int       { return []int{3389} }
+
+// Enrich negotiates the security protocol three times: offering all of
+// them to see what the server prefers, offering legacy RDP security alone
+// to see if it is still accepted, and offering TLS alone to see if NLA is
+// required
+func (rdpModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	selected, failure, err := rdpNegotiate(ctx, target, port, rdpProtocolSSL|rdpProtocolHybrid|rdpProtocolHybridEx)
+	if err != nil {
+		return err
+	}
+	info := &database.RDPResult{}
+	if failure == 0 {
+		info.SelectedProtocol = rdpProtocolName(selected)
+	}
+	result.RDP = info
+
+	if selected, failure, err := rdpNegotiate(ctx, target, port, rdpProtocolRDP); err == nil {
+		info.StandardSecurity = failure == 0 && selected == rdpProtocolRDP
+	}
+
+	if selected, failure, err := rdpNegotiate(ctx, target, port, rdpProtocolSSL); err == nil {
+		info.TLSSupported = failure == 0 && selected == rdpProtocolSSL
+		info.NLARequired = failure == rdpHybridRequired
+	}
+	return nil
+}
+
+// rdpNegotiate sends an X.224 Connection Request carrying an RDP_NEG_REQ
+// and returns the protocol the server selected or its failure code. A
+// server that answers without a negotiation response only speaks legacy
+// RDP security.
+func rdpNegotiate(ctx context.Context, target Target, port int, protocols uint32) (uint32, uint32, error) {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	request := []byte{
+		0x03, 0x00, 0x00, 0x13, // TPKT, 19 bytes
+		0x0e, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00, // X.224 Connection Request
+		0x01, 0x00, 0x08, 0x00, // RDP_NEG_REQ, 8 bytes
+		0x00, 0x00, 0x00, 0x00, // Requested protocols
+	}
+	binary.LittleEndian.PutUint32(request[15:], protocols)
+	if _, err := conn.Write(request); err != nil {
+		return 0, 0, err
+	}
+
+	var tpkt [4]byte
+	if _, err := io.ReadFull(conn, tpkt[:]); err != nil {
+		return 0, 0, err
+	}
+	if tpkt[0] != 0x03 {
+		return 0, 0, fmt.Errorf("not an RDP server")
+	}
+	length := int(binary.BigEndian.Uint16(tpkt[2:]))
+	if length < 11 || length > 512 {
+		return 0, 0, fmt.Errorf("invalid TPKT length %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, 0, err
+	}
+	return rdpConfirm(body)
+}
+
+// rdpConfirm reads the selected protocol or failure code from the body of an
+// X.224 Connection Confirm, after its TPKT header
+func rdpConfirm(body []byte) (uint32, uint32, error) {
+	if len(body) < 7 || body[1]&0xf0 != 0xd0 {
+		return 0, 0, fmt.Errorf("not an X.224 Connection Confirm")
+	}
+	if len(body) < 15 {
+		return rdpProtocolRDP, 0, nil
+	}
+
+	value := binary.LittleEndian.Uint32(body[11:15])
+	switch body[7] {
+	case 0x02: // RDP_NEG_RSP
+		return value, 0, nil
+	case 0x03: // RDP_NEG_FAILURE
+		return 0, value, nil
+	}
+	return 0, 0, fmt.Errorf("unknown RDP negotiation message %d", body[7])
+}
+
+func rdpProtocolName(protocol uint32) string {
+	if name, ok := rdpProtocolNames[protocol]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", protocol)
+}
@@ -0,0 +1,147 @@
+// pkg/enrichment/rdp_test.go
+
+package enrichment
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// rdpConfirmBody builds an X.224 Connection Confirm body, with an RDP
+// negotiation message unless kind is 0
+func rdpConfirmBody(kind byte, value uint32) []byte {
+	body := []byte{0x0e, 0xd0, 0x00, 0x00, 0x12, 0x34, 0x00}
+	if kind == 0 {
+		return body
+	}
+	body = append(body, kind, 0x00, 0x08, 0x00)
+	return binary.LittleEndian.AppendUint32(body, value)
+}
+
+func TestRDPConfirm(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         []byte
+		wantSelected uint32
+		wantFailure  uint32
+		wantErr      bool
+	}{
+		{name: "CredSSP selected", body: rdpConfirmBody(0x02, rdpProtocolHybrid), wantSelected: rdpProtocolHybrid},
+		{name: "TLS selected", body: rdpConfirmBody(0x02, rdpProtocolSSL), wantSelected: rdpProtocolSSL},
+		{name: "CredSSP required", body: rdpConfirmBody(0x03, rdpHybridRequired), wantFailure: rdpHybridRequired},
+		{name: "no negotiation", body: rdpConfirmBody(0, 0), wantSelected: rdpProtocolRDP},
+		{name: "unknown negotiation message", body: rdpConfirmBody(0x07, 1), wantErr: true},
+		{name: "Connection Request", body: []byte{0x0e, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00}, wantErr: true},
+		{name: "short", body: []byte{0x0e, 0xd0}, wantErr: true},
+		{name: "empty", body: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		selected, failure, err := rdpConfirm(tt.body)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if selected != tt.wantSelected || failure != tt.wantFailure {
+			t.Errorf("%s: got protocol %d failure %d, want %d and %d", tt.name, selected, failure, tt.wantSelected, tt.wantFailure)
+		}
+	}
+
+	everyPrefix(t, "Connection Confirm", rdpConfirmBody(0x02, rdpProtocolHybrid), func(data []byte) {
+		rdpConfirm(data)
+	})
+}
+
+// rdpScript plays an RDP server that answers each Connection Request with
+// the Connection Confirm body confirm returns for the requested protocols
+func rdpScript(confirm func(requested uint32) []byte) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		request := make([]byte, 19)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		body := confirm(binary.LittleEndian.Uint32(request[15:]))
+		tpkt := binary.BigEndian.AppendUint16([]byte{0x03, 0x00}, uint16(len(body)+4))
+		conn.Write(append(tpkt, body...))
+	}
+}
+
+func TestRDPEnrich(t *testing.T) {
+	tests := []struct {
+		name    string
+		confirm func(requested uint32) []byte
+		want    *database.RDPResult
+		wantErr bool
+	}{
+		{
+			name: "NLA required",
+			confirm: func(requested uint32) []byte {
+				if requested&rdpProtocolHybrid == 0 {
+					return rdpConfirmBody(0x03, rdpHybridRequired)
+				}
+				return rdpConfirmBody(0x02, rdpProtocolHybrid)
+			},
+			want: &database.RDPResult{SelectedProtocol: "credssp", NLARequired: true},
+		},
+		{
+			name: "TLS without NLA",
+			confirm: func(requested uint32) []byte {
+				switch {
+				case requested&rdpProtocolHybridEx != 0:
+					return rdpConfirmBody(0x02, rdpProtocolHybridEx)
+				case requested&rdpProtocolSSL != 0:
+					return rdpConfirmBody(0x02, rdpProtocolSSL)
+				}
+				return rdpConfirmBody(0x03, 0x01) // SSL_REQUIRED_BY_SERVER
+			},
+			want: &database.RDPResult{SelectedProtocol: "credssp-early-auth", TLSSupported: true},
+		},
+		{
+			name:    "legacy security only",
+			confirm: func(uint32) []byte { return rdpConfirmBody(0, 0) },
+			want:    &database.RDPResult{SelectedProtocol: "rdp", StandardSecurity: true},
+		},
+		{
+			name:    "refuses every protocol",
+			confirm: func(uint32) []byte { return rdpConfirmBody(0x03, 0x06) },
+			want:    &database.RDPResult{},
+		},
+		{
+			name:    "unknown negotiation message",
+			confirm: func(uint32) []byte { return rdpConfirmBody(0x09, 0) },
+			wantErr: true,
+		},
+		{
+			name:    "TPKT too short",
+			confirm: func(uint32) []byte { return []byte{0x02, 0xd0} },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := enrichScript(t, rdpModule{}, rdpScript(tt.confirm))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.RDP, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.RDP, tt.want)
+		}
+	}
+
+	// A server that is not RDP at all
+	_, err := enrichScript(t, rdpModule{}, func(conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+	})
+	if err == nil {
+		t.Errorf("HTTP server: got no error")
+	}
+}
@@ -0,0 +1,194 @@
+// pkg/enrichment/smb.go
+
+package enrichment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// smb2Dialects are the SMB 2 and 3 dialects tried, oldest first
+var smb2Dialects = []struct {
+	revision uint16
+	name     string
+}{
+	{0x0202, "2.0.2"},
+	{0x0210, "2.1"},
+	{0x0300, "3.0"},
+	{0x0302, "3.0.2"},
+	{0x0311, "3.1.1"},
+}
+
+// SMB2 security mode flags
+const (
+	smbSigningEnabled  = 0x01
+	smbSigningRequired = 0x02
+)
+
+type smbModule struct{}
+
+func (smbModule) Name() string       { return "smb" }
+func (smbModule) Services() []string { return []string{"smb", "microsoft-ds"} }
+func (smbModule) Ports() []int       { return []int{445} }
+
+// Enrich negotiates each dialect on its own connection to list the ones the
+// server accepts, and reads the signing policy from the newest. SMB 1 is
+// tried last with its own negotiate request.
+func (smbModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	info := &database.SMBResult{}
+	var lastErr error
+	for _, dialect := range smb2Dialects {
+		securityMode, err := smb2Negotiate(ctx, target, port, dialect.revision)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		info.Dialects = append(info.Dialects, dialect.name)
+		info.SigningEnabled = securityMode&smbSigningEnabled != 0
+		info.SigningRequired = securityMode&smbSigningRequired != 0
+	}
+
+	if smb1Negotiate(ctx, target, port) == nil {
+		info.SMBv1 = true
+		info.Dialects = append([]string{"NT LM 0.12"}, info.Dialects...)
+	}
+
+	if len(info.Dialects) == 0 {
+		return fmt.Errorf("no SMB dialect accepted: %v", lastErr)
+	}
+	result.SMB = info
+	return nil
+}
+
+// smb2Negotiate offers a single dialect and returns the server's security
+// mode if it is accepted
+func smb2Negotiate(ctx context.Context, target Target, port int, dialect uint16) (uint16, error) {
+	header := make([]byte, 64)
+	copy(header, "\xfeSMB")
+	binary.LittleEndian.PutUint16(header[4:], 64) // Structure size
+	binary.LittleEndian.PutUint16(header[14:], 1) // Credits requested; the command, NEGOTIATE, is 0
+
+	body := make([]byte, 38)
+	binary.LittleEndian.PutUint16(body[0:], 36) // Structure size
+	binary.LittleEndian.PutUint16(body[2:], 1)  // Dialect count
+	binary.LittleEndian.PutUint16(body[4:], smbSigningEnabled)
+	rand.Read(body[12:28]) // Client GUID
+	binary.LittleEndian.PutUint16(body[36:], dialect)
+
+	// SMB 3.1.1 requires a preauth integrity context, 8 byte aligned
+	if dialect == 0x0311 {
+		for (len(header)+len(body))%8 != 0 {
+			body = append(body, 0)
+		}
+		binary.LittleEndian.PutUint32(body[28:], uint32(len(header)+len(body)))
+		binary.LittleEndian.PutUint16(body[32:], 1)
+
+		negotiateContext := make([]byte, 8+38)
+		binary.LittleEndian.PutUint16(negotiateContext[0:], 0x0001) // SMB2_PREAUTH_INTEGRITY_CAPABILITIES
+		binary.LittleEndian.PutUint16(negotiateContext[2:], 38)
+		binary.LittleEndian.PutUint16(negotiateContext[8:], 1)       // Hash algorithm count
+		binary.LittleEndian.PutUint16(negotiateContext[10:], 32)     // Salt length
+		binary.LittleEndian.PutUint16(negotiateContext[12:], 0x0001) // SHA-512
+		rand.Read(negotiateContext[14:])
+		body = append(body, negotiateContext...)
+	}
+
+	response, err := smbExchange(ctx, target, port, append(header, body...))
+	if err != nil {
+		return 0, err
+	}
+	return smb2NegotiateResponse(response, dialect)
+}
+
+// smb2NegotiateResponse returns the security mode of an SMB2 NEGOTIATE
+// response that accepts dialect
+func smb2NegotiateResponse(response []byte, dialect uint16) (uint16, error) {
+	if len(response) < 64+6 || string(response[:4]) != "\xfeSMB" {
+		return 0, fmt.Errorf("not an SMB2 response")
+	}
+	if status := binary.LittleEndian.Uint32(response[8:]); status != 0 {
+		return 0, fmt.Errorf("dialect 0x%04x refused with status 0x%08x", dialect, status)
+	}
+	if accepted := binary.LittleEndian.Uint16(response[68:]); accepted != dialect {
+		return 0, fmt.Errorf("server chose dialect 0x%04x", accepted)
+	}
+	return binary.LittleEndian.Uint16(response[66:]), nil
+}
+
+// smb1Negotiate offers the NT LM 0.12 dialect of SMB 1 and succeeds if the
+// server accepts it
+func smb1Negotiate(ctx context.Context, target Target, port int) error {
+	request := make([]byte, 32)
+	copy(request, "\xffSMB")
+	request[4] = 0x72                                   // SMB_COM_NEGOTIATE
+	request[9] = 0x18                                   // Flags: canonical paths, case insensitive
+	binary.LittleEndian.PutUint16(request[10:], 0x4001) // Flags2: NT status codes, long names
+
+	dialects := append([]byte{0x02}, "NT LM 0.12\x00"...)
+	request = append(request, 0) // Word count
+	request = append(request, byte(len(dialects)), byte(len(dialects)>>8))
+	request = append(request, dialects...)
+
+	response, err := smbExchange(ctx, target, port, request)
+	if err != nil {
+		return err
+	}
+	return smb1NegotiateResponse(response)
+}
+
+// smb1NegotiateResponse succeeds if an SMB 1 NEGOTIATE response accepts the
+// NT LM 0.12 dialect, the only one offered
+func smb1NegotiateResponse(response []byte) error {
+	if len(response) < 35 || string(response[:4]) != "\xffSMB" {
+		return fmt.Errorf("SMB 1 not supported")
+	}
+	if status := binary.LittleEndian.Uint32(response[5:]); status != 0 {
+		return fmt.Errorf("SMB 1 refused with status 0x%08x", status)
+	}
+	if response[32] == 0 || binary.LittleEndian.Uint16(response[33:]) != 0 {
+		return fmt.Errorf("SMB 1 dialect refused")
+	}
+	return nil
+}
+
+// smbExchange sends one message framed for direct TCP transport and reads
+// the reply
+func smbExchange(ctx context.Context, target Target, port int, message []byte) ([]byte, error) {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(smbFrame(message)); err != nil {
+		return nil, err
+	}
+	return smbRead(conn)
+}
+
+func smbFrame(message []byte) []byte {
+	length := len(message)
+	return append([]byte{0x00, byte(length >> 16), byte(length >> 8), byte(length)}, message...)
+}
+
+func smbRead(conn net.Conn) ([]byte, error) {
+	var frame [4]byte
+	if _, err := io.ReadFull(conn, frame[:]); err != nil {
+		return nil, err
+	}
+	length := int(frame[1])<<16 | int(frame[2])<<8 | int(frame[3])
+	if frame[0] != 0x00 || length > 1<<16 {
+		return nil, fmt.Errorf("invalid SMB frame")
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(conn, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
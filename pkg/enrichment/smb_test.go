@@ -0,0 +1,203 @@
+// pkg/enrichment/smb_test.go
+
+package enrichment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// smbStatusNotSupported is the NTSTATUS of a refused dialect
+const smbStatusNotSupported = 0xc00000bb
+
+// smb2Response builds an SMB2 NEGOTIATE response
+func smb2Response(status uint32, securityMode, dialect uint16) []byte {
+	response := make([]byte, 64+65)
+	copy(response, "\xfeSMB")
+	binary.LittleEndian.PutUint16(response[4:], 64)
+	binary.LittleEndian.PutUint32(response[8:], status)
+	binary.LittleEndian.PutUint16(response[64:], 65)
+	binary.LittleEndian.PutUint16(response[66:], securityMode)
+	binary.LittleEndian.PutUint16(response[68:], dialect)
+	return response
+}
+
+// smb1Response builds an SMB 1 NEGOTIATE response choosing dialect index
+func smb1Response(status uint32, wordCount byte, index uint16) []byte {
+	response := make([]byte, 32)
+	copy(response, "\xffSMB")
+	response[4] = 0x72
+	binary.LittleEndian.PutUint32(response[5:], status)
+	response = append(response, wordCount)
+	response = binary.LittleEndian.AppendUint16(response, index)
+	return append(response, make([]byte, 2*int(wordCount))...)
+}
+
+func TestSMB2NegotiateResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []byte
+		want     uint16
+		wantErr  bool
+	}{
+		{name: "signing required", response: smb2Response(0, smbSigningEnabled|smbSigningRequired, 0x0302), want: 3},
+		{name: "signing enabled", response: smb2Response(0, smbSigningEnabled, 0x0302), want: 1},
+		{name: "refused", response: smb2Response(smbStatusNotSupported, 0, 0), wantErr: true},
+		{name: "other dialect chosen", response: smb2Response(0, smbSigningEnabled, 0x0210), wantErr: true},
+		{name: "SMB 1 response", response: smb1Response(0, 17, 0), wantErr: true},
+		{name: "header only", response: smb2Response(0, 1, 0x0302)[:64], wantErr: true},
+		{name: "empty", response: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := smb2NegotiateResponse(tt.response, 0x0302)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got security mode %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	everyPrefix(t, "SMB2 NEGOTIATE response", smb2Response(0, 1, 0x0302), func(data []byte) {
+		smb2NegotiateResponse(data, 0x0302)
+	})
+}
+
+func TestSMB1NegotiateResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []byte
+		wantErr  bool
+	}{
+		{name: "NT LM 0.12 accepted", response: smb1Response(0, 17, 0)},
+		{name: "no dialect chosen", response: smb1Response(0, 1, 0xffff), wantErr: true},
+		{name: "no parameters", response: smb1Response(0, 0, 0), wantErr: true},
+		{name: "refused", response: smb1Response(smbStatusNotSupported, 0, 0), wantErr: true},
+		{name: "SMB2 response", response: smb2Response(0, 1, 0x02ff), wantErr: true},
+		{name: "header only", response: smb1Response(0, 17, 0)[:32], wantErr: true},
+		{name: "empty", response: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := smb1NegotiateResponse(tt.response); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	everyPrefix(t, "SMB 1 NEGOTIATE response", smb1Response(0, 17, 0), func(data []byte) {
+		smb1NegotiateResponse(data)
+	})
+}
+
+func TestSMBRead(t *testing.T) {
+	message := smb2Response(0, 1, 0x0302)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "frame", data: smbFrame(message)},
+		{name: "session keepalive", data: append([]byte{0x85}, smbFrame(message)[1:]...), wantErr: true},
+		{name: "oversized", data: []byte{0x00, 0x02, 0x00, 0x00}, wantErr: true},
+		{name: "message cut short", data: smbFrame(message)[:40], wantErr: true},
+		{name: "length cut short", data: []byte{0x00, 0x00}, wantErr: true},
+		{name: "nothing", data: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		go func(data []byte) {
+			server.Write(data)
+			server.Close()
+		}(tt.data)
+
+		got, err := smbRead(client)
+		client.Close()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !bytes.Equal(got, message) {
+			t.Errorf("%s: read %d bytes, want %d", tt.name, len(got), len(message))
+		}
+	}
+}
+
+// smbScript plays an SMB server that accepts the SMB2 dialects up to newest
+// with securityMode, and SMB 1 if smb1 is set
+func smbScript(newest uint16, securityMode uint16, smb1 bool) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		request, err := smbRead(conn)
+		if err != nil || len(request) < 4 {
+			return
+		}
+		switch {
+		case string(request[:4]) == "\xfeSMB" && len(request) >= 64+38:
+			dialect := binary.LittleEndian.Uint16(request[64+36:])
+			if dialect > newest {
+				conn.Write(smbFrame(smb2Response(smbStatusNotSupported, 0, 0)))
+				return
+			}
+			conn.Write(smbFrame(smb2Response(0, securityMode, dialect)))
+		case string(request[:4]) == "\xffSMB" && smb1:
+			conn.Write(smbFrame(smb1Response(0, 17, 0)))
+		}
+	}
+}
+
+func TestSMBEnrich(t *testing.T) {
+	tests := []struct {
+		name    string
+		handle  func(conn net.Conn)
+		want    *database.SMBResult
+		wantErr bool
+	}{
+		{
+			name:   "signing required",
+			handle: smbScript(0x0311, smbSigningEnabled|smbSigningRequired, false),
+			want: &database.SMBResult{
+				Dialects:        []string{"2.0.2", "2.1", "3.0", "3.0.2", "3.1.1"},
+				SigningEnabled:  true,
+				SigningRequired: true,
+			},
+		},
+		{
+			name:   "SMB 1 still accepted",
+			handle: smbScript(0x0210, smbSigningEnabled, true),
+			want: &database.SMBResult{
+				Dialects:       []string{"NT LM 0.12", "2.0.2", "2.1"},
+				SMBv1:          true,
+				SigningEnabled: true,
+			},
+		},
+		{
+			name:   "SMB 1 only",
+			handle: smbScript(0, 0, true),
+			want:   &database.SMBResult{Dialects: []string{"NT LM 0.12"}, SMBv1: true},
+		},
+		{name: "no dialect accepted", handle: smbScript(0, 0, false), wantErr: true},
+		{name: "not SMB", handle: func(conn net.Conn) { conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n")) }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := enrichScript(t, smbModule{}, tt.handle)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.SMB, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.SMB, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// pkg/enrichment/smtp.go
+
+package enrichment
+
+import (
+	"context"
+	"crypto/tls"
+	"net/textproto"
+	"strings"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/webprobe"
+)
+
+// heloName is the client name sent in EHLO. The .invalid TLD is reserved
+// for names that must never resolve.
+const heloName = "nexusscan.invalid"
+
+type smtpModule struct{}
+
+func (smtpModule) Name() string       { return "smtp" }
+func (smtpModule) Services() []string { return []string{"smtp"} }
+func (smtpModule) Ports() []int       { return []int{25, 587, 2525} }
+
+// Enrich records the EHLO extensions and, when STARTTLS is offered, the
+// TLS version it negotiates. No mail is sent.
+func (smtpModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	_, greeting, err := text.ReadResponse(220)
+	if err != nil {
+		return err
+	}
+	info := &database.SMTPResult{Banner: firstLine(greeting)}
+	result.SMTP = info
+
+	_, ehlo, err := command(text, 250, "EHLO %s", heloName)
+	if err != nil {
+		return err
+	}
+
+	// The first line greets the client; each following line is an extension
+	lines := strings.Split(ehlo, "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		info.Capabilities = append(info.Capabilities, line)
+		switch strings.ToUpper(fields[0]) {
+		case "STARTTLS":
+			info.StartTLS = true
+		case "AUTH":
+			info.AuthMechanisms = fields[1:]
+		}
+	}
+	info.AuthBeforeTLS = len(info.AuthMechanisms) > 0
+
+	if info.StartTLS {
+		if _, _, err := command(text, 220, "STARTTLS"); err != nil {
+			return err
+		}
+		tlsConn := tls.Client(conn, &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         target.Hostname,
+			MinVersion:         tls.VersionTLS10,
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		info.TLSVersion = webprobe.VersionName(tlsConn.ConnectionState().Version)
+		textproto.NewConn(tlsConn).Cmd("QUIT")
+		return nil
+	}
+
+	text.Cmd("QUIT")
+	return nil
+}
+
+// command sends a command and reads its response. An expect of 0 takes
+// any status code.
+func command(text *textproto.Conn, expect int, format string, args ...interface{}) (int, string, error) {
+	id, err := text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	text.StartResponse(id)
+	defer text.EndResponse(id)
+	return text.ReadResponse(expect)
+}
+
+func firstLine(message string) string {
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		return message[:i]
+	}
+	return message
+}
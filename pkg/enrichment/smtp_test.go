@@ -0,0 +1,112 @@
+// pkg/enrichment/smtp_test.go
+
+package enrichment
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// smtpScript plays an SMTP server that greets with greeting, answers EHLO
+// with ehlo and, given a certificate, accepts STARTTLS. Without an ehlo it
+// hangs up after the greeting.
+func smtpScript(greeting, ehlo string, certificate *tls.Certificate) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		io.WriteString(conn, greeting)
+		if ehlo == "" {
+			return
+		}
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch verb := strings.ToUpper(strings.Fields(line + " x")[0]); {
+			case verb == "EHLO":
+				io.WriteString(conn, ehlo)
+			case verb == "STARTTLS" && certificate != nil:
+				io.WriteString(conn, "220 2.0.0 Ready to start TLS\r\n")
+				server := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*certificate}})
+				if server.Handshake() != nil {
+					return
+				}
+				conn, reader = server, bufio.NewReader(server)
+			case verb == "QUIT":
+				io.WriteString(conn, "221 2.0.0 Bye\r\n")
+				return
+			default:
+				io.WriteString(conn, "502 5.5.2 Command not recognized\r\n")
+			}
+		}
+	}
+}
+
+func TestSMTPEnrich(t *testing.T) {
+	certificate := testCertificate(t, "mail.example.com")
+
+	tests := []struct {
+		name        string
+		greeting    string
+		ehlo        string
+		certificate *tls.Certificate
+		want        *database.SMTPResult
+		wantErr     bool
+	}{
+		{
+			name:     "AUTH without STARTTLS",
+			greeting: "220 mail.example.com ESMTP Postfix\r\n",
+			ehlo:     "250-mail.example.com\r\n250-PIPELINING\r\n250-SIZE 10240000\r\n250-AUTH PLAIN LOGIN\r\n250 8BITMIME\r\n",
+			want: &database.SMTPResult{
+				Banner:         "mail.example.com ESMTP Postfix",
+				Capabilities:   []string{"PIPELINING", "SIZE 10240000", "AUTH PLAIN LOGIN", "8BITMIME"},
+				AuthMechanisms: []string{"PLAIN", "LOGIN"},
+				AuthBeforeTLS:  true,
+			},
+		},
+		{
+			name:        "STARTTLS",
+			greeting:    "220-mail.example.com ESMTP\r\n220 No UCE\r\n",
+			ehlo:        "250-mail.example.com\r\n250-STARTTLS\r\n250 SMTPUTF8\r\n",
+			certificate: &certificate,
+			want: &database.SMTPResult{
+				Banner:       "mail.example.com ESMTP",
+				Capabilities: []string{"STARTTLS", "SMTPUTF8"},
+				StartTLS:     true,
+				TLSVersion:   "tls13",
+			},
+		},
+		{
+			name:     "no extensions",
+			greeting: "220 mail.example.com\r\n",
+			ehlo:     "250 mail.example.com\r\n",
+			want:     &database.SMTPResult{Banner: "mail.example.com"},
+		},
+		{name: "STARTTLS refused", greeting: "220 mx\r\n", ehlo: "250-mx\r\n250 STARTTLS\r\n", wantErr: true},
+		{name: "EHLO refused", greeting: "220 mx\r\n", ehlo: "502 5.5.2 Error: command not recognized\r\n", wantErr: true},
+		{name: "service not available", greeting: "554 5.7.1 No SMTP service here\r\n", wantErr: true},
+		{name: "greeting cut short", greeting: "220-mail.example.com ESMTP\r\n", wantErr: true},
+		{name: "not SMTP", greeting: "SSH-2.0-OpenSSH_9.6\r\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := enrichScript(t, smtpModule{}, smtpScript(tt.greeting, tt.ehlo, tt.certificate))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(result.SMTP, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result.SMTP, tt.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// pkg/enrichment/ssh.go
+
+package enrichment
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// sshClientVersion identifies the prober to SSH servers
+const sshClientVersion = "SSH-2.0-nexusscan"
+
+// sshKeyFamilies are the host key algorithms asked for in turn, one per key
+// type, so that every host key a server holds is fingerprinted
+var sshKeyFamilies = [][]string{
+	{ssh.KeyAlgoED25519},
+	{ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521},
+	{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA},
+	{ssh.KeyAlgoDSA},
+}
+
+// sshWeakAlgorithms are offered algorithms considered broken or too weak
+var sshWeakAlgorithms = map[string]bool{
+	"diffie-hellman-group1-sha1":         true,
+	"diffie-hellman-group-exchange-sha1": true,
+	"ssh-dss":                            true,
+	"arcfour":                            true,
+	"arcfour128":                         true,
+	"arcfour256":                         true,
+	"3des-cbc":                           true,
+	"blowfish-cbc":                       true,
+	"cast128-cbc":                        true,
+	"des-cbc":                            true,
+	"aes128-cbc":                         true,
+	"aes192-cbc":                         true,
+	"aes256-cbc":                         true,
+	"none":                               true,
+	"hmac-md5":                           true,
+	"hmac-md5-96":                        true,
+	"hmac-sha1-96":                       true,
+	"umac-64@openssh.com":                true,
+}
+
+// errHostKeySeen stops a handshake once the host key has been recorded
+var errHostKeySeen = errors.New("host key recorded")
+
+type sshModule struct{}
+
+func (sshModule) Name() string       { return "ssh" }
+func (sshModule) Services() []string { return []string{"ssh"} }
+func (sshModule) Ports() []int       { return []int{22, 2222} }
+
+// Enrich reads the algorithms from the server's key exchange offer, then
+// starts a handshake for each key type it offers to fingerprint the keys
+func (sshModule) Enrich(ctx context.Context, target Target, port int, result *database.ServiceResult) error {
+	info, err := sshAlgorithms(ctx, target, port)
+	if err != nil {
+		return err
+	}
+	result.SSH = info
+
+	for _, family := range sshKeyFamilies {
+		var offered []string
+		for _, algorithm := range family {
+			if contains(info.HostKeyAlgorithms, algorithm) {
+				offered = append(offered, algorithm)
+			}
+		}
+		if len(offered) == 0 {
+			continue
+		}
+
+		key, err := sshHostKey(ctx, target, port, offered)
+		if err != nil {
+			continue
+		}
+		info.HostKeys = append(info.HostKeys, database.SSHHostKey{
+			Type:              key.Type(),
+			FingerprintSHA256: ssh.FingerprintSHA256(key),
+			FingerprintMD5:    fmt.Sprintf("MD5:%x", md5.Sum(key.Marshal())),
+		})
+	}
+	return nil
+}
+
+// sshAlgorithms exchanges versions and parses the server's KEXINIT
+func sshAlgorithms(ctx context.Context, target Target, port int) (*database.SSHResult, error) {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	banner, err := sshBanner(reader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(conn, sshClientVersion+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	payload, err := sshPacket(reader)
+	if err != nil {
+		return nil, err
+	}
+	return sshKexInit(banner, payload)
+}
+
+// sshKexInit reads the algorithms from the payload of a KEXINIT message
+func sshKexInit(banner string, payload []byte) (*database.SSHResult, error) {
+	const msgKexInit = 20
+	if len(payload) < 17 || payload[0] != msgKexInit {
+		return nil, fmt.Errorf("no KEXINIT received")
+	}
+
+	// The cookie is followed by ten name-lists, of which the client to
+	// server and server to client lists are merged
+	rest := payload[17:]
+	lists := make([][]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		var list []string
+		var err error
+		list, rest, err = sshNameList(rest)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+
+	info := &database.SSHResult{
+		Banner:            banner,
+		KexAlgorithms:     lists[0],
+		HostKeyAlgorithms: lists[1],
+		Ciphers:           merge(lists[2], lists[3]),
+		MACs:              merge(lists[4], lists[5]),
+		Compression:       merge(lists[6], lists[7]),
+	}
+	for _, group := range [][]string{info.KexAlgorithms, info.HostKeyAlgorithms, info.Ciphers, info.MACs} {
+		for _, algorithm := range group {
+			if sshWeakAlgorithms[algorithm] {
+				info.WeakAlgorithms = append(info.WeakAlgorithms, algorithm)
+			}
+		}
+	}
+	return info, nil
+}
+
+// sshBanner reads the server's identification line, skipping any lines
+// sent before it
+func sshBanner(reader *bufio.Reader) (string, error) {
+	for i := 0; i < 20; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "SSH-") {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("no SSH identification received")
+}
+
+// sshPacket reads one unencrypted binary packet and returns its payload
+func sshPacket(reader *bufio.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	padding := uint32(header[4])
+	if length < padding+1 || length > 35000 {
+		return nil, fmt.Errorf("invalid SSH packet length %d", length)
+	}
+	body := make([]byte, length-1)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return body[:len(body)-int(padding)], nil
+}
+
+func sshNameList(data []byte) ([]string, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("truncated KEXINIT")
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint32(len(data)-4) < length {
+		return nil, nil, fmt.Errorf("truncated KEXINIT")
+	}
+	list := string(data[4 : 4+length])
+	rest := data[4+length:]
+	if list == "" {
+		return nil, rest, nil
+	}
+	return strings.Split(list, ","), rest, nil
+}
+
+// sshHostKey runs a handshake limited to algorithms and returns the host
+// key the server proves it holds
+func sshHostKey(ctx context.Context, target Target, port int, algorithms []string) (ssh.PublicKey, error) {
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var hostKey ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:              "nexusscan",
+		ClientVersion:     sshClientVersion,
+		HostKeyAlgorithms: algorithms,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKeySeen
+		},
+	}
+	_, _, _, err = ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
+	if hostKey == nil {
+		if err == nil {
+			err = fmt.Errorf("no host key received")
+		}
+		return nil, err
+	}
+	return hostKey, nil
+}
+
+// merge joins two name-lists, keeping the order and dropping repeats
+func merge(a, b []string) []string {
+	merged := append([]string(nil), a...)
+	for _, name := range b {
+		if !contains(merged, name) {
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
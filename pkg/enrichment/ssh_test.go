@@ -0,0 +1,189 @@
+// pkg/enrichment/ssh_test.go
+
+package enrichment
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// kexInitPayload builds a KEXINIT payload from its ten name-lists
+func kexInitPayload(lists ...string) []byte {
+	payload := append([]byte{20}, make([]byte, 16)...)
+	for _, list := range lists {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(list)))
+		payload = append(payload, list...)
+	}
+	return append(payload, 0, 0, 0, 0, 0) // first_kex_packet_follows and reserved
+}
+
+// sshPacketBytes frames a payload as an unencrypted binary packet
+func sshPacketBytes(payload []byte) []byte {
+	padding := 8 - (len(payload)+5)%8
+	if padding < 4 {
+		padding += 8
+	}
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+padding+1))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+	return append(packet, make([]byte, padding)...)
+}
+
+// openSSHKexInit is a KEXINIT as an older OpenSSH sends it
+var openSSHKexInit = kexInitPayload(
+	"curve25519-sha256,diffie-hellman-group1-sha1",
+	"ssh-ed25519,rsa-sha2-512,ssh-dss",
+	"aes128-ctr,aes128-cbc",
+	"aes128-ctr,chacha20-poly1305@openssh.com",
+	"hmac-sha2-256,hmac-md5",
+	"hmac-sha2-256",
+	"none,zlib@openssh.com",
+	"none",
+	"",
+	"",
+)
+
+// sshLists are the algorithm lists of an SSHResult that are compared
+type sshLists struct {
+	Kex, HostKey, Ciphers, MACs, Weak []string
+}
+
+func TestSSHKexInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    *sshLists
+		wantErr bool
+	}{
+		{
+			name:    "OpenSSH",
+			payload: openSSHKexInit,
+			want: &sshLists{
+				Kex:     []string{"curve25519-sha256", "diffie-hellman-group1-sha1"},
+				HostKey: []string{"ssh-ed25519", "rsa-sha2-512", "ssh-dss"},
+				Ciphers: []string{"aes128-ctr", "aes128-cbc", "chacha20-poly1305@openssh.com"},
+				MACs:    []string{"hmac-sha2-256", "hmac-md5"},
+				Weak:    []string{"diffie-hellman-group1-sha1", "ssh-dss", "aes128-cbc", "hmac-md5"},
+			},
+		},
+		{
+			name:    "empty lists",
+			payload: kexInitPayload("", "", "", "", "", "", "", "", "", ""),
+			want:    &sshLists{},
+		},
+		{name: "not a KEXINIT", payload: append([]byte{21}, openSSHKexInit[1:]...), wantErr: true},
+		{name: "no name-lists", payload: openSSHKexInit[:17], wantErr: true},
+		{name: "name-list longer than the payload", payload: append(openSSHKexInit[:17:17], 0xff, 0xff, 0xff, 0xff, 'a'), wantErr: true},
+		{name: "nine name-lists", payload: kexInitPayload("a", "b", "c", "d", "e", "f", "g", "h", "i")[:17+9*5], wantErr: true},
+		{name: "empty", payload: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		info, err := sshKexInit("SSH-2.0-OpenSSH_7.4", tt.payload)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := &sshLists{Kex: info.KexAlgorithms, HostKey: info.HostKeyAlgorithms, Ciphers: info.Ciphers, MACs: info.MACs, Weak: info.WeakAlgorithms}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	everyPrefix(t, "KEXINIT", openSSHKexInit, func(data []byte) {
+		// Every list is needed, so only the trailing fields may be missing
+		if _, err := sshKexInit("", data); err == nil && len(data) < len(openSSHKexInit)-5 {
+			t.Errorf("KEXINIT cut to %d bytes parsed", len(data))
+		}
+	})
+}
+
+func TestSSHPacket(t *testing.T) {
+	packet := sshPacketBytes(openSSHKexInit)
+	huge := binary.BigEndian.AppendUint32(nil, 1<<20)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "KEXINIT", data: packet},
+		{name: "padding longer than the packet", data: []byte{0, 0, 0, 4, 10, 1, 2, 3}, wantErr: true},
+		{name: "oversized", data: append(huge, 4), wantErr: true},
+		{name: "body cut short", data: packet[:len(packet)-1], wantErr: true},
+		{name: "header cut short", data: packet[:3], wantErr: true},
+		{name: "empty", data: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		payload, err := sshPacket(bufio.NewReader(bytes.NewReader(tt.data)))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !bytes.Equal(payload, openSSHKexInit) {
+			t.Errorf("%s: payload of %d bytes, want %d", tt.name, len(payload), len(openSSHKexInit))
+		}
+	}
+
+	everyPrefix(t, "SSH packet", packet, func(data []byte) {
+		sshPacket(bufio.NewReader(bytes.NewReader(data)))
+	})
+}
+
+func TestSSHAlgorithms(t *testing.T) {
+	tests := []struct {
+		name       string
+		greeting   string
+		packet     []byte
+		wantBanner string
+		wantErr    bool
+	}{
+		{
+			name:       "OpenSSH",
+			greeting:   "SSH-2.0-OpenSSH_7.4\r\n",
+			packet:     sshPacketBytes(openSSHKexInit),
+			wantBanner: "SSH-2.0-OpenSSH_7.4",
+		},
+		{
+			name:       "lines before the identification",
+			greeting:   "Authorised use only\r\nSSH-2.0-dropbear_2022.83\n",
+			packet:     sshPacketBytes(openSSHKexInit),
+			wantBanner: "SSH-2.0-dropbear_2022.83",
+		},
+		{name: "no identification", greeting: strings.Repeat("hello\r\n", 25), wantErr: true},
+		{name: "HTTP", greeting: "HTTP/1.1 400 Bad Request\r\n\r\n", wantErr: true},
+		{name: "no KEXINIT", greeting: "SSH-2.0-OpenSSH_9.6\r\n", packet: sshPacketBytes([]byte{1, 0, 0, 0, 0}), wantErr: true},
+		{name: "KEXINIT cut short", greeting: "SSH-2.0-OpenSSH_9.6\r\n", packet: sshPacketBytes(openSSHKexInit)[:40], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		port := serveScript(t, func(conn net.Conn) {
+			io.WriteString(conn, tt.greeting)
+			if tt.packet == nil {
+				return
+			}
+			bufio.NewReader(conn).ReadString('\n')
+			conn.Write(tt.packet)
+		})
+
+		info, err := sshAlgorithms(testContext(t), Target{IPAddress: "127.0.0.1"}, port)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (info.Banner != tt.wantBanner || len(info.KexAlgorithms) != 2) {
+			t.Errorf("%s: got banner %q with %d key exchanges, want %q with 2", tt.name, info.Banner, len(info.KexAlgorithms), tt.wantBanner)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// pkg/enrichment/tls.go
+
+package enrichment
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/webprobe"
+)
+
+// TLS inspection runs on every open port rather than as a module, since TLS
+// wraps services of every kind
+
+// tlsUnknownServerName is sent as SNI to see the certificate a server
+// falls back to for names it does not serve
+const tlsUnknownServerName = "nexusscan.invalid"
+
+// Minimum key sizes, below which a certificate key is reported as short
+const (
+	minRSABits   = 2048
+	minECDSABits = 224
+)
+
+// InspectTLS handshakes with every port and returns what it found on those
+// that speak TLS, in port order. Each connection is limited by
+// opts.Timeout; a port takes one for each protocol version and each suite
+// the server accepts.
+func InspectTLS(ctx context.Context, target Target, ports []int, opts Options) []database.TLSResult {
+	opts = opts.withDefaults()
+
+	var results []database.TLSResult
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, opts.Concurrency)
+
+	for _, port := range ports {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			if result := inspectPort(ctx, target, port, opts.Timeout); result != nil {
+				mu.Lock()
+				results = append(results, *result)
+				mu.Unlock()
+			}
+		}(port)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Port < results[j].Port })
+	return results
+}
+
+// inspectPort enumerates the versions and suites of a port, then completes
+// a handshake for each SNI variant to read the certificates. It returns
+// nil if the port does not speak TLS.
+func inspectPort(ctx context.Context, target Target, port int, timeout time.Duration) *database.TLSResult {
+	// Any ServerHello or alert in answer to a TLS 1.2 ClientHello is TLS
+	if _, _, err := helloExchange(ctx, target, port, versionTLS12, suiteIDs(legacyCipherSuites), timeout); err != nil && !errors.Is(err, errTLSRefused) {
+		return nil
+	}
+
+	result := &database.TLSResult{Port: port}
+	for _, version := range tlsVersions {
+		suites, err := acceptedSuites(ctx, target, port, version, timeout)
+		if err != nil || len(suites) == 0 {
+			continue
+		}
+		entry := database.TLSVersion{Version: tlsVersionName(version)}
+		for _, suite := range suites {
+			entry.CipherSuites = append(entry.CipherSuites, cipherSuiteName(version, suite))
+		}
+		result.Versions = append(result.Versions, entry)
+	}
+
+	chain := inspectCertificates(ctx, target, port, timeout, result)
+	result.Weaknesses = tlsWeaknesses(result.Versions, chain)
+	if len(result.Versions) == 0 && len(chain) == 0 {
+		result.Error = "no protocol version or cipher suite accepted"
+	}
+	result.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	return result
+}
+
+// inspectCertificates completes a handshake without SNI, with the hostname
+// the IP was added with, and with a name no certificate should cover. The
+// chain and OCSP staple kept are those for the hostname, or those without
+// SNI when there is none. It returns the kept chain.
+func inspectCertificates(ctx context.Context, target Target, port int, timeout time.Duration, result *database.TLSResult) []*x509.Certificate {
+	names := []string{""}
+	if target.Hostname != "" {
+		names = append(names, target.Hostname)
+	}
+	names = append(names, tlsUnknownServerName)
+
+	var kept *tls.ConnectionState
+	for _, name := range names {
+		entry := database.TLSServerName{ServerName: name}
+		state, err := tlsHandshake(ctx, target, port, name, timeout)
+		if err != nil {
+			entry.Error = err.Error()
+			result.ServerNames = append(result.ServerNames, entry)
+			continue
+		}
+		if len(state.PeerCertificates) > 0 {
+			leaf := state.PeerCertificates[0]
+			entry.SubjectCN = leaf.Subject.CommonName
+			entry.FingerprintSHA256 = fmt.Sprintf("%x", sha256.Sum256(leaf.Raw))
+			entry.Mismatched = name != "" && name == target.Hostname && leaf.VerifyHostname(name) != nil
+		}
+		result.ServerNames = append(result.ServerNames, entry)
+
+		if name == "" || name == target.Hostname {
+			kept = &state
+		}
+	}
+	if kept == nil {
+		return nil
+	}
+
+	for _, cert := range kept.PeerCertificates {
+		result.Certificates = append(result.Certificates, webprobe.Certificate(cert))
+	}
+	if len(kept.OCSPResponse) > 0 {
+		result.OCSPStapled = true
+		var issuer *x509.Certificate
+		if len(kept.PeerCertificates) > 1 {
+			issuer = kept.PeerCertificates[1]
+		}
+		if response, err := ocsp.ParseResponse(kept.OCSPResponse, issuer); err == nil {
+			switch response.Status {
+			case ocsp.Good:
+				result.OCSPStatus = "good"
+			case ocsp.Revoked:
+				result.OCSPStatus = "revoked"
+			default:
+				result.OCSPStatus = "unknown"
+			}
+		}
+	}
+	return kept.PeerCertificates
+}
+
+// tlsHandshake completes a handshake with crypto/tls, offering every suite
+// it implements from TLS 1.0 up. An empty server name sends no SNI.
+func tlsHandshake(ctx context.Context, target Target, port int, serverName string, timeout time.Duration) (tls.ConnectionState, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	var suites []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites = append(suites, suite.ID)
+	}
+	client := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true, // Certificates are recorded, not trusted
+		MinVersion:         tls.VersionTLS10,
+		CipherSuites:       suites,
+	})
+	defer client.Close()
+
+	if err := client.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return client.ConnectionState(), nil
+}
+
+// tlsWeaknesses lists what is weak in the accepted versions and suites and
+// in the certificates. The signature and key of a self-signed certificate
+// after the leaf are not checked, as such a root is trusted as it is.
+func tlsWeaknesses(versions []database.TLSVersion, chain []*x509.Certificate) []string {
+	found := make(map[string]bool)
+	for _, version := range versions {
+		switch version.Version {
+		case "ssl30":
+			found["ssl3"] = true
+		case "tls10":
+			found["tls10"] = true
+		case "tls11":
+			found["tls11"] = true
+		}
+		for _, suite := range version.CipherSuites {
+			if strings.Contains(suite, "_RC4_") {
+				found["rc4"] = true
+			}
+			if strings.Contains(suite, "_3DES_") {
+				found["3des"] = true
+			}
+			if strings.Contains(suite, "_DES_") || strings.Contains(suite, "_DES40_") {
+				found["des"] = true
+			}
+			if strings.Contains(suite, "_NULL_") {
+				found["null-cipher"] = true
+			}
+			if strings.Contains(suite, "_EXPORT_") {
+				found["export-cipher"] = true
+			}
+			if strings.Contains(suite, "_anon_") {
+				found["anonymous-cipher"] = true
+			}
+		}
+	}
+
+	for i, cert := range chain {
+		if i > 0 && webprobe.SelfSigned(cert) {
+			continue
+		}
+		described := webprobe.Certificate(cert)
+		switch described.KeyAlgorithm {
+		case "RSA":
+			if described.KeyBits < minRSABits {
+				found["short-key"] = true
+			}
+		case "ECDSA":
+			if described.KeyBits < minECDSABits {
+				found["short-key"] = true
+			}
+		}
+		switch cert.SignatureAlgorithm {
+		case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			found["sha1-signature"] = true
+		case x509.MD5WithRSA, x509.MD2WithRSA:
+			found["md5-signature"] = true
+		}
+	}
+
+	weaknesses := make([]string, 0, len(found))
+	for weakness := range found {
+		weaknesses = append(weaknesses, weakness)
+	}
+	sort.Strings(weaknesses)
+	return weaknesses
+}
+
+func suiteIDs(suites []cipherSuite) []uint16 {
+	ids := make([]uint16, len(suites))
+	for i, suite := range suites {
+		ids[i] = suite.id
+	}
+	return ids
+}
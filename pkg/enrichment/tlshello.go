@@ -0,0 +1,363 @@
+// pkg/enrichment/tlshello.go
+
+package enrichment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/webprobe"
+)
+
+// Versions and cipher suites are enumerated with hand-built ClientHellos,
+// since crypto/tls cannot offer SSL 3.0, legacy suites or a chosen TLS 1.3
+// suite. Only the ServerHello is read; no handshake is completed.
+
+// Protocol versions, oldest first
+const (
+	versionSSL30 = 0x0300
+	versionTLS10 = 0x0301
+	versionTLS11 = 0x0302
+	versionTLS12 = 0x0303
+	versionTLS13 = 0x0304
+)
+
+var tlsVersions = []uint16{versionSSL30, versionTLS10, versionTLS11, versionTLS12, versionTLS13}
+
+var (
+	// errTLSRefused is a ClientHello answered with an alert
+	errTLSRefused = errors.New("handshake refused")
+	// errNotTLS is a ClientHello answered with something other than TLS
+	errNotTLS = errors.New("not a TLS server")
+)
+
+type cipherSuite struct {
+	id   uint16
+	name string
+}
+
+// tls13CipherSuites are offered only with TLS 1.3, which uses no others
+var tls13CipherSuites = []cipherSuite{
+	{0x1301, "TLS_AES_128_GCM_SHA256"},
+	{0x1302, "TLS_AES_256_GCM_SHA384"},
+	{0x1303, "TLS_CHACHA20_POLY1305_SHA256"},
+	{0x1304, "TLS_AES_128_CCM_SHA256"},
+	{0x1305, "TLS_AES_128_CCM_8_SHA256"},
+}
+
+// legacyCipherSuites are offered with SSL 3.0 up to TLS 1.2. They cover
+// what servers deploy today and the weak suites worth finding.
+var legacyCipherSuites = []cipherSuite{
+	{0xc02b, "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	{0xc02c, "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+	{0xc02f, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	{0xc030, "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+	{0xcca8, "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+	{0xcca9, "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"},
+	{0xccaa, "TLS_DHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+	{0x009e, "TLS_DHE_RSA_WITH_AES_128_GCM_SHA256"},
+	{0x009f, "TLS_DHE_RSA_WITH_AES_256_GCM_SHA384"},
+	{0xc023, "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256"},
+	{0xc024, "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384"},
+	{0xc027, "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256"},
+	{0xc028, "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384"},
+	{0xc009, "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA"},
+	{0xc00a, "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA"},
+	{0xc013, "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"},
+	{0xc014, "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA"},
+	{0x0067, "TLS_DHE_RSA_WITH_AES_128_CBC_SHA256"},
+	{0x006b, "TLS_DHE_RSA_WITH_AES_256_CBC_SHA256"},
+	{0x0033, "TLS_DHE_RSA_WITH_AES_128_CBC_SHA"},
+	{0x0039, "TLS_DHE_RSA_WITH_AES_256_CBC_SHA"},
+	{0x0045, "TLS_DHE_RSA_WITH_CAMELLIA_128_CBC_SHA"},
+	{0x0088, "TLS_DHE_RSA_WITH_CAMELLIA_256_CBC_SHA"},
+	{0x009c, "TLS_RSA_WITH_AES_128_GCM_SHA256"},
+	{0x009d, "TLS_RSA_WITH_AES_256_GCM_SHA384"},
+	{0x003c, "TLS_RSA_WITH_AES_128_CBC_SHA256"},
+	{0x003d, "TLS_RSA_WITH_AES_256_CBC_SHA256"},
+	{0x002f, "TLS_RSA_WITH_AES_128_CBC_SHA"},
+	{0x0035, "TLS_RSA_WITH_AES_256_CBC_SHA"},
+	{0x0041, "TLS_RSA_WITH_CAMELLIA_128_CBC_SHA"},
+	{0x0084, "TLS_RSA_WITH_CAMELLIA_256_CBC_SHA"},
+	{0x0096, "TLS_RSA_WITH_SEED_CBC_SHA"},
+	{0xc008, "TLS_ECDHE_ECDSA_WITH_3DES_EDE_CBC_SHA"},
+	{0xc012, "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA"},
+	{0x0016, "TLS_DHE_RSA_WITH_3DES_EDE_CBC_SHA"},
+	{0x000a, "TLS_RSA_WITH_3DES_EDE_CBC_SHA"},
+	{0x0015, "TLS_DHE_RSA_WITH_DES_CBC_SHA"},
+	{0x0009, "TLS_RSA_WITH_DES_CBC_SHA"},
+	{0xc007, "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA"},
+	{0xc011, "TLS_ECDHE_RSA_WITH_RC4_128_SHA"},
+	{0x0005, "TLS_RSA_WITH_RC4_128_SHA"},
+	{0x0004, "TLS_RSA_WITH_RC4_128_MD5"},
+	{0x0014, "TLS_DHE_RSA_EXPORT_WITH_DES40_CBC_SHA"},
+	{0x0008, "TLS_RSA_EXPORT_WITH_DES40_CBC_SHA"},
+	{0x0006, "TLS_RSA_EXPORT_WITH_RC2_CBC_40_MD5"},
+	{0x0003, "TLS_RSA_EXPORT_WITH_RC4_40_MD5"},
+	{0xc018, "TLS_ECDH_anon_WITH_AES_128_CBC_SHA"},
+	{0x0034, "TLS_DH_anon_WITH_AES_128_CBC_SHA"},
+	{0x003a, "TLS_DH_anon_WITH_AES_256_CBC_SHA"},
+	{0x001b, "TLS_DH_anon_WITH_3DES_EDE_CBC_SHA"},
+	{0xc016, "TLS_ECDH_anon_WITH_RC4_128_SHA"},
+	{0x0018, "TLS_DH_anon_WITH_RC4_128_MD5"},
+	{0x003b, "TLS_RSA_WITH_NULL_SHA256"},
+	{0x0002, "TLS_RSA_WITH_NULL_SHA"},
+	{0x0001, "TLS_RSA_WITH_NULL_MD5"},
+}
+
+// suitesFor returns the suites to offer with a version
+func suitesFor(version uint16) []cipherSuite {
+	if version == versionTLS13 {
+		return tls13CipherSuites
+	}
+	return legacyCipherSuites
+}
+
+func cipherSuiteName(version, id uint16) string {
+	for _, suite := range suitesFor(version) {
+		if suite.id == id {
+			return suite.name
+		}
+	}
+	return fmt.Sprintf("0x%04x", id)
+}
+
+// tlsVersionName names a version the way the web prober does, with SSL 3.0
+// as ssl30
+func tlsVersionName(version uint16) string {
+	if version == versionSSL30 {
+		return "ssl30"
+	}
+	return webprobe.VersionName(version)
+}
+
+// acceptedSuites returns the suites a server accepts with a version. All
+// are offered and each one the server picks is struck off before asking
+// again, so when the server enforces its own order the result follows it.
+// An error means the version itself was refused.
+func acceptedSuites(ctx context.Context, target Target, port int, version uint16, timeout time.Duration) ([]uint16, error) {
+	offered := suiteIDs(suitesFor(version))
+
+	var accepted []uint16
+	for len(offered) > 0 {
+		chosenVersion, chosen, err := helloExchange(ctx, target, port, version, offered, timeout)
+		if err == nil && chosenVersion != version {
+			err = fmt.Errorf("server chose %s", tlsVersionName(chosenVersion))
+		}
+		if err != nil {
+			if len(accepted) == 0 {
+				return nil, err
+			}
+			break
+		}
+
+		index := -1
+		for i, id := range offered {
+			if id == chosen {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			break // A suite that was not offered; the answers cannot be trusted further
+		}
+		accepted = append(accepted, chosen)
+		offered = append(append([]uint16(nil), offered[:index]...), offered[index+1:]...)
+	}
+	return accepted, nil
+}
+
+// helloExchange sends one ClientHello on a new connection and returns the
+// version and suite of the ServerHello
+func helloExchange(ctx context.Context, target Target, port int, version uint16, suites []uint16, timeout time.Duration) (uint16, uint16, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := dial(ctx, target, port)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(clientHello(version, suites, target.Hostname)); err != nil {
+		return 0, 0, err
+	}
+	return readServerHello(conn)
+}
+
+// clientHello builds a ClientHello record offering one version. TLS 1.3 is
+// offered through supported_versions with an X25519 key share, which only
+// has to look valid as the handshake stops at the ServerHello.
+func clientHello(version uint16, suites []uint16, serverName string) []byte {
+	legacyVersion := version
+	if version == versionTLS13 {
+		legacyVersion = versionTLS12
+	}
+
+	body := binary.BigEndian.AppendUint16(nil, legacyVersion)
+	random := make([]byte, 32+32)
+	rand.Read(random)
+	body = append(body, random[:32]...)
+	body = append(body, 32) // Session ID, for middlebox compatibility
+	body = append(body, random[32:]...)
+	body = binary.BigEndian.AppendUint16(body, uint16(2*len(suites)))
+	for _, suite := range suites {
+		body = binary.BigEndian.AppendUint16(body, suite)
+	}
+	body = append(body, 0x01, 0x00) // Null compression only
+
+	if version > versionSSL30 {
+		extensions := helloExtensions(version, serverName)
+		body = binary.BigEndian.AppendUint16(body, uint16(len(extensions)))
+		body = append(body, extensions...)
+	}
+
+	handshake := []byte{0x01, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	handshake = append(handshake, body...)
+
+	recordVersion := uint16(versionTLS10)
+	if version == versionSSL30 {
+		recordVersion = versionSSL30
+	}
+	record := []byte{0x16} // Handshake
+	record = binary.BigEndian.AppendUint16(record, recordVersion)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(handshake)))
+	return append(record, handshake...)
+}
+
+func helloExtensions(version uint16, serverName string) []byte {
+	var extensions []byte
+	add := func(kind uint16, data []byte) {
+		extensions = binary.BigEndian.AppendUint16(extensions, kind)
+		extensions = binary.BigEndian.AppendUint16(extensions, uint16(len(data)))
+		extensions = append(extensions, data...)
+	}
+	withLength := func(data []byte) []byte {
+		return append(binary.BigEndian.AppendUint16(nil, uint16(len(data))), data...)
+	}
+
+	if serverName != "" && net.ParseIP(serverName) == nil {
+		entry := append([]byte{0x00}, withLength([]byte(serverName))...) // host_name
+		add(0x0000, withLength(entry))
+	}
+
+	var groups []byte
+	for _, group := range []uint16{0x001d, 0x0017, 0x0018, 0x0019, 0x0100} { // X25519, P-256, P-384, P-521, ffdhe2048
+		groups = binary.BigEndian.AppendUint16(groups, group)
+	}
+	add(0x000a, withLength(groups))
+	add(0x000b, []byte{0x01, 0x00}) // Uncompressed EC points
+
+	if version >= versionTLS12 {
+		var algorithms []byte
+		for _, algorithm := range []uint16{
+			0x0403, 0x0503, 0x0603, // ECDSA with SHA-2
+			0x0804, 0x0805, 0x0806, // RSA-PSS
+			0x0401, 0x0501, 0x0601, // RSA PKCS#1 with SHA-2
+			0x0807,         // Ed25519
+			0x0201, 0x0203, // SHA-1, so servers with SHA-1 only certificates still answer
+		} {
+			algorithms = binary.BigEndian.AppendUint16(algorithms, algorithm)
+		}
+		add(0x000d, withLength(algorithms))
+	}
+	add(0xff01, []byte{0x00}) // Empty renegotiation_info
+
+	if version == versionTLS13 {
+		add(0x002b, []byte{0x02, 0x03, 0x04}) // supported_versions: TLS 1.3
+		share := binary.BigEndian.AppendUint16(nil, 0x001d)
+		key := make([]byte, 32)
+		rand.Read(key)
+		share = append(share, withLength(key)...)
+		add(0x0033, withLength(share))
+	}
+	return extensions
+}
+
+// readServerHello reads handshake records until the first message is
+// complete and returns the negotiated version and suite. An alert is
+// errTLSRefused and anything that is not TLS is errNotTLS.
+func readServerHello(conn net.Conn) (uint16, uint16, error) {
+	var message []byte
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			if len(message) == 0 {
+				return 0, 0, errNotTLS
+			}
+			return 0, 0, err
+		}
+		length := int(binary.BigEndian.Uint16(header[3:]))
+		if header[1] != 0x03 || length > 1<<14+2048 {
+			return 0, 0, errNotTLS
+		}
+		switch header[0] {
+		case 0x15: // Alert
+			return 0, 0, errTLSRefused
+		case 0x16: // Handshake
+		default:
+			return 0, 0, errNotTLS
+		}
+
+		fragment := make([]byte, length)
+		if _, err := io.ReadFull(conn, fragment); err != nil {
+			return 0, 0, err
+		}
+		message = append(message, fragment...)
+		if len(message) < 4 {
+			continue
+		}
+		if message[0] != 0x02 {
+			return 0, 0, fmt.Errorf("expected a ServerHello, got handshake message %d", message[0])
+		}
+		size := int(message[1])<<16 | int(message[2])<<8 | int(message[3])
+		if len(message) >= 4+size {
+			return parseServerHello(message[4 : 4+size])
+		}
+	}
+}
+
+// parseServerHello returns the version and suite of a ServerHello, taking
+// the version from supported_versions when TLS 1.3 was negotiated
+func parseServerHello(body []byte) (uint16, uint16, error) {
+	truncated := fmt.Errorf("truncated ServerHello")
+	if len(body) < 2+32+1 {
+		return 0, 0, truncated
+	}
+	version := binary.BigEndian.Uint16(body)
+	pos := 2 + 32
+	pos += 1 + int(body[pos]) // Session ID
+	if pos+3 > len(body) {
+		return 0, 0, truncated
+	}
+	suite := binary.BigEndian.Uint16(body[pos:])
+	pos += 3 // Suite and compression method
+
+	if pos+2 > len(body) {
+		return version, suite, nil // No extensions
+	}
+	end := pos + 2 + int(binary.BigEndian.Uint16(body[pos:]))
+	pos += 2
+	if end > len(body) {
+		return 0, 0, truncated
+	}
+	for pos+4 <= end {
+		kind := binary.BigEndian.Uint16(body[pos:])
+		size := int(binary.BigEndian.Uint16(body[pos+2:]))
+		pos += 4
+		if pos+size > end {
+			return 0, 0, truncated
+		}
+		if kind == 0x002b && size == 2 {
+			version = binary.BigEndian.Uint16(body[pos:])
+		}
+		pos += size
+	}
+	return version, suite, nil
+}
@@ -0,0 +1,268 @@
+// pkg/enrichment/tlshello_test.go
+
+package enrichment
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed ECDSA certificate for name
+func testCertificate(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serverHelloBody builds the body of a ServerHello message
+func serverHelloBody(version uint16, sessionID []byte, suite uint16, extensions []byte) []byte {
+	body := binary.BigEndian.AppendUint16(nil, version)
+	body = append(body, make([]byte, 32)...)
+	body = append(body, byte(len(sessionID)))
+	body = append(body, sessionID...)
+	body = binary.BigEndian.AppendUint16(body, suite)
+	body = append(body, 0x00)
+	if extensions != nil {
+		body = binary.BigEndian.AppendUint16(body, uint16(len(extensions)))
+		body = append(body, extensions...)
+	}
+	return body
+}
+
+// handshakeMessage wraps a body in a handshake header
+func handshakeMessage(kind byte, body []byte) []byte {
+	return append([]byte{kind, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// tlsRecord wraps a fragment in a record header
+func tlsRecord(kind byte, fragment []byte) []byte {
+	record := []byte{kind, 0x03, 0x03}
+	record = binary.BigEndian.AppendUint16(record, uint16(len(fragment)))
+	return append(record, fragment...)
+}
+
+// supportedVersion is a ServerHello supported_versions extension
+var supportedVersion = []byte{0x00, 0x2b, 0x00, 0x02, 0x03, 0x04}
+
+func TestParseServerHello(t *testing.T) {
+	sessionID := make([]byte, 32)
+
+	tests := []struct {
+		name        string
+		body        []byte
+		wantVersion uint16
+		wantSuite   uint16
+		wantErr     bool
+	}{
+		{name: "without extensions", body: serverHelloBody(versionTLS12, sessionID, 0xc02f, nil), wantVersion: versionTLS12, wantSuite: 0xc02f},
+		{name: "SSL 3.0", body: serverHelloBody(versionSSL30, nil, 0x000a, nil), wantVersion: versionSSL30, wantSuite: 0x000a},
+		{name: "empty extensions", body: serverHelloBody(versionTLS12, sessionID, 0xc02f, []byte{}), wantVersion: versionTLS12, wantSuite: 0xc02f},
+		{
+			name:        "other extensions",
+			body:        serverHelloBody(versionTLS12, sessionID, 0xc030, []byte{0xff, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0b, 0x00, 0x02, 0x01, 0x00}),
+			wantVersion: versionTLS12, wantSuite: 0xc030,
+		},
+		{
+			name:        "TLS 1.3 through supported_versions",
+			body:        serverHelloBody(versionTLS12, sessionID, 0x1301, append([]byte{0x00, 0x33, 0x00, 0x00}, supportedVersion...)),
+			wantVersion: versionTLS13, wantSuite: 0x1301,
+		},
+		{name: "empty", body: nil, wantErr: true},
+		{name: "random cut short", body: serverHelloBody(versionTLS12, nil, 0xc02f, nil)[:20], wantErr: true},
+		{name: "session ID longer than the message", body: serverHelloBody(versionTLS12, sessionID, 0xc02f, nil)[:2+32+1+16], wantErr: true},
+		{name: "suite cut short", body: serverHelloBody(versionTLS12, nil, 0xc02f, nil)[:2+32+1+1], wantErr: true},
+		{name: "extensions longer than the message", body: serverHelloBody(versionTLS12, sessionID, 0x1301, supportedVersion)[:2+32+33+3+2+3], wantErr: true},
+		{name: "extension longer than the extensions", body: serverHelloBody(versionTLS12, sessionID, 0x1301, []byte{0x00, 0x2b, 0x00, 0x09, 0x03, 0x04}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		version, suite, err := parseServerHello(tt.body)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (version != tt.wantVersion || suite != tt.wantSuite) {
+			t.Errorf("%s: got %04x/%04x, want %04x/%04x", tt.name, version, suite, tt.wantVersion, tt.wantSuite)
+		}
+	}
+}
+
+func TestReadServerHello(t *testing.T) {
+	hello := handshakeMessage(0x02, serverHelloBody(versionTLS12, make([]byte, 32), 0xc02b, nil))
+	oversized := []byte{0x16, 0x03, 0x03, 0xff, 0xff}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error // nil for any error when failing is all that matters
+		fails   bool
+	}{
+		{name: "one record", data: tlsRecord(0x16, hello)},
+		{name: "split across records", data: append(tlsRecord(0x16, hello[:10]), tlsRecord(0x16, hello[10:])...)},
+		{name: "header split across records", data: append(tlsRecord(0x16, hello[:2]), tlsRecord(0x16, hello[2:])...)},
+		{name: "followed by more messages", data: tlsRecord(0x16, append(hello, handshakeMessage(0x0b, []byte{0, 0, 0})...))},
+		{name: "nothing", data: nil, fails: true, wantErr: errNotTLS},
+		{name: "short header", data: []byte{0x16, 0x03}, fails: true, wantErr: errNotTLS},
+		{name: "HTTP", data: []byte("HTTP/1.1 400 Bad Request\r\n\r\n"), fails: true, wantErr: errNotTLS},
+		{name: "SSH", data: []byte("SSH-2.0-OpenSSH_9.6\r\n"), fails: true, wantErr: errNotTLS},
+		{name: "alert", data: tlsRecord(0x15, []byte{0x02, 0x46}), fails: true, wantErr: errTLSRefused},
+		{name: "application data", data: tlsRecord(0x17, []byte{0x01}), fails: true, wantErr: errNotTLS},
+		{name: "oversized record", data: oversized, fails: true, wantErr: errNotTLS},
+		{name: "record cut short", data: tlsRecord(0x16, hello)[:30], fails: true},
+		{name: "message cut short", data: tlsRecord(0x16, hello[:30]), fails: true},
+		{name: "second record missing", data: tlsRecord(0x16, hello[:10]), fails: true},
+		{name: "not a ServerHello", data: tlsRecord(0x16, handshakeMessage(0x0e, nil)), fails: true},
+		{name: "malformed ServerHello", data: tlsRecord(0x16, handshakeMessage(0x02, []byte{0x03, 0x03, 0x00})), fails: true},
+	}
+
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		go func(data []byte) {
+			server.Write(data)
+			server.Close()
+		}(tt.data)
+
+		version, suite, err := readServerHello(client)
+		client.Close()
+
+		if (err != nil) != tt.fails {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.fails)
+			continue
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if !tt.fails && (version != versionTLS12 || suite != 0xc02b) {
+			t.Errorf("%s: got %04x/%04x, want %04x/c02b", tt.name, version, suite, versionTLS12)
+		}
+	}
+}
+
+// TestClientHello checks that the hand-built ClientHellos are understood by
+// the crypto/tls server
+func TestClientHello(t *testing.T) {
+	config := &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t, "tls.example.com")},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	tests := []struct {
+		name        string
+		version     uint16
+		suites      []uint16
+		serverName  string
+		wantVersion uint16
+		wantSuite   uint16
+		wantErr     error
+	}{
+		{name: "TLS 1.2", version: versionTLS12, suites: []uint16{0xc02c}, wantVersion: versionTLS12, wantSuite: 0xc02c},
+		{name: "TLS 1.2 with a server name", version: versionTLS12, suites: []uint16{0x0005, 0xc02b}, serverName: "tls.example.com", wantVersion: versionTLS12, wantSuite: 0xc02b},
+		{name: "TLS 1.3", version: versionTLS13, suites: []uint16{0x1302}, serverName: "tls.example.com", wantVersion: versionTLS13, wantSuite: 0x1302},
+		{name: "version below the server's minimum", version: versionTLS10, suites: []uint16{0xc009}, wantErr: errTLSRefused},
+		{name: "no suite in common", version: versionTLS12, suites: []uint16{0x0005, 0x000a}, wantErr: errTLSRefused},
+	}
+
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		go func() {
+			tls.Server(server, config).Handshake()
+			server.Close()
+		}()
+		client.SetDeadline(time.Now().Add(5 * time.Second))
+
+		go client.Write(clientHello(tt.version, tt.suites, tt.serverName))
+		version, suite, err := readServerHello(client)
+		client.Close()
+
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if version != tt.wantVersion || suite != tt.wantSuite {
+			t.Errorf("%s: got %04x/%04x, want %04x/%04x", tt.name, version, suite, tt.wantVersion, tt.wantSuite)
+		}
+	}
+}
+
+func TestAcceptedSuites(t *testing.T) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t, "tls.example.com")},
+		MinVersion:   tls.VersionTLS12,
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+
+	ctx := context.Background()
+	target := Target{IPAddress: "127.0.0.1"}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	suites, err := acceptedSuites(ctx, target, port, versionTLS12, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suites) != 2 || !containsSuite(suites, 0xc02b) || !containsSuite(suites, 0xc02c) {
+		t.Errorf("accepted suites = %04x, want c02b and c02c", suites)
+	}
+
+	for _, version := range []uint16{versionSSL30, versionTLS11, versionTLS13} {
+		if suites, err := acceptedSuites(ctx, target, port, version, 5*time.Second); err == nil {
+			t.Errorf("%s accepted with suites %04x, want it refused", tlsVersionName(version), suites)
+		}
+	}
+}
+
+func containsSuite(suites []uint16, id uint16) bool {
+	for _, suite := range suites {
+		if suite == id {
+			return true
+		}
+	}
+	return false
+}
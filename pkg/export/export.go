@@ -0,0 +1,127 @@
+// pkg/export/export.go
+
+// Package export renders scan results in the formats other tools read:
+// Nmap XML, CSV, JSON Lines and SARIF. Writers stream host by host, so an
+// export of the whole inventory never has to be held in memory.
+package export
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Host is one scan of one IP, with the IP's metadata and what enrichment
+// found on the ports of that scan, if anything
+type Host struct {
+	IP         models.IP
+	Scan       models.ScanResult
+	Enrichment *database.HttpxEnrichment
+}
+
+// Writer renders hosts to an output. Close finishes the document and must
+// be called once every host is written; it does not close the output.
+type Writer interface {
+	WriteHost(host Host) error
+	Close() error
+}
+
+// NewWriter returns a writer of format to w
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case models.ExportFormatNmap:
+		return newNmapWriter(w)
+	case models.ExportFormatCSV:
+		return newCSVWriter(w)
+	case models.ExportFormatJSONL:
+		return newJSONLWriter(w), nil
+	case models.ExportFormatSARIF:
+		return newSARIFWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// ContentType returns the media type of format
+func ContentType(format string) string {
+	switch format {
+	case models.ExportFormatNmap:
+		return "application/xml"
+	case models.ExportFormatCSV:
+		return "text/csv"
+	case models.ExportFormatJSONL:
+		return "application/x-ndjson"
+	case models.ExportFormatSARIF:
+		return "application/sarif+json"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Extension returns the file extension of format, with its dot
+func Extension(format string) string {
+	switch format {
+	case models.ExportFormatNmap:
+		return ".xml"
+	case models.ExportFormatCSV:
+		return ".csv"
+	case models.ExportFormatJSONL:
+		return ".jsonl"
+	case models.ExportFormatSARIF:
+		return ".sarif"
+	default:
+		return ""
+	}
+}
+
+// webProbes returns what enrichment found on a port. Enrichment only probes
+// TCP ports, over both HTTP and HTTPS; failed probes are left out.
+func (h Host) webProbes(port models.Port) []database.HttpxResult {
+	if h.Enrichment == nil || models.NormalizeProtocol(port.Protocol) != models.ProtocolTCP {
+		return nil
+	}
+
+	var probes []database.HttpxResult
+	for _, result := range h.Enrichment.EnrichedPorts {
+		if result.Failed || probePort(result) != port.Number {
+			continue
+		}
+		probes = append(probes, result)
+	}
+	return probes
+}
+
+// probePort returns the port an enrichment result was probed on, from its
+// port field or failing that its URL
+func probePort(result database.HttpxResult) int {
+	if port, err := strconv.Atoi(result.Port); err == nil {
+		return port
+	}
+	parsed, err := url.Parse(result.URL)
+	if err != nil {
+		return 0
+	}
+	if port, err := strconv.Atoi(parsed.Port()); err == nil {
+		return port
+	}
+	switch parsed.Scheme {
+	case "http":
+		return 80
+	case "https":
+		return 443
+	}
+	return 0
+}
+
+// addressType returns the Nmap address type of an IP
+func addressType(ipAddress string) string {
+	if ip := net.ParseIP(ipAddress); ip != nil && ip.To4() == nil {
+		return "ipv6"
+	}
+	return "ipv4"
+}
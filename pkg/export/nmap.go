@@ -0,0 +1,208 @@
+// pkg/export/nmap.go
+
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// The elements of Nmap's XML output that NexusScan has data for, as laid out
+// in nmap.dtd. Scans are hosts of a single run, so an IP with several scans
+// in a history export appears once per scan.
+
+type nmapHost struct {
+	XMLName   xml.Name       `xml:"host"`
+	StartTime int64          `xml:"starttime,attr,omitempty"`
+	EndTime   int64          `xml:"endtime,attr,omitempty"`
+	Comment   string         `xml:"comment,attr,omitempty"`
+	Status    nmapStatus     `xml:"status"`
+	Address   nmapAddress    `xml:"address"`
+	Hostnames []nmapHostname `xml:"hostnames>hostname"`
+	Ports     nmapPorts      `xml:"ports"`
+}
+
+type nmapStatus struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+}
+
+type nmapHostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type nmapPorts struct {
+	ExtraPorts []nmapExtraPorts `xml:"extraports"`
+	Ports      []nmapPort       `xml:"port"`
+}
+
+type nmapExtraPorts struct {
+	State string `xml:"state,attr"`
+	Count int    `xml:"count,attr"`
+}
+
+type nmapPort struct {
+	Protocol string       `xml:"protocol,attr"`
+	PortID   int          `xml:"portid,attr"`
+	State    nmapState    `xml:"state"`
+	Service  *nmapService `xml:"service,omitempty"`
+	Scripts  []nmapScript `xml:"script"`
+}
+
+type nmapState struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapService struct {
+	Name    string `xml:"name,attr"`
+	Product string `xml:"product,attr,omitempty"`
+	Version string `xml:"version,attr,omitempty"`
+	Method  string `xml:"method,attr"`
+	Conf    int    `xml:"conf,attr"`
+}
+
+type nmapScript struct {
+	ID     string `xml:"id,attr"`
+	Output string `xml:"output,attr"`
+}
+
+type nmapRunStats struct {
+	XMLName  xml.Name     `xml:"runstats"`
+	Finished nmapFinished `xml:"finished"`
+	Hosts    nmapHosts    `xml:"hosts"`
+}
+
+type nmapFinished struct {
+	Time    int64   `xml:"time,attr"`
+	TimeStr string  `xml:"timestr,attr"`
+	Elapsed float64 `xml:"elapsed,attr"`
+	Summary string  `xml:"summary,attr"`
+	Exit    string  `xml:"exit,attr"`
+}
+
+type nmapHosts struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+type nmapWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+	started time.Time
+	hosts   int
+}
+
+func newNmapWriter(w io.Writer) (*nmapWriter, error) {
+	started := time.Now().UTC()
+	_, err := fmt.Fprintf(w, "%s<!DOCTYPE nmaprun>\n<nmaprun scanner=\"nexusscan\" args=\"nexusscan export\" start=\"%d\" startstr=\"%s\" version=\"1.0\" xmloutputversion=\"1.05\">\n",
+		xml.Header, started.Unix(), started.Format(time.ANSIC))
+	if err != nil {
+		return nil, err
+	}
+	return &nmapWriter{w: w, encoder: xml.NewEncoder(w), started: started}, nil
+}
+
+func (n *nmapWriter) WriteHost(host Host) error {
+	scanned := scanTime(host.Scan)
+	element := nmapHost{
+		Comment: host.Scan.ScanID,
+		Status:  nmapStatus{State: "up", Reason: "user-set"},
+		Address: nmapAddress{Addr: host.IP.IPAddress, AddrType: addressType(host.IP.IPAddress)},
+	}
+	if !scanned.IsZero() {
+		element.EndTime = scanned.Unix()
+		element.StartTime = scanned.Add(-time.Duration(host.Scan.ScanDuration) * time.Millisecond).Unix()
+	}
+	if host.IP.Hostname != "" {
+		element.Hostnames = []nmapHostname{{Name: host.IP.Hostname, Type: "user"}}
+	}
+	if closed := host.Scan.PortsScanned - len(host.Scan.OpenPorts); closed > 0 {
+		element.Ports.ExtraPorts = []nmapExtraPorts{{State: "closed", Count: closed}}
+	}
+
+	for _, port := range host.Scan.OpenPorts {
+		protocol := models.NormalizeProtocol(port.Protocol)
+		reason := "syn-ack"
+		if protocol == models.ProtocolUDP {
+			reason = "udp-response"
+		}
+		state := port.State
+		if state == "" {
+			state = "open"
+		}
+
+		entry := nmapPort{
+			Protocol: protocol,
+			PortID:   port.Number,
+			State:    nmapState{State: state, Reason: reason},
+		}
+		if port.Service != "" {
+			entry.Service = &nmapService{Name: port.Service, Product: port.Product, Version: port.Version, Method: "probed", Conf: 10}
+		}
+		if port.Banner != "" {
+			entry.Scripts = append(entry.Scripts, nmapScript{ID: "banner", Output: port.Banner})
+		}
+		for _, probe := range host.webProbes(port) {
+			if probe.Title != "" {
+				entry.Scripts = append(entry.Scripts, nmapScript{ID: "http-title", Output: probe.Title})
+			}
+			if probe.ServerHeader != "" {
+				entry.Scripts = append(entry.Scripts, nmapScript{ID: "http-server-header", Output: probe.ServerHeader})
+			}
+			if len(probe.Technologies) > 0 {
+				entry.Scripts = append(entry.Scripts, nmapScript{ID: "http-technologies", Output: strings.Join(probe.Technologies, ", ")})
+			}
+		}
+		element.Ports.Ports = append(element.Ports.Ports, entry)
+	}
+
+	if err := n.encoder.Encode(element); err != nil {
+		return err
+	}
+	n.hosts++
+	_, err := io.WriteString(n.w, "\n")
+	return err
+}
+
+func (n *nmapWriter) Close() error {
+	finished := time.Now().UTC()
+	stats := nmapRunStats{
+		Finished: nmapFinished{
+			Time:    finished.Unix(),
+			TimeStr: finished.Format(time.ANSIC),
+			Elapsed: finished.Sub(n.started).Seconds(),
+			Summary: fmt.Sprintf("NexusScan export of %d hosts", n.hosts),
+			Exit:    "success",
+		},
+		Hosts: nmapHosts{Up: n.hosts, Total: n.hosts},
+	}
+	if err := n.encoder.Encode(stats); err != nil {
+		return err
+	}
+	_, err := io.WriteString(n.w, "\n</nmaprun>\n")
+	return err
+}
+
+// scanTime returns when a scan finished. Final summaries stored before
+// result keys kept nanoseconds have an extra Z on their timestamp.
+func scanTime(result models.ScanResult) time.Time {
+	for _, layout := range []string{time.RFC3339, time.RFC3339 + "Z"} {
+		if t, err := time.Parse(layout, result.ScanTimestamp); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
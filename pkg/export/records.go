@@ -0,0 +1,151 @@
+// pkg/export/records.go
+
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// record is one open port of a host, the row of a CSV export and the object
+// of a JSON Lines export. A host without open ports is a single record with
+// the port fields empty, so every host scanned appears in the export.
+type record struct {
+	IPAddress    string            `json:"ip"`
+	Hostname     string            `json:"hostname,omitempty"`
+	Group        string            `json:"group,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	ScanID       string            `json:"scanId"`
+	Timestamp    string            `json:"timestamp"`
+	Protocol     string            `json:"protocol"`
+	Port         int               `json:"port,omitempty"`
+	State        string            `json:"state,omitempty"`
+	Service      string            `json:"service,omitempty"`
+	Product      string            `json:"product,omitempty"`
+	Version      string            `json:"version,omitempty"`
+	Banner       string            `json:"banner,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	StatusCode   int               `json:"statusCode,omitempty"`
+	Title        string            `json:"title,omitempty"`
+	Server       string            `json:"server,omitempty"`
+	Technologies []string          `json:"technologies,omitempty"`
+}
+
+// csvHeader names the columns of a CSV export, in the order of record
+var csvHeader = []string{
+	"ip", "hostname", "group", "owner", "tags", "scan_id", "timestamp", "protocol",
+	"port", "state", "service", "product", "version", "banner",
+	"url", "status_code", "title", "server", "technologies",
+}
+
+// records flattens a host into one record per open port. Ports with web
+// services get the first page enrichment fetched from them.
+func records(host Host) []record {
+	base := record{
+		IPAddress: host.IP.IPAddress,
+		Hostname:  host.IP.Hostname,
+		Group:     host.IP.Group,
+		Owner:     host.IP.Owner,
+		Tags:      host.IP.Tags,
+		ScanID:    host.Scan.ScanID,
+		Timestamp: host.Scan.ScanTimestamp,
+		Protocol:  models.NormalizeProtocol(host.Scan.Protocol),
+	}
+	if scanned := scanTime(host.Scan); !scanned.IsZero() {
+		base.Timestamp = scanned.UTC().Format(time.RFC3339)
+	}
+	if len(host.Scan.OpenPorts) == 0 {
+		return []record{base}
+	}
+
+	rows := make([]record, 0, len(host.Scan.OpenPorts))
+	for _, port := range host.Scan.OpenPorts {
+		row := base
+		row.Protocol = models.NormalizeProtocol(port.Protocol)
+		row.Port = port.Number
+		row.State = port.State
+		row.Service = port.Service
+		row.Product = port.Product
+		row.Version = port.Version
+		row.Banner = port.Banner
+		if probes := host.webProbes(port); len(probes) > 0 {
+			row.URL = probes[0].URL
+			row.StatusCode = probes[0].StatusCode
+			row.Title = probes[0].Title
+			row.Server = probes[0].ServerHeader
+			row.Technologies = probes[0].Technologies
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	out := &csvWriter{w: csv.NewWriter(w)}
+	if err := out.w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *csvWriter) WriteHost(host Host) error {
+	for _, row := range records(host) {
+		port, status := "", ""
+		if row.Port != 0 {
+			port = strconv.Itoa(row.Port)
+		}
+		if row.StatusCode != 0 {
+			status = strconv.Itoa(row.StatusCode)
+		}
+		err := c.w.Write([]string{
+			row.IPAddress, row.Hostname, row.Group, row.Owner, models.FormatTags(row.Tags),
+			row.ScanID, row.Timestamp, row.Protocol,
+			port, row.State, row.Service, row.Product, row.Version, row.Banner,
+			row.URL, status, row.Title, row.Server, strings.Join(row.Technologies, ","),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &jsonlWriter{encoder: encoder}
+}
+
+func (j *jsonlWriter) WriteHost(host Host) error {
+	for _, row := range records(host) {
+		if err := j.encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,153 @@
+// pkg/export/sarif.go
+
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The SARIF 2.1.0 objects an export uses. Every open port is one result of
+// the open-port rule, located at a tcp:// or udp:// URI, with the fields
+// of the CSV and JSON Lines exports as its properties.
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifRuleID  = "open-port"
+)
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          record            `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+type sarifWriter struct {
+	w       io.Writer
+	results int
+}
+
+func newSARIFWriter(w io.Writer) (*sarifWriter, error) {
+	driver, err := json.Marshal(sarifDriver{
+		Name:           "NexusScan",
+		InformationURI: "https://github.com/Elite-Security-Systems/nexusscan",
+		Rules: []sarifRule{{
+			ID:                   sarifRuleID,
+			Name:                 "OpenPort",
+			ShortDescription:     sarifMessage{Text: "A network port is open"},
+			DefaultConfiguration: sarifConfiguration{Level: "note"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = fmt.Fprintf(w, `{"version":%q,"$schema":%q,"runs":[{"tool":{"driver":%s},"results":[`+"\n", sarifVersion, sarifSchema, driver)
+	if err != nil {
+		return nil, err
+	}
+	return &sarifWriter{w: w}, nil
+}
+
+// WriteHost adds a result per open port. Hosts without open ports have no
+// findings and add nothing.
+func (s *sarifWriter) WriteHost(host Host) error {
+	for _, row := range records(host) {
+		if row.Port == 0 {
+			continue
+		}
+
+		result := sarifResult{
+			RuleID:  sarifRuleID,
+			Level:   "note",
+			Message: sarifMessage{Text: sarifText(row)},
+			PartialFingerprints: map[string]string{
+				"openPort/v1": fmt.Sprintf("%s/%s/%d", row.IPAddress, row.Protocol, row.Port),
+			},
+			Properties: row,
+		}
+		var location sarifLocation
+		location.PhysicalLocation.ArtifactLocation.URI = row.Protocol + "://" + net.JoinHostPort(row.IPAddress, strconv.Itoa(row.Port))
+		result.Locations = []sarifLocation{location}
+
+		// Results go one to a line, with banners and titles left unescaped
+		var encoded bytes.Buffer
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		if s.results > 0 {
+			if _, err := io.WriteString(s.w, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := s.w.Write(encoded.Bytes()); err != nil {
+			return err
+		}
+		s.results++
+	}
+	return nil
+}
+
+func (s *sarifWriter) Close() error {
+	_, err := io.WriteString(s.w, "]}]}\n")
+	return err
+}
+
+// sarifText describes an open port and what runs on it
+func sarifText(row record) string {
+	text := fmt.Sprintf("Port %d/%s is open on %s", row.Port, row.Protocol, row.IPAddress)
+
+	var service []string
+	for _, part := range []string{row.Service, row.Product, row.Version} {
+		if part != "" {
+			service = append(service, part)
+		}
+	}
+	if len(service) > 0 {
+		text += " (" + strings.Join(service, " ") + ")"
+	}
+	if row.Title != "" {
+		text += fmt.Sprintf(", serving %q", row.Title)
+	}
+	return text
+}
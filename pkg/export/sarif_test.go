@@ -0,0 +1,75 @@
+// pkg/export/sarif_test.go
+
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+func TestSARIFLocationURI(t *testing.T) {
+	tests := []struct {
+		ipAddress string
+		protocol  string
+		port      int
+		want      string
+	}{
+		{ipAddress: "10.0.0.1", protocol: "tcp", port: 22, want: "tcp://10.0.0.1:22"},
+		{ipAddress: "2001:db8::1", protocol: "tcp", port: 443, want: "tcp://[2001:db8::1]:443"},
+		{ipAddress: "::1", protocol: "udp", port: 53, want: "udp://[::1]:53"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		w, err := NewWriter(models.ExportFormatSARIF, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		host := Host{
+			IP: models.IP{IPAddress: tt.ipAddress},
+			Scan: models.ScanResult{
+				IPAddress: tt.ipAddress,
+				ScanID:    models.NewScanID("scan", tt.ipAddress),
+				OpenPorts: []models.Port{{Number: tt.port, Protocol: tt.protocol, State: models.PortStateOpen}},
+			},
+		}
+		if err := w.WriteHost(host); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var doc struct {
+			Runs []struct {
+				Results []sarifResult `json:"results"`
+			} `json:"runs"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+			t.Fatalf("invalid SARIF for %s: %v\n%s", tt.ipAddress, err, out.String())
+		}
+		if len(doc.Runs) != 1 || len(doc.Runs[0].Results) != 1 {
+			t.Fatalf("SARIF for %s has %+v, want one result", tt.ipAddress, doc.Runs)
+		}
+		if got := doc.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI; got != tt.want {
+			t.Errorf("SARIF URI for %s = %q, want %q", tt.ipAddress, got, tt.want)
+		}
+	}
+}
+
+func TestAddressType(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1":        "ipv4",
+		"::ffff:10.0.0.1": "ipv4",
+		"2001:db8::1":     "ipv6",
+		"::1":             "ipv6",
+	}
+	for ipAddress, want := range tests {
+		if got := addressType(ipAddress); got != want {
+			t.Errorf("addressType(%q) = %q, want %q", ipAddress, got, want)
+		}
+	}
+}
@@ -0,0 +1,4650 @@
+// pkg/handlers/api/api.go
+
+// Package api serves the REST API behind API Gateway
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	lambdaService "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/targets"
+	"github.com/google/uuid"
+//	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+)
+
+// Response represents an API response
+type Response struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Helper function to create error responses
+func errorResponse(statusCode int, message string) (Response, error) {
+	errorJSON, _ := json.Marshal(ErrorResponse{Error: message})
+	
+	return Response{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(errorJSON),
+	}, nil
+}
+
+// canonicalIP decodes an IP address taken from a URL path or request body and
+// returns its canonical form, so IPv6 spellings match the stored inventory key.
+// Values that do not parse are returned unchanged and simply match nothing.
+func canonicalIP(ipAddress string) string {
+	if decoded, err := url.PathUnescape(ipAddress); err == nil {
+		ipAddress = decoded
+	}
+	if canonical, err := targets.CanonicalIP(ipAddress); err == nil {
+		return canonical
+	}
+	return ipAddress
+}
+
+// IP Management Endpoints
+
+// addIP adds a single IP address. CIDR blocks, ranges and hostnames are
+// expanded and added as a bulk request.
+func addIP(ctx context.Context, ipAddress string, exclude []string, metadata models.AssetMetadata) (Response, error) {
+	if !targets.IsSingleAddress(ipAddress) {
+		return addIPs(ctx, []string{ipAddress}, exclude, metadata)
+	}
+	
+	// Validate metadata
+	if err := metadata.Validate(); err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid metadata: %v", err))
+	}
+	
+	ipAddress, err := targets.CanonicalIP(ipAddress)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Add IP to database
+	if err := db.AddIPFromNetwork(ctx, ipAddress, "", "", metadata); err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error adding IP: %v", err))
+	}
+	
+	// Create success response
+	response := struct {
+		Message string `json:"message"`
+		IP      string `json:"ip"`
+	}{
+		Message: "IP added successfully",
+		IP:      ipAddress,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// addIPs adds multiple IP addresses, expanding CIDR blocks, ranges and
+// hostnames. Every IP added gets the same metadata.
+func addIPs(ctx context.Context, ips []string, exclude []string, metadata models.AssetMetadata) (Response, error) {
+	// Validate metadata
+	if err := metadata.Validate(); err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid metadata: %v", err))
+	}
+	
+	// Expand target specifications into individual addresses
+	expanded, err := targets.Expand(ctx, ips, targets.Options{Exclude: exclude})
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid targets: %v", err))
+	}
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Add each IP to database
+	var addedIPs []string
+	var failedIPs []string
+	
+	for _, target := range expanded {
+		if err := db.AddIPFromNetwork(ctx, target.IPAddress, target.Network, target.Hostname, metadata); err != nil {
+			log.Printf("Error adding IP %s: %v", target.IPAddress, err)
+			failedIPs = append(failedIPs, target.IPAddress)
+		} else {
+			addedIPs = append(addedIPs, target.IPAddress)
+		}
+	}
+	
+	// Create response
+	response := struct {
+		Message   string   `json:"message"`
+		AddedIPs  []string `json:"addedIPs"`
+		FailedIPs []string `json:"failedIPs,omitempty"`
+		Total     int      `json:"total"`
+	}{
+		Message:   fmt.Sprintf("Added %d out of %d IPs", len(addedIPs), len(expanded)),
+		AddedIPs:  addedIPs,
+		FailedIPs: failedIPs,
+		Total:     len(addedIPs),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// deleteIP removes an IP address
+func deleteIP(ctx context.Context, ipAddress string) (Response, error) {
+	ipAddress = canonicalIP(ipAddress)
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Delete IP from database
+	if err := db.DeleteIP(ctx, ipAddress); err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error deleting IP: %v", err))
+	}
+	
+	// Create success response
+	response := struct {
+		Message string `json:"message"`
+		IP      string `json:"ip"`
+	}{
+		Message: "IP deleted successfully",
+		IP:      ipAddress,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getIP retrieves one IP with its metadata
+func getIP(ctx context.Context, ipAddress string) (Response, error) {
+	ipAddress = canonicalIP(ipAddress)
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	ip, err := db.GetIP(ctx, ipAddress)
+	if errors.Is(err, database.ErrIPNotFound) {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("IP %s not found", ipAddress))
+	}
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting IP: %v", err))
+	}
+	
+	responseJSON, _ := json.Marshal(ip)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// updateIPMetadata applies a metadata update to each of a list of IPs
+func updateIPMetadata(ctx context.Context, ips []string, update models.AssetMetadataUpdate) (Response, error) {
+	// Validate the update on its own; tag counts are checked per IP
+	if err := update.Apply(models.AssetMetadata{}).Validate(); err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid metadata: %v", err))
+	}
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Update each IP
+	updated := []models.IP{}
+	var failedIPs []string
+	
+	for _, ipAddress := range ips {
+		ipAddress = canonicalIP(ipAddress)
+		
+		ip, err := db.GetIP(ctx, ipAddress)
+		if err != nil {
+			log.Printf("Error getting IP %s: %v", ipAddress, err)
+			failedIPs = append(failedIPs, ipAddress)
+			continue
+		}
+		
+		ip.AssetMetadata = update.Apply(ip.AssetMetadata)
+		if err := ip.AssetMetadata.Validate(); err != nil {
+			log.Printf("Not updating metadata of IP %s: %v", ipAddress, err)
+			failedIPs = append(failedIPs, ipAddress)
+			continue
+		}
+		
+		if err := db.SetIPMetadata(ctx, ipAddress, ip.AssetMetadata); err != nil {
+			log.Printf("Error updating metadata of IP %s: %v", ipAddress, err)
+			failedIPs = append(failedIPs, ipAddress)
+			continue
+		}
+		updated = append(updated, *ip)
+	}
+	
+	// Create response
+	response := struct {
+		Message   string      `json:"message"`
+		IPs       []models.IP `json:"ips"`
+		FailedIPs []string    `json:"failedIPs,omitempty"`
+		Total     int         `json:"total"`
+	}{
+		Message:   fmt.Sprintf("Updated %d out of %d IPs", len(updated), len(ips)),
+		IPs:       updated,
+		FailedIPs: failedIPs,
+		Total:     len(updated),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// deleteIPs removes a list of IPs
+func deleteIPs(ctx context.Context, ips []string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	var deleted []string
+	var failedIPs []string
+	
+	for _, ipAddress := range ips {
+		ipAddress = canonicalIP(ipAddress)
+		if err := db.DeleteIP(ctx, ipAddress); err != nil {
+			log.Printf("Error deleting IP %s: %v", ipAddress, err)
+			failedIPs = append(failedIPs, ipAddress)
+			continue
+		}
+		deleted = append(deleted, ipAddress)
+	}
+	
+	// Create response
+	response := struct {
+		Message    string   `json:"message"`
+		DeletedIPs []string `json:"deletedIPs"`
+		FailedIPs  []string `json:"failedIPs,omitempty"`
+		Total      int      `json:"total"`
+	}{
+		Message:    fmt.Sprintf("Deleted %d out of %d IPs", len(deleted), len(ips)),
+		DeletedIPs: deleted,
+		FailedIPs:  failedIPs,
+		Total:      len(deleted),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// selectIPs returns every IP in the inventory a selector matches, for bulk
+// requests that name their IPs by group, owner or tags. The IPs are picked
+// once, when the request is made; schedules keep their selector instead (see
+// addSelectorSchedule). When they cannot be, it returns the response to send
+// instead.
+func selectIPs(ctx context.Context, selector models.AssetSelector) ([]string, *Response) {
+	fail := func(statusCode int, message string) ([]string, *Response) {
+		response, _ := errorResponse(statusCode, message)
+		return nil, &response
+	}
+	
+	if message := invalidSelector(selector); message != "" {
+		return fail(http.StatusBadRequest, message)
+	}
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return fail(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	ips, err := services.DB.SelectIPs(ctx, selector)
+	if err != nil {
+		return fail(http.StatusInternalServerError, fmt.Sprintf("Error selecting IPs: %v", err))
+	}
+	
+	if len(ips) == 0 {
+		return fail(http.StatusNotFound, "No IPs match the selector")
+	}
+	return ips, nil
+}
+
+// invalidSelector returns why a selector cannot pick IPs, or "" when it can
+func invalidSelector(selector models.AssetSelector) string {
+	if selector.IsEmpty() {
+		return "Selector must name a group, owner or tag"
+	}
+	if err := selector.Validate(); err != nil {
+		return fmt.Sprintf("Invalid selector: %v", err)
+	}
+	return ""
+}
+
+// bulkIPs returns the IPs of a bulk request, which names them either as a
+// list or with a selector. When it cannot, it returns the response to send
+// instead.
+func bulkIPs(ctx context.Context, ips []string, selector *models.AssetSelector) ([]string, *Response) {
+	switch {
+	case selector != nil && len(ips) > 0:
+		response, _ := errorResponse(http.StatusBadRequest, "Give either an IPs list or a selector, not both")
+		return nil, &response
+	case selector != nil:
+		return selectIPs(ctx, *selector)
+	case len(ips) == 0:
+		response, _ := errorResponse(http.StatusBadRequest, "IPs list or selector is required")
+		return nil, &response
+	}
+	return ips, nil
+}
+
+// getIPsByNetwork retrieves all IPs added from a network
+func getIPsByNetwork(ctx context.Context, network string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	ips, err := db.GetIPsByNetwork(ctx, network)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting IPs: %v", err))
+	}
+	
+	// Create response
+	response := struct {
+		Network string      `json:"network"`
+		IPs     []models.IP `json:"ips"`
+		Count   int         `json:"count"`
+	}{
+		Network: network,
+		IPs:     ips,
+		Count:   len(ips),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// deleteNetwork removes every IP added from a network
+func deleteNetwork(ctx context.Context, network string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	deleted, err := db.DeleteNetwork(ctx, network)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error deleting network: %v", err))
+	}
+	
+	// Create success response
+	response := struct {
+		Message    string   `json:"message"`
+		Network    string   `json:"network"`
+		DeletedIPs []string `json:"deletedIPs"`
+		Total      int      `json:"total"`
+	}{
+		Message:    fmt.Sprintf("Deleted %d IPs from network %s", len(deleted), network),
+		Network:    network,
+		DeletedIPs: deleted,
+		Total:      len(deleted),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getIPs retrieves one page of the inventory
+func getIPs(ctx context.Context, query database.IPQuery) (Response, error) {
+	if err := query.Validate(); err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Get IPs from database
+	page, err := db.ListIPs(ctx, query)
+	if err != nil {
+		return pageErrorResponse("IPs", err)
+	}
+	
+	// Create response
+	response := struct {
+		IPs        []models.IP `json:"ips"`
+		Count      int         `json:"count"`
+		Total      int         `json:"total"`
+		NextCursor string      `json:"nextCursor,omitempty"`
+	}{
+		IPs:        page.IPs,
+		Count:      len(page.IPs),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// pageErrorResponse maps the errors of paged listings to HTTP status codes
+func pageErrorResponse(what string, err error) (Response, error) {
+	if errors.Is(err, database.ErrInvalidCursor) {
+		return errorResponse(http.StatusBadRequest, "Invalid cursor. Pass the nextCursor of the previous page, with the same query parameters")
+	}
+	return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting %s: %v", what, err))
+}
+
+// pageLimit reads the limit query parameter of a paged listing
+func pageLimit(params map[string]string) int {
+	limit := database.DefaultPageSize
+	if parsedLimit, err := strconv.Atoi(params["limit"]); err == nil && parsedLimit > 0 {
+		limit = parsedLimit
+	}
+	return limit
+}
+
+// descending reads the order query parameter, asc or desc
+func descending(params map[string]string, fallback bool) (bool, error) {
+	switch params["order"] {
+	case "":
+		return fallback, nil
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	}
+	return false, errors.New("Invalid order parameter. Must be asc or desc")
+}
+
+// parseAge parses a duration such as "90m", "12h" or "7d"
+func parseAge(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return age, nil
+}
+
+// ipQuery reads the paging, sorting, last-scanned and metadata filters of
+// GET /api/ips. The age of the last scan is given either as a time
+// (scannedBefore, scannedSince) or as a duration back from now
+// (notScannedFor, scannedWithin).
+func ipQuery(params map[string]string, now time.Time) (database.IPQuery, error) {
+	if _, ok := params["offset"]; ok {
+		return database.IPQuery{}, errors.New("The offset parameter is no longer supported. Page with the nextCursor of the previous response")
+	}
+
+	query := database.IPQuery{
+		SortBy: params["sort"],
+		Limit:  pageLimit(params),
+		Cursor: params["cursor"],
+	}
+	var err error
+	if query.Descending, err = descending(params, false); err != nil {
+		return query, err
+	}
+	if query.Selector, err = assetSelector(params); err != nil {
+		return query, err
+	}
+
+	bounds := []struct {
+		timeParam, ageParam string
+		target              *time.Time
+	}{
+		{"scannedBefore", "notScannedFor", &query.ScannedBefore},
+		{"scannedSince", "scannedWithin", &query.ScannedSince},
+	}
+	for _, bound := range bounds {
+		if value, ok := params[bound.timeParam]; ok {
+			if *bound.target, err = time.Parse(time.RFC3339, value); err != nil {
+				return query, fmt.Errorf("Invalid %s parameter. Must be an RFC 3339 timestamp", bound.timeParam)
+			}
+		}
+		if value, ok := params[bound.ageParam]; ok {
+			if !bound.target.IsZero() {
+				return query, fmt.Errorf("Give only one of %s and %s", bound.timeParam, bound.ageParam)
+			}
+			age, err := parseAge(value)
+			if err != nil {
+				return query, fmt.Errorf("Invalid %s parameter. Must be a duration such as 12h or 7d", bound.ageParam)
+			}
+			*bound.target = now.Add(-age)
+		}
+	}
+	return query, nil
+}
+
+// assetSelector reads the group, owner and tags query parameters. Tags are
+// written as key:value pairs separated by commas; a key alone matches any
+// value.
+func assetSelector(params map[string]string) (models.AssetSelector, error) {
+	selector := models.AssetSelector{
+		Group: params["group"],
+		Owner: params["owner"],
+	}
+	if value := params["tags"]; value != "" {
+		tags, err := models.ParseTags(value)
+		if err != nil {
+			return selector, fmt.Errorf("Invalid tags parameter. Must be key:value pairs separated by commas: %v", err)
+		}
+		selector.Tags = tags
+	}
+	return selector, nil
+}
+
+// historyQuery reads the paging parameters of the scan result and
+// enrichment history of an IP, which is listed newest first by default
+func historyQuery(ipAddress string, params map[string]string) (database.HistoryQuery, error) {
+	newestFirst, err := descending(params, true)
+	if err != nil {
+		return database.HistoryQuery{}, err
+	}
+	return database.HistoryQuery{
+		IPAddress:   ipAddress,
+		OldestFirst: !newestFirst,
+		Limit:       pageLimit(params),
+		Cursor:      params["cursor"],
+	}, nil
+}
+
+// Enrichment
+// startEnrichment initiates an enrichment for an IP's open ports
+func startEnrichment(ctx context.Context, ipAddress string, scanID string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Get open ports for the IP
+	openPorts, err := db.GetOpenPorts(ctx, ipAddress)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting open ports: %v", err))
+	}
+	
+	if len(openPorts) == 0 {
+		return errorResponse(http.StatusBadRequest, "No open ports found for this IP")
+	}
+	
+	// If no scanID provided, generate one
+	if scanID == "" {
+		scanID = models.NewScanID("manual-scan", ipAddress)
+	}
+	
+	// Get enricher function name
+	enricherFunction := os.Getenv("ENRICHER_FUNCTION")
+	if enricherFunction == "" {
+		enricherFunction = "nexusscan-enricher" // Default name if not set
+	}
+	
+	// Create Lambda client
+	lambdaClient := services.Functions
+	
+	// Create enricher request
+	request := struct {
+		IPAddress     string `json:"ipAddress"`
+		ScanID        string `json:"scanId"`
+		OpenPorts     []int  `json:"openPorts"`
+		ImmediateMode bool   `json:"immediateMode"`
+	}{
+		IPAddress:     ipAddress,
+		ScanID:        scanID,
+		OpenPorts:     openPorts,
+		ImmediateMode: true,
+	}
+	
+	// Convert to JSON
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error marshaling request: %v", err))
+	}
+	
+	// Invoke Lambda function
+	_, err = lambdaClient.Invoke(ctx, &lambdaService.InvokeInput{
+		FunctionName:   aws.String(enricherFunction),
+		Payload:        payload,
+		InvocationType: lambdaTypes.InvocationTypeEvent, // Asynchronous invocation
+	})
+	
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error invoking enricher: %v", err))
+	}
+	
+	// Create success response
+	response := struct {
+		Message   string `json:"message"`
+		IP        string `json:"ip"`
+		ScanID    string `json:"scanId"`
+		PortCount int    `json:"portCount"`
+	}{
+		Message:   "Enrichment started successfully",
+		IP:        ipAddress,
+		ScanID:    scanID,
+		PortCount: len(openPorts),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// Schedule Management Endpoints
+
+// addSchedule adds a scan schedule for an IP
+func addSchedule(ctx context.Context, ipAddress string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (Response, error) {
+    ipAddress, err := targets.CanonicalIP(ipAddress)
+    if err != nil {
+        return errorResponse(http.StatusBadRequest, err.Error())
+    }
+    
+    // Initialize AWS clients
+    services, err := platform.Load(ctx)
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+    }
+    
+    // Create database client
+    db := services.DB
+    
+    // Validate schedule type and timing
+    scheduleType, timing, err = models.ResolveScheduleTiming(scheduleType, timing)
+    if err != nil {
+        return errorResponse(http.StatusBadRequest, err.Error())
+    }
+    
+    // Validate port set
+    if err := db.ValidatePortSet(ctx, portSet); err != nil {
+        return portSetErrorResponse(err)
+    }
+    
+    // Validate scan profile
+    if err := db.ValidateScanProfile(ctx, profile); err != nil {
+        return scanProfileErrorResponse(err)
+    }
+    
+    // Add schedule to database
+    scheduleID, err := db.AddSchedule(ctx, ipAddress, scheduleType, timing, portSet, profile, enabled)
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error adding schedule: %v", err))
+    }
+    
+    // Create success response
+    response := struct {
+        Message      string `json:"message"`
+        ScheduleID   string `json:"scheduleId"`
+        IP           string `json:"ip"`
+        ScheduleType string `json:"scheduleType"`
+        models.ScheduleTiming
+        PortSet      string `json:"portSet"`
+        Profile      string `json:"profile,omitempty"`
+        Enabled      bool   `json:"enabled"`
+    }{
+        Message:        "Schedule added successfully",
+        ScheduleID:     scheduleID,
+        IP:             ipAddress,
+        ScheduleType:   scheduleType,
+        ScheduleTiming: timing,
+        PortSet:        portSet,
+        Profile:        profile,
+        Enabled:        enabled,
+    }
+    
+    responseJSON, _ := json.Marshal(response)
+    
+    return Response{
+        StatusCode: http.StatusOK,
+        Headers:    map[string]string{"Content-Type": "application/json"},
+        Body:       string(responseJSON),
+    }, nil
+}
+
+// updateScheduleStatus enables or disables a schedule
+func updateScheduleStatus(ctx context.Context, scheduleID string, enabled bool) (Response, error) {
+    // Initialize AWS clients
+    services, err := platform.Load(ctx)
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+    }
+    
+    // Create database client
+    db := services.DB
+    
+    // Get the schedule first to include in the response
+    schedule, err := db.GetScheduleByID(ctx, scheduleID)
+    if err != nil {
+        return errorResponse(http.StatusNotFound, fmt.Sprintf("Schedule not found: %v", err))
+    }
+    
+    // Update schedule status
+    err = db.UpdateScheduleStatus(ctx, scheduleID, enabled)
+    if errors.Is(err, database.ErrScheduleNotFound) {
+        return errorResponse(http.StatusNotFound, fmt.Sprintf("Schedule %s not found", scheduleID))
+    }
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error updating schedule status: %v", err))
+    }
+    
+    // Create success response
+    response := struct {
+        Message      string `json:"message"`
+        ScheduleID   string `json:"scheduleId"`
+        IP           string `json:"ip,omitempty"`
+        Selector     *models.AssetSelector `json:"selector,omitempty"`
+        ScheduleType string `json:"scheduleType"`
+        Enabled      bool   `json:"enabled"`
+    }{
+        Message:      fmt.Sprintf("Schedule %s", func() string {
+            if enabled {
+                return "enabled"
+            }
+            return "disabled"
+        }()),
+        ScheduleID:   scheduleID,
+        IP:           schedule.IPAddress,
+        Selector:     schedule.Selector,
+        ScheduleType: schedule.ScheduleType,
+        Enabled:      enabled,
+    }
+    
+    responseJSON, _ := json.Marshal(response)
+    
+    return Response{
+        StatusCode: http.StatusOK,
+        Headers:    map[string]string{"Content-Type": "application/json"},
+        Body:       string(responseJSON),
+    }, nil
+}
+
+// getScheduleByID retrieves a schedule by its ID
+func getScheduleByID(ctx context.Context, scheduleID string) (Response, error) {
+    // Initialize AWS clients
+    services, err := platform.Load(ctx)
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+    }
+    
+    // Create database client
+    db := services.DB
+    
+    // Get schedule by ID
+    schedule, err := db.GetScheduleByID(ctx, scheduleID)
+    if err != nil {
+        return errorResponse(http.StatusNotFound, fmt.Sprintf("Schedule not found: %v", err))
+    }
+    
+    // Convert dates to RFC3339 format for consistent JSON response
+    response := struct {
+        ScheduleID   string `json:"scheduleId"`
+        IPAddress    string `json:"ipAddress,omitempty"`
+        Selector     *models.AssetSelector `json:"selector,omitempty"`
+        ScheduleType string `json:"scheduleType"`
+        models.ScheduleTiming
+        PortSet      string `json:"portSet"`
+        Profile      string `json:"profile,omitempty"`
+        Enabled      bool   `json:"enabled"`
+        CreatedAt    string `json:"createdAt"`
+        UpdatedAt    string `json:"updatedAt"`
+        LastRun      string `json:"lastRun,omitempty"`
+        NextRun      string `json:"nextRun"`
+    }{
+        ScheduleID:   schedule.ScheduleID,
+        IPAddress:    schedule.IPAddress,
+        Selector:     schedule.Selector,
+        ScheduleType: schedule.ScheduleType,
+        ScheduleTiming: schedule.ScheduleTiming,
+        PortSet:      schedule.PortSet,
+        Profile:      schedule.Profile,
+        Enabled:      schedule.Enabled,
+        CreatedAt:    schedule.CreatedAt.Format(time.RFC3339),
+        UpdatedAt:    schedule.UpdatedAt.Format(time.RFC3339),
+        NextRun:      schedule.NextRun.Format(time.RFC3339),
+    }
+    
+    // Only include LastRun if it's not zero
+    if !schedule.LastRun.IsZero() {
+        response.LastRun = schedule.LastRun.Format(time.RFC3339)
+    }
+    
+    responseJSON, _ := json.Marshal(response)
+    
+    return Response{
+        StatusCode: http.StatusOK,
+        Headers:    map[string]string{"Content-Type": "application/json"},
+        Body:       string(responseJSON),
+    }, nil
+}
+
+// addSchedules adds scan schedules for multiple IPs
+func addSchedules(ctx context.Context, ips []string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (Response, error) {
+    // Initialize AWS clients
+    services, err := platform.Load(ctx)
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+    }
+    
+    // Create database client
+    db := services.DB
+    
+    // Validate schedule type and timing
+    scheduleType, timing, err = models.ResolveScheduleTiming(scheduleType, timing)
+    if err != nil {
+        return errorResponse(http.StatusBadRequest, err.Error())
+    }
+    
+    // Validate port set
+    if err := db.ValidatePortSet(ctx, portSet); err != nil {
+        return portSetErrorResponse(err)
+    }
+    
+    // Validate scan profile
+    if err := db.ValidateScanProfile(ctx, profile); err != nil {
+        return scanProfileErrorResponse(err)
+    }
+    
+    // Add schedule for each IP
+    var addedIPs []string
+    var failedIPs []string
+    var scheduleIDs []string
+    
+    for _, ip := range ips {
+        canonical, err := targets.CanonicalIP(ip)
+        if err != nil {
+            log.Printf("Skipping schedule: %v", err)
+            failedIPs = append(failedIPs, ip)
+            continue
+        }
+        ip = canonical
+        
+        scheduleID, err := db.AddSchedule(ctx, ip, scheduleType, timing, portSet, profile, enabled)
+        if err != nil {
+            log.Printf("Error adding schedule for IP %s: %v", ip, err)
+            failedIPs = append(failedIPs, ip)
+        } else {
+            addedIPs = append(addedIPs, ip)
+            scheduleIDs = append(scheduleIDs, scheduleID)
+        }
+    }
+    
+    // Create response
+    response := struct {
+        Message      string   `json:"message"`
+        AddedIPs     []string `json:"addedIPs"`
+        ScheduleIDs  []string `json:"scheduleIds"`
+        FailedIPs    []string `json:"failedIPs,omitempty"`
+        Total        int      `json:"total"`
+        ScheduleType string   `json:"scheduleType"`
+        models.ScheduleTiming
+        PortSet      string   `json:"portSet"`
+        Profile      string   `json:"profile,omitempty"`
+        Enabled      bool     `json:"enabled"`
+    }{
+        Message:      fmt.Sprintf("Added schedule for %d out of %d IPs", len(addedIPs), len(ips)),
+        AddedIPs:     addedIPs,
+        ScheduleIDs:  scheduleIDs,
+        FailedIPs:    failedIPs,
+        Total:        len(addedIPs),
+        ScheduleType: scheduleType,
+        ScheduleTiming: timing,
+        PortSet:      portSet,
+        Profile:      profile,
+        Enabled:      enabled,
+    }
+    
+    responseJSON, _ := json.Marshal(response)
+    
+    return Response{
+        StatusCode: http.StatusOK,
+        Headers:    map[string]string{"Content-Type": "application/json"},
+        Body:       string(responseJSON),
+    }, nil
+}
+
+// addSelectorSchedule adds one scan schedule for the IPs a selector matches.
+// The selector is kept on the schedule and expanded each time it runs, so IPs
+// tagged later are scanned too.
+func addSelectorSchedule(ctx context.Context, selector models.AssetSelector, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (Response, error) {
+	if message := invalidSelector(selector); message != "" {
+		return errorResponse(http.StatusBadRequest, message)
+	}
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Validate schedule type and timing
+	scheduleType, timing, err = models.ResolveScheduleTiming(scheduleType, timing)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	
+	// Validate port set
+	if err := db.ValidatePortSet(ctx, portSet); err != nil {
+		return portSetErrorResponse(err)
+	}
+	
+	// Validate scan profile
+	if err := db.ValidateScanProfile(ctx, profile); err != nil {
+		return scanProfileErrorResponse(err)
+	}
+	
+	scheduleID, err := db.AddSelectorSchedule(ctx, selector, scheduleType, timing, portSet, profile, enabled)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error adding schedule: %v", err))
+	}
+	
+	// Create response
+	response := struct {
+		Message      string               `json:"message"`
+		ScheduleID   string               `json:"scheduleId"`
+		Selector     models.AssetSelector `json:"selector"`
+		ScheduleType string               `json:"scheduleType"`
+		models.ScheduleTiming
+		PortSet string `json:"portSet"`
+		Profile string `json:"profile,omitempty"`
+		Enabled bool   `json:"enabled"`
+	}{
+		Message:        "Added schedule for the IPs the selector matches when it runs",
+		ScheduleID:     scheduleID,
+		Selector:       selector,
+		ScheduleType:   scheduleType,
+		ScheduleTiming: timing,
+		PortSet:        portSet,
+		Profile:        profile,
+		Enabled:        enabled,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getSelectorSchedules retrieves the schedules of selectors
+func getSelectorSchedules(ctx context.Context) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	schedules, err := services.DB.GetSelectorSchedules(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting schedules: %v", err))
+	}
+	
+	// Create response
+	response := struct {
+		Schedules []models.Schedule `json:"schedules"`
+		Count     int               `json:"count"`
+	}{
+		Schedules: schedules,
+		Count:     len(schedules),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getSchedules retrieves all schedules for an IP
+func getSchedules(ctx context.Context, ipAddress string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Get schedules from database
+	schedules, err := db.GetSchedulesForIP(ctx, ipAddress)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting schedules: %v", err))
+	}
+	
+	// Create response
+	response := struct {
+		IP        string            `json:"ip"`
+		Schedules []models.Schedule `json:"schedules"`
+		Count     int               `json:"count"`
+	}{
+		IP:        ipAddress,
+		Schedules: schedules,
+		Count:     len(schedules),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// updateScheduleStatus enables or disables a schedule
+func updateSchedule(ctx context.Context, scheduleID string, scheduleType string, timing models.ScheduleTiming, portSet string, profile string, enabled bool) (Response, error) {
+    // Initialize AWS clients
+    services, err := platform.Load(ctx)
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+    }
+    
+    // Create database client
+    db := services.DB
+    
+    // Validate schedule type and timing
+    scheduleType, timing, err = models.ResolveScheduleTiming(scheduleType, timing)
+    if err != nil {
+        return errorResponse(http.StatusBadRequest, err.Error())
+    }
+    
+    // Validate port set
+    if err := db.ValidatePortSet(ctx, portSet); err != nil {
+        return portSetErrorResponse(err)
+    }
+    
+    // Validate scan profile
+    if err := db.ValidateScanProfile(ctx, profile); err != nil {
+        return scanProfileErrorResponse(err)
+    }
+    
+    // Update schedule in database
+    err = db.UpdateSchedule(ctx, scheduleID, scheduleType, timing, portSet, profile, enabled)
+    if errors.Is(err, database.ErrScheduleNotFound) {
+        return errorResponse(http.StatusNotFound, fmt.Sprintf("Schedule %s not found", scheduleID))
+    }
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error updating schedule: %v", err))
+    }
+    
+    // Create success response
+    response := struct {
+        Message      string `json:"message"`
+        ScheduleID   string `json:"scheduleId"`
+        ScheduleType string `json:"scheduleType"`
+        models.ScheduleTiming
+        PortSet      string `json:"portSet"`
+        Profile      string `json:"profile,omitempty"`
+        Enabled      bool   `json:"enabled"`
+    }{
+        Message:      "Schedule updated successfully",
+        ScheduleID:   scheduleID,
+        ScheduleType: scheduleType,
+        ScheduleTiming: timing,
+        PortSet:      portSet,
+        Profile:      profile,
+        Enabled:      enabled,
+    }
+    
+    responseJSON, _ := json.Marshal(response)
+    
+    return Response{
+        StatusCode: http.StatusOK,
+        Headers:    map[string]string{"Content-Type": "application/json"},
+        Body:       string(responseJSON),
+    }, nil
+}
+
+// deleteSchedule removes a schedule
+func deleteSchedule(ctx context.Context, scheduleID string) (Response, error) {
+    // Initialize AWS clients
+    services, err := platform.Load(ctx)
+    if err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+    }
+    
+    // Create database client
+    db := services.DB
+    
+    // Delete schedule
+    if err := db.DeleteSchedule(ctx, scheduleID); err != nil {
+        return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error deleting schedule: %v", err))
+    }
+    
+    // Create success response
+    response := struct {
+        Message    string `json:"message"`
+        ScheduleID string `json:"scheduleId"`
+    }{
+        Message:    "Schedule deleted successfully",
+        ScheduleID: scheduleID,
+    }
+    
+    responseJSON, _ := json.Marshal(response)
+    
+    return Response{
+        StatusCode: http.StatusOK,
+        Headers:    map[string]string{"Content-Type": "application/json"},
+        Body:       string(responseJSON),
+    }, nil
+}
+
+// Enrichment
+// getEnrichmentResults retrieves one page of the enrichment runs of an IP
+func getEnrichmentResults(ctx context.Context, query database.HistoryQuery, format string) (Response, error) {
+	ipAddress := query.IPAddress
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Get enrichment results
+	page, err := db.ListEnrichmentResults(ctx, query)
+	if err != nil {
+		return pageErrorResponse("enrichment results", err)
+	}
+	results := page.Results
+	
+	// Format the results based on the requested format
+	var response interface{}
+	
+	if format == "full" {
+		// Return full details for each scan
+		response = struct {
+			IP         string                     `json:"ip"`
+			Results    []database.HttpxEnrichment `json:"results"`
+			Count      int                        `json:"count"`
+			Total      int                        `json:"total"`
+			NextCursor string                     `json:"nextCursor,omitempty"`
+		}{
+			IP:         ipAddress,
+			Results:    results,
+			Count:      len(results),
+			Total:      page.Total,
+			NextCursor: page.NextCursor,
+		}
+	} else {
+		// Return simplified results grouped by port
+		type SimplifiedResult struct {
+			Port         int      `json:"port"`
+			ServiceName  string   `json:"serviceName,omitempty"`
+			URLs         []string `json:"urls"`
+			WebServer    string   `json:"webServer,omitempty"`
+			Title        string   `json:"title,omitempty"`
+			StatusCode   int      `json:"statusCode,omitempty"`
+			Technologies []string `json:"technologies,omitempty"`
+			HasTLS       bool     `json:"hasTLS"`
+			TLSIssues    []string `json:"tlsIssues,omitempty"`
+			LastScanned  string   `json:"lastScanned"`
+		}
+
+		// Group scan results by port
+		portMap := make(map[int]*SimplifiedResult)
+		var lastScanned string
+		
+		for _, result := range results {
+			if lastScanned == "" || result.Timestamp > lastScanned {
+				lastScanned = result.Timestamp
+			}
+			
+			for _, port := range result.EnrichedPorts {
+				// Extract port number from URL
+				portStr := port.Port
+				if portStr == "" {
+					// Try to parse from URL
+					urlParts := strings.Split(port.URL, ":")
+					if len(urlParts) > 2 {
+						portStr = strings.Split(urlParts[2], "/")[0]
+					}
+				}
+				
+				portNum, err := strconv.Atoi(portStr)
+				if err != nil {
+					continue
+				}
+				
+				if _, exists := portMap[portNum]; !exists {
+					portMap[portNum] = &SimplifiedResult{
+						Port:        portNum,
+						URLs:        []string{},
+						LastScanned: result.Timestamp,
+						HasTLS:      false,
+					}
+				}
+				
+				// Add URL if not already in the list
+				urlFound := false
+				for _, u := range portMap[portNum].URLs {
+					if u == port.URL {
+						urlFound = true
+						break
+					}
+				}
+				if !urlFound {
+					portMap[portNum].URLs = append(portMap[portNum].URLs, port.URL)
+				}
+				
+				// Update other fields if they're not set
+				if portMap[portNum].WebServer == "" && port.ServerHeader != "" {
+					portMap[portNum].WebServer = port.ServerHeader
+				}
+				
+				if portMap[portNum].Title == "" && port.Title != "" {
+					portMap[portNum].Title = port.Title
+				}
+				
+				if portMap[portNum].StatusCode == 0 && port.StatusCode != 0 {
+					portMap[portNum].StatusCode = port.StatusCode
+				}
+				
+				// Add technologies if not already in the list
+				for _, tech := range port.Technologies {
+					found := false
+					for _, t := range portMap[portNum].Technologies {
+						if t == tech {
+							found = true
+							break
+						}
+					}
+					if !found {
+						portMap[portNum].Technologies = append(portMap[portNum].Technologies, tech)
+					}
+				}
+				
+				// Check TLS information
+				if port.TLS.Cipher != "" {
+					portMap[portNum].HasTLS = true
+					
+					// Add TLS issues if any
+					if port.TLS.Expired {
+						portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Expired Certificate")
+					}
+					if port.TLS.SelfSigned {
+						portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Self-Signed Certificate")
+					}
+					if port.TLS.Mismatched {
+						portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Hostname Mismatch")
+					}
+				}
+			}
+		}
+		
+		// Convert map to slice
+		simplifiedResults := make([]SimplifiedResult, 0, len(portMap))
+		for _, v := range portMap {
+			simplifiedResults = append(simplifiedResults, *v)
+		}
+		
+		// Sort by port number
+		sort.Slice(simplifiedResults, func(i, j int) bool {
+			return simplifiedResults[i].Port < simplifiedResults[j].Port
+		})
+		
+		// Total and NextCursor page through enrichment runs, not ports
+		response = struct {
+			IP      string             `json:"ip"`
+			Results []SimplifiedResult `json:"ports"`
+			Count   int                `json:"count"`
+			LastScanned string         `json:"lastScanned"`
+			Total      int             `json:"total"`
+			NextCursor string          `json:"nextCursor,omitempty"`
+		}{
+			IP:      ipAddress,
+			Results: simplifiedResults,
+			Count:   len(simplifiedResults),
+			LastScanned: lastScanned,
+			Total:      page.Total,
+			NextCursor: page.NextCursor,
+		}
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getEnrichmentResultByScan retrieves enrichment result for a specific scan
+func getEnrichmentResultByScan(ctx context.Context, ipAddress string, scanID string, format string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Get enrichment result
+	result, err := db.GetEnrichmentResultByScan(ctx, ipAddress, scanID)
+	if err != nil {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("Enrichment result not found: %v", err))
+	}
+	
+	// If format is not "full", convert to simplified format
+	if format != "full" {
+		// Return simplified results grouped by port
+		type SimplifiedResult struct {
+			Port         int      `json:"port"`
+			ServiceName  string   `json:"serviceName,omitempty"`
+			URLs         []string `json:"urls"`
+			WebServer    string   `json:"webServer,omitempty"`
+			Title        string   `json:"title,omitempty"`
+			StatusCode   int      `json:"statusCode,omitempty"`
+			Technologies []string `json:"technologies,omitempty"`
+			HasTLS       bool     `json:"hasTLS"`
+			TLSIssues    []string `json:"tlsIssues,omitempty"`
+		}
+
+		// Group scan results by port
+		portMap := make(map[int]*SimplifiedResult)
+		
+		for _, port := range result.EnrichedPorts {
+			// Extract port number from URL
+			portStr := port.Port
+			if portStr == "" {
+				// Try to parse from URL
+				urlParts := strings.Split(port.URL, ":")
+				if len(urlParts) > 2 {
+					portStr = strings.Split(urlParts[2], "/")[0]
+				}
+			}
+			
+			portNum, err := strconv.Atoi(portStr)
+			if err != nil {
+				continue
+			}
+			
+			if _, exists := portMap[portNum]; !exists {
+				portMap[portNum] = &SimplifiedResult{
+					Port:        portNum,
+					URLs:        []string{},
+					HasTLS:      false,
+				}
+			}
+			
+			// Add URL if not already in the list
+			urlFound := false
+			for _, u := range portMap[portNum].URLs {
+				if u == port.URL {
+					urlFound = true
+					break
+				}
+			}
+			if !urlFound {
+				portMap[portNum].URLs = append(portMap[portNum].URLs, port.URL)
+			}
+			
+			// Update other fields if they're not set
+			if portMap[portNum].WebServer == "" && port.ServerHeader != "" {
+				portMap[portNum].WebServer = port.ServerHeader
+			}
+			
+			if portMap[portNum].Title == "" && port.Title != "" {
+				portMap[portNum].Title = port.Title
+			}
+			
+			if portMap[portNum].StatusCode == 0 && port.StatusCode != 0 {
+				portMap[portNum].StatusCode = port.StatusCode
+			}
+			
+			// Add technologies if not already in the list
+			for _, tech := range port.Technologies {
+				found := false
+				for _, t := range portMap[portNum].Technologies {
+					if t == tech {
+						found = true
+						break
+					}
+				}
+				if !found {
+					portMap[portNum].Technologies = append(portMap[portNum].Technologies, tech)
+				}
+			}
+			
+			// Check TLS information
+			if port.TLS.Cipher != "" {
+				portMap[portNum].HasTLS = true
+				
+				// Add TLS issues if any
+				if port.TLS.Expired {
+					portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Expired Certificate")
+				}
+				if port.TLS.SelfSigned {
+					portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Self-Signed Certificate")
+				}
+				if port.TLS.Mismatched {
+					portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Hostname Mismatch")
+				}
+			}
+		}
+		
+		// Convert map to slice
+		simplifiedResults := make([]SimplifiedResult, 0, len(portMap))
+		for _, v := range portMap {
+			simplifiedResults = append(simplifiedResults, *v)
+		}
+		
+		// Sort by port number
+		sort.Slice(simplifiedResults, func(i, j int) bool {
+			return simplifiedResults[i].Port < simplifiedResults[j].Port
+		})
+		
+		response := struct {
+			IP        string             `json:"ip"`
+			ScanID    string             `json:"scanId"`
+			Timestamp string             `json:"timestamp"`
+			Ports     []SimplifiedResult `json:"ports"`
+			Count     int                `json:"count"`
+		}{
+			IP:        result.IPAddress,
+			ScanID:    result.ScanID,
+			Timestamp: result.Timestamp,
+			Ports:     simplifiedResults,
+			Count:     len(simplifiedResults),
+		}
+		
+		responseJSON, _ := json.Marshal(response)
+		
+		return Response{
+			StatusCode: http.StatusOK,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       string(responseJSON),
+		}, nil
+	}
+	
+	responseJSON, _ := json.Marshal(result)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+
+// getLatestEnrichmentResult retrieves the latest enrichment result for an IP
+func getLatestEnrichmentResult(ctx context.Context, ipAddress string, format string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Get latest enrichment result
+	result, err := db.GetLatestEnrichmentResult(ctx, ipAddress)
+	if err != nil {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("Enrichment result not found: %v", err))
+	}
+	
+	// If format is not "full", convert to simplified format
+	if format != "full" {
+		// Return simplified results grouped by port
+		type SimplifiedResult struct {
+			Port         int      `json:"port"`
+			ServiceName  string   `json:"serviceName,omitempty"`
+			URLs         []string `json:"urls"`
+			WebServer    string   `json:"webServer,omitempty"`
+			Title        string   `json:"title,omitempty"`
+			StatusCode   int      `json:"statusCode,omitempty"`
+			Technologies []string `json:"technologies,omitempty"`
+			HasTLS       bool     `json:"hasTLS"`
+			TLSIssues    []string `json:"tlsIssues,omitempty"`
+		}
+
+		// Group scan results by port
+		portMap := make(map[int]*SimplifiedResult)
+		
+		for _, port := range result.EnrichedPorts {
+			// Extract port number from URL
+			portStr := port.Port
+			if portStr == "" {
+				// Try to parse from URL
+				urlParts := strings.Split(port.URL, ":")
+				if len(urlParts) > 2 {
+					portStr = strings.Split(urlParts[2], "/")[0]
+				}
+			}
+			
+			portNum, err := strconv.Atoi(portStr)
+			if err != nil {
+				continue
+			}
+			
+			if _, exists := portMap[portNum]; !exists {
+				portMap[portNum] = &SimplifiedResult{
+					Port:        portNum,
+					URLs:        []string{},
+					HasTLS:      false,
+				}
+			}
+			
+			// Add URL if not already in the list
+			urlFound := false
+			for _, u := range portMap[portNum].URLs {
+				if u == port.URL {
+					urlFound = true
+					break
+				}
+			}
+			if !urlFound {
+				portMap[portNum].URLs = append(portMap[portNum].URLs, port.URL)
+			}
+			
+			// Update other fields if they're not set
+			if portMap[portNum].WebServer == "" && port.ServerHeader != "" {
+				portMap[portNum].WebServer = port.ServerHeader
+			}
+			
+			if portMap[portNum].Title == "" && port.Title != "" {
+				portMap[portNum].Title = port.Title
+			}
+			
+			if portMap[portNum].StatusCode == 0 && port.StatusCode != 0 {
+				portMap[portNum].StatusCode = port.StatusCode
+			}
+			
+			// Add technologies if not already in the list
+			for _, tech := range port.Technologies {
+				found := false
+				for _, t := range portMap[portNum].Technologies {
+					if t == tech {
+						found = true
+						break
+					}
+				}
+				if !found {
+					portMap[portNum].Technologies = append(portMap[portNum].Technologies, tech)
+				}
+			}
+			
+			// Check TLS information
+			if port.TLS.Cipher != "" {
+				portMap[portNum].HasTLS = true
+				
+				// Add TLS issues if any
+				if port.TLS.Expired {
+					portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Expired Certificate")
+				}
+				if port.TLS.SelfSigned {
+					portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Self-Signed Certificate")
+				}
+				if port.TLS.Mismatched {
+					portMap[portNum].TLSIssues = append(portMap[portNum].TLSIssues, "Hostname Mismatch")
+				}
+			}
+		}
+		
+		// Convert map to slice
+		simplifiedResults := make([]SimplifiedResult, 0, len(portMap))
+		for _, v := range portMap {
+			simplifiedResults = append(simplifiedResults, *v)
+		}
+		
+		// Sort by port number
+		sort.Slice(simplifiedResults, func(i, j int) bool {
+			return simplifiedResults[i].Port < simplifiedResults[j].Port
+		})
+		
+		response := struct {
+			IP        string             `json:"ip"`
+			ScanID    string             `json:"scanId"`
+			Timestamp string             `json:"timestamp"`
+			Ports     []SimplifiedResult `json:"ports"`
+			Count     int                `json:"count"`
+		}{
+			IP:        result.IPAddress,
+			ScanID:    result.ScanID,
+			Timestamp: result.Timestamp,
+			Ports:     simplifiedResults,
+			Count:     len(simplifiedResults),
+		}
+		
+		responseJSON, _ := json.Marshal(response)
+		
+		return Response{
+			StatusCode: http.StatusOK,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+			Body:       string(responseJSON),
+		}, nil
+	}
+	
+	responseJSON, _ := json.Marshal(result)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+
+// Port Set Management Endpoints
+
+// portSetErrorResponse maps port set errors to HTTP status codes
+func portSetErrorResponse(err error) (Response, error) {
+	switch {
+	case errors.Is(err, database.ErrInvalidPortSet):
+		return errorResponse(http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrPortSetNotFound):
+		return errorResponse(http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrPortSetExists), errors.Is(err, database.ErrPortSetInUse):
+		return errorResponse(http.StatusConflict, err.Error())
+	default:
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error accessing port sets: %v", err))
+	}
+}
+
+// createPortSet stores a new user-defined port set
+func createPortSet(ctx context.Context, name string, description string, ports string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	portSet, err := db.CreatePortSet(ctx, name, description, ports)
+	if err != nil {
+		return portSetErrorResponse(err)
+	}
+	
+	responseJSON, _ := json.Marshal(portSet)
+	
+	return Response{
+		StatusCode: http.StatusCreated,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// updatePortSet replaces the ports of a user-defined port set
+func updatePortSet(ctx context.Context, name string, description string, ports string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	portSet, err := db.UpdatePortSet(ctx, name, description, ports)
+	if err != nil {
+		return portSetErrorResponse(err)
+	}
+	
+	responseJSON, _ := json.Marshal(portSet)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getPortSet retrieves a user-defined port set with its expanded ports
+func getPortSet(ctx context.Context, name string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	portSet, err := db.GetPortSetByName(ctx, name)
+	if err != nil {
+		return portSetErrorResponse(err)
+	}
+	
+	expanded, _ := models.ParsePortSpec(portSet.Ports)
+	
+	// Create response
+	response := struct {
+		*models.PortSet
+		Expanded []int `json:"expandedPorts"`
+	}{
+		PortSet:  portSet,
+		Expanded: expanded,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// listPortSets retrieves the built-in and user-defined port sets
+func listPortSets(ctx context.Context) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	portSets, err := db.ListPortSets(ctx)
+	if err != nil {
+		return portSetErrorResponse(err)
+	}
+	
+	// Create response
+	response := struct {
+		Builtin  []string         `json:"builtin"`
+		PortSets []models.PortSet `json:"portSets"`
+		Count    int              `json:"count"`
+	}{
+		Builtin:  append([]string{models.PortSetPreviousOpen}, models.BuiltinPortSets...),
+		PortSets: portSets,
+		Count:    len(portSets),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// deletePortSet removes a user-defined port set
+func deletePortSet(ctx context.Context, name string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	if err := db.DeletePortSet(ctx, name); err != nil {
+		return portSetErrorResponse(err)
+	}
+	
+	// Create success response
+	response := struct {
+		Message string `json:"message"`
+		Name    string `json:"name"`
+	}{
+		Message: "Port set deleted successfully",
+		Name:    name,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// Scan Profile Management Endpoints
+
+// scanProfileErrorResponse maps scan profile errors to HTTP status codes
+func scanProfileErrorResponse(err error) (Response, error) {
+	switch {
+	case errors.Is(err, database.ErrInvalidScanProfile):
+		return errorResponse(http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrScanProfileNotFound):
+		return errorResponse(http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrScanProfileExists), errors.Is(err, database.ErrScanProfileInUse):
+		return errorResponse(http.StatusConflict, err.Error())
+	default:
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error accessing scan profiles: %v", err))
+	}
+}
+
+// saveScanProfile creates a user-defined scan profile, or replaces the
+// settings of an existing one when update is set
+func saveScanProfile(ctx context.Context, profile models.ScanProfile, update bool) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	statusCode := http.StatusCreated
+	if update {
+		statusCode = http.StatusOK
+		err = db.UpdateScanProfile(ctx, &profile)
+	} else {
+		err = db.CreateScanProfile(ctx, &profile)
+	}
+	if err != nil {
+		return scanProfileErrorResponse(err)
+	}
+	
+	responseJSON, _ := json.Marshal(profile)
+	
+	return Response{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getScanProfile retrieves a built-in or user-defined scan profile
+func getScanProfile(ctx context.Context, name string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	profile, err := db.GetScanProfile(ctx, name)
+	if err != nil {
+		return scanProfileErrorResponse(err)
+	}
+	
+	responseJSON, _ := json.Marshal(profile)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// listScanProfiles retrieves the built-in and user-defined scan profiles
+func listScanProfiles(ctx context.Context) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	profiles, err := db.ListScanProfiles(ctx)
+	if err != nil {
+		return scanProfileErrorResponse(err)
+	}
+	
+	// Create response
+	response := struct {
+		Profiles []models.ScanProfile `json:"profiles"`
+		Count    int                  `json:"count"`
+	}{
+		Profiles: profiles,
+		Count:    len(profiles),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// deleteScanProfile removes a user-defined scan profile
+func deleteScanProfile(ctx context.Context, name string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	if err := db.DeleteScanProfile(ctx, name); err != nil {
+		return scanProfileErrorResponse(err)
+	}
+	
+	// Create success response
+	response := struct {
+		Message string `json:"message"`
+		Name    string `json:"name"`
+	}{
+		Message: "Scan profile deleted successfully",
+		Name:    name,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// Scan Management Endpoints
+
+// startScan initiates a scan for an IP
+func startScan(ctx context.Context, ipAddress string, portSet string, protocol string, grabBanners bool, maxRate int, profile string, immediate bool, exclude []string) (Response, error) {
+	// Blocks, ranges and hostnames fan out to one scan per address
+	if !targets.IsSingleAddress(ipAddress) {
+		return startBulkScan(ctx, []string{ipAddress}, portSet, protocol, grabBanners, maxRate, profile, immediate, exclude)
+	}
+	
+	ipAddress, err := targets.CanonicalIP(ipAddress)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Get scheduler function name
+	schedulerFunction := os.Getenv("SCHEDULER_FUNCTION")
+	if schedulerFunction == "" {
+		return errorResponse(http.StatusInternalServerError, "SCHEDULER_FUNCTION not set")
+	}
+	
+	// Create Lambda client
+	lambdaClient := services.Functions
+	
+	// Create database client
+	db := services.DB
+	
+	// Validate protocol
+	if !models.IsValidProtocol(protocol) {
+		return errorResponse(http.StatusBadRequest, "Invalid protocol. Must be one of: tcp, udp")
+	}
+	protocol = models.NormalizeProtocol(protocol)
+	
+	// Validate scan profile
+	if err := db.ValidateScanProfile(ctx, profile); err != nil {
+		return scanProfileErrorResponse(err)
+	}
+	
+	// Determine ports to scan
+	var portsToScan []int
+	
+	if portSet == "previous_open" {
+		// Get previously open ports for this IP
+		openPorts, err := db.GetOpenPortsByProtocol(ctx, ipAddress, protocol)
+		if err != nil {
+			log.Printf("Error getting open ports for %s: %v", ipAddress, err)
+			// Default to a small set of ports if error
+			portsToScan = []int{22, 80, 443, 3389}
+		} else if len(openPorts) == 0 {
+			// If no open ports found, use default common ports
+			portsToScan = []int{22, 80, 443, 3389}
+		} else {
+			portsToScan = openPorts
+		}
+	} else {
+		// Get ports from a built-in or user-defined port set
+		portsToScan, err = db.ResolvePortSet(ctx, portSet)
+		if err != nil {
+			return portSetErrorResponse(err)
+		}
+	}
+	
+	// Assign the scan ID here so the caller can track the scan right away
+	scanID := models.NewScanID("scan", ipAddress)
+	
+	// Create scheduler event
+	event := struct {
+		Immediate bool     `json:"immediate"`
+		IP        string   `json:"ip"`
+		PortSet   string   `json:"portSet"`
+		Ports       []int    `json:"ports"`
+		Protocol    string   `json:"protocol"`
+		GrabBanners bool     `json:"grabBanners"`
+		MaxScanRate int      `json:"maxScanRate,omitempty"`
+		Profile     string   `json:"profile,omitempty"`
+		ScanID      string   `json:"scanId"`
+	}{
+		Immediate:   immediate,
+		IP:          ipAddress,
+		PortSet:     portSet,
+		Ports:       portsToScan,
+		Protocol:    protocol,
+		GrabBanners: grabBanners,
+		MaxScanRate: maxRate,
+		Profile:     profile,
+		ScanID:      scanID,
+	}
+	
+	// Convert to JSON
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error marshaling event: %v", err))
+	}
+	
+	// Invoke Lambda function
+	_, err = lambdaClient.Invoke(ctx, &lambdaService.InvokeInput{
+		FunctionName:   aws.String(schedulerFunction),
+		Payload:        payload,
+		InvocationType: lambdaTypes.InvocationTypeEvent, // Asynchronous invocation
+	})
+	
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error invoking scheduler: %v", err))
+	}
+	
+	// Create success response
+	response := struct {
+		Message   string `json:"message"`
+		ScanID    string `json:"scanId"`
+		IP        string `json:"ip"`
+		PortSet   string `json:"portSet"`
+		Protocol  string `json:"protocol"`
+		Profile   string `json:"profile,omitempty"`
+		PortCount int    `json:"portCount"`
+		Immediate bool   `json:"immediate"`
+	}{
+		Message:   "Scan scheduled successfully",
+		ScanID:    scanID,
+		IP:        ipAddress,
+		PortSet:   portSet,
+		Protocol:  protocol,
+		Profile:   profile,
+		PortCount: len(portsToScan),
+		Immediate: immediate,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// startBulkScan initiates scans for multiple IPs
+func startBulkScan(ctx context.Context, ips []string, portSet string, protocol string, grabBanners bool, maxRate int, profile string, immediate bool, exclude []string) (Response, error) {
+	// Expand target specifications into individual addresses
+	expanded, err := targets.Expand(ctx, ips, targets.Options{Exclude: exclude})
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid targets: %v", err))
+	}
+	if len(expanded) == 0 {
+		return errorResponse(http.StatusBadRequest, "No targets left to scan after exclusions")
+	}
+	ips = make([]string, 0, len(expanded))
+	for _, target := range expanded {
+		ips = append(ips, target.IPAddress)
+	}
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Get scheduler function name
+	schedulerFunction := os.Getenv("SCHEDULER_FUNCTION")
+	if schedulerFunction == "" {
+		return errorResponse(http.StatusInternalServerError, "SCHEDULER_FUNCTION not set")
+	}
+	
+	// Create Lambda client
+	lambdaClient := services.Functions
+	
+	// Create database client
+	db := services.DB
+	
+	// Validate port set
+	if err := db.ValidatePortSet(ctx, portSet); err != nil {
+		return portSetErrorResponse(err)
+	}
+	
+	// Validate protocol
+	if !models.IsValidProtocol(protocol) {
+		return errorResponse(http.StatusBadRequest, "Invalid protocol. Must be one of: tcp, udp")
+	}
+	protocol = models.NormalizeProtocol(protocol)
+	
+	// Validate scan profile
+	if err := db.ValidateScanProfile(ctx, profile); err != nil {
+		return scanProfileErrorResponse(err)
+	}
+	
+	// Previously open ports differ per IP and are checked when each scan is dispatched
+	if portSet != models.PortSetPreviousOpen {
+		if _, err := db.ResolvePortSet(ctx, portSet); err != nil {
+			return portSetErrorResponse(err)
+		}
+	}
+	
+	// Assign a scan ID per IP so the caller can track each scan
+	scanIDs := make(map[string]string, len(ips))
+	for _, ip := range ips {
+		scanIDs[ip] = models.NewScanID("scan", ip)
+	}
+	
+	// Create bulk scan event
+	event := struct {
+		Immediate bool     `json:"immediate"`
+		IPs       []string `json:"ips"`
+		PortSet     string   `json:"portSet"`
+		Protocol    string   `json:"protocol"`
+		GrabBanners bool     `json:"grabBanners"`
+		MaxScanRate int      `json:"maxScanRate,omitempty"`
+		Profile     string   `json:"profile,omitempty"`
+		ScanIDs     map[string]string `json:"scanIds"`
+	}{
+		Immediate:   immediate,
+		IPs:         ips,
+		PortSet:     portSet,
+		Protocol:    protocol,
+		GrabBanners: grabBanners,
+		MaxScanRate: maxRate,
+		Profile:     profile,
+		ScanIDs:     scanIDs,
+	}
+	
+	// Convert to JSON
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error marshaling event: %v", err))
+	}
+	
+	// Invoke Lambda function
+	_, err = lambdaClient.Invoke(ctx, &lambdaService.InvokeInput{
+		FunctionName:   aws.String(schedulerFunction),
+		Payload:        payload,
+		InvocationType: lambdaTypes.InvocationTypeEvent, // Asynchronous invocation
+	})
+	
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error invoking scheduler: %v", err))
+	}
+	
+	// Create success response
+	response := struct {
+		Message   string            `json:"message"`
+		IPs       []string          `json:"ips"`
+		ScanIDs   map[string]string `json:"scanIds"`
+		PortSet   string            `json:"portSet"`
+		Protocol  string            `json:"protocol"`
+		Profile   string            `json:"profile,omitempty"`
+		IPCount   int               `json:"ipCount"`
+		Immediate bool              `json:"immediate"`
+	}{
+		Message:   "Bulk scan scheduled successfully",
+		IPs:       ips,
+		ScanIDs:   scanIDs,
+		PortSet:   portSet,
+		Protocol:  protocol,
+		Profile:   profile,
+		IPCount:   len(ips),
+		Immediate: immediate,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getScanJob reports the progress of a scan across its batches
+func getScanJob(ctx context.Context, scanID string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	job, err := db.GetScanJob(ctx, scanID)
+	if errors.Is(err, database.ErrScanJobNotFound) {
+		return errorResponse(http.StatusNotFound, "Scan not found")
+	}
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting scan: %v", err))
+	}
+	
+	responseJSON, _ := json.Marshal(job)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getScanResults retrieves one page of the final summaries of an IP's scans
+func getScanResults(ctx context.Context, query database.HistoryQuery) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Get scan results
+	page, err := db.ListScanResults(ctx, query)
+	if err != nil {
+		return pageErrorResponse("scan results", err)
+	}
+	
+	// Create response
+	response := struct {
+		IP         string              `json:"ip"`
+		Results    []models.ScanResult `json:"results"`
+		Count      int                 `json:"count"`
+		Total      int                 `json:"total"`
+		NextCursor string              `json:"nextCursor,omitempty"`
+	}{
+		IP:         query.IPAddress,
+		Results:    page.Results,
+		Count:      len(page.Results),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getPortChanges retrieves the ports opened and closed between scans of an IP
+func getPortChanges(ctx context.Context, ipAddress string, limit int) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	changes, err := db.GetPortChanges(ctx, ipAddress, limit)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting port changes: %v", err))
+	}
+	
+	// Create response
+	response := struct {
+		IP      string              `json:"ip"`
+		Changes []models.PortChange `json:"changes"`
+		Count   int                 `json:"count"`
+	}{
+		IP:      ipAddress,
+		Changes: changes,
+		Count:   len(changes),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getRecentPortChanges retrieves the latest port changes across all IPs
+func getRecentPortChanges(ctx context.Context, limit int, since time.Time) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	changes, err := db.GetRecentPortChanges(ctx, limit, since)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting port changes: %v", err))
+	}
+	
+	// Create response
+	response := struct {
+		Changes []models.PortChange `json:"changes"`
+		Count   int                 `json:"count"`
+	}{
+		Changes: changes,
+		Count:   len(changes),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getTLSResults retrieves what TLS inspection found on the ports of an IP
+// in its latest enrichment, optionally for one port
+func getTLSResults(ctx context.Context, ipAddress string, port int) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	result, err := db.GetLatestEnrichmentResult(ctx, ipAddress)
+	if err != nil {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("Enrichment result not found: %v", err))
+	}
+	
+	ports := []database.TLSResult{}
+	for _, tlsResult := range result.TLS {
+		if port == 0 || tlsResult.Port == port {
+			ports = append(ports, tlsResult)
+		}
+	}
+	if port != 0 && len(ports) == 0 {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("No TLS found on port %d", port))
+	}
+	
+	// Create response
+	response := struct {
+		IP        string               `json:"ip"`
+		ScanID    string               `json:"scanId"`
+		Timestamp string               `json:"timestamp"`
+		Ports     []database.TLSResult `json:"ports"`
+		Count     int                  `json:"count"`
+	}{
+		IP:        ipAddress,
+		ScanID:    result.ScanID,
+		Timestamp: result.Timestamp,
+		Ports:     ports,
+		Count:     len(ports),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getServiceState retrieves the current state of an IP's ports, or of one
+// port when port is not zero
+func getServiceState(ctx context.Context, ipAddress string, port int) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	states, err := db.GetServiceState(ctx, ipAddress, port)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting service state: %v", err))
+	}
+	if port != 0 && len(states) == 0 {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("No state recorded for port %d", port))
+	}
+	
+	// Create response
+	response := struct {
+		IP    string                `json:"ip"`
+		Ports []models.ServiceState `json:"ports"`
+		Count int                   `json:"count"`
+	}{
+		IP:    ipAddress,
+		Ports: states,
+		Count: len(states),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// enrichmentChangeQuery reads the paging and filter parameters of
+// GET /api/enrichment-changes/{ip}
+func enrichmentChangeQuery(ipAddress string, params map[string]string) (database.EnrichmentChangeQuery, error) {
+	query := database.EnrichmentChangeQuery{
+		IPAddress: ipAddress,
+		Field:     params["field"],
+		Limit:     pageLimit(params),
+		Cursor:    params["cursor"],
+	}
+	if value, ok := params["port"]; ok {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return query, errors.New("Invalid port parameter. Must be between 1 and 65535")
+		}
+		query.Port = port
+	}
+	if query.Field != "" && !models.IsTrackedField(query.Field) {
+		return query, fmt.Errorf("Invalid field parameter. Must be one of %s", strings.Join(models.TrackedFields, ", "))
+	}
+	return query, nil
+}
+
+// getEnrichmentChanges retrieves one page of the changes of the tracked
+// enrichment fields of an IP's ports
+func getEnrichmentChanges(ctx context.Context, query database.EnrichmentChangeQuery) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	page, err := db.ListEnrichmentChanges(ctx, query)
+	if err != nil {
+		return pageErrorResponse("enrichment changes", err)
+	}
+	
+	// Create response
+	response := struct {
+		IP         string                    `json:"ip"`
+		Changes    []models.EnrichmentChange `json:"changes"`
+		Count      int                       `json:"count"`
+		Total      int                       `json:"total"`
+		NextCursor string                    `json:"nextCursor,omitempty"`
+	}{
+		IP:         query.IPAddress,
+		Changes:    page.Changes,
+		Count:      len(page.Changes),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// certificateQuery reads the paging and filter parameters of
+// GET /api/certificates
+func certificateQuery(params map[string]string) (database.CertificateQuery, error) {
+	query := database.CertificateQuery{
+		Issuer: params["issuer"],
+		Limit:  pageLimit(params),
+		Cursor: params["cursor"],
+	}
+	if value, ok := params["expiringWithin"]; ok {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return query, errors.New("Invalid expiringWithin parameter. Must be a number of days")
+		}
+		query.ExpiringWithin = &days
+	}
+	flags := []struct {
+		param  string
+		target *bool
+	}{
+		{"selfSigned", &query.SelfSigned},
+		{"mismatched", &query.Mismatched},
+	}
+	for _, flag := range flags {
+		if value, ok := params[flag.param]; ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return query, fmt.Errorf("Invalid %s parameter. Must be true or false", flag.param)
+			}
+			*flag.target = parsed
+		}
+	}
+	return query, nil
+}
+
+// listCertificates retrieves one page of the certificate inventory
+func listCertificates(ctx context.Context, query database.CertificateQuery) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	page, err := db.ListCertificates(ctx, query)
+	if err != nil {
+		return pageErrorResponse("certificates", err)
+	}
+	
+	// Create response
+	response := struct {
+		Certificates []models.Certificate `json:"certificates"`
+		Count        int                  `json:"count"`
+		Total        int                  `json:"total"`
+		NextCursor   string               `json:"nextCursor,omitempty"`
+	}{
+		Certificates: page.Certificates,
+		Count:        len(page.Certificates),
+		Total:        page.Total,
+		NextCursor:   page.NextCursor,
+	}
+	if response.Certificates == nil {
+		response.Certificates = []models.Certificate{}
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getCertificate retrieves one certificate of the inventory by fingerprint
+func getCertificate(ctx context.Context, fingerprint string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	cert, err := db.GetCertificate(ctx, fingerprint)
+	if errors.Is(err, database.ErrCertificateNotFound) {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("Certificate %s not found", fingerprint))
+	}
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting certificate: %v", err))
+	}
+	
+	responseJSON, _ := json.Marshal(cert)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getOpenPorts retrieves open ports for an IP
+func getOpenPorts(ctx context.Context, ipAddress string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	// Get open ports for each protocol
+	openPorts, err := db.GetOpenPorts(ctx, ipAddress)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting open ports: %v", err))
+	}
+	
+	openUDPPorts, err := db.GetOpenPortsByProtocol(ctx, ipAddress, models.ProtocolUDP)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting open UDP ports: %v", err))
+	}
+	
+	// Create response
+	response := struct {
+		IP           string `json:"ip"`
+		OpenPorts    []int  `json:"openPorts"`
+		OpenUDPPorts []int  `json:"openUdpPorts"`
+		Count        int    `json:"count"`
+		UDPCount     int    `json:"udpCount"`
+	}{
+		IP:           ipAddress,
+		OpenPorts:    openPorts,
+		OpenUDPPorts: openUDPPorts,
+		Count:        len(openPorts),
+		UDPCount:     len(openUDPPorts),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// Notification Endpoints
+
+// notificationErrorResponse maps notification errors to HTTP status codes
+func notificationErrorResponse(err error) (Response, error) {
+	switch {
+	case errors.Is(err, database.ErrInvalidNotification):
+		return errorResponse(http.StatusBadRequest, err.Error())
+	case errors.Is(err, database.ErrNotificationNotFound):
+		return errorResponse(http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrChannelInUse):
+		return errorResponse(http.StatusConflict, err.Error())
+	default:
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error accessing notifications: %v", err))
+	}
+}
+
+// createNotificationChannel stores a new notification channel
+func createNotificationChannel(ctx context.Context, channel models.NotificationChannel) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	if err := db.CreateNotificationChannel(ctx, &channel); err != nil {
+		return notificationErrorResponse(err)
+	}
+	
+	responseJSON, _ := json.Marshal(channel.Redacted())
+	
+	return Response{
+		StatusCode: http.StatusCreated,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getNotificationChannel retrieves a notification channel without its credentials
+func getNotificationChannel(ctx context.Context, channelID string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	channel, err := db.GetNotificationChannel(ctx, channelID)
+	if err != nil {
+		return notificationErrorResponse(err)
+	}
+	
+	responseJSON, _ := json.Marshal(channel.Redacted())
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// listNotificationChannels retrieves all notification channels without their credentials
+func listNotificationChannels(ctx context.Context) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	channels, err := db.ListNotificationChannels(ctx)
+	if err != nil {
+		return notificationErrorResponse(err)
+	}
+	
+	redacted := make([]models.NotificationChannel, 0, len(channels))
+	for _, channel := range channels {
+		redacted = append(redacted, channel.Redacted())
+	}
+	
+	// Create response
+	response := struct {
+		Channels []models.NotificationChannel `json:"channels"`
+		Count    int                          `json:"count"`
+	}{
+		Channels: redacted,
+		Count:    len(redacted),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// deleteNotificationChannel removes a notification channel
+func deleteNotificationChannel(ctx context.Context, channelID string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	if err := db.DeleteNotificationChannel(ctx, channelID); err != nil {
+		return notificationErrorResponse(err)
+	}
+	
+	// Create success response
+	response := struct {
+		Message   string `json:"message"`
+		ChannelID string `json:"channelId"`
+	}{
+		Message:   "Notification channel deleted successfully",
+		ChannelID: channelID,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// createNotificationRule stores a new notification rule
+func createNotificationRule(ctx context.Context, rule models.NotificationRule) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	if err := db.CreateNotificationRule(ctx, &rule); err != nil {
+		return notificationErrorResponse(err)
+	}
+	
+	responseJSON, _ := json.Marshal(rule)
+	
+	return Response{
+		StatusCode: http.StatusCreated,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// listNotificationRules retrieves all notification rules
+func listNotificationRules(ctx context.Context) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	rules, err := db.ListNotificationRules(ctx)
+	if err != nil {
+		return notificationErrorResponse(err)
+	}
+	
+	// Create response
+	response := struct {
+		Rules []models.NotificationRule `json:"rules"`
+		Count int                       `json:"count"`
+	}{
+		Rules: rules,
+		Count: len(rules),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// deleteNotificationRule removes a notification rule
+func deleteNotificationRule(ctx context.Context, ruleID string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	if err := db.DeleteNotificationRule(ctx, ruleID); err != nil {
+		return notificationErrorResponse(err)
+	}
+	
+	// Create success response
+	response := struct {
+		Message string `json:"message"`
+		RuleID  string `json:"ruleId"`
+	}{
+		Message: "Notification rule deleted successfully",
+		RuleID:  ruleID,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getNotificationFailures retrieves notifications that could not be delivered
+func getNotificationFailures(ctx context.Context, limit int) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	failures, err := db.ListNotificationFailures(ctx, limit)
+	if err != nil {
+		return notificationErrorResponse(err)
+	}
+	
+	// Create response
+	response := struct {
+		Failures []models.NotificationFailure `json:"failures"`
+		Count    int                          `json:"count"`
+	}{
+		Failures: failures,
+		Count:    len(failures),
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// exportLinkExpiry is how long the download links handed out for exports work
+const exportLinkExpiry = time.Hour
+
+// startExport records an export job and invokes the exporter to render it.
+// A scan ID exports that scan, an IP without one the IP's scan history, and
+// neither the latest results of the whole inventory or of the IPs the
+// selector matches.
+func startExport(ctx context.Context, format string, ipAddress string, scanID string, selector *models.AssetSelector) (Response, error) {
+	// Validate format
+	if !models.IsValidExportFormat(format) {
+		return errorResponse(http.StatusBadRequest, "Invalid format. Must be one of: "+strings.Join(models.ExportFormats, ", "))
+	}
+	
+	// Work out the scope
+	if selector != nil && (ipAddress != "" || scanID != "") {
+		return errorResponse(http.StatusBadRequest, "Give a scan, an IP or a selector, not more than one")
+	}
+	if selector != nil {
+		if err := selector.Validate(); err != nil {
+			return errorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid selector: %v", err))
+		}
+		if selector.IsEmpty() {
+			selector = nil
+		}
+	}
+	
+	job := &models.ExportJob{
+		ExportID: uuid.New().String(),
+		Format:   format,
+		Scope:    models.ExportScopeInventory,
+		Selector: selector,
+	}
+	if ipAddress != "" {
+		job.Scope = models.ExportScopeHistory
+		job.IPAddress = canonicalIP(ipAddress)
+	}
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	if services.Objects == nil {
+		return errorResponse(http.StatusInternalServerError, "Exports are not configured: EXPORTS_BUCKET not set")
+	}
+	
+	// Get exporter function name
+	exporterFunction := os.Getenv("EXPORTER_FUNCTION")
+	if exporterFunction == "" {
+		return errorResponse(http.StatusInternalServerError, "EXPORTER_FUNCTION not set")
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	if scanID != "" {
+		job.Scope = models.ExportScopeScan
+		job.ScanID = scanID
+		
+		// Scans are tracked by ID, so the IP can be left out
+		scanJob, err := db.GetScanJob(ctx, scanID)
+		if errors.Is(err, database.ErrScanJobNotFound) && job.IPAddress == "" {
+			return errorResponse(http.StatusNotFound, "Scan not found")
+		}
+		if err != nil && !errors.Is(err, database.ErrScanJobNotFound) {
+			return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting scan: %v", err))
+		}
+		if scanJob != nil {
+			if job.IPAddress != "" && job.IPAddress != scanJob.IPAddress {
+				return errorResponse(http.StatusBadRequest, fmt.Sprintf("Scan %s is of %s, not %s", scanID, scanJob.IPAddress, job.IPAddress))
+			}
+			job.IPAddress = scanJob.IPAddress
+		}
+	}
+	
+	if err := db.CreateExportJob(ctx, job); err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error creating export: %v", err))
+	}
+	
+	payload, _ := json.Marshal(map[string]string{"exportId": job.ExportID})
+	
+	// Invoke Lambda function
+	_, err = services.Functions.Invoke(ctx, &lambdaService.InvokeInput{
+		FunctionName:   aws.String(exporterFunction),
+		Payload:        payload,
+		InvocationType: lambdaTypes.InvocationTypeEvent, // Asynchronous invocation
+	})
+	
+	if err != nil {
+		job.Status = models.ExportStatusFailed
+		job.Error = fmt.Sprintf("Error invoking exporter: %v", err)
+		if saveErr := db.SaveExportJob(ctx, job); saveErr != nil {
+			log.Printf("Error saving export %s: %v", job.ExportID, saveErr)
+		}
+		return errorResponse(http.StatusInternalServerError, job.Error)
+	}
+	
+	// Create success response
+	response := struct {
+		Message string `json:"message"`
+		*models.ExportJob
+	}{
+		Message:   "Export started successfully",
+		ExportJob: job,
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// getExport reports the status of an export, with a link to download it
+// once it has completed
+func getExport(ctx context.Context, exportID string) (Response, error) {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error loading AWS config: %v", err))
+	}
+	
+	// Create database client
+	db := services.DB
+	
+	job, err := db.GetExportJob(ctx, exportID)
+	if errors.Is(err, database.ErrExportNotFound) {
+		return errorResponse(http.StatusNotFound, "Export not found")
+	}
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error getting export: %v", err))
+	}
+	
+	response := struct {
+		*models.ExportJob
+		DownloadURL       string     `json:"downloadUrl,omitempty"`
+		DownloadExpiresAt *time.Time `json:"downloadExpiresAt,omitempty"`
+	}{
+		ExportJob: job,
+	}
+	
+	// Sign a fresh link on every request, so links can be short-lived
+	if job.Status == models.ExportStatusCompleted && services.Objects != nil {
+		expiresAt := time.Now().UTC().Add(exportLinkExpiry).Truncate(time.Second)
+		link, err := services.Objects.URL(ctx, job.ObjectKey, exportLinkExpiry)
+		if err != nil {
+			return errorResponse(http.StatusInternalServerError, fmt.Sprintf("Error creating download link: %v", err))
+		}
+		response.DownloadURL = link
+		response.DownloadExpiresAt = &expiresAt
+	}
+	
+	responseJSON, _ := json.Marshal(response)
+	
+	return Response{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// Handler for Lambda API Gateway
+func HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Log request
+	log.Printf("API Request: %s %s", request.HTTPMethod, request.Path)
+	
+	// Parse path
+	path := request.Path
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	
+	// Basic routing
+	if len(pathParts) >= 2 && pathParts[0] == "api" {
+		switch pathParts[1] {
+case "enrichment-results":
+	// GET /api/enrichment-results/{ip}?limit=5&cursor=...&order=desc&format=full
+	if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+		ipAddress := canonicalIP(pathParts[2])
+		
+		// Parse paging query parameters
+		query, err := historyQuery(ipAddress, request.QueryStringParameters)
+		if err != nil {
+			response, _ := errorResponse(http.StatusBadRequest, err.Error())
+			return events.APIGatewayProxyResponse{
+				StatusCode: response.StatusCode,
+				Headers:    response.Headers,
+				Body:       response.Body,
+			}, nil
+		}
+		
+		// Parse format query parameter
+		format := "simple" // Default
+		if formatStr, ok := request.QueryStringParameters["format"]; ok {
+			if formatStr == "full" {
+				format = "full"
+			}
+		}
+		
+		// Get enrichment results
+		response, err := getEnrichmentResults(ctx, query, format)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: response.StatusCode,
+				Headers:    response.Headers,
+				Body:       response.Body,
+			}, nil
+		}
+		
+		return events.APIGatewayProxyResponse{
+			StatusCode: response.StatusCode,
+			Headers:    response.Headers,
+			Body:       response.Body,
+		}, nil
+	}
+	
+case "enrichment-scan":
+	// GET /api/enrichment-scan/{ip}/{scanId}?format=full
+	if request.HTTPMethod == "GET" && len(pathParts) >= 4 {
+		ipAddress := canonicalIP(pathParts[2])
+		scanID := pathParts[3]
+		
+		// Parse format query parameter
+		format := "simple" // Default
+		if formatStr, ok := request.QueryStringParameters["format"]; ok {
+			if formatStr == "full" {
+				format = "full"
+			}
+		}
+		
+		// Get enrichment result for specific scan
+		response, err := getEnrichmentResultByScan(ctx, ipAddress, scanID, format)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: response.StatusCode,
+				Headers:    response.Headers,
+				Body:       response.Body,
+			}, nil
+		}
+		
+		return events.APIGatewayProxyResponse{
+			StatusCode: response.StatusCode,
+			Headers:    response.Headers,
+			Body:       response.Body,
+		}, nil
+	}
+	
+case "latest-enrichment":
+	// GET /api/latest-enrichment/{ip}?format=full
+	if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+		ipAddress := canonicalIP(pathParts[2])
+		
+		// Parse format query parameter
+		format := "simple" // Default
+		if formatStr, ok := request.QueryStringParameters["format"]; ok {
+			if formatStr == "full" {
+				format = "full"
+			}
+		}
+		
+		// Get latest enrichment result
+		response, err := getLatestEnrichmentResult(ctx, ipAddress, format)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: response.StatusCode,
+				Headers:    response.Headers,
+				Body:       response.Body,
+			}, nil
+		}
+		
+		return events.APIGatewayProxyResponse{
+			StatusCode: response.StatusCode,
+			Headers:    response.Headers,
+			Body:       response.Body,
+		}, nil
+	}
+case "enrich":
+	// POST /api/enrich
+	if request.HTTPMethod == "POST" {
+		// Parse request body
+		var enrichRequest struct {
+			IP     string `json:"ip"`
+			ScanID string `json:"scanId,omitempty"`
+		}
+		
+		if err := json.Unmarshal([]byte(request.Body), &enrichRequest); err != nil {
+			response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+			return events.APIGatewayProxyResponse{
+				StatusCode: response.StatusCode,
+				Headers:    response.Headers,
+				Body:       response.Body,
+			}, nil
+		}
+		
+		// Validate IP address
+		if enrichRequest.IP == "" {
+			response, _ := errorResponse(http.StatusBadRequest, "IP address is required")
+			return events.APIGatewayProxyResponse{
+				StatusCode: response.StatusCode,
+				Headers:    response.Headers,
+				Body:       response.Body,
+			}, nil
+		}
+		
+		// Start enrichment
+		response, err := startEnrichment(ctx, enrichRequest.IP, enrichRequest.ScanID)
+		if err != nil {
+			return events.APIGatewayProxyResponse{
+				StatusCode: response.StatusCode,
+				Headers:    response.Headers,
+				Body:       response.Body,
+			}, nil
+		}
+		
+		return events.APIGatewayProxyResponse{
+			StatusCode: response.StatusCode,
+			Headers:    response.Headers,
+			Body:       response.Body,
+		}, nil
+	}
+		// IP Management
+		case "ip":
+			// GET /api/ip/{ip}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				response, _ := getIP(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// POST /api/ip
+			if request.HTTPMethod == "POST" {
+				// Parse request body
+				var ipRequest struct {
+					IP      string   `json:"ip"`      // Address, CIDR block, range or hostname
+					Exclude []string `json:"exclude"` // Addresses, blocks or ranges to skip
+					models.AssetMetadata
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &ipRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate IP address
+				if ipRequest.IP == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "IP address is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Add IP
+				response, err := addIP(ctx, ipRequest.IP, ipRequest.Exclude, ipRequest.AssetMetadata)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// DELETE /api/ip
+			if request.HTTPMethod == "DELETE" {
+				// Parse request body
+				var ipRequest struct {
+					IP string `json:"ip"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &ipRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate IP address
+				if ipRequest.IP == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "IP address is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Delete IP
+				response, err := deleteIP(ctx, ipRequest.IP)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+		
+		case "ips":
+			// POST /api/ips (bulk add)
+			if request.HTTPMethod == "POST" {
+				// Parse request body
+				var ipsRequest struct {
+					IPs     []string `json:"ips"`     // Addresses, CIDR blocks, ranges or hostnames
+					Exclude []string `json:"exclude"` // Addresses, blocks or ranges to skip
+					models.AssetMetadata             // Given to every IP added
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &ipsRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate IPs
+				if len(ipsRequest.IPs) == 0 {
+					response, _ := errorResponse(http.StatusBadRequest, "IPs list is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Add IPs
+				response, err := addIPs(ctx, ipsRequest.IPs, ipsRequest.Exclude, ipsRequest.AssetMetadata)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// DELETE /api/ips (bulk delete)
+			if request.HTTPMethod == "DELETE" {
+				// Parse request body
+				var ipsRequest struct {
+					IPs      []string              `json:"ips"`
+					Selector *models.AssetSelector `json:"selector"` // Instead of ips
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &ipsRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Resolve the IPs
+				ips, failure := bulkIPs(ctx, ipsRequest.IPs, ipsRequest.Selector)
+				if failure != nil {
+					response := *failure
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Delete IPs
+				response, _ := deleteIPs(ctx, ips)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// GET /api/ips?network=10.0.0.0/24
+			if request.HTTPMethod == "GET" && request.QueryStringParameters["network"] != "" {
+				response, err := getIPsByNetwork(ctx, request.QueryStringParameters["network"])
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// GET /api/ips?limit=10&cursor=...&sort=lastScanned&order=desc&notScannedFor=7d
+			if request.HTTPMethod == "GET" {
+				// Parse query parameters
+				query, err := ipQuery(request.QueryStringParameters, time.Now())
+				if err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, err.Error())
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Get IPs
+				response, err := getIPs(ctx, query)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+		
+		case "ip-metadata":
+			// PUT /api/ip-metadata
+			if request.HTTPMethod == "PUT" {
+				// Parse request body
+				var metadataRequest struct {
+					IPs      []string              `json:"ips"`
+					Selector *models.AssetSelector `json:"selector"` // Instead of ips
+					models.AssetMetadataUpdate
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &metadataRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate the update
+				if metadataRequest.AssetMetadataUpdate.IsEmpty() {
+					response, _ := errorResponse(http.StatusBadRequest, "Tags, removeTags, description, owner or group is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Resolve the IPs
+				ips, failure := bulkIPs(ctx, metadataRequest.IPs, metadataRequest.Selector)
+				if failure != nil {
+					response := *failure
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Update metadata
+				response, _ := updateIPMetadata(ctx, ips, metadataRequest.AssetMetadataUpdate)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+		
+		case "network":
+			// DELETE /api/network
+			if request.HTTPMethod == "DELETE" {
+				// Parse request body
+				var networkRequest struct {
+					Network string `json:"network"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &networkRequest); err != nil || networkRequest.Network == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Network is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Delete every IP in the network
+				response, err := deleteNetwork(ctx, networkRequest.Network)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+		
+		// Port Set Management
+		case "port-sets":
+			// GET /api/port-sets/{name}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				response, _ := getPortSet(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// GET /api/port-sets
+			if request.HTTPMethod == "GET" {
+				response, _ := listPortSets(ctx)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// DELETE /api/port-sets/{name}
+			if request.HTTPMethod == "DELETE" && len(pathParts) >= 3 {
+				response, _ := deletePortSet(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// POST /api/port-sets and PUT /api/port-sets/{name}
+			if request.HTTPMethod == "POST" || (request.HTTPMethod == "PUT" && len(pathParts) >= 3) {
+				// Parse request body
+				var portSetRequest struct {
+					Name        string `json:"name"`
+					Description string `json:"description"`
+					Ports       string `json:"ports"` // e.g. "22,80,1-1024,8000-9000"
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &portSetRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				var response Response
+				if request.HTTPMethod == "POST" {
+					response, _ = createPortSet(ctx, portSetRequest.Name, portSetRequest.Description, portSetRequest.Ports)
+				} else {
+					response, _ = updatePortSet(ctx, pathParts[2], portSetRequest.Description, portSetRequest.Ports)
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+		
+		// Scan Profile Management
+		case "scan-profiles":
+			// GET /api/scan-profiles/{name}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				response, _ := getScanProfile(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// GET /api/scan-profiles
+			if request.HTTPMethod == "GET" {
+				response, _ := listScanProfiles(ctx)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// DELETE /api/scan-profiles/{name}
+			if request.HTTPMethod == "DELETE" && len(pathParts) >= 3 {
+				response, _ := deleteScanProfile(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// POST /api/scan-profiles and PUT /api/scan-profiles/{name}
+			if request.HTTPMethod == "POST" || (request.HTTPMethod == "PUT" && len(pathParts) >= 3) {
+				// Parse request body
+				var profile models.ScanProfile
+				if err := json.Unmarshal([]byte(request.Body), &profile); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				update := request.HTTPMethod == "PUT"
+				if update {
+					profile.Name = pathParts[2]
+				}
+				
+				response, _ := saveScanProfile(ctx, profile, update)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+		
+		// Schedule Management
+		case "schedule":
+			// POST /api/schedule
+			if request.HTTPMethod == "POST" {
+				// Parse request body
+				var scheduleRequest struct {
+					IP           string `json:"ip"`
+					ScheduleType string `json:"scheduleType"` // Optional with a cronExpression
+					models.ScheduleTiming
+					PortSet      string `json:"portSet"`
+					Profile      string `json:"profile"` // Scan profile, default when empty
+					Enabled      bool   `json:"enabled"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &scheduleRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate required fields
+				if scheduleRequest.IP == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "IP address is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				if scheduleRequest.ScheduleType == "" && scheduleRequest.CronExpression == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Schedule type or cron expression is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				if scheduleRequest.PortSet == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Port set is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Add schedule
+				response, err := addSchedule(ctx, scheduleRequest.IP, scheduleRequest.ScheduleType, scheduleRequest.ScheduleTiming,
+					scheduleRequest.PortSet, scheduleRequest.Profile, scheduleRequest.Enabled)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// PUT /api/schedule (Update existing schedule)
+			if request.HTTPMethod == "PUT" {
+				// Parse request body
+				var scheduleRequest struct {
+					ScheduleID   string `json:"scheduleId"`
+					ScheduleType string `json:"scheduleType"` // Optional with a cronExpression
+					models.ScheduleTiming
+					PortSet      string `json:"portSet"`
+					Profile      string `json:"profile"` // Scan profile, default when empty
+					Enabled      bool   `json:"enabled"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &scheduleRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate required fields
+				if scheduleRequest.ScheduleID == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Schedule ID is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				if scheduleRequest.ScheduleType == "" && scheduleRequest.CronExpression == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Schedule type or cron expression is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				if scheduleRequest.PortSet == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Port set is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Update schedule
+				response, err := updateSchedule(ctx, scheduleRequest.ScheduleID, scheduleRequest.ScheduleType, 
+										  scheduleRequest.ScheduleTiming, scheduleRequest.PortSet, scheduleRequest.Profile, scheduleRequest.Enabled)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// DELETE /api/schedule
+			if request.HTTPMethod == "DELETE" {
+				// Parse request body
+				var scheduleRequest struct {
+					ScheduleID string `json:"scheduleId"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &scheduleRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate required fields
+				if scheduleRequest.ScheduleID == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Schedule ID is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Delete schedule
+				response, err := deleteSchedule(ctx, scheduleRequest.ScheduleID)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "schedules":
+			// POST /api/schedules (bulk add)
+			if request.HTTPMethod == "POST" {
+				// Parse request body
+				var schedulesRequest struct {
+					IPs          []string `json:"ips"`
+					Selector     *models.AssetSelector `json:"selector"` // Instead of ips
+					ScheduleType string   `json:"scheduleType"` // Optional with a cronExpression
+					models.ScheduleTiming
+					PortSet      string   `json:"portSet"`
+					Profile      string   `json:"profile"` // Scan profile, default when empty
+					Enabled      bool     `json:"enabled"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &schedulesRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate required fields
+				
+				if schedulesRequest.ScheduleType == "" && schedulesRequest.CronExpression == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Schedule type or cron expression is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				if schedulesRequest.PortSet == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Port set is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// A selector is kept on one schedule and expanded each time it runs
+				if schedulesRequest.Selector != nil && len(schedulesRequest.IPs) == 0 {
+					response, _ := addSelectorSchedule(ctx, *schedulesRequest.Selector, schedulesRequest.ScheduleType,
+						schedulesRequest.ScheduleTiming, schedulesRequest.PortSet, schedulesRequest.Profile, schedulesRequest.Enabled)
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Resolve the IPs
+				ips, failure := bulkIPs(ctx, schedulesRequest.IPs, schedulesRequest.Selector)
+				if failure != nil {
+					response := *failure
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Add schedules
+				response, err := addSchedules(ctx, ips, schedulesRequest.ScheduleType, schedulesRequest.ScheduleTiming,
+					schedulesRequest.PortSet, schedulesRequest.Profile, schedulesRequest.Enabled)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// GET /api/schedules (selector schedules)
+			if request.HTTPMethod == "GET" && len(pathParts) == 2 {
+				response, _ := getSelectorSchedules(ctx)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// GET /api/schedules/{ip}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				ipAddress := canonicalIP(pathParts[2])
+				
+				// Get schedules for IP
+				response, err := getSchedules(ctx, ipAddress)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "schedule-status":
+			// PUT /api/schedule-status
+			if request.HTTPMethod == "PUT" {
+				// Parse request body
+				var statusRequest struct {
+					ScheduleID string `json:"scheduleId"`
+					Enabled    bool   `json:"enabled"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &statusRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate required fields
+				if statusRequest.ScheduleID == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Schedule ID is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Update schedule status
+				response, err := updateScheduleStatus(ctx, statusRequest.ScheduleID, statusRequest.Enabled)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		// Scan Management
+		case "scan":
+			// GET /api/scan/{scanId}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				response, _ := getScanJob(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// POST /api/scan
+			if request.HTTPMethod == "POST" {
+				// Parse request body
+				var scanRequest struct {
+					IP        string `json:"ip"`
+					PortSet   string `json:"portSet"`
+					Protocol    string   `json:"protocol"`
+					GrabBanners bool     `json:"grabBanners"`
+					MaxScanRate int      `json:"maxScanRate"` // Probes per second cap of the scan
+					Profile     string   `json:"profile"` // Scan profile, default when empty
+					Immediate   bool     `json:"immediate"`
+					Exclude     []string `json:"exclude"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &scanRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate required fields
+				if scanRequest.IP == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "IP address is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				if scanRequest.PortSet == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Port set is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Start scan
+				response, err := startScan(ctx, scanRequest.IP, scanRequest.PortSet, scanRequest.Protocol, scanRequest.GrabBanners, scanRequest.MaxScanRate, scanRequest.Profile, scanRequest.Immediate, scanRequest.Exclude)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "scans":
+			// POST /api/scans (bulk scan)
+			if request.HTTPMethod == "POST" {
+				// Parse request body
+				var scansRequest struct {
+					IPs       []string `json:"ips"`
+					Selector    *models.AssetSelector `json:"selector"` // Instead of ips
+					PortSet   string   `json:"portSet"`
+					Protocol    string   `json:"protocol"`
+					GrabBanners bool     `json:"grabBanners"`
+					MaxScanRate int      `json:"maxScanRate"` // Probes per second cap of the scan
+					Profile     string   `json:"profile"` // Scan profile, default when empty
+					Immediate   bool     `json:"immediate"`
+					Exclude     []string `json:"exclude"`
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &scansRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Resolve the IPs
+				ips, failure := bulkIPs(ctx, scansRequest.IPs, scansRequest.Selector)
+				if failure != nil {
+					response := *failure
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate required fields
+				
+				if scansRequest.PortSet == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Port set is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Start bulk scan
+				response, err := startBulkScan(ctx, ips, scansRequest.PortSet, scansRequest.Protocol, scansRequest.GrabBanners, scansRequest.MaxScanRate, scansRequest.Profile, scansRequest.Immediate, scansRequest.Exclude)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "export":
+			// GET /api/export/{exportId}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				response, _ := getExport(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// POST /api/export
+			if request.HTTPMethod == "POST" {
+				// Parse request body
+				var exportRequest struct {
+					Format   string                `json:"format"`
+					IP       string                `json:"ip"`       // History of this IP
+					ScanID   string                `json:"scanId"`   // Just this scan
+					Selector *models.AssetSelector `json:"selector"` // Latest results of matching IPs
+				}
+				
+				if err := json.Unmarshal([]byte(request.Body), &exportRequest); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Validate required fields
+				if exportRequest.Format == "" {
+					response, _ := errorResponse(http.StatusBadRequest, "Format is required")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Start export
+				response, _ := startExport(ctx, exportRequest.Format, exportRequest.IP, exportRequest.ScanID, exportRequest.Selector)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "scan-results":
+			// GET /api/scan-results/{ip}?limit=5&cursor=...&order=desc
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				ipAddress := canonicalIP(pathParts[2])
+				
+				// Parse paging query parameters
+				query, err := historyQuery(ipAddress, request.QueryStringParameters)
+				if err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, err.Error())
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				// Get scan results
+				response, err := getScanResults(ctx, query)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "open-ports":
+			// GET /api/open-ports/{ip}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				ipAddress := canonicalIP(pathParts[2])
+				
+				// Get open ports
+				response, err := getOpenPorts(ctx, ipAddress)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "tls":
+			// GET /api/tls/{ip}?port=443
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				ipAddress := canonicalIP(pathParts[2])
+				
+				// Parse port query parameter
+				port := 0 // All ports
+				if portStr, ok := request.QueryStringParameters["port"]; ok {
+					parsedPort, err := strconv.Atoi(portStr)
+					if err != nil || parsedPort < 1 || parsedPort > 65535 {
+						response, _ := errorResponse(http.StatusBadRequest, "Invalid port parameter. Must be between 1 and 65535")
+						return events.APIGatewayProxyResponse{
+							StatusCode: response.StatusCode,
+							Headers:    response.Headers,
+							Body:       response.Body,
+						}, nil
+					}
+					port = parsedPort
+				}
+				
+				response, _ := getTLSResults(ctx, ipAddress, port)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "service-state":
+			// GET /api/service-state/{ip}?port=443
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				ipAddress := canonicalIP(pathParts[2])
+				
+				port := 0 // All ports
+				if portStr, ok := request.QueryStringParameters["port"]; ok {
+					parsedPort, err := strconv.Atoi(portStr)
+					if err != nil || parsedPort < 1 || parsedPort > 65535 {
+						response, _ := errorResponse(http.StatusBadRequest, "Invalid port parameter. Must be between 1 and 65535")
+						return events.APIGatewayProxyResponse{
+							StatusCode: response.StatusCode,
+							Headers:    response.Headers,
+							Body:       response.Body,
+						}, nil
+					}
+					port = parsedPort
+				}
+				
+				response, _ := getServiceState(ctx, ipAddress, port)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "enrichment-changes":
+			// GET /api/enrichment-changes/{ip}?port=443&field=certificateFingerprint
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				var response Response
+				query, err := enrichmentChangeQuery(canonicalIP(pathParts[2]), request.QueryStringParameters)
+				if err != nil {
+					response, _ = errorResponse(http.StatusBadRequest, err.Error())
+				} else {
+					response, _ = getEnrichmentChanges(ctx, query)
+				}
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "certificates":
+			if request.HTTPMethod == "GET" {
+				var response Response
+				if len(pathParts) >= 3 {
+					// GET /api/certificates/{fingerprint}
+					response, _ = getCertificate(ctx, pathParts[2])
+				} else {
+					// GET /api/certificates?expiringWithin=30&selfSigned=true&mismatched=true&issuer=...
+					query, err := certificateQuery(request.QueryStringParameters)
+					if err != nil {
+						response, _ = errorResponse(http.StatusBadRequest, err.Error())
+					} else {
+						response, _ = listCertificates(ctx, query)
+					}
+				}
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "changes":
+			if request.HTTPMethod == "GET" {
+				// Parse limit query parameter
+				limit := 0 // Database default
+				if limitStr, ok := request.QueryStringParameters["limit"]; ok {
+					if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+						limit = parsedLimit
+					}
+				}
+				
+				var response Response
+				if len(pathParts) >= 3 {
+					// GET /api/changes/{ip}?limit=10
+					response, _ = getPortChanges(ctx, canonicalIP(pathParts[2]), limit)
+				} else {
+					// GET /api/changes?limit=50&since=2024-01-01T00:00:00Z
+					var since time.Time
+					if sinceStr, ok := request.QueryStringParameters["since"]; ok {
+						parsed, err := time.Parse(time.RFC3339, sinceStr)
+						if err != nil {
+							response, _ = errorResponse(http.StatusBadRequest, "Invalid since parameter. Must be an RFC 3339 timestamp")
+							return events.APIGatewayProxyResponse{
+								StatusCode: response.StatusCode,
+								Headers:    response.Headers,
+								Body:       response.Body,
+							}, nil
+						}
+						since = parsed
+					}
+					response, _ = getRecentPortChanges(ctx, limit, since)
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		// Notifications
+		case "notification-channels":
+			// GET /api/notification-channels/{channelId}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				response, _ := getNotificationChannel(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// GET /api/notification-channels
+			if request.HTTPMethod == "GET" {
+				response, _ := listNotificationChannels(ctx)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// DELETE /api/notification-channels/{channelId}
+			if request.HTTPMethod == "DELETE" && len(pathParts) >= 3 {
+				response, _ := deleteNotificationChannel(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// POST /api/notification-channels
+			if request.HTTPMethod == "POST" {
+				var channel models.NotificationChannel
+				if err := json.Unmarshal([]byte(request.Body), &channel); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				response, _ := createNotificationChannel(ctx, channel)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "notification-rules":
+			// GET /api/notification-rules
+			if request.HTTPMethod == "GET" {
+				response, _ := listNotificationRules(ctx)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// DELETE /api/notification-rules/{ruleId}
+			if request.HTTPMethod == "DELETE" && len(pathParts) >= 3 {
+				response, _ := deleteNotificationRule(ctx, pathParts[2])
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+			// POST /api/notification-rules
+			if request.HTTPMethod == "POST" {
+				// Rules are enabled unless the request says otherwise
+				rule := models.NotificationRule{Enabled: true}
+				if err := json.Unmarshal([]byte(request.Body), &rule); err != nil {
+					response, _ := errorResponse(http.StatusBadRequest, "Invalid request body")
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				response, _ := createNotificationRule(ctx, rule)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		case "notification-failures":
+			// GET /api/notification-failures?limit=50
+			if request.HTTPMethod == "GET" {
+				limit := 50
+				if limitStr, ok := request.QueryStringParameters["limit"]; ok {
+					if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+						limit = parsedLimit
+					}
+				}
+				
+				response, _ := getNotificationFailures(ctx, limit)
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+			
+		// Add a new endpoint to get a schedule by ID
+		case "schedule-detail":
+			// GET /api/schedule-detail/{scheduleId}
+			if request.HTTPMethod == "GET" && len(pathParts) >= 3 {
+				scheduleID := pathParts[2]
+				
+				// Get schedule by ID
+				response, err := getScheduleByID(ctx, scheduleID)
+				if err != nil {
+					return events.APIGatewayProxyResponse{
+						StatusCode: response.StatusCode,
+						Headers:    response.Headers,
+						Body:       response.Body,
+					}, nil
+				}
+				
+				return events.APIGatewayProxyResponse{
+					StatusCode: response.StatusCode,
+					Headers:    response.Headers,
+					Body:       response.Body,
+				}, nil
+			}
+		}
+	}
+	
+	// If we get here, route not found
+	response, _ := errorResponse(http.StatusNotFound, "Not found")
+	return events.APIGatewayProxyResponse{
+		StatusCode: response.StatusCode,
+		Headers:    response.Headers,
+		Body:       response.Body,
+	}, nil
+}
@@ -0,0 +1,264 @@
+// pkg/handlers/enricher/enricher.go
+
+// Package enricher probes the open ports of a scan for web services, runs
+// the protocol modules for the other services it finds, inspects TLS on
+// every port and stores the results
+package enricher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/enrichment"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/notify"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/webprobe"
+)
+
+// EnricherRequest defines the input for an enrichment
+type EnricherRequest struct {
+	IPAddress  string   `json:"ipAddress"`
+	ScanID     string   `json:"scanId"`
+	OpenPorts  []int    `json:"openPorts"`
+	ImmediateMode bool   `json:"immediateMode"`
+	ScheduleID string   `json:"scheduleId,omitempty"`
+	Services   map[int]string `json:"services,omitempty"` // Services the scan detected, by port
+	CertificateExpiry bool `json:"certificateExpiry,omitempty"` // Scheduled request to check the certificate inventory for expiry
+}
+
+// probeLimits reads how many probes run at once and how long each may take
+// from PROBE_CONCURRENCY and PROBE_TIMEOUT_SECONDS. Zero leaves the
+// defaults of the web prober and the modules.
+func probeLimits() (int, time.Duration) {
+	var concurrency int
+	var timeout time.Duration
+	if n, err := strconv.Atoi(os.Getenv("PROBE_CONCURRENCY")); err == nil && n > 0 {
+		concurrency = n
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("PROBE_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	return concurrency, timeout
+}
+
+// Store enrichment results in the database, then fold them into the
+// current state of the IP's ports
+func storeEnrichmentResults(ctx context.Context, services *platform.Services, ipAddress, scanId, scheduleId, assetGroup string, results []database.HttpxResult, serviceResults []database.ServiceResult, tlsResults []database.TLSResult) error {
+    enrichment := &database.HttpxEnrichment{
+        IPAddress:     ipAddress,
+        ScanID:        scanId,
+        EnrichedPorts: results,
+        Services:      serviceResults,
+        TLS:           tlsResults,
+        Timestamp:     time.Now().Format(time.RFC3339),
+        ScheduleID:    scheduleId,
+        AssetGroup:    assetGroup,
+    }
+    err := services.DB.StoreEnrichmentResult(ctx, enrichment)
+    if err != nil {
+        return fmt.Errorf("error storing enrichment result: %v", err)
+    }
+
+    log.Printf("Successfully stored enrichment results for IP %s with %d web, %d service and %d TLS results", ipAddress, len(results), len(serviceResults), len(tlsResults))
+
+    // The history expires, so the state and its changes are kept apart
+    changes, err := services.DB.RecordServiceState(ctx, enrichment)
+    if err != nil {
+        log.Printf("Error recording service state for IP %s: %v", ipAddress, err)
+    } else if len(changes) > 0 {
+        log.Printf("Recorded %d enrichment changes for IP %s", len(changes), ipAddress)
+    }
+    return nil
+}
+
+// HandleRequest enriches the open ports of one scan, or checks the
+// certificate inventory for expiry when scheduled to
+func HandleRequest(ctx context.Context, request EnricherRequest) error {
+	if request.CertificateExpiry {
+		return HandleCertificateExpiry(ctx)
+	}
+
+	log.Printf("Received enrichment request for IP %s with %d open ports", request.IPAddress, len(request.OpenPorts))
+
+	if len(request.OpenPorts) == 0 {
+		log.Printf("No open ports to enrich for IP %s, skipping", request.IPAddress)
+		return nil
+	}
+
+	services, err := platform.Load(ctx)
+	if err != nil {
+		log.Printf("Error loading AWS config: %v", err)
+		return err
+	}
+
+	// Probe under the hostname the IP was added with, so name-based virtual
+	// hosts answer and certificates can be checked against it
+	var hostname, assetGroup string
+	if ip, err := services.DB.GetIP(ctx, request.IPAddress); err == nil {
+		hostname = ip.Hostname
+		assetGroup = ip.Group
+	}
+	concurrency, timeout := probeLimits()
+	target := enrichment.Target{IPAddress: request.IPAddress, Hostname: hostname}
+	moduleOpts := enrichment.Options{Concurrency: concurrency, Timeout: timeout}
+
+	// Ports the scan could not identify are fingerprinted here, so each
+	// gets the module for its service and only web ports get web probes
+	detected := enrichment.Detect(ctx, target, request.OpenPorts, request.Services, moduleOpts)
+	var webPorts []int
+	for _, port := range request.OpenPorts {
+		if enrichment.IsWeb(detected[port], port) {
+			webPorts = append(webPorts, port)
+		}
+	}
+
+	results := webprobe.Probe(ctx, webprobe.Target{IPAddress: request.IPAddress, Hostname: hostname}, webPorts,
+		webprobe.Options{Concurrency: concurrency, Timeout: timeout})
+	log.Printf("Found %d web services on %d candidate ports of IP %s", len(results), len(webPorts), request.IPAddress)
+
+	serviceResults := enrichment.Run(ctx, target, request.OpenPorts, detected, moduleOpts)
+	log.Printf("Ran %d protocol modules on IP %s", len(serviceResults), request.IPAddress)
+
+	// TLS can wrap any service, so every open port is inspected
+	tlsResults := enrichment.InspectTLS(ctx, target, request.OpenPorts, moduleOpts)
+	log.Printf("Found TLS on %d ports of IP %s", len(tlsResults), request.IPAddress)
+
+	// Store results in DynamoDB
+	err = storeEnrichmentResults(ctx, services, request.IPAddress, request.ScanID, request.ScheduleID, assetGroup, results, serviceResults, tlsResults)
+	if err != nil {
+		log.Printf("Error storing enrichment results: %v", err)
+		return err
+	}
+
+	// Add the certificates found to the inventory, whose daily check
+	// warns about those close to expiry
+	sightings := certificateSightings(request.IPAddress, hostname, results, tlsResults)
+	if err := services.DB.RecordCertificates(ctx, request.IPAddress, request.OpenPorts, sightings, time.Now()); err != nil {
+		log.Printf("Error recording certificates for IP %s: %v", request.IPAddress, err)
+	}
+
+	log.Printf("Enrichment completed for IP %s", request.IPAddress)
+	return nil
+}
+
+// certExpiryWarnDays returns how many days before expiry a certificate is
+// reported, from CERT_EXPIRY_WARN_DAYS (default 30)
+func certExpiryWarnDays() int {
+	if days, err := strconv.Atoi(os.Getenv("CERT_EXPIRY_WARN_DAYS")); err == nil && days > 0 {
+		return days
+	}
+	return 30
+}
+
+// certificateSightings collects the leaf certificates a web probe or TLS
+// inspection found, once per port. TLS inspection tells whether the leaf
+// presented for the hostname covers it, web probes whether the one they
+// were served does.
+func certificateSightings(ipAddress, hostname string, results []database.HttpxResult, tlsResults []database.TLSResult) []database.CertificateSighting {
+	var sightings []database.CertificateSighting
+	seen := make(map[string]bool)
+	add := func(port int, mismatched bool, leaf database.TLSCertificate) {
+		key := fmt.Sprintf("%s|%d", leaf.FingerprintSHA256, port)
+		if leaf.FingerprintSHA256 == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		sightings = append(sightings, database.CertificateSighting{
+			IPAddress:   ipAddress,
+			Port:        port,
+			Hostname:    hostname,
+			Mismatched:  mismatched,
+			Certificate: leaf,
+		})
+	}
+
+	for _, result := range tlsResults {
+		if len(result.Certificates) == 0 {
+			continue
+		}
+		mismatched := false
+		for _, name := range result.ServerNames {
+			if hostname != "" && name.ServerName == hostname && name.FingerprintSHA256 == result.Certificates[0].FingerprintSHA256 {
+				mismatched = name.Mismatched
+			}
+		}
+		add(result.Port, mismatched, result.Certificates[0])
+	}
+	for _, result := range results {
+		if len(result.TLS.Chain) == 0 {
+			continue
+		}
+		port, _ := strconv.Atoi(result.Port)
+		add(port, result.TLS.Mismatched, result.TLS.Chain[0])
+	}
+	return sightings
+}
+
+// HandleCertificateExpiry publishes a certificate_expiring notification for
+// each certificate in the inventory that has expired or expires within the
+// warning window, for every IP still serving it. It runs daily, so each
+// certificate is reported once a day until it is replaced.
+func HandleCertificateExpiry(ctx context.Context) error {
+	services, err := platform.Load(ctx)
+	if err != nil {
+		log.Printf("Error loading AWS config: %v", err)
+		return err
+	}
+
+	warnDays := certExpiryWarnDays()
+	query := database.CertificateQuery{ExpiringWithin: &warnDays, Limit: database.MaxPageSize}
+	published := 0
+	for {
+		page, err := services.DB.ListCertificates(ctx, query)
+		if err != nil {
+			return fmt.Errorf("error listing expiring certificates: %v", err)
+		}
+
+		for _, cert := range page.Certificates {
+			// One event per IP, so notification rules can select by target
+			ports := make(map[string][]int)
+			var ips []string
+			for _, location := range cert.CurrentLocations() {
+				if _, ok := ports[location.IPAddress]; !ok {
+					ips = append(ips, location.IPAddress)
+				}
+				ports[location.IPAddress] = append(ports[location.IPAddress], location.Port)
+			}
+
+			for _, ip := range ips {
+				expiry := models.CertificateExpiry{
+					Port:        ports[ip][0],
+					SubjectCN:   cert.SubjectCN,
+					IssuerCN:    cert.IssuerCN,
+					NotAfter:    cert.NotAfter,
+					DaysLeft:    cert.DaysLeft,
+					Fingerprint: cert.Fingerprint,
+				}
+				if len(ports[ip]) > 1 {
+					expiry.Ports = ports[ip]
+				}
+
+				event := models.NewCertificateExpiringEvent(ip, "", expiry)
+				if err := notify.Publish(ctx, services.Queues, event); err != nil {
+					log.Printf("Error publishing certificate expiry notification for %s: %v", ip, err)
+					continue
+				}
+				published++
+			}
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	log.Printf("Published %d certificate expiry notifications", published)
+	return nil
+}
@@ -0,0 +1,282 @@
+// pkg/handlers/exporter/exporter.go
+
+// Package exporter renders export jobs to files in object storage
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/export"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+)
+
+// ExportRequest is the event the API invokes the exporter with
+type ExportRequest struct {
+	ExportID string `json:"exportId"`
+}
+
+// HandleExport renders an export job to a temporary file and uploads it.
+// An export that cannot be rendered is marked failed rather than returned
+// as an error, since retrying the invocation would fail the same way.
+func HandleExport(ctx context.Context, request ExportRequest) error {
+	services, err := platform.Load(ctx)
+	if err != nil {
+		log.Printf("Error loading AWS config: %v", err)
+		return err
+	}
+
+	db := services.DB
+
+	job, err := db.GetExportJob(ctx, request.ExportID)
+	if err != nil {
+		log.Printf("Error loading export %s: %v", request.ExportID, err)
+		return err
+	}
+	if job.Finished() {
+		log.Printf("Export %s already %s", job.ExportID, job.Status)
+		return nil
+	}
+
+	job.Status = models.ExportStatusRunning
+	if err := db.SaveExportJob(ctx, job); err != nil {
+		return err
+	}
+
+	if err := render(ctx, services, job); err != nil {
+		log.Printf("Error exporting %s: %v", job.ExportID, err)
+		job.Status = models.ExportStatusFailed
+		job.Error = err.Error()
+	} else {
+		log.Printf("Exported %d hosts with %d open ports to %s (%d bytes)", job.Hosts, job.OpenPorts, job.ObjectKey, job.Size)
+		job.Status = models.ExportStatusCompleted
+	}
+	return db.SaveExportJob(ctx, job)
+}
+
+// render writes every host of the job to a temporary file, which keeps
+// memory flat however large the export, then uploads the file
+func render(ctx context.Context, services *platform.Services, job *models.ExportJob) error {
+	if services.Objects == nil {
+		return fmt.Errorf("no object storage is configured for exports")
+	}
+
+	file, err := os.CreateTemp("", "export-*"+export.Extension(job.Format))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	buffered := bufio.NewWriter(file)
+	writer, err := export.NewWriter(job.Format, buffered)
+	if err != nil {
+		return err
+	}
+
+	job.Hosts, job.OpenPorts = 0, 0
+	err = eachHost(ctx, services.DB, job, func(host export.Host) error {
+		job.Hosts++
+		job.OpenPorts += len(host.Scan.OpenPorts)
+		return writer.WriteHost(host)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := job.ExportID + export.Extension(job.Format)
+	if err := services.Objects.Put(ctx, key, file, size, export.ContentType(job.Format)); err != nil {
+		return err
+	}
+	job.ObjectKey = key
+	job.Size = size
+	return nil
+}
+
+// eachHost calls fn with every host in the scope of the job
+func eachHost(ctx context.Context, db *database.Client, job *models.ExportJob, fn func(export.Host) error) error {
+	switch job.Scope {
+	case models.ExportScopeScan:
+		return scanHosts(ctx, db, job.IPAddress, job.ScanID, fn)
+	case models.ExportScopeHistory:
+		return historyHosts(ctx, db, job.IPAddress, fn)
+	case models.ExportScopeInventory:
+		var selector models.AssetSelector
+		if job.Selector != nil {
+			selector = *job.Selector
+		}
+		return inventoryHosts(ctx, db, selector, fn)
+	default:
+		return fmt.Errorf("unknown export scope %q", job.Scope)
+	}
+}
+
+// scanHosts exports the final summary of one scan
+func scanHosts(ctx context.Context, db *database.Client, ipAddress string, scanID string, fn func(export.Host) error) error {
+	ip := lookupIP(ctx, db, ipAddress)
+	found := false
+	err := eachSummary(ctx, db, ipAddress, func(summary models.ScanResult) error {
+		if summary.ScanID != scanID {
+			return nil
+		}
+		found = true
+		return fn(export.Host{IP: ip, Scan: summary, Enrichment: scanEnrichment(ctx, db, ipAddress, scanID)})
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("scan %s of %s has no results yet", scanID, ipAddress)
+	}
+	return nil
+}
+
+// historyHosts exports every final summary of an IP, newest first
+func historyHosts(ctx context.Context, db *database.Client, ipAddress string, fn func(export.Host) error) error {
+	ip := lookupIP(ctx, db, ipAddress)
+	return eachSummary(ctx, db, ipAddress, func(summary models.ScanResult) error {
+		return fn(export.Host{IP: ip, Scan: summary, Enrichment: scanEnrichment(ctx, db, ipAddress, summary.ScanID)})
+	})
+}
+
+// inventoryHosts exports the ports currently open on every IP the selector
+// matches, per protocol, as tracked for the ports endpoint. Service details
+// come from the latest completed scan that saw each port.
+func inventoryHosts(ctx context.Context, db *database.Client, selector models.AssetSelector, fn func(export.Host) error) error {
+	query := database.IPQuery{Selector: selector, Limit: database.MaxPageSize}
+	for {
+		page, err := db.ListIPs(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		for _, ip := range page.IPs {
+			for _, protocol := range []string{models.ProtocolTCP, models.ProtocolUDP} {
+				host, err := inventoryHost(ctx, db, ip, protocol)
+				if err != nil {
+					return err
+				}
+				if host == nil {
+					continue
+				}
+				if err := fn(*host); err != nil {
+					return err
+				}
+			}
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// inventoryHost builds the host of one IP and protocol from its open ports,
+// or returns nil when it was never scanned and has none
+func inventoryHost(ctx context.Context, db *database.Client, ip models.IP, protocol string) (*export.Host, error) {
+	open, err := db.GetOpenPortsByProtocol(ctx, ip.IPAddress, protocol)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := db.GetLastCompletedSummary(ctx, ip.IPAddress, protocol, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(open) == 0 && summary == nil {
+		return nil, nil
+	}
+
+	scan := models.ScanResult{IPAddress: ip.IPAddress, Protocol: protocol}
+	seen := make(map[int]models.Port)
+	if summary != nil {
+		scan = *summary
+		for _, port := range append(summary.WatchedPorts, summary.OpenPorts...) {
+			seen[port.Number] = port
+		}
+	}
+
+	scan.OpenPorts = make([]models.Port, 0, len(open))
+	for _, number := range open {
+		port, ok := seen[number]
+		if !ok {
+			port = models.Port{Number: number, Protocol: protocol}
+		}
+		port.State = models.PortStateOpen
+		scan.OpenPorts = append(scan.OpenPorts, port)
+	}
+	if scan.PortsScanned < len(scan.OpenPorts) {
+		scan.PortsScanned = len(scan.OpenPorts)
+	}
+
+	host := &export.Host{IP: ip, Scan: scan}
+	if protocol == models.ProtocolTCP {
+		if summary != nil {
+			host.Enrichment = scanEnrichment(ctx, db, ip.IPAddress, summary.ScanID)
+		}
+		if host.Enrichment == nil {
+			host.Enrichment, _ = db.GetLatestEnrichmentResult(ctx, ip.IPAddress)
+		}
+	}
+	return host, nil
+}
+
+// eachSummary pages through the final scan summaries of an IP
+func eachSummary(ctx context.Context, db *database.Client, ipAddress string, fn func(models.ScanResult) error) error {
+	query := database.HistoryQuery{IPAddress: ipAddress, Limit: database.MaxPageSize}
+	for {
+		page, err := db.ListScanResults(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, summary := range page.Results {
+			if err := fn(summary); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// lookupIP returns an IP of the inventory with its metadata. An IP that
+// cannot be looked up is exported with its address alone.
+func lookupIP(ctx context.Context, db *database.Client, ipAddress string) models.IP {
+	ip, err := db.GetIP(ctx, ipAddress)
+	if err != nil {
+		return models.IP{IPAddress: ipAddress}
+	}
+	return *ip
+}
+
+// scanEnrichment returns the enrichment of a scan, or nil when the scan had
+// no web services to enrich
+func scanEnrichment(ctx context.Context, db *database.Client, ipAddress string, scanID string) *database.HttpxEnrichment {
+	enrichment, err := db.GetEnrichmentResultByScan(ctx, ipAddress, scanID)
+	if err != nil {
+		return nil
+	}
+	return enrichment
+}
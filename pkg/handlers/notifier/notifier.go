@@ -0,0 +1,158 @@
+// pkg/handlers/notifier/notifier.go
+
+// Package notifier delivers notification events to the channels of the rules
+// they match
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/notify"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+)
+
+// HandleSQSEvent delivers queued notification events to the channels of
+// every matching rule. Deliveries that fail after all retries, or to a
+// channel that could not be loaded, are recorded as notification failures
+// rather than returned, so one broken channel does
+// not cause the event to be redelivered to the others. Events that could not
+// be dispatched at all are reported as batch item failures, so SQS delivers
+// only them again and not the events already sent.
+func HandleSQSEvent(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var response events.SQSEventResponse
+
+	services, err := platform.Load(ctx)
+	if err != nil {
+		log.Printf("Error loading AWS config: %v", err)
+		return response, err
+	}
+
+	db := services.DB
+
+	rules, err := db.ListNotificationRules(ctx)
+	if err != nil {
+		log.Printf("Error loading notification rules: %v", err)
+		return response, err
+	}
+
+	for _, message := range event.Records {
+		var notification models.NotificationEvent
+		if err := json.Unmarshal([]byte(message.Body), &notification); err != nil {
+			log.Printf("Error parsing notification event: %v", err)
+			continue
+		}
+
+		if err := dispatch(ctx, db, rules, &notification); err != nil {
+			log.Printf("Error dispatching %s event %s, leaving it for redelivery: %v", notification.Type, notification.EventID, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+
+	return response, nil
+}
+
+// dispatch sends one event to each channel of the rules it matches, once
+// per channel even when several rules select the same channel
+func dispatch(ctx context.Context, db *database.Client, rules []models.NotificationRule, event *models.NotificationEvent) error {
+	sent := make(map[string]bool)
+
+	asset, err := eventAsset(ctx, db, rules, event)
+	if err != nil {
+		return err
+	}
+
+	for i := range rules {
+		if !notify.Matches(&rules[i], event, asset) {
+			continue
+		}
+
+		for _, channelID := range rules[i].ChannelIDs {
+			if sent[channelID] {
+				continue
+			}
+			sent[channelID] = true
+
+			channel, err := db.GetNotificationChannel(ctx, channelID)
+			if errors.Is(err, database.ErrNotificationNotFound) {
+				log.Printf("Notification channel %s of rule %s no longer exists", channelID, rules[i].Name)
+				continue
+			}
+			if err != nil {
+				// The event is not delivered again, so keep it with the failure
+				log.Printf("Error loading notification channel %s: %v", channelID, err)
+				recordFailure(ctx, db, &models.NotificationFailure{
+					ChannelID: channelID,
+					Event:     *event,
+					Error:     fmt.Sprintf("loading channel: %v", err),
+					FailedAt:  time.Now().UTC(),
+				})
+				continue
+			}
+
+			attempts, err := notify.DeliverWithRetry(ctx, channel, event)
+			if err == nil {
+				log.Printf("Delivered %s event %s to %s channel %s", event.Type, event.EventID, channel.Type, channel.Name)
+				continue
+			}
+
+			log.Printf("Failed to deliver %s event %s to channel %s after %d attempts: %v",
+				event.Type, event.EventID, channel.Name, attempts, err)
+
+			recordFailure(ctx, db, &models.NotificationFailure{
+				ChannelID:   channel.ChannelID,
+				ChannelType: channel.Type,
+				Event:       *event,
+				Attempts:    attempts,
+				Error:       err.Error(),
+				FailedAt:    time.Now().UTC(),
+			})
+		}
+	}
+
+	if len(sent) == 0 {
+		log.Printf("No notification rules match %s event for %s", event.Type, event.IPAddress)
+	}
+	return nil
+}
+
+// recordFailure stores an event a channel did not get. An error is only
+// logged: returning it would have SQS deliver the event again to the
+// channels that already got it.
+func recordFailure(ctx context.Context, db *database.Client, failure *models.NotificationFailure) {
+	if err := db.StoreNotificationFailure(ctx, failure); err != nil {
+		log.Printf("Error recording failure of %s event %s on channel %s: %v",
+			failure.Event.Type, failure.Event.EventID, failure.ChannelID, err)
+	}
+}
+
+// eventAsset loads the inventory entry of an event's IP when a rule selects
+// IPs by their metadata. It is nil when no rule does or the IP has been
+// deleted since the event was published.
+func eventAsset(ctx context.Context, db *database.Client, rules []models.NotificationRule, event *models.NotificationEvent) (*models.IP, error) {
+	for i := range rules {
+		if !rules[i].Enabled || !rules[i].HasSelector() {
+			continue
+		}
+
+		asset, err := db.GetIP(ctx, event.IPAddress)
+		if errors.Is(err, database.ErrIPNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			log.Printf("Error loading IP %s for notification rules: %v", event.IPAddress, err)
+			return nil, err
+		}
+		return asset, nil
+	}
+	return nil, nil
+}
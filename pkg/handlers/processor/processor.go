@@ -0,0 +1,374 @@
+// pkg/handlers/processor/processor.go
+
+// Package processor records batch results as they arrive and finalises scans
+// once every batch has reported
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	lambdaService "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/notify"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+)
+
+// EnricherRequest defines the input for the enricher function
+type EnricherRequest struct {
+	IPAddress     string   `json:"ipAddress"`
+	ScanID        string   `json:"scanId"`
+	OpenPorts     []int    `json:"openPorts"`
+	ImmediateMode bool     `json:"immediateMode"`
+	ScheduleID    string   `json:"scheduleId,omitempty"`
+	Services      map[int]string `json:"services,omitempty"`
+}
+
+// ProcessorEvent is either a batch of scan results from SQS or a scheduled
+// request to finalise scans whose batches stopped reporting
+type ProcessorEvent struct {
+	events.SQSEvent
+	FinalizeStale bool `json:"finalizeStale,omitempty"`
+}
+
+// HandleEvent dispatches a processor invocation
+func HandleEvent(ctx context.Context, event ProcessorEvent) (events.SQSEventResponse, error) {
+	if event.FinalizeStale {
+		return events.SQSEventResponse{}, HandleStaleScans(ctx)
+	}
+	return HandleSQSEvent(ctx, event.SQSEvent)
+}
+
+// HandleSQSEvent records each batch result in its scan job. Results that
+// could not be recorded are reported as batch item failures so SQS delivers
+// them again; the others are not retried.
+func HandleSQSEvent(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var response events.SQSEventResponse
+	
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		log.Printf("Error loading AWS config: %v", err)
+		return response, err
+	}
+	
+	db := services.DB
+	
+	for _, message := range event.Records {
+		// Parse message
+		var result scanner.ScanResult
+		if err := json.Unmarshal([]byte(message.Body), &result); err != nil {
+			log.Printf("Error parsing result: %v", err)
+			continue
+		}
+		
+		if err := processResult(ctx, services, db, result); err != nil {
+			log.Printf("Error recording batch %d of scan %s, leaving it for redelivery: %v", result.BatchID, result.ScanID, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+	
+	return response, nil
+}
+
+// processResult adds one batch to its scan job and stores it in the
+// results. The tracker, summary and enrichment wait until every batch of the
+// scan has reported. A batch that was recorded before is skipped, finalising
+// its scan if the delivery that recorded it did not; a batch arriving after
+// its scan finished is dropped.
+func processResult(ctx context.Context, services *platform.Services, db *database.Client, result scanner.ScanResult) error {
+	protocol := models.NormalizeProtocol(result.Protocol)
+	
+	openPorts := make([]models.Port, 0, len(result.OpenPorts))
+	for _, port := range result.OpenPorts {
+		port.Protocol = protocol
+		openPorts = append(openPorts, port)
+	}
+	
+	job, err := db.RecordScanBatch(ctx, result.ScanID, result.BatchID, models.ScanBatchResult{
+		PortsScanned: result.PortsScanned,
+		OpenPorts:    openPorts,
+		WatchedPorts: result.WatchedPorts,
+		StateCounts:  result.StateCounts,
+		DurationMs:   result.ScanDuration.Milliseconds(),
+	})
+	if errors.Is(err, database.ErrBatchAlreadyRecorded) {
+		log.Printf("Batch %d of scan %s was already recorded", result.BatchID, result.ScanID)
+		job, err := db.ResumeScanJob(ctx, result.ScanID)
+		if err != nil {
+			return err
+		}
+		if job.CompletedAt != nil && job.FinalizedAt == nil {
+			return finalizeScan(ctx, services, db, job)
+		}
+		return nil
+	}
+	if errors.Is(err, database.ErrScanJobClosed) {
+		log.Printf("Batch %d of scan %s arrived after the scan finished, dropping it", result.BatchID, result.ScanID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	
+	// Store the batch result in DynamoDB
+	if err := db.StoreScanResult(ctx, result.IPAddress, result.ScanID, result.Protocol, result.Profile, result.OpenPorts, 
+		result.ScanDuration, result.PortsScanned, result.StateCounts, result.WatchedPorts); err != nil {
+		log.Printf("Error storing results: %v", err)
+	}
+	
+	// Report previously open ports that no longer answer, and why
+	for _, watched := range result.WatchedPorts {
+		switch watched.State {
+		case models.PortStateClosed:
+			log.Printf("Port %d/%s on %s is now closed (service down)", 
+				watched.Number, watched.Protocol, result.IPAddress)
+		case models.PortStateFiltered, models.PortStateOpenFiltered:
+			log.Printf("Port %d/%s on %s is now filtered (possible firewall change)", 
+				watched.Number, watched.Protocol, result.IPAddress)
+		case models.PortStateUnreachable:
+			log.Printf("Port %d/%s on %s is unreachable (host or network down)", 
+				watched.Number, watched.Protocol, result.IPAddress)
+		}
+	}
+	
+	log.Printf("Processed %s batch %d/%d for IP %s (%d open ports)", 
+		protocol, result.BatchID+1, result.TotalBatches, result.IPAddress, len(result.OpenPorts))
+	
+	if job.Finished() {
+		return finalizeScan(ctx, services, db, job)
+	}
+	return nil
+}
+
+// HandleStaleScans finishes scans with batches that never reported, keeping
+// the findings of the batches that did, and finalises finished scans whose
+// finalisation stopped or failed
+func HandleStaleScans(ctx context.Context) error {
+	services, err := platform.Load(ctx)
+	if err != nil {
+		log.Printf("Error loading AWS config: %v", err)
+		return err
+	}
+	
+	db := services.DB
+	
+	jobs, err := db.GetStaleScanJobs(ctx, time.Now().Add(-models.ScanJobStaleAfter))
+	if err != nil {
+		log.Printf("Error getting stale scan jobs: %v", err)
+		return err
+	}
+	
+	for i := range jobs {
+		job := &jobs[i]
+		
+		// Refresh marks an unfinished job partial or failed and lists the
+		// lost batches
+		wasFinished := job.Finished()
+		job.Refresh(time.Now())
+		if !job.Finished() {
+			continue
+		}
+		
+		if !wasFinished {
+			log.Printf("Scan %s timed out with batches %v missing", job.ScanID, job.MissingBatches)
+			if err := db.FinishScanJob(ctx, job.ScanID, job.Status); err != nil {
+				log.Printf("Error finishing scan job %s: %v", job.ScanID, err)
+				continue
+			}
+		}
+		
+		if err := finalizeScan(ctx, services, db, job); err != nil {
+			log.Printf("Error finalizing scan %s: %v", job.ScanID, err)
+		}
+	}
+	
+	return nil
+}
+
+// finalizeScan stores the final summary, updates the open ports tracker and
+// triggers enrichment from the findings of every reported batch. The summary
+// is stored first: when it cannot be, the claim is given back and an error
+// returned, so a redelivery or the stale-job sweep finalises the scan again.
+// Later steps only log their failures.
+func finalizeScan(ctx context.Context, services *platform.Services, db *database.Client, job *models.ScanJob) error {
+	batches, err := db.GetScanBatches(ctx, job.ScanID)
+	if err != nil {
+		return fmt.Errorf("getting batches of scan %s: %w", job.ScanID, err)
+	}
+	
+	claimed, err := db.ClaimScanJobFinalization(ctx, job.ScanID)
+	if err != nil {
+		return fmt.Errorf("claiming finalization of scan %s: %w", job.ScanID, err)
+	}
+	if !claimed {
+		return nil
+	}
+	
+	protocol := models.NormalizeProtocol(job.Protocol)
+	merged := models.AggregateBatches(batches)
+	
+	log.Printf("Storing final scan summary for IP %s with %d open %s ports (%s, %d/%d batches)", 
+		job.IPAddress, len(merged.OpenPorts), protocol, job.Status, job.BatchesDone, job.TotalBatches)
+	
+	if err := db.StoreFinalScanSummary(ctx, job.IPAddress, job.ScanID, protocol, job.Profile, job.Status, merged.OpenPorts, job.Ports, 
+		time.Duration(merged.DurationMs)*time.Millisecond, merged.PortsScanned, merged.StateCounts, false); err != nil {
+		if releaseErr := db.ReleaseScanJobFinalization(ctx, job.ScanID); releaseErr != nil {
+			log.Printf("Error releasing finalization of scan %s: %v", job.ScanID, releaseErr)
+		}
+		return fmt.Errorf("storing final summary of scan %s: %w", job.ScanID, err)
+	}
+	
+	openPortNumbers := make([]int, 0, len(merged.OpenPorts))
+	for _, port := range merged.OpenPorts {
+		openPortNumbers = append(openPortNumbers, port.Number)
+	}
+	
+	// A completed scan is the full picture for the ports it covered. When
+	// batches are missing, merge instead so ports in them are not forgotten.
+	replaceExisting := job.Status == models.ScanStatusCompleted
+	if err := db.StoreOpenPortsByProtocol(ctx, job.IPAddress, protocol, openPortNumbers, replaceExisting); err != nil {
+		log.Printf("Error updating open ports: %v", err)
+	}
+	
+	// Compare against the previous completed scan, leaving out this scan's
+	// own summary. A partial scan cannot tell a closed port from a lost batch.
+	if job.Status == models.ScanStatusCompleted {
+		change, err := detectPortChanges(ctx, db, job, merged)
+		if err != nil {
+			log.Printf("Error detecting port changes for scan %s: %v", job.ScanID, err)
+		} else if change != nil {
+			publishNotification(ctx, services, models.NewPortsChangedEvent(change))
+		}
+	}
+	
+	publishNotification(ctx, services, models.NewScanFinishedEvent(job, merged.OpenPorts))
+	
+	// Trigger the enricher function only when there are open TCP ports,
+	// since its web probes and protocol modules all speak TCP
+	if len(openPortNumbers) > 0 && protocol == models.ProtocolTCP {
+		if err := triggerEnricher(ctx, services, job.IPAddress, job.ScanID, openPortNumbers, detectedServices(merged.OpenPorts), job.ScheduleID); err != nil {
+			log.Printf("Error triggering enricher: %v", err)
+		}
+	}
+	return nil
+}
+
+// detectPortChanges diffs a completed scan against the previous completed
+// scan of the IP and stores a change event when ports opened or closed. The
+// first scan of an IP only sets the baseline, so no change is returned.
+func detectPortChanges(ctx context.Context, db *database.Client, job *models.ScanJob, merged models.ScanBatchResult) (*models.PortChange, error) {
+	previous, err := db.GetLastCompletedSummary(ctx, job.IPAddress, job.Protocol, job.ScanID)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return nil, nil
+	}
+	
+	// Summaries stored before scans recorded their ports leave this nil
+	var previousProbed []int
+	if previous.PortsProbed != "" {
+		previousProbed, err = models.ParsePortSpec(previous.PortsProbed)
+		if err != nil {
+			return nil, fmt.Errorf("reading ports of scan %s: %w", previous.ScanID, err)
+		}
+	}
+	
+	opened, closed := models.DiffPorts(previous.OpenPorts, previousProbed, merged.OpenPorts, merged.WatchedPorts)
+	if len(opened) == 0 && len(closed) == 0 {
+		return nil, nil
+	}
+	
+	change := &models.PortChange{
+		IPAddress:      job.IPAddress,
+		ScanID:         job.ScanID,
+		PreviousScanID: previous.ScanID,
+		Protocol:       models.NormalizeProtocol(job.Protocol),
+		Opened:         opened,
+		Closed:         closed,
+		DetectedAt:     time.Now().UTC(),
+	}
+	
+	log.Printf("Port changes on %s/%s since scan %s: %d opened, %d closed", 
+		change.IPAddress, change.Protocol, change.PreviousScanID, len(opened), len(closed))
+	
+	if err := db.StorePortChange(ctx, change); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// publishNotification queues an event for the notifier. Failures are only
+// logged so notifications never hold up scan processing.
+func publishNotification(ctx context.Context, services *platform.Services, event *models.NotificationEvent) {
+	if err := notify.Publish(ctx, services.Queues, event); err != nil {
+		log.Printf("Error publishing %s notification for %s: %v", event.Type, event.IPAddress, err)
+	}
+}
+
+// detectedServices maps the open ports whose service banner grabbing
+// identified to that service, so the enricher need not fingerprint them again
+func detectedServices(ports []models.Port) map[int]string {
+	detected := make(map[int]string)
+	for _, port := range ports {
+		if port.Service != "" {
+			detected[port.Number] = port.Service
+		}
+	}
+	return detected
+}
+
+// Trigger the enricher Lambda function. Scans started by a schedule pass
+// its ID; the others are immediate.
+func triggerEnricher(ctx context.Context, services *platform.Services, ipAddress, scanID string, openPorts []int, 
+	detected map[int]string, scheduleID string) error {
+	
+	// Get enricher function name from environment variable
+	enricherFunction := os.Getenv("ENRICHER_FUNCTION")
+	if enricherFunction == "" {
+		enricherFunction = "nexusscan-enricher" // Default name if not set
+	}
+	
+	// Prepare the enricher request
+	request := EnricherRequest{
+		IPAddress:     ipAddress,
+		ScanID:        scanID,
+		OpenPorts:     openPorts,
+		ImmediateMode: scheduleID == "",
+		ScheduleID:    scheduleID,
+		Services:      detected,
+	}
+	
+	// Convert to JSON
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	
+	// Invoke Lambda function asynchronously
+	_, err = services.Functions.Invoke(ctx, &lambdaService.InvokeInput{
+		FunctionName:   aws.String(enricherFunction),
+		Payload:        payload,
+		InvocationType: lambdaTypes.InvocationTypeEvent, // Asynchronous invocation
+	})
+	
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Triggered enricher for IP %s with %d open ports", ipAddress, len(openPorts))
+	return nil
+}
@@ -0,0 +1,683 @@
+// pkg/handlers/scheduler/scheduler.go
+
+// Package scheduler splits scans into batches and queues them for the
+// workers, for immediate scans and for due schedules
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	lambdaService "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/targets"
+)
+
+// SchedulerEvent triggers the scheduling process
+type SchedulerEvent struct {
+	// For immediate scans of a single IP
+	Immediate bool   `json:"immediate"`
+	IP        string `json:"ip"`
+	PortSet   string `json:"portSet"`
+	Ports     []int  `json:"ports"`
+	Protocol  string `json:"protocol,omitempty"` // tcp (default) or udp
+	GrabBanners bool `json:"grabBanners,omitempty"` // Fingerprint services on open ports
+	MaxScanRate int  `json:"maxScanRate,omitempty"` // Probes per second cap of the scan, overrides the profile's
+	Profile   string `json:"profile,omitempty"`   // Scan profile, default when empty
+	ScanID    string `json:"scanId,omitempty"`    // Assigned by the API so it can be returned to the caller
+	
+	// For bulk immediate scans
+	IPs     []string          `json:"ips"`
+	ScanIDs map[string]string `json:"scanIds,omitempty"` // Scan ID assigned to each IP by the API
+	
+	// IP and IPs also accept CIDR blocks, dash ranges and hostnames, which
+	// are expanded here; Exclude lists addresses, blocks or ranges to skip
+	Exclude []string `json:"exclude,omitempty"`
+	
+	// For scheduled scans. Dispatch runs every due schedule; ScheduleType
+	// limits the pass to one type (hourly, 12hour, daily, weekly, monthly, cron)
+	Dispatch          bool   `json:"dispatch,omitempty"`
+	ScheduleType      string `json:"scheduleType"`
+	MaxIPs            int    `json:"maxIPs"`                      // Schedules read per page
+	ContinuationToken string `json:"continuationToken,omitempty"` // Resumes a pass that ran out of time
+	
+	// For the IPs of a selector schedule's run that a previous invocation
+	// ran out of time to start
+	ScheduleRun *models.ScheduleScan `json:"scheduleRun,omitempty"`
+	ScheduleIPs []string             `json:"scheduleIps,omitempty"`
+	
+	// One-off maintenance. BackfillInventory adds the inventory index keys
+	// to IPs stored before those indexes existed, so they are listed again.
+	BackfillInventory bool `json:"backfillInventory,omitempty"`
+}
+
+// Dispatch settings
+const (
+	defaultDispatchPageSize    = 100
+	defaultDispatchConcurrency = 10
+	
+	// dispatchTimeMargin is the time left before the Lambda deadline at
+	// which a pass stops and hands its continuation token to a new invocation
+	dispatchTimeMargin = 60 * time.Second
+	
+	// maxContinuationIPs bounds the IPs handed to one invocation, keeping
+	// its payload within the asynchronous invocation limit
+	maxContinuationIPs = 2000
+)
+
+// ScanOptions holds per-scan settings passed through to every batch
+type ScanOptions struct {
+	ScanID       string // Generated when empty
+	Protocol     string
+	GrabBanners  bool
+	MaxScanRate  int                 // Overrides the profile's rate cap when set
+	Profile      *models.ScanProfile // Default profile when nil
+	ScheduleID   string              // Schedule that started the scan, for scheduled scans
+	ScheduleType string
+}
+
+// scanProfile returns the profile of a scan, falling back to the default
+func (opts ScanOptions) scanProfile() *models.ScanProfile {
+	if opts.Profile != nil {
+		return opts.Profile
+	}
+	return models.GetBuiltinScanProfile(models.DefaultScanProfile)
+}
+
+// watchPortsForBatch returns the ports in batch that were open in an earlier scan
+func watchPortsForBatch(batch []int, previouslyOpen map[int]bool) []int {
+	var watch []int
+	for _, port := range batch {
+		if previouslyOpen[port] {
+			watch = append(watch, port)
+		}
+	}
+	return watch
+}
+
+// previouslyOpenPorts loads the open ports tracker for an IP as a lookup set
+func previouslyOpenPorts(ctx context.Context, db *database.Client, ipAddress string, protocol string) map[int]bool {
+	openPorts, err := db.GetOpenPortsByProtocol(ctx, ipAddress, protocol)
+	if err != nil {
+		log.Printf("Error getting open ports for IP %s: %v", ipAddress, err)
+	}
+	
+	previouslyOpen := make(map[int]bool, len(openPorts))
+	for _, port := range openPorts {
+		previouslyOpen[port] = true
+	}
+	return previouslyOpen
+}
+
+// recordScanFailure keeps the error of a scan that could not be dispatched on
+// its job, so the scan ID the API handed out for it does not go missing
+func recordScanFailure(ctx context.Context, db *database.Client, ipAddress string, portSet string, opts ScanOptions, scanErr error) {
+	// The ID belongs to a scan that is already under way
+	if opts.ScanID == "" || errors.Is(scanErr, database.ErrScanJobExists) {
+		return
+	}
+	
+	job := &models.ScanJob{
+		ScanID:       opts.ScanID,
+		IPAddress:    ipAddress,
+		Protocol:     models.NormalizeProtocol(opts.Protocol),
+		PortSet:      portSet,
+		Profile:      opts.scanProfile().Name,
+		ScheduleID:   opts.ScheduleID,
+		ScheduleType: opts.ScheduleType,
+	}
+	if err := db.FailScanJob(ctx, job, scanErr.Error()); err != nil {
+		log.Printf("Error recording failed scan %s: %v", opts.ScanID, err)
+	}
+}
+
+// SplitIntoBatches divides ports into batches for Lambda functions
+func SplitIntoBatches(ports []int, batchSize int) [][]int {
+	if batchSize <= 0 {
+		batchSize = 4000 // Default
+	}
+	
+	var batches [][]int
+	for i := 0; i < len(ports); i += batchSize {
+		end := i + batchSize
+		if end > len(ports) {
+			end = len(ports)
+		}
+		batches = append(batches, ports[i:end])
+	}
+	
+	return batches
+}
+
+// ScheduleScan prepares and dispatches scan tasks
+func ScheduleScan(ctx context.Context, ipAddress string, portSet string, opts ScanOptions, sqsClient platform.Queues, db *database.Client) error {
+	protocol := models.NormalizeProtocol(opts.Protocol)
+	
+	// Previously open ports are watched so their new state is always reported
+	previouslyOpen := previouslyOpenPorts(ctx, db, ipAddress, protocol)
+	
+	// Determine ports to scan based on port set
+	var portsToScan []int
+	
+	if portSet == models.PortSetPreviousOpen {
+		// Reuse previously open ports from the tracker
+		openPorts := make([]int, 0, len(previouslyOpen))
+		for port := range previouslyOpen {
+			openPorts = append(openPorts, port)
+		}
+		sort.Ints(openPorts)
+		
+		// If no open ports found, use a small set of common ports
+		if len(openPorts) == 0 {
+			openPorts = []int{22, 80, 443, 3389} // Minimal set of common ports
+			if protocol == models.ProtocolUDP {
+				openPorts = []int{53, 123, 161, 500}
+			}
+		}
+		
+		portsToScan = openPorts
+	} else {
+		// Get ports from a built-in or user-defined port set
+		ports, err := db.ResolvePortSet(ctx, portSet)
+		if err != nil {
+			return fmt.Errorf("resolving port set %s: %w", portSet, err)
+		}
+		portsToScan = ports
+	}
+	
+	return dispatchScan(ctx, ipAddress, portSet, portsToScan, opts, previouslyOpen, sqsClient, db)
+}
+
+// dispatchScan records a scan job for the ports and queues its batches,
+// split and tuned according to the scan profile. The batches of a rate capped
+// scan run one after another at the scan's whole cap, so only the first is
+// queued here and each worker queues the next. The job's queued batch count
+// is corrected afterwards so a batch that never reached the queue does not
+// leave the scan waiting forever.
+func dispatchScan(ctx context.Context, ipAddress string, portSet string, ports []int,
+	opts ScanOptions, previouslyOpen map[int]bool, sqsClient platform.Queues, db *database.Client) error {
+	protocol := models.NormalizeProtocol(opts.Protocol)
+	profile := opts.scanProfile()
+	
+	maxRate := opts.MaxScanRate
+	if maxRate == 0 {
+		maxRate = profile.MaxScanRate
+	}
+	batchSize := models.RateCappedBatchSize(profile.BatchSizeFor(portSet), profile.RetryCount, maxRate)
+	
+	// Use the scan ID handed out by the API, or create one
+	scanID := opts.ScanID
+	if scanID == "" {
+		scanID = models.NewScanID("scan", ipAddress)
+	}
+	
+	template := scanner.ScanRequest{
+		IPAddress:    ipAddress,
+		ScanID:       scanID,
+		TimeoutMs:    profile.TimeoutFor(protocol),
+		Concurrency:  profile.Concurrency,
+		RetryCount:   profile.RetryCount,
+		Protocol:     protocol,
+		GrabBanners:  opts.GrabBanners,
+		MaxRate:      float64(maxRate),
+		ProbeOrder:   profile.ProbeOrder,
+		Profile:      profile.Name,
+		ScheduleType: opts.ScheduleType,
+	}
+	
+	var requests []scanner.ScanRequest
+	totalBatches := 0
+	if maxRate > 0 {
+		template.Chain = scanner.NewBatchChain(ports, batchSize, profile.ProbeOrder, watchPortsForBatch(ports, previouslyOpen))
+		first, err := template.ChainedBatch(0)
+		if err != nil {
+			return err
+		}
+		requests = []scanner.ScanRequest{first}
+		totalBatches = first.TotalBatches
+	} else {
+		// Shuffle before batching so random order also spreads ports across batches
+		if profile.ProbeOrder == models.ProbeOrderRandom {
+			shuffled := make([]int, len(ports))
+			copy(shuffled, ports)
+			rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			ports = shuffled
+		}
+		batches := SplitIntoBatches(ports, batchSize)
+		for i, batch := range batches {
+			request := template
+			request.PortsToScan = batch
+			request.BatchID = i
+			request.TotalBatches = len(batches)
+			request.WatchPorts = watchPortsForBatch(batch, previouslyOpen)
+			requests = append(requests, request)
+		}
+		totalBatches = len(batches)
+	}
+	
+	// Get queue URL
+	tasksQueueURL := os.Getenv("TASKS_QUEUE_URL")
+	if tasksQueueURL == "" {
+		log.Printf("TASKS_QUEUE_URL environment variable not set")
+		return fmt.Errorf("TASKS_QUEUE_URL not set")
+	}
+	
+	// Track the scan before any batch can report back
+	job := &models.ScanJob{
+		ScanID:       scanID,
+		IPAddress:    ipAddress,
+		Protocol:     protocol,
+		PortSet:      portSet,
+		Profile:      profile.Name,
+		ScheduleID:   opts.ScheduleID,
+		ScheduleType: opts.ScheduleType,
+		TotalBatches: totalBatches,
+		PortsTotal:   len(ports),
+		Ports:        models.FormatPortSpec(ports),
+	}
+	
+	// Without a job the batches' results would have nowhere to go
+	if err := db.CreateScanJob(ctx, job); err != nil {
+		return fmt.Errorf("creating scan job %s: %w", scanID, err)
+	}
+	
+	// Submit scan tasks to SQS
+	queued := 0
+	for _, request := range requests {
+		if err := queueScanRequest(ctx, sqsClient, tasksQueueURL, request); err != nil {
+			log.Printf("Error sending task to SQS: %v", err)
+			continue
+		}
+		
+		queued++
+		log.Printf("Scheduled %s scan batch %d/%d for IP %s", 
+			protocol, request.BatchID+1, totalBatches, ipAddress)
+	}
+	
+	// A chained scan expects every batch once its first is queued
+	if queued < len(requests) {
+		log.Printf("Queued %d of %d batches for scan %s", queued, len(requests), scanID)
+		if _, err := db.SetScanJobBatchesQueued(ctx, scanID, queued); err != nil {
+			log.Printf("Error updating scan job %s: %v", scanID, err)
+		}
+	}
+	
+	if queued == 0 {
+		return fmt.Errorf("no batches queued for scan %s", scanID)
+	}
+	
+	return nil
+}
+
+// queueScanRequest sends a batch to the workers through the tasks queue
+func queueScanRequest(ctx context.Context, sqsClient platform.Queues, tasksQueueURL string, request scanner.ScanRequest) error {
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(tasksQueueURL),
+		MessageBody: aws.String(string(requestJSON)),
+	})
+	return err
+}
+
+// HandleSchedule processes scheduler events
+func HandleSchedule(ctx context.Context, event SchedulerEvent) error {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		log.Printf("Error loading AWS config: %v", err)
+		return err
+	}
+	
+	sqsClient := services.Queues
+	db := services.DB
+	
+	if event.BackfillInventory {
+		return backfillInventory(ctx, db)
+	}
+	
+	opts := ScanOptions{ScanID: event.ScanID, Protocol: event.Protocol, GrabBanners: event.GrabBanners, MaxScanRate: event.MaxScanRate}
+	
+	// Scheduled scans carry their own profiles
+	if event.Immediate {
+		profile, err := db.GetScanProfile(ctx, event.Profile)
+		if err != nil {
+			log.Printf("Error loading scan profile %q: %v", event.Profile, err)
+			return err
+		}
+		opts.Profile = profile
+	}
+	
+	// Expand blocks, ranges and hostnames into individual addresses. A single
+	// target that expands to several addresses becomes a bulk scan.
+	if event.Immediate && (len(event.IPs) > 0 || (event.IP != "" && !targets.IsSingleAddress(event.IP))) {
+		specs := event.IPs
+		if event.IP != "" {
+			specs = append([]string{event.IP}, specs...)
+		}
+		
+		expanded, err := targets.Expand(ctx, specs, targets.Options{Exclude: event.Exclude})
+		if err != nil {
+			log.Printf("Error expanding targets: %v", err)
+			return err
+		}
+		
+		event.IP = ""
+		event.IPs = make([]string, 0, len(expanded))
+		for _, target := range expanded {
+			event.IPs = append(event.IPs, target.IPAddress)
+		}
+	}
+	
+	if event.IP != "" {
+		canonical, err := targets.CanonicalIP(event.IP)
+		if err != nil {
+			return err
+		}
+		event.IP = canonical
+	}
+	
+	// Handle immediate scan for a single IP
+	if event.Immediate && event.IP != "" {
+		log.Printf("Immediate scan requested for IP %s with port set %s", event.IP, event.PortSet)
+		
+		// Use provided ports if available, otherwise determine from port set
+		if len(event.Ports) > 0 {
+			previouslyOpen := previouslyOpenPorts(ctx, db, event.IP, event.Protocol)
+			if err := dispatchScan(ctx, event.IP, event.PortSet, event.Ports, opts, previouslyOpen, sqsClient, db); err != nil {
+				return err
+			}
+			
+			log.Printf("Immediate scan scheduled for IP %s with %d ports", 
+				event.IP, len(event.Ports))
+			
+			return nil
+		} else {
+			// Schedule scan with port set
+			return ScheduleScan(ctx, event.IP, event.PortSet, opts, sqsClient, db)
+		}
+	}
+	
+	// Handle bulk immediate scan
+	if event.Immediate && len(event.IPs) > 0 {
+		log.Printf("Bulk immediate scan requested for %d IPs with port set %s", len(event.IPs), event.PortSet)
+		
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, 10) // Limit concurrent scheduling
+		
+		for _, ip := range event.IPs {
+			wg.Add(1)
+			semaphore <- struct{}{} // Acquire semaphore
+			
+			go func(ipAddress string) {
+				defer wg.Done()
+				defer func() { <-semaphore }() // Release semaphore
+				
+				ipOpts := opts
+				ipOpts.ScanID = event.ScanIDs[ipAddress]
+				if err := ScheduleScan(ctx, ipAddress, event.PortSet, ipOpts, sqsClient, db); err != nil {
+					log.Printf("Error scheduling scan for IP %s: %v", ipAddress, err)
+					recordScanFailure(ctx, db, ipAddress, event.PortSet, ipOpts, err)
+				}
+			}(ip)
+		}
+		
+		wg.Wait()
+		log.Printf("Bulk scan scheduled for %d IPs", len(event.IPs))
+		
+		return nil
+	}
+	
+	// Handle the rest of a selector schedule's run
+	if event.ScheduleRun != nil {
+		scheduleOpts, err := scheduleScanOptions(ctx, *event.ScheduleRun, db)
+		if err != nil {
+			log.Printf("Error loading scan profile %q: %v", event.ScheduleRun.Profile, err)
+			return err
+		}
+		started := startScheduleIPs(ctx, services.Functions, *event.ScheduleRun, scheduleOpts, event.ScheduleIPs, sqsClient, db)
+		log.Printf("Started %d more scans of schedule %s", started, event.ScheduleRun.ScheduleID)
+		return nil
+	}
+	
+	// Handle scheduled scans
+	if event.Dispatch || event.ScheduleType != "" {
+		return dispatchDueSchedules(ctx, services.Functions, event, sqsClient, db)
+	}
+	
+	// If we get here, no valid operation was specified
+	return fmt.Errorf("no valid operation specified in scheduler event")
+}
+
+
+// backfillInventory runs DynamoDBStore.BackfillInventory until the Lambda
+// deadline is near. IPs kept in another store are always listed, so there
+// is nothing to do for them.
+func backfillInventory(ctx context.Context, db *database.Client) error {
+	store, ok := db.Store.(*database.DynamoDBStore)
+	if !ok {
+		log.Printf("IPs are not kept in DynamoDB, no inventory backfill needed")
+		return nil
+	}
+	
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-dispatchTimeMargin))
+		defer cancel()
+	}
+	
+	updated, err := store.BackfillInventory(ctx)
+	if err != nil {
+		return fmt.Errorf("backfilled %d IPs before stopping, invoke again to finish: %w", updated, err)
+	}
+	log.Printf("Backfilled the inventory keys of %d IPs", updated)
+	return nil
+}
+
+// dispatchDueSchedules pages through every due schedule and starts its scan
+// with bounded parallelism. Each run is claimed before its scan is queued,
+// so overlapping passes never start it twice. When the invocation is close
+// to its deadline, the rest of the pass continues in a new invocation.
+func dispatchDueSchedules(ctx context.Context, functions platform.Functions, event SchedulerEvent, sqsClient platform.Queues, db *database.Client) error {
+	pageSize := event.MaxIPs
+	if pageSize <= 0 {
+		pageSize = defaultDispatchPageSize
+	}
+	
+	concurrency := defaultDispatchConcurrency
+	if n, err := strconv.Atoi(os.Getenv("DISPATCH_CONCURRENCY")); err == nil && n > 0 {
+		concurrency = n
+	}
+	
+	now := time.Now()
+	token := event.ContinuationToken
+	
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	dispatched := 0
+	semaphore := make(chan struct{}, concurrency)
+	
+	for {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < dispatchTimeMargin {
+			wg.Wait()
+			log.Printf("Dispatched %d scheduled scans, continuing in a new invocation", dispatched)
+			return continueDispatch(ctx, functions, event, token)
+		}
+		
+		scans, nextToken, err := db.GetDueSchedules(ctx, now, event.ScheduleType, pageSize, token)
+		if err != nil {
+			wg.Wait()
+			log.Printf("Error getting due schedules: %v", err)
+			return err
+		}
+		
+		for _, scan := range scans {
+			wg.Add(1)
+			semaphore <- struct{}{} // Acquire semaphore
+			
+			go func(scan models.ScheduleScan) {
+				defer wg.Done()
+				defer func() { <-semaphore }() // Release semaphore
+				
+				claimed, err := db.ClaimScheduleRun(ctx, scan, now)
+				if err != nil {
+					log.Printf("Error claiming schedule %s: %v", scan.ScheduleID, err)
+					return
+				}
+				if !claimed {
+					return
+				}
+				
+				started, err := startScheduleScans(ctx, functions, scan, sqsClient, db)
+				if err != nil {
+					log.Printf("Error scheduling scans for schedule %s: %v", scan.ScheduleID, err)
+					if err := db.ReleaseScheduleRun(ctx, scan); err != nil {
+						log.Printf("%v", err)
+					}
+					return
+				}
+				
+				mu.Lock()
+				dispatched += started
+				mu.Unlock()
+			}(scan)
+		}
+		
+		token = nextToken
+		if token == "" {
+			break
+		}
+	}
+	
+	wg.Wait()
+	log.Printf("Dispatched %d scheduled scans", dispatched)
+	return nil
+}
+
+// startScheduleScans starts the scans of a claimed schedule and returns how
+// many it started. A selector schedule scans the IPs its selector matches
+// now. An error means nothing was started and the run can be released; once
+// IPs are being scanned, the ones that fail are logged and skipped.
+func startScheduleScans(ctx context.Context, functions platform.Functions, scan models.ScheduleScan, sqsClient platform.Queues, db *database.Client) (int, error) {
+	opts, err := scheduleScanOptions(ctx, scan, db)
+	if err != nil {
+		return 0, err
+	}
+	
+	if scan.Selector == nil {
+		if err := ScheduleScan(ctx, scan.IPAddress, scan.PortSet, opts, sqsClient, db); err != nil {
+			return 0, fmt.Errorf("IP %s: %v", scan.IPAddress, err)
+		}
+		return 1, nil
+	}
+	
+	ips, err := db.SelectIPs(ctx, *scan.Selector)
+	if err != nil {
+		return 0, fmt.Errorf("error selecting IPs: %v", err)
+	}
+	if len(ips) == 0 {
+		log.Printf("Schedule %s: no IPs match the selector", scan.ScheduleID)
+		return 0, nil
+	}
+	
+	return startScheduleIPs(ctx, functions, scan, opts, ips, sqsClient, db), nil
+}
+
+// startScheduleIPs starts the scans of a schedule's run for the given IPs
+// and returns how many it started. When the invocation is close to its
+// deadline, the IPs left are handed to new invocations.
+func startScheduleIPs(ctx context.Context, functions platform.Functions, scan models.ScheduleScan, opts ScanOptions, ips []string, sqsClient platform.Queues, db *database.Client) int {
+	started := 0
+	for i, ip := range ips {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < dispatchTimeMargin {
+			rest := ips[i:]
+			log.Printf("Started %d scans of schedule %s, continuing with %d IPs in a new invocation", started, scan.ScheduleID, len(rest))
+			if err := continueScheduleIPs(ctx, functions, scan, rest); err != nil {
+				log.Printf("Error continuing schedule %s: %v", scan.ScheduleID, err)
+			}
+			return started
+		}
+		
+		if err := ScheduleScan(ctx, ip, scan.PortSet, opts, sqsClient, db); err != nil {
+			log.Printf("Error scheduling scan for IP %s of schedule %s: %v", ip, scan.ScheduleID, err)
+			continue
+		}
+		started++
+	}
+	return started
+}
+
+// scheduleScanOptions returns the options of a schedule's scans
+func scheduleScanOptions(ctx context.Context, scan models.ScheduleScan, db *database.Client) (ScanOptions, error) {
+	profile, err := db.GetScanProfile(ctx, scan.Profile)
+	if err != nil {
+		return ScanOptions{}, err
+	}
+	return ScanOptions{Profile: profile, ScheduleID: scan.ScheduleID, ScheduleType: scan.ScheduleType}, nil
+}
+
+// continueScheduleIPs hands the IPs of a schedule's run to new asynchronous
+// invocations of this function, in chunks of at most maxContinuationIPs
+func continueScheduleIPs(ctx context.Context, functions platform.Functions, scan models.ScheduleScan, ips []string) error {
+	for len(ips) > 0 {
+		chunk := ips
+		if len(chunk) > maxContinuationIPs {
+			chunk = chunk[:maxContinuationIPs]
+		}
+		ips = ips[len(chunk):]
+		
+		if err := invokeSelf(ctx, functions, SchedulerEvent{ScheduleRun: &scan, ScheduleIPs: chunk}); err != nil {
+			return fmt.Errorf("%d IPs not started: %v", len(chunk)+len(ips), err)
+		}
+	}
+	return nil
+}
+
+// continueDispatch hands the rest of a dispatch pass to a new asynchronous
+// invocation of this function
+func continueDispatch(ctx context.Context, functions platform.Functions, event SchedulerEvent, token string) error {
+	return invokeSelf(ctx, functions, SchedulerEvent{
+		Dispatch:          true,
+		ScheduleType:      event.ScheduleType,
+		MaxIPs:            event.MaxIPs,
+		ContinuationToken: token,
+	})
+}
+
+// invokeSelf invokes this function asynchronously with an event
+func invokeSelf(ctx context.Context, functions platform.Functions, event SchedulerEvent) error {
+	functionName := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	if functionName == "" {
+		functionName = "nexusscan-scheduler"
+	}
+	
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	
+	_, err = functions.Invoke(ctx, &lambdaService.InvokeInput{
+		FunctionName:   aws.String(functionName),
+		Payload:        payload,
+		InvocationType: lambdaTypes.InvocationTypeEvent, // Asynchronous invocation
+	})
+	return err
+}
@@ -0,0 +1,402 @@
+// pkg/handlers/scheduler/scheduler_test.go
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/local"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+)
+
+// recordingQueues keeps the scan requests sent to the tasks queue
+type recordingQueues struct {
+	mu       sync.Mutex
+	requests []scanner.ScanRequest
+}
+
+func (q *recordingQueues) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	var request scanner.ScanRequest
+	if err := json.Unmarshal([]byte(aws.ToString(params.MessageBody)), &request); err != nil {
+		return nil, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.requests = append(q.requests, request)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+// take returns the requests sent so far and forgets them
+func (q *recordingQueues) take() []scanner.ScanRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	requests := q.requests
+	q.requests = nil
+	return requests
+}
+
+// newTestClient returns a client on an empty local store, with the IP,
+// schedule and result stores in memory
+func newTestClient(t *testing.T) *database.Client {
+	t.Helper()
+	tables := database.DefaultTables()
+	api, err := local.OpenStore(filepath.Join(t.TempDir(), "nexusscan.db"), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { api.Close() })
+	return database.NewClientWithStore(api, tables, database.NewMemoryStore())
+}
+
+// TestDispatchBuiltinProfiles dispatches every built-in port set under every
+// built-in profile and follows the batches the way the workers would,
+// checking that each port is scanned once and capped batches fit a worker run
+func TestDispatchBuiltinProfiles(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TASKS_QUEUE_URL", "local://nexusscan-tasks")
+	db := newTestClient(t)
+	previouslyOpen := map[int]bool{22: true, 443: true}
+
+	for _, profile := range models.BuiltinScanProfiles() {
+		profile := profile
+		for _, portSet := range models.BuiltinPortSets {
+			name := fmt.Sprintf("%s with %s", profile.Name, portSet)
+			ports := models.GetPortSet(portSet)
+			queues := &recordingQueues{}
+			opts := ScanOptions{
+				ScanID:   fmt.Sprintf("scan-%s-%s", profile.Name, portSet),
+				Protocol: models.ProtocolTCP,
+				Profile:  &profile,
+			}
+
+			if err := dispatchScan(ctx, "10.0.0.1", portSet, ports, opts, previouslyOpen, queues, db); err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			job, err := db.GetScanJob(ctx, opts.ScanID)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+
+			pending := queues.take()
+			if profile.MaxScanRate > 0 && len(pending) != 1 {
+				t.Errorf("%s: capped scan queued %d batches, want 1", name, len(pending))
+			}
+			if profile.MaxScanRate == 0 && len(pending) != job.TotalBatches {
+				t.Errorf("%s: queued %d batches, want %d", name, len(pending), job.TotalBatches)
+			}
+
+			// Scan the batches as the workers would, queueing the next of a chain
+			var batches []scanner.ScanRequest
+			for len(pending) > 0 {
+				request := pending[0]
+				pending = pending[1:]
+				batches = append(batches, request)
+
+				next, err := request.NextBatch()
+				if err != nil {
+					t.Errorf("%s: batch %d: %v", name, request.BatchID, err)
+					break
+				}
+				if next != nil {
+					pending = append(pending, *next)
+				}
+			}
+
+			if len(batches) != job.TotalBatches {
+				t.Errorf("%s: scanned %d batches, job expects %d", name, len(batches), job.TotalBatches)
+			}
+			scanned := map[int]int{}
+			watched := map[int]bool{}
+			for _, batch := range batches {
+				if batch.MaxRate != float64(profile.MaxScanRate) {
+					t.Errorf("%s: batch %d at %v probes per second, want %d", name, batch.BatchID, batch.MaxRate, profile.MaxScanRate)
+				}
+				if batch.MaxRate > 0 {
+					probes := len(batch.PortsToScan) * (batch.RetryCount + 1)
+					if duration := time.Duration(probes) * time.Second / time.Duration(batch.MaxRate); duration > models.MaxRateCappedBatchTime {
+						t.Errorf("%s: batch %d can take %v, more than %v", name, batch.BatchID, duration, models.MaxRateCappedBatchTime)
+					}
+				}
+				for _, port := range batch.PortsToScan {
+					scanned[port]++
+				}
+				for _, port := range batch.WatchPorts {
+					watched[port] = true
+				}
+			}
+
+			for _, port := range ports {
+				if scanned[port] != 1 {
+					t.Errorf("%s: port %d scanned %d times", name, port, scanned[port])
+				}
+			}
+			if len(scanned) != len(ports) {
+				t.Errorf("%s: scanned %d ports, want %d", name, len(scanned), len(ports))
+			}
+			for port := range previouslyOpen {
+				if !watched[port] {
+					t.Errorf("%s: previously open port %d not watched", name, port)
+				}
+			}
+		}
+	}
+}
+
+// laterStore runs the schedule dispatch of a store as if the clock were
+// ahead by shift, so freshly added schedules are due. Before returning a
+// page, it lets a rival dispatcher claim every run on it when rival is set.
+type laterStore struct {
+	database.Store
+	shift time.Duration
+	rival bool
+}
+
+func (s *laterStore) GetDueSchedules(ctx context.Context, now time.Time, scheduleType string, pageSize int, token string) ([]models.ScheduleScan, string, error) {
+	scans, next, err := s.Store.GetDueSchedules(ctx, now.Add(s.shift), scheduleType, pageSize, token)
+	if err == nil && s.rival {
+		for _, scan := range scans {
+			s.Store.ClaimScheduleRun(ctx, scan, now.Add(s.shift))
+		}
+	}
+	return scans, next, err
+}
+
+func (s *laterStore) ClaimScheduleRun(ctx context.Context, scan models.ScheduleScan, now time.Time) (bool, error) {
+	return s.Store.ClaimScheduleRun(ctx, scan, now.Add(s.shift))
+}
+
+// recordingFunctions keeps the events of the scheduler invocations made
+type recordingFunctions struct {
+	mu     sync.Mutex
+	events []SchedulerEvent
+}
+
+func (f *recordingFunctions) Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	var event SchedulerEvent
+	if err := json.Unmarshal(params.Payload, &event); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return &lambda.InvokeOutput{}, nil
+}
+
+// failingQueues refuses every message, or delays each one by delay
+type failingQueues struct {
+	recordingQueues
+	fail  bool
+	delay time.Duration
+}
+
+func (q *failingQueues) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if q.fail {
+		return nil, errors.New("queue unavailable")
+	}
+	time.Sleep(q.delay)
+	return q.recordingQueues.SendMessage(ctx, params, optFns...)
+}
+
+// newDispatchClient returns a test client whose schedule store dispatches
+// two hours ahead, with an hourly schedule for each of count IPs and a
+// disabled one
+func newDispatchClient(t *testing.T, count int) (*database.Client, *laterStore, []string) {
+	t.Helper()
+	ctx := context.Background()
+	tables := database.DefaultTables()
+	api, err := local.OpenStore(filepath.Join(t.TempDir(), "nexusscan.db"), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { api.Close() })
+	store := &laterStore{Store: database.NewMemoryStore(), shift: 2 * time.Hour}
+
+	var ids []string
+	for i := 1; i <= count; i++ {
+		id, err := store.AddSchedule(ctx, fmt.Sprintf("10.0.0.%d", i), "hourly", models.ScheduleTiming{}, "top_100", "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := store.AddSchedule(ctx, "10.0.0.99", "hourly", models.ScheduleTiming{}, "top_100", "", false); err != nil {
+		t.Fatal(err)
+	}
+	return database.NewClientWithStore(api, tables, store), store, ids
+}
+
+// scansByIP counts the scans queued for each IP
+func scansByIP(requests []scanner.ScanRequest) map[string]int {
+	scanIDs := map[string]map[string]bool{}
+	for _, request := range requests {
+		if scanIDs[request.IPAddress] == nil {
+			scanIDs[request.IPAddress] = map[string]bool{}
+		}
+		scanIDs[request.IPAddress][request.ScanID] = true
+	}
+	counts := map[string]int{}
+	for ip, ids := range scanIDs {
+		counts[ip] = len(ids)
+	}
+	return counts
+}
+
+// TestDispatchDueSchedulesOnce runs overlapping dispatch passes, which must
+// start each due schedule once between them, and a later pass that finds
+// nothing left to run
+func TestDispatchDueSchedulesOnce(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TASKS_QUEUE_URL", "local://nexusscan-tasks")
+	db, store, ids := newDispatchClient(t, 5)
+	queues := &recordingQueues{}
+	event := SchedulerEvent{Dispatch: true, MaxIPs: 2}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := dispatchDueSchedules(ctx, &recordingFunctions{}, event, queues, db); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	counts := scansByIP(queues.take())
+	for i := 1; i <= 5; i++ {
+		if ip := fmt.Sprintf("10.0.0.%d", i); counts[ip] != 1 {
+			t.Errorf("%s scanned %d times, want once", ip, counts[ip])
+		}
+	}
+	if len(counts) != 5 {
+		t.Errorf("scanned %d IPs, want 5: %v", len(counts), counts)
+	}
+	for _, id := range ids {
+		schedule, err := store.GetScheduleByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schedule.LastRun.IsZero() || !schedule.NextRun.After(time.Now().Add(store.shift)) {
+			t.Errorf("schedule %s: last run %s, next run %s; want a run recorded and the next one ahead", id, schedule.LastRun, schedule.NextRun)
+		}
+	}
+
+	if err := dispatchDueSchedules(ctx, &recordingFunctions{}, event, queues, db); err != nil {
+		t.Fatal(err)
+	}
+	if requests := queues.take(); len(requests) != 0 {
+		t.Errorf("a later pass queued %d batches, want none", len(requests))
+	}
+}
+
+// TestDispatchDueSchedulesLostClaims checks that a run is not started when a
+// rival dispatcher claims it after it was read, and that a claimed run whose
+// scan cannot be queued is released for the next pass
+func TestDispatchDueSchedulesLostClaims(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TASKS_QUEUE_URL", "local://nexusscan-tasks")
+	event := SchedulerEvent{Dispatch: true}
+
+	t.Run("claimed by a rival", func(t *testing.T) {
+		db, store, _ := newDispatchClient(t, 3)
+		store.rival = true
+		queues := &recordingQueues{}
+		if err := dispatchDueSchedules(ctx, &recordingFunctions{}, event, queues, db); err != nil {
+			t.Fatal(err)
+		}
+		if requests := queues.take(); len(requests) != 0 {
+			t.Errorf("queued %d batches of runs claimed by a rival, want none", len(requests))
+		}
+	})
+
+	t.Run("released after a failed dispatch", func(t *testing.T) {
+		db, store, _ := newDispatchClient(t, 3)
+		queues := &failingQueues{fail: true}
+		if err := dispatchDueSchedules(ctx, &recordingFunctions{}, event, queues, db); err != nil {
+			t.Fatal(err)
+		}
+		scans, _, err := store.GetDueSchedules(ctx, time.Now(), "", 10, "")
+		if err != nil || len(scans) != 3 {
+			t.Fatalf("due after a failed dispatch: %d schedules, %v; want 3", len(scans), err)
+		}
+
+		queues.fail = false
+		if err := dispatchDueSchedules(ctx, &recordingFunctions{}, event, queues, db); err != nil {
+			t.Fatal(err)
+		}
+		if counts := scansByIP(queues.take()); len(counts) != 3 {
+			t.Errorf("the next pass scanned %v, want all 3 IPs", counts)
+		}
+	})
+}
+
+// TestDispatchDueSchedulesContinuation runs a pass that reaches its
+// deadline after the first page, then the invocation it hands over to, which
+// must start the remaining schedules from the continuation token
+func TestDispatchDueSchedulesContinuation(t *testing.T) {
+	t.Setenv("TASKS_QUEUE_URL", "local://nexusscan-tasks")
+	t.Setenv("DISPATCH_CONCURRENCY", "1")
+	db, _, _ := newDispatchClient(t, 5)
+
+	// Queueing the first scan outlasts the time left before the margin, so
+	// the pass stops once the first page is done
+	queues := &failingQueues{delay: time.Second}
+	functions := &recordingFunctions{}
+	ctx, cancel := context.WithTimeout(context.Background(), dispatchTimeMargin+500*time.Millisecond)
+	defer cancel()
+	if err := dispatchDueSchedules(ctx, functions, SchedulerEvent{Dispatch: true, MaxIPs: 2}, queues, db); err != nil {
+		t.Fatal(err)
+	}
+
+	first := scansByIP(queues.take())
+	if len(first) != 2 {
+		t.Errorf("the first invocation scanned %v, want the 2 IPs of its first page", first)
+	}
+	if len(functions.events) != 1 {
+		t.Fatalf("the first invocation handed over %d times, want once", len(functions.events))
+	}
+	handover := functions.events[0]
+	if !handover.Dispatch || handover.MaxIPs != 2 || handover.ContinuationToken == "" {
+		t.Fatalf("handed over %+v, want a dispatch of pages of 2 with a continuation token", handover)
+	}
+
+	queues.delay = 0
+	functions = &recordingFunctions{}
+	if err := dispatchDueSchedules(context.Background(), functions, handover, queues, db); err != nil {
+		t.Fatal(err)
+	}
+	rest := scansByIP(queues.take())
+	for ip, count := range first {
+		rest[ip] += count
+	}
+	if len(rest) != 5 || len(functions.events) != 0 {
+		t.Errorf("both invocations scanned %v and handed over %d more times, want all 5 IPs and no handover", rest, len(functions.events))
+	}
+	for ip, count := range rest {
+		if count != 1 {
+			t.Errorf("%s scanned %d times, want once", ip, count)
+		}
+	}
+
+	// A token that GetDueSchedules did not produce is refused
+	bad := SchedulerEvent{Dispatch: true, ContinuationToken: "not-a-token"}
+	if err := dispatchDueSchedules(context.Background(), functions, bad, queues, db); !errors.Is(err, database.ErrInvalidContinuationToken) {
+		t.Errorf("dispatch with a malformed token = %v, want %v", err, database.ErrInvalidContinuationToken)
+	}
+}
@@ -0,0 +1,101 @@
+// pkg/handlers/worker/worker.go
+
+// Package worker scans the port batches queued by the scheduler and queues
+// the results for the processor, along with the next batch of a rate capped
+// scan
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/scanner"
+)
+
+func HandleSQSEvent(ctx context.Context, event events.SQSEvent) error {
+	// Initialize AWS clients
+	services, err := platform.Load(ctx)
+	if err != nil {
+		return err
+	}
+	
+	sqsClient := services.Queues
+	resultsQueueURL := os.Getenv("RESULTS_QUEUE_URL")
+	tasksQueueURL := os.Getenv("TASKS_QUEUE_URL")
+	
+	for _, message := range event.Records {
+		// Parse SQS message into scan request
+		var request scanner.ScanRequest
+		if err := json.Unmarshal([]byte(message.Body), &request); err != nil {
+			log.Printf("Error parsing message: %v", err)
+			continue
+		}
+		
+		log.Printf("Processing scan for IP %s (%d ports)", 
+			request.IPAddress, len(request.PortsToScan))
+		
+		// Execute the scan
+		result, err := scanner.ScanPorts(ctx, request)
+		if err != nil {
+			log.Printf("Error scanning IP %s: %v", request.IPAddress, err)
+			continue
+		}
+		
+		// Send result to results queue
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("Error marshaling result: %v", err)
+			continue
+		}
+		
+		_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:    &resultsQueueURL,
+			MessageBody: aws.String(string(resultJSON)),
+		})
+		
+		if err != nil {
+			log.Printf("Error sending result: %v", err)
+		}
+		
+		log.Printf("Scan complete for IP %s: found %d open ports", 
+			request.IPAddress, len(result.OpenPorts))
+		
+		// The batches of a rate capped scan run one after another, so queue
+		// the next one now that this one is done. If that fails, the processor
+		// marks the scan partial once it stops hearing from it.
+		next, err := request.NextBatch()
+		if err != nil {
+			log.Printf("Error preparing next batch of scan %s: %v", request.ScanID, err)
+			continue
+		}
+		if next == nil {
+			continue
+		}
+		
+		nextJSON, err := json.Marshal(next)
+		if err != nil {
+			log.Printf("Error marshaling next batch: %v", err)
+			continue
+		}
+		
+		_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:    &tasksQueueURL,
+			MessageBody: aws.String(string(nextJSON)),
+		})
+		
+		if err != nil {
+			log.Printf("Error queueing batch %d/%d of scan %s: %v", 
+				next.BatchID+1, next.TotalBatches, request.ScanID, err)
+		}
+	}
+	
+	return nil
+}
+
+
@@ -0,0 +1,570 @@
+// pkg/local/eval.go
+
+package local
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// resolve looks up a document path in an item
+func resolve(item map[string]types.AttributeValue, path docPath) (types.AttributeValue, bool) {
+	if len(path) == 0 || path[0].isIndex {
+		return nil, false
+	}
+	current, ok := item[path[0].name]
+	if !ok {
+		return nil, false
+	}
+	for _, elem := range path[1:] {
+		if elem.isIndex {
+			list, isList := current.(*types.AttributeValueMemberL)
+			if !isList || elem.index >= len(list.Value) {
+				return nil, false
+			}
+			current = list.Value[elem.index]
+			continue
+		}
+		m, isMap := current.(*types.AttributeValueMemberM)
+		if !isMap {
+			return nil, false
+		}
+		if current, ok = m.Value[elem.name]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// evalOperand evaluates an operand against an item. ok is false when a path
+// does not exist.
+func evalOperand(item map[string]types.AttributeValue, o operand) (types.AttributeValue, bool, error) {
+	switch v := o.(type) {
+	case valueOperand:
+		return v.value, true, nil
+	case pathOperand:
+		value, ok := resolve(item, v.path)
+		return value, ok, nil
+	case sizeOperand:
+		value, ok := resolve(item, v.path)
+		if !ok {
+			return nil, false, nil
+		}
+		size, ok := sizeOf(value)
+		if !ok {
+			return nil, false, nil
+		}
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(size)}, true, nil
+	case ifNotExists:
+		if value, ok := resolve(item, v.path); ok {
+			return value, true, nil
+		}
+		return evalOperand(item, v.fallback)
+	case listAppend:
+		a, okA, err := evalOperand(item, v.a)
+		if err != nil {
+			return nil, false, err
+		}
+		b, okB, err := evalOperand(item, v.b)
+		if err != nil {
+			return nil, false, err
+		}
+		listA, isA := a.(*types.AttributeValueMemberL)
+		listB, isB := b.(*types.AttributeValueMemberL)
+		if !okA || !okB || !isA || !isB {
+			return nil, false, validationError("list_append operands must be lists")
+		}
+		joined := append(append([]types.AttributeValue{}, listA.Value...), listB.Value...)
+		return &types.AttributeValueMemberL{Value: joined}, true, nil
+	case arithmetic:
+		a, okA, err := evalOperand(item, v.a)
+		if err != nil {
+			return nil, false, err
+		}
+		b, okB, err := evalOperand(item, v.b)
+		if err != nil {
+			return nil, false, err
+		}
+		numA, isA := a.(*types.AttributeValueMemberN)
+		numB, isB := b.(*types.AttributeValueMemberN)
+		if !okA || !okB || !isA || !isB {
+			return nil, false, validationError("arithmetic operands must be numbers")
+		}
+		x, err := parseNumber(numA.Value)
+		if err != nil {
+			return nil, false, err
+		}
+		y, err := parseNumber(numB.Value)
+		if err != nil {
+			return nil, false, err
+		}
+		if v.op == '+' {
+			x.Add(x, y)
+		} else {
+			x.Sub(x, y)
+		}
+		return &types.AttributeValueMemberN{Value: formatNumber(x)}, true, nil
+	}
+	return nil, false, validationError("unsupported operand")
+}
+
+func sizeOf(value types.AttributeValue) (int, bool) {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return utf8.RuneCountInString(v.Value), true
+	case *types.AttributeValueMemberB:
+		return len(v.Value), true
+	case *types.AttributeValueMemberSS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberNS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberBS:
+		return len(v.Value), true
+	case *types.AttributeValueMemberM:
+		return len(v.Value), true
+	case *types.AttributeValueMemberL:
+		return len(v.Value), true
+	}
+	return 0, false
+}
+
+// evalCondition evaluates a condition against an item. A nil condition
+// always matches.
+func evalCondition(item map[string]types.AttributeValue, c condition) (bool, error) {
+	switch v := c.(type) {
+	case nil:
+		return true, nil
+	case logical:
+		left, err := evalCondition(item, v.left)
+		if err != nil {
+			return false, err
+		}
+		if left != v.and {
+			return left, nil // Short circuit
+		}
+		return evalCondition(item, v.right)
+	case negation:
+		matched, err := evalCondition(item, v.c)
+		return !matched, err
+	case comparison:
+		a, okA, err := evalOperand(item, v.a)
+		if err != nil {
+			return false, err
+		}
+		b, okB, err := evalOperand(item, v.b)
+		if err != nil {
+			return false, err
+		}
+		if !okA || !okB {
+			return false, nil
+		}
+		switch v.op {
+		case "=":
+			return equalValues(a, b), nil
+		case "<>":
+			return !equalValues(a, b), nil
+		}
+		cmp, ok := compareValues(a, b)
+		if !ok {
+			return false, nil
+		}
+		switch v.op {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp >= 0, nil
+	case between:
+		a, okA, err := evalOperand(item, v.a)
+		if err != nil {
+			return false, err
+		}
+		low, okLow, err := evalOperand(item, v.low)
+		if err != nil {
+			return false, err
+		}
+		high, okHigh, err := evalOperand(item, v.high)
+		if err != nil {
+			return false, err
+		}
+		if !okA || !okLow || !okHigh {
+			return false, nil
+		}
+		cmpLow, ok1 := compareValues(a, low)
+		cmpHigh, ok2 := compareValues(a, high)
+		return ok1 && ok2 && cmpLow >= 0 && cmpHigh <= 0, nil
+	case inList:
+		a, ok, err := evalOperand(item, v.a)
+		if err != nil || !ok {
+			return false, err
+		}
+		for _, candidate := range v.list {
+			value, ok, err := evalOperand(item, candidate)
+			if err != nil {
+				return false, err
+			}
+			if ok && equalValues(a, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case function:
+		return evalFunction(item, v)
+	}
+	return false, validationError("unsupported condition")
+}
+
+func evalFunction(item map[string]types.AttributeValue, fn function) (bool, error) {
+	if fn.name == "attribute_exists" || fn.name == "attribute_not_exists" {
+		path, ok := fn.args[0].(pathOperand)
+		if !ok {
+			return false, validationError("%s takes an attribute path", fn.name)
+		}
+		_, exists := resolve(item, path.path)
+		return exists == (fn.name == "attribute_exists"), nil
+	}
+
+	a, okA, err := evalOperand(item, fn.args[0])
+	if err != nil {
+		return false, err
+	}
+	b, okB, err := evalOperand(item, fn.args[1])
+	if err != nil {
+		return false, err
+	}
+	if !okA || !okB {
+		return false, nil
+	}
+
+	switch fn.name {
+	case "attribute_type":
+		want, ok := b.(*types.AttributeValueMemberS)
+		return ok && typeName(a) == want.Value, nil
+	case "begins_with":
+		switch x := a.(type) {
+		case *types.AttributeValueMemberS:
+			prefix, ok := b.(*types.AttributeValueMemberS)
+			return ok && strings.HasPrefix(x.Value, prefix.Value), nil
+		case *types.AttributeValueMemberB:
+			prefix, ok := b.(*types.AttributeValueMemberB)
+			return ok && strings.HasPrefix(string(x.Value), string(prefix.Value)), nil
+		}
+		return false, nil
+	case "contains":
+		switch x := a.(type) {
+		case *types.AttributeValueMemberS:
+			sub, ok := b.(*types.AttributeValueMemberS)
+			return ok && strings.Contains(x.Value, sub.Value), nil
+		case *types.AttributeValueMemberSS:
+			for _, member := range x.Value {
+				if equalValues(&types.AttributeValueMemberS{Value: member}, b) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberNS:
+			for _, member := range x.Value {
+				if equalValues(&types.AttributeValueMemberN{Value: member}, b) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberBS:
+			for _, member := range x.Value {
+				if equalValues(&types.AttributeValueMemberB{Value: member}, b) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberL:
+			for _, member := range x.Value {
+				if equalValues(member, b) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, validationError("unsupported function %s", fn.name)
+}
+
+// applyUpdate applies an update expression to an item in place. Values are
+// computed from the item as it was before the update.
+func applyUpdate(item map[string]types.AttributeValue, u *update) error {
+	before := copyItem(item)
+
+	for _, action := range u.set {
+		value, ok, err := evalOperand(before, action.value)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return validationError("the value for %s refers to an attribute that does not exist", action.path)
+		}
+		if err := setPath(item, action.path, value); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range u.remove {
+		removePath(item, path)
+	}
+
+	for _, action := range u.add {
+		value, _, err := evalOperand(before, action.value)
+		if err != nil {
+			return err
+		}
+		current, exists := resolve(item, action.path)
+		if !exists {
+			if err := setPath(item, action.path, value); err != nil {
+				return err
+			}
+			continue
+		}
+		sum, err := addValues(current, value)
+		if err != nil {
+			return err
+		}
+		if err := setPath(item, action.path, sum); err != nil {
+			return err
+		}
+	}
+
+	for _, action := range u.delete {
+		value, _, err := evalOperand(before, action.value)
+		if err != nil {
+			return err
+		}
+		current, exists := resolve(item, action.path)
+		if !exists {
+			continue
+		}
+		remaining, empty, err := deleteFromSet(current, value)
+		if err != nil {
+			return err
+		}
+		if empty {
+			removePath(item, action.path)
+		} else if err := setPath(item, action.path, remaining); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addValues implements ADD: numeric addition or set union
+func addValues(current, value types.AttributeValue) (types.AttributeValue, error) {
+	switch x := current.(type) {
+	case *types.AttributeValueMemberN:
+		y, ok := value.(*types.AttributeValueMemberN)
+		if !ok {
+			return nil, validationError("ADD operand type mismatch")
+		}
+		a, err := parseNumber(x.Value)
+		if err != nil {
+			return nil, err
+		}
+		b, err := parseNumber(y.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberN{Value: formatNumber(a.Add(a, b))}, nil
+	case *types.AttributeValueMemberSS:
+		y, ok := value.(*types.AttributeValueMemberSS)
+		if !ok {
+			return nil, validationError("ADD operand type mismatch")
+		}
+		return &types.AttributeValueMemberSS{Value: union(x.Value, y.Value, func(s string) string { return s })}, nil
+	case *types.AttributeValueMemberNS:
+		y, ok := value.(*types.AttributeValueMemberNS)
+		if !ok {
+			return nil, validationError("ADD operand type mismatch")
+		}
+		return &types.AttributeValueMemberNS{Value: union(x.Value, y.Value, canonicalNumber)}, nil
+	case *types.AttributeValueMemberBS:
+		y, ok := value.(*types.AttributeValueMemberBS)
+		if !ok {
+			return nil, validationError("ADD operand type mismatch")
+		}
+		return &types.AttributeValueMemberBS{Value: union(x.Value, y.Value, func(b []byte) string { return string(b) })}, nil
+	}
+	return nil, validationError("ADD only supports numbers and sets")
+}
+
+// deleteFromSet implements DELETE: set difference. empty reports that
+// nothing is left.
+func deleteFromSet(current, value types.AttributeValue) (types.AttributeValue, bool, error) {
+	switch x := current.(type) {
+	case *types.AttributeValueMemberSS:
+		y, ok := value.(*types.AttributeValueMemberSS)
+		if !ok {
+			return nil, false, validationError("DELETE operand type mismatch")
+		}
+		left := difference(x.Value, y.Value, func(s string) string { return s })
+		return &types.AttributeValueMemberSS{Value: left}, len(left) == 0, nil
+	case *types.AttributeValueMemberNS:
+		y, ok := value.(*types.AttributeValueMemberNS)
+		if !ok {
+			return nil, false, validationError("DELETE operand type mismatch")
+		}
+		left := difference(x.Value, y.Value, canonicalNumber)
+		return &types.AttributeValueMemberNS{Value: left}, len(left) == 0, nil
+	case *types.AttributeValueMemberBS:
+		y, ok := value.(*types.AttributeValueMemberBS)
+		if !ok {
+			return nil, false, validationError("DELETE operand type mismatch")
+		}
+		left := difference(x.Value, y.Value, func(b []byte) string { return string(b) })
+		return &types.AttributeValueMemberBS{Value: left}, len(left) == 0, nil
+	}
+	return nil, false, validationError("DELETE only supports sets")
+}
+
+func union[T any](a, b []T, key func(T) string) []T {
+	seen := make(map[string]bool, len(a)+len(b))
+	out := make([]T, 0, len(a)+len(b))
+	for _, v := range append(append([]T{}, a...), b...) {
+		if !seen[key(v)] {
+			seen[key(v)] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func difference[T any](a, b []T, key func(T) string) []T {
+	drop := make(map[string]bool, len(b))
+	for _, v := range b {
+		drop[key(v)] = true
+	}
+	var out []T
+	for _, v := range a {
+		if !drop[key(v)] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// setPath writes a value at a document path. Every element but the last
+// must already exist, as in DynamoDB.
+func setPath(item map[string]types.AttributeValue, path docPath, value types.AttributeValue) error {
+	if len(path) == 1 {
+		item[path[0].name] = value
+		return nil
+	}
+
+	parent, ok := resolve(item, path[:len(path)-1])
+	if !ok {
+		return validationError("the document path %s is invalid for update", path)
+	}
+
+	last := path[len(path)-1]
+	updated, err := withChild(parent, last, value)
+	if err != nil {
+		return err
+	}
+	return setPath(item, path[:len(path)-1], updated)
+}
+
+// withChild returns a copy of a map or list with one element replaced
+func withChild(parent types.AttributeValue, elem pathElem, value types.AttributeValue) (types.AttributeValue, error) {
+	if elem.isIndex {
+		list, ok := parent.(*types.AttributeValueMemberL)
+		if !ok {
+			return nil, validationError("the document path is invalid for update")
+		}
+		values := append([]types.AttributeValue{}, list.Value...)
+		if elem.index >= len(values) {
+			values = append(values, value)
+		} else {
+			values[elem.index] = value
+		}
+		return &types.AttributeValueMemberL{Value: values}, nil
+	}
+
+	m, ok := parent.(*types.AttributeValueMemberM)
+	if !ok {
+		return nil, validationError("the document path is invalid for update")
+	}
+	values := copyItem(m.Value)
+	values[elem.name] = value
+	return &types.AttributeValueMemberM{Value: values}, nil
+}
+
+// removePath deletes the value at a document path, if present
+func removePath(item map[string]types.AttributeValue, path docPath) {
+	if len(path) == 1 {
+		delete(item, path[0].name)
+		return
+	}
+
+	parent, ok := resolve(item, path[:len(path)-1])
+	if !ok {
+		return
+	}
+
+	var updated types.AttributeValue
+	last := path[len(path)-1]
+	switch v := parent.(type) {
+	case *types.AttributeValueMemberM:
+		values := copyItem(v.Value)
+		delete(values, last.name)
+		updated = &types.AttributeValueMemberM{Value: values}
+	case *types.AttributeValueMemberL:
+		if !last.isIndex || last.index >= len(v.Value) {
+			return
+		}
+		values := append([]types.AttributeValue{}, v.Value[:last.index]...)
+		values = append(values, v.Value[last.index+1:]...)
+		updated = &types.AttributeValueMemberL{Value: values}
+	default:
+		return
+	}
+	setPath(item, path[:len(path)-1], updated)
+}
+
+// project keeps only the given paths of an item
+func project(item map[string]types.AttributeValue, paths []docPath) map[string]types.AttributeValue {
+	if len(paths) == 0 {
+		return item
+	}
+	out := make(map[string]types.AttributeValue)
+	for _, path := range paths {
+		value, ok := resolve(item, path)
+		if !ok {
+			continue
+		}
+		if len(path) == 1 {
+			out[path[0].name] = value
+			continue
+		}
+		// Nested projections keep the enclosing maps, trimmed to the
+		// projected members
+		projectNested(out, path, value)
+	}
+	return out
+}
+
+func projectNested(out map[string]types.AttributeValue, path docPath, value types.AttributeValue) {
+	for i := len(path) - 1; i > 0; i-- {
+		elem := path[i]
+		if elem.isIndex {
+			value = &types.AttributeValueMemberL{Value: []types.AttributeValue{value}}
+			continue
+		}
+		parent, ok := resolve(out, path[:i])
+		if m, isMap := parent.(*types.AttributeValueMemberM); ok && isMap {
+			values := copyItem(m.Value)
+			values[elem.name] = value
+			value = &types.AttributeValueMemberM{Value: values}
+		} else {
+			value = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{elem.name: value}}
+		}
+	}
+	out[path[0].name] = value
+}
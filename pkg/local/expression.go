@@ -0,0 +1,558 @@
+// pkg/local/expression.go
+
+package local
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// pathElem is one step of a document path: a map key or a list index
+type pathElem struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type docPath []pathElem
+
+func (p docPath) String() string {
+	var b strings.Builder
+	for i, elem := range p {
+		if elem.isIndex {
+			b.WriteString("[" + strconv.Itoa(elem.index) + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(elem.name)
+	}
+	return b.String()
+}
+
+// operand is anything that evaluates to a value: a path, a placeholder
+// value, or a function or arithmetic over those
+type operand interface{}
+
+type (
+	pathOperand  struct{ path docPath }
+	valueOperand struct{ value types.AttributeValue }
+	sizeOperand  struct{ path docPath }
+	ifNotExists  struct {
+		path     docPath
+		fallback operand
+	}
+	listAppend struct{ a, b operand }
+	arithmetic struct {
+		op   byte
+		a, b operand
+	}
+)
+
+// condition is a node of a condition, filter or key condition expression
+type condition interface{}
+
+type (
+	logical struct {
+		and         bool
+		left, right condition
+	}
+	negation   struct{ c condition }
+	comparison struct {
+		op   string
+		a, b operand
+	}
+	between struct{ a, low, high operand }
+	inList  struct {
+		a    operand
+		list []operand
+	}
+	function struct {
+		name string
+		args []operand
+	}
+)
+
+// update is a parsed update expression
+type update struct {
+	set    []setAction
+	remove []docPath
+	add    []setAction
+	delete []setAction
+}
+
+type setAction struct {
+	path  docPath
+	value operand
+}
+
+type token struct {
+	kind byte // 'i' identifier, '#' name, ':' value, 'n' number, 'p' punctuation
+	text string
+}
+
+// parser parses one expression, resolving #name and :value placeholders as
+// it goes
+type parser struct {
+	tokens []token
+	pos    int
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func newParser(expr string, names map[string]string, values map[string]types.AttributeValue) (*parser, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{tokens: tokens, names: names, values: values}, nil
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || r == ':' || unicode.IsLetter(r) || r == '_':
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			kind := byte('i')
+			if r == '#' || r == ':' {
+				kind = byte(r)
+			}
+			tokens = append(tokens, token{kind: kind, text: string(runes[start:i])})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: 'n', text: string(runes[start:i])})
+		case r == '<' || r == '>':
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				tokens = append(tokens, token{kind: 'p', text: string(runes[i : i+2])})
+				i += 2
+			} else {
+				tokens = append(tokens, token{kind: 'p', text: string(r)})
+				i++
+			}
+		case strings.ContainsRune("=(),.[]+-", r):
+			tokens = append(tokens, token{kind: 'p', text: string(r)})
+			i++
+		default:
+			return nil, validationError("invalid character %q in expression %q", r, expr)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// keyword reports whether the next token is the given keyword, consuming it
+// if so
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == 'i' && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) punct(text string) bool {
+	t := p.peek()
+	if t.kind == 'p' && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.punct(text) {
+		return validationError("expected %q but found %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) parsePath() (docPath, error) {
+	var path docPath
+	for {
+		t := p.next()
+		switch t.kind {
+		case 'i':
+			path = append(path, pathElem{name: t.text})
+		case '#':
+			name, ok := p.names[t.text]
+			if !ok {
+				return nil, validationError("undefined attribute name %s", t.text)
+			}
+			path = append(path, pathElem{name: name})
+		default:
+			return nil, validationError("expected attribute name but found %q", t.text)
+		}
+
+		for p.punct("[") {
+			t := p.next()
+			index, err := strconv.Atoi(t.text)
+			if t.kind != 'n' || err != nil {
+				return nil, validationError("invalid list index %q", t.text)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, pathElem{index: index, isIndex: true})
+		}
+
+		if !p.punct(".") {
+			return path, nil
+		}
+	}
+}
+
+// parseOperand parses a path, placeholder value or function call
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	switch t.kind {
+	case ':':
+		p.pos++
+		value, ok := p.values[t.text]
+		if !ok {
+			return nil, validationError("undefined attribute value %s", t.text)
+		}
+		return valueOperand{value: value}, nil
+	case 'i':
+		if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "(" {
+			return p.parseFunctionOperand()
+		}
+	}
+
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return pathOperand{path: path}, nil
+}
+
+func (p *parser) parseFunctionOperand() (operand, error) {
+	name := p.next().text
+	p.next() // (
+
+	switch strings.ToLower(name) {
+	case "size":
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return sizeOperand{path: path}, p.expect(")")
+	case "if_not_exists":
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		fallback, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return ifNotExists{path: path, fallback: fallback}, p.expect(")")
+	case "list_append":
+		a, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		b, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return listAppend{a: a, b: b}, p.expect(")")
+	}
+	return nil, validationError("unsupported function %s", name)
+}
+
+// parseCondition parses a whole condition expression
+func parseCondition(expr string, names map[string]string, values map[string]types.AttributeValue) (condition, error) {
+	p, err := newParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, validationError("unexpected %q in expression %q", p.peek().text, expr)
+	}
+	return c, nil
+}
+
+func (p *parser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.keyword("NOT") {
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return negation{c: c}, nil
+	}
+	return p.parsePrimary()
+}
+
+var conditionFunctions = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	if p.punct("(") {
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+
+	t := p.peek()
+	if arity, ok := conditionFunctions[strings.ToLower(t.text)]; ok && t.kind == 'i' {
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		fn := function{name: strings.ToLower(t.text)}
+		for i := 0; i < arity; i++ {
+			if i > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			fn.args = append(fn.args, arg)
+		}
+		return fn, p.expect(")")
+	}
+
+	a, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.keyword("BETWEEN") {
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, validationError("expected AND in BETWEEN")
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return between{a: a, low: low, high: high}, nil
+	}
+
+	if p.keyword("IN") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		in := inList{a: a}
+		for {
+			item, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, item)
+			if !p.punct(",") {
+				break
+			}
+		}
+		return in, p.expect(")")
+	}
+
+	op := p.next()
+	switch op.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		return nil, validationError("expected comparator but found %q", op.text)
+	}
+	b, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return comparison{op: op.text, a: a, b: b}, nil
+}
+
+// parseUpdate parses an update expression
+func parseUpdate(expr string, names map[string]string, values map[string]types.AttributeValue) (*update, error) {
+	p, err := newParser(expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &update{}
+	for !p.done() {
+		switch {
+		case p.keyword("SET"):
+			for {
+				path, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				value, err := p.parseSetValue()
+				if err != nil {
+					return nil, err
+				}
+				u.set = append(u.set, setAction{path: path, value: value})
+				if !p.punct(",") {
+					break
+				}
+			}
+		case p.keyword("REMOVE"):
+			for {
+				path, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				u.remove = append(u.remove, path)
+				if !p.punct(",") {
+					break
+				}
+			}
+		case p.keyword("ADD"), p.keyword("DELETE"):
+			isAdd := strings.EqualFold(p.tokens[p.pos-1].text, "ADD")
+			for {
+				path, err := p.parsePath()
+				if err != nil {
+					return nil, err
+				}
+				value, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				action := setAction{path: path, value: value}
+				if isAdd {
+					u.add = append(u.add, action)
+				} else {
+					u.delete = append(u.delete, action)
+				}
+				if !p.punct(",") {
+					break
+				}
+			}
+		default:
+			return nil, validationError("unexpected %q in update expression %q", p.peek().text, expr)
+		}
+	}
+	return u, nil
+}
+
+func (p *parser) parseSetValue() (operand, error) {
+	a, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != 'p' || (t.text != "+" && t.text != "-") {
+			return a, nil
+		}
+		p.pos++
+		b, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		a = arithmetic{op: t.text[0], a: a, b: b}
+	}
+}
+
+// parseProjection parses a comma-separated list of paths
+func parseProjection(expr string, names map[string]string) ([]docPath, error) {
+	p, err := newParser(expr, names, nil)
+	if err != nil {
+		return nil, err
+	}
+	var paths []docPath
+	for {
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !p.punct(",") {
+			break
+		}
+	}
+	if !p.done() {
+		return nil, validationError("unexpected %q in projection %q", p.peek().text, expr)
+	}
+	return paths, nil
+}
@@ -0,0 +1,396 @@
+// pkg/local/expression_test.go
+
+package local
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func s(v string) types.AttributeValue                  { return &types.AttributeValueMemberS{Value: v} }
+func n(v string) types.AttributeValue                  { return &types.AttributeValueMemberN{Value: v} }
+func ss(v ...string) types.AttributeValue              { return &types.AttributeValueMemberSS{Value: v} }
+func ns(v ...string) types.AttributeValue              { return &types.AttributeValueMemberNS{Value: v} }
+func l(v ...types.AttributeValue) types.AttributeValue { return &types.AttributeValueMemberL{Value: v} }
+
+func m(v map[string]types.AttributeValue) types.AttributeValue {
+	return &types.AttributeValueMemberM{Value: v}
+}
+
+func TestEvalCondition(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"ScanID":          s("scan-1"),
+		"Status":          s("running"),
+		"ReportedBatches": ns("0", "2"),
+		"Tags":            ss("prod", "web"),
+		"LastScanned":     s("2024-05-01T00:00:00Z"),
+		"PortsScanned":    n("200"),
+		"Batches":         m(map[string]types.AttributeValue{"0": n("1")}),
+		"OpenPorts":       l(n("22"), n("80")),
+		"IsFinalSummary":  &types.AttributeValueMemberBOOL{Value: true},
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		names   map[string]string
+		values  map[string]types.AttributeValue
+		want    bool
+		wantErr bool
+	}{
+		{name: "attribute_exists", expr: "attribute_exists(ScanID)", want: true},
+		{name: "attribute_exists missing", expr: "attribute_exists(Missing)", want: false},
+		{name: "attribute_not_exists", expr: "attribute_not_exists(#m)", names: map[string]string{"#m": "Missing"}, want: true},
+		{name: "attribute_exists nested", expr: "attribute_exists(Batches.#k)", names: map[string]string{"#k": "0"}, want: true},
+		{name: "attribute_exists nested missing", expr: "attribute_exists(Batches.#k)", names: map[string]string{"#k": "1"}, want: false},
+		{name: "contains number set", expr: "contains(ReportedBatches, :b)", values: map[string]types.AttributeValue{":b": n("2")}, want: true},
+		{name: "contains number set canonical", expr: "contains(ReportedBatches, :b)", values: map[string]types.AttributeValue{":b": n("2.0")}, want: true},
+		{name: "NOT contains number set", expr: "attribute_exists(ScanID) AND NOT contains(ReportedBatches, :b)", values: map[string]types.AttributeValue{":b": n("1")}, want: true},
+		{name: "contains string set", expr: "contains(Tags, :t)", values: map[string]types.AttributeValue{":t": s("web")}, want: true},
+		{name: "contains substring", expr: "contains(ScanID, :t)", values: map[string]types.AttributeValue{":t": s("an-")}, want: true},
+		{name: "contains list", expr: "contains(OpenPorts, :p)", values: map[string]types.AttributeValue{":p": n("443")}, want: false},
+		{name: "begins_with", expr: "begins_with(ScanID, :p)", values: map[string]types.AttributeValue{":p": s("scan-")}, want: true},
+		{name: "IN", expr: "#status IN (:queued, :running)", names: map[string]string{"#status": "Status"},
+			values: map[string]types.AttributeValue{":queued": s("queued"), ":running": s("running")}, want: true},
+		{name: "IN miss", expr: "#status IN (:queued)", names: map[string]string{"#status": "Status"},
+			values: map[string]types.AttributeValue{":queued": s("queued")}, want: false},
+		{name: "BETWEEN", expr: "LastScanned BETWEEN :since AND :before",
+			values: map[string]types.AttributeValue{":since": s("2024-04-01T00:00:00Z"), ":before": s("2024-06-01T00:00:00Z")}, want: true},
+		{name: "BETWEEN outside", expr: "LastScanned BETWEEN :since AND :before",
+			values: map[string]types.AttributeValue{":since": s("2024-05-02T00:00:00Z"), ":before": s("2024-06-01T00:00:00Z")}, want: false},
+		{name: "numbers compare by value", expr: "PortsScanned > :n", values: map[string]types.AttributeValue{":n": n("99")}, want: true},
+		{name: "mismatched types never order", expr: "PortsScanned > :n", values: map[string]types.AttributeValue{":n": s("1")}, want: false},
+		{name: "<> on missing attribute", expr: "Missing <> :n", values: map[string]types.AttributeValue{":n": n("1")}, want: false},
+		{name: "size", expr: "size(OpenPorts) = :two", values: map[string]types.AttributeValue{":two": n("2")}, want: true},
+		{name: "list index", expr: "OpenPorts[1] = :p", values: map[string]types.AttributeValue{":p": n("80")}, want: true},
+		{name: "AND binds tighter than OR", expr: "IsFinalSummary = :final AND (attribute_not_exists(ScanStatus) OR ScanStatus = :completed)",
+			values: map[string]types.AttributeValue{":final": &types.AttributeValueMemberBOOL{Value: true}, ":completed": s("completed")}, want: true},
+		{name: "OR", expr: "attribute_exists(Missing) OR attribute_exists(ScanID)", want: true},
+		{name: "undefined value", expr: "ScanID = :missing", wantErr: true},
+		{name: "undefined name", expr: "#missing = :v", values: map[string]types.AttributeValue{":v": s("x")}, wantErr: true},
+		{name: "trailing tokens", expr: "attribute_exists(ScanID) ScanID", wantErr: true},
+		{name: "unknown comparator", expr: "ScanID ! :v", values: map[string]types.AttributeValue{":v": s("x")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseCondition(tt.expr, tt.names, tt.values)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCondition(%q) succeeded, want error", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCondition(%q) error: %v", tt.expr, err)
+			}
+			got, err := evalCondition(item, c)
+			if err != nil {
+				t.Fatalf("evalCondition(%q) error: %v", tt.expr, err)
+			}
+			if got != tt.want {
+				t.Errorf("evalCondition(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    map[string]types.AttributeValue
+		expr    string
+		names   map[string]string
+		values  map[string]types.AttributeValue
+		want    map[string]types.AttributeValue
+		wantErr bool
+	}{
+		{
+			name:   "ADD creates a counter",
+			item:   map[string]types.AttributeValue{},
+			expr:   "ADD PortsScanned :ports",
+			values: map[string]types.AttributeValue{":ports": n("100")},
+			want:   map[string]types.AttributeValue{"PortsScanned": n("100")},
+		},
+		{
+			name:   "ADD to a counter",
+			item:   map[string]types.AttributeValue{"PortsScanned": n("100")},
+			expr:   "ADD PortsScanned :ports",
+			values: map[string]types.AttributeValue{":ports": n("0.5")},
+			want:   map[string]types.AttributeValue{"PortsScanned": n("100.5")},
+		},
+		{
+			name:   "ADD to a number set",
+			item:   map[string]types.AttributeValue{"ReportedBatches": ns("0")},
+			expr:   "ADD ReportedBatches :batch",
+			values: map[string]types.AttributeValue{":batch": ns("1", "0.0")},
+			want:   map[string]types.AttributeValue{"ReportedBatches": ns("0", "1")},
+		},
+		{
+			name:   "ADD to a string set",
+			item:   map[string]types.AttributeValue{"Tags": ss("a")},
+			expr:   "ADD Tags :t",
+			values: map[string]types.AttributeValue{":t": ss("b", "a")},
+			want:   map[string]types.AttributeValue{"Tags": ss("a", "b")},
+		},
+		{
+			name:    "ADD set to a number",
+			item:    map[string]types.AttributeValue{"PortsScanned": n("1")},
+			expr:    "ADD PortsScanned :t",
+			values:  map[string]types.AttributeValue{":t": ss("a")},
+			wantErr: true,
+		},
+		{
+			name:   "DELETE from a set",
+			item:   map[string]types.AttributeValue{"Tags": ss("a", "b", "c")},
+			expr:   "DELETE Tags :t",
+			values: map[string]types.AttributeValue{":t": ss("b", "z")},
+			want:   map[string]types.AttributeValue{"Tags": ss("a", "c")},
+		},
+		{
+			name:   "DELETE the last members removes the set",
+			item:   map[string]types.AttributeValue{"ReportedBatches": ns("1"), "ScanID": s("scan-1")},
+			expr:   "DELETE ReportedBatches :b",
+			values: map[string]types.AttributeValue{":b": ns("1.00")},
+			want:   map[string]types.AttributeValue{"ScanID": s("scan-1")},
+		},
+		{
+			name:   "DELETE from a missing set",
+			item:   map[string]types.AttributeValue{},
+			expr:   "DELETE Tags :t",
+			values: map[string]types.AttributeValue{":t": ss("a")},
+			want:   map[string]types.AttributeValue{},
+		},
+		{
+			name:   "if_not_exists keeps the current value",
+			item:   map[string]types.AttributeValue{"FirstSeen": s("2024-01-01")},
+			expr:   "SET #firstSeen = if_not_exists(#firstSeen, :firstSeen), LastSeen = :firstSeen",
+			names:  map[string]string{"#firstSeen": "FirstSeen"},
+			values: map[string]types.AttributeValue{":firstSeen": s("2024-05-01")},
+			want:   map[string]types.AttributeValue{"FirstSeen": s("2024-01-01"), "LastSeen": s("2024-05-01")},
+		},
+		{
+			name:   "if_not_exists sets a missing value",
+			item:   map[string]types.AttributeValue{},
+			expr:   "SET #firstSeen = if_not_exists(#firstSeen, :firstSeen)",
+			names:  map[string]string{"#firstSeen": "FirstSeen"},
+			values: map[string]types.AttributeValue{":firstSeen": s("2024-05-01")},
+			want:   map[string]types.AttributeValue{"FirstSeen": s("2024-05-01")},
+		},
+		{
+			name:   "SET a nested map member",
+			item:   map[string]types.AttributeValue{"Batches": m(map[string]types.AttributeValue{"0": n("1")})},
+			expr:   "SET Batches.#k = :v",
+			names:  map[string]string{"#k": "3"},
+			values: map[string]types.AttributeValue{":v": n("7")},
+			want:   map[string]types.AttributeValue{"Batches": m(map[string]types.AttributeValue{"0": n("1"), "3": n("7")})},
+		},
+		{
+			name:    "SET a nested member of a missing map",
+			item:    map[string]types.AttributeValue{},
+			expr:    "SET Batches.#k = :v",
+			names:   map[string]string{"#k": "3"},
+			values:  map[string]types.AttributeValue{":v": n("7")},
+			wantErr: true,
+		},
+		{
+			name: "SET from the old values",
+			item: map[string]types.AttributeValue{"A": n("1"), "B": n("2")},
+			expr: "SET A = B, B = A",
+			want: map[string]types.AttributeValue{"A": n("2"), "B": n("1")},
+		},
+		{
+			name:   "SET arithmetic",
+			item:   map[string]types.AttributeValue{"Count": n("10")},
+			expr:   "SET #count = #count - :one + :one + :one",
+			names:  map[string]string{"#count": "Count"},
+			values: map[string]types.AttributeValue{":one": n("1")},
+			want:   map[string]types.AttributeValue{"Count": n("11")},
+		},
+		{
+			name:   "SET list_append",
+			item:   map[string]types.AttributeValue{"History": l(s("a"))},
+			expr:   "SET History = list_append(History, :new)",
+			values: map[string]types.AttributeValue{":new": l(s("b"))},
+			want:   map[string]types.AttributeValue{"History": l(s("a"), s("b"))},
+		},
+		{
+			name:    "SET from a missing attribute",
+			item:    map[string]types.AttributeValue{},
+			expr:    "SET A = B",
+			wantErr: true,
+		},
+		{
+			name: "REMOVE attributes and list elements",
+			item: map[string]types.AttributeValue{"Owner": s("ops"), "Ports": l(n("22"), n("80"), n("443")), "Keep": s("x")},
+			expr: "REMOVE Owner, Ports[1], Missing",
+			want: map[string]types.AttributeValue{"Ports": l(n("22"), n("443")), "Keep": s("x")},
+		},
+		{
+			name:   "ADD then SET in one expression",
+			item:   map[string]types.AttributeValue{"ReportedBatches": ns("0")},
+			expr:   "ADD ReportedBatches :batch, PortsScanned :ports SET #status = :running",
+			names:  map[string]string{"#status": "Status"},
+			values: map[string]types.AttributeValue{":batch": ns("1"), ":ports": n("100"), ":running": s("running")},
+			want: map[string]types.AttributeValue{
+				"ReportedBatches": ns("0", "1"),
+				"PortsScanned":    n("100"),
+				"Status":          s("running"),
+			},
+		},
+		{
+			name:    "unknown clause",
+			item:    map[string]types.AttributeValue{},
+			expr:    "PUT A = :v",
+			values:  map[string]types.AttributeValue{":v": n("1")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := parseUpdate(tt.expr, tt.names, tt.values)
+			if err == nil {
+				err = applyUpdate(tt.item, u)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("%q = %v, want error", tt.expr, tt.item)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%q error: %v", tt.expr, err)
+			}
+			if len(tt.item) != len(tt.want) {
+				t.Fatalf("%q = %v, want %v", tt.expr, tt.item, tt.want)
+			}
+			for name, want := range tt.want {
+				if got, ok := tt.item[name]; !ok || !equalValues(got, want) {
+					t.Errorf("%q set %s = %v, want %v", tt.expr, name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProject(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"IPAddress": s("10.0.0.1"),
+		"Tags":      m(map[string]types.AttributeValue{"env": s("prod"), "team": s("ops")}),
+		"Ports":     l(n("22"), n("80")),
+	}
+	paths, err := parseProjection("IPAddress, Tags.#env", map[string]string{"#env": "env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := project(item, paths)
+	want := map[string]types.AttributeValue{
+		"IPAddress": s("10.0.0.1"),
+		"Tags":      m(map[string]types.AttributeValue{"env": s("prod")}),
+	}
+	if !equalValues(m(got), m(want)) {
+		t.Errorf("project = %v, want %v", got, want)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		a, b types.AttributeValue
+		cmp  int
+		ok   bool
+	}{
+		{a: n("10"), b: n("9"), cmp: 1, ok: true},
+		{a: n("1.50"), b: n("1.5"), cmp: 0, ok: true},
+		{a: n("-3"), b: n("2e1"), cmp: -1, ok: true},
+		{a: s("10"), b: s("9"), cmp: -1, ok: true},
+		{a: s("a"), b: n("1"), ok: false},
+		{a: ss("a"), b: ss("a"), ok: false},
+	}
+	for _, tt := range tests {
+		cmp, ok := compareValues(tt.a, tt.b)
+		if ok != tt.ok || (ok && cmp != tt.cmp) {
+			t.Errorf("compareValues(%v, %v) = %d, %v, want %d, %v", tt.a, tt.b, cmp, ok, tt.cmp, tt.ok)
+		}
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := map[string]string{
+		"1":       "1",
+		"1.0":     "1",
+		"001.250": "1.25",
+		"-0.5":    "-0.5",
+		"1e3":     "1000",
+		"bogus":   "bogus",
+	}
+	for input, want := range tests {
+		if got := canonicalNumber(input); got != want {
+			t.Errorf("canonicalNumber(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestEncodeItemRoundTrip(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"S":    s("text"),
+		"N":    n("1.5"),
+		"B":    &types.AttributeValueMemberB{Value: []byte{0, 1}},
+		"SS":   ss("a", "b"),
+		"NS":   ns("1", "2"),
+		"BS":   &types.AttributeValueMemberBS{Value: [][]byte{{1}, {2}}},
+		"M":    m(map[string]types.AttributeValue{"nested": l(s("x"), &types.AttributeValueMemberNULL{Value: true})}),
+		"BOOL": &types.AttributeValueMemberBOOL{Value: true},
+	}
+	data, err := encodeItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeItem(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := sortedNames(got); !reflect.DeepEqual(names, sortedNames(item)) {
+		t.Fatalf("decoded attributes %v, want %v", names, sortedNames(item))
+	}
+	for name, want := range item {
+		if !equalValues(got[name], want) {
+			t.Errorf("decoded %s = %v, want %v", name, got[name], want)
+		}
+	}
+}
+
+func TestKeyBytes(t *testing.T) {
+	key := func(item map[string]types.AttributeValue) string {
+		b, err := keyBytes(item, "IPAddress", "Port")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	// Equal numbers are one key, and the hash key groups its range keys
+	if key(map[string]types.AttributeValue{"IPAddress": s("a"), "Port": n("80")}) !=
+		key(map[string]types.AttributeValue{"IPAddress": s("a"), "Port": n("80.0")}) {
+		t.Error("80 and 80.0 encode to different keys")
+	}
+	keys := []string{
+		key(map[string]types.AttributeValue{"IPAddress": s("b"), "Port": n("1")}),
+		key(map[string]types.AttributeValue{"IPAddress": s("a"), "Port": n("2")}),
+		key(map[string]types.AttributeValue{"IPAddress": s("a"), "Port": n("1")}),
+	}
+	sort.Strings(keys)
+	if keys[2] != key(map[string]types.AttributeValue{"IPAddress": s("b"), "Port": n("1")}) {
+		t.Errorf("keys of one hash key do not sort together: %q", keys)
+	}
+
+	if _, err := keyBytes(map[string]types.AttributeValue{"IPAddress": s("a")}, "IPAddress", "Port"); err == nil {
+		t.Error("keyBytes accepted an item without its range key")
+	}
+	if _, err := keyBytes(map[string]types.AttributeValue{"IPAddress": ss("a")}, "IPAddress"); err == nil {
+		t.Error("keyBytes accepted a set as a key")
+	}
+}
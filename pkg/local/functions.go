@@ -0,0 +1,77 @@
+// pkg/local/functions.go
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	lambdaService "github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// Functions is an in-process stand-in for Lambda invocation. Functions are
+// registered by the names the handlers invoke them by.
+type Functions struct {
+	mu       sync.RWMutex
+	handlers map[string]lambda.Handler
+	wg       sync.WaitGroup
+}
+
+// NewFunctions creates an empty function registry
+func NewFunctions() *Functions {
+	return &Functions{handlers: make(map[string]lambda.Handler)}
+}
+
+// Register makes handler invocable as name. handler takes the same
+// signatures lambda.Start accepts.
+func (f *Functions) Register(name string, handler interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[name] = lambda.NewHandler(handler)
+}
+
+// Invoke implements the Lambda Invoke call. Event invocations run in the
+// background and return immediately, like asynchronous Lambda invocations.
+func (f *Functions) Invoke(ctx context.Context, params *lambdaService.InvokeInput, optFns ...func(*lambdaService.Options)) (*lambdaService.InvokeOutput, error) {
+	name := aws.ToString(params.FunctionName)
+
+	f.mu.RLock()
+	handler, ok := f.handlers[name]
+	f.mu.RUnlock()
+	if !ok {
+		return nil, &lambdaTypes.ResourceNotFoundException{Message: aws.String("Function not found: " + name)}
+	}
+
+	if params.InvocationType == lambdaTypes.InvocationTypeEvent {
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			if _, err := handler.Invoke(context.Background(), params.Payload); err != nil {
+				log.Printf("Error in asynchronous invocation of %s: %v", name, err)
+			}
+		}()
+		return &lambdaService.InvokeOutput{StatusCode: 202}, nil
+	}
+
+	payload, err := handler.Invoke(ctx, params.Payload)
+	if err != nil {
+		errorPayload, _ := json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": fmt.Sprintf("%T", err)})
+		return &lambdaService.InvokeOutput{
+			StatusCode:    200,
+			FunctionError: aws.String("Unhandled"),
+			Payload:       errorPayload,
+		}, nil
+	}
+	return &lambdaService.InvokeOutput{StatusCode: 200, Payload: payload}, nil
+}
+
+// Wait blocks until every asynchronous invocation has finished
+func (f *Functions) Wait() {
+	f.wg.Wait()
+}
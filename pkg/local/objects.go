@@ -0,0 +1,129 @@
+// pkg/local/objects.go
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Objects is a stand-in for the exports bucket. Files are kept in a
+// directory and downloaded through ServeHTTP, mounted by nexusscan serve
+// under the base URL links point at. Keys are unguessable, so like
+// presigned S3 links the downloads need no token.
+type Objects struct {
+	dir     string
+	baseURL string
+}
+
+// NewObjects keeps objects in dir, creating it if needed, with links under
+// baseURL
+func NewObjects(dir string, baseURL string) (*Objects, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Objects{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put writes an object to a temporary file and renames it into place, so
+// downloads never see it half written
+func (o *Objects) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path, err := o.path(key)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(o.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	written, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("object %s is %d bytes, expected %d", key, written, size)
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// URL returns the link to an object. Links do not expire; objects are
+// removed by Purge instead.
+func (o *Objects) URL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if _, err := o.path(key); err != nil {
+		return "", err
+	}
+	return o.baseURL + "/" + url.PathEscape(key), nil
+}
+
+// ServeHTTP downloads the object named by the last element of the path.
+// Nothing is listed, so only holders of a link can fetch an object.
+func (o *Objects) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path, err := o.path(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", info.Name()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// Purge removes objects older than age, as the bucket's lifecycle rule
+// does, and returns how many were removed
+func (o *Objects) Purge(age time.Duration) (int, error) {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-age)
+	purged := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(o.dir, entry.Name())); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// path returns the file of an object. Keys are single file names.
+func (o *Objects) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(o.dir, key), nil
+}
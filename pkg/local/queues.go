@@ -0,0 +1,230 @@
+// pkg/local/queues.go
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/uuid"
+)
+
+// Consumer describes how messages sent to a queue are delivered, mirroring
+// the SQS event source mappings in template.yaml
+type Consumer struct {
+	// Handler is the function messages are delivered to. It takes an
+	// events.SQSEvent, like the Lambda it stands in for, and may return an
+	// events.SQSEventResponse to have only some messages delivered again.
+	Handler interface{}
+	// BatchSize is the most messages delivered in one event
+	BatchSize int
+	// Concurrency is how many batches are handled at once
+	Concurrency int
+	// MaxReceives is how many times a batch is delivered before it is
+	// dropped, like a dead-letter queue's maxReceiveCount. Zero retries
+	// forever.
+	MaxReceives int
+}
+
+// Queues is an in-memory stand-in for SQS. Messages are held only while the
+// process runs; scans interrupted by a restart are finalised by the stale
+// scan sweep.
+type Queues struct {
+	mu     sync.Mutex
+	queues map[string]*queue
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type queue struct {
+	url      string
+	consumer Consumer
+	handler  lambda.Handler
+
+	mu      sync.Mutex
+	pending []events.SQSMessage
+	ready   chan struct{}
+}
+
+// NewQueues creates an empty set of queues
+func NewQueues() *Queues {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queues{queues: make(map[string]*queue), ctx: ctx, cancel: cancel}
+}
+
+// Consume creates the queue at url and starts delivering its messages to
+// the consumer
+func (q *Queues) Consume(url string, consumer Consumer) {
+	if consumer.BatchSize <= 0 {
+		consumer.BatchSize = 1
+	}
+	if consumer.Concurrency <= 0 {
+		consumer.Concurrency = 1
+	}
+
+	qu := &queue{
+		url:      url,
+		consumer: consumer,
+		handler:  lambda.NewHandler(consumer.Handler),
+		ready:    make(chan struct{}, 1),
+	}
+
+	q.mu.Lock()
+	q.queues[url] = qu
+	q.mu.Unlock()
+
+	for i := 0; i < consumer.Concurrency; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			qu.poll(q.ctx)
+		}()
+	}
+}
+
+// SendMessage implements the SQS SendMessage call
+func (q *Queues) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	url := aws.ToString(params.QueueUrl)
+
+	q.mu.Lock()
+	qu, ok := q.queues[url]
+	q.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("queue %q does not exist", url)
+	}
+
+	id := uuid.New().String()
+	qu.push(events.SQSMessage{
+		MessageId:      id,
+		Body:           aws.ToString(params.MessageBody),
+		EventSource:    "aws:sqs",
+		EventSourceARN: url,
+		Attributes:     map[string]string{"ApproximateReceiveCount": "1"},
+	})
+	return &sqs.SendMessageOutput{MessageId: aws.String(id)}, nil
+}
+
+// Close stops delivery and waits for batches being handled to finish.
+// Messages still queued are dropped.
+func (q *Queues) Close() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+func (qu *queue) push(messages ...events.SQSMessage) {
+	qu.mu.Lock()
+	qu.pending = append(qu.pending, messages...)
+	qu.mu.Unlock()
+
+	select {
+	case qu.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take removes up to one batch of messages from the queue
+func (qu *queue) take() []events.SQSMessage {
+	qu.mu.Lock()
+	defer qu.mu.Unlock()
+
+	n := len(qu.pending)
+	if n > qu.consumer.BatchSize {
+		n = qu.consumer.BatchSize
+	}
+	batch := append([]events.SQSMessage{}, qu.pending[:n]...)
+	qu.pending = qu.pending[n:]
+
+	if len(qu.pending) > 0 {
+		// Wake another poller for the rest
+		select {
+		case qu.ready <- struct{}{}:
+		default:
+		}
+	}
+	return batch
+}
+
+func (qu *queue) poll(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-qu.ready:
+		}
+
+		for {
+			batch := qu.take()
+			if len(batch) == 0 {
+				break
+			}
+			qu.deliver(ctx, batch)
+		}
+	}
+}
+
+// deliver hands a batch to the consumer, retrying failed batches with
+// backoff until MaxReceives is reached. A handler that reports batch item
+// failures has only those messages retried.
+func (qu *queue) deliver(ctx context.Context, batch []events.SQSMessage) {
+	for receive := 1; ; receive++ {
+		for i := range batch {
+			batch[i].Attributes["ApproximateReceiveCount"] = fmt.Sprint(receive)
+		}
+
+		payload, err := json.Marshal(events.SQSEvent{Records: batch})
+		if err != nil {
+			log.Printf("Error encoding messages for %s: %v", qu.url, err)
+			return
+		}
+
+		output, err := qu.handler.Invoke(ctx, payload)
+		if err == nil {
+			if batch = failedMessages(batch, output); len(batch) == 0 {
+				return
+			}
+			err = fmt.Errorf("%d messages failed", len(batch))
+		}
+
+		if qu.consumer.MaxReceives > 0 && receive >= qu.consumer.MaxReceives {
+			log.Printf("Dropping %d messages from %s after %d attempts: %v", len(batch), qu.url, receive, err)
+			return
+		}
+
+		log.Printf("Error handling messages from %s (attempt %d), retrying: %v", qu.url, receive, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(receive) * 5 * time.Second):
+		}
+	}
+}
+
+// failedMessages returns the messages of a batch that a handler's
+// events.SQSEventResponse reported as failed
+func failedMessages(batch []events.SQSMessage, output []byte) []events.SQSMessage {
+	var response events.SQSEventResponse
+	if err := json.Unmarshal(output, &response); err != nil || len(response.BatchItemFailures) == 0 {
+		return nil
+	}
+
+	failed := make(map[string]bool, len(response.BatchItemFailures))
+	for _, failure := range response.BatchItemFailures {
+		failed[failure.ItemIdentifier] = true
+	}
+	var retry []events.SQSMessage
+	for _, message := range batch {
+		if failed[message.MessageId] {
+			retry = append(retry, message)
+		}
+	}
+	return retry
+}
@@ -0,0 +1,81 @@
+// pkg/local/queues_test.go
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// TestBatchItemFailures checks that only the messages a handler reports as
+// failed are delivered again
+func TestBatchItemFailures(t *testing.T) {
+	var mu sync.Mutex
+	deliveries := map[string]int{}
+	done := make(chan struct{})
+
+	queues := NewQueues()
+	defer queues.Close()
+	queues.Consume("results", Consumer{
+		Handler: func(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			var response events.SQSEventResponse
+			for _, message := range event.Records {
+				deliveries[message.Body]++
+				// "flaky" fails on its first delivery only
+				if message.Body == "flaky" && deliveries[message.Body] == 1 {
+					response.BatchItemFailures = append(response.BatchItemFailures,
+						events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+				}
+				if message.Body == "flaky" && deliveries[message.Body] == 2 {
+					close(done)
+				}
+			}
+			return response, nil
+		},
+		BatchSize:   10,
+		MaxReceives: 3,
+	})
+
+	for _, body := range []string{"ok", "flaky"} {
+		if _, err := queues.SendMessage(context.Background(), &sqs.SendMessageInput{
+			QueueUrl:    aws.String("results"),
+			MessageBody: aws.String(body),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatal("failed message was not delivered again")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if deliveries["ok"] != 1 {
+		t.Errorf("ok was delivered %d times, want 1", deliveries["ok"])
+	}
+}
+
+func TestFailedMessages(t *testing.T) {
+	batch := []events.SQSMessage{{MessageId: "a"}, {MessageId: "b"}, {MessageId: "c"}}
+
+	output, _ := json.Marshal(events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{{ItemIdentifier: "b"}}})
+	if failed := failedMessages(batch, output); len(failed) != 1 || failed[0].MessageId != "b" {
+		t.Errorf("failedMessages = %+v, want only b", failed)
+	}
+	if failed := failedMessages(batch, []byte("null")); len(failed) != 0 {
+		t.Errorf("failedMessages of a handler without a response = %+v, want none", failed)
+	}
+}
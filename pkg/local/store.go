@@ -0,0 +1,643 @@
+// pkg/local/store.go
+
+// Package local runs NexusScan without AWS: an embedded store that speaks
+// the subset of the DynamoDB API the database client uses, in-process queues
+// and in-process function invocation.
+package local
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store is a DynamoDB stand-in backed by a single bbolt file. Each table is
+// a bucket of JSON-encoded items keyed by their primary key; indexes are
+// evaluated by scanning the table, which is fine at the scale of one
+// machine's inventory.
+type Store struct {
+	db     *bolt.DB
+	tables map[string]tableSchema
+}
+
+// OpenStore opens or creates the store at path, holding the given tables
+func OpenStore(path string, tableNames database.Tables) (*Store, error) {
+	tables := schemas(tableNames)
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for name := range tables {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db, tables: tables}, nil
+}
+
+// Close closes the store
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) lookupTable(name *string) (tableSchema, []byte, error) {
+	table, ok := s.tables[aws.ToString(name)]
+	if !ok {
+		return tableSchema{}, nil, &types.ResourceNotFoundException{
+			Message: aws.String("Requested resource not found: Table: " + aws.ToString(name) + " not found"),
+		}
+	}
+	return table, []byte(aws.ToString(name)), nil
+}
+
+func conditionFailed() error {
+	return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+}
+
+// expired reports whether TTL has removed an item. DynamoDB deletes expired
+// items lazily, but never returns them once they are gone; here they are
+// hidden from the moment they expire.
+func expired(table tableSchema, item map[string]types.AttributeValue, now time.Time) bool {
+	if !table.ttl {
+		return false
+	}
+	n, ok := item[ttlAttribute].(*types.AttributeValueMemberN)
+	if !ok {
+		return false
+	}
+	at, err := strconv.ParseInt(n.Value, 10, 64)
+	return err == nil && at < now.Unix()
+}
+
+// primaryKey encodes the primary key of an item
+func (t tableSchema) primaryKey(item map[string]types.AttributeValue) ([]byte, error) {
+	return keyBytes(item, t.hashKey, t.rangeKey)
+}
+
+// keyOf returns just the primary key attributes of an item
+func (t tableSchema) keyOf(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{t.hashKey: item[t.hashKey]}
+	if t.rangeKey != "" {
+		key[t.rangeKey] = item[t.rangeKey]
+	}
+	return key
+}
+
+// load reads the live item with the given key, or nil
+func load(bucket *bolt.Bucket, table tableSchema, key []byte) (map[string]types.AttributeValue, error) {
+	data := bucket.Get(key)
+	if data == nil {
+		return nil, nil
+	}
+	item, err := decodeItem(data)
+	if err != nil {
+		return nil, err
+	}
+	if expired(table, item, time.Now()) {
+		return nil, nil
+	}
+	return item, nil
+}
+
+func store(bucket *bolt.Bucket, key []byte, item map[string]types.AttributeValue) error {
+	data, err := encodeItem(item)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// checkCondition evaluates a condition expression against the current item,
+// which is empty when the item does not exist
+func checkCondition(expr *string, names map[string]string, values map[string]types.AttributeValue, item map[string]types.AttributeValue) error {
+	if aws.ToString(expr) == "" {
+		return nil
+	}
+	c, err := parseCondition(*expr, names, values)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		item = map[string]types.AttributeValue{}
+	}
+	matched, err := evalCondition(item, c)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return conditionFailed()
+	}
+	return nil
+}
+
+// GetItem implements the DynamoDB GetItem call
+func (s *Store) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	table, name, err := s.lookupTable(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := table.primaryKey(params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var projection []docPath
+	if aws.ToString(params.ProjectionExpression) != "" {
+		if projection, err = parseProjection(*params.ProjectionExpression, params.ExpressionAttributeNames); err != nil {
+			return nil, err
+		}
+	}
+
+	var item map[string]types.AttributeValue
+	err = s.db.View(func(tx *bolt.Tx) error {
+		item, err = load(tx.Bucket(name), table, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if item == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: project(item, projection)}, nil
+}
+
+// PutItem implements the DynamoDB PutItem call
+func (s *Store) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	table, name, err := s.lookupTable(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := table.primaryKey(params.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	var old map[string]types.AttributeValue
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(name)
+		if old, err = load(bucket, table, key); err != nil {
+			return err
+		}
+		if err := checkCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, old); err != nil {
+			return err
+		}
+		return store(bucket, key, params.Item)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.PutItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllOld {
+		output.Attributes = old
+	}
+	return output, nil
+}
+
+// UpdateItem implements the DynamoDB UpdateItem call. Updating an item that
+// does not exist creates it, as in DynamoDB.
+func (s *Store) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	table, name, err := s.lookupTable(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := table.primaryKey(params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var u *update
+	if aws.ToString(params.UpdateExpression) != "" {
+		if u, err = parseUpdate(*params.UpdateExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues); err != nil {
+			return nil, err
+		}
+	}
+
+	var old, updated map[string]types.AttributeValue
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(name)
+		if old, err = load(bucket, table, key); err != nil {
+			return err
+		}
+		if err := checkCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, old); err != nil {
+			return err
+		}
+
+		if old != nil {
+			updated = copyItem(old)
+		} else {
+			updated = copyItem(params.Key)
+		}
+		if u != nil {
+			if err := applyUpdate(updated, u); err != nil {
+				return err
+			}
+		}
+		for attr := range params.Key {
+			if !equalValues(updated[attr], params.Key[attr]) {
+				return validationError("cannot update key attribute %s", attr)
+			}
+		}
+		return store(bucket, key, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.UpdateItemOutput{}
+	switch params.ReturnValues {
+	case types.ReturnValueAllNew:
+		output.Attributes = updated
+	case types.ReturnValueAllOld:
+		output.Attributes = old
+	case types.ReturnValueUpdatedNew, types.ReturnValueUpdatedOld:
+		source := updated
+		if params.ReturnValues == types.ReturnValueUpdatedOld {
+			source = old
+		}
+		output.Attributes = changedAttributes(old, updated, source)
+	}
+	return output, nil
+}
+
+// changedAttributes returns the attributes of source that differ between
+// before and after
+func changedAttributes(before, after, source map[string]types.AttributeValue) map[string]types.AttributeValue {
+	changed := make(map[string]types.AttributeValue)
+	for name, value := range source {
+		a, inBefore := before[name]
+		b, inAfter := after[name]
+		if inBefore != inAfter || !equalValues(a, b) {
+			changed[name] = value
+		}
+	}
+	return changed
+}
+
+// DeleteItem implements the DynamoDB DeleteItem call
+func (s *Store) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	table, name, err := s.lookupTable(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := table.primaryKey(params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var old map[string]types.AttributeValue
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(name)
+		if old, err = load(bucket, table, key); err != nil {
+			return err
+		}
+		if err := checkCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, old); err != nil {
+			return err
+		}
+		return bucket.Delete(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.DeleteItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllOld {
+		output.Attributes = old
+	}
+	return output, nil
+}
+
+// BatchWriteItem implements the DynamoDB BatchWriteItem call. Every request
+// is applied; none are returned as unprocessed.
+func (s *Store) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for tableName, requests := range params.RequestItems {
+			table, name, err := s.lookupTable(aws.String(tableName))
+			if err != nil {
+				return err
+			}
+			bucket := tx.Bucket(name)
+
+			for _, request := range requests {
+				switch {
+				case request.PutRequest != nil:
+					key, err := table.primaryKey(request.PutRequest.Item)
+					if err != nil {
+						return err
+					}
+					if err := store(bucket, key, request.PutRequest.Item); err != nil {
+						return err
+					}
+				case request.DeleteRequest != nil:
+					key, err := table.primaryKey(request.DeleteRequest.Key)
+					if err != nil {
+						return err
+					}
+					if err := bucket.Delete(key); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}, nil
+}
+
+// candidate is an item together with its primary key bytes
+type candidate struct {
+	key  []byte
+	item map[string]types.AttributeValue
+}
+
+// allItems returns the live items of a table in primary key order
+func (s *Store) allItems(table tableSchema, name []byte) ([]candidate, error) {
+	var items []candidate
+	now := time.Now()
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(name).ForEach(func(k, v []byte) error {
+			item, err := decodeItem(v)
+			if err != nil {
+				return err
+			}
+			if !expired(table, item, now) {
+				items = append(items, candidate{key: append([]byte{}, k...), item: item})
+			}
+			return nil
+		})
+	})
+	return items, err
+}
+
+// Query implements the DynamoDB Query call on a table or one of its indexes
+func (s *Store) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	table, name, err := s.lookupTable(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	hashKey, rangeKey := table.hashKey, table.rangeKey
+	if indexName := aws.ToString(params.IndexName); indexName != "" {
+		index, ok := table.indexes[indexName]
+		if !ok {
+			return nil, validationError("the table does not have the specified index: %s", indexName)
+		}
+		hashKey, rangeKey = index.hashKey, index.rangeKey
+	}
+
+	keyCondition, err := parseCondition(aws.ToString(params.KeyConditionExpression), params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	filter, projection, err := parseReadExpressions(params.FilterExpression, params.ProjectionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.allItems(table, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []candidate
+	for _, c := range items {
+		if _, ok := c.item[hashKey]; !ok {
+			continue
+		}
+		if rangeKey != "" {
+			if _, ok := c.item[rangeKey]; !ok {
+				continue // Sparse index
+			}
+		}
+		matched, err := evalCondition(c.item, keyCondition)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matches = append(matches, c)
+		}
+	}
+
+	// Order by the range key, then by primary key so pages are stable
+	less := func(a, b candidate) bool {
+		if rangeKey != "" {
+			if cmp, _ := compareValues(a.item[rangeKey], b.item[rangeKey]); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return bytes.Compare(a.key, b.key) < 0
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return less(matches[i], matches[j]) })
+	forward := params.ScanIndexForward == nil || *params.ScanIndexForward
+	if !forward {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+
+	if params.ExclusiveStartKey != nil {
+		startKey, err := table.primaryKey(params.ExclusiveStartKey)
+		if err != nil {
+			return nil, err
+		}
+		start := candidate{key: startKey, item: params.ExclusiveStartKey}
+		i := 0
+		for i < len(matches) {
+			after := less(start, matches[i])
+			if !forward {
+				after = less(matches[i], start)
+			}
+			if after {
+				break
+			}
+			i++
+		}
+		matches = matches[i:]
+	}
+
+	page, lastKey := paginate(matches, params.Limit, func(c candidate) map[string]types.AttributeValue {
+		key := table.keyOf(c.item)
+		key[hashKey] = c.item[hashKey]
+		if rangeKey != "" {
+			key[rangeKey] = c.item[rangeKey]
+		}
+		return key
+	})
+
+	output := &dynamodb.QueryOutput{ScannedCount: int32(len(page)), LastEvaluatedKey: lastKey}
+	if output.Items, err = filterAndProject(page, filter, projection); err != nil {
+		return nil, err
+	}
+	output.Count = int32(len(output.Items))
+	return output, nil
+}
+
+// Scan implements the DynamoDB Scan call. Segments are not supported.
+func (s *Store) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	table, name, err := s.lookupTable(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var index *indexSchema
+	if indexName := aws.ToString(params.IndexName); indexName != "" {
+		i, ok := table.indexes[indexName]
+		if !ok {
+			return nil, validationError("the table does not have the specified index: %s", indexName)
+		}
+		index = &i
+	}
+
+	filter, projection, err := parseReadExpressions(params.FilterExpression, params.ProjectionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.allItems(table, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if index != nil {
+		var indexed []candidate
+		for _, c := range items {
+			_, hasHash := c.item[index.hashKey]
+			_, hasRange := c.item[index.rangeKey]
+			if hasHash && (index.rangeKey == "" || hasRange) {
+				indexed = append(indexed, c)
+			}
+		}
+		items = indexed
+	}
+
+	if params.ExclusiveStartKey != nil {
+		startKey, err := table.primaryKey(params.ExclusiveStartKey)
+		if err != nil {
+			return nil, err
+		}
+		i := sort.Search(len(items), func(i int) bool { return bytes.Compare(items[i].key, startKey) > 0 })
+		items = items[i:]
+	}
+
+	page, lastKey := paginate(items, params.Limit, func(c candidate) map[string]types.AttributeValue {
+		key := table.keyOf(c.item)
+		if index != nil {
+			key[index.hashKey] = c.item[index.hashKey]
+			if index.rangeKey != "" {
+				key[index.rangeKey] = c.item[index.rangeKey]
+			}
+		}
+		return key
+	})
+
+	output := &dynamodb.ScanOutput{ScannedCount: int32(len(page)), LastEvaluatedKey: lastKey}
+	if output.Items, err = filterAndProject(page, filter, projection); err != nil {
+		return nil, err
+	}
+	output.Count = int32(len(output.Items))
+	return output, nil
+}
+
+// parseReadExpressions parses the filter and projection of a Query or Scan
+func parseReadExpressions(filterExpr, projectionExpr *string, names map[string]string, values map[string]types.AttributeValue) (condition, []docPath, error) {
+	var filter condition
+	var projection []docPath
+	var err error
+	if aws.ToString(filterExpr) != "" {
+		if filter, err = parseCondition(*filterExpr, names, values); err != nil {
+			return nil, nil, err
+		}
+	}
+	if aws.ToString(projectionExpr) != "" {
+		if projection, err = parseProjection(*projectionExpr, names); err != nil {
+			return nil, nil, err
+		}
+	}
+	return filter, projection, nil
+}
+
+// paginate cuts items to limit, returning the key to resume from when more
+// items remain. Like DynamoDB, the limit counts items read, before any
+// filter is applied.
+func paginate(items []candidate, limit *int32, keyOf func(candidate) map[string]types.AttributeValue) ([]candidate, map[string]types.AttributeValue) {
+	if limit == nil || *limit <= 0 || int(*limit) >= len(items) {
+		return items, nil
+	}
+	page := items[:*limit]
+	return page, keyOf(page[len(page)-1])
+}
+
+func filterAndProject(items []candidate, filter condition, projection []docPath) ([]map[string]types.AttributeValue, error) {
+	out := []map[string]types.AttributeValue{}
+	for _, c := range items {
+		matched, err := evalCondition(c.item, filter)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			out = append(out, project(c.item, projection))
+		}
+	}
+	return out, nil
+}
+
+// PurgeExpired deletes items whose TTL has passed, as DynamoDB's background
+// sweeper does
+func (s *Store) PurgeExpired() (int, error) {
+	purged := 0
+	now := time.Now()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for name, table := range s.tables {
+			if !table.ttl {
+				continue
+			}
+			bucket := tx.Bucket([]byte(name))
+			var expiredKeys [][]byte
+			err := bucket.ForEach(func(k, v []byte) error {
+				item, err := decodeItem(v)
+				if err != nil {
+					return err
+				}
+				if expired(table, item, now) {
+					expiredKeys = append(expiredKeys, append([]byte{}, k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expiredKeys {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+			purged += len(expiredKeys)
+		}
+		return nil
+	})
+	return purged, err
+}
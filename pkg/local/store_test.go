@@ -0,0 +1,264 @@
+// pkg/local/store_test.go
+
+package local
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+func openTestStore(t *testing.T) (*Store, database.Tables) {
+	t.Helper()
+	tables := database.DefaultTables()
+	store, err := OpenStore(filepath.Join(t.TempDir(), "nexusscan.db"), tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, tables
+}
+
+func TestUpdateItemCondition(t *testing.T) {
+	ctx := context.Background()
+	store, tables := openTestStore(t)
+
+	record := func(batch string) error {
+		_, err := store.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(tables.ScanJobs),
+			Key:                 map[string]types.AttributeValue{"ScanID": s("scan-1")},
+			UpdateExpression:    aws.String("ADD ReportedBatches :batch, PortsScanned :ports SET #status = :running"),
+			ConditionExpression: aws.String("attribute_exists(ScanID) AND NOT contains(ReportedBatches, :batchId)"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "Status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":batch":   ns(batch),
+				":batchId": n(batch),
+				":ports":   n("100"),
+				":running": s("running"),
+			},
+		})
+		return err
+	}
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if err := record("0"); !errors.As(err, &conditionErr) {
+		t.Fatalf("update of a missing item = %v, want ConditionalCheckFailedException", err)
+	}
+
+	_, err := store.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(tables.ScanJobs),
+		Item:                map[string]types.AttributeValue{"ScanID": s("scan-1"), "Status": s("queued")},
+		ConditionExpression: aws.String("attribute_not_exists(ScanID)"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, batch := range []string{"0", "1"} {
+		if err := record(batch); err != nil {
+			t.Fatalf("recording batch %s: %v", batch, err)
+		}
+	}
+	if err := record("1"); !errors.As(err, &conditionErr) {
+		t.Fatalf("recording batch 1 twice = %v, want ConditionalCheckFailedException", err)
+	}
+
+	out, err := store.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(tables.ScanJobs),
+		Key:       map[string]types.AttributeValue{"ScanID": s("scan-1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]types.AttributeValue{
+		"ScanID":          s("scan-1"),
+		"Status":          s("running"),
+		"ReportedBatches": ns("0", "1"),
+		"PortsScanned":    n("200"),
+	}
+	if !equalValues(m(out.Item), m(want)) {
+		t.Errorf("scan job = %v, want %v", out.Item, want)
+	}
+}
+
+func TestQueryIndex(t *testing.T) {
+	ctx := context.Background()
+	store, tables := openTestStore(t)
+
+	put := func(table string, item map[string]types.AttributeValue) {
+		t.Helper()
+		if _, err := store.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(table), Item: item}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put(tables.Schedules, map[string]types.AttributeValue{"ScheduleID": s("a"), "ScheduleType": s("daily"), "NextRun": s("2024-05-01T10:00:00Z")})
+	put(tables.Schedules, map[string]types.AttributeValue{"ScheduleID": s("b"), "ScheduleType": s("daily"), "NextRun": s("2024-05-01T09:00:00Z")})
+	put(tables.Schedules, map[string]types.AttributeValue{"ScheduleID": s("c"), "ScheduleType": s("daily"), "NextRun": s("2024-05-02T09:00:00Z")})
+	put(tables.Schedules, map[string]types.AttributeValue{"ScheduleID": s("d"), "ScheduleType": s("weekly"), "NextRun": s("2024-05-01T08:00:00Z")})
+	put(tables.Schedules, map[string]types.AttributeValue{"ScheduleID": s("e"), "ScheduleType": s("daily")}) // Not in NextRunIndex
+
+	put(tables.ScanJobs, map[string]types.AttributeValue{"ScanID": s("1"), "Status": s("running"), "UpdatedAt": n("100")})
+	put(tables.ScanJobs, map[string]types.AttributeValue{"ScanID": s("2"), "Status": s("running"), "UpdatedAt": n("20")})
+	put(tables.ScanJobs, map[string]types.AttributeValue{"ScanID": s("3"), "Status": s("completed"), "UpdatedAt": n("10")})
+
+	put(tables.IPs, map[string]types.AttributeValue{"IPAddress": s("10.0.0.1"), "Inventory": s("ip"), "CreatedAt": s("2024-01-02")})
+	put(tables.IPs, map[string]types.AttributeValue{"IPAddress": s("10.0.0.2"), "Inventory": s("ip"), "CreatedAt": s("2024-01-01")})
+	put(tables.IPs, map[string]types.AttributeValue{"IPAddress": s("10.0.0.3"), "CreatedAt": s("2024-01-03")}) // No Inventory
+
+	tests := []struct {
+		name    string
+		input   dynamodb.QueryInput
+		want    []string
+		keyAttr string
+		wantErr bool
+	}{
+		{
+			name: "due schedules",
+			input: dynamodb.QueryInput{
+				TableName:              aws.String(tables.Schedules),
+				IndexName:              aws.String("NextRunIndex"),
+				KeyConditionExpression: aws.String("ScheduleType = :scheduleType AND NextRun <= :now"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":scheduleType": s("daily"),
+					":now":          s("2024-05-01T10:00:00Z"),
+				},
+			},
+			keyAttr: "ScheduleID",
+			want:    []string{"b", "a"},
+		},
+		{
+			name: "stale jobs by number range key",
+			input: dynamodb.QueryInput{
+				TableName:                aws.String(tables.ScanJobs),
+				IndexName:                aws.String("StatusIndex"),
+				KeyConditionExpression:   aws.String("#status = :status AND UpdatedAt < :cutoff"),
+				ExpressionAttributeNames: map[string]string{"#status": "Status"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":status": s("running"),
+					":cutoff": n("50"),
+				},
+			},
+			keyAttr: "ScanID",
+			want:    []string{"2"},
+		},
+		{
+			name: "inventory newest first",
+			input: dynamodb.QueryInput{
+				TableName:                 aws.String(tables.IPs),
+				IndexName:                 aws.String("CreatedAtIndex"),
+				KeyConditionExpression:    aws.String("Inventory = :inventory"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{":inventory": s("ip")},
+				ScanIndexForward:          aws.Bool(false),
+			},
+			keyAttr: "IPAddress",
+			want:    []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name: "filter after key condition",
+			input: dynamodb.QueryInput{
+				TableName:              aws.String(tables.Schedules),
+				IndexName:              aws.String("ScheduleTypeIndex"),
+				KeyConditionExpression: aws.String("ScheduleType = :scheduleType"),
+				FilterExpression:       aws.String("attribute_not_exists(NextRun)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":scheduleType": s("daily"),
+				},
+			},
+			keyAttr: "ScheduleID",
+			want:    []string{"e"},
+		},
+		{
+			name: "unknown index",
+			input: dynamodb.QueryInput{
+				TableName:                 aws.String(tables.Schedules),
+				IndexName:                 aws.String("MissingIndex"),
+				KeyConditionExpression:    aws.String("ScheduleType = :scheduleType"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{":scheduleType": s("daily")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := store.Query(ctx, &tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Query succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, item := range out.Items {
+				got = append(got, item[tt.keyAttr].(*types.AttributeValueMemberS).Value)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Query = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Query = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestQueryPages checks that paging through an index with Limit visits every
+// item exactly once
+func TestQueryPages(t *testing.T) {
+	ctx := context.Background()
+	store, tables := openTestStore(t)
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+		item := map[string]types.AttributeValue{"IPAddress": s(ip), "Inventory": s("ip"), "LastScanned": s("2024-05-01")}
+		if _, err := store.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(tables.IPs), Item: item}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := map[string]bool{}
+	var startKey map[string]types.AttributeValue
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging did not finish")
+		}
+		out, err := store.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String(tables.IPs),
+			IndexName:                 aws.String("LastScannedIndex"),
+			KeyConditionExpression:    aws.String("Inventory = :inventory"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":inventory": s("ip")},
+			Limit:                     aws.Int32(2),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range out.Items {
+			ip := item["IPAddress"].(*types.AttributeValueMemberS).Value
+			if seen[ip] {
+				t.Fatalf("%s returned twice", ip)
+			}
+			seen[ip] = true
+		}
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+	if len(seen) != 5 {
+		t.Errorf("paging returned %d items, want 5", len(seen))
+	}
+}
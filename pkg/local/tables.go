@@ -0,0 +1,118 @@
+// pkg/local/tables.go
+
+package local
+
+import (
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// tableSchema describes the keys of a table, as defined in template.yaml
+type tableSchema struct {
+	hashKey  string
+	rangeKey string
+	indexes  map[string]indexSchema
+	ttl      bool // Items expire at their ExpirationTime
+}
+
+// indexSchema describes the keys of a global secondary index. All indexes
+// project every attribute.
+type indexSchema struct {
+	hashKey  string
+	rangeKey string
+}
+
+// ttlAttribute is the attribute every table with TTL enabled expires on
+const ttlAttribute = "ExpirationTime"
+
+// schemas mirrors the DynamoDB tables in template.yaml, keyed by the names
+// the database client uses for them
+func schemas(tables database.Tables) map[string]tableSchema {
+	return map[string]tableSchema{
+		tables.IPs: {
+			hashKey: "IPAddress",
+			indexes: map[string]indexSchema{
+				"NetworkIndex":     {hashKey: "Network"},
+				"CreatedAtIndex":   {hashKey: "Inventory", rangeKey: "CreatedAt"},
+				"LastScannedIndex": {hashKey: "Inventory", rangeKey: "LastScanned"},
+			},
+		},
+		tables.Schedules: {
+			hashKey: "ScheduleID",
+			indexes: map[string]indexSchema{
+				"IPAddressIndex":    {hashKey: "IPAddress"},
+				"ScheduleTypeIndex": {hashKey: "ScheduleType"},
+				"NextRunIndex":      {hashKey: "ScheduleType", rangeKey: "NextRun"},
+			},
+		},
+		tables.Results: {
+			hashKey:  "IPAddress",
+			rangeKey: "ScanTimestamp",
+			ttl:      true,
+		},
+		tables.OpenPorts: {
+			hashKey: "IPAddress",
+		},
+		tables.Enrichment: {
+			hashKey:  "IPAddress",
+			rangeKey: "Timestamp",
+			ttl:      true,
+		},
+		tables.PortSets: {
+			hashKey: "Name",
+		},
+		tables.ScanProfiles: {
+			hashKey: "Name",
+		},
+		tables.ScanJobs: {
+			hashKey: "ScanID",
+			indexes: map[string]indexSchema{
+				"StatusIndex": {hashKey: "Status", rangeKey: "UpdatedAt"},
+			},
+			ttl: true,
+		},
+		tables.ScanBatches: {
+			hashKey:  "ScanID",
+			rangeKey: "BatchID",
+			ttl:      true,
+		},
+		tables.PortChanges: {
+			hashKey:  "IPAddress",
+			rangeKey: "ChangeID",
+			indexes: map[string]indexSchema{
+				"FeedIndex": {hashKey: "Feed", rangeKey: "ChangeID"},
+			},
+			ttl: true,
+		},
+		tables.NotificationChannels: {
+			hashKey: "ChannelID",
+		},
+		tables.NotificationRules: {
+			hashKey: "RuleID",
+		},
+		tables.NotificationFailures: {
+			hashKey: "FailureID",
+			ttl:     true,
+		},
+		tables.Exports: {
+			hashKey: "ExportID",
+			ttl:     true,
+		},
+		tables.Certificates: {
+			hashKey:  "Fingerprint",
+			rangeKey: "Location",
+			indexes: map[string]indexSchema{
+				"ExpiryIndex":    {hashKey: "Inventory", rangeKey: "NotAfter"},
+				"IPAddressIndex": {hashKey: "IPAddress"},
+			},
+			ttl: true,
+		},
+		tables.ServiceState: {
+			hashKey:  "IPAddress",
+			rangeKey: "Port",
+		},
+		tables.EnrichmentChanges: {
+			hashKey:  "IPAddress",
+			rangeKey: "ChangeID",
+		},
+	}
+}
@@ -0,0 +1,328 @@
+// pkg/local/values.go
+
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// storedValue is the JSON form of an attribute value, the same shape the
+// DynamoDB wire protocol uses
+type storedValue struct {
+	S    *string                 `json:"S,omitempty"`
+	N    *string                 `json:"N,omitempty"`
+	B    []byte                  `json:"B,omitempty"`
+	SS   []string                `json:"SS,omitempty"`
+	NS   []string                `json:"NS,omitempty"`
+	BS   [][]byte                `json:"BS,omitempty"`
+	M    map[string]*storedValue `json:"M,omitempty"`
+	L    []*storedValue          `json:"L,omitempty"`
+	NULL bool                    `json:"NULL,omitempty"`
+	BOOL *bool                   `json:"BOOL,omitempty"`
+
+	// IsM and IsL keep empty maps and lists distinct from other empty values
+	IsM bool `json:"isM,omitempty"`
+	IsL bool `json:"isL,omitempty"`
+}
+
+func toStored(av types.AttributeValue) *storedValue {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return &storedValue{S: &v.Value}
+	case *types.AttributeValueMemberN:
+		return &storedValue{N: &v.Value}
+	case *types.AttributeValueMemberB:
+		return &storedValue{B: v.Value}
+	case *types.AttributeValueMemberSS:
+		return &storedValue{SS: v.Value}
+	case *types.AttributeValueMemberNS:
+		return &storedValue{NS: v.Value}
+	case *types.AttributeValueMemberBS:
+		return &storedValue{BS: v.Value}
+	case *types.AttributeValueMemberM:
+		m := make(map[string]*storedValue, len(v.Value))
+		for name, value := range v.Value {
+			m[name] = toStored(value)
+		}
+		return &storedValue{M: m, IsM: true}
+	case *types.AttributeValueMemberL:
+		l := make([]*storedValue, len(v.Value))
+		for i, value := range v.Value {
+			l[i] = toStored(value)
+		}
+		return &storedValue{L: l, IsL: true}
+	case *types.AttributeValueMemberNULL:
+		return &storedValue{NULL: true}
+	case *types.AttributeValueMemberBOOL:
+		return &storedValue{BOOL: &v.Value}
+	}
+	return &storedValue{NULL: true}
+}
+
+func fromStored(sv *storedValue) types.AttributeValue {
+	switch {
+	case sv == nil:
+		return &types.AttributeValueMemberNULL{Value: true}
+	case sv.S != nil:
+		return &types.AttributeValueMemberS{Value: *sv.S}
+	case sv.N != nil:
+		return &types.AttributeValueMemberN{Value: *sv.N}
+	case sv.B != nil:
+		return &types.AttributeValueMemberB{Value: sv.B}
+	case sv.SS != nil:
+		return &types.AttributeValueMemberSS{Value: sv.SS}
+	case sv.NS != nil:
+		return &types.AttributeValueMemberNS{Value: sv.NS}
+	case sv.BS != nil:
+		return &types.AttributeValueMemberBS{Value: sv.BS}
+	case sv.IsM || sv.M != nil:
+		m := make(map[string]types.AttributeValue, len(sv.M))
+		for name, value := range sv.M {
+			m[name] = fromStored(value)
+		}
+		return &types.AttributeValueMemberM{Value: m}
+	case sv.IsL || sv.L != nil:
+		l := make([]types.AttributeValue, len(sv.L))
+		for i, value := range sv.L {
+			l[i] = fromStored(value)
+		}
+		return &types.AttributeValueMemberL{Value: l}
+	case sv.BOOL != nil:
+		return &types.AttributeValueMemberBOOL{Value: *sv.BOOL}
+	}
+	return &types.AttributeValueMemberNULL{Value: true}
+}
+
+// encodeItem serializes an item for storage
+func encodeItem(item map[string]types.AttributeValue) ([]byte, error) {
+	stored := make(map[string]*storedValue, len(item))
+	for name, value := range item {
+		stored[name] = toStored(value)
+	}
+	return json.Marshal(stored)
+}
+
+// decodeItem reverses encodeItem
+func decodeItem(data []byte) (map[string]types.AttributeValue, error) {
+	var stored map[string]*storedValue
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	item := make(map[string]types.AttributeValue, len(stored))
+	for name, value := range stored {
+		item[name] = fromStored(value)
+	}
+	return item, nil
+}
+
+// parseNumber parses a DynamoDB number
+func parseNumber(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, validationError("invalid number %q", s)
+	}
+	return r, nil
+}
+
+// formatNumber renders a number the way DynamoDB returns it, without
+// trailing zeros
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := strings.TrimRight(r.FloatString(38), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// typeName returns the DynamoDB type descriptor of a value
+func typeName(av types.AttributeValue) string {
+	switch av.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberM:
+		return "M"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	}
+	return "NULL"
+}
+
+// compareValues orders two scalar values of the same type. ok is false when
+// the values cannot be ordered against each other.
+func compareValues(a, b types.AttributeValue) (cmp int, ok bool) {
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS:
+		y, isS := b.(*types.AttributeValueMemberS)
+		if !isS {
+			return 0, false
+		}
+		return strings.Compare(x.Value, y.Value), true
+	case *types.AttributeValueMemberN:
+		y, isN := b.(*types.AttributeValueMemberN)
+		if !isN {
+			return 0, false
+		}
+		rx, err := parseNumber(x.Value)
+		if err != nil {
+			return 0, false
+		}
+		ry, err := parseNumber(y.Value)
+		if err != nil {
+			return 0, false
+		}
+		return rx.Cmp(ry), true
+	case *types.AttributeValueMemberB:
+		y, isB := b.(*types.AttributeValueMemberB)
+		if !isB {
+			return 0, false
+		}
+		return bytes.Compare(x.Value, y.Value), true
+	}
+	return 0, false
+}
+
+// equalValues reports whether two values are equal. Sets compare without
+// regard to order.
+func equalValues(a, b types.AttributeValue) bool {
+	if typeName(a) != typeName(b) {
+		return false
+	}
+
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		cmp, ok := compareValues(a, b)
+		return ok && cmp == 0
+	case *types.AttributeValueMemberSS:
+		return equalSets(x.Value, b.(*types.AttributeValueMemberSS).Value, func(s string) string { return s })
+	case *types.AttributeValueMemberNS:
+		return equalSets(x.Value, b.(*types.AttributeValueMemberNS).Value, canonicalNumber)
+	case *types.AttributeValueMemberBS:
+		return equalSets(x.Value, b.(*types.AttributeValueMemberBS).Value, func(b []byte) string { return string(b) })
+	case *types.AttributeValueMemberM:
+		y := b.(*types.AttributeValueMemberM)
+		if len(x.Value) != len(y.Value) {
+			return false
+		}
+		for name, value := range x.Value {
+			other, ok := y.Value[name]
+			if !ok || !equalValues(value, other) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberL:
+		y := b.(*types.AttributeValueMemberL)
+		if len(x.Value) != len(y.Value) {
+			return false
+		}
+		for i := range x.Value {
+			if !equalValues(x.Value[i], y.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberBOOL:
+		return x.Value == b.(*types.AttributeValueMemberBOOL).Value
+	}
+	return true // Both NULL
+}
+
+func equalSets[T any](a, b []T, key func(T) string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, v := range a {
+		seen[key(v)] = true
+	}
+	for _, v := range b {
+		if !seen[key(v)] {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalNumber normalizes a number so equal numbers compare equal as
+// strings
+func canonicalNumber(s string) string {
+	r, err := parseNumber(s)
+	if err != nil {
+		return s
+	}
+	return formatNumber(r)
+}
+
+// keyBytes encodes the given key attributes of an item into a storage key.
+// Items sort by these bytes in Scan results.
+func keyBytes(item map[string]types.AttributeValue, names ...string) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		value, ok := item[name]
+		if !ok {
+			return nil, validationError("missing key attribute %s", name)
+		}
+		if i > 0 {
+			buf.WriteByte(0)
+		}
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			buf.WriteString("S" + v.Value)
+		case *types.AttributeValueMemberN:
+			buf.WriteString("N" + canonicalNumber(v.Value))
+		case *types.AttributeValueMemberB:
+			buf.WriteString("B")
+			buf.Write(v.Value)
+		default:
+			return nil, validationError("key attribute %s must be a string, number or binary", name)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// copyItem returns a shallow copy of an item
+func copyItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	out := make(map[string]types.AttributeValue, len(item))
+	for name, value := range item {
+		out[name] = value
+	}
+	return out
+}
+
+// sortedNames returns the keys of a map in order
+func sortedNames(m map[string]types.AttributeValue) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validationError mirrors the ValidationException DynamoDB returns for
+// malformed requests
+func validationError(format string, args ...interface{}) error {
+	return fmt.Errorf("ValidationException: "+format, args...)
+}
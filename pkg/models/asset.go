@@ -0,0 +1,237 @@
+// pkg/models/asset.go
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Limits on asset metadata
+const (
+	MaxTags              = 50
+	MaxTagKeyLength      = 128
+	MaxTagValueLength    = 256
+	MaxOwnerLength       = 256
+	MaxGroupLength       = 128
+	MaxDescriptionLength = 1024
+)
+
+// AssetMetadata records what an IP is and who it belongs to. Tags are free
+// key/value pairs; the group and owner are single values that IPs are most
+// often selected by.
+type AssetMetadata struct {
+	Tags        map[string]string `json:"tags,omitempty" dynamodbav:"Tags,omitempty"`
+	Description string            `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	Owner       string            `json:"owner,omitempty" dynamodbav:"Owner,omitempty"`
+	Group       string            `json:"group,omitempty" dynamodbav:"AssetGroup,omitempty"`
+}
+
+// Validate checks the metadata against the limits above. Tag keys are
+// letters, digits and _ . - / @; tag values cannot contain commas, which
+// separate tags in selectors.
+func (m AssetMetadata) Validate() error {
+	if len(m.Tags) > MaxTags {
+		return fmt.Errorf("too many tags: %d, at most %d are allowed", len(m.Tags), MaxTags)
+	}
+	for key, value := range m.Tags {
+		if err := validateTagKey(key); err != nil {
+			return err
+		}
+		if len(value) > MaxTagValueLength {
+			return fmt.Errorf("value of tag %q is longer than %d characters", key, MaxTagValueLength)
+		}
+		if strings.Contains(value, ",") || hasControl(value) {
+			return fmt.Errorf("value of tag %q cannot contain commas or control characters", key)
+		}
+	}
+	if err := validateText("owner", m.Owner, MaxOwnerLength); err != nil {
+		return err
+	}
+	if err := validateText("group", m.Group, MaxGroupLength); err != nil {
+		return err
+	}
+	return validateText("description", m.Description, MaxDescriptionLength)
+}
+
+func validateTagKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("tag keys cannot be empty")
+	}
+	if len(key) > MaxTagKeyLength {
+		return fmt.Errorf("tag key %q is longer than %d characters", key, MaxTagKeyLength)
+	}
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_.-/@", r) {
+			return fmt.Errorf("invalid tag key %q: use letters, digits and _ . - / @", key)
+		}
+	}
+	return nil
+}
+
+func validateText(name string, value string, limit int) error {
+	if len(value) > limit {
+		return fmt.Errorf("%s is longer than %d characters", name, limit)
+	}
+	if hasControl(value) {
+		return fmt.Errorf("%s cannot contain control characters", name)
+	}
+	return nil
+}
+
+func hasControl(value string) bool {
+	return strings.IndexFunc(value, unicode.IsControl) >= 0
+}
+
+// AssetMetadataUpdate changes the metadata of IPs. Tags are added or
+// replaced and RemoveTags deleted; the other fields change only when set,
+// and setting one to "" clears it.
+type AssetMetadataUpdate struct {
+	Tags        map[string]string `json:"tags,omitempty"`
+	RemoveTags  []string          `json:"removeTags,omitempty"`
+	Description *string           `json:"description,omitempty"`
+	Owner       *string           `json:"owner,omitempty"`
+	Group       *string           `json:"group,omitempty"`
+}
+
+// IsEmpty reports whether the update changes nothing
+func (u AssetMetadataUpdate) IsEmpty() bool {
+	return len(u.Tags) == 0 && len(u.RemoveTags) == 0 && u.Description == nil && u.Owner == nil && u.Group == nil
+}
+
+// Apply returns metadata with the update applied, leaving metadata itself
+// unchanged
+func (u AssetMetadataUpdate) Apply(metadata AssetMetadata) AssetMetadata {
+	tags := make(map[string]string, len(metadata.Tags)+len(u.Tags))
+	for key, value := range metadata.Tags {
+		tags[key] = value
+	}
+	for _, key := range u.RemoveTags {
+		delete(tags, key)
+	}
+	for key, value := range u.Tags {
+		tags[key] = value
+	}
+	metadata.Tags = nil
+	if len(tags) > 0 {
+		metadata.Tags = tags
+	}
+
+	if u.Description != nil {
+		metadata.Description = *u.Description
+	}
+	if u.Owner != nil {
+		metadata.Owner = *u.Owner
+	}
+	if u.Group != nil {
+		metadata.Group = *u.Group
+	}
+	return metadata
+}
+
+// Merge returns the metadata with the tags of added laid over its own and
+// the description, owner and group of added in place of its own where set.
+// Adding an IP that is already in the inventory merges its metadata this way.
+func (m AssetMetadata) Merge(added AssetMetadata) AssetMetadata {
+	update := AssetMetadataUpdate{Tags: added.Tags}
+	if added.Description != "" {
+		update.Description = &added.Description
+	}
+	if added.Owner != "" {
+		update.Owner = &added.Owner
+	}
+	if added.Group != "" {
+		update.Group = &added.Group
+	}
+	return update.Apply(m)
+}
+
+// AssetSelector picks IPs by their metadata. An IP matches when it is in
+// the group, has the owner and carries every tag, each only checked when
+// set. A tag with an empty value matches any value of that key.
+type AssetSelector struct {
+	Group string            `json:"group,omitempty"`
+	Owner string            `json:"owner,omitempty"`
+	Tags  map[string]string `json:"tags,omitempty"`
+}
+
+// IsEmpty reports whether the selector would match every IP
+func (s AssetSelector) IsEmpty() bool {
+	return s.Group == "" && s.Owner == "" && len(s.Tags) == 0
+}
+
+// Validate checks the tag keys of the selector
+func (s AssetSelector) Validate() error {
+	for key := range s.Tags {
+		if err := validateTagKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches reports whether an IP is selected
+func (s AssetSelector) Matches(ip IP) bool {
+	if s.Group != "" && ip.Group != s.Group {
+		return false
+	}
+	if s.Owner != "" && ip.Owner != s.Owner {
+		return false
+	}
+	for key, value := range s.Tags {
+		tagged, ok := ip.Tags[key]
+		if !ok || (value != "" && tagged != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the selector in a stable form, with tags in key order
+func (s AssetSelector) String() string {
+	if s.IsEmpty() {
+		return ""
+	}
+	text, _ := json.Marshal(s)
+	return string(text)
+}
+
+// ParseTags reads tags written as "key:value,key:value". A key without a
+// value is a tag with an empty value.
+func ParseTags(text string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, pair := range strings.Split(text, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, ":")
+		key = strings.TrimSpace(key)
+		if err := validateTagKey(key); err != nil {
+			return nil, err
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// FormatTags writes tags in the form ParseTags reads, in key order
+func FormatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key
+		if tags[key] != "" {
+			pairs[i] += ":" + tags[key]
+		}
+	}
+	return strings.Join(pairs, ",")
+}
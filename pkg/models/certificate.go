@@ -0,0 +1,58 @@
+// pkg/models/certificate.go
+
+package models
+
+import (
+	"time"
+)
+
+// Certificate is a TLS certificate in the inventory, with every port it has
+// been seen on. Certificates are told apart by the SHA-256 fingerprint of
+// their DER encoding, so one served on many ports appears once.
+type Certificate struct {
+	Fingerprint        string                `json:"fingerprint"`
+	SubjectCN          string                `json:"subjectCn,omitempty"`
+	SubjectAN          []string              `json:"subjectAn,omitempty"`
+	IssuerCN           string                `json:"issuerCn,omitempty"`
+	IssuerDN           string                `json:"issuerDn,omitempty"`
+	Serial             string                `json:"serial,omitempty"`
+	NotBefore          time.Time             `json:"notBefore"`
+	NotAfter           time.Time             `json:"notAfter"`
+	DaysLeft           int                   `json:"daysLeft"` // Negative once expired
+	KeyAlgorithm       string                `json:"keyAlgorithm,omitempty"`
+	KeyBits            int                   `json:"keyBits,omitempty"`
+	SignatureAlgorithm string                `json:"signatureAlgorithm,omitempty"`
+	SelfSigned         bool                  `json:"selfSigned"`
+	Mismatched         bool                  `json:"mismatched"` // Served on some port for a hostname it does not cover
+	FirstSeen          time.Time             `json:"firstSeen"`
+	LastSeen           time.Time             `json:"lastSeen"`
+	Locations          []CertificateLocation `json:"locations"`
+}
+
+// CertificateLocation is a port a certificate has been seen on
+type CertificateLocation struct {
+	IPAddress  string    `json:"ipAddress"`
+	Port       int       `json:"port"`
+	Hostname   string    `json:"hostname,omitempty"` // Hostname the IP was added with, sent as SNI
+	Mismatched bool      `json:"mismatched"`
+	Current    bool      `json:"current"` // Still served there at the last enrichment of the port
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+}
+
+// DaysUntil returns the whole days left before a time, negative once it has
+// passed
+func DaysUntil(t time.Time, now time.Time) int {
+	return int(t.Sub(now).Hours() / 24)
+}
+
+// CurrentLocations returns the locations still serving the certificate
+func (c *Certificate) CurrentLocations() []CertificateLocation {
+	var current []CertificateLocation
+	for _, location := range c.Locations {
+		if location.Current {
+			current = append(current, location)
+		}
+	}
+	return current
+}
@@ -0,0 +1,160 @@
+// pkg/models/cron_test.go
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// newYork returns the America/New_York location, or skips the test when the
+// system has no time zone data
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	return loc
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"30-10 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"* * * * someday",
+		"@often",
+		"@every",
+		"@every 30s",
+		"@every soon",
+	}
+
+	for _, expr := range tests {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := func(value string) time.Time {
+		at, err := time.Parse("2006-01-02 15:04:05", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+
+	// 16 October 2026 is a Friday
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2026-10-16 10:07:30", "2026-10-16 10:08:00"},
+		{"*/15 * * * *", "2026-10-16 10:07:00", "2026-10-16 10:15:00"},
+		{"*/15 * * * *", "2026-10-16 10:45:00", "2026-10-16 11:00:00"},
+		{"5,35 * * * *", "2026-10-16 10:35:00", "2026-10-16 11:05:00"},
+		{"0 9-17/4 * * *", "2026-10-16 09:00:00", "2026-10-16 13:00:00"},
+		{"0 9-17/4 * * *", "2026-10-16 17:00:00", "2026-10-17 09:00:00"},
+		{"0 22-23,0-2 * * *", "2026-10-16 23:00:00", "2026-10-17 00:00:00"},
+		{"10 0 5/10 * *", "2026-10-16 00:00:00", "2026-10-25 00:10:00"},
+		{"0 12 * jan,jul *", "2026-03-01 00:00:00", "2026-07-01 12:00:00"},
+		{"0 12 * JUL-AUG *", "2026-08-31 12:00:00", "2027-07-01 12:00:00"},
+		{"0 0 * * mon-fri", "2026-10-16 12:00:00", "2026-10-19 00:00:00"},
+		{"0 0 * * 7", "2026-10-16 12:00:00", "2026-10-18 00:00:00"},
+		{"0 0 * * 0", "2026-10-16 12:00:00", "2026-10-18 00:00:00"},
+		{"0 0 ? * sat", "2026-10-16 12:00:00", "2026-10-17 00:00:00"},
+		// Either day field matches when both are restricted
+		{"0 0 13 * fri", "2026-10-16 00:00:00", "2026-10-23 00:00:00"},
+		{"0 0 13 * fri", "2026-11-06 00:00:00", "2026-11-13 00:00:00"},
+		{"0 0 20 * mon", "2026-10-16 00:00:00", "2026-10-19 00:00:00"},
+		{"0 0 20 * mon", "2026-10-19 00:00:00", "2026-10-20 00:00:00"},
+		// Otherwise only the restricted one does
+		{"0 0 13 * *", "2026-10-16 00:00:00", "2026-11-13 00:00:00"},
+		{"0 0 * * fri", "2026-10-16 00:00:00", "2026-10-23 00:00:00"},
+		{"0 0 29 2 *", "2026-10-16 00:00:00", "2028-02-29 00:00:00"},
+		{"@hourly", "2026-10-16 10:00:00", "2026-10-16 11:00:00"},
+		{"@daily", "2026-10-16 10:00:00", "2026-10-17 00:00:00"},
+		{"@weekly", "2026-10-16 10:00:00", "2026-10-18 00:00:00"},
+		{"@monthly", "2026-10-16 10:00:00", "2026-11-01 00:00:00"},
+		{"@yearly", "2026-10-16 10:00:00", "2027-01-01 00:00:00"},
+		{"@every 90m", "2026-10-16 10:00:30", "2026-10-16 11:30:30"},
+		{"@every 1m30s", "2026-10-16 10:00:00", "2026-10-16 10:01:30"},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got, want := expr.Next(utc(tt.from)), utc(tt.want); !got.Equal(want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got, want)
+		}
+	}
+
+	// Nothing matches 30 February
+	expr, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expr.Next(utc("2026-10-16 00:00:00")); !got.IsZero() {
+		t.Errorf("30 February after 2026-10-16 = %s, want the zero time", got)
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	loc := newYork(t)
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04 -0700", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.In(loc)
+	}
+
+	// Clocks go from 02:00 EST (-0500) to 03:00 EDT (-0400) on 8 March 2026,
+	// and from 02:00 EDT back to 01:00 EST on 1 November 2026
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{"daily run across the gap", "0 9 * * *", "2026-03-07 09:00 -0500", "2026-03-08 09:00 -0400"},
+		{"skipped time of day", "30 2 * * *", "2026-03-08 00:00 -0500", "2026-03-09 02:30 -0400"},
+		{"hourly across the gap", "0 * * * *", "2026-03-08 01:00 -0500", "2026-03-08 03:00 -0400"},
+		{"minutes across the gap", "*/20 * * * *", "2026-03-08 01:50 -0500", "2026-03-08 03:00 -0400"},
+		{"repeated time of day", "30 1 * * *", "2026-11-01 00:00 -0400", "2026-11-01 01:30 -0400"},
+		{"repeated time of day runs once", "30 1 * * *", "2026-11-01 01:30 -0400", "2026-11-02 01:30 -0500"},
+		{"hourly across the repeat", "0 * * * *", "2026-11-01 01:00 -0400", "2026-11-01 02:00 -0500"},
+		{"minutes across the repeat", "*/20 * * * *", "2026-11-01 01:50 -0400", "2026-11-01 02:00 -0500"},
+		{"minutes in the repeat", "*/20 * * * *", "2026-11-01 01:00 -0500", "2026-11-01 01:20 -0500"},
+	}
+
+	for _, tt := range tests {
+		expr, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, want := expr.Next(at(tt.from)), at(tt.want); !got.Equal(want) {
+			t.Errorf("%s: %q after %s = %s, want %s", tt.name, tt.expr, tt.from, got, want)
+		}
+	}
+}
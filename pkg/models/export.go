@@ -0,0 +1,71 @@
+// pkg/models/export.go
+
+package models
+
+import (
+	"time"
+)
+
+// Export formats
+const (
+	ExportFormatNmap  = "nmap"  // Nmap XML
+	ExportFormatCSV   = "csv"   // One row per open port
+	ExportFormatJSONL = "jsonl" // JSON Lines, one object per open port
+	ExportFormatSARIF = "sarif" // SARIF 2.1.0, one result per open port
+)
+
+// ExportFormats lists every export format
+var ExportFormats = []string{ExportFormatNmap, ExportFormatCSV, ExportFormatJSONL, ExportFormatSARIF}
+
+// IsValidExportFormat reports whether format is a supported export format
+func IsValidExportFormat(format string) bool {
+	for _, known := range ExportFormats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
+
+// What an export covers
+const (
+	ExportScopeScan      = "scan"      // The final summary of one scan
+	ExportScopeHistory   = "history"   // Every final summary of one IP
+	ExportScopeInventory = "inventory" // The latest completed scan of every IP
+)
+
+// Export job statuses
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// ExportRetention is how long export jobs and their files are kept
+const ExportRetention = 7 * 24 * time.Hour
+
+// ExportJob tracks one export as it is rendered and uploaded. Once completed,
+// ObjectKey names the file in object storage.
+type ExportJob struct {
+	ExportID       string         `json:"exportId" dynamodbav:"ExportID"`
+	Format         string         `json:"format" dynamodbav:"Format"`
+	Scope          string         `json:"scope" dynamodbav:"Scope"`
+	IPAddress      string         `json:"ipAddress,omitempty" dynamodbav:"IPAddress,omitempty"`
+	ScanID         string         `json:"scanId,omitempty" dynamodbav:"ScanID,omitempty"`
+	Selector       *AssetSelector `json:"selector,omitempty" dynamodbav:"Selector,omitempty"`
+	Status         string         `json:"status" dynamodbav:"Status"`
+	Error          string         `json:"error,omitempty" dynamodbav:"Error,omitempty"`
+	ObjectKey      string         `json:"-" dynamodbav:"ObjectKey,omitempty"`
+	Hosts          int            `json:"hosts" dynamodbav:"Hosts"`
+	OpenPorts      int            `json:"openPorts" dynamodbav:"OpenPorts"`
+	Size           int64          `json:"size" dynamodbav:"Size"`
+	CreatedAt      time.Time      `json:"createdAt" dynamodbav:"CreatedAt"`
+	CompletedAt    *time.Time     `json:"completedAt,omitempty" dynamodbav:"CompletedAt,omitempty"`
+	ExpirationTime int64          `json:"expiresAt,omitempty" dynamodbav:"ExpirationTime,omitempty"`
+}
+
+// Finished reports whether the export has reached a terminal status
+func (j *ExportJob) Finished() bool {
+	return j.Status == ExportStatusCompleted || j.Status == ExportStatusFailed
+}
@@ -2,21 +2,34 @@
 
 package models
 
-import "time"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // IP represents a network IP address to be scanned
 type IP struct {
 	IPAddress   string    `json:"ipAddress" dynamodbav:"IPAddress"`
 	CreatedAt   time.Time `json:"createdAt" dynamodbav:"CreatedAt"`
 	LastScanned time.Time `json:"lastScanned,omitempty" dynamodbav:"LastScanned,omitempty"`
+	Network     string    `json:"network,omitempty" dynamodbav:"Network,omitempty"`   // CIDR block or range the IP was added from
+	Hostname    string    `json:"hostname,omitempty" dynamodbav:"Hostname,omitempty"` // DNS name the IP was resolved from
+	AssetMetadata
 }
 
-// Schedule represents a scan schedule for an IP address
+// Schedule represents a scan schedule for an IP address, or for every IP a
+// selector matches when the schedule runs
 type Schedule struct {
     ScheduleID    string    `json:"scheduleId" dynamodbav:"ScheduleID"`     // New primary key
-    IPAddress     string    `json:"ipAddress" dynamodbav:"IPAddress"`
-    ScheduleType  string    `json:"scheduleType" dynamodbav:"ScheduleType"` // hourly, 12hour, daily, weekly, monthly
+    IPAddress     string    `json:"ipAddress,omitempty" dynamodbav:"IPAddress,omitempty"` // Empty for selector schedules
+    Selector      *AssetSelector `json:"selector,omitempty" dynamodbav:"Selector,omitempty"`
+    ScheduleType  string    `json:"scheduleType" dynamodbav:"ScheduleType"` // hourly, 12hour, daily, weekly, monthly or cron
+    ScheduleTiming
     PortSet       string    `json:"portSet" dynamodbav:"PortSet"`           // previous_open, top_100, custom_3500, full_65k
+    Profile       string    `json:"profile,omitempty" dynamodbav:"Profile,omitempty"` // Scan profile, default when empty
     Enabled       bool      `json:"enabled" dynamodbav:"Enabled"`
     CreatedAt     time.Time `json:"createdAt" dynamodbav:"CreatedAt"`
     UpdatedAt     time.Time `json:"updatedAt" dynamodbav:"UpdatedAt"`
@@ -26,9 +39,12 @@ type Schedule struct {
 // ScheduleScan represents a pending scan from a schedule
 type ScheduleScan struct {
     ScheduleID    string    `json:"scheduleId" dynamodbav:"ScheduleID"`    // Add this field
-    IPAddress     string    `json:"ipAddress" dynamodbav:"IPAddress"`
+    IPAddress     string    `json:"ipAddress,omitempty" dynamodbav:"IPAddress,omitempty"`
+    Selector      *AssetSelector `json:"selector,omitempty" dynamodbav:"Selector,omitempty"` // Expanded when the scan is dispatched
     ScheduleType  string    `json:"scheduleType" dynamodbav:"ScheduleType"`
+    ScheduleTiming
     PortSet       string    `json:"portSet" dynamodbav:"PortSet"`
+    Profile       string    `json:"profile,omitempty" dynamodbav:"Profile,omitempty"`
     NextRun       time.Time `json:"nextRun" dynamodbav:"NextRun"`
 }
 
@@ -40,7 +56,24 @@ type ScanResult struct {
     OpenPorts     []Port    `json:"openPorts" dynamodbav:"OpenPorts"`
     ScanDuration  int       `json:"scanDuration" dynamodbav:"ScanDuration"`
     PortsScanned  int       `json:"portsScanned" dynamodbav:"PortsScanned"`
+    Protocol      string    `json:"protocol,omitempty" dynamodbav:"Protocol,omitempty"`
+    StateCounts   *PortStateCounts `json:"stateCounts,omitempty" dynamodbav:"StateCounts,omitempty"`
+    WatchedPorts  []Port    `json:"watchedPorts,omitempty" dynamodbav:"WatchedPorts,omitempty"` // State of previously open ports
+    Profile       string    `json:"profile,omitempty" dynamodbav:"Profile,omitempty"` // Scan profile in effect
     ScheduleType  string    `json:"scheduleType,omitempty" dynamodbav:"ScheduleType,omitempty"`
     ExpirationTime int64    `json:"expirationTime,omitempty" dynamodbav:"ExpirationTime,omitempty"`
     IsFinalSummary bool     `json:"isFinalSummary,omitempty" dynamodbav:"IsFinalSummary,omitempty"`
+    ScanStatus    string    `json:"scanStatus,omitempty" dynamodbav:"ScanStatus,omitempty"` // completed or partial, on final summaries
+    PortsProbed   string    `json:"portsProbed,omitempty" dynamodbav:"PortsProbed,omitempty"` // Port spec of the ports the scan covered, on final summaries
+}
+
+// NewScanID builds a scan identifier for an IP. Colons in IPv6 addresses are
+// replaced so the ID can be used as a single URL path segment. A random
+// suffix keeps scans of the same IP started in the same second apart.
+func NewScanID(prefix string, ipAddress string) string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(fmt.Sprintf("reading random scan ID suffix: %v", err))
+	}
+	return fmt.Sprintf("%s-%s-%d-%s", prefix, strings.ReplaceAll(ipAddress, ":", "-"), time.Now().Unix(), hex.EncodeToString(suffix))
 }
@@ -0,0 +1,45 @@
+// pkg/models/ip_test.go
+
+package models
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewScanID(t *testing.T) {
+	tests := []struct {
+		ipAddress string
+		want      string
+	}{
+		{ipAddress: "10.0.0.1", want: `^scan-10\.0\.0\.1-\d+-[0-9a-f]{8}$`},
+		{ipAddress: "2001:db8::1", want: `^scan-2001-db8--1-\d+-[0-9a-f]{8}$`},
+		{ipAddress: "::1", want: `^scan---1-\d+-[0-9a-f]{8}$`},
+		{ipAddress: "fe80::a:b:c:d", want: `^scan-fe80--a-b-c-d-\d+-[0-9a-f]{8}$`},
+	}
+
+	for _, tt := range tests {
+		id := NewScanID("scan", tt.ipAddress)
+		if !regexp.MustCompile(tt.want).MatchString(id) {
+			t.Errorf("NewScanID(%q) = %q, want match for %s", tt.ipAddress, id, tt.want)
+		}
+		if strings.Contains(id, ":") {
+			t.Errorf("NewScanID(%q) = %q contains a colon", tt.ipAddress, id)
+		}
+		if escaped := url.PathEscape(id); escaped != id {
+			t.Errorf("NewScanID(%q) = %q is not a plain path segment (%q)", tt.ipAddress, id, escaped)
+		}
+	}
+
+	// Scans of one IP started in the same second get IDs of their own
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := NewScanID("scan", "10.0.0.1")
+		if seen[id] {
+			t.Fatalf("NewScanID returned %q twice", id)
+		}
+		seen[id] = true
+	}
+}
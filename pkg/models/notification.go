@@ -0,0 +1,203 @@
+// pkg/models/notification.go
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Notification event types
+const (
+	EventScanFinished        = "scan_finished"        // A scan completed, or finished partial or failed
+	EventPortsChanged        = "ports_changed"        // Ports opened or closed since the previous scan
+	EventCertificateExpiring = "certificate_expiring" // A TLS certificate expires soon or has expired
+)
+
+// EventTypes lists every notification event type
+var EventTypes = []string{EventScanFinished, EventPortsChanged, EventCertificateExpiring}
+
+// Notification channel types
+const (
+	ChannelWebhook = "webhook" // JSON POST signed with HMAC-SHA256
+	ChannelSlack   = "slack"   // Slack-compatible incoming webhook
+	ChannelEmail   = "email"   // Email sent through an SMTP server
+)
+
+// NotificationEvent is emitted by the pipeline and delivered to the channels
+// of every rule that matches it
+type NotificationEvent struct {
+	EventID    string          `json:"eventId" dynamodbav:"EventID"`
+	Type       string          `json:"type" dynamodbav:"Type"`
+	IPAddress  string          `json:"ipAddress" dynamodbav:"IPAddress"`
+	ScanID     string          `json:"scanId,omitempty" dynamodbav:"ScanID,omitempty"`
+	Summary    string          `json:"summary" dynamodbav:"Summary"` // One line description for chat and email
+	Data       json.RawMessage `json:"data,omitempty" dynamodbav:"Data,omitempty"`
+	OccurredAt time.Time       `json:"occurredAt" dynamodbav:"OccurredAt"`
+}
+
+// CertificateExpiry describes a certificate in a certificate_expiring event
+type CertificateExpiry struct {
+	Port        int       `json:"port"`
+	Ports       []int     `json:"ports,omitempty"` // Every port of the IP serving it, when there are several
+	SubjectCN   string    `json:"subjectCn,omitempty"`
+	IssuerCN    string    `json:"issuerCn,omitempty"`
+	NotAfter    time.Time `json:"notAfter"`
+	DaysLeft    int       `json:"daysLeft"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+}
+
+// NewScanFinishedEvent describes a scan that reached a terminal status
+func NewScanFinishedEvent(job *ScanJob, openPorts []Port) *NotificationEvent {
+	data, _ := json.Marshal(struct {
+		Status       string `json:"status"`
+		Protocol     string `json:"protocol"`
+		PortSet      string `json:"portSet,omitempty"`
+		Profile      string `json:"profile,omitempty"`
+		BatchesDone  int    `json:"batchesDone"`
+		TotalBatches int    `json:"totalBatches"`
+		OpenPorts    []Port `json:"openPorts"`
+	}{job.Status, job.Protocol, job.PortSet, job.Profile, job.BatchesDone, job.TotalBatches, openPorts})
+
+	return &NotificationEvent{
+		Type:      EventScanFinished,
+		IPAddress: job.IPAddress,
+		ScanID:    job.ScanID,
+		Summary: fmt.Sprintf("%s scan of %s %s: %d open ports",
+			job.Protocol, job.IPAddress, job.Status, len(openPorts)),
+		Data:       data,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// NewPortsChangedEvent describes the ports that opened or closed between scans
+func NewPortsChangedEvent(change *PortChange) *NotificationEvent {
+	data, _ := json.Marshal(change)
+
+	return &NotificationEvent{
+		Type:      EventPortsChanged,
+		IPAddress: change.IPAddress,
+		ScanID:    change.ScanID,
+		Summary: fmt.Sprintf("%s: %d %s ports opened, %d closed",
+			change.IPAddress, len(change.Opened), change.Protocol, len(change.Closed)),
+		Data:       data,
+		OccurredAt: change.DetectedAt,
+	}
+}
+
+// NewCertificateExpiringEvent describes a certificate that expires soon
+func NewCertificateExpiringEvent(ipAddress string, scanID string, cert CertificateExpiry) *NotificationEvent {
+	data, _ := json.Marshal(cert)
+
+	where := fmt.Sprintf("port %d", cert.Port)
+	if len(cert.Ports) > 1 {
+		where = fmt.Sprintf("%d ports", len(cert.Ports))
+	}
+	summary := fmt.Sprintf("Certificate %q on %s %s expires in %d days",
+		cert.SubjectCN, ipAddress, where, cert.DaysLeft)
+	if cert.DaysLeft < 0 {
+		summary = fmt.Sprintf("Certificate %q on %s %s expired %d days ago",
+			cert.SubjectCN, ipAddress, where, -cert.DaysLeft)
+	}
+
+	return &NotificationEvent{
+		Type:       EventCertificateExpiring,
+		IPAddress:  ipAddress,
+		ScanID:     scanID,
+		Summary:    summary,
+		Data:       data,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// NotificationChannel is a destination for notifications
+type NotificationChannel struct {
+	ChannelID    string    `json:"channelId" dynamodbav:"ChannelID"`
+	Name         string    `json:"name" dynamodbav:"Name"`
+	Type         string    `json:"type" dynamodbav:"Type"`                                     // webhook, slack or email
+	URL          string    `json:"url,omitempty" dynamodbav:"URL,omitempty"`                   // webhook and slack
+	Secret       string    `json:"secret,omitempty" dynamodbav:"Secret,omitempty"`             // HMAC key for webhook signatures
+	SMTPHost     string    `json:"smtpHost,omitempty" dynamodbav:"SMTPHost,omitempty"`         // email
+	SMTPPort     int       `json:"smtpPort,omitempty" dynamodbav:"SMTPPort,omitempty"`         // email, defaults to 587
+	SMTPUsername string    `json:"smtpUsername,omitempty" dynamodbav:"SMTPUsername,omitempty"` // email, optional
+	SMTPPassword string    `json:"smtpPassword,omitempty" dynamodbav:"SMTPPassword,omitempty"` // email, optional
+	From         string    `json:"from,omitempty" dynamodbav:"From,omitempty"`                 // email
+	To           []string  `json:"to,omitempty" dynamodbav:"To,omitempty"`                     // email
+	CreatedAt    time.Time `json:"createdAt" dynamodbav:"CreatedAt"`
+}
+
+// Validate checks that the channel has the settings its type needs
+func (c *NotificationChannel) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("channel name is required")
+	}
+
+	switch c.Type {
+	case ChannelWebhook, ChannelSlack:
+		if c.URL == "" {
+			return fmt.Errorf("url is required for %s channels", c.Type)
+		}
+	case ChannelEmail:
+		if c.SMTPHost == "" || c.From == "" || len(c.To) == 0 {
+			return fmt.Errorf("smtpHost, from and to are required for email channels")
+		}
+	default:
+		return fmt.Errorf("channel type must be one of: webhook, slack, email")
+	}
+	return nil
+}
+
+// Redacted returns a copy of the channel with its credentials removed, for
+// returning through the API
+func (c NotificationChannel) Redacted() NotificationChannel {
+	if c.Secret != "" {
+		c.Secret = "********"
+	}
+	if c.SMTPPassword != "" {
+		c.SMTPPassword = "********"
+	}
+	return c
+}
+
+// NotificationRule sends events of the given types for the given targets to
+// a set of channels. An event's IP must be among the targets and match the
+// selector when either is set.
+type NotificationRule struct {
+	RuleID     string         `json:"ruleId" dynamodbav:"RuleID"`
+	Name       string         `json:"name" dynamodbav:"Name"`
+	EventTypes []string       `json:"eventTypes,omitempty" dynamodbav:"EventTypes,omitempty"` // Empty matches every event type
+	Targets    []string       `json:"targets,omitempty" dynamodbav:"Targets,omitempty"`       // IPs, CIDR blocks or ranges; empty matches every IP
+	Selector   *AssetSelector `json:"selector,omitempty" dynamodbav:"Selector,omitempty"`     // Group, owner and tags of the IP, checked at delivery
+	ChannelIDs []string       `json:"channelIds" dynamodbav:"ChannelIDs"`
+	Enabled    bool           `json:"enabled" dynamodbav:"Enabled"`
+	CreatedAt  time.Time      `json:"createdAt" dynamodbav:"CreatedAt"`
+}
+
+// HasSelector reports whether the rule selects IPs by their metadata
+func (r *NotificationRule) HasSelector() bool {
+	return r.Selector != nil && !r.Selector.IsEmpty()
+}
+
+// IsValidEventType reports whether eventType is a known notification event type
+func IsValidEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationFailure is the dead-letter record of an event that could not
+// be delivered to a channel after every retry
+type NotificationFailure struct {
+	FailureID      string            `json:"failureId" dynamodbav:"FailureID"`
+	ChannelID      string            `json:"channelId" dynamodbav:"ChannelID"`
+	ChannelType    string            `json:"channelType" dynamodbav:"ChannelType"`
+	Event          NotificationEvent `json:"event" dynamodbav:"Event"`
+	Attempts       int               `json:"attempts" dynamodbav:"Attempts"`
+	Error          string            `json:"error" dynamodbav:"Error"`
+	FailedAt       time.Time         `json:"failedAt" dynamodbav:"FailedAt"`
+	ExpirationTime int64             `json:"-" dynamodbav:"ExpirationTime,omitempty"`
+}
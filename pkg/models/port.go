@@ -1,11 +1,105 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported scan protocols
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+// Port states reported by the scanner
+const (
+	PortStateOpen         = "open"
+	PortStateClosed       = "closed"        // Host answered with RST / ICMP port unreachable
+	PortStateFiltered     = "filtered"      // No answer before the timeout
+	PortStateUnreachable  = "unreachable"   // ICMP host or network unreachable
+	PortStateOpenFiltered = "open|filtered" // UDP port that stayed silent
+)
+
+// PortStateCounts aggregates how many ports ended up in each state
+type PortStateCounts struct {
+	Open         int `json:"open" dynamodbav:"Open"`
+	Closed       int `json:"closed" dynamodbav:"Closed"`
+	Filtered     int `json:"filtered" dynamodbav:"Filtered"`
+	Unreachable  int `json:"unreachable" dynamodbav:"Unreachable"`
+	OpenFiltered int `json:"openFiltered,omitempty" dynamodbav:"OpenFiltered,omitempty"`
+}
+
+// Add records one port in the given state
+func (c *PortStateCounts) Add(state string) {
+	switch state {
+	case PortStateOpen:
+		c.Open++
+	case PortStateClosed:
+		c.Closed++
+	case PortStateUnreachable:
+		c.Unreachable++
+	case PortStateOpenFiltered:
+		c.OpenFiltered++
+	default:
+		c.Filtered++
+	}
+}
+
+// Merge adds the counts from another batch
+func (c *PortStateCounts) Merge(other PortStateCounts) {
+	c.Open += other.Open
+	c.Closed += other.Closed
+	c.Filtered += other.Filtered
+	c.Unreachable += other.Unreachable
+	c.OpenFiltered += other.OpenFiltered
+}
+
+// String summarises the counts for logging
+func (c PortStateCounts) String() string {
+	return fmt.Sprintf("open=%d closed=%d filtered=%d unreachable=%d open|filtered=%d",
+		c.Open, c.Closed, c.Filtered, c.Unreachable, c.OpenFiltered)
+}
 
 // Port represents information about a scanned port
 type Port struct {
-	Number  int           `json:"number"`
-	State   string        `json:"state"`
-	Latency time.Duration `json:"latency"`
-	Service string        `json:"service,omitempty"`
+	Number   int           `json:"number"`
+	Protocol string        `json:"protocol,omitempty"`
+	State    string        `json:"state"`
+	Latency  time.Duration `json:"latency"`
+	Service  string        `json:"service,omitempty"`
+	Product  string        `json:"product,omitempty"`
+	Version  string        `json:"version,omitempty"`
+	Banner   string        `json:"banner,omitempty"`
+}
+
+// NormalizeProtocol returns the canonical protocol name, defaulting to TCP
+func NormalizeProtocol(protocol string) string {
+	if strings.EqualFold(protocol, ProtocolUDP) {
+		return ProtocolUDP
+	}
+	return ProtocolTCP
+}
+
+// IsValidProtocol reports whether protocol is empty (meaning TCP) or a supported protocol
+func IsValidProtocol(protocol string) bool {
+	switch strings.ToLower(protocol) {
+	case "", ProtocolTCP, ProtocolUDP:
+		return true
+	default:
+		return false
+	}
+}
+
+// SplitByProtocol separates ports into TCP and UDP findings. Ports recorded
+// before protocol tracking existed are treated as TCP.
+func SplitByProtocol(ports []Port) (tcp []Port, udp []Port) {
+	for _, port := range ports {
+		if NormalizeProtocol(port.Protocol) == ProtocolUDP {
+			udp = append(udp, port)
+		} else {
+			tcp = append(tcp, port)
+		}
+	}
+	return tcp, udp
 }
@@ -0,0 +1,69 @@
+// pkg/models/port_change.go
+
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// PortChange records the ports that opened or closed on an IP between two
+// completed scans of the same protocol
+type PortChange struct {
+	IPAddress      string    `json:"ipAddress" dynamodbav:"IPAddress"`
+	ChangeID       string    `json:"changeId" dynamodbav:"ChangeID"` // DetectedAt followed by the scan ID, so changes sort by time
+	ScanID         string    `json:"scanId" dynamodbav:"ScanID"`
+	PreviousScanID string    `json:"previousScanId" dynamodbav:"PreviousScanID"`
+	Protocol       string    `json:"protocol" dynamodbav:"Protocol"`
+	Opened         []Port    `json:"opened" dynamodbav:"Opened"`
+	Closed         []Port    `json:"closed" dynamodbav:"Closed"` // State says whether the port closed, was filtered or became unreachable
+	DetectedAt     time.Time `json:"detectedAt" dynamodbav:"DetectedAt"`
+	ExpirationTime int64     `json:"-" dynamodbav:"ExpirationTime,omitempty"`
+}
+
+// NewPortChangeID builds the sort key for a change detected by a scan
+func NewPortChangeID(detectedAt time.Time, scanID string) string {
+	return detectedAt.UTC().Format(time.RFC3339) + "#" + scanID
+}
+
+// DiffPorts compares the open ports of a scan against the previous completed
+// scan. Opened ports are open now and were probed by the previous scan
+// without answering as open; previousProbed lists the ports that scan
+// covered, and is nil for summaries that did not record them, in which case
+// every port counts as covered. Closed ports were open before and were
+// probed again without answering as open; watched carries their current
+// state. A port only one of the two scans covered is never reported.
+func DiffPorts(previous []Port, previousProbed []int, current []Port, watched []Port) (opened []Port, closed []Port) {
+	opened, closed = []Port{}, []Port{}
+
+	wasOpen := make(map[int]bool, len(previous))
+	for _, port := range previous {
+		wasOpen[port.Number] = true
+	}
+
+	var wasProbed map[int]bool
+	if previousProbed != nil {
+		wasProbed = make(map[int]bool, len(previousProbed))
+		for _, port := range previousProbed {
+			wasProbed[port] = true
+		}
+	}
+
+	isOpen := make(map[int]bool, len(current))
+	for _, port := range current {
+		isOpen[port.Number] = true
+		if !wasOpen[port.Number] && (wasProbed == nil || wasProbed[port.Number]) {
+			opened = append(opened, port)
+		}
+	}
+
+	for _, port := range watched {
+		if wasOpen[port.Number] && !isOpen[port.Number] && port.State != PortStateOpen {
+			closed = append(closed, port)
+		}
+	}
+
+	sort.Slice(opened, func(a, b int) bool { return opened[a].Number < opened[b].Number })
+	sort.Slice(closed, func(a, b int) bool { return closed[a].Number < closed[b].Number })
+	return opened, closed
+}
@@ -0,0 +1,125 @@
+// pkg/models/port_change_test.go
+
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffPorts(t *testing.T) {
+	open := func(numbers ...int) []Port {
+		ports := []Port{}
+		for _, number := range numbers {
+			ports = append(ports, Port{Number: number, State: PortStateOpen})
+		}
+		return ports
+	}
+	numbers := func(ports []Port) []int {
+		list := []int{}
+		for _, port := range ports {
+			list = append(list, port.Number)
+		}
+		return list
+	}
+
+	tests := []struct {
+		name       string
+		previous   []Port
+		probed     []int // Ports the previous scan covered, nil when it did not record them
+		current    []Port
+		watched    []Port
+		wantOpened []int
+		wantClosed []int
+	}{
+		{
+			name:       "first scan",
+			current:    open(443, 22),
+			wantOpened: []int{22, 443},
+			wantClosed: []int{},
+		},
+		{
+			name:       "no change",
+			previous:   open(22, 80),
+			current:    open(80, 22),
+			watched:    open(22, 80),
+			wantOpened: []int{},
+			wantClosed: []int{},
+		},
+		{
+			name:       "added and removed",
+			previous:   open(22, 80),
+			current:    open(22, 8443, 443),
+			watched:    []Port{{Number: 22, State: PortStateOpen}, {Number: 80, State: PortStateClosed}},
+			wantOpened: []int{443, 8443},
+			wantClosed: []int{80},
+		},
+		{
+			name:       "every port closed",
+			previous:   open(80, 22),
+			watched:    []Port{{Number: 80, State: PortStateFiltered}, {Number: 22, State: PortStateClosed}},
+			wantOpened: []int{},
+			wantClosed: []int{22, 80},
+		},
+		{
+			// A port the scan did not probe again is not reported closed
+			name:       "port not covered",
+			previous:   open(22, 3389),
+			current:    open(22),
+			watched:    open(22),
+			wantOpened: []int{},
+			wantClosed: []int{},
+		},
+		{
+			// A watched port that answered open was found by another batch
+			name:       "watched port still open",
+			previous:   open(22),
+			watched:    open(22),
+			wantOpened: []int{},
+			wantClosed: []int{},
+		},
+		{
+			// A port the previous scan did not probe is not reported opened
+			name:       "port not covered before",
+			previous:   open(22),
+			probed:     []int{22, 80, 443},
+			current:    open(22, 443, 8080),
+			watched:    open(22),
+			wantOpened: []int{443},
+			wantClosed: []int{},
+		},
+		{
+			name:       "previous scan covered every port",
+			previous:   open(22),
+			probed:     []int{22, 80, 8080},
+			current:    open(80, 8080),
+			watched:    []Port{{Number: 22, State: PortStateClosed}},
+			wantOpened: []int{80, 8080},
+			wantClosed: []int{22},
+		},
+		{
+			name:       "watched port that was not open before",
+			previous:   open(22),
+			current:    open(22),
+			watched:    []Port{{Number: 25, State: PortStateClosed}},
+			wantOpened: []int{},
+			wantClosed: []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		opened, closed := DiffPorts(tt.previous, tt.probed, tt.current, tt.watched)
+		if got := numbers(opened); !reflect.DeepEqual(got, tt.wantOpened) {
+			t.Errorf("%s: opened = %v, want %v", tt.name, got, tt.wantOpened)
+		}
+		if got := numbers(closed); !reflect.DeepEqual(got, tt.wantClosed) {
+			t.Errorf("%s: closed = %v, want %v", tt.name, got, tt.wantClosed)
+		}
+	}
+
+	// Closed ports carry the state they were found in
+	_, closed := DiffPorts(open(80), nil, nil, []Port{{Number: 80, State: PortStateFiltered}})
+	if len(closed) != 1 || closed[0].State != PortStateFiltered {
+		t.Errorf("closed = %+v, want port 80 %s", closed, PortStateFiltered)
+	}
+}
@@ -0,0 +1,152 @@
+// pkg/models/port_sets.go
+
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PortSetPreviousOpen rescans the ports found open by earlier scans of the IP
+const PortSetPreviousOpen = "previous_open"
+
+// BuiltinPortSets are the port sets defined in code by GetPortSet
+var BuiltinPortSets = []string{"top_100", "custom_3500", "full_65k"}
+
+// PortSet is a named, user-defined list of ports stored in the database
+type PortSet struct {
+	Name        string    `json:"name" dynamodbav:"Name"`
+	Description string    `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	Ports       string    `json:"ports" dynamodbav:"Ports"` // Spec such as "22,80,1-1024,8000-9000"
+	PortCount   int       `json:"portCount" dynamodbav:"PortCount"`
+	CreatedAt   time.Time `json:"createdAt" dynamodbav:"CreatedAt"`
+	UpdatedAt   time.Time `json:"updatedAt" dynamodbav:"UpdatedAt"`
+}
+
+// IsBuiltinPortSet reports whether name is previous_open or a port set defined in code
+func IsBuiltinPortSet(name string) bool {
+	if name == PortSetPreviousOpen {
+		return true
+	}
+	for _, builtin := range BuiltinPortSets {
+		if name == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePortSetName checks that name can be used for a user-defined port set
+func ValidatePortSetName(name string) error {
+	if err := validateName("port set", name); err != nil {
+		return err
+	}
+	if IsBuiltinPortSet(name) {
+		return fmt.Errorf("port set name %q is reserved", name)
+	}
+	return nil
+}
+
+// validateName checks the name of a user-defined port set or profile
+func validateName(kind string, name string) error {
+	if name == "" || len(name) > 64 {
+		return fmt.Errorf("%s name must be 1-64 characters", kind)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return fmt.Errorf("%s name may only contain lowercase letters, digits, '_' and '-'", kind)
+		}
+	}
+	return nil
+}
+
+// ParsePortSpec expands a comma separated list of ports and ranges such as
+// "22,80,1-1024,8000-9000" into a sorted list of unique ports
+func ParsePortSpec(spec string) ([]int, error) {
+	seen := make(map[int]bool)
+	
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		
+		start, end := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			start, end = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		
+		first, err := parsePort(start)
+		if err != nil {
+			return nil, err
+		}
+		last, err := parsePort(end)
+		if err != nil {
+			return nil, err
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+		
+		for port := first; port <= last; port++ {
+			seen[port] = true
+		}
+	}
+	
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("port list is empty")
+	}
+	
+	ports := make([]int, 0, len(seen))
+	for port := range seen {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// FormatPortSpec writes ports as a port spec, sorted and each once, with
+// runs of consecutive ports as ranges. ParsePortSpec gives the same ports
+// back in that order.
+func FormatPortSpec(ports []int) string {
+	sorted := make([]int, len(ports))
+	copy(sorted, ports)
+	sort.Ints(sorted)
+	
+	ports = sorted[:0]
+	for i, port := range sorted {
+		if i == 0 || port != sorted[i-1] {
+			ports = append(ports, port)
+		}
+	}
+	
+	var b strings.Builder
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && ports[j+1] == ports[j]+1 {
+			j++
+		}
+		
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(ports[i]))
+		if j > i {
+			b.WriteByte('-')
+			b.WriteString(strconv.Itoa(ports[j]))
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q: must be between 1 and 65535", value)
+	}
+	return port, nil
+}
@@ -0,0 +1,95 @@
+// pkg/models/port_sets_test.go
+
+package models
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		{spec: "22", want: []int{22}},
+		{spec: "443,22,80", want: []int{22, 80, 443}},
+		{spec: " 22 , 80 ", want: []int{22, 80}},
+		{spec: "8000-8003", want: []int{8000, 8001, 8002, 8003}},
+		{spec: "8000 - 8002", want: []int{8000, 8001, 8002}},
+		{spec: "80-80", want: []int{80}},
+		{spec: "1,65535", want: []int{1, 65535}},
+		{spec: "65530-65535", want: []int{65530, 65531, 65532, 65533, 65534, 65535}},
+		// Duplicates and overlapping ranges are listed once
+		{spec: "22,22,80,22", want: []int{22, 80}},
+		{spec: "1-5,3-7,5", want: []int{1, 2, 3, 4, 5, 6, 7}},
+		{spec: "22,,80,", want: []int{22, 80}},
+		{spec: "0", wantErr: true},
+		{spec: "0-10", wantErr: true},
+		{spec: "65536", wantErr: true},
+		{spec: "65530-65536", wantErr: true},
+		{spec: "-1", wantErr: true},
+		{spec: "100-1", wantErr: true},
+		{spec: "80-", wantErr: true},
+		{spec: "1-2-3", wantErr: true},
+		{spec: "http", wantErr: true},
+		{spec: "22,ssh", wantErr: true},
+		{spec: "", wantErr: true},
+		{spec: " , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePortSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePortSpec(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePortSpec(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	ports, err := ParsePortSpec("1-65535")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 65535 || ports[0] != 1 || ports[len(ports)-1] != 65535 {
+		t.Errorf("ParsePortSpec(\"1-65535\") returned %d ports from %d to %d", len(ports), ports[0], ports[len(ports)-1])
+	}
+}
+
+func TestFormatPortSpec(t *testing.T) {
+	tests := []struct {
+		ports []int
+		want  string
+	}{
+		{ports: nil, want: ""},
+		{ports: []int{22}, want: "22"},
+		{ports: []int{22, 80, 443}, want: "22,80,443"},
+		{ports: []int{79, 80, 81, 443}, want: "79-81,443"},
+		{ports: []int{1, 2, 4, 5, 65535}, want: "1-2,4-5,65535"},
+		{ports: []int{443, 22, 80, 22, 81}, want: "22,80-81,443"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatPortSpec(tt.ports); got != tt.want {
+			t.Errorf("FormatPortSpec(%v) = %q, want %q", tt.ports, got, tt.want)
+		}
+	}
+
+	// Every built-in port set survives the round trip
+	for _, name := range BuiltinPortSets {
+		builtin := GetPortSet(name)
+		want := append([]int{}, builtin...)
+		sort.Ints(want)
+		ports, err := ParsePortSpec(FormatPortSpec(builtin))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(ports, want) {
+			t.Errorf("%s: %d ports after the round trip, want %d", name, len(ports), len(want))
+		}
+	}
+}
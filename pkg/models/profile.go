@@ -0,0 +1,192 @@
+// pkg/models/profile.go
+
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Probe orders
+const (
+	ProbeOrderSequential = "sequential" // Ascending port order
+	ProbeOrderRandom     = "random"     // Shuffled across and within batches
+)
+
+// DefaultScanProfile is used when no profile is named
+const DefaultScanProfile = "default"
+
+// ScanProfile controls how aggressively ports are probed. Zero values fall
+// back to the defaults of the default profile.
+type ScanProfile struct {
+	Name         string    `json:"name" dynamodbav:"Name"`
+	Description  string    `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	TimeoutMs    int       `json:"timeoutMs" dynamodbav:"TimeoutMs"`       // Starting per-port timeout for TCP
+	UDPTimeoutMs int       `json:"udpTimeoutMs" dynamodbav:"UDPTimeoutMs"` // Starting per-port timeout for UDP
+	Concurrency  int       `json:"concurrency" dynamodbav:"Concurrency"`   // Most probes in flight per batch
+	RetryCount   int       `json:"retryCount" dynamodbav:"RetryCount"`     // Retries of silent ports
+	BatchSize    int       `json:"batchSize" dynamodbav:"BatchSize"`       // Ports per batch
+	ProbeOrder   string    `json:"probeOrder" dynamodbav:"ProbeOrder"`     // sequential or random
+	MaxScanRate  int       `json:"maxScanRate" dynamodbav:"MaxScanRate"`   // Probes per second cap per scan, 0 for none
+	Builtin      bool      `json:"builtin,omitempty" dynamodbav:"-"`
+	CreatedAt    time.Time `json:"createdAt,omitempty" dynamodbav:"CreatedAt"`
+	UpdatedAt    time.Time `json:"updatedAt,omitempty" dynamodbav:"UpdatedAt"`
+}
+
+// builtinScanProfiles are the profiles defined in code
+var builtinScanProfiles = []ScanProfile{
+	{
+		Name:         DefaultScanProfile,
+		Description:  "Balanced settings for hosts on the internet",
+		TimeoutMs:    500,
+		UDPTimeoutMs: 1500,
+		Concurrency:  50,
+		RetryCount:   2,
+		BatchSize:    4000,
+		ProbeOrder:   ProbeOrderSequential,
+	},
+	{
+		Name:         "stealth",
+		Description:  "Few, slow probes in random order to stay under IDS thresholds",
+		TimeoutMs:    1500,
+		UDPTimeoutMs: 3000,
+		Concurrency:  5,
+		RetryCount:   1,
+		BatchSize:    2400, // As many as a worker run can probe at the rate cap
+		ProbeOrder:   ProbeOrderRandom,
+		MaxScanRate:  20,
+	},
+	{
+		Name:         "aggressive",
+		Description:  "Short timeouts and high concurrency for responsive hosts",
+		TimeoutMs:    300,
+		UDPTimeoutMs: 1000,
+		Concurrency:  200,
+		RetryCount:   1,
+		BatchSize:    10000,
+		ProbeOrder:   ProbeOrderSequential,
+	},
+	{
+		Name:         "lan",
+		Description:  "Very short timeouts for hosts on a local network",
+		TimeoutMs:    150,
+		UDPTimeoutMs: 500,
+		Concurrency:  500,
+		RetryCount:   0,
+		BatchSize:    10000,
+		ProbeOrder:   ProbeOrderSequential,
+	},
+}
+
+// BuiltinScanProfiles returns the profiles defined in code
+func BuiltinScanProfiles() []ScanProfile {
+	profiles := make([]ScanProfile, len(builtinScanProfiles))
+	copy(profiles, builtinScanProfiles)
+	for i := range profiles {
+		profiles[i].Builtin = true
+	}
+	return profiles
+}
+
+// GetBuiltinScanProfile returns a profile defined in code, or nil
+func GetBuiltinScanProfile(name string) *ScanProfile {
+	for _, profile := range BuiltinScanProfiles() {
+		if profile.Name == name {
+			return &profile
+		}
+	}
+	return nil
+}
+
+// Validate checks a user-defined profile and fills unset values from the
+// default profile
+func (p *ScanProfile) Validate() error {
+	if err := validateName("scan profile", p.Name); err != nil {
+		return err
+	}
+	if GetBuiltinScanProfile(p.Name) != nil {
+		return fmt.Errorf("scan profile name %q is reserved", p.Name)
+	}
+
+	defaults := GetBuiltinScanProfile(DefaultScanProfile)
+	if p.TimeoutMs == 0 {
+		p.TimeoutMs = defaults.TimeoutMs
+	}
+	if p.UDPTimeoutMs == 0 {
+		p.UDPTimeoutMs = defaults.UDPTimeoutMs
+	}
+	if p.Concurrency == 0 {
+		p.Concurrency = defaults.Concurrency
+	}
+	if p.BatchSize == 0 {
+		p.BatchSize = defaults.BatchSize
+	}
+	if p.ProbeOrder == "" {
+		p.ProbeOrder = defaults.ProbeOrder
+	}
+
+	switch {
+	case p.TimeoutMs < 50 || p.TimeoutMs > 10000 || p.UDPTimeoutMs < 50 || p.UDPTimeoutMs > 10000:
+		return fmt.Errorf("timeoutMs and udpTimeoutMs must be between 50 and 10000")
+	case p.Concurrency < 1 || p.Concurrency > 1000:
+		return fmt.Errorf("concurrency must be between 1 and 1000")
+	case p.RetryCount < 0 || p.RetryCount > 5:
+		return fmt.Errorf("retryCount must be between 0 and 5")
+	case p.BatchSize < 100 || p.BatchSize > 65535:
+		return fmt.Errorf("batchSize must be between 100 and 65535")
+	case p.ProbeOrder != ProbeOrderSequential && p.ProbeOrder != ProbeOrderRandom:
+		return fmt.Errorf("probeOrder must be %s or %s", ProbeOrderSequential, ProbeOrderRandom)
+	case p.MaxScanRate < 0:
+		return fmt.Errorf("maxScanRate cannot be negative")
+	}
+	return nil
+}
+
+// TimeoutFor returns the starting per-port timeout for a protocol
+func (p *ScanProfile) TimeoutFor(protocol string) int {
+	if NormalizeProtocol(protocol) == ProtocolUDP {
+		return p.UDPTimeoutMs
+	}
+	return p.TimeoutMs
+}
+
+// BatchSizeFor returns the ports per batch for a port set under the profile.
+// Full range scans keep their larger batches under the default profile.
+func (p *ScanProfile) BatchSizeFor(portSet string) int {
+	if portSet == "full_65k" && p.Name == DefaultScanProfile {
+		return 10000
+	}
+	return p.BatchSize
+}
+
+// WorkerTimeout is the Timeout of WorkerFunction in template.yaml, the
+// longest the worker may take to scan one batch
+const WorkerTimeout = 5 * time.Minute
+
+// MaxRateCappedBatchTime is the longest a batch of a rate capped scan may
+// take to probe its ports. The batches of a capped scan run one after
+// another, each at the scan's whole cap, and hold no more ports than it can
+// probe in this time. A minute of WorkerTimeout is left for the worker to
+// start, grab banners and report the results.
+const MaxRateCappedBatchTime = WorkerTimeout - time.Minute
+
+// RateCappedBatchSize returns the ports per batch of a scan capped at
+// maxScanRate probes per second: batchSize, or fewer when a batch that size
+// could take longer than MaxRateCappedBatchTime. Silent ports are probed
+// again up to retryCount times and retries take rate tokens like first
+// probes, so every port is counted retryCount+1 times. Without a cap,
+// batchSize is returned unchanged.
+func RateCappedBatchSize(batchSize int, retryCount int, maxScanRate int) int {
+	if maxScanRate <= 0 {
+		return batchSize
+	}
+
+	fits := int(MaxRateCappedBatchTime/time.Second) * maxScanRate / (retryCount + 1)
+	if fits < 1 {
+		fits = 1
+	}
+	if batchSize <= 0 || batchSize > fits {
+		return fits
+	}
+	return batchSize
+}
@@ -0,0 +1,62 @@
+// pkg/models/profile_test.go
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateCappedBatchSize(t *testing.T) {
+	tests := []struct {
+		batchSize  int
+		retryCount int
+		maxRate    int
+		want       int
+	}{
+		{batchSize: 4000, retryCount: 2, maxRate: 0, want: 4000},
+		{batchSize: 4000, retryCount: 1, maxRate: 20, want: 2400},
+		{batchSize: 4000, retryCount: 0, maxRate: 20, want: 4000},
+		{batchSize: 10000, retryCount: 0, maxRate: 20, want: 4800},
+		{batchSize: 1000, retryCount: 1, maxRate: 20, want: 1000},
+		{batchSize: 10000, retryCount: 2, maxRate: 125, want: 10000},
+		{batchSize: 10000, retryCount: 2, maxRate: 124, want: 9920},
+		// A batch always holds at least one port
+		{batchSize: 4000, retryCount: 1000, maxRate: 1, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := RateCappedBatchSize(tt.batchSize, tt.retryCount, tt.maxRate); got != tt.want {
+			t.Errorf("RateCappedBatchSize(%d, %d, %d) = %d, want %d",
+				tt.batchSize, tt.retryCount, tt.maxRate, got, tt.want)
+		}
+	}
+}
+
+// TestBuiltinProfilesFitBatches checks that every built-in port set can be
+// scanned under every built-in profile, with capped batches that finish
+// within a worker run
+func TestBuiltinProfilesFitBatches(t *testing.T) {
+	for _, profile := range BuiltinScanProfiles() {
+		for _, portSet := range BuiltinPortSets {
+			ports := len(GetPortSet(portSet))
+			batchSize := RateCappedBatchSize(profile.BatchSizeFor(portSet), profile.RetryCount, profile.MaxScanRate)
+			if batchSize < 1 {
+				t.Errorf("%s with %s: batches of %d ports", profile.Name, portSet, batchSize)
+				continue
+			}
+			if profile.MaxScanRate == 0 {
+				continue
+			}
+
+			probes := batchSize * (profile.RetryCount + 1)
+			if ports < batchSize {
+				probes = ports * (profile.RetryCount + 1)
+			}
+			if duration := time.Duration(probes) * time.Second / time.Duration(profile.MaxScanRate); duration > MaxRateCappedBatchTime {
+				t.Errorf("%s with %s: a batch of %d ports can take %v, more than %v",
+					profile.Name, portSet, batchSize, duration, MaxRateCappedBatchTime)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// pkg/models/scan_job.go
+
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Scan job statuses
+const (
+	ScanStatusQueued    = "queued"    // Batches sent, none reported yet
+	ScanStatusRunning   = "running"   // Some batches reported
+	ScanStatusCompleted = "completed" // Every batch reported
+	ScanStatusPartial   = "partial"   // Some batches were never queued or never reported
+	ScanStatusFailed    = "failed"    // No batch could be queued or none reported
+)
+
+// ScanJobStaleAfter is how long a scan may go without a batch reporting
+// before its missing batches are considered lost. Workers time out after
+// five minutes, so this leaves room for SQS redelivery.
+const ScanJobStaleAfter = 15 * time.Minute
+
+// ScanJob tracks the progress of one scan across its batches
+type ScanJob struct {
+	ScanID          string     `json:"scanId" dynamodbav:"ScanID"`
+	IPAddress       string     `json:"ipAddress" dynamodbav:"IPAddress"`
+	Protocol        string     `json:"protocol" dynamodbav:"Protocol"`
+	PortSet         string     `json:"portSet,omitempty" dynamodbav:"PortSet,omitempty"`
+	Profile         string     `json:"profile,omitempty" dynamodbav:"Profile,omitempty"`
+	ScheduleID      string     `json:"scheduleId,omitempty" dynamodbav:"ScheduleID,omitempty"`     // Schedule that started the scan, if any
+	ScheduleType    string     `json:"scheduleType,omitempty" dynamodbav:"ScheduleType,omitempty"` // hourly, daily and so on, for scheduled scans
+	Status          string     `json:"status" dynamodbav:"Status"`
+	TotalBatches    int        `json:"totalBatches" dynamodbav:"TotalBatches"`
+	BatchesQueued   int        `json:"batchesQueued" dynamodbav:"BatchesQueued"`
+	ReportedBatches []int      `json:"-" dynamodbav:"ReportedBatches,numberset,omitempty"`
+	BatchesDone     int        `json:"batchesDone" dynamodbav:"-"`
+	MissingBatches  []int      `json:"missingBatches,omitempty" dynamodbav:"-"`
+	PortsTotal      int        `json:"portsTotal" dynamodbav:"PortsTotal"`
+	Ports           string     `json:"ports,omitempty" dynamodbav:"Ports,omitempty"` // Every port the scan probes, as a port spec
+	PortsScanned    int        `json:"portsScanned" dynamodbav:"PortsScanned"`
+	OpenPortsFound  int        `json:"openPortsFound" dynamodbav:"OpenPortsFound"`
+	CreatedAt       time.Time  `json:"createdAt" dynamodbav:"CreatedAt"`
+	UpdatedAt       time.Time  `json:"updatedAt" dynamodbav:"UpdatedAt"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty" dynamodbav:"CompletedAt,omitempty"`
+	ExpirationTime  int64      `json:"-" dynamodbav:"ExpirationTime,omitempty"`
+	FinalizedAt     *time.Time `json:"finalizedAt,omitempty" dynamodbav:"FinalizedAt,omitempty"`
+	Error           string     `json:"error,omitempty" dynamodbav:"Error,omitempty"` // Why the scan could not be started
+}
+
+// ScanBatchResult is what one batch of a scan reported. Each batch is kept
+// in an item of its own until the scan is finalised, so the summary covers
+// every batch whatever order they arrive in.
+type ScanBatchResult struct {
+	ScanID         string          `dynamodbav:"ScanID"`
+	BatchID        int             `dynamodbav:"BatchID"`
+	PortsScanned   int             `dynamodbav:"PortsScanned"`
+	OpenPorts      []Port          `dynamodbav:"OpenPorts"`
+	WatchedPorts   []Port          `dynamodbav:"WatchedPorts,omitempty"` // Current state of previously open ports
+	StateCounts    PortStateCounts `dynamodbav:"StateCounts"`
+	DurationMs     int64           `dynamodbav:"DurationMs"`
+	ExpirationTime int64           `dynamodbav:"ExpirationTime,omitempty"`
+}
+
+// Finished reports whether the job has reached a terminal status
+func (j *ScanJob) Finished() bool {
+	switch j.Status {
+	case ScanStatusCompleted, ScanStatusPartial, ScanStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Refresh fills in the derived progress fields and, for a job that has not
+// heard from a batch within ScanJobStaleAfter, reports the missing batches
+// as lost
+func (j *ScanJob) Refresh(now time.Time) {
+	reported := make(map[int]bool, len(j.ReportedBatches))
+	for _, batchID := range j.ReportedBatches {
+		reported[batchID] = true
+	}
+	j.BatchesDone = len(reported)
+
+	j.MissingBatches = nil
+	for batchID := 0; batchID < j.TotalBatches; batchID++ {
+		if !reported[batchID] {
+			j.MissingBatches = append(j.MissingBatches, batchID)
+		}
+	}
+	sort.Ints(j.MissingBatches)
+
+	if !j.Finished() && now.Sub(j.UpdatedAt) > ScanJobStaleAfter {
+		if j.BatchesDone > 0 {
+			j.Status = ScanStatusPartial
+		} else {
+			j.Status = ScanStatusFailed
+		}
+	}
+}
+
+// CompletionStatus returns the terminal status once every queued batch has
+// reported, or an empty string while batches are outstanding
+func (j *ScanJob) CompletionStatus() string {
+	if j.BatchesQueued == 0 {
+		return ScanStatusFailed
+	}
+	if len(j.ReportedBatches) < j.BatchesQueued {
+		return ""
+	}
+	if j.BatchesQueued < j.TotalBatches {
+		return ScanStatusPartial
+	}
+	return ScanStatusCompleted
+}
+
+// AggregateBatches merges the findings of the batches of a scan. Open ports
+// are deduplicated and sorted; the duration is that of the slowest batch,
+// since batches run in parallel.
+func AggregateBatches(batches []ScanBatchResult) ScanBatchResult {
+	var merged ScanBatchResult
+	seen := make(map[int]bool)
+
+	for _, batch := range batches {
+		merged.PortsScanned += batch.PortsScanned
+		merged.StateCounts.Merge(batch.StateCounts)
+		if batch.DurationMs > merged.DurationMs {
+			merged.DurationMs = batch.DurationMs
+		}
+		merged.WatchedPorts = append(merged.WatchedPorts, batch.WatchedPorts...)
+		for _, port := range batch.OpenPorts {
+			if seen[port.Number] {
+				continue
+			}
+			seen[port.Number] = true
+			merged.OpenPorts = append(merged.OpenPorts, port)
+		}
+	}
+
+	sort.Slice(merged.OpenPorts, func(a, b int) bool {
+		return merged.OpenPorts[a].Number < merged.OpenPorts[b].Number
+	})
+	return merged
+}
@@ -0,0 +1,294 @@
+// pkg/models/schedule_timing.go
+
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScheduleTypeCron marks schedules driven by a cron expression rather than
+// one of the fixed schedule types
+const ScheduleTypeCron = "cron"
+
+// ScheduleTypes lists the fixed schedule types
+var ScheduleTypes = []string{"hourly", "12hour", "daily", "weekly", "monthly"}
+
+// scheduleTypeExpressions keeps the fixed schedule types running at their
+// original interval from the previous run
+var scheduleTypeExpressions = map[string]string{
+	"hourly":  "@every 1h",
+	"12hour":  "@every 12h",
+	"daily":   "@every 24h",
+	"weekly":  "@every 168h",
+	"monthly": "@every 720h",
+}
+
+// blackoutDateLayout is the format of blackout dates
+const blackoutDateLayout = "2006-01-02"
+
+// maxDeferral bounds how far windows and blackout dates can push a run
+const maxDeferral = 400
+
+// ScanWindow is a time of day during which scans may start, in the
+// schedule's time zone. End is exclusive; an End before Start spans
+// midnight and belongs to the day it starts.
+type ScanWindow struct {
+	Days  []string `json:"days,omitempty" dynamodbav:"Days,omitempty"` // mon..sun, weekdays or weekends; empty means every day
+	Start string   `json:"start" dynamodbav:"Start"`                   // HH:MM
+	End   string   `json:"end" dynamodbav:"End"`                       // HH:MM
+}
+
+// ScheduleTiming describes when a schedule runs
+type ScheduleTiming struct {
+	CronExpression string       `json:"cronExpression,omitempty" dynamodbav:"CronExpression,omitempty"`
+	Timezone       string       `json:"timezone,omitempty" dynamodbav:"Timezone,omitempty"`           // IANA name, defaults to UTC
+	Windows        []ScanWindow `json:"windows,omitempty" dynamodbav:"Windows,omitempty"`             // Empty allows any time
+	BlackoutDates  []string     `json:"blackoutDates,omitempty" dynamodbav:"BlackoutDates,omitempty"` // YYYY-MM-DD in the schedule's time zone
+}
+
+// IsScheduleType reports whether scheduleType is a fixed schedule type
+func IsScheduleType(scheduleType string) bool {
+	_, ok := scheduleTypeExpressions[scheduleType]
+	return ok
+}
+
+// ResolveScheduleTiming validates the schedule type and timing of a new or
+// updated schedule. A fixed schedule type runs at its interval; a cron
+// expression makes the schedule a cron schedule. Either can have a time
+// zone, scan windows and blackout dates.
+func ResolveScheduleTiming(scheduleType string, timing ScheduleTiming) (string, ScheduleTiming, error) {
+	switch {
+	case timing.CronExpression != "":
+		if scheduleType != "" && scheduleType != ScheduleTypeCron {
+			return "", timing, fmt.Errorf("scheduleType must be %q or omitted when cronExpression is set", ScheduleTypeCron)
+		}
+		scheduleType = ScheduleTypeCron
+	case IsScheduleType(scheduleType):
+		// Runs at the interval of its type
+	case scheduleType == ScheduleTypeCron:
+		return "", timing, fmt.Errorf("cronExpression is required for cron schedules")
+	default:
+		return "", timing, fmt.Errorf("invalid schedule type: must be one of %s, or set a cronExpression",
+			strings.Join(ScheduleTypes, ", "))
+	}
+
+	if err := timing.ForScheduleType(scheduleType).Validate(); err != nil {
+		return "", timing, err
+	}
+	return scheduleType, timing, nil
+}
+
+// ForScheduleType fills in the expression of a fixed schedule type, for
+// schedules stored before cron expressions existed
+func (t ScheduleTiming) ForScheduleType(scheduleType string) ScheduleTiming {
+	if t.CronExpression == "" {
+		t.CronExpression = scheduleTypeExpressions[scheduleType]
+		if t.CronExpression == "" {
+			t.CronExpression = scheduleTypeExpressions["daily"]
+		}
+	}
+	return t
+}
+
+// Validate checks the expression, time zone, windows and blackout dates, and
+// that they leave at least one run in the coming year
+func (t ScheduleTiming) Validate() error {
+	if _, err := ParseCron(t.CronExpression); err != nil {
+		return err
+	}
+	if _, err := t.location(); err != nil {
+		return err
+	}
+	for _, window := range t.Windows {
+		if _, _, err := window.bounds(); err != nil {
+			return err
+		}
+		if _, err := window.weekdays(); err != nil {
+			return err
+		}
+	}
+	for _, date := range t.BlackoutDates {
+		if _, err := time.Parse(blackoutDateLayout, date); err != nil {
+			return fmt.Errorf("invalid blackout date %q: must be YYYY-MM-DD", date)
+		}
+	}
+
+	if _, err := t.Next(time.Now()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Next returns the first run after the given time. A run that falls outside
+// every window is deferred to the start of the next window, and runs on
+// blackout dates are skipped.
+func (t ScheduleTiming) Next(after time.Time) (time.Time, error) {
+	expr, err := ParseCron(t.CronExpression)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := t.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	run := expr.Next(after.In(loc))
+	for i := 0; i < maxDeferral && !run.IsZero(); i++ {
+		if t.Allows(run) {
+			return run.UTC(), nil
+		}
+
+		if len(t.Windows) > 0 {
+			run = t.nextWindowStart(run)
+			continue
+		}
+
+		// Only a blackout date is in the way; resume at the end of it
+		local := run.In(loc)
+		dayEnd := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+		if expr.Interval() > 0 {
+			run = dayEnd
+		} else {
+			run = expr.Next(dayEnd.Add(-time.Second))
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("schedule has no run in the coming year within its windows and blackout dates")
+}
+
+// Allows reports whether a scan may start at the given time
+func (t ScheduleTiming) Allows(at time.Time) bool {
+	loc, err := t.location()
+	if err != nil {
+		return false
+	}
+	local := at.In(loc)
+
+	if t.blackedOut(local) {
+		return false
+	}
+	if len(t.Windows) == 0 {
+		return true
+	}
+
+	// A window that spans midnight may have opened the previous day
+	for _, offset := range []int{0, -1} {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		for _, window := range t.Windows {
+			start, end, ok := window.on(day)
+			if ok && !local.Before(start) && local.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nextWindowStart returns the earliest window opening after the given time
+// on a date that is not blacked out
+func (t ScheduleTiming) nextWindowStart(after time.Time) time.Time {
+	loc, _ := t.location()
+	local := after.In(loc)
+
+	for offset := 0; offset < maxDeferral; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		var earliest time.Time
+		for _, window := range t.Windows {
+			start, _, ok := window.on(day)
+			if !ok || !start.After(local) || t.blackedOut(start) {
+				continue
+			}
+			if earliest.IsZero() || start.Before(earliest) {
+				earliest = start
+			}
+		}
+		if !earliest.IsZero() {
+			return earliest
+		}
+	}
+	return time.Time{}
+}
+
+func (t ScheduleTiming) blackedOut(local time.Time) bool {
+	date := local.Format(blackoutDateLayout)
+	for _, blackout := range t.BlackoutDates {
+		if blackout == date {
+			return true
+		}
+	}
+	return false
+}
+
+func (t ScheduleTiming) location() (*time.Location, error) {
+	if t.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(t.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", t.Timezone)
+	}
+	return loc, nil
+}
+
+// on returns the window's opening and closing times for a day, and false if
+// the window does not open that day
+func (w ScanWindow) on(day time.Time) (time.Time, time.Time, bool) {
+	days, err := w.weekdays()
+	if err != nil || (len(days) > 0 && !days[day.Weekday()]) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	startMin, endMin, err := w.bounds()
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if endMin <= startMin {
+		endMin += 24 * 60
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, startMin, 0, 0, day.Location())
+	end := time.Date(day.Year(), day.Month(), day.Day(), 0, endMin, 0, 0, day.Location())
+	return start, end, true
+}
+
+// bounds returns the window's start and end as minutes after midnight
+func (w ScanWindow) bounds() (int, int, error) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid window start %q: must be HH:MM", w.Start)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid window end %q: must be HH:MM", w.End)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+// weekdays returns the days the window opens, or nil for every day
+func (w ScanWindow) weekdays() (map[time.Weekday]bool, error) {
+	if len(w.Days) == 0 {
+		return nil, nil
+	}
+
+	days := make(map[time.Weekday]bool)
+	for _, day := range w.Days {
+		switch name := strings.ToLower(day); name {
+		case "weekdays":
+			for d := time.Monday; d <= time.Friday; d++ {
+				days[d] = true
+			}
+		case "weekends":
+			days[time.Saturday] = true
+			days[time.Sunday] = true
+		default:
+			n, ok := weekdayNames[name]
+			if !ok {
+				return nil, fmt.Errorf("invalid window day %q: must be mon..sun, weekdays or weekends", day)
+			}
+			days[time.Weekday(n)] = true
+		}
+	}
+	return days, nil
+}
@@ -0,0 +1,194 @@
+// pkg/models/schedule_timing_test.go
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveScheduleTiming(t *testing.T) {
+	tests := []struct {
+		scheduleType string
+		timing       ScheduleTiming
+		wantType     string
+		wantErr      bool
+	}{
+		{scheduleType: "daily", wantType: "daily"},
+		{scheduleType: "hourly", timing: ScheduleTiming{Timezone: "Europe/London"}, wantType: "hourly"},
+		{timing: ScheduleTiming{CronExpression: "0 2 * * *"}, wantType: ScheduleTypeCron},
+		{scheduleType: ScheduleTypeCron, timing: ScheduleTiming{CronExpression: "@every 6h"}, wantType: ScheduleTypeCron},
+		{scheduleType: ScheduleTypeCron, wantErr: true},
+		{scheduleType: "daily", timing: ScheduleTiming{CronExpression: "0 2 * * *"}, wantErr: true},
+		{scheduleType: "fortnightly", wantErr: true},
+		{scheduleType: "", wantErr: true},
+		{timing: ScheduleTiming{CronExpression: "0 2 * *"}, wantErr: true},
+		{timing: ScheduleTiming{CronExpression: "0 0 30 2 *"}, wantErr: true},
+		{scheduleType: "daily", timing: ScheduleTiming{Timezone: "Mars/Olympus"}, wantErr: true},
+		{scheduleType: "daily", timing: ScheduleTiming{Windows: []ScanWindow{{Start: "22:00", End: "02:00"}}}, wantType: "daily"},
+		{scheduleType: "daily", timing: ScheduleTiming{Windows: []ScanWindow{{Start: "25:00", End: "02:00"}}}, wantErr: true},
+		{scheduleType: "daily", timing: ScheduleTiming{Windows: []ScanWindow{{Start: "22:00", End: "2am"}}}, wantErr: true},
+		{scheduleType: "daily", timing: ScheduleTiming{Windows: []ScanWindow{{Days: []string{"weekdays", "sat"}, Start: "22:00", End: "02:00"}}}, wantType: "daily"},
+		{scheduleType: "daily", timing: ScheduleTiming{Windows: []ScanWindow{{Days: []string{"someday"}, Start: "22:00", End: "02:00"}}}, wantErr: true},
+		{scheduleType: "daily", timing: ScheduleTiming{BlackoutDates: []string{"2026-12-25"}}, wantType: "daily"},
+		{scheduleType: "daily", timing: ScheduleTiming{BlackoutDates: []string{"25/12/2026"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, _, err := ResolveScheduleTiming(tt.scheduleType, tt.timing)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveScheduleTiming(%q, %+v) error = %v, want error %v", tt.scheduleType, tt.timing, err, tt.wantErr)
+			continue
+		}
+		if got != tt.wantType {
+			t.Errorf("ResolveScheduleTiming(%q, %+v) = %q, want %q", tt.scheduleType, tt.timing, got, tt.wantType)
+		}
+	}
+}
+
+func TestScheduleTimingAllows(t *testing.T) {
+	overnight := []ScanWindow{{Days: []string{"fri"}, Start: "22:00", End: "02:00"}}
+
+	// 16 October 2026 is a Friday
+	tests := []struct {
+		timing ScheduleTiming
+		at     string
+		want   bool
+	}{
+		{ScheduleTiming{}, "2026-10-16 12:00", true},
+		{ScheduleTiming{Windows: overnight}, "2026-10-16 21:59", false},
+		{ScheduleTiming{Windows: overnight}, "2026-10-16 22:00", true},
+		// The window opened on Friday runs into Saturday
+		{ScheduleTiming{Windows: overnight}, "2026-10-17 01:59", true},
+		{ScheduleTiming{Windows: overnight}, "2026-10-17 02:00", false},
+		{ScheduleTiming{Windows: overnight}, "2026-10-17 22:00", false},
+		{ScheduleTiming{Windows: overnight}, "2026-10-18 01:00", false},
+		{ScheduleTiming{Windows: []ScanWindow{{Days: []string{"weekends"}, Start: "00:00", End: "00:00"}}}, "2026-10-16 23:59", false},
+		{ScheduleTiming{Windows: []ScanWindow{{Days: []string{"weekends"}, Start: "00:00", End: "00:00"}}}, "2026-10-17 00:00", true},
+		{ScheduleTiming{Windows: []ScanWindow{{Days: []string{"weekdays"}, Start: "09:00", End: "17:00"}}}, "2026-10-16 16:59", true},
+		{ScheduleTiming{Windows: []ScanWindow{{Days: []string{"weekdays"}, Start: "09:00", End: "17:00"}}}, "2026-10-17 12:00", false},
+		{ScheduleTiming{BlackoutDates: []string{"2026-10-16"}}, "2026-10-16 12:00", false},
+		{ScheduleTiming{BlackoutDates: []string{"2026-10-16"}}, "2026-10-17 00:00", true},
+		// Blackout dates are days in the schedule's time zone
+		{ScheduleTiming{Timezone: "America/New_York", BlackoutDates: []string{"2026-10-16"}}, "2026-10-17 03:59", false},
+		{ScheduleTiming{Timezone: "America/New_York", BlackoutDates: []string{"2026-10-16"}}, "2026-10-17 04:00", true},
+	}
+
+	for _, tt := range tests {
+		at, err := time.Parse("2006-01-02 15:04", tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.timing.Timezone != "" {
+			newYork(t)
+		}
+		if got := tt.timing.Allows(at); got != tt.want {
+			t.Errorf("%+v allows %s = %v, want %v", tt.timing, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleTimingNext(t *testing.T) {
+	overnight := []ScanWindow{{Days: []string{"fri"}, Start: "22:00", End: "02:00"}}
+
+	tests := []struct {
+		name   string
+		timing ScheduleTiming
+		after  string
+		want   string
+	}{
+		{
+			name:   "no windows",
+			timing: ScheduleTiming{CronExpression: "0 9 * * *"},
+			after:  "2026-10-16 09:00", want: "2026-10-17 09:00",
+		},
+		{
+			name:   "run inside a window that crosses midnight",
+			timing: ScheduleTiming{CronExpression: "0 1 * * *", Windows: overnight},
+			after:  "2026-10-16 12:00", want: "2026-10-17 01:00",
+		},
+		{
+			name:   "run outside the window waits for it to open",
+			timing: ScheduleTiming{CronExpression: "0 1 * * *", Windows: overnight},
+			after:  "2026-10-17 01:00", want: "2026-10-23 22:00",
+		},
+		{
+			name:   "interval outside the window waits for it to open",
+			timing: ScheduleTiming{CronExpression: "@every 1h", Windows: []ScanWindow{{Start: "22:00", End: "02:00"}}},
+			after:  "2026-10-17 01:30", want: "2026-10-17 22:00",
+		},
+		{
+			name:   "blackout date skips the run",
+			timing: ScheduleTiming{CronExpression: "0 9 * * *", BlackoutDates: []string{"2026-10-17"}},
+			after:  "2026-10-16 09:00", want: "2026-10-18 09:00",
+		},
+		{
+			name:   "blackout dates in a row",
+			timing: ScheduleTiming{CronExpression: "0 9 * * *", BlackoutDates: []string{"2026-10-17", "2026-10-18"}},
+			after:  "2026-10-16 09:00", want: "2026-10-19 09:00",
+		},
+		{
+			name:   "interval resumes when the blackout date ends",
+			timing: ScheduleTiming{CronExpression: "@every 24h", BlackoutDates: []string{"2026-10-17"}},
+			after:  "2026-10-16 09:00", want: "2026-10-18 00:00",
+		},
+		{
+			name:   "window on a blackout date is skipped",
+			timing: ScheduleTiming{CronExpression: "0 23 * * *", Windows: []ScanWindow{{Start: "22:00", End: "02:00"}}, BlackoutDates: []string{"2026-10-17"}},
+			after:  "2026-10-16 23:00", want: "2026-10-18 22:00",
+		},
+		{
+			name:   "time zone",
+			timing: ScheduleTiming{CronExpression: "0 9 * * *", Timezone: "America/New_York"},
+			after:  "2026-10-16 13:00", want: "2026-10-17 13:00",
+		},
+		{
+			name:   "time zone across the start of daylight saving",
+			timing: ScheduleTiming{CronExpression: "0 9 * * *", Timezone: "America/New_York"},
+			after:  "2026-03-07 14:00", want: "2026-03-08 13:00",
+		},
+		{
+			name:   "time zone across the end of daylight saving",
+			timing: ScheduleTiming{CronExpression: "30 1 * * *", Timezone: "America/New_York"},
+			after:  "2026-11-01 05:30", want: "2026-11-02 06:30",
+		},
+		{
+			name:   "blackout date in the schedule's time zone",
+			timing: ScheduleTiming{CronExpression: "0 22 * * *", Timezone: "America/New_York", BlackoutDates: []string{"2026-10-17"}},
+			after:  "2026-10-17 03:00", want: "2026-10-19 02:00",
+		},
+		{
+			name:   "fixed schedule type",
+			timing: ScheduleTiming{}.ForScheduleType("12hour"),
+			after:  "2026-10-16 09:30", want: "2026-10-16 21:30",
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.timing.Timezone != "" {
+			newYork(t)
+		}
+		after, err := time.Parse("2006-01-02 15:04", tt.after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := time.Parse("2006-01-02 15:04", tt.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := tt.timing.Next(after)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("%s: next run after %s = %s, want %s", tt.name, tt.after, got, want)
+		}
+	}
+
+	// A cron expression that never matches leaves no run
+	if _, err := (ScheduleTiming{CronExpression: "0 0 30 2 *"}).Next(time.Now()); err == nil {
+		t.Error("next run of 30 February succeeded, want an error")
+	}
+}
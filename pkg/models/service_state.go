@@ -0,0 +1,115 @@
+// pkg/models/service_state.go
+
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Enrichment fields whose changes are tracked
+const (
+	FieldTitle                  = "title"
+	FieldServer                 = "server"
+	FieldStatusCode             = "statusCode"
+	FieldCertificateFingerprint = "certificateFingerprint"
+)
+
+// TrackedFields lists every enrichment field whose changes are tracked
+var TrackedFields = []string{FieldTitle, FieldServer, FieldStatusCode, FieldCertificateFingerprint}
+
+// ServiceState is the latest enrichment of one open port of an IP. It is
+// replaced by every enrichment that gets an answer from the port and kept
+// after the enrichment results it came from expire.
+type ServiceState struct {
+	IPAddress              string    `json:"ipAddress" dynamodbav:"IPAddress"`
+	Port                   int       `json:"port" dynamodbav:"Port"`
+	Service                string    `json:"service,omitempty" dynamodbav:"Service,omitempty"` // Service a module identified, such as ssh
+	URL                    string    `json:"url,omitempty" dynamodbav:"URL,omitempty"`
+	StatusCode             int       `json:"statusCode,omitempty" dynamodbav:"StatusCode,omitempty"`
+	Title                  string    `json:"title,omitempty" dynamodbav:"Title,omitempty"`
+	Server                 string    `json:"server,omitempty" dynamodbav:"Server,omitempty"`
+	Technologies           []string  `json:"technologies,omitempty" dynamodbav:"Technologies,omitempty"`
+	TLSVersions            []string  `json:"tlsVersions,omitempty" dynamodbav:"TLSVersions,omitempty"`
+	CertificateFingerprint string    `json:"certificateFingerprint,omitempty" dynamodbav:"CertificateFingerprint,omitempty"` // SHA-256 of the leaf
+	CertificateSubjectCN   string    `json:"certificateSubjectCn,omitempty" dynamodbav:"CertificateSubjectCN,omitempty"`
+	CertificateNotAfter    string    `json:"certificateNotAfter,omitempty" dynamodbav:"CertificateNotAfter,omitempty"`
+	ScanID                 string    `json:"scanId" dynamodbav:"ScanID"` // Scan whose enrichment this is
+	FirstSeen              time.Time `json:"firstSeen" dynamodbav:"FirstSeen"`
+	LastSeen               time.Time `json:"lastSeen" dynamodbav:"LastSeen"`
+	LastChanged            time.Time `json:"lastChanged" dynamodbav:"LastChanged"` // Last time a tracked field changed, FirstSeen if none has
+}
+
+// EnrichmentChange records a tracked field of a port that differed from
+// the port's previous enrichment
+type EnrichmentChange struct {
+	IPAddress      string    `json:"ipAddress" dynamodbav:"IPAddress"`
+	ChangeID       string    `json:"changeId" dynamodbav:"ChangeID"` // DetectedAt, port and field, so changes sort by time
+	Port           int       `json:"port" dynamodbav:"Port"`
+	Field          string    `json:"field" dynamodbav:"Field"`
+	Previous       string    `json:"previous" dynamodbav:"Previous"`
+	Current        string    `json:"current" dynamodbav:"Current"`
+	ScanID         string    `json:"scanId" dynamodbav:"ScanID"`
+	PreviousScanID string    `json:"previousScanId" dynamodbav:"PreviousScanID"`
+	DetectedAt     time.Time `json:"detectedAt" dynamodbav:"DetectedAt"`
+}
+
+// NewEnrichmentChangeID builds the sort key for a change of a field of a port
+func NewEnrichmentChangeID(detectedAt time.Time, port int, field string) string {
+	return fmt.Sprintf("%s#%05d#%s", detectedAt.UTC().Format(time.RFC3339), port, field)
+}
+
+// TrackedValue returns the value of a tracked field as it is recorded in
+// changes. A status code of zero, for a port that did not answer HTTP, is
+// empty.
+func (s *ServiceState) TrackedValue(field string) string {
+	switch field {
+	case FieldTitle:
+		return s.Title
+	case FieldServer:
+		return s.Server
+	case FieldStatusCode:
+		if s.StatusCode == 0 {
+			return ""
+		}
+		return strconv.Itoa(s.StatusCode)
+	case FieldCertificateFingerprint:
+		return s.CertificateFingerprint
+	}
+	return ""
+}
+
+// DiffServiceState returns a change for each tracked field that differs
+// between two enrichments of a port, detected at the current one's LastSeen
+func DiffServiceState(previous *ServiceState, current *ServiceState) []EnrichmentChange {
+	var changes []EnrichmentChange
+	for _, field := range TrackedFields {
+		before, after := previous.TrackedValue(field), current.TrackedValue(field)
+		if before == after {
+			continue
+		}
+		changes = append(changes, EnrichmentChange{
+			IPAddress:      current.IPAddress,
+			ChangeID:       NewEnrichmentChangeID(current.LastSeen, current.Port, field),
+			Port:           current.Port,
+			Field:          field,
+			Previous:       before,
+			Current:        after,
+			ScanID:         current.ScanID,
+			PreviousScanID: previous.ScanID,
+			DetectedAt:     current.LastSeen,
+		})
+	}
+	return changes
+}
+
+// IsTrackedField reports whether changes of a field are tracked
+func IsTrackedField(field string) bool {
+	for _, tracked := range TrackedFields {
+		if field == tracked {
+			return true
+		}
+	}
+	return false
+}
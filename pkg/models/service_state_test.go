@@ -0,0 +1,89 @@
+// pkg/models/service_state_test.go
+
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffServiceState(t *testing.T) {
+	seen := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	previous := ServiceState{
+		IPAddress:              "10.0.0.1",
+		Port:                   443,
+		StatusCode:             200,
+		Title:                  "Welcome",
+		Server:                 "nginx",
+		CertificateFingerprint: "aa",
+		ScanID:                 "scan-1",
+	}
+	change := func(field, before, after string) EnrichmentChange {
+		return EnrichmentChange{
+			IPAddress:      "10.0.0.1",
+			ChangeID:       "2026-03-01T12:00:00Z#00443#" + field,
+			Port:           443,
+			Field:          field,
+			Previous:       before,
+			Current:        after,
+			ScanID:         "scan-2",
+			PreviousScanID: "scan-1",
+			DetectedAt:     seen,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		update func(s *ServiceState)
+		want   []EnrichmentChange
+	}{
+		{
+			name:   "same",
+			update: func(s *ServiceState) {},
+		},
+		{
+			name: "untracked fields",
+			update: func(s *ServiceState) {
+				s.Technologies = []string{"Nginx"}
+				s.TLSVersions = []string{"tls13"}
+				s.CertificateNotAfter = "2027-01-01T00:00:00Z"
+			},
+		},
+		{
+			name:   "title",
+			update: func(s *ServiceState) { s.Title = "Sign in" },
+			want:   []EnrichmentChange{change(FieldTitle, "Welcome", "Sign in")},
+		},
+		{
+			name: "every tracked field, in order",
+			update: func(s *ServiceState) {
+				s.CertificateFingerprint = "bb"
+				s.StatusCode = 302
+				s.Server = "Apache"
+				s.Title = ""
+			},
+			want: []EnrichmentChange{
+				change(FieldTitle, "Welcome", ""),
+				change(FieldServer, "nginx", "Apache"),
+				change(FieldStatusCode, "200", "302"),
+				change(FieldCertificateFingerprint, "aa", "bb"),
+			},
+		},
+		{
+			name:   "stopped answering HTTP",
+			update: func(s *ServiceState) { s.StatusCode = 0 },
+			want:   []EnrichmentChange{change(FieldStatusCode, "200", "")},
+		},
+	}
+
+	for _, tt := range tests {
+		current := previous
+		current.ScanID = "scan-2"
+		current.LastSeen = seen
+		tt.update(&current)
+		if got := DiffServiceState(&previous, &current); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
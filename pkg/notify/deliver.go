@@ -0,0 +1,235 @@
+// pkg/notify/deliver.go
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Delivery retry settings
+const (
+	MaxAttempts    = 4
+	InitialBackoff = 2 * time.Second
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body, as
+// "sha256=<hex>", when the channel has a secret
+const SignatureHeader = "X-NexusScan-Signature"
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// smtpTimeout bounds a whole email delivery, from dialling the server to
+// quitting
+const smtpTimeout = 30 * time.Second
+
+// permanentError marks a failure that retrying cannot fix, such as a 4xx response
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// DeliverWithRetry sends an event to a channel, retrying transient failures
+// with exponential backoff. It returns the number of attempts made and the
+// last error when every attempt failed.
+func DeliverWithRetry(ctx context.Context, channel *models.NotificationChannel, event *models.NotificationEvent) (int, error) {
+	backoff := InitialBackoff
+	var err error
+
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		if err = Deliver(ctx, channel, event); err == nil {
+			return attempt, nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt == MaxAttempts {
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return MaxAttempts, err
+}
+
+// Deliver sends an event to a channel once
+func Deliver(ctx context.Context, channel *models.NotificationChannel, event *models.NotificationEvent) error {
+	switch channel.Type {
+	case models.ChannelWebhook:
+		return sendWebhook(ctx, channel, event)
+	case models.ChannelSlack:
+		return sendSlack(ctx, channel, event)
+	case models.ChannelEmail:
+		return sendEmail(ctx, channel, event)
+	default:
+		return &permanentError{fmt.Errorf("unknown channel type %q", channel.Type)}
+	}
+}
+
+// Sign returns the signature of a webhook body for the given secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook posts the event as JSON, signed when the channel has a secret
+func sendWebhook(ctx context.Context, channel *models.NotificationChannel, event *models.NotificationEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return &permanentError{err}
+	}
+
+	headers := map[string]string{"X-NexusScan-Event": event.Type}
+	if channel.Secret != "" {
+		headers[SignatureHeader] = Sign(channel.Secret, body)
+	}
+	return post(ctx, channel.URL, body, headers)
+}
+
+// sendSlack posts the event summary as a Slack incoming webhook message
+func sendSlack(ctx context.Context, channel *models.NotificationChannel, event *models.NotificationEvent) error {
+	text := fmt.Sprintf("*NexusScan %s*\n%s", strings.ReplaceAll(event.Type, "_", " "), event.Summary)
+	if event.ScanID != "" {
+		text += fmt.Sprintf("\nScan: `%s`", event.ScanID)
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return &permanentError{err}
+	}
+	return post(ctx, channel.URL, body, nil)
+}
+
+// post sends a JSON body and classifies the response. Rate limiting and
+// server errors are retried; other 4xx responses are permanent.
+func post(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NexusScan-Notifier")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	default:
+		return &permanentError{fmt.Errorf("%s returned %s", url, resp.Status)}
+	}
+}
+
+// sendEmail sends the event through the channel's SMTP server, upgrading to
+// STARTTLS when the server offers it. The delivery gives up after
+// smtpTimeout or when ctx is done, so a stuck server cannot hold the
+// notifier.
+func sendEmail(ctx context.Context, channel *models.NotificationChannel, event *models.NotificationEvent) error {
+	port := channel.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(channel.SMTPHost, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if channel.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", channel.SMTPUsername, channel.SMTPPassword, channel.SMTPHost)
+	}
+
+	details, _ := json.MarshalIndent(event, "", "  ")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", channel.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(channel.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [NexusScan] %s\r\n", event.Summary)
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.OccurredAt.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n%s\r\n", event.Summary, details)
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, channel.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	// The steps of smtp.SendMail, on a connection with a deadline
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: channel.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return &permanentError{fmt.Errorf("SMTP server %s does not support authentication", addr)}
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(channel.From); err != nil {
+		return err
+	}
+	for _, to := range channel.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
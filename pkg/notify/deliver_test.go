@@ -0,0 +1,60 @@
+// pkg/notify/deliver_test.go
+
+package notify
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// TestSendEmailStuckServer checks that an SMTP server that accepts the
+// connection but never greets does not hold a delivery past its context
+func TestSendEmailStuckServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	channel := &models.NotificationChannel{
+		Type:     models.ChannelEmail,
+		SMTPHost: host,
+		SMTPPort: portNumber,
+		From:     "nexusscan@example.com",
+		To:       []string{"security@example.com"},
+	}
+	event := &models.NotificationEvent{Type: "scan_finished", Summary: "test", OccurredAt: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := Deliver(ctx, channel, event); err == nil {
+		t.Fatal("delivery to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("delivery gave up after %v, want about 200ms", elapsed)
+	}
+}
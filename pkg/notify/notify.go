@@ -0,0 +1,80 @@
+// pkg/notify/notify.go
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/platform"
+	"github.com/Elite-Security-Systems/nexusscan/pkg/targets"
+	"github.com/google/uuid"
+)
+
+// Publish queues an event for the notifier. Events are dropped with a log
+// line when NOTIFICATIONS_QUEUE_URL is not set, so notifications stay
+// optional for the functions that emit them.
+func Publish(ctx context.Context, queues platform.Queues, event *models.NotificationEvent) error {
+	queueURL := os.Getenv("NOTIFICATIONS_QUEUE_URL")
+	if queueURL == "" {
+		log.Printf("NOTIFICATIONS_QUEUE_URL not set, dropping %s event for %s", event.Type, event.IPAddress)
+		return nil
+	}
+
+	if event.EventID == "" {
+		event.EventID = uuid.New().String()
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = queues.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+// Matches reports whether a rule applies to an event. A rule with no event
+// types, no targets or no selector matches every event type or every IP
+// respectively. asset is the inventory entry of the event's IP, which rules
+// with a selector are matched against; they match nothing when it is nil.
+func Matches(rule *models.NotificationRule, event *models.NotificationEvent, asset *models.IP) bool {
+	if !rule.Enabled {
+		return false
+	}
+
+	if len(rule.EventTypes) > 0 && !contains(rule.EventTypes, event.Type) {
+		return false
+	}
+
+	if rule.HasSelector() && (asset == nil || !rule.Selector.Matches(*asset)) {
+		return false
+	}
+
+	if len(rule.Targets) == 0 {
+		return true
+	}
+	for _, spec := range rule.Targets {
+		if targets.Match(spec, event.IPAddress) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
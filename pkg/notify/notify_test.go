@@ -0,0 +1,86 @@
+// pkg/notify/notify_test.go
+
+package notify
+
+import (
+	"testing"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+func TestMatches(t *testing.T) {
+	production := &models.IP{
+		IPAddress: "10.0.0.5",
+		AssetMetadata: models.AssetMetadata{
+			Group: "production",
+			Owner: "web-team",
+			Tags:  map[string]string{"env": "prod", "pci": ""},
+		},
+	}
+	staging := &models.IP{
+		IPAddress:     "10.0.0.5",
+		AssetMetadata: models.AssetMetadata{Group: "staging"},
+	}
+	event := &models.NotificationEvent{Type: models.EventPortsChanged, IPAddress: "10.0.0.5"}
+
+	tests := []struct {
+		name  string
+		rule  models.NotificationRule
+		asset *models.IP
+		want  bool
+	}{
+		{name: "empty rule", rule: models.NotificationRule{Enabled: true}, want: true},
+		{name: "disabled", rule: models.NotificationRule{}, want: false},
+		{name: "other event type", rule: models.NotificationRule{Enabled: true, EventTypes: []string{models.EventScanFinished}}, want: false},
+		{name: "target block", rule: models.NotificationRule{Enabled: true, Targets: []string{"10.0.0.0/24"}}, want: true},
+		{name: "other target", rule: models.NotificationRule{Enabled: true, Targets: []string{"192.168.0.0/16"}}, want: false},
+		{
+			name:  "group",
+			rule:  models.NotificationRule{Enabled: true, Selector: &models.AssetSelector{Group: "production"}},
+			asset: production,
+			want:  true,
+		},
+		{
+			name:  "other group",
+			rule:  models.NotificationRule{Enabled: true, Selector: &models.AssetSelector{Group: "production"}},
+			asset: staging,
+			want:  false,
+		},
+		{
+			name:  "tags",
+			rule:  models.NotificationRule{Enabled: true, Selector: &models.AssetSelector{Tags: map[string]string{"env": "prod", "pci": ""}}},
+			asset: production,
+			want:  true,
+		},
+		{
+			name:  "missing tag",
+			rule:  models.NotificationRule{Enabled: true, Selector: &models.AssetSelector{Tags: map[string]string{"env": "prod"}}},
+			asset: staging,
+			want:  false,
+		},
+		{
+			name: "selector without the IP in the inventory",
+			rule: models.NotificationRule{Enabled: true, Selector: &models.AssetSelector{Group: "production"}},
+			want: false,
+		},
+		{
+			name: "empty selector",
+			rule: models.NotificationRule{Enabled: true, Selector: &models.AssetSelector{}},
+			want: true,
+		},
+		{
+			name:  "selector and targets",
+			rule:  models.NotificationRule{Enabled: true, Targets: []string{"192.168.0.0/16"}, Selector: &models.AssetSelector{Group: "production"}},
+			asset: production,
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Matches(&tt.rule, event, tt.asset); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// pkg/platform/objects.go
+
+package platform
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// Objects keeps files, such as exports, and hands out links to download
+// them. In Lambda it is the S3 bucket named by EXPORTS_BUCKET.
+type Objects interface {
+	// Put stores size bytes of body under key
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// URL returns a link that downloads the object for at least expires
+	URL(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// unsignedPayload lets S3 uploads stream from disk rather than being read
+// twice to hash them. Requests go over TLS, which protects the body.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Objects keeps objects in an S3 bucket. Only the two calls exports need
+// are implemented, signed with Signature Version 4.
+type S3Objects struct {
+	Bucket string
+	cfg    aws.Config
+	signer *v4.Signer
+}
+
+// NewS3Objects creates objects in bucket, with the region and credentials
+// of cfg
+func NewS3Objects(cfg aws.Config, bucket string) *S3Objects {
+	return &S3Objects{
+		Bucket: bucket,
+		cfg:    cfg,
+		// S3 object keys are escaped once, not twice like other services
+		signer: v4.NewSigner(func(options *v4.SignerOptions) {
+			options.DisableURIPathEscaping = true
+		}),
+	}
+}
+
+// Put uploads an object in a single request, which S3 allows up to 5 GB
+func (o *S3Objects) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if size == 0 {
+		body = http.NoBody
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, o.objectURL(key), body)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	credentials, err := o.credentials(ctx)
+	if err != nil {
+		return err
+	}
+	if err := o.signer.SignHTTP(ctx, credentials, request, unsignedPayload, "s3", o.cfg.Region, time.Now()); err != nil {
+		return err
+	}
+
+	response, err := o.httpClient().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("uploading %s to bucket %s: %s: %s", key, o.Bucket, response.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// URL returns a presigned link to the object. S3 caps the expiry at seven
+// days, and at the lifetime of the credentials that signed it.
+func (o *S3Objects) URL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, o.objectURL(key), nil)
+	if err != nil {
+		return "", err
+	}
+	query := request.URL.Query()
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	request.URL.RawQuery = query.Encode()
+
+	credentials, err := o.credentials(ctx)
+	if err != nil {
+		return "", err
+	}
+	signed, _, err := o.signer.PresignHTTP(ctx, credentials, request, unsignedPayload, "s3", o.cfg.Region, time.Now())
+	return signed, err
+}
+
+// objectURL returns the virtual-hosted-style URL of an object
+func (o *S3Objects) objectURL(key string) string {
+	escaped := strings.Split(key, "/")
+	for i, segment := range escaped {
+		escaped[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", o.Bucket, o.cfg.Region, strings.Join(escaped, "/"))
+}
+
+func (o *S3Objects) credentials(ctx context.Context) (aws.Credentials, error) {
+	if o.cfg.Credentials == nil {
+		return aws.Credentials{}, fmt.Errorf("no AWS credentials to sign requests to bucket %s with", o.Bucket)
+	}
+	return o.cfg.Credentials.Retrieve(ctx)
+}
+
+func (o *S3Objects) httpClient() aws.HTTPClient {
+	if o.cfg.HTTPClient != nil {
+		return o.cfg.HTTPClient
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,104 @@
+// pkg/platform/platform.go
+
+// Package platform provides the services the handlers run on. In Lambda
+// these are the AWS clients; nexusscan serve swaps in local stand-ins so the
+// same handlers run in a single process.
+package platform
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// Queues sends messages to queues. It is satisfied by *sqs.Client.
+type Queues interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// Functions invokes other functions. It is satisfied by *lambda.Client.
+type Functions interface {
+	Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error)
+}
+
+// Services bundles the database, queues, functions and object storage a
+// handler uses. Objects is nil when no exports bucket is configured.
+type Services struct {
+	DB        *database.Client
+	Queues    Queues
+	Functions Functions
+	Objects   Objects
+}
+
+var (
+	mu    sync.RWMutex
+	local *Services
+
+	postgresMu sync.Mutex
+	postgres   *database.PostgresStore
+)
+
+// Use makes Load return services instead of AWS clients
+func Use(services *Services) {
+	mu.Lock()
+	defer mu.Unlock()
+	local = services
+}
+
+// Load returns the services set with Use, or AWS clients built from the
+// default configuration. When DATABASE_URL is set, IPs, schedules, results,
+// open ports and enrichment are kept in that PostgreSQL database instead of
+// DynamoDB. Exports are kept in the S3 bucket named by EXPORTS_BUCKET.
+func Load(ctx context.Context) (*Services, error) {
+	mu.RLock()
+	services := local
+	mu.RUnlock()
+	if services != nil {
+		return services, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.NewClient(cfg)
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		store, err := openPostgres(ctx, url, db.Tables)
+		if err != nil {
+			return nil, err
+		}
+		db.Store = store
+	}
+
+	services = &Services{
+		DB:        db,
+		Queues:    sqs.NewFromConfig(cfg),
+		Functions: lambda.NewFromConfig(cfg),
+	}
+	if bucket := os.Getenv("EXPORTS_BUCKET"); bucket != "" {
+		services.Objects = NewS3Objects(cfg, bucket)
+	}
+	return services, nil
+}
+
+// openPostgres opens the PostgreSQL store once per process, so warm
+// invocations reuse its connections
+func openPostgres(ctx context.Context, url string, tables database.Tables) (*database.PostgresStore, error) {
+	postgresMu.Lock()
+	defer postgresMu.Unlock()
+
+	if postgres == nil {
+		store, err := database.OpenPostgresStore(ctx, url, tables)
+		if err != nil {
+			return nil, err
+		}
+		postgres = store
+	}
+	return postgres, nil
+}
@@ -0,0 +1,267 @@
+// pkg/scanner/adaptive.go
+
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// Adaptive engine tuning
+const (
+	initialWindow   = 10                     // Probes in flight before any feedback
+	minWindow       = 1                      // Never back off below one probe in flight
+	minProbeTimeout = 100 * time.Millisecond // Floor for RTT-derived timeouts
+	maxProbeTimeout = 5 * time.Second        // Ceiling for RTT-derived timeouts and retry backoff
+	shortLossWeight = 0.2                    // EWMA weight of the recent timeout rate
+	longLossWeight  = 0.02                   // EWMA weight of the baseline timeout rate
+	lossSpikeMargin = 0.25                   // Recent timeouts this far above baseline mean congestion
+)
+
+// congestionControl adapts probe timeouts and parallelism to the target.
+//
+// Timeouts follow the TCP retransmission timer (RFC 6298): a smoothed RTT and
+// RTT variance are measured from every probe that got an answer, and the
+// timeout is srtt + 4*rttvar. Parallelism is a congestion window: it grows
+// with slow start and then additively while the target is healthy, and halves
+// when the recent timeout rate spikes above its long-run baseline. Comparing
+// against the baseline keeps a host that silently drops most ports from being
+// mistaken for a congested one.
+type congestionControl struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	inFlight int
+	window   float64
+	ssthresh float64
+	maxWin   float64
+
+	srtt    time.Duration
+	rttvar  time.Duration
+	hasRTT  bool
+	timeout time.Duration
+
+	shortLoss    float64
+	longLoss     float64
+	lastDecrease time.Time
+	decreases    int
+
+	limiter *rateLimiter
+}
+
+// newCongestionControl creates a controller allowing at most maxConcurrency
+// probes in flight and maxRate probes per second (0 for no cap)
+func newCongestionControl(maxConcurrency int, initialTimeout time.Duration, maxRate float64) *congestionControl {
+	maxWin := float64(maxConcurrency)
+	window := float64(initialWindow)
+	if window > maxWin {
+		window = maxWin
+	}
+
+	if initialTimeout <= 0 {
+		initialTimeout = 500 * time.Millisecond
+	}
+
+	cc := &congestionControl{
+		window:   window,
+		ssthresh: maxWin,
+		maxWin:   maxWin,
+		timeout:  initialTimeout,
+		limiter:  newRateLimiter(maxRate),
+	}
+	cc.cond = sync.NewCond(&cc.mu)
+	return cc
+}
+
+// acquire blocks until the window and the packet rate allow another probe,
+// or ctx is done
+func (cc *congestionControl) acquire(ctx context.Context) error {
+	cc.mu.Lock()
+	if cc.inFlight >= int(cc.window) {
+		// Wake the wait below when ctx is done, since a full window is only
+		// signalled by probes finishing
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				cc.mu.Lock()
+				cc.cond.Broadcast()
+				cc.mu.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+	for cc.inFlight >= int(cc.window) {
+		if err := ctx.Err(); err != nil {
+			cc.mu.Unlock()
+			return err
+		}
+		cc.cond.Wait()
+	}
+	cc.inFlight++
+	cc.mu.Unlock()
+
+	if err := cc.limiter.wait(ctx); err != nil {
+		cc.mu.Lock()
+		cc.inFlight--
+		cc.cond.Broadcast()
+		cc.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// release records the outcome of a probe and frees its window slot
+func (cc *congestionControl) release(result PortResult) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.inFlight--
+	defer cc.cond.Broadcast()
+
+	// Anything other than silence is an answer from the network
+	lost := result.State == models.PortStateFiltered || result.State == models.PortStateOpenFiltered
+	if !lost && result.Latency > 0 {
+		cc.sampleRTT(result.Latency)
+	}
+
+	loss := 0.0
+	if lost {
+		loss = 1.0
+	}
+	cc.shortLoss += shortLossWeight * (loss - cc.shortLoss)
+	cc.longLoss += longLossWeight * (loss - cc.longLoss)
+
+	if lost && cc.shortLoss > cc.longLoss+lossSpikeMargin {
+		// Back off at most once per timeout period so a burst of losses
+		// from probes already in flight counts as a single congestion event
+		if time.Since(cc.lastDecrease) > cc.timeout {
+			cc.ssthresh = cc.window / 2
+			if cc.ssthresh < minWindow {
+				cc.ssthresh = minWindow
+			}
+			cc.window = cc.ssthresh
+			cc.lastDecrease = time.Now()
+			cc.decreases++
+		}
+		return
+	}
+
+	// Healthy: slow start up to ssthresh, then additive increase
+	if cc.window < cc.ssthresh {
+		cc.window++
+	} else {
+		cc.window += 1 / cc.window
+	}
+	if cc.window > cc.maxWin {
+		cc.window = cc.maxWin
+	}
+}
+
+// done frees a window slot taken for a connection that is not a port probe,
+// such as a banner grab, without counting it in the RTT and loss estimates
+func (cc *congestionControl) done() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.inFlight--
+	cc.cond.Broadcast()
+}
+
+// sampleRTT folds a measured round trip into the smoothed estimate and
+// recomputes the probe timeout. Must be called with cc.mu held.
+func (cc *congestionControl) sampleRTT(rtt time.Duration) {
+	if !cc.hasRTT {
+		cc.srtt = rtt
+		cc.rttvar = rtt / 2
+		cc.hasRTT = true
+	} else {
+		delta := cc.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		cc.rttvar = (3*cc.rttvar + delta) / 4
+		cc.srtt = (7*cc.srtt + rtt) / 8
+	}
+
+	cc.timeout = clampTimeout(cc.srtt + 4*cc.rttvar)
+}
+
+// probeTimeout returns the timeout for a probe, doubled for every retry
+func (cc *congestionControl) probeTimeout(attempt int) time.Duration {
+	cc.mu.Lock()
+	timeout := cc.timeout
+	cc.mu.Unlock()
+
+	for i := 0; i < attempt && timeout < maxProbeTimeout; i++ {
+		timeout *= 2
+	}
+	return clampTimeout(timeout)
+}
+
+// String summarises the controller state for logging
+func (cc *congestionControl) String() string {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return fmt.Sprintf("srtt=%v timeout=%v window=%.1f backoffs=%d",
+		cc.srtt.Round(time.Microsecond), cc.timeout.Round(time.Millisecond), cc.window, cc.decreases)
+}
+
+func clampTimeout(timeout time.Duration) time.Duration {
+	if timeout < minProbeTimeout {
+		return minProbeTimeout
+	}
+	if timeout > maxProbeTimeout {
+		return maxProbeTimeout
+	}
+	return timeout
+}
+
+// rateLimiter spaces probes evenly to cap packets per second. A nil limiter
+// imposes no cap.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next probe may be sent
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
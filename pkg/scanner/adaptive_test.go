@@ -0,0 +1,93 @@
+// pkg/scanner/adaptive_test.go
+
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAcquireHonorsCancellation(t *testing.T) {
+	cc := newCongestionControl(1, time.Second, 0)
+	if err := cc.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The window is full, so the next acquire can only end by cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- cc.acquire(ctx) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("acquire returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire did not return after cancellation")
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.inFlight != 1 {
+		t.Errorf("inFlight = %d after a cancelled acquire, want 1", cc.inFlight)
+	}
+}
+
+func TestRateLimiterFractionalRate(t *testing.T) {
+	// A cap of 20 per second shared by 80 batches
+	limiter := newRateLimiter(20.0 / 80)
+	if limiter.interval != 4*time.Second {
+		t.Errorf("interval = %v, want %v", limiter.interval, 4*time.Second)
+	}
+	if newRateLimiter(0) != nil {
+		t.Error("a zero rate should not limit")
+	}
+}
+
+// TestGrabBannerTakesRateToken checks that a banner grab counts against the
+// scan's rate cap and gives its window slot back
+func TestGrabBannerTakesRateToken(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	cc := newCongestionControl(1, time.Second, 1)
+	start := time.Now()
+	if info := grabBanner(context.Background(), cc, "127.0.0.1", port, time.Second); info.Service != "ssh" {
+		t.Errorf("grabBanner found %+v, want ssh", info)
+	}
+
+	cc.mu.Lock()
+	inFlight := cc.inFlight
+	cc.mu.Unlock()
+	if inFlight != 0 {
+		t.Errorf("inFlight = %d after a banner grab, want 0", inFlight)
+	}
+
+	// At one probe per second, the grab leaves the next token a second away
+	cc.limiter.mu.Lock()
+	next := cc.limiter.next
+	cc.limiter.mu.Unlock()
+	if next.Before(start.Add(time.Second)) {
+		t.Errorf("next probe allowed at %v after the grab started, want a second or more", next.Sub(start))
+	}
+}
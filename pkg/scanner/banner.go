@@ -0,0 +1,166 @@
+// pkg/scanner/banner.go
+
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Banner grabbing limits
+const (
+	bannerReadTimeout = 2 * time.Second
+	bannerMaxBytes    = 4096
+	bannerStoreBytes  = 256 // Banners are truncated to this length before storage
+)
+
+// ServiceInfo describes what is listening on an open port
+type ServiceInfo struct {
+	Service string
+	Product string
+	Version string
+	Banner  string
+}
+
+// httpProbe is a minimal request that makes any HTTP server answer
+const httpProbe = "GET / HTTP/1.0\r\nUser-Agent: nexusscan\r\nAccept: */*\r\n\r\n"
+
+// tcpProbes maps ports whose services wait for the client to speak first to
+// a request that elicits an identifying response. Silent ports that are not
+// listed here receive httpProbe, since HTTP is by far the most common
+// client-first protocol on non-standard ports.
+var tcpProbes = map[int][]byte{
+	5432:  {0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}, // PostgreSQL: SSLRequest, answered with S or N
+	6379:  []byte("*1\r\n$4\r\nINFO\r\n"),                   // Redis: INFO, or an auth error
+	11211: []byte("version\r\n"),                            // Memcached: version command
+	27017: mongoProbe(),                                     // MongoDB: buildinfo over OP_QUERY
+}
+
+// tlsPorts are ports that expect a TLS ClientHello; plaintext probes only
+// produce a protocol error there, so banner grabbing skips them
+var tlsPorts = map[int]bool{
+	443: true, 465: true, 636: true, 853: true, 990: true, 992: true,
+	993: true, 995: true, 8443: true,
+}
+
+// GrabBanner connects to an open TCP port, reads the greeting the service
+// sends on connect and, if it stays silent, sends a light protocol probe.
+// The response is matched against the fingerprint table. An empty ServiceInfo
+// means nothing was received.
+func GrabBanner(ctx context.Context, host string, port int, timeout time.Duration) ServiceInfo {
+	if tlsPorts[port] {
+		return ServiceInfo{}
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return ServiceInfo{}
+	}
+	defer conn.Close()
+
+	buf := make([]byte, bannerMaxBytes)
+
+	// Many protocols (SSH, FTP, SMTP, POP3, IMAP, MySQL, VNC) announce
+	// themselves as soon as the connection is accepted
+	conn.SetReadDeadline(time.Now().Add(bannerReadTimeout))
+	n, _ := conn.Read(buf)
+
+	if n == 0 {
+		probe, ok := tcpProbes[port]
+		if !ok {
+			probe = []byte(httpProbe)
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(bannerReadTimeout))
+		if _, err := conn.Write(probe); err != nil {
+			return ServiceInfo{}
+		}
+
+		conn.SetReadDeadline(time.Now().Add(bannerReadTimeout))
+		n = readResponse(conn, buf)
+	}
+
+	if n == 0 {
+		return ServiceInfo{}
+	}
+
+	info := matchFingerprint(buf[:n])
+	info.Banner = sanitizeBanner(buf[:n])
+	return info
+}
+
+// readResponse reads until the buffer is full, the peer closes the
+// connection or the deadline passes, so that headers split across several
+// segments are still seen by the fingerprint matcher
+func readResponse(conn net.Conn, buf []byte) int {
+	total := 0
+	for total < len(buf) {
+		n, err := conn.Read(buf[total:])
+		total += n
+		if err != nil {
+			break
+		}
+	}
+	return total
+}
+
+// sanitizeBanner keeps the first line or two of a response in a form that is
+// safe to store and display: control and non-ASCII bytes become escapes and
+// the result is truncated to bannerStoreBytes
+func sanitizeBanner(raw []byte) string {
+	var b strings.Builder
+	for _, c := range raw {
+		if b.Len() >= bannerStoreBytes {
+			break
+		}
+		switch {
+		case c == '\r':
+			continue
+		case c == '\n':
+			b.WriteString("\\n")
+		case c >= 0x20 && c < 0x7f:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		}
+	}
+	banner := b.String()
+	for strings.HasSuffix(banner, "\\n") {
+		banner = strings.TrimSuffix(banner, "\\n")
+	}
+	return banner
+}
+
+// mongoProbe builds an OP_QUERY for {buildinfo: 1} against admin.$cmd
+func mongoProbe() []byte {
+	query := []byte{
+		0x00, 0x00, 0x00, 0x00, // Flags
+	}
+	query = append(query, "admin.$cmd"...)
+	query = append(query, 0x00)
+	query = append(query, 0x00, 0x00, 0x00, 0x00) // Number to skip
+	query = append(query, 0x01, 0x00, 0x00, 0x00) // Number to return
+
+	// BSON document {buildinfo: 1}
+	doc := []byte{0x00, 0x00, 0x00, 0x00, 0x10}
+	doc = append(doc, "buildinfo"...)
+	doc = append(doc, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00)
+	doc[0] = byte(len(doc))
+	query = append(query, doc...)
+
+	header := []byte{
+		0x00, 0x00, 0x00, 0x00, // Message length
+		0x4e, 0x58, 0x00, 0x00, // Request ID
+		0x00, 0x00, 0x00, 0x00, // Response to
+		0xd4, 0x07, 0x00, 0x00, // OP_QUERY
+	}
+	packet := append(header, query...)
+	packet[0] = byte(len(packet))
+	return packet
+}
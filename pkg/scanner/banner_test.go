@@ -0,0 +1,258 @@
+// pkg/scanner/banner_test.go
+
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tcpServer serves every connection to a loopback listener with handle,
+// which owns the connection
+func tcpServer(t *testing.T, listener net.Listener, handle func(conn net.Conn)) int {
+	t.Helper()
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// loopbackServer is tcpServer on any free loopback port
+func loopbackServer(t *testing.T, handle func(conn net.Conn)) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tcpServer(t, listener, handle)
+}
+
+// greeting plays a service that announces itself on connect
+func greeting(banner string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		io.WriteString(conn, banner)
+	}
+}
+
+func TestGrabBanner(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle func(conn net.Conn)
+		want   ServiceInfo
+	}{
+		{
+			name:   "SSH",
+			handle: greeting("SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n"),
+			want:   ServiceInfo{Service: "ssh", Product: "OpenSSH", Version: "9.6p1", Banner: "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13"},
+		},
+		{
+			name:   "SMTP",
+			handle: greeting("220 mail.example.com ESMTP Postfix (Ubuntu)\r\n"),
+			want:   ServiceInfo{Service: "smtp", Product: "Postfix", Banner: "220 mail.example.com ESMTP Postfix (Ubuntu)"},
+		},
+		{
+			name:   "FTP",
+			handle: greeting("220 (vsFTPd 3.0.5)\r\n"),
+			want:   ServiceInfo{Service: "ftp", Product: "vsftpd", Version: "3.0.5", Banner: "220 (vsFTPd 3.0.5)"},
+		},
+		{
+			name: "HTTP",
+			handle: func(conn net.Conn) {
+				// HTTP waits for the request, and the response arrives in
+				// two segments
+				request, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || request.Method != http.MethodGet || request.URL.Path != "/" {
+					return
+				}
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n")
+				time.Sleep(50 * time.Millisecond)
+				io.WriteString(conn, "Server: nginx/1.24.0\r\n\r\n<html></html>")
+			},
+			want: ServiceInfo{
+				Service: "http",
+				Product: "nginx",
+				Version: "1.24.0",
+				Banner:  `HTTP/1.1 200 OK\nContent-Type: text/html\nServer: nginx/1.24.0\n\n<html></html>`,
+			},
+		},
+		{
+			name:   "unknown greeting",
+			handle: greeting("\x00\x01hello\xff\r\n"),
+			want:   ServiceInfo{Banner: `\x00\x01hello\xff`},
+		},
+		{
+			name: "silent",
+			handle: func(conn net.Conn) {
+				io.Copy(io.Discard, conn)
+			},
+			want: ServiceInfo{},
+		},
+		{
+			name:   "closes at once",
+			handle: func(conn net.Conn) {},
+			want:   ServiceInfo{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			port := loopbackServer(t, tt.handle)
+			if got := GrabBanner(context.Background(), "127.0.0.1", port, time.Second); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrabBannerSkipsTLSPorts(t *testing.T) {
+	for port := range tlsPorts {
+		if got := GrabBanner(context.Background(), "127.0.0.1", port, time.Second); got != (ServiceInfo{}) {
+			t.Errorf("port %d: got %+v, want nothing", port, got)
+		}
+	}
+}
+
+// TestTCPProbes listens on the port of each dedicated probe, so that
+// GrabBanner sends it, and checks the probe arrives whole and its answer is
+// recognised. Ports already in use on this machine are skipped.
+func TestTCPProbes(t *testing.T) {
+	mongoReply := append([]byte("\x00\x00\x00\x00\x02version\x00\x06\x00\x00\x007.0.5\x00"), "\x10maxWireVersion\x00\x15\x00\x00\x00"...)
+
+	tests := []struct {
+		port  int
+		reply []byte
+		want  ServiceInfo
+	}{
+		{port: 5432, reply: []byte("N"), want: ServiceInfo{Service: "postgresql", Product: "PostgreSQL", Banner: "N"}},
+		{port: 6379, reply: []byte("-NOAUTH Authentication required.\r\n"), want: ServiceInfo{Service: "redis", Product: "Redis", Banner: "-NOAUTH Authentication required."}},
+		{port: 11211, reply: []byte("VERSION 1.6.21\r\n"), want: ServiceInfo{Service: "memcached", Product: "Memcached", Version: "1.6.21", Banner: "VERSION 1.6.21"}},
+		{port: 27017, reply: mongoReply, want: ServiceInfo{Service: "mongodb", Product: "MongoDB", Version: "7.0.5", Banner: sanitizeBanner(mongoReply)}},
+	}
+	if len(tests) != len(tcpProbes) {
+		t.Errorf("%d probes tested, want all %d", len(tests), len(tcpProbes))
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprint(tt.port), func(t *testing.T) {
+			t.Parallel()
+			listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", tt.port))
+			if err != nil {
+				t.Skipf("cannot listen on %d: %v", tt.port, err)
+			}
+			probe := tcpProbes[tt.port]
+			received := make(chan []byte, 1)
+			tcpServer(t, listener, func(conn net.Conn) {
+				request := make([]byte, len(probe))
+				n, _ := io.ReadFull(conn, request)
+				received <- request[:n]
+				conn.Write(tt.reply)
+			})
+
+			if got := GrabBanner(context.Background(), "127.0.0.1", tt.port, time.Second); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if request := <-received; !bytes.Equal(request, probe) {
+				t.Errorf("server received %x, want %x", request, probe)
+			}
+		})
+	}
+}
+
+func TestMongoProbe(t *testing.T) {
+	packet := mongoProbe()
+	if length := binary.LittleEndian.Uint32(packet); int(length) != len(packet) {
+		t.Errorf("message length %d, packet is %d bytes", length, len(packet))
+	}
+	if opcode := binary.LittleEndian.Uint32(packet[12:]); opcode != 2004 {
+		t.Errorf("opcode %d, want OP_QUERY", opcode)
+	}
+	collection := packet[20 : 20+bytes.IndexByte(packet[20:], 0)]
+	if string(collection) != "admin.$cmd" {
+		t.Errorf("collection %q, want admin.$cmd", collection)
+	}
+	doc := packet[20+len(collection)+1+8:]
+	if length := binary.LittleEndian.Uint32(doc); int(length) != len(doc) || doc[len(doc)-1] != 0 {
+		t.Errorf("document length %d, document is %d bytes", length, len(doc))
+	}
+}
+
+func TestMatchFingerprint(t *testing.T) {
+	tests := []struct {
+		banner string
+		want   ServiceInfo
+	}{
+		{"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6\r\n", ServiceInfo{Service: "ssh", Product: "OpenSSH", Version: "8.9p1"}},
+		{"SSH-2.0-dropbear_2022.83\r\n", ServiceInfo{Service: "ssh", Product: "Dropbear", Version: "2022.83"}},
+		{"SSH-2.0-Cisco-1.25\r\n", ServiceInfo{Service: "ssh", Product: "Cisco-1.25"}},
+		{"SSH-2.0-libssh_0.9.6\r\n", ServiceInfo{Service: "ssh", Product: "libssh", Version: "0.9.6"}},
+		{"220 ProFTPD 1.3.8 Server (Debian) [::ffff:10.0.0.1]\r\n", ServiceInfo{Service: "ftp", Product: "ProFTPD", Version: "1.3.8"}},
+		{"220-FileZilla Server 1.7.3\r\n", ServiceInfo{Service: "ftp", Product: "FileZilla Server", Version: "1.7.3"}},
+		{"220 Microsoft FTP Service\r\n", ServiceInfo{Service: "ftp", Product: "Microsoft ftpd"}},
+		{"220 files.example.com ready\r\n", ServiceInfo{Service: "ftp"}},
+		{"220 mx.example.com ESMTP Exim 4.96 Mon, 01 Jan 2024\r\n", ServiceInfo{Service: "smtp", Product: "Exim", Version: "4.96"}},
+		{"220 mail.example.com Microsoft ESMTP MAIL Service ready\r\n", ServiceInfo{Service: "smtp", Product: "Microsoft ESMTP"}},
+		{"220 mail.example.com ESMTP\r\n", ServiceInfo{Service: "smtp"}},
+		{"+OK Dovecot ready.\r\n", ServiceInfo{Service: "pop3", Product: "Dovecot"}},
+		{"* OK [CAPABILITY IMAP4rev1] Dovecot ready.\r\n", ServiceInfo{Service: "imap", Product: "Dovecot"}},
+		{"\x4a\x00\x00\x00\x0a8.0.36\x00\x01\x00", ServiceInfo{Service: "mysql", Product: "MySQL", Version: "8.0.36"}},
+		{"\x5b\x00\x00\x00\x0a5.5.5-10.11.6-MariaDB-0+deb12u1\x00", ServiceInfo{Service: "mysql", Product: "MariaDB", Version: "10.11.6"}},
+		{"\x45\x00\x00\x00\xff\x6a\x04Host '10.0.0.1' is not allowed to connect to this MySQL server", ServiceInfo{Service: "mysql", Product: "MySQL"}},
+		{"$3000\r\n# Server\r\nredis_version:7.2.4\r\n", ServiceInfo{Service: "redis", Product: "Redis", Version: "7.2.4"}},
+		{"RFB 003.008\n", ServiceInfo{Service: "vnc", Version: "003.008"}},
+		{"\xff\xfd\x18\xff\xfd\x20", ServiceInfo{Service: "telnet"}},
+		{"@RSYNCD: 31.0\n", ServiceInfo{Service: "rsync", Version: "31.0"}},
+		{"HTTP/1.1 404 Not Found\r\nserver: Apache\r\n\r\n", ServiceInfo{Service: "http", Product: "Apache"}},
+		{"HTTP/1.0 400 Bad Request\r\n\r\n", ServiceInfo{Service: "http"}},
+		{"AMQP\x00\x00\x09\x01", ServiceInfo{Service: "amqp"}},
+		{"hello", ServiceInfo{}},
+		{"", ServiceInfo{}},
+	}
+
+	for _, tt := range tests {
+		if got := matchFingerprint([]byte(tt.banner)); got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.banner, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeBanner(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"SSH-2.0-OpenSSH_9.6\r\n", "SSH-2.0-OpenSSH_9.6"},
+		{"220-first\r\n220 second\r\n\r\n", `220-first\n220 second`},
+		{"\x00\x7f\xc3\xa9", `\x00\x7f\xc3\xa9`},
+		{strings.Repeat("a", 300), strings.Repeat("a", bannerStoreBytes)},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeBanner([]byte(tt.raw)); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// pkg/scanner/chain.go
+
+package scanner
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// BatchChain describes the batches of a rate capped scan. They run one after
+// another so each can use the scan's whole cap: only the first is queued when
+// the scan starts, and the worker that scans a batch queues the next.
+type BatchChain struct {
+	Ports      string `json:"ports"`                // Every port of the scan, as a port spec
+	BatchSize  int    `json:"batchSize"`            // Ports per batch
+	Seed       int64  `json:"seed,omitempty"`       // Spreads the ports across batches at random, 0 to keep them in order
+	WatchPorts []int  `json:"watchPorts,omitempty"` // Previously open ports of the whole scan
+}
+
+// NewBatchChain creates the chain for a scan of ports in batches of
+// batchSize. With random probe order, the ports are spread across the
+// batches at random.
+func NewBatchChain(ports []int, batchSize int, probeOrder string, watchPorts []int) *BatchChain {
+	chain := &BatchChain{
+		Ports:      models.FormatPortSpec(ports),
+		BatchSize:  batchSize,
+		WatchPorts: watchPorts,
+	}
+	if probeOrder == models.ProbeOrderRandom {
+		for chain.Seed == 0 {
+			chain.Seed = rand.Int63()
+		}
+	}
+	return chain
+}
+
+// ports returns the ports of the scan in the order they are batched
+func (c *BatchChain) ports() ([]int, error) {
+	if c.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size %d", c.BatchSize)
+	}
+	ports, err := models.ParsePortSpec(c.Ports)
+	if err != nil {
+		return nil, err
+	}
+	if c.Seed != 0 {
+		shuffle := rand.New(rand.NewSource(c.Seed))
+		shuffle.Shuffle(len(ports), func(i, j int) { ports[i], ports[j] = ports[j], ports[i] })
+	}
+	return ports, nil
+}
+
+// ChainedBatch returns the request for a batch of a chained scan, with the
+// ports and watch ports of that batch and the other settings of r
+func (r ScanRequest) ChainedBatch(batchID int) (ScanRequest, error) {
+	if r.Chain == nil {
+		return ScanRequest{}, fmt.Errorf("scan %s is not chained", r.ScanID)
+	}
+	ports, err := r.Chain.ports()
+	if err != nil {
+		return ScanRequest{}, fmt.Errorf("scan %s: %w", r.ScanID, err)
+	}
+
+	start := batchID * r.Chain.BatchSize
+	if batchID < 0 || start >= len(ports) {
+		return ScanRequest{}, fmt.Errorf("scan %s has no batch %d", r.ScanID, batchID)
+	}
+	end := start + r.Chain.BatchSize
+	if end > len(ports) {
+		end = len(ports)
+	}
+
+	watch := make(map[int]bool, len(r.Chain.WatchPorts))
+	for _, port := range r.Chain.WatchPorts {
+		watch[port] = true
+	}
+
+	batch := r
+	batch.BatchID = batchID
+	batch.TotalBatches = (len(ports) + r.Chain.BatchSize - 1) / r.Chain.BatchSize
+	batch.PortsToScan = ports[start:end]
+	batch.WatchPorts = nil
+	for _, port := range batch.PortsToScan {
+		if watch[port] {
+			batch.WatchPorts = append(batch.WatchPorts, port)
+		}
+	}
+	return batch, nil
+}
+
+// NextBatch returns the request for the batch that follows r in its chain,
+// or nil when r is the last batch or the scan is not chained
+func (r ScanRequest) NextBatch() (*ScanRequest, error) {
+	if r.Chain == nil || r.BatchID+1 >= r.TotalBatches {
+		return nil, nil
+	}
+	next, err := r.ChainedBatch(r.BatchID + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
@@ -0,0 +1,109 @@
+// pkg/scanner/fingerprint.go
+
+package scanner
+
+import (
+	"regexp"
+	"strings"
+)
+
+// fingerprint matches a service response and extracts product and version.
+// ProductGroup and VersionGroup are regexp submatch indexes, 0 when unused.
+type fingerprint struct {
+	Service      string
+	Product      string
+	Pattern      *regexp.Regexp
+	ProductGroup int
+	VersionGroup int
+}
+
+// fingerprints is ordered from most to least specific; the first match wins
+var fingerprints = []fingerprint{
+	// SSH
+	{Service: "ssh", Product: "OpenSSH", Pattern: regexp.MustCompile(`^SSH-[\d.]+-OpenSSH_([\w.]+)`), VersionGroup: 1},
+	{Service: "ssh", Product: "Dropbear", Pattern: regexp.MustCompile(`^SSH-[\d.]+-dropbear_([\w.]+)`), VersionGroup: 1},
+	{Service: "ssh", Pattern: regexp.MustCompile(`^SSH-[\d.]+-([^\s_]+)(?:_(\S+))?`), ProductGroup: 1, VersionGroup: 2},
+
+	// FTP
+	{Service: "ftp", Product: "vsftpd", Pattern: regexp.MustCompile(`^220[ -].*\(vsFTPd ([\d.]+)\)`), VersionGroup: 1},
+	{Service: "ftp", Product: "ProFTPD", Pattern: regexp.MustCompile(`^220[ -].*ProFTPD ([\w.]+)`), VersionGroup: 1},
+	{Service: "ftp", Product: "Pure-FTPd", Pattern: regexp.MustCompile(`^220[ -].*Pure-FTPd`)},
+	{Service: "ftp", Product: "FileZilla Server", Pattern: regexp.MustCompile(`^220[ -].*FileZilla Server(?: version)? ([\w.]+)`), VersionGroup: 1},
+	{Service: "ftp", Product: "Microsoft ftpd", Pattern: regexp.MustCompile(`^220[ -].*Microsoft FTP Service`)},
+
+	// SMTP
+	{Service: "smtp", Product: "Postfix", Pattern: regexp.MustCompile(`^220[ -].*ESMTP Postfix`)},
+	{Service: "smtp", Product: "Exim", Pattern: regexp.MustCompile(`^220[ -].*ESMTP Exim ([\d.]+)`), VersionGroup: 1},
+	{Service: "smtp", Product: "Sendmail", Pattern: regexp.MustCompile(`^220[ -].*Sendmail ([\w./]+)`), VersionGroup: 1},
+	{Service: "smtp", Product: "Microsoft ESMTP", Pattern: regexp.MustCompile(`^220[ -].*Microsoft ESMTP MAIL Service(?:, Version: ([\d.]+))?`), VersionGroup: 1},
+	{Service: "smtp", Pattern: regexp.MustCompile(`^220[ -].*(?:SMTP|smtp)`)},
+
+	// Any other 220 greeting is almost always FTP
+	{Service: "ftp", Pattern: regexp.MustCompile(`^220[ -]`)},
+
+	// POP3 / IMAP
+	{Service: "pop3", Product: "Dovecot", Pattern: regexp.MustCompile(`^\+OK.*Dovecot`)},
+	{Service: "pop3", Pattern: regexp.MustCompile(`^\+OK`)},
+	{Service: "imap", Product: "Dovecot", Pattern: regexp.MustCompile(`^\* OK.*Dovecot`)},
+	{Service: "imap", Product: "Courier", Pattern: regexp.MustCompile(`^\* OK.*Courier-IMAP`)},
+	{Service: "imap", Product: "Microsoft Exchange", Pattern: regexp.MustCompile(`^\* OK.*Microsoft Exchange`)},
+	{Service: "imap", Pattern: regexp.MustCompile(`^\* OK`)},
+
+	// Databases and caches
+	{Service: "mysql", Product: "MariaDB", Pattern: regexp.MustCompile(`(?s)^.{4}\x0a(?:5\.5\.5-)?([\d.]+)-MariaDB`), VersionGroup: 1},
+	{Service: "mysql", Product: "MySQL", Pattern: regexp.MustCompile(`(?s)^.{4}\x0a([\d.]+[^\x00]*)\x00`), VersionGroup: 1},
+	{Service: "mysql", Product: "MySQL", Pattern: regexp.MustCompile(`(?s)^.{4}\xff.{2}Host '.*' is not allowed`)},
+	{Service: "redis", Product: "Redis", Pattern: regexp.MustCompile(`(?m)^redis_version:([\w.]+)`), VersionGroup: 1},
+	{Service: "redis", Product: "Redis", Pattern: regexp.MustCompile(`^-(?:NOAUTH|DENIED|ERR operation not permitted)`)},
+	{Service: "memcached", Product: "Memcached", Pattern: regexp.MustCompile(`^VERSION ([\w.]+)`), VersionGroup: 1},
+	{Service: "postgresql", Product: "PostgreSQL", Pattern: regexp.MustCompile(`^[SN]$`)},
+	{Service: "mongodb", Product: "MongoDB", Pattern: regexp.MustCompile(`(?s)"?version"?\W+([\d.]+).*(?:maxWireVersion|gitVersion)`), VersionGroup: 1},
+
+	// Remote access
+	{Service: "vnc", Pattern: regexp.MustCompile(`^RFB (\d{3}\.\d{3})`), VersionGroup: 1},
+	{Service: "telnet", Pattern: regexp.MustCompile(`^\xff[\xfb-\xfe]`)},
+	{Service: "rsync", Pattern: regexp.MustCompile(`^@RSYNCD: ([\d.]+)`), VersionGroup: 1},
+
+	// HTTP, identified by the Server header when present
+	{Service: "http", Pattern: regexp.MustCompile(`(?is)^HTTP/[\d.]+ \d{3}.*?\r\nServer: ([^/\r\n ]+)(?:/([^\s\r\n]+))?`), ProductGroup: 1, VersionGroup: 2},
+	{Service: "http", Pattern: regexp.MustCompile(`^HTTP/[\d.]+ \d{3}`)},
+	{Service: "amqp", Pattern: regexp.MustCompile(`^AMQP`)},
+}
+
+// matchFingerprint identifies a service from a raw banner. The returned
+// ServiceInfo is empty when nothing in the table matches.
+func matchFingerprint(banner []byte) ServiceInfo {
+	text := latin1(banner)
+	for _, fp := range fingerprints {
+		match := fp.Pattern.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+
+		info := ServiceInfo{
+			Service: fp.Service,
+			Product: fp.Product,
+		}
+		if fp.ProductGroup > 0 && fp.ProductGroup < len(match) {
+			info.Product = match[fp.ProductGroup]
+		}
+		if fp.VersionGroup > 0 && fp.VersionGroup < len(match) {
+			info.Version = strings.TrimSpace(match[fp.VersionGroup])
+		}
+		return info
+	}
+
+	return ServiceInfo{}
+}
+
+// latin1 maps each byte of a banner to the rune of the same value. Patterns
+// are matched against runes, and binary greetings such as telnet's \xff
+// option negotiation are not valid UTF-8, so matching the raw bytes would
+// never see them.
+func latin1(banner []byte) string {
+	runes := make([]rune, len(banner))
+	for i, b := range banner {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
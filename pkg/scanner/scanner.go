@@ -4,12 +4,15 @@ package scanner
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
+	"math/rand"
 	"net"
+	"strconv"
 	"sort"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
@@ -25,7 +28,14 @@ type ScanRequest struct {
 	TimeoutMs     int      `json:"timeoutMs"`
 	Concurrency   int      `json:"concurrency"`
 	RetryCount    int      `json:"retryCount"`
+	Protocol      string   `json:"protocol,omitempty"`     // tcp (default) or udp
+	WatchPorts    []int    `json:"watchPorts,omitempty"`   // Previously open ports whose state is always reported
+	GrabBanners   bool     `json:"grabBanners,omitempty"`  // Fingerprint services on open TCP ports
+	MaxRate       float64  `json:"maxRate,omitempty"`      // Probes per second this batch may send, the scan's cap; 0 for none
+	ProbeOrder    string   `json:"probeOrder,omitempty"`   // sequential (default) or random
+	Profile       string   `json:"profile,omitempty"`      // Scan profile the settings came from
 	ScheduleType  string   `json:"scheduleType,omitempty"` // Optional, for scheduled scans
+	Chain         *BatchChain `json:"chain,omitempty"`     // Batches of a rate capped scan, run one after another
 }
 
 // ScanResult defines the scanner output
@@ -38,9 +48,21 @@ type ScanResult struct {
 	TotalBatches int           `json:"totalBatches"`
 	PortsScanned int           `json:"portsScanned"`
 	ScanComplete bool          `json:"scanComplete"`
+	Protocol     string        `json:"protocol"`
+	StateCounts  models.PortStateCounts `json:"stateCounts"`
+	WatchedPorts []models.Port `json:"watchedPorts,omitempty"` // Final state of each requested watch port
+	Profile      string        `json:"profile,omitempty"`      // Scan profile the batch ran with
 	ScheduleType string        `json:"scheduleType,omitempty"` // Optional, for scheduled scans
 }
 
+// PortResult is the outcome of probing a single port
+type PortResult struct {
+	Port    int
+	State   string
+	Latency time.Duration
+	Service ServiceInfo // Populated by banner grabbing on open ports
+}
+
 // Initialize connection pool
 var connPoolSize = 100
 var connPool = sync.Pool{
@@ -53,15 +75,33 @@ var connPool = sync.Pool{
 	},
 }
 
-// ScanPort checks if a single port is open
-func ScanPort(ctx context.Context, host string, port int, timeout time.Duration, retryCount int) (bool, time.Duration) {
+// classifyDialError maps a failed TCP connect to a port state. A refused
+// connection means the host answered with RST, a timeout means something
+// silently dropped the SYN, and ICMP unreachables mean we never got there.
+func classifyDialError(err error) string {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return models.PortStateClosed
+	}
+	if errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTDOWN) || errors.Is(err, syscall.ENETDOWN) {
+		return models.PortStateUnreachable
+	}
+	
+	// Timeouts, administratively prohibited responses and anything else
+	// we cannot attribute to the target host are treated as filtered
+	return models.PortStateFiltered
+}
+
+// ScanPort probes a single TCP port and classifies it as open, closed,
+// filtered or unreachable
+func ScanPort(ctx context.Context, host string, port int, timeout time.Duration, retryCount int) PortResult {
 	// Get dialer from pool
 	dialerInterface := connPool.Get()
 	dialer := dialerInterface.(*net.Dialer)
 	dialer.Timeout = timeout
 	defer connPool.Put(dialer)
 	
-	addr := fmt.Sprintf("%s:%d", host, port)
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
 	
 	// First attempt
 	start := time.Now()
@@ -70,7 +110,15 @@ func ScanPort(ctx context.Context, host string, port int, timeout time.Duration,
 	
 	if err == nil {
 		conn.Close()
-		return true, latency
+		return PortResult{Port: port, State: models.PortStateOpen, Latency: latency}
+	}
+	
+	state := classifyDialError(err)
+	
+	// Closed and unreachable are definitive answers; only a silent drop
+	// could be packet loss worth retrying
+	if state != models.PortStateFiltered {
+		return PortResult{Port: port, State: state, Latency: latency}
 	}
 	
 	// Retry logic for potential false negatives
@@ -82,7 +130,7 @@ func ScanPort(ctx context.Context, host string, port int, timeout time.Duration,
 			// Check context before retry
 			select {
 			case <-ctx.Done():
-				return false, 0
+				return PortResult{Port: port, State: state, Latency: latency}
 			default:
 			}
 			
@@ -92,7 +140,12 @@ func ScanPort(ctx context.Context, host string, port int, timeout time.Duration,
 			
 			if err == nil {
 				conn.Close()
-				return true, retryLatency
+				return PortResult{Port: port, State: models.PortStateOpen, Latency: retryLatency}
+			}
+			
+			state = classifyDialError(err)
+			if state != models.PortStateFiltered {
+				return PortResult{Port: port, State: state, Latency: retryLatency}
 			}
 			
 			// Exponential backoff
@@ -102,25 +155,30 @@ func ScanPort(ctx context.Context, host string, port int, timeout time.Duration,
 		}
 	}
 	
-	return false, latency
+	return PortResult{Port: port, State: state, Latency: latency}
 }
 
 // ScanPorts performs port scanning with optimized concurrency
 func ScanPorts(ctx context.Context, request ScanRequest) (ScanResult, error) {
 	startTime := time.Now()
 	
-	// Configure scan parameters
+	// Configure scan parameters. TimeoutMs is the starting timeout and
+	// Concurrency the most probes in flight; the congestion controller
+	// adjusts both to what the target can handle.
 	timeout := time.Duration(request.TimeoutMs) * time.Millisecond
 	concurrency := request.Concurrency
 	if concurrency <= 0 {
 		concurrency = 50 // Default concurrency
 	}
+	cc := newCongestionControl(concurrency, timeout, request.MaxRate)
 	
 	retryCount := request.RetryCount
 	if retryCount < 0 {
 		retryCount = 0
 	}
 	
+	protocol := models.NormalizeProtocol(request.Protocol)
+	
 	// Prepare result
 	result := ScanResult{
 		IPAddress:    request.IPAddress,
@@ -129,12 +187,29 @@ func ScanPorts(ctx context.Context, request ScanRequest) (ScanResult, error) {
 		TotalBatches: request.TotalBatches,
 		OpenPorts:    make([]models.Port, 0),
 		PortsScanned: len(request.PortsToScan),
+		Protocol:     protocol,
+		Profile:      request.Profile,
 		ScheduleType: request.ScheduleType,
 	}
 	
+	// Probe in random order when asked, so consecutive probes do not walk
+	// the port range in a pattern an IDS would recognise
+	ports := request.PortsToScan
+	if request.ProbeOrder == models.ProbeOrderRandom {
+		ports = make([]int, len(request.PortsToScan))
+		copy(ports, request.PortsToScan)
+		rand.Shuffle(len(ports), func(i, j int) { ports[i], ports[j] = ports[j], ports[i] })
+	}
+	
+	// Ports whose state should be reported even when they are not open
+	watchPorts := make(map[int]bool, len(request.WatchPorts))
+	for _, port := range request.WatchPorts {
+		watchPorts[port] = true
+	}
+	
 	// Use buffered channels for worker management
 	portChan := make(chan int, concurrency)
-	resultChan := make(chan models.Port, concurrency)
+	resultChan := make(chan PortResult, concurrency)
 	doneChan := make(chan struct{})
 	
 	// Track open ports with atomic counter
@@ -142,9 +217,28 @@ func ScanPorts(ctx context.Context, request ScanRequest) (ScanResult, error) {
 	
 	// Start result collector
 	go func() {
-		for port := range resultChan {
-			result.OpenPorts = append(result.OpenPorts, port)
-			atomic.AddInt32(&openPortCount, 1)
+		for portResult := range resultChan {
+			result.StateCounts.Add(portResult.State)
+			
+			port := models.Port{
+				Number:   portResult.Port,
+				Protocol: protocol,
+				State:    portResult.State,
+				Latency:  portResult.Latency,
+				Service:  portResult.Service.Service,
+				Product:  portResult.Service.Product,
+				Version:  portResult.Service.Version,
+				Banner:   portResult.Service.Banner,
+			}
+			
+			if watchPorts[portResult.Port] {
+				result.WatchedPorts = append(result.WatchedPorts, port)
+			}
+			
+			if portResult.State == models.PortStateOpen {
+				result.OpenPorts = append(result.OpenPorts, port)
+				atomic.AddInt32(&openPortCount, 1)
+			}
 		}
 		close(doneChan)
 	}()
@@ -161,17 +255,12 @@ func ScanPorts(ctx context.Context, request ScanRequest) (ScanResult, error) {
 				case <-ctx.Done():
 					return // Context cancelled
 				default:
-					// Scan the port
-					isOpen, latency := ScanPort(ctx, request.IPAddress, port, timeout, retryCount)
-					
-					if isOpen {
-						// Port is open, send to result channel
-						resultChan <- models.Port{
-							Number:  port,
-							State:   "open",
-							Latency: latency,
-						}
+					// Scan the port and hand every outcome to the collector
+					portResult := probePort(ctx, cc, protocol, request.IPAddress, port, retryCount)
+					if protocol == models.ProtocolTCP && portResult.State == models.PortStateOpen && request.GrabBanners {
+						portResult.Service = grabBanner(ctx, cc, request.IPAddress, port, timeout)
 					}
+					resultChan <- portResult
 				}
 			}
 		}()
@@ -179,7 +268,7 @@ func ScanPorts(ctx context.Context, request ScanRequest) (ScanResult, error) {
 	
 	// Feed ports to workers
 	go func() {
-		for _, port := range request.PortsToScan {
+		for _, port := range ports {
 			select {
 			case <-ctx.Done():
 				break
@@ -201,13 +290,66 @@ func ScanPorts(ctx context.Context, request ScanRequest) (ScanResult, error) {
 	sort.Slice(result.OpenPorts, func(i, j int) bool {
 		return result.OpenPorts[i].Number < result.OpenPorts[j].Number
 	})
+	sort.Slice(result.WatchedPorts, func(i, j int) bool {
+		return result.WatchedPorts[i].Number < result.WatchedPorts[j].Number
+	})
 	
 	result.ScanDuration = time.Since(startTime)
 	result.ScanComplete = true
 	
 	// Log summary
-	log.Printf("Scan of %s completed: %d ports scanned, %d open ports found in %v",
-		request.IPAddress, len(request.PortsToScan), len(result.OpenPorts), result.ScanDuration)
+	log.Printf("Scan of %s (%s) completed: %d ports scanned, %d open ports found in %v (%s; %s)",
+		request.IPAddress, protocol, len(request.PortsToScan), len(result.OpenPorts), result.ScanDuration,
+		result.StateCounts, cc)
 	
 	return result, nil
 }
+
+// probePort scans one port under the congestion controller. Each attempt
+// takes a window slot and a rate token, and silent ports are retried with a
+// doubled timeout, since a drop may be packet loss rather than a firewall.
+func probePort(ctx context.Context, cc *congestionControl, protocol string, host string, port int, retryCount int) PortResult {
+	var result PortResult
+	
+	for attempt := 0; attempt <= retryCount; attempt++ {
+		if err := cc.acquire(ctx); err != nil {
+			break
+		}
+		
+		timeout := cc.probeTimeout(attempt)
+		if protocol == models.ProtocolUDP {
+			result = ScanUDPPort(ctx, host, port, timeout, 0)
+		} else {
+			result = ScanPort(ctx, host, port, timeout, 0)
+		}
+		cc.release(result)
+		
+		if result.State != models.PortStateFiltered && result.State != models.PortStateOpenFiltered {
+			break
+		}
+	}
+	
+	if result.State == "" {
+		// Cancelled before the first probe went out
+		result = PortResult{Port: port, State: models.PortStateFiltered}
+		if protocol == models.ProtocolUDP {
+			result.State = models.PortStateOpenFiltered
+		}
+	}
+	return result
+}
+
+// grabBanner fingerprints an open port under the congestion controller. The
+// banner connection takes a window slot and a rate token like a probe, so
+// the scan's rate cap covers every connection the scan makes.
+func grabBanner(ctx context.Context, cc *congestionControl, host string, port int, timeout time.Duration) ServiceInfo {
+	if tlsPorts[port] {
+		return ServiceInfo{} // Skipped without connecting
+	}
+	if err := cc.acquire(ctx); err != nil {
+		return ServiceInfo{}
+	}
+	defer cc.done()
+	
+	return GrabBanner(ctx, host, port, timeout)
+}
@@ -0,0 +1,51 @@
+// pkg/scanner/scanner_test.go
+
+package scanner
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// TestScanPortAddressFamilies dials a loopback listener through every
+// spelling of its address that the scanner may be handed
+func TestScanPortAddressFamilies(t *testing.T) {
+	tests := []struct {
+		name   string
+		listen string
+		host   string
+	}{
+		{name: "v4", listen: "127.0.0.1:0", host: "127.0.0.1"},
+		{name: "v6", listen: "[::1]:0", host: "::1"},
+		{name: "v4-mapped", listen: "127.0.0.1:0", host: "::ffff:127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", tt.listen)
+			if err != nil {
+				t.Skipf("cannot listen on %s: %v", tt.listen, err)
+			}
+			defer listener.Close()
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					conn.Close()
+				}
+			}()
+
+			port := listener.Addr().(*net.TCPAddr).Port
+			result := ScanPort(context.Background(), tt.host, port, time.Second, 0)
+			if result.State != models.PortStateOpen {
+				t.Errorf("ScanPort(%s, %d) = %s, want %s", tt.host, port, result.State, models.PortStateOpen)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// pkg/scanner/udp.go
+
+package scanner
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// udpProbes maps well-known UDP ports to payloads that elicit a reply from
+// the service listening there. UDP services generally ignore empty or
+// malformed datagrams, so without a protocol-specific probe an open port is
+// indistinguishable from a filtered one.
+var udpProbes = map[int][]byte{
+	53:    dnsProbe("", 2),                              // DNS: NS query for the root zone
+	69:    tftpProbe(),                                  // TFTP: read request, any error reply means open
+	123:   ntpProbe(),                                   // NTP: version 4 client request
+	137:   netbiosProbe(),                               // NetBIOS: node status request
+	161:   snmpProbe("public"),                          // SNMP: v1 get sysDescr.0
+	500:   ikeProbe(),                                   // IKE: main mode SA proposal
+	1434:  {0x02},                                       // MS-SQL browser: client broadcast request
+	1900:  ssdpProbe(),                                  // SSDP: M-SEARCH discovery
+	5353:  dnsProbe("_services._dns-sd._udp.local", 12), // mDNS: service enumeration
+	11211: memcachedProbe(),                             // Memcached: stats over the UDP frame header
+}
+
+// UDPProbe returns the payload sent to a UDP port. Ports without a dedicated
+// probe receive an empty datagram.
+func UDPProbe(port int) []byte {
+	if payload, ok := udpProbes[port]; ok {
+		return payload
+	}
+	return []byte{}
+}
+
+// ScanUDPPort probes a single UDP port and classifies it from the response:
+// any reply means open, an ICMP port unreachable (surfaced as ECONNREFUSED on a
+// connected socket) means closed, ICMP host or network unreachable means
+// unreachable, and silence means open|filtered.
+func ScanUDPPort(ctx context.Context, host string, port int, timeout time.Duration, retryCount int) PortResult {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	payload := UDPProbe(port)
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return PortResult{Port: port, State: classifyUDPError(err)}
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	var latency time.Duration
+
+	// UDP has no retransmission of its own, so resend the probe on silence
+	for attempt := 0; attempt <= retryCount; attempt++ {
+		select {
+		case <-ctx.Done():
+			return PortResult{Port: port, State: models.PortStateOpenFiltered, Latency: latency}
+		default:
+		}
+
+		start := time.Now()
+		if _, err := conn.Write(payload); err != nil {
+			if state := classifyUDPError(err); state != models.PortStateOpenFiltered {
+				return PortResult{Port: port, State: state, Latency: time.Since(start)}
+			}
+			continue
+		}
+
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		_, err := conn.Read(buf)
+		latency = time.Since(start)
+
+		if err == nil {
+			return PortResult{Port: port, State: models.PortStateOpen, Latency: latency}
+		}
+		if state := classifyUDPError(err); state != models.PortStateOpenFiltered {
+			return PortResult{Port: port, State: state, Latency: latency}
+		}
+	}
+
+	return PortResult{Port: port, State: models.PortStateOpenFiltered, Latency: latency}
+}
+
+// classifyUDPError maps a socket error from a UDP probe to a port state.
+// Only ICMP errors are conclusive; everything else leaves the port ambiguous.
+func classifyUDPError(err error) string {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return models.PortStateClosed
+	}
+	if errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) {
+		return models.PortStateUnreachable
+	}
+	return models.PortStateOpenFiltered
+}
+
+// dnsProbe builds a standard recursive query for name with the given qtype
+func dnsProbe(name string, qtype uint16) []byte {
+	packet := []byte{
+		0x4e, 0x58, // Transaction ID
+		0x01, 0x00, // Standard query, recursion desired
+		0x00, 0x01, // One question
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	for _, label := range splitLabels(name) {
+		packet = append(packet, byte(len(label)))
+		packet = append(packet, label...)
+	}
+	packet = append(packet, 0x00)
+	packet = binary.BigEndian.AppendUint16(packet, qtype)
+	packet = binary.BigEndian.AppendUint16(packet, 1) // Class IN
+	return packet
+}
+
+func splitLabels(name string) []string {
+	var labels []string
+	start := 0
+	for i := 0; i <= len(name); i++ {
+		if i == len(name) || name[i] == '.' {
+			if i > start {
+				labels = append(labels, name[start:i])
+			}
+			start = i + 1
+		}
+	}
+	return labels
+}
+
+// ntpProbe builds an NTPv4 client mode request
+func ntpProbe() []byte {
+	packet := make([]byte, 48)
+	packet[0] = 0xe3 // LI unsynchronised, version 4, mode 3 (client)
+	return packet
+}
+
+// tftpProbe builds a read request for a file that almost certainly does not exist
+func tftpProbe() []byte {
+	packet := []byte{0x00, 0x01}
+	packet = append(packet, "nexusscan"...)
+	packet = append(packet, 0x00)
+	packet = append(packet, "octet"...)
+	return append(packet, 0x00)
+}
+
+// netbiosProbe builds a NetBIOS node status (NBSTAT) request for the wildcard name
+func netbiosProbe() []byte {
+	packet := []byte{
+		0x4e, 0x58, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x20, 'C', 'K',
+	}
+	for i := 0; i < 30; i++ {
+		packet = append(packet, 'A')
+	}
+	return append(packet, 0x00, 0x00, 0x21, 0x00, 0x01)
+}
+
+// snmpProbe builds an SNMPv1 GetRequest for sysDescr.0 (1.3.6.1.2.1.1.1.0)
+func snmpProbe(community string) []byte {
+	oid := []byte{0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00}
+
+	varbind := berTLV(0x30, append(berTLV(0x06, oid), 0x05, 0x00))
+	varbindList := berTLV(0x30, varbind)
+
+	pdu := berTLV(0x02, []byte{0x4e, 0x58, 0x53, 0x43}) // Request ID
+	pdu = append(pdu, berTLV(0x02, []byte{0x00})...)    // Error status
+	pdu = append(pdu, berTLV(0x02, []byte{0x00})...)    // Error index
+	pdu = append(pdu, varbindList...)
+
+	message := berTLV(0x02, []byte{0x00}) // Version 1
+	message = append(message, berTLV(0x04, []byte(community))...)
+	message = append(message, berTLV(0xa0, pdu)...)
+
+	return berTLV(0x30, message)
+}
+
+// berTLV encodes a short-form BER type-length-value triple
+func berTLV(tag byte, value []byte) []byte {
+	return append([]byte{tag, byte(len(value))}, value...)
+}
+
+// ikeProbe builds an IKEv1 main mode packet proposing 3DES/SHA1/PSK/MODP1024
+func ikeProbe() []byte {
+	attributes := []uint16{
+		0x8001, 0x0005, // Encryption: 3DES-CBC
+		0x8002, 0x0002, // Hash: SHA1
+		0x8003, 0x0001, // Authentication: pre-shared key
+		0x8004, 0x0002, // Group: MODP 1024
+		0x800b, 0x0001, // Life type: seconds
+		0x800c, 0x7080, // Life duration: 28800
+	}
+
+	transform := []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x00, 0x00}
+	for _, attr := range attributes {
+		transform = binary.BigEndian.AppendUint16(transform, attr)
+	}
+	binary.BigEndian.PutUint16(transform[2:], uint16(len(transform)))
+
+	proposal := []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x00, 0x01}
+	proposal = append(proposal, transform...)
+	binary.BigEndian.PutUint16(proposal[2:], uint16(len(proposal)))
+
+	sa := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}
+	sa = append(sa, proposal...)
+	binary.BigEndian.PutUint16(sa[2:], uint16(len(sa)))
+
+	header := []byte{
+		0x4e, 0x58, 0x53, 0x43, 0x41, 0x4e, 0x00, 0x01, // Initiator cookie
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // Responder cookie
+		0x01,                   // Next payload: SA
+		0x10,                   // Version 1.0
+		0x02,                   // Exchange: identity protection (main mode)
+		0x00,                   // Flags
+		0x00, 0x00, 0x00, 0x00, // Message ID
+		0x00, 0x00, 0x00, 0x00, // Length
+	}
+	packet := append(header, sa...)
+	binary.BigEndian.PutUint32(packet[24:], uint32(len(packet)))
+	return packet
+}
+
+// ssdpProbe builds an SSDP M-SEARCH request for all devices
+func ssdpProbe() []byte {
+	return []byte("M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: ssdp:all\r\n\r\n")
+}
+
+// memcachedProbe builds a "stats" command behind the memcached UDP frame header
+func memcachedProbe() []byte {
+	packet := []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}
+	return append(packet, "stats\r\n"...)
+}
@@ -0,0 +1,201 @@
+// pkg/scanner/udp_test.go
+
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/models"
+)
+
+// udpListener listens on a loopback port and hands every datagram to reply,
+// answering with what it returns unless that is nil. It returns the port
+// and a count of the datagrams received.
+func udpListener(t *testing.T, reply func(payload []byte) []byte) (int, *int32) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var received int32
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&received, 1)
+			if response := reply(buf[:n]); response != nil {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port, &received
+}
+
+// closedUDPPort returns a loopback port nothing listens on
+func closedUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+	return port
+}
+
+func TestScanUDPPort(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	echo := func(payload []byte) []byte { return append([]byte("reply:"), payload...) }
+	silent := func([]byte) []byte { return nil }
+
+	t.Run("open", func(t *testing.T) {
+		port, received := udpListener(t, echo)
+		result := ScanUDPPort(context.Background(), "127.0.0.1", port, timeout, 2)
+		if result.State != models.PortStateOpen || result.Port != port {
+			t.Errorf("got port %d %s, want %d open", result.Port, result.State, port)
+		}
+		if n := atomic.LoadInt32(received); n != 1 {
+			t.Errorf("sent %d probes to an open port, want 1", n)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		// The kernel answers with ICMP port unreachable, which the connected
+		// socket surfaces as ECONNREFUSED
+		result := ScanUDPPort(context.Background(), "127.0.0.1", closedUDPPort(t), timeout, 2)
+		if result.State != models.PortStateClosed {
+			t.Errorf("got %s, want closed", result.State)
+		}
+	})
+
+	t.Run("open|filtered", func(t *testing.T) {
+		port, received := udpListener(t, silent)
+		result := ScanUDPPort(context.Background(), "127.0.0.1", port, timeout, 2)
+		if result.State != models.PortStateOpenFiltered {
+			t.Errorf("got %s, want open|filtered", result.State)
+		}
+		// Give the last probe time to arrive before counting
+		time.Sleep(50 * time.Millisecond)
+		if n := atomic.LoadInt32(received); n != 3 {
+			t.Errorf("sent %d probes with 2 retries, want 3", n)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		port, received := udpListener(t, silent)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		result := ScanUDPPort(ctx, "127.0.0.1", port, timeout, 2)
+		if result.State != models.PortStateOpenFiltered {
+			t.Errorf("got %s, want open|filtered", result.State)
+		}
+		if n := atomic.LoadInt32(received); n != 0 {
+			t.Errorf("sent %d probes after cancellation, want 0", n)
+		}
+	})
+}
+
+func TestUDPProbe(t *testing.T) {
+	if payload := UDPProbe(40000); payload == nil || len(payload) != 0 {
+		t.Errorf("port without a probe: got %v, want an empty datagram", payload)
+	}
+	for port, want := range udpProbes {
+		if got := UDPProbe(port); !bytes.Equal(got, want) {
+			t.Errorf("port %d: got %x, want %x", port, got, want)
+		}
+	}
+}
+
+func TestDNSProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		qname    string
+		qtype    uint16
+		question []byte
+	}{
+		{name: "root NS", qname: "", qtype: 2, question: []byte{0x00}},
+		{name: "trailing dot", qname: "example.com.", qtype: 1, question: []byte("\x07example\x03com\x00")},
+		{
+			name:     "DNS-SD services",
+			qname:    "_services._dns-sd._udp.local",
+			qtype:    12,
+			question: []byte("\x09_services\x07_dns-sd\x04_udp\x05local\x00"),
+		},
+	}
+
+	for _, tt := range tests {
+		packet := dnsProbe(tt.qname, tt.qtype)
+		want := []byte{0x4e, 0x58, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+		want = append(want, tt.question...)
+		want = binary.BigEndian.AppendUint16(want, tt.qtype)
+		want = append(want, 0x00, 0x01)
+		if !bytes.Equal(packet, want) {
+			t.Errorf("%s: got %x, want %x", tt.name, packet, want)
+		}
+	}
+}
+
+func TestNTPProbe(t *testing.T) {
+	packet := ntpProbe()
+	if len(packet) != 48 {
+		t.Fatalf("got %d bytes, want 48", len(packet))
+	}
+	if version, mode := packet[0]>>3&0x07, packet[0]&0x07; version != 4 || mode != 3 {
+		t.Errorf("got version %d mode %d, want version 4 mode 3", version, mode)
+	}
+	if !bytes.Equal(packet[1:], make([]byte, 47)) {
+		t.Errorf("got %x after the first byte, want zeros", packet[1:])
+	}
+}
+
+func TestSNMPProbe(t *testing.T) {
+	var message struct {
+		Version   int
+		Community []byte
+		PDU       asn1.RawValue
+	}
+	rest, err := asn1.Unmarshal(snmpProbe("public"), &message)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("not a BER sequence: %v, %d trailing bytes", err, len(rest))
+	}
+	if message.Version != 0 || string(message.Community) != "public" {
+		t.Errorf("got version %d community %q, want 0 and public", message.Version, message.Community)
+	}
+	if message.PDU.Class != asn1.ClassContextSpecific || message.PDU.Tag != 0 {
+		t.Fatalf("got PDU class %d tag %d, want a GetRequest", message.PDU.Class, message.PDU.Tag)
+	}
+
+	var pdu struct {
+		RequestID   int
+		ErrorStatus int
+		ErrorIndex  int
+		Bindings    []struct {
+			Name  asn1.ObjectIdentifier
+			Value asn1.RawValue
+		}
+	}
+	if _, err := asn1.UnmarshalWithParams(message.PDU.FullBytes, &pdu, "tag:0"); err != nil {
+		t.Fatalf("malformed GetRequest: %v", err)
+	}
+	if pdu.ErrorStatus != 0 || pdu.ErrorIndex != 0 || len(pdu.Bindings) != 1 {
+		t.Fatalf("got %+v, want one binding and no error", pdu)
+	}
+	if sysDescr := (asn1.ObjectIdentifier{1, 3, 6, 1, 2, 1, 1, 1, 0}); !pdu.Bindings[0].Name.Equal(sysDescr) {
+		t.Errorf("got OID %v, want %v", pdu.Bindings[0].Name, sysDescr)
+	}
+	if value := pdu.Bindings[0].Value; value.Tag != asn1.TagNull || len(value.Bytes) != 0 {
+		t.Errorf("got value tag %d, want NULL", value.Tag)
+	}
+}
@@ -0,0 +1,294 @@
+// pkg/targets/targets.go
+
+package targets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// DefaultMaxTargets bounds how many addresses a single request may expand to
+const DefaultMaxTargets = 4096
+
+// ErrTooManyTargets is returned when an expansion exceeds the target limit
+var ErrTooManyTargets = errors.New("too many targets")
+
+// Target is a single address produced by expanding a target specification
+type Target struct {
+	IPAddress string `json:"ip"`
+	Network   string `json:"network,omitempty"`  // CIDR block or range the address came from
+	Hostname  string `json:"hostname,omitempty"` // DNS name the address was resolved from
+}
+
+// Options controls target expansion
+type Options struct {
+	MaxTargets int      // Defaults to DefaultMaxTargets
+	Exclude    []string // Addresses, CIDR blocks or ranges to leave out
+}
+
+// addrRange is an inclusive range of addresses of the same family
+type addrRange struct {
+	first netip.Addr
+	last  netip.Addr
+}
+
+func (r addrRange) contains(addr netip.Addr) bool {
+	return addr.BitLen() == r.first.BitLen() && r.first.Compare(addr) <= 0 && addr.Compare(r.last) <= 0
+}
+
+// CanonicalIP validates an IP address and returns its canonical text form:
+// IPv6 is lowercased and zero-compressed, and IPv4-mapped IPv6 addresses
+// (::ffff:10.0.0.1) are reduced to plain IPv4 so both spellings refer to the
+// same inventory entry. Zoned addresses are rejected since a zone only has
+// meaning on the host that wrote it.
+func CanonicalIP(ipAddress string) (string, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ipAddress))
+	if err != nil {
+		return "", fmt.Errorf("invalid IP address %q", ipAddress)
+	}
+	if addr.Zone() != "" {
+		return "", fmt.Errorf("invalid IP address %q: zones are not supported", ipAddress)
+	}
+	return addr.Unmap().String(), nil
+}
+
+// IsSingleAddress reports whether spec is a plain IP address rather than a
+// block, range or hostname
+func IsSingleAddress(spec string) bool {
+	_, err := netip.ParseAddr(strings.TrimSpace(spec))
+	return err == nil
+}
+
+// ValidateMatch checks that spec is an address, CIDR block or dash range
+// that Match can compare addresses against
+func ValidateMatch(spec string) error {
+	if _, _, err := parseRange(strings.TrimSpace(spec)); err != nil {
+		return fmt.Errorf("invalid address, CIDR block or range %q: %w", spec, err)
+	}
+	return nil
+}
+
+// Match reports whether ipAddress is spec or falls within the CIDR block or
+// dash range spec. Invalid values match nothing.
+func Match(spec string, ipAddress string) bool {
+	r, _, err := parseRange(strings.TrimSpace(spec))
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(ipAddress)
+	if err != nil {
+		return false
+	}
+	return r.contains(addr.Unmap())
+}
+
+// Expand turns IP addresses, CIDR blocks (10.0.0.0/24), dash ranges
+// (10.0.0.1-10.0.0.50 or 10.0.0.1-50) and DNS names into individual targets.
+// Duplicates are dropped, excluded addresses are skipped and the total is
+// checked against the limit before any block is enumerated.
+func Expand(ctx context.Context, specs []string, opts Options) ([]Target, error) {
+	maxTargets := opts.MaxTargets
+	if maxTargets <= 0 {
+		maxTargets = DefaultMaxTargets
+	}
+
+	var excluded []addrRange
+	for _, spec := range opts.Exclude {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		r, _, err := parseRange(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclusion %q: %w", spec, err)
+		}
+		excluded = append(excluded, r)
+	}
+
+	var result []Target
+	seen := make(map[netip.Addr]bool)
+
+	add := func(addr netip.Addr, network string, hostname string) error {
+		addr = addr.Unmap()
+		if seen[addr] {
+			return nil
+		}
+		for _, r := range excluded {
+			if r.contains(addr) {
+				return nil
+			}
+		}
+		if len(result) >= maxTargets {
+			return fmt.Errorf("%w: more than %d addresses", ErrTooManyTargets, maxTargets)
+		}
+		seen[addr] = true
+		result = append(result, Target{IPAddress: addr.String(), Network: network, Hostname: hostname})
+		return nil
+	}
+
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		// Plain address
+		if addr, err := netip.ParseAddr(spec); err == nil {
+			if addr.Zone() != "" {
+				return nil, fmt.Errorf("invalid target %q: zones are not supported", spec)
+			}
+			if err := add(addr, "", ""); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// CIDR block or dash range
+		if r, network, err := parseRange(spec); err == nil {
+			if size := rangeSize(r.first, r.last); size > uint64(maxTargets) {
+				return nil, fmt.Errorf("%w: %s contains %d addresses, limit is %d",
+					ErrTooManyTargets, spec, size, maxTargets)
+			}
+			for addr := r.first; ; addr = addr.Next() {
+				if err := add(addr, network, ""); err != nil {
+					return nil, err
+				}
+				if addr == r.last {
+					break
+				}
+			}
+			continue
+		} else if strings.ContainsAny(spec, "/:") || looksLikeRange(spec) {
+			return nil, fmt.Errorf("invalid target %q: %w", spec, err)
+		}
+
+		// Anything else must be a DNS name
+		if !isValidHostname(spec) {
+			return nil, fmt.Errorf("invalid target %q", spec)
+		}
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", spec)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", spec, err)
+		}
+		for _, addr := range addrs {
+			if err := add(addr, "", strings.ToLower(strings.TrimSuffix(spec, "."))); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// parseRange parses an address, CIDR block or dash range into an inclusive
+// range and returns the canonical network label for it. For IPv4 blocks
+// larger than /31 the network and broadcast addresses are left out.
+func parseRange(spec string) (addrRange, string, error) {
+	if addr, err := netip.ParseAddr(spec); err == nil {
+		return addrRange{first: addr, last: addr}, "", nil
+	}
+
+	if strings.Contains(spec, "/") {
+		prefix, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return addrRange{}, "", err
+		}
+		prefix = prefix.Masked()
+		first, last := prefix.Addr(), lastAddr(prefix)
+		if first.Is4() && prefix.Bits() < 31 {
+			first, last = first.Next(), last.Prev()
+		}
+		return addrRange{first: first, last: last}, prefix.String(), nil
+	}
+
+	if i := strings.Index(spec, "-"); i > 0 {
+		first, err := netip.ParseAddr(strings.TrimSpace(spec[:i]))
+		if err != nil {
+			return addrRange{}, "", err
+		}
+		end := strings.TrimSpace(spec[i+1:])
+
+		last, err := netip.ParseAddr(end)
+		if err != nil && first.Is4() {
+			// Short form: 10.0.0.1-50 replaces the last octet
+			last, err = netip.ParseAddr(spec[:strings.LastIndex(spec[:i], ".")+1] + end)
+		}
+		if err != nil {
+			return addrRange{}, "", fmt.Errorf("invalid range end %q", end)
+		}
+		if first.BitLen() != last.BitLen() || last.Less(first) {
+			return addrRange{}, "", fmt.Errorf("invalid range %s", spec)
+		}
+		return addrRange{first: first, last: last}, first.String() + "-" + last.String(), nil
+	}
+
+	return addrRange{}, "", fmt.Errorf("not an address, CIDR block or range")
+}
+
+// looksLikeRange reports whether spec starts with an IP address followed by a dash
+func looksLikeRange(spec string) bool {
+	i := strings.Index(spec, "-")
+	if i <= 0 {
+		return false
+	}
+	_, err := netip.ParseAddr(spec[:i])
+	return err == nil
+}
+
+// lastAddr returns the highest address in a masked prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().As16()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	for i := 15; i >= 0 && hostBits > 0; i-- {
+		if hostBits >= 8 {
+			bytes[i] = 0xff
+			hostBits -= 8
+		} else {
+			bytes[i] |= byte(1<<hostBits) - 1
+			hostBits = 0
+		}
+	}
+	addr := netip.AddrFrom16(bytes)
+	if prefix.Addr().Is4() {
+		return addr.Unmap()
+	}
+	return addr
+}
+
+// rangeSize returns the number of addresses in an inclusive range, saturating
+// at the maximum uint64
+func rangeSize(first, last netip.Addr) uint64 {
+	a, b := first.As16(), last.As16()
+	var hiA, hiB, loA, loB uint64
+	for i := 0; i < 8; i++ {
+		hiA, hiB = hiA<<8|uint64(a[i]), hiB<<8|uint64(b[i])
+		loA, loB = loA<<8|uint64(a[i+8]), loB<<8|uint64(b[i+8])
+	}
+	if hiA != hiB || loB-loA == ^uint64(0) {
+		return ^uint64(0)
+	}
+	return loB - loA + 1
+}
+
+// isValidHostname checks spec against the RFC 1123 hostname syntax
+func isValidHostname(spec string) bool {
+	name := strings.TrimSuffix(spec, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
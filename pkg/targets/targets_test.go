@@ -0,0 +1,244 @@
+// pkg/targets/targets_test.go
+
+package targets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "v4", input: "10.0.0.1", want: "10.0.0.1"},
+		{name: "v4 with spaces", input: " 192.168.1.20 ", want: "192.168.1.20"},
+		{name: "v6 compressed", input: "2001:db8::1", want: "2001:db8::1"},
+		{name: "v6 expanded", input: "2001:0db8:0000:0000:0000:0000:0000:0001", want: "2001:db8::1"},
+		{name: "v6 uppercase", input: "2001:DB8::ABCD", want: "2001:db8::abcd"},
+		{name: "v6 loopback", input: "::1", want: "::1"},
+		{name: "v4-mapped", input: "::ffff:10.0.0.1", want: "10.0.0.1"},
+		{name: "v4-mapped hex", input: "::ffff:a00:1", want: "10.0.0.1"},
+		{name: "v4-mapped uppercase", input: "::FFFF:192.168.0.1", want: "192.168.0.1"},
+		{name: "zoned v6", input: "fe80::1%eth0", wantErr: true},
+		{name: "hostname", input: "example.com", wantErr: true},
+		{name: "cidr", input: "10.0.0.0/24", wantErr: true},
+		{name: "v4 with port", input: "10.0.0.1:80", wantErr: true},
+		{name: "bracketed v6", input: "[2001:db8::1]", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalIP(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("CanonicalIP(%q) = %q, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CanonicalIP(%q) error: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("CanonicalIP(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		first, last string
+		network     string
+		wantErr     bool
+	}{
+		{name: "v4 address", spec: "10.0.0.1", first: "10.0.0.1", last: "10.0.0.1"},
+		{name: "v4 /24 skips network and broadcast", spec: "10.0.0.0/24", first: "10.0.0.1", last: "10.0.0.254", network: "10.0.0.0/24"},
+		{name: "v4 /31 keeps both", spec: "10.0.0.0/31", first: "10.0.0.0", last: "10.0.0.1", network: "10.0.0.0/31"},
+		{name: "v4 /32", spec: "10.0.0.7/32", first: "10.0.0.7", last: "10.0.0.7", network: "10.0.0.7/32"},
+		{name: "v4 unmasked block", spec: "10.0.0.77/30", first: "10.0.0.77", last: "10.0.0.78", network: "10.0.0.76/30"},
+		{name: "v4 range", spec: "10.0.0.1-10.0.0.50", first: "10.0.0.1", last: "10.0.0.50", network: "10.0.0.1-10.0.0.50"},
+		{name: "v4 short range", spec: "10.0.0.1-50", first: "10.0.0.1", last: "10.0.0.50", network: "10.0.0.1-10.0.0.50"},
+		{name: "v6 address", spec: "2001:db8::1", first: "2001:db8::1", last: "2001:db8::1"},
+		{name: "v6 /126 keeps all", spec: "2001:db8::/126", first: "2001:db8::", last: "2001:db8::3", network: "2001:db8::/126"},
+		{name: "v6 /120", spec: "2001:db8::100/120", first: "2001:db8::100", last: "2001:db8::1ff", network: "2001:db8::100/120"},
+		{name: "v6 range", spec: "2001:db8::1-2001:db8::a", first: "2001:db8::1", last: "2001:db8::a", network: "2001:db8::1-2001:db8::a"},
+		{name: "v4-mapped address", spec: "::ffff:10.0.0.1", first: "::ffff:10.0.0.1", last: "::ffff:10.0.0.1"},
+		{name: "v6 short range", spec: "2001:db8::1-a", wantErr: true},
+		{name: "mixed family range", spec: "10.0.0.1-2001:db8::1", wantErr: true},
+		{name: "reversed range", spec: "10.0.0.50-10.0.0.1", wantErr: true},
+		{name: "bad prefix", spec: "10.0.0.0/33", wantErr: true},
+		{name: "hostname", spec: "example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, network, err := parseRange(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRange(%q) = %s-%s, want error", tt.spec, r.first, r.last)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRange(%q) error: %v", tt.spec, err)
+			}
+			if r.first.String() != tt.first || r.last.String() != tt.last {
+				t.Errorf("parseRange(%q) = %s-%s, want %s-%s", tt.spec, r.first, r.last, tt.first, tt.last)
+			}
+			if network != tt.network {
+				t.Errorf("parseRange(%q) network = %q, want %q", tt.spec, network, tt.network)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		spec string
+		ip   string
+		want bool
+	}{
+		{spec: "10.0.0.0/24", ip: "10.0.0.5", want: true},
+		{spec: "10.0.0.0/24", ip: "10.0.1.5", want: false},
+		{spec: "10.0.0.0/24", ip: "::ffff:10.0.0.5", want: true},
+		{spec: "10.0.0.1-10.0.0.9", ip: "10.0.0.9", want: true},
+		{spec: "2001:db8::/64", ip: "2001:db8::abcd", want: true},
+		{spec: "2001:db8::/64", ip: "2001:db9::1", want: false},
+		{spec: "2001:db8::/64", ip: "10.0.0.1", want: false},
+		{spec: "10.0.0.0/8", ip: "2001:db8::1", want: false},
+		{spec: "not-a-range", ip: "10.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.spec, tt.ip); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.spec, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		opts    Options
+		want    []Target
+		wantErr error
+	}{
+		{
+			name:  "v4 addresses",
+			specs: []string{"10.0.0.1", "10.0.0.2"},
+			want:  []Target{{IPAddress: "10.0.0.1"}, {IPAddress: "10.0.0.2"}},
+		},
+		{
+			name:  "v6 address is canonicalised",
+			specs: []string{"2001:0DB8::0001"},
+			want:  []Target{{IPAddress: "2001:db8::1"}},
+		},
+		{
+			name:  "v4-mapped address is unmapped",
+			specs: []string{"::ffff:10.0.0.1"},
+			want:  []Target{{IPAddress: "10.0.0.1"}},
+		},
+		{
+			name:  "v4 and v4-mapped spellings are one target",
+			specs: []string{"10.0.0.1", "::ffff:10.0.0.1", "::ffff:a00:1"},
+			want:  []Target{{IPAddress: "10.0.0.1"}},
+		},
+		{
+			name:  "v4 block",
+			specs: []string{"10.0.0.0/30"},
+			want:  []Target{{IPAddress: "10.0.0.1", Network: "10.0.0.0/30"}, {IPAddress: "10.0.0.2", Network: "10.0.0.0/30"}},
+		},
+		{
+			name:  "v6 block",
+			specs: []string{"2001:db8::/127"},
+			want:  []Target{{IPAddress: "2001:db8::", Network: "2001:db8::/127"}, {IPAddress: "2001:db8::1", Network: "2001:db8::/127"}},
+		},
+		{
+			name:  "v6 range",
+			specs: []string{"2001:db8::fe-2001:db8::101"},
+			want: []Target{
+				{IPAddress: "2001:db8::fe", Network: "2001:db8::fe-2001:db8::101"},
+				{IPAddress: "2001:db8::ff", Network: "2001:db8::fe-2001:db8::101"},
+				{IPAddress: "2001:db8::100", Network: "2001:db8::fe-2001:db8::101"},
+				{IPAddress: "2001:db8::101", Network: "2001:db8::fe-2001:db8::101"},
+			},
+		},
+		{
+			name:  "v4-mapped block is unmapped",
+			specs: []string{"::ffff:10.0.0.0/127"},
+			want:  []Target{{IPAddress: "10.0.0.0", Network: "::ffff:10.0.0.0/127"}, {IPAddress: "10.0.0.1", Network: "::ffff:10.0.0.0/127"}},
+		},
+		{
+			name:  "v4 short range with exclusion",
+			specs: []string{"10.0.0.1-4"},
+			opts:  Options{Exclude: []string{"10.0.0.2", "10.0.0.3"}},
+			want:  []Target{{IPAddress: "10.0.0.1", Network: "10.0.0.1-10.0.0.4"}, {IPAddress: "10.0.0.4", Network: "10.0.0.1-10.0.0.4"}},
+		},
+		{
+			name:  "v6 exclusion block",
+			specs: []string{"2001:db8::1", "2001:db8::1:1"},
+			opts:  Options{Exclude: []string{"2001:db8::/112"}},
+			want:  []Target{{IPAddress: "2001:db8::1:1"}},
+		},
+		{
+			name:  "v4 exclusion does not hide v6",
+			specs: []string{"2001:db8::1"},
+			opts:  Options{Exclude: []string{"0.0.0.0/0"}},
+			want:  []Target{{IPAddress: "2001:db8::1"}},
+		},
+		{
+			name:    "v6 block over the limit",
+			specs:   []string{"2001:db8::/64"},
+			wantErr: ErrTooManyTargets,
+		},
+		{
+			name:    "addresses over the limit",
+			specs:   []string{"10.0.0.1", "2001:db8::1"},
+			opts:    Options{MaxTargets: 1},
+			wantErr: ErrTooManyTargets,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(context.Background(), tt.specs, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expand(%q) error = %v, want %v", tt.specs, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expand(%q) error: %v", tt.specs, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expand(%q) = %+v, want %+v", tt.specs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandRejects(t *testing.T) {
+	specs := []string{
+		"fe80::1%eth0",
+		"2001:db8::/129",
+		"2001:db8::1-10.0.0.1",
+		"10.0.0.1-foo",
+		"bad_host!name",
+	}
+	for _, spec := range specs {
+		if got, err := Expand(context.Background(), []string{spec}, Options{}); err == nil {
+			t.Errorf("Expand(%q) = %+v, want error", spec, got)
+		}
+	}
+}
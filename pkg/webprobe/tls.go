@@ -0,0 +1,141 @@
+// pkg/webprobe/tls.go
+
+package webprobe
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// tlsData describes a TLS connection and the certificates the server
+// presented. The leaf certificate fills the flat fields, as httpx did, and
+// the whole chain is kept in Chain.
+func tlsData(state tls.ConnectionState, target Target, port int) database.TLSData {
+	data := database.TLSData{
+		Version:       VersionName(state.Version),
+		Cipher:        tls.CipherSuiteName(state.CipherSuite),
+		TLSConnection: "ctls",
+		Host:          target.IPAddress,
+		Port:          strconv.Itoa(port),
+		ProbeStatus:   true,
+	}
+	if len(state.PeerCertificates) == 0 {
+		return data
+	}
+
+	leaf := state.PeerCertificates[0]
+	data.NotBefore = leaf.NotBefore.UTC().Format(time.RFC3339)
+	data.NotAfter = leaf.NotAfter.UTC().Format(time.RFC3339)
+	data.Expired = time.Now().After(leaf.NotAfter)
+	data.SelfSigned = SelfSigned(leaf)
+	data.Mismatched = target.Hostname != "" && leaf.VerifyHostname(target.Hostname) != nil
+	data.SubjectDN = leaf.Subject.String()
+	data.SubjectCN = leaf.Subject.CommonName
+	data.SubjectOrg = leaf.Subject.Organization
+	data.SubjectAN = subjectAltNames(leaf)
+	data.Serial = serialNumber(leaf)
+	data.IssuerDN = leaf.Issuer.String()
+	data.IssuerCN = leaf.Issuer.CommonName
+	data.IssuerOrg = leaf.Issuer.Organization
+	data.FingerprintHash = map[string]string{
+		"md5":    fmt.Sprintf("%x", md5.Sum(leaf.Raw)),
+		"sha1":   fmt.Sprintf("%x", sha1.Sum(leaf.Raw)),
+		"sha256": fmt.Sprintf("%x", sha256.Sum256(leaf.Raw)),
+	}
+
+	for _, cert := range state.PeerCertificates {
+		data.Chain = append(data.Chain, Certificate(cert))
+	}
+	return data
+}
+
+// Certificate describes one certificate of a chain
+func Certificate(cert *x509.Certificate) database.TLSCertificate {
+	algorithm, bits := publicKey(cert)
+	return database.TLSCertificate{
+		SubjectDN:          cert.Subject.String(),
+		SubjectCN:          cert.Subject.CommonName,
+		SubjectAN:          subjectAltNames(cert),
+		IssuerDN:           cert.Issuer.String(),
+		IssuerCN:           cert.Issuer.CommonName,
+		Serial:             serialNumber(cert),
+		NotBefore:          cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:           cert.NotAfter.UTC().Format(time.RFC3339),
+		KeyAlgorithm:       algorithm,
+		KeyBits:            bits,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		IsCA:               cert.IsCA,
+		SelfSigned:         SelfSigned(cert),
+		FingerprintSHA256:  fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+	}
+}
+
+// VersionName names a TLS version the way httpx did, such as tls12
+func VersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "tls10"
+	case tls.VersionTLS11:
+		return "tls11"
+	case tls.VersionTLS12:
+		return "tls12"
+	case tls.VersionTLS13:
+		return "tls13"
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// SelfSigned reports whether a certificate is its own issuer and signed
+// with its own key
+func SelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	names := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
+
+// serialNumber formats a serial as colon separated hex bytes
+func serialNumber(cert *x509.Certificate) string {
+	if cert.SerialNumber == nil {
+		return ""
+	}
+	raw := cert.SerialNumber.Bytes()
+	parts := make([]string, len(raw))
+	for i, b := range raw {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func publicKey(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	}
+	return cert.PublicKeyAlgorithm.String(), 0
+}
@@ -0,0 +1,294 @@
+// pkg/webprobe/webprobe.go
+
+// Package webprobe fetches the web services on open ports: their status,
+// title, headers, redirects and content hash, and the certificate chain of
+// those served over TLS
+package webprobe
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Elite-Security-Systems/nexusscan/pkg/database"
+)
+
+// Probe defaults
+const (
+	DefaultConcurrency  = 25
+	DefaultTimeout      = 10 * time.Second
+	DefaultMaxRedirects = 5
+	DefaultMaxBodyBytes = 1 << 20
+	DefaultUserAgent    = "Mozilla/5.0 (compatible; nexusscan)"
+
+	maxTitleLength = 256
+)
+
+// Options controls how hard a host is probed
+type Options struct {
+	Concurrency  int           // Requests in flight at once
+	Timeout      time.Duration // Limit on each request, redirects included
+	MaxRedirects int           // Redirects followed on the same host, negative for none
+	MaxBodyBytes int64         // Body read for the title and content hash
+	UserAgent    string
+}
+
+// withDefaults fills the options left unset
+func (o Options) withDefaults() Options {
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.MaxRedirects == 0 {
+		o.MaxRedirects = DefaultMaxRedirects
+	}
+	if o.MaxBodyBytes <= 0 {
+		o.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if o.UserAgent == "" {
+		o.UserAgent = DefaultUserAgent
+	}
+	return o
+}
+
+// Target is the host whose ports are probed
+type Target struct {
+	IPAddress string
+	Hostname  string // Sent as the Host header and TLS server name when set
+}
+
+// schemes are tried on every port, since a web service can speak either on
+// any port
+var schemes = []string{"http", "https"}
+
+// Probe requests / over http and https on every port and returns a result
+// for each that answered, in the order of ports, http first. Requests that
+// fail leave no result.
+func Probe(ctx context.Context, target Target, ports []int, opts Options) []database.HttpxResult {
+	opts = opts.withDefaults()
+
+	found := make([]*database.HttpxResult, len(ports)*len(schemes))
+	slots := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+
+	for i, port := range ports {
+		for j, scheme := range schemes {
+			wg.Add(1)
+			go func(index int, scheme string, port int) {
+				defer wg.Done()
+
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-slots }()
+
+				result, err := fetch(ctx, target, scheme, port, opts)
+				if err != nil {
+					return
+				}
+				found[index] = &result
+			}(i*len(schemes)+j, scheme, port)
+		}
+	}
+	wg.Wait()
+
+	results := make([]database.HttpxResult, 0, len(found))
+	for _, result := range found {
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results
+}
+
+// fetch requests / on one port. Redirects are followed while they stay on
+// the host, and the result describes the page they end at. The location,
+// TLS connection and certificates are those of the first response, which
+// is what the port itself serves.
+func fetch(ctx context.Context, target Target, scheme string, port int, opts Options) (database.HttpxResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	transport := &http.Transport{
+		// Names are never resolved: every connection goes to the IP probed
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(target.IPAddress, port))
+		},
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true, // Certificates are recorded, not trusted
+			ServerName:         target.Hostname,
+			MinVersion:         tls.VersionTLS10,
+		},
+		TLSHandshakeTimeout:    opts.Timeout,
+		DisableKeepAlives:      true,
+		MaxResponseHeaderBytes: 64 << 10,
+	}
+	defer transport.CloseIdleConnections()
+
+	var first *http.Response
+	var chain []string
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if first == nil {
+				first = req.Response
+			}
+			if opts.MaxRedirects < 0 || len(via) > opts.MaxRedirects || !target.owns(req.URL.Hostname()) {
+				return http.ErrUseLastResponse
+			}
+			chain = append(chain, req.URL.String())
+			return nil
+		},
+	}
+
+	hostPort := net.JoinHostPort(target.IPAddress, strconv.Itoa(port))
+	address := scheme + "://" + hostPort
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+"/", nil)
+	if err != nil {
+		return database.HttpxResult{}, err
+	}
+	if target.Hostname != "" {
+		req.Host = target.Hostname
+		if port != defaultPort(scheme) {
+			req.Host = net.JoinHostPort(target.Hostname, strconv.Itoa(port))
+		}
+	}
+	req.Header.Set("User-Agent", opts.UserAgent)
+	req.Header.Set("Accept", "*/*")
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return database.HttpxResult{}, err
+	}
+	defer resp.Body.Close()
+
+	// A body cut short still gives a title and hash for what arrived
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, opts.MaxBodyBytes))
+	elapsed := time.Since(started)
+
+	if first == nil {
+		first = resp
+	}
+
+	result := database.HttpxResult{
+		URL:             address,
+		Input:           address,
+		StatusCode:      resp.StatusCode,
+		Title:           pageTitle(body),
+		Location:        first.Header.Get("Location"),
+		ServerHeader:    resp.Header.Get("Server"),
+		ContentType:     mediaType(resp.Header.Get("Content-Type")),
+		ContentLength:   len(body),
+		Host:            target.IPAddress,
+		Path:            "/",
+		Scheme:          scheme,
+		Port:            strconv.Itoa(port),
+		ResponseTime:    elapsed.Round(time.Microsecond).String(),
+		Words:           len(strings.Fields(string(body))),
+		Lines:           lineCount(body),
+		Method:          http.MethodGet,
+		ResponseHeaders: responseHeaders(resp.Header),
+		Hash:            bodyHashes(body),
+		Chain:           chain,
+		Timestamp:       time.Now().UTC().Format(time.RFC3339),
+	}
+	if resp.ContentLength > int64(len(body)) {
+		result.ContentLength = int(resp.ContentLength)
+	}
+	if first.TLS != nil {
+		result.TLS = tlsData(*first.TLS, target, port)
+	}
+	return result, nil
+}
+
+// owns reports whether a redirect to host stays on the target
+func (t Target) owns(host string) bool {
+	if strings.EqualFold(host, t.Hostname) && t.Hostname != "" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.Equal(net.ParseIP(t.IPAddress))
+}
+
+func defaultPort(scheme string) int {
+	if scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// pageTitle returns the text of the title element, with entities decoded
+// and whitespace collapsed
+func pageTitle(body []byte) string {
+	match := titlePattern.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	title := strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength])
+	}
+	return title
+}
+
+// mediaType drops the parameters of a Content-Type
+func mediaType(contentType string) string {
+	if parsed, _, err := mime.ParseMediaType(contentType); err == nil {
+		return parsed
+	}
+	return strings.TrimSpace(contentType)
+}
+
+func lineCount(body []byte) int {
+	if len(body) == 0 {
+		return 0
+	}
+	return strings.Count(string(body), "\n") + 1
+}
+
+// responseHeaders flattens headers to lower case names with their values
+// joined
+func responseHeaders(header http.Header) map[string]string {
+	if len(header) == 0 {
+		return nil
+	}
+	flat := make(map[string]string, len(header))
+	for name, values := range header {
+		flat[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	return flat
+}
+
+// bodyHashes identifies identical pages across hosts and scans
+func bodyHashes(body []byte) map[string]string {
+	sum := sha256.Sum256(body)
+	return map[string]string{
+		"body_md5":    fmt.Sprintf("%x", md5.Sum(body)),
+		"body_sha256": hex.EncodeToString(sum[:]),
+	}
+}
@@ -0,0 +1,280 @@
+// pkg/webprobe/webprobe_test.go
+
+package webprobe
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serverPort returns the port a test server listens on
+func serverPort(t *testing.T, srv *httptest.Server) int {
+	t.Helper()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestFetch(t *testing.T) {
+	var host string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			host = r.Host
+			http.Redirect(w, r, "/login", http.StatusFound)
+		case "/login":
+			w.Header().Set("Server", "test/1.0")
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><head><title> Sign &amp; in </title></head>\n<body>Welcome back</body></html>")
+		}
+	}))
+	defer srv.Close()
+	port := serverPort(t, srv)
+
+	result, err := fetch(context.Background(), Target{IPAddress: "127.0.0.1"}, "http", port, Options{}.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := "http://127.0.0.1:" + strconv.Itoa(port)
+	if result.URL != address || result.Scheme != "http" || result.Port != strconv.Itoa(port) {
+		t.Errorf("result is for %s (%s, port %s), want %s", result.URL, result.Scheme, result.Port, address)
+	}
+	if host != "127.0.0.1:"+strconv.Itoa(port) {
+		t.Errorf("Host header = %q, want the IP and port", host)
+	}
+	// The result describes the page the redirect ends at, and the location
+	// the port itself answered with
+	if result.StatusCode != http.StatusOK || result.Title != "Sign & in" {
+		t.Errorf("status %d with title %q, want 200 with %q", result.StatusCode, result.Title, "Sign & in")
+	}
+	if result.Location != "/login" {
+		t.Errorf("location = %q, want /login", result.Location)
+	}
+	if want := []string{address + "/login"}; !reflect.DeepEqual(result.Chain, want) {
+		t.Errorf("chain = %v, want %v", result.Chain, want)
+	}
+	if result.ServerHeader != "test/1.0" || result.ContentType != "text/html" {
+		t.Errorf("server %q with content type %q, want test/1.0 with text/html", result.ServerHeader, result.ContentType)
+	}
+	if result.ResponseHeaders["server"] != "test/1.0" {
+		t.Errorf("response headers = %v, want server test/1.0", result.ResponseHeaders)
+	}
+	if result.Lines != 2 || result.Words != 7 {
+		t.Errorf("%d lines and %d words, want 2 and 7", result.Lines, result.Words)
+	}
+	body := "<html><head><title> Sign &amp; in </title></head>\n<body>Welcome back</body></html>"
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte(body))); result.Hash["body_sha256"] != want {
+		t.Errorf("body_sha256 = %s, want %s", result.Hash["body_sha256"], want)
+	}
+	if result.TLS.ProbeStatus {
+		t.Errorf("plain HTTP result has TLS data %+v", result.TLS)
+	}
+}
+
+func TestFetchRedirects(t *testing.T) {
+	var port int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+		case "/a":
+			http.Redirect(w, r, "http://www.example.com:"+strconv.Itoa(port)+"/b", http.StatusFound)
+		case "/b":
+			if !strings.HasPrefix(r.Host, "www.example.com") {
+				http.Redirect(w, r, "http://elsewhere.example.net/", http.StatusFound)
+				return
+			}
+			fmt.Fprint(w, "<title>b</title>")
+		}
+	}))
+	defer srv.Close()
+	port = serverPort(t, srv)
+	address := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	tests := []struct {
+		name       string
+		target     Target
+		opts       Options
+		wantStatus int
+		wantChain  []string
+	}{
+		{
+			// A redirect to a name the target does not have is not followed
+			name:       "off the host",
+			target:     Target{IPAddress: "127.0.0.1"},
+			wantStatus: http.StatusFound,
+			wantChain:  []string{address + "/a"},
+		},
+		{
+			name:       "to the target's hostname",
+			target:     Target{IPAddress: "127.0.0.1", Hostname: "www.example.com"},
+			wantStatus: http.StatusOK,
+			wantChain:  []string{address + "/a", "http://www.example.com:" + strconv.Itoa(port) + "/b"},
+		},
+		{
+			name:       "limited",
+			target:     Target{IPAddress: "127.0.0.1", Hostname: "www.example.com"},
+			opts:       Options{MaxRedirects: 1},
+			wantStatus: http.StatusFound,
+			wantChain:  []string{address + "/a"},
+		},
+		{
+			name:       "none",
+			target:     Target{IPAddress: "127.0.0.1"},
+			opts:       Options{MaxRedirects: -1},
+			wantStatus: http.StatusMovedPermanently,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := fetch(context.Background(), tt.target, "http", port, tt.opts.withDefaults())
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if result.StatusCode != tt.wantStatus || !reflect.DeepEqual(result.Chain, tt.wantChain) {
+			t.Errorf("%s: status %d after %v, want %d after %v", tt.name, result.StatusCode, result.Chain, tt.wantStatus, tt.wantChain)
+		}
+		if result.Location != "/a" {
+			t.Errorf("%s: location = %q, want the first response's /a", tt.name, result.Location)
+		}
+	}
+}
+
+func TestFetchBodyLimit(t *testing.T) {
+	body := "<title>big</title>" + strings.Repeat("x", 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	result, err := fetch(context.Background(), Target{IPAddress: "127.0.0.1"}, "http", serverPort(t, srv), Options{MaxBodyBytes: 100}.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Title != "big" || result.ContentLength != len(body) {
+		t.Errorf("title %q with content length %d, want big with %d", result.Title, result.ContentLength, len(body))
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte(body[:100]))); result.Hash["body_sha256"] != want {
+		t.Errorf("body_sha256 = %s, want the hash of the first 100 bytes", result.Hash["body_sha256"])
+	}
+}
+
+func TestFetchTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<title>secure</title>")
+	}))
+	defer srv.Close()
+	port := serverPort(t, srv)
+	cert := srv.Certificate()
+
+	tests := []struct {
+		target         Target
+		wantMismatched bool
+	}{
+		{target: Target{IPAddress: "127.0.0.1"}},
+		{target: Target{IPAddress: "127.0.0.1", Hostname: "example.com"}},
+		{target: Target{IPAddress: "127.0.0.1", Hostname: "www.example.org"}, wantMismatched: true},
+	}
+
+	for _, tt := range tests {
+		result, err := fetch(context.Background(), tt.target, "https", port, Options{}.withDefaults())
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.target, err)
+		}
+		data := result.TLS
+		if result.Title != "secure" || !data.ProbeStatus || data.Version != "tls13" {
+			t.Errorf("%+v: title %q over %q, want secure over tls13", tt.target, result.Title, data.Version)
+		}
+		if data.Mismatched != tt.wantMismatched {
+			t.Errorf("%+v: mismatched = %v, want %v", tt.target, data.Mismatched, tt.wantMismatched)
+		}
+		if want := fmt.Sprintf("%x", sha256.Sum256(cert.Raw)); data.FingerprintHash["sha256"] != want {
+			t.Errorf("%+v: sha256 fingerprint = %s, want %s", tt.target, data.FingerprintHash["sha256"], want)
+		}
+		if len(data.Chain) != 1 || data.Chain[0].FingerprintSHA256 != data.FingerprintHash["sha256"] {
+			t.Errorf("%+v: chain = %+v, want the leaf alone", tt.target, data.Chain)
+		}
+		if !reflect.DeepEqual(data.SubjectAN, subjectAltNames(cert)) || data.IssuerOrg[0] != cert.Issuer.Organization[0] {
+			t.Errorf("%+v: names %v issued by %v, want %v issued by %v", tt.target, data.SubjectAN, data.IssuerOrg, subjectAltNames(cert), cert.Issuer.Organization)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<title>plain</title>")
+	}))
+	defer srv.Close()
+	secure := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<title>secure</title>")
+	}))
+	secure.Config.ErrorLog = log.New(io.Discard, "", 0) // The plain HTTP request is expected to fail
+	secure.StartTLS()
+	defer secure.Close()
+
+	// A port with nothing listening leaves no result
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	ports := []int{serverPort(t, secure), closedPort, serverPort(t, srv)}
+	results := Probe(context.Background(), Target{IPAddress: "127.0.0.1"}, ports, Options{Concurrency: 2})
+
+	// The TLS server answers plain HTTP with an error page
+	var got []string
+	for _, result := range results {
+		got = append(got, fmt.Sprintf("%s:%s %d %s", result.Scheme, result.Port, result.StatusCode, result.Title))
+	}
+	want := []string{
+		fmt.Sprintf("http:%d 400 ", ports[0]),
+		fmt.Sprintf("https:%d 200 secure", ports[0]),
+		fmt.Sprintf("http:%d 200 plain", ports[2]),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %q, want %q", got, want)
+	}
+}
+
+func TestPageTitle(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{body: "<html><title>Home</title></html>", want: "Home"},
+		{body: "<TITLE lang=\"en\">\n  Admin\n\tConsole  </TITLE>", want: "Admin Console"},
+		{body: "<title>Tom &amp; Jerry&#39;s</title>", want: "Tom & Jerry's"},
+		{body: "<title>first</title><title>second</title>", want: "first"},
+		{body: "<title></title>", want: ""},
+		{body: "<title>never closed", want: ""},
+		{body: "no title", want: ""},
+		{body: "<title>" + strings.Repeat("é", 300) + "</title>", want: strings.Repeat("é", maxTitleLength)},
+	}
+
+	for _, tt := range tests {
+		if got := pageTitle([]byte(tt.body)); got != tt.want {
+			t.Errorf("pageTitle(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}